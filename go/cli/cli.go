@@ -34,6 +34,8 @@ func Run() {
 // 1. 默认/serve: 启动整套后端服务
 // 2. db init: 显式初始化数据库结构
 // 3. db migrate: 当前与 init 复用同一套过渡迁移逻辑
+// 4. db prune [--class metrics,logs]: 按保留策略手动清理过期数据
+// 5. ingress credentials create/rotate/revoke/list: 管理 protocol-ingress 的 adapter 凭据
 func RunWithArgs(ctx context.Context, args []string) error {
 	if len(args) == 0 {
 		return serve(ctx)
@@ -47,9 +49,17 @@ func RunWithArgs(ctx context.Context, args []string) error {
 		return serve(ctx)
 	case "db":
 		if len(args) < 2 {
-			return fmt.Errorf("db 子命令缺失，当前支持: init, migrate")
+			return fmt.Errorf("db 子命令缺失，当前支持: init, migrate, prune")
+		}
+		if args[1] == "prune" {
+			return runDBPruneCommand(ctx, args[2:])
 		}
 		return runDBCommand(args[1])
+	case "ingress":
+		if len(args) < 2 || args[1] != "credentials" {
+			return fmt.Errorf("ingress 子命令缺失，当前支持: credentials")
+		}
+		return runIngressCredentialCommand(args[2:])
 	default:
 		return fmt.Errorf("未知命令: %s", args[0])
 	}
@@ -111,27 +121,60 @@ func serve(ctx context.Context) error {
 	}
 
 	services := core.NewServicesWithConfig(runtimeStore, appCfg.DeviceManager)
+	if err := services.LatestMetrics.Warm(); err != nil {
+		// 预热失败不影响启动，缓存会在读取时按设备从存储加载。
+		rootLogger.Warn("最新指标缓存预热失败", inter.Err(err))
+	}
+	if err := services.CommandBatches.Resume(); err != nil {
+		rootLogger.Warn("恢复未完成的批量指令失败", inter.Err(err))
+	}
+	// 先于存储关闭执行，等待进行中的批量入队结束。
+	defer services.CommandBatches.Stop()
 
 	webLogger := rootLogger.With(inter.String("module", "web"))
 
 	webServer, err := web.NewWebServer(web.WebServerDeps{
-		DataStore:        runtimeStore,
-		IngressStore:     runtimeStore,
-		TelemetryIngest:  services.TelemetryIngest,
-		DeviceRegistry:   services.DeviceRegistry,
-		DevicePresence:   services.DevicePresence,
-		DownlinkCommands: services.DownlinkCommands,
-		Auth:             authService,
-		Captcha:          web.NewTurnstileServiceWithConfig(appCfg.Captcha),
-		Logger:           webLogger,
-		Config:           appCfg.Web,
-		IngressToken:     appCfg.Ingress.Token,
+		DataStore:                 runtimeStore,
+		IngressStore:              runtimeStore,
+		TelemetryIngest:           services.TelemetryIngest,
+		DeviceRegistry:            services.DeviceRegistry,
+		DevicePresence:            services.DevicePresence,
+		DownlinkCommands:          services.DownlinkCommands,
+		CommandSchedules:          services.CommandSchedules,
+		CommandBatches:            services.CommandBatches,
+		DeviceGroups:              services.DeviceGroups,
+		Ota:                       services.Ota,
+		DeviceConfigs:             services.DeviceConfigs,
+		LatestMetrics:             services.LatestMetrics,
+		Retention:                 services.Retention,
+		DeviceStates:              services.DeviceStates,
+		DeviceShadows:             services.DeviceShadows,
+		DeviceTopology:            services.DeviceTopology,
+		DeviceDiagnostics:         services.DeviceDiagnostics,
+		ExternalEntities:          services.ExternalEntities,
+		ExternalCommands:          services.ExternalCommands,
+		IngestDedupe:              services.IngestDedupe,
+		CommandNotifier:           services.CommandNotifier,
+		IngressCredentials:        services.IngressCredentials,
+		Auth:                      authService,
+		Captcha:                   web.NewTurnstileServiceWithConfig(appCfg.Captcha),
+		Logger:                    webLogger,
+		Config:                    appCfg.Web,
+		IngressToken:              appCfg.Ingress.Token,
+		IngressRequireCredentials: appCfg.Ingress.RequireCredentials,
 	})
 	if err != nil {
 		rootLogger.Error("Web 服务初始化失败", inter.Err(err))
 		return err
 	}
 
+	go services.DevicePresence.Run(ctx)
+	go services.IngestDedupe.Run(ctx)
+	go services.DownlinkCommands.Run(ctx)
+	go services.CommandSchedules.Run(ctx)
+	go services.Ota.Run(ctx)
+	go services.Retention.Run(ctx)
+
 	errCh := make(chan error, 1)
 	go func() {
 		errCh <- webServer.Start(ctx)
@@ -167,7 +210,7 @@ func runDBCommand(action string) error {
 		rootLogger.Info("数据库结构已初始化", inter.String("action", action), inter.String("driver", appCfg.DB.Driver))
 		return nil
 	default:
-		return errors.New("未知 db 子命令，仅支持 init / migrate")
+		return errors.New("未知 db 子命令，仅支持 init / migrate / prune")
 	}
 }
 
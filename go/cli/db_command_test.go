@@ -1,13 +1,17 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"net"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/nhirsama/Goster-IoT/src/persistence"
 )
 
@@ -88,3 +92,94 @@ func TestRunWithArgsServeSupportsRuntimeStore(t *testing.T) {
 		_ = persistence.CloseIfPossible(store)
 	})
 }
+
+func TestRunWithArgsIngressCredentialsCreateAndRevoke(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "ingress_creds.db")
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_PATH", dbPath)
+	t.Setenv("DB_DSN", "")
+	t.Setenv("DB_SCHEMA_MODE", "managed")
+	if err := RunWithArgs(context.Background(), []string{"db", "init"}); err != nil {
+		t.Fatalf("RunWithArgs(db init) failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	commandOutput = &out
+	t.Cleanup(func() { commandOutput = os.Stdout })
+
+	if err := RunWithArgs(context.Background(), []string{"ingress", "credentials", "create", "-instance", "ingress-1", "-adapters", "mqtt,custom_tcp"}); err != nil {
+		t.Fatalf("create credential failed: %v", err)
+	}
+	var id, token string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if v, ok := strings.CutPrefix(line, "id: "); ok {
+			id = v
+		}
+		if v, ok := strings.CutPrefix(line, "token: "); ok {
+			token = v
+		}
+	}
+	if id == "" || !strings.HasPrefix(token, "gic_") {
+		t.Fatalf("create should print id and token once, got %q", out.String())
+	}
+
+	if err := RunWithArgs(context.Background(), []string{"ingress", "credentials", "revoke", id}); err != nil {
+		t.Fatalf("revoke credential failed: %v", err)
+	}
+	if err := RunWithArgs(context.Background(), []string{"ingress", "credentials", "rotate", id}); err == nil {
+		t.Fatal("rotating a revoked credential should fail")
+	}
+	out.Reset()
+	if err := RunWithArgs(context.Background(), []string{"ingress", "credentials", "list"}); err != nil {
+		t.Fatalf("list credentials failed: %v", err)
+	}
+	if !strings.Contains(out.String(), id) || !strings.Contains(out.String(), "revoked") || strings.Contains(out.String(), token) {
+		t.Fatalf("unexpected list output: %q", out.String())
+	}
+}
+
+func TestRunWithArgsDBPruneRollsUpExpiredMetrics(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "prune.db")
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_PATH", dbPath)
+	t.Setenv("DB_DSN", "")
+	t.Setenv("DB_SCHEMA_MODE", "managed")
+	if err := RunWithArgs(context.Background(), []string{"db", "init"}); err != nil {
+		t.Fatalf("RunWithArgs(db init) failed: %v", err)
+	}
+
+	store, err := persistence.OpenRuntimeStore(appcfg.DBConfig{Driver: "sqlite", Path: dbPath, SchemaMode: "managed"})
+	if err != nil {
+		t.Fatalf("OpenRuntimeStore failed: %v", err)
+	}
+	if err := store.InitDevice("prune-dev", inter.DeviceMetadata{Name: "prune-dev", Token: "tk-prune", AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	if err := store.AppendMetric("prune-dev", inter.MetricPoint{Timestamp: 1000, Name: "temperature", ValueType: "number", Value: 21}); err != nil {
+		t.Fatalf("AppendMetric failed: %v", err)
+	}
+	_ = persistence.CloseIfPossible(store)
+
+	var out bytes.Buffer
+	commandOutput = &out
+	t.Cleanup(func() { commandOutput = os.Stdout })
+
+	if err := RunWithArgs(context.Background(), []string{"db", "prune", "-class", "metrics,logs"}); err != nil {
+		t.Fatalf("db prune failed: %v", err)
+	}
+	fields := map[string][]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if f := strings.Fields(line); len(f) == 4 {
+			fields[f[0]] = f[1:]
+		}
+	}
+	if got := strings.Join(fields["metrics"], " "); got != "1 1 1" {
+		t.Fatalf("expected one metric pruned and rolled up, got %q in %q", got, out.String())
+	}
+	if _, ok := fields["metrics_hourly"]; ok {
+		t.Fatalf("unselected classes should not be reported: %q", out.String())
+	}
+	if err := RunWithArgs(context.Background(), []string{"db", "prune", "-class", "audio"}); err == nil {
+		t.Fatal("unknown data class should fail")
+	}
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/device_manager"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+// runDBPruneCommand 手动执行一次保留期清理，与 Core 后台任务使用相同的策略与分批参数。
+// 清理在本进程内串行执行，与正在运行的 Core 同时清理时各批次仍是独立的短事务。
+func runDBPruneCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("db prune", flag.ContinueOnError)
+	fs.SetOutput(commandOutput)
+	classes := fs.String("class", "", "只清理这些数据类别，逗号分隔；留空表示全部")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var selected []inter.RetentionDataClass
+	for _, item := range splitList(*classes) {
+		class := inter.RetentionDataClass(item)
+		if !class.Valid() {
+			return fmt.Errorf("未知数据类别: %s，当前支持: %s", item, joinRetentionClasses())
+		}
+		selected = append(selected, class)
+	}
+
+	appCfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("配置加载失败: %w", err)
+	}
+	initRootLogger(appCfg.Logger)
+
+	dbCfg := appCfg.DB
+	dbCfg.SchemaMode = "managed"
+	store, err := persistence.OpenRuntimeStore(dbCfg)
+	if err != nil {
+		return fmt.Errorf("业务存储初始化失败: %w", err)
+	}
+	defer persistence.CloseIfPossible(store)
+
+	svc := device_manager.NewRetentionService(store, appCfg.DeviceManager)
+	progress, pruneErr := svc.Prune(ctx, selected)
+	if len(selected) == 0 {
+		selected = inter.RetentionDataClasses
+	}
+	tw := tabwriter.NewWriter(commandOutput, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLASS\tDELETED\tROLLED_UP\tBATCHES")
+	for _, class := range selected {
+		p := progress.Classes[class]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", class, p.Deleted, p.RolledUp, p.Batches)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if pruneErr != nil {
+		return pruneErr
+	}
+	if progress.StartedAt != nil && progress.FinishedAt != nil {
+		fmt.Fprintf(commandOutput, "耗时 %s\n", progress.FinishedAt.Sub(*progress.StartedAt).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func joinRetentionClasses() string {
+	names := make([]string, 0, len(inter.RetentionDataClasses))
+	for _, class := range inter.RetentionDataClasses {
+		names = append(names, string(class))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/device_manager"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+// commandOutput 是运维子命令的输出目标，测试中可以替换。
+var commandOutput io.Writer = os.Stdout
+
+// runIngressCredentialCommand 执行 ingress credentials 子命令。
+// 令牌只在 create / rotate 时输出一次，之后无法再次查看。
+func runIngressCredentialCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("ingress credentials 子命令缺失，当前支持: create, rotate, revoke, list")
+	}
+
+	appCfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("配置加载失败: %w", err)
+	}
+	initRootLogger(appCfg.Logger)
+
+	dbCfg := appCfg.DB
+	dbCfg.SchemaMode = "managed"
+	store, err := persistence.OpenRuntimeStore(dbCfg)
+	if err != nil {
+		return fmt.Errorf("业务存储初始化失败: %w", err)
+	}
+	defer persistence.CloseIfPossible(store)
+	svc := device_manager.NewIngressCredentialService(store)
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("ingress credentials create", flag.ContinueOnError)
+		fs.SetOutput(commandOutput)
+		name := fs.String("name", "", "凭据名称")
+		instance := fs.String("instance", "", "绑定的 protocol-ingress 实例 ID（必填）")
+		adapters := fs.String("adapters", "", "允许的 adapter，逗号分隔；留空表示不限")
+		tenants := fs.String("tenants", "", "允许的租户，逗号分隔；留空表示不限")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		cred, token, err := svc.Create(inter.IngressCredentialInput{
+			Name:       *name,
+			InstanceID: *instance,
+			Adapters:   splitList(*adapters),
+			TenantIDs:  splitList(*tenants),
+			CreatedBy:  "cli",
+		})
+		if err != nil {
+			return err
+		}
+		printIssuedCredential(cred, token)
+		return nil
+	case "rotate":
+		if len(args) != 2 {
+			return errors.New("用法: ingress credentials rotate <id>")
+		}
+		cred, token, err := svc.Rotate(args[1])
+		if err != nil {
+			return err
+		}
+		printIssuedCredential(cred, token)
+		return nil
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New("用法: ingress credentials revoke <id>")
+		}
+		if err := svc.Revoke(args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(commandOutput, "已吊销 %s\n", args[1])
+		return nil
+	case "list":
+		items, err := svc.List()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(commandOutput, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tINSTANCE\tADAPTERS\tTENANTS\tPREFIX\tSTATUS\tCREATED")
+		for _, item := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				item.ID, item.Name, item.InstanceID, joinOrAny(item.Adapters), joinOrAny(item.TenantIDs),
+				item.TokenPrefix, item.Status, item.CreatedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("未知 ingress credentials 子命令: %s", args[0])
+	}
+}
+
+func printIssuedCredential(cred inter.IngressCredential, token string) {
+	fmt.Fprintf(commandOutput, "id: %s\ninstance: %s\nadapters: %s\ntenants: %s\ntoken: %s\n",
+		cred.ID, cred.InstanceID, joinOrAny(cred.Adapters), joinOrAny(cred.TenantIDs), token)
+	fmt.Fprintln(commandOutput, "请妥善保存令牌，它不会再次显示；将其配置为 protocol-ingress 的 PROTOCOL_INGRESS_CORE_TOKEN。")
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func joinOrAny(items []string) string {
+	if len(items) == 0 {
+		return "*"
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,45 @@
+-- 设备状态最新值与变更历史
+
+CREATE TABLE IF NOT EXISTS device_states (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    entity_id TEXT NOT NULL DEFAULT '',
+    value_type TEXT NOT NULL DEFAULT 'string',
+    value_num DOUBLE PRECISION,
+    value_text TEXT,
+    value_bool INTEGER,
+    value_json TEXT,
+    unit TEXT,
+    endpoint TEXT,
+    tags_json TEXT,
+    value_sig TEXT NOT NULL DEFAULT '',
+    ts BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, uuid, name, entity_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_states_tenant_uuid
+    ON device_states (tenant_id, uuid);
+
+CREATE TABLE IF NOT EXISTS device_state_history (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    entity_id TEXT NOT NULL DEFAULT '',
+    value_type TEXT NOT NULL DEFAULT 'string',
+    value_num DOUBLE PRECISION,
+    value_text TEXT,
+    value_bool INTEGER,
+    value_json TEXT,
+    unit TEXT,
+    value_sig TEXT NOT NULL DEFAULT '',
+    ts BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, uuid, name, entity_id, ts, value_sig)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_state_history_query
+    ON device_state_history (tenant_id, uuid, name, entity_id, ts);
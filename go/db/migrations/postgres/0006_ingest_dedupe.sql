@@ -0,0 +1,18 @@
+-- 事件去重台账：按租户 + event_id/idempotency_key 记录首次处理结果，过期后由后台任务清理
+
+CREATE TABLE IF NOT EXISTS ingest_event_dedupe (
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    dedupe_key TEXT NOT NULL,
+    event_id TEXT NOT NULL DEFAULT '',
+    uuid TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL DEFAULT FALSE,
+    error_code TEXT,
+    error_message TEXT,
+    created_at BIGINT NOT NULL,
+    completed_at BIGINT NOT NULL DEFAULT 0,
+    expires_at BIGINT NOT NULL,
+    PRIMARY KEY (tenant_id, dedupe_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingest_event_dedupe_expires
+    ON ingest_event_dedupe (expires_at);
@@ -0,0 +1,15 @@
+-- 设备拓扑：记录网关与子设备的挂载关系，parent_uuid 为空表示直连云端
+
+CREATE TABLE IF NOT EXISTS device_topology (
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    parent_uuid TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL DEFAULT '',
+    device_type TEXT NOT NULL DEFAULT '',
+    network_address TEXT NOT NULL DEFAULT '',
+    updated_at BIGINT NOT NULL,
+    PRIMARY KEY (tenant_id, uuid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_topology_parent
+    ON device_topology (tenant_id, parent_uuid);
@@ -0,0 +1,13 @@
+-- 下行指令有效期与重试：记录发送次数、确认超时与过期时间，由后台任务标记 expired
+
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS max_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS timeout_ms BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS sent_at TIMESTAMPTZ;
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS ack_deadline_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_device_commands_status_expires
+    ON device_commands (status, expires_at);
+CREATE INDEX IF NOT EXISTS idx_device_commands_status_ack_deadline
+    ON device_commands (status, ack_deadline_at);
@@ -0,0 +1,38 @@
+-- 完整设备描述：保留注册与发现时上报的厂商、型号、能力等信息，并登记可解析的设备身份
+
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS manufacturer TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS vendor TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS model TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS model_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS firmware_version TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS hardware_revision TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS software_build_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS power_source TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS device_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS labels_json TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS attributes_json TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS entities_json TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS endpoints_json TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS capabilities_json TEXT NOT NULL DEFAULT '[]';
+
+CREATE TABLE IF NOT EXISTS device_identities (
+    identity_type TEXT NOT NULL,
+    identity_value TEXT NOT NULL,
+    uuid TEXT NOT NULL,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    issuer TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL DEFAULT 0,
+    updated_at BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (identity_type, identity_value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_identities_uuid
+    ON device_identities (uuid);
+
+INSERT INTO device_identities (identity_type, identity_value, uuid, tenant_id)
+SELECT 'sn', sn, uuid, tenant_id FROM devices WHERE sn IS NOT NULL AND sn <> ''
+ON CONFLICT (identity_type, identity_value) DO NOTHING;
+
+INSERT INTO device_identities (identity_type, identity_value, uuid, tenant_id)
+SELECT 'mac', lower(replace(replace(replace(mac, ':', ''), '-', ''), '.', '')), uuid, tenant_id FROM devices WHERE mac IS NOT NULL AND mac <> ''
+ON CONFLICT (identity_type, identity_value) DO NOTHING;
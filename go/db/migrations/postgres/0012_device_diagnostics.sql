@@ -0,0 +1,21 @@
+-- 设备运行诊断：心跳携带的 state 保存为最新快照，并按采样间隔写入历史
+
+CREATE TABLE IF NOT EXISTS device_diagnostics (
+    uuid TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    state_json TEXT NOT NULL DEFAULT '{}',
+    observed_at BIGINT NOT NULL,
+    received_at BIGINT NOT NULL,
+    sampled_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS device_diagnostics_history (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    state_json TEXT NOT NULL DEFAULT '{}',
+    observed_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_diagnostics_history_query
+    ON device_diagnostics_history (tenant_id, uuid, observed_at);
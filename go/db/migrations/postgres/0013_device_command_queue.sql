@@ -0,0 +1,8 @@
+-- 持久化下行队列：queue_order 决定出队顺序，重新入队的指令取更小的值排到队首；
+-- claimed_at 记录出队时间，超过租约仍未标记发送的指令会被重新投递
+
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS queue_order BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_device_commands_queue
+    ON device_commands (uuid, status, queue_order, id);
@@ -0,0 +1,7 @@
+-- 指令历史：记录最近一次投递指令的 ingress 实例与 adapter，并按设备倒序分页查询
+
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS delivered_instance TEXT;
+ALTER TABLE device_commands ADD COLUMN IF NOT EXISTS delivered_adapter TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_device_commands_tenant_uuid_id
+    ON device_commands (tenant_id, uuid, id);
@@ -0,0 +1,33 @@
+-- 批量下发任务：按分组或标签选择器展开的目标设备逐台入队，每台设备一行结果
+-- 创建任务时写入全部目标设备，command_id 与 error_text 都为空的设备尚未入队，重启后继续
+-- 进度不单独存储，读取时关联 device_commands 的当前状态汇总
+
+CREATE TABLE IF NOT EXISTS command_batches (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    group_id TEXT NOT NULL DEFAULT '',
+    labels_json TEXT,
+    command TEXT NOT NULL,
+    cmd_id INTEGER NOT NULL,
+    payload_json TEXT,
+    command_key TEXT NOT NULL DEFAULT '',
+    supersede BOOLEAN NOT NULL DEFAULT FALSE,
+    ttl_ms BIGINT NOT NULL DEFAULT 0,
+    timeout_ms BIGINT NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 0,
+    total INTEGER NOT NULL DEFAULT 0,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_command_batches_tenant
+    ON command_batches (tenant_id, id);
+
+CREATE TABLE IF NOT EXISTS command_batch_items (
+    batch_id BIGINT NOT NULL,
+    uuid TEXT NOT NULL,
+    command_id BIGINT,
+    error_text TEXT,
+    PRIMARY KEY (batch_id, uuid),
+    FOREIGN KEY (batch_id) REFERENCES command_batches(id)
+);
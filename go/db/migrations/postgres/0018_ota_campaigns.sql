@@ -0,0 +1,58 @@
+-- OTA 固件升级：固件镜像、升级活动与逐台设备的传输进度
+-- 数据块不落入 device_commands，指令载荷只引用镜像的偏移与长度，发送时再从 firmware_artifacts 读取
+-- ota_devices 以 revision 为条件推进，多个 Core 实例不会为同一设备重复下发数据块
+
+CREATE TABLE IF NOT EXISTS firmware_artifacts (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    name TEXT NOT NULL DEFAULT '',
+    version TEXT NOT NULL,
+    hardware_versions_json TEXT NOT NULL DEFAULT '[]',
+    size BIGINT NOT NULL,
+    sha256 TEXT NOT NULL,
+    content BYTEA NOT NULL,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_firmware_artifacts_tenant
+    ON firmware_artifacts (tenant_id, created_at);
+
+CREATE TABLE IF NOT EXISTS ota_campaigns (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    name TEXT NOT NULL DEFAULT '',
+    artifact_id TEXT NOT NULL,
+    group_id TEXT NOT NULL DEFAULT '',
+    labels_json TEXT,
+    rollout_percent INTEGER NOT NULL DEFAULT 100,
+    status TEXT NOT NULL DEFAULT 'running',
+    chunk_size INTEGER NOT NULL,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (artifact_id) REFERENCES firmware_artifacts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ota_campaigns_status
+    ON ota_campaigns (status, id);
+CREATE INDEX IF NOT EXISTS idx_ota_campaigns_tenant
+    ON ota_campaigns (tenant_id, id);
+
+CREATE TABLE IF NOT EXISTS ota_devices (
+    campaign_id BIGINT NOT NULL,
+    uuid TEXT NOT NULL,
+    bucket INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    bytes_sent BIGINT NOT NULL DEFAULT 0,
+    command_id BIGINT NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    from_version TEXT NOT NULL DEFAULT '',
+    error_text TEXT,
+    revision BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ,
+    transferred_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (campaign_id, uuid),
+    FOREIGN KEY (campaign_id) REFERENCES ota_campaigns(id)
+);
@@ -0,0 +1,17 @@
+-- 具名指标：为 metrics 增加名称、单位、实体、标签与取值类型，旧数据按 legacy metric type 补齐名称
+
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '';
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS unit TEXT NOT NULL DEFAULT '';
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS entity_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tags_json TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS value_type TEXT NOT NULL DEFAULT 'number';
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS value_text TEXT NOT NULL DEFAULT '';
+ALTER TABLE metrics ALTER COLUMN value TYPE DOUBLE PRECISION;
+
+UPDATE metrics SET name = 'temperature', unit = '°C' WHERE type = 1 AND name = '';
+UPDATE metrics SET name = 'humidity', unit = '%' WHERE type = 2 AND name = '';
+UPDATE metrics SET name = 'illuminance', unit = 'lx' WHERE type = 4 AND name = '';
+UPDATE metrics SET name = 'access_signal_a' WHERE type = 8 AND name = '';
+UPDATE metrics SET name = 'access_signal_b' WHERE type = 16 AND name = '';
+
+CREATE INDEX IF NOT EXISTS idx_metrics_tenant_name_ts ON metrics (tenant_id, uuid, name, ts);
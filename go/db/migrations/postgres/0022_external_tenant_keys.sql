@@ -0,0 +1,75 @@
+-- 外部实体与观测值的唯一键加入 tenant_id，不同租户上报相同 source/entity_id 时不再互相覆盖。
+-- 唯一约束写在建表语句中，两种数据库都通过重建表迁移，已有数据的空租户归入默认租户。
+
+CREATE TABLE integration_external_entities_next (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    source TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    domain TEXT NOT NULL,
+    goster_uuid TEXT,
+    device_id TEXT,
+    model TEXT,
+    name TEXT,
+    room_name TEXT,
+    unit TEXT,
+    value_type TEXT NOT NULL DEFAULT 'string',
+    device_class TEXT,
+    state_class TEXT,
+    attributes_json TEXT,
+    last_state_text TEXT,
+    last_state_num DOUBLE PRECISION,
+    last_state_bool INTEGER,
+    last_seen_ts BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, source, entity_id)
+);
+
+INSERT INTO integration_external_entities_next (id, tenant_id, source, entity_id, domain, goster_uuid, device_id, model, name, room_name, unit, value_type, device_class, state_class, attributes_json, last_state_text, last_state_num, last_state_bool, last_seen_ts, created_at, updated_at)
+SELECT id, COALESCE(NULLIF(tenant_id, ''), 'tenant_legacy'), source, entity_id, domain, goster_uuid, device_id, model, name, room_name, unit, value_type, device_class, state_class, attributes_json, last_state_text, last_state_num, last_state_bool, last_seen_ts, created_at, updated_at
+FROM integration_external_entities;
+
+DROP TABLE integration_external_entities;
+ALTER TABLE integration_external_entities_next RENAME TO integration_external_entities;
+
+SELECT setval(pg_get_serial_sequence('integration_external_entities', 'id'), COALESCE((SELECT MAX(id) FROM integration_external_entities), 0) + 1, false);
+
+CREATE INDEX IF NOT EXISTS idx_integration_entities_source_domain
+    ON integration_external_entities (source, domain);
+CREATE INDEX IF NOT EXISTS idx_integration_entities_uuid
+    ON integration_external_entities (goster_uuid);
+CREATE INDEX IF NOT EXISTS idx_ext_entities_tenant_source_domain
+    ON integration_external_entities (tenant_id, source, domain);
+
+CREATE TABLE integration_external_observations_next (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    source TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    ts BIGINT NOT NULL,
+    value_num DOUBLE PRECISION,
+    value_text TEXT,
+    value_bool INTEGER,
+    value_json TEXT,
+    unit TEXT,
+    value_sig TEXT NOT NULL DEFAULT '',
+    raw_event_json TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, source, entity_id, ts, value_sig)
+);
+
+INSERT INTO integration_external_observations_next (id, tenant_id, source, entity_id, ts, value_num, value_text, value_bool, value_json, unit, value_sig, raw_event_json, created_at)
+SELECT id, COALESCE(NULLIF(tenant_id, ''), 'tenant_legacy'), source, entity_id, ts, value_num, value_text, value_bool, value_json, unit, value_sig, raw_event_json, created_at
+FROM integration_external_observations;
+
+DROP TABLE integration_external_observations;
+ALTER TABLE integration_external_observations_next RENAME TO integration_external_observations;
+
+SELECT setval(pg_get_serial_sequence('integration_external_observations', 'id'), COALESCE((SELECT MAX(id) FROM integration_external_observations), 0) + 1, false);
+
+CREATE INDEX IF NOT EXISTS idx_integration_observations_query
+    ON integration_external_observations (source, entity_id, ts);
+CREATE INDEX IF NOT EXISTS idx_ext_obs_tenant_source_entity_ts
+    ON integration_external_observations (tenant_id, source, entity_id, ts);
+CREATE INDEX IF NOT EXISTS idx_ext_obs_ts ON integration_external_observations (ts);
@@ -0,0 +1,3 @@
+-- 外部命令：领取时只记录租约时间，adapter 发布成功回执后才标记 sent
+
+ALTER TABLE integration_external_commands ADD COLUMN IF NOT EXISTS claimed_at TIMESTAMPTZ;
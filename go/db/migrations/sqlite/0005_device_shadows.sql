@@ -0,0 +1,16 @@
+-- 设备影子：desired 由管理端写入，reported 来自设备上报；version 只随 desired 递增并用于乐观并发控制，reported_version 单独计数设备上报
+
+CREATE TABLE IF NOT EXISTS device_shadows (
+    uuid TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    desired_json TEXT,
+    reported_json TEXT,
+    version BIGINT NOT NULL DEFAULT 0,
+    reported_version BIGINT NOT NULL DEFAULT 0,
+    desired_updated_at BIGINT NOT NULL DEFAULT 0,
+    reported_updated_at BIGINT NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_shadows_tenant
+    ON device_shadows (tenant_id);
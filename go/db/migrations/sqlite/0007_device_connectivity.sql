@@ -0,0 +1,14 @@
+-- 设备连通性历史：记录每次在线/离线切换的时间与原因
+
+CREATE TABLE IF NOT EXISTS device_connectivity_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    status TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    ts BIGINT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_connectivity_query
+    ON device_connectivity_events (tenant_id, uuid, ts);
@@ -0,0 +1,13 @@
+-- 下行指令有效期与重试：记录发送次数、确认超时与过期时间，由后台任务标记 expired
+
+ALTER TABLE device_commands ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE device_commands ADD COLUMN max_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE device_commands ADD COLUMN timeout_ms INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE device_commands ADD COLUMN expires_at DATETIME;
+ALTER TABLE device_commands ADD COLUMN sent_at DATETIME;
+ALTER TABLE device_commands ADD COLUMN ack_deadline_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_device_commands_status_expires
+    ON device_commands (status, expires_at);
+CREATE INDEX IF NOT EXISTS idx_device_commands_status_ack_deadline
+    ON device_commands (status, ack_deadline_at);
@@ -0,0 +1,19 @@
+-- protocol-ingress 服务间凭据：每条凭据绑定一个 ingress 实例，可限制 adapter 与租户，库中只保存令牌摘要
+
+CREATE TABLE IF NOT EXISTS ingress_credentials (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    instance_id TEXT NOT NULL,
+    adapters TEXT NOT NULL DEFAULT '[]',
+    tenant_ids TEXT NOT NULL DEFAULT '[]',
+    token_hash TEXT NOT NULL,
+    token_prefix TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'active',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    rotated_at BIGINT NOT NULL DEFAULT 0,
+    revoked_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ingress_credentials_token_hash
+    ON ingress_credentials (token_hash);
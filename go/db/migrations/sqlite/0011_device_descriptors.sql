@@ -0,0 +1,38 @@
+-- 完整设备描述：保留注册与发现时上报的厂商、型号、能力等信息，并登记可解析的设备身份
+
+ALTER TABLE devices ADD COLUMN manufacturer TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN vendor TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN model TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN model_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN firmware_version TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN hardware_revision TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN software_build_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN power_source TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN device_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN labels_json TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE devices ADD COLUMN attributes_json TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE devices ADD COLUMN entities_json TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE devices ADD COLUMN endpoints_json TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE devices ADD COLUMN capabilities_json TEXT NOT NULL DEFAULT '[]';
+
+CREATE TABLE IF NOT EXISTS device_identities (
+    identity_type TEXT NOT NULL,
+    identity_value TEXT NOT NULL,
+    uuid TEXT NOT NULL,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    issuer TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL DEFAULT 0,
+    updated_at BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (identity_type, identity_value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_identities_uuid
+    ON device_identities (uuid);
+
+INSERT INTO device_identities (identity_type, identity_value, uuid, tenant_id)
+SELECT 'sn', sn, uuid, tenant_id FROM devices WHERE sn IS NOT NULL AND sn <> ''
+ON CONFLICT (identity_type, identity_value) DO NOTHING;
+
+INSERT INTO device_identities (identity_type, identity_value, uuid, tenant_id)
+SELECT 'mac', lower(replace(replace(replace(mac, ':', ''), '-', ''), '.', '')), uuid, tenant_id FROM devices WHERE mac IS NOT NULL AND mac <> ''
+ON CONFLICT (identity_type, identity_value) DO NOTHING;
@@ -0,0 +1,6 @@
+-- 指令取消与替换：command_key 标识同类指令的作用对象，新指令可替换同设备同名同键的未发送指令
+
+ALTER TABLE device_commands ADD COLUMN command_key TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_device_commands_supersede
+    ON device_commands (uuid, command, command_key, status);
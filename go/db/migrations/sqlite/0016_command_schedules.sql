@@ -0,0 +1,33 @@
+-- 指令计划：一次性 execute_at 与 cron 周期计划，uuid 为空时作用于租户内全部已认证设备
+-- 各 Core 实例以 revision 为条件抢占触发并推进 next_run_at，同一次触发只会下发一次
+
+CREATE TABLE IF NOT EXISTS command_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    name TEXT NOT NULL DEFAULT '',
+    uuid TEXT,
+    command TEXT NOT NULL,
+    cmd_id INTEGER NOT NULL,
+    payload_json TEXT,
+    command_key TEXT NOT NULL DEFAULT '',
+    supersede BOOLEAN NOT NULL DEFAULT FALSE,
+    ttl_ms BIGINT NOT NULL DEFAULT 0,
+    timeout_ms BIGINT NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 0,
+    execute_at DATETIME,
+    cron_expr TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at DATETIME,
+    last_run_at DATETIME,
+    last_error TEXT,
+    run_count BIGINT NOT NULL DEFAULT 0,
+    revision BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_command_schedules_due
+    ON command_schedules (enabled, next_run_at);
+CREATE INDEX IF NOT EXISTS idx_command_schedules_tenant_uuid
+    ON command_schedules (tenant_id, uuid, id);
@@ -0,0 +1,44 @@
+-- 分层配置：租户、分组、设备三层配置文档只追加版本，设备的生效配置按层覆盖后计算
+-- device_config_states 记录每台设备上报、下发与确认的配置版本，device_config_acks 保留确认审计
+
+CREATE TABLE IF NOT EXISTS config_documents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    scope_type TEXT NOT NULL,
+    scope_id TEXT NOT NULL DEFAULT '',
+    version BIGINT NOT NULL,
+    content_json TEXT NOT NULL DEFAULT '{}',
+    comment TEXT NOT NULL DEFAULT '',
+    rolled_back_from BIGINT NOT NULL DEFAULT 0,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_config_documents_scope_version
+    ON config_documents (tenant_id, scope_type, scope_id, version);
+
+CREATE TABLE IF NOT EXISTS device_config_states (
+    uuid TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    current_version TEXT NOT NULL DEFAULT '',
+    pushed_version TEXT NOT NULL DEFAULT '',
+    command_id BIGINT NOT NULL DEFAULT 0,
+    pushed_at DATETIME,
+    acked_version TEXT NOT NULL DEFAULT '',
+    acked_at DATETIME,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS device_config_acks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    config_version TEXT NOT NULL,
+    sources_json TEXT NOT NULL DEFAULT '[]',
+    source TEXT NOT NULL,
+    command_id BIGINT NOT NULL DEFAULT 0,
+    acked_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_config_acks_device
+    ON device_config_acks (tenant_id, uuid, id);
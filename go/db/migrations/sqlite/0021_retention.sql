@@ -0,0 +1,51 @@
+-- 数据保留：retention_policies 记录租户对各类数据的保留期覆盖，未覆盖的类别使用平台默认值
+-- 原始指标过期后先按小时汇总进 metric_rollups_hourly，小时汇总过期后再按天汇总进 metric_rollups_daily，同一设备不同实体的同名指标分别汇总
+
+CREATE TABLE IF NOT EXISTS retention_policies (
+    tenant_id TEXT NOT NULL,
+    data_class TEXT NOT NULL,
+    retention_ms BIGINT NOT NULL DEFAULT 0,
+    updated_by TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, data_class)
+);
+
+CREATE TABLE IF NOT EXISTS metric_rollups_hourly (
+    tenant_id TEXT NOT NULL,
+    uuid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    entity_id TEXT NOT NULL DEFAULT '',
+    bucket_ts BIGINT NOT NULL,
+    unit TEXT NOT NULL DEFAULT '',
+    value_count BIGINT NOT NULL DEFAULT 0,
+    value_sum REAL NOT NULL DEFAULT 0,
+    value_min REAL NOT NULL DEFAULT 0,
+    value_max REAL NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, uuid, name, entity_id, bucket_ts)
+);
+
+CREATE INDEX IF NOT EXISTS idx_metric_rollups_hourly_bucket
+    ON metric_rollups_hourly (bucket_ts);
+
+CREATE TABLE IF NOT EXISTS metric_rollups_daily (
+    tenant_id TEXT NOT NULL,
+    uuid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    entity_id TEXT NOT NULL DEFAULT '',
+    bucket_ts BIGINT NOT NULL,
+    unit TEXT NOT NULL DEFAULT '',
+    value_count BIGINT NOT NULL DEFAULT 0,
+    value_sum REAL NOT NULL DEFAULT 0,
+    value_min REAL NOT NULL DEFAULT 0,
+    value_max REAL NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, uuid, name, entity_id, bucket_ts)
+);
+
+CREATE INDEX IF NOT EXISTS idx_metric_rollups_daily_bucket
+    ON metric_rollups_daily (bucket_ts);
+
+-- 清理按时间扫描，补齐没有以时间开头的索引
+CREATE INDEX IF NOT EXISTS idx_metrics_ts ON metrics (ts);
+CREATE INDEX IF NOT EXISTS idx_logs_created ON logs (created_at);
+CREATE INDEX IF NOT EXISTS idx_ext_obs_ts ON integration_external_observations (ts);
+CREATE INDEX IF NOT EXISTS idx_device_commands_requested ON device_commands (requested_at);
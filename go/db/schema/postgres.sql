@@ -11,7 +11,21 @@ CREATE TABLE IF NOT EXISTS devices (
     mac TEXT,
     created_at TIMESTAMPTZ,
     token TEXT UNIQUE,
-    auth_status INTEGER
+    auth_status INTEGER,
+    manufacturer TEXT NOT NULL DEFAULT '',
+    vendor TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL DEFAULT '',
+    model_id TEXT NOT NULL DEFAULT '',
+    firmware_version TEXT NOT NULL DEFAULT '',
+    hardware_revision TEXT NOT NULL DEFAULT '',
+    software_build_id TEXT NOT NULL DEFAULT '',
+    power_source TEXT NOT NULL DEFAULT '',
+    device_type TEXT NOT NULL DEFAULT '',
+    labels_json TEXT NOT NULL DEFAULT '{}',
+    attributes_json TEXT NOT NULL DEFAULT '{}',
+    entities_json TEXT NOT NULL DEFAULT '[]',
+    endpoints_json TEXT NOT NULL DEFAULT '[]',
+    capabilities_json TEXT NOT NULL DEFAULT '[]'
 );
 
 CREATE INDEX IF NOT EXISTS idx_devices_tenant_uuid ON devices (tenant_id, uuid);
@@ -20,13 +34,21 @@ CREATE TABLE IF NOT EXISTS metrics (
     uuid TEXT NOT NULL,
     tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
     ts BIGINT NOT NULL,
-    value REAL,
-    type INTEGER NOT NULL DEFAULT 0
+    value DOUBLE PRECISION,
+    type INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL DEFAULT '',
+    unit TEXT NOT NULL DEFAULT '',
+    entity_id TEXT NOT NULL DEFAULT '',
+    tags_json TEXT NOT NULL DEFAULT '{}',
+    value_type TEXT NOT NULL DEFAULT 'number',
+    value_text TEXT NOT NULL DEFAULT ''
 );
 
 CREATE INDEX IF NOT EXISTS idx_metrics_query ON metrics (uuid, ts);
 CREATE INDEX IF NOT EXISTS idx_metrics_type ON metrics (uuid, type, ts);
 CREATE INDEX IF NOT EXISTS idx_metrics_tenant_uuid_ts ON metrics (tenant_id, uuid, ts);
+CREATE INDEX IF NOT EXISTS idx_metrics_ts ON metrics (ts);
+CREATE INDEX IF NOT EXISTS idx_metrics_tenant_name_ts ON metrics (tenant_id, uuid, name, ts);
 
 CREATE TABLE IF NOT EXISTS logs (
     id BIGSERIAL PRIMARY KEY,
@@ -39,6 +61,7 @@ CREATE TABLE IF NOT EXISTS logs (
 
 CREATE INDEX IF NOT EXISTS idx_logs_uuid ON logs (uuid);
 CREATE INDEX IF NOT EXISTS idx_logs_tenant_uuid_created ON logs (tenant_id, uuid, created_at);
+CREATE INDEX IF NOT EXISTS idx_logs_created ON logs (created_at);
 
 CREATE TABLE IF NOT EXISTS users (
     id BIGSERIAL PRIMARY KEY,
@@ -153,7 +176,7 @@ CREATE TABLE IF NOT EXISTS integration_external_entities (
     last_seen_ts BIGINT,
     created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE (source, entity_id)
+    UNIQUE (tenant_id, source, entity_id)
 );
 
 CREATE INDEX IF NOT EXISTS idx_integration_entities_source_domain
@@ -177,13 +200,14 @@ CREATE TABLE IF NOT EXISTS integration_external_observations (
     value_sig TEXT NOT NULL DEFAULT '',
     raw_event_json TEXT,
     created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE (source, entity_id, ts, value_sig)
+    UNIQUE (tenant_id, source, entity_id, ts, value_sig)
 );
 
 CREATE INDEX IF NOT EXISTS idx_integration_observations_query
     ON integration_external_observations (source, entity_id, ts);
 CREATE INDEX IF NOT EXISTS idx_ext_obs_tenant_source_entity_ts
     ON integration_external_observations (tenant_id, source, entity_id, ts);
+CREATE INDEX IF NOT EXISTS idx_ext_obs_ts ON integration_external_observations (ts);
 
 CREATE TABLE IF NOT EXISTS integration_external_commands (
     id BIGSERIAL PRIMARY KEY,
@@ -195,7 +219,8 @@ CREATE TABLE IF NOT EXISTS integration_external_commands (
     status TEXT NOT NULL DEFAULT 'pending',
     error_text TEXT,
     requested_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    executed_at TIMESTAMPTZ
+    executed_at TIMESTAMPTZ,
+    claimed_at TIMESTAMPTZ
 );
 
 CREATE INDEX IF NOT EXISTS idx_integration_commands_status
@@ -212,11 +237,401 @@ CREATE TABLE IF NOT EXISTS device_commands (
     payload_json TEXT,
     status TEXT NOT NULL DEFAULT 'queued',
     error_text TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 0,
+    timeout_ms BIGINT NOT NULL DEFAULT 0,
     requested_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    executed_at TIMESTAMPTZ
+    expires_at TIMESTAMPTZ,
+    sent_at TIMESTAMPTZ,
+    ack_deadline_at TIMESTAMPTZ,
+    executed_at TIMESTAMPTZ,
+    queue_order BIGINT NOT NULL DEFAULT 0,
+    claimed_at TIMESTAMPTZ,
+    delivered_instance TEXT,
+    delivered_adapter TEXT,
+    command_key TEXT NOT NULL DEFAULT ''
 );
 
 CREATE INDEX IF NOT EXISTS idx_device_commands_uuid_status
     ON device_commands (uuid, status, requested_at);
+CREATE INDEX IF NOT EXISTS idx_device_commands_requested ON device_commands (requested_at);
 CREATE INDEX IF NOT EXISTS idx_device_commands_tenant_uuid_status
     ON device_commands (tenant_id, uuid, status, requested_at);
+CREATE INDEX IF NOT EXISTS idx_device_commands_status_expires
+    ON device_commands (status, expires_at);
+CREATE INDEX IF NOT EXISTS idx_device_commands_status_ack_deadline
+    ON device_commands (status, ack_deadline_at);
+CREATE INDEX IF NOT EXISTS idx_device_commands_queue
+    ON device_commands (uuid, status, queue_order, id);
+CREATE INDEX IF NOT EXISTS idx_device_commands_tenant_uuid_id
+    ON device_commands (tenant_id, uuid, id);
+CREATE INDEX IF NOT EXISTS idx_device_commands_supersede
+    ON device_commands (uuid, command, command_key, status);
+
+CREATE TABLE IF NOT EXISTS device_states (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    entity_id TEXT NOT NULL DEFAULT '',
+    value_type TEXT NOT NULL DEFAULT 'string',
+    value_num DOUBLE PRECISION,
+    value_text TEXT,
+    value_bool INTEGER,
+    value_json TEXT,
+    unit TEXT,
+    endpoint TEXT,
+    tags_json TEXT,
+    value_sig TEXT NOT NULL DEFAULT '',
+    ts BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, uuid, name, entity_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_states_tenant_uuid
+    ON device_states (tenant_id, uuid);
+
+CREATE TABLE IF NOT EXISTS device_state_history (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    entity_id TEXT NOT NULL DEFAULT '',
+    value_type TEXT NOT NULL DEFAULT 'string',
+    value_num DOUBLE PRECISION,
+    value_text TEXT,
+    value_bool INTEGER,
+    value_json TEXT,
+    unit TEXT,
+    value_sig TEXT NOT NULL DEFAULT '',
+    ts BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, uuid, name, entity_id, ts, value_sig)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_state_history_query
+    ON device_state_history (tenant_id, uuid, name, entity_id, ts);
+
+-- 设备影子：desired 由管理端写入，reported 来自设备上报，version 用于乐观并发控制
+
+CREATE TABLE IF NOT EXISTS device_shadows (
+    uuid TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    desired_json TEXT,
+    reported_json TEXT,
+    version BIGINT NOT NULL DEFAULT 0,
+    reported_version BIGINT NOT NULL DEFAULT 0,
+    desired_updated_at BIGINT NOT NULL DEFAULT 0,
+    reported_updated_at BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_shadows_tenant
+    ON device_shadows (tenant_id);
+
+-- 事件去重台账：按租户 + event_id/idempotency_key 记录首次处理结果，过期后由后台任务清理
+
+CREATE TABLE IF NOT EXISTS ingest_event_dedupe (
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    dedupe_key TEXT NOT NULL,
+    event_id TEXT NOT NULL DEFAULT '',
+    uuid TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL DEFAULT FALSE,
+    error_code TEXT,
+    error_message TEXT,
+    created_at BIGINT NOT NULL,
+    completed_at BIGINT NOT NULL DEFAULT 0,
+    expires_at BIGINT NOT NULL,
+    PRIMARY KEY (tenant_id, dedupe_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingest_event_dedupe_expires
+    ON ingest_event_dedupe (expires_at);
+
+-- 设备连通性历史：记录每次在线/离线切换的时间与原因
+
+CREATE TABLE IF NOT EXISTS device_connectivity_events (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    status TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    ts BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_connectivity_query
+    ON device_connectivity_events (tenant_id, uuid, ts);
+
+-- 设备拓扑：记录网关与子设备的挂载关系，parent_uuid 为空表示直连云端
+
+CREATE TABLE IF NOT EXISTS device_topology (
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    parent_uuid TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL DEFAULT '',
+    device_type TEXT NOT NULL DEFAULT '',
+    network_address TEXT NOT NULL DEFAULT '',
+    updated_at BIGINT NOT NULL,
+    PRIMARY KEY (tenant_id, uuid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_topology_parent
+    ON device_topology (tenant_id, parent_uuid);
+
+-- protocol-ingress 服务间凭据：每条凭据绑定一个 ingress 实例，可限制 adapter 与租户，库中只保存令牌摘要
+
+CREATE TABLE IF NOT EXISTS ingress_credentials (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    instance_id TEXT NOT NULL,
+    adapters TEXT NOT NULL DEFAULT '[]',
+    tenant_ids TEXT NOT NULL DEFAULT '[]',
+    token_hash TEXT NOT NULL,
+    token_prefix TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'active',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL,
+    rotated_at BIGINT NOT NULL DEFAULT 0,
+    revoked_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ingress_credentials_token_hash
+    ON ingress_credentials (token_hash);
+
+CREATE TABLE IF NOT EXISTS device_identities (
+    identity_type TEXT NOT NULL,
+    identity_value TEXT NOT NULL,
+    uuid TEXT NOT NULL,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    issuer TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL DEFAULT 0,
+    updated_at BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (identity_type, identity_value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_identities_uuid
+    ON device_identities (uuid);
+
+-- 设备运行诊断：心跳携带的 state 保存为最新快照，并按采样间隔写入历史
+
+CREATE TABLE IF NOT EXISTS device_diagnostics (
+    uuid TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    state_json TEXT NOT NULL DEFAULT '{}',
+    observed_at BIGINT NOT NULL,
+    received_at BIGINT NOT NULL,
+    sampled_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS device_diagnostics_history (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    state_json TEXT NOT NULL DEFAULT '{}',
+    observed_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_diagnostics_history_query
+    ON device_diagnostics_history (tenant_id, uuid, observed_at);
+
+CREATE TABLE IF NOT EXISTS command_schedules (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    name TEXT NOT NULL DEFAULT '',
+    uuid TEXT,
+    command TEXT NOT NULL,
+    cmd_id INTEGER NOT NULL,
+    payload_json TEXT,
+    command_key TEXT NOT NULL DEFAULT '',
+    supersede BOOLEAN NOT NULL DEFAULT FALSE,
+    ttl_ms BIGINT NOT NULL DEFAULT 0,
+    timeout_ms BIGINT NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 0,
+    execute_at TIMESTAMPTZ,
+    cron_expr TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    last_error TEXT,
+    run_count BIGINT NOT NULL DEFAULT 0,
+    revision BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_command_schedules_due
+    ON command_schedules (enabled, next_run_at);
+CREATE INDEX IF NOT EXISTS idx_command_schedules_tenant_uuid
+    ON command_schedules (tenant_id, uuid, id);
+
+CREATE TABLE IF NOT EXISTS command_batches (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    group_id TEXT NOT NULL DEFAULT '',
+    labels_json TEXT,
+    command TEXT NOT NULL,
+    cmd_id INTEGER NOT NULL,
+    payload_json TEXT,
+    command_key TEXT NOT NULL DEFAULT '',
+    supersede BOOLEAN NOT NULL DEFAULT FALSE,
+    ttl_ms BIGINT NOT NULL DEFAULT 0,
+    timeout_ms BIGINT NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 0,
+    total INTEGER NOT NULL DEFAULT 0,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_command_batches_tenant
+    ON command_batches (tenant_id, id);
+
+CREATE TABLE IF NOT EXISTS command_batch_items (
+    batch_id BIGINT NOT NULL,
+    uuid TEXT NOT NULL,
+    command_id BIGINT,
+    error_text TEXT,
+    PRIMARY KEY (batch_id, uuid),
+    FOREIGN KEY (batch_id) REFERENCES command_batches(id)
+);
+
+CREATE TABLE IF NOT EXISTS firmware_artifacts (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    name TEXT NOT NULL DEFAULT '',
+    version TEXT NOT NULL,
+    hardware_versions_json TEXT NOT NULL DEFAULT '[]',
+    size BIGINT NOT NULL,
+    sha256 TEXT NOT NULL,
+    content BYTEA NOT NULL,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_firmware_artifacts_tenant
+    ON firmware_artifacts (tenant_id, created_at);
+
+CREATE TABLE IF NOT EXISTS ota_campaigns (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    name TEXT NOT NULL DEFAULT '',
+    artifact_id TEXT NOT NULL,
+    group_id TEXT NOT NULL DEFAULT '',
+    labels_json TEXT,
+    rollout_percent INTEGER NOT NULL DEFAULT 100,
+    status TEXT NOT NULL DEFAULT 'running',
+    chunk_size INTEGER NOT NULL,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (artifact_id) REFERENCES firmware_artifacts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ota_campaigns_status
+    ON ota_campaigns (status, id);
+CREATE INDEX IF NOT EXISTS idx_ota_campaigns_tenant
+    ON ota_campaigns (tenant_id, id);
+
+CREATE TABLE IF NOT EXISTS ota_devices (
+    campaign_id BIGINT NOT NULL,
+    uuid TEXT NOT NULL,
+    bucket INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    bytes_sent BIGINT NOT NULL DEFAULT 0,
+    command_id BIGINT NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    from_version TEXT NOT NULL DEFAULT '',
+    error_text TEXT,
+    revision BIGINT NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ,
+    transferred_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (campaign_id, uuid),
+    FOREIGN KEY (campaign_id) REFERENCES ota_campaigns(id)
+);
+
+CREATE TABLE IF NOT EXISTS config_documents (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    scope_type TEXT NOT NULL,
+    scope_id TEXT NOT NULL DEFAULT '',
+    version BIGINT NOT NULL,
+    content_json TEXT NOT NULL DEFAULT '{}',
+    comment TEXT NOT NULL DEFAULT '',
+    rolled_back_from BIGINT NOT NULL DEFAULT 0,
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_config_documents_scope_version
+    ON config_documents (tenant_id, scope_type, scope_id, version);
+
+CREATE TABLE IF NOT EXISTS device_config_states (
+    uuid TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    current_version TEXT NOT NULL DEFAULT '',
+    pushed_version TEXT NOT NULL DEFAULT '',
+    command_id BIGINT NOT NULL DEFAULT 0,
+    pushed_at TIMESTAMPTZ,
+    acked_version TEXT NOT NULL DEFAULT '',
+    acked_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS device_config_acks (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy',
+    uuid TEXT NOT NULL,
+    config_version TEXT NOT NULL,
+    sources_json TEXT NOT NULL DEFAULT '[]',
+    source TEXT NOT NULL,
+    command_id BIGINT NOT NULL DEFAULT 0,
+    acked_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_config_acks_device
+    ON device_config_acks (tenant_id, uuid, id);
+
+CREATE TABLE IF NOT EXISTS retention_policies (
+    tenant_id TEXT NOT NULL,
+    data_class TEXT NOT NULL,
+    retention_ms BIGINT NOT NULL DEFAULT 0,
+    updated_by TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, data_class)
+);
+
+CREATE TABLE IF NOT EXISTS metric_rollups_hourly (
+    tenant_id TEXT NOT NULL,
+    uuid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    entity_id TEXT NOT NULL DEFAULT '',
+    bucket_ts BIGINT NOT NULL,
+    unit TEXT NOT NULL DEFAULT '',
+    value_count BIGINT NOT NULL DEFAULT 0,
+    value_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+    value_min DOUBLE PRECISION NOT NULL DEFAULT 0,
+    value_max DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, uuid, name, entity_id, bucket_ts)
+);
+
+CREATE INDEX IF NOT EXISTS idx_metric_rollups_hourly_bucket
+    ON metric_rollups_hourly (bucket_ts);
+
+CREATE TABLE IF NOT EXISTS metric_rollups_daily (
+    tenant_id TEXT NOT NULL,
+    uuid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    entity_id TEXT NOT NULL DEFAULT '',
+    bucket_ts BIGINT NOT NULL,
+    unit TEXT NOT NULL DEFAULT '',
+    value_count BIGINT NOT NULL DEFAULT 0,
+    value_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+    value_min DOUBLE PRECISION NOT NULL DEFAULT 0,
+    value_max DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, uuid, name, entity_id, bucket_ts)
+);
+
+CREATE INDEX IF NOT EXISTS idx_metric_rollups_daily_bucket
+    ON metric_rollups_daily (bucket_ts);
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/nhirsama/Goster-IoT/src/logger"
 	"github.com/spf13/viper"
 )
@@ -19,13 +20,23 @@ const (
 	defaultAPICORSAllowOrigins              = "http://localhost:3000,http://127.0.0.1:3000"
 	defaultAuthRootURL                      = "http://localhost:8080"
 	defaultMaxAPIBodyBytes            int64 = 1 << 20
+	defaultMaxFirmwareBytes           int64 = 16 << 20
 	defaultMetricsMinValidTimestampMs int64 = 1672531200000
 	defaultMetricsRangeLabel                = "1h"
+	defaultMetricsMaxPoints                 = 1000
 	defaultLoginMaxFailures                 = 5
 	defaultLoginFailureWindow               = 10 * time.Minute
 	defaultLoginLockout                     = 15 * time.Minute
 )
 
+// 设备下行队列的可选实现。
+const (
+	// QueueBackendMemory 把待发指令保存在进程内存中，重启后丢失。
+	QueueBackendMemory = "memory"
+	// QueueBackendDatabase 以 device_commands 表为队列，重启后继续投递。
+	QueueBackendDatabase = "database"
+)
+
 type AppConfig struct {
 	DB            DBConfig
 	Web           WebConfig
@@ -47,9 +58,11 @@ type WebConfig struct {
 	HTTPAddr            string
 	APICORSAllowOrigins string
 	MaxAPIBodyBytes     int64
-	DeviceListPage      PaginationConfig
-	Metrics             MetricsConfig
-	LoginProtection     LoginProtectionConfig
+	// MaxFirmwareBytes 限制上传固件镜像的大小，固件以原始字节上传，不受 MaxAPIBodyBytes 约束。
+	MaxFirmwareBytes int64
+	DeviceListPage   PaginationConfig
+	Metrics          MetricsConfig
+	LoginProtection  LoginProtectionConfig
 }
 
 type AuthConfig struct {
@@ -64,7 +77,10 @@ type AuthConfig struct {
 type IngressConfig struct {
 	// Token 是 core-api 校验 protocol-ingress 服务间调用的共享密钥。
 	// 通过 PROTOCOL_INGRESS_TOKEN 环境变量注入；为空时兼容本地开发，不启用校验。
+	// 共享密钥不区分实例与租户，生产环境应改用 Core 签发的 adapter 凭据。
 	Token string
+	// RequireCredentials 为 true 时只接受 adapter 凭据，共享密钥与匿名调用都会被拒绝。
+	RequireCredentials bool
 }
 
 type CaptchaConfig struct {
@@ -75,10 +91,45 @@ type CaptchaConfig struct {
 }
 
 type DeviceManagerConfig struct {
-	QueueCapacity            int
-	HeartbeatDeadline        time.Duration
-	ExternalListPage         PaginationConfig
-	ExternalObservationLimit LimitConfig
+	QueueCapacity int
+	// QueueBackend 选择设备下行队列实现：memory 或 database。
+	QueueBackend string
+	// QueueClaimLease 是 database 队列中已出队但尚未确认发送的指令被重新投递前的租约时长。
+	QueueClaimLease             time.Duration
+	HeartbeatDeadline           time.Duration
+	ExternalListPage            PaginationConfig
+	ExternalObservationLimit    LimitConfig
+	StateHistoryLimit           LimitConfig
+	PresenceSweepInterval       time.Duration
+	ConnectivityHistoryLimit    LimitConfig
+	IngestDedupeTTL             time.Duration
+	IngestDedupeCleanupInterval time.Duration
+	CommandTTL                  time.Duration
+	CommandAckTimeout           time.Duration
+	CommandMaxAttempts          int
+	CommandReapInterval         time.Duration
+	CommandHistoryLimit         LimitConfig
+	SchedulePollInterval        time.Duration
+	OtaPollInterval             time.Duration
+	// OtaChunkSize 是单个 OTA 数据块携带的固件字节数，超过单帧载荷上限时按上限截断。
+	OtaChunkSize int
+	// OtaVerifyTimeout 是固件传输完成后等待设备以新版本重新注册的时长，超时判定升级失败。
+	OtaVerifyTimeout          time.Duration
+	DiagnosticsSampleInterval time.Duration
+	DiagnosticsHistoryLimit   LimitConfig
+	// DiagnosticsMetricKeys 把心跳 state 中的数值键转写为指定 legacy metric type 的指标。
+	DiagnosticsMetricKeys map[string]uint8
+	RetentionInterval     time.Duration
+	// RetentionBatchSize 是单个清理事务处理的行数上限，批次之间暂停 RetentionBatchPause，避免长时间占用 SQLite 写锁。
+	RetentionBatchSize  int
+	RetentionBatchPause time.Duration
+	// RetentionDefaults 是各数据类别的平台默认保留期，0 表示永久保留，租户可以单独覆盖。
+	RetentionDefaults map[inter.RetentionDataClass]time.Duration
+	// LatestMetricTTL 是最新值缓存中设备条目的有效期，过期后下次读取从存储重新加载，以便看到其他实例写入的指标。
+	LatestMetricTTL time.Duration
+	// LatestMetricWarmWindow 与 LatestMetricWarmLimit 限定启动预热的范围：只加载窗口内上报过指标的设备，且不超过上限台数。
+	LatestMetricWarmWindow time.Duration
+	LatestMetricWarmLimit  int
 }
 
 type PaginationConfig struct {
@@ -94,6 +145,7 @@ type LimitConfig struct {
 type MetricsConfig struct {
 	MinValidTimestampMs int64
 	DefaultRangeLabel   string
+	MaxPoints           int
 }
 
 type LoginProtectionConfig struct {
@@ -115,6 +167,7 @@ func DefaultWebConfig() WebConfig {
 		HTTPAddr:            defaultWebHTTPAddr,
 		APICORSAllowOrigins: defaultAPICORSAllowOrigins,
 		MaxAPIBodyBytes:     defaultMaxAPIBodyBytes,
+		MaxFirmwareBytes:    defaultMaxFirmwareBytes,
 		DeviceListPage: PaginationConfig{
 			DefaultSize: 100,
 			MaxSize:     1000,
@@ -122,6 +175,7 @@ func DefaultWebConfig() WebConfig {
 		Metrics: MetricsConfig{
 			MinValidTimestampMs: defaultMetricsMinValidTimestampMs,
 			DefaultRangeLabel:   defaultMetricsRangeLabel,
+			MaxPoints:           defaultMetricsMaxPoints,
 		},
 		LoginProtection: LoginProtectionConfig{
 			MaxFailures: defaultLoginMaxFailures,
@@ -156,6 +210,8 @@ func DefaultCaptchaConfig() CaptchaConfig {
 func DefaultDeviceManagerConfig() DeviceManagerConfig {
 	return DeviceManagerConfig{
 		QueueCapacity:     100,
+		QueueBackend:      QueueBackendMemory,
+		QueueClaimLease:   time.Minute,
 		HeartbeatDeadline: 60 * time.Second,
 		ExternalListPage: PaginationConfig{
 			DefaultSize: 100,
@@ -165,6 +221,41 @@ func DefaultDeviceManagerConfig() DeviceManagerConfig {
 			Default: 1000,
 			Max:     10000,
 		},
+		StateHistoryLimit: LimitConfig{
+			Default: 1000,
+			Max:     10000,
+		},
+		PresenceSweepInterval: 15 * time.Second,
+		ConnectivityHistoryLimit: LimitConfig{
+			Default: 500,
+			Max:     5000,
+		},
+		IngestDedupeTTL:             24 * time.Hour,
+		IngestDedupeCleanupInterval: 10 * time.Minute,
+		CommandTTL:                  24 * time.Hour,
+		CommandMaxAttempts:          3,
+		CommandReapInterval:         30 * time.Second,
+		CommandHistoryLimit: LimitConfig{
+			Default: 100,
+			Max:     1000,
+		},
+		SchedulePollInterval:      15 * time.Second,
+		OtaPollInterval:           10 * time.Second,
+		OtaChunkSize:              16 * 1024,
+		OtaVerifyTimeout:          30 * time.Minute,
+		DiagnosticsSampleInterval: 5 * time.Minute,
+		DiagnosticsHistoryLimit: LimitConfig{
+			Default: 500,
+			Max:     5000,
+		},
+		DiagnosticsMetricKeys:  map[string]uint8{},
+		RetentionInterval:      time.Hour,
+		RetentionBatchSize:     1000,
+		RetentionBatchPause:    50 * time.Millisecond,
+		RetentionDefaults:      defaultRetentionPeriods(),
+		LatestMetricTTL:        30 * time.Second,
+		LatestMetricWarmWindow: time.Hour,
+		LatestMetricWarmLimit:  1000,
 	}
 }
 
@@ -197,6 +288,7 @@ func NormalizeWebConfig(cfg WebConfig) WebConfig {
 	out.HTTPAddr = normalizeOrDefault(out.HTTPAddr, base.HTTPAddr)
 	out.APICORSAllowOrigins = normalizeOrDefault(out.APICORSAllowOrigins, base.APICORSAllowOrigins)
 	out.MaxAPIBodyBytes = normalizePositiveInt64(out.MaxAPIBodyBytes, base.MaxAPIBodyBytes)
+	out.MaxFirmwareBytes = normalizePositiveInt64(out.MaxFirmwareBytes, base.MaxFirmwareBytes)
 
 	out.DeviceListPage.DefaultSize = normalizePositiveInt(out.DeviceListPage.DefaultSize, base.DeviceListPage.DefaultSize)
 	out.DeviceListPage.MaxSize = normalizePositiveInt(out.DeviceListPage.MaxSize, base.DeviceListPage.MaxSize)
@@ -206,6 +298,7 @@ func NormalizeWebConfig(cfg WebConfig) WebConfig {
 
 	out.Metrics.MinValidTimestampMs = normalizePositiveInt64(out.Metrics.MinValidTimestampMs, base.Metrics.MinValidTimestampMs)
 	out.Metrics.DefaultRangeLabel = normalizeMetricsRangeLabel(out.Metrics.DefaultRangeLabel)
+	out.Metrics.MaxPoints = normalizePositiveInt(out.Metrics.MaxPoints, base.Metrics.MaxPoints)
 	out.LoginProtection.MaxFailures = normalizePositiveInt(out.LoginProtection.MaxFailures, base.LoginProtection.MaxFailures)
 	if out.LoginProtection.Window <= 0 {
 		out.LoginProtection.Window = base.LoginProtection.Window
@@ -238,6 +331,10 @@ func NormalizeDeviceManagerConfig(cfg DeviceManagerConfig) DeviceManagerConfig {
 	base := DefaultDeviceManagerConfig()
 	out := cfg
 	out.QueueCapacity = normalizePositiveInt(out.QueueCapacity, base.QueueCapacity)
+	out.QueueBackend = normalizeQueueBackend(out.QueueBackend, base.QueueBackend)
+	if out.QueueClaimLease <= 0 {
+		out.QueueClaimLease = base.QueueClaimLease
+	}
 	if out.HeartbeatDeadline <= 0 {
 		out.HeartbeatDeadline = base.HeartbeatDeadline
 	}
@@ -253,9 +350,102 @@ func NormalizeDeviceManagerConfig(cfg DeviceManagerConfig) DeviceManagerConfig {
 	if out.ExternalObservationLimit.Default > out.ExternalObservationLimit.Max {
 		out.ExternalObservationLimit.Default = out.ExternalObservationLimit.Max
 	}
+
+	out.StateHistoryLimit.Default = normalizePositiveInt(out.StateHistoryLimit.Default, base.StateHistoryLimit.Default)
+	out.StateHistoryLimit.Max = normalizePositiveInt(out.StateHistoryLimit.Max, base.StateHistoryLimit.Max)
+	if out.StateHistoryLimit.Default > out.StateHistoryLimit.Max {
+		out.StateHistoryLimit.Default = out.StateHistoryLimit.Max
+	}
+
+	if out.PresenceSweepInterval <= 0 {
+		out.PresenceSweepInterval = base.PresenceSweepInterval
+	}
+	out.ConnectivityHistoryLimit.Default = normalizePositiveInt(out.ConnectivityHistoryLimit.Default, base.ConnectivityHistoryLimit.Default)
+	out.ConnectivityHistoryLimit.Max = normalizePositiveInt(out.ConnectivityHistoryLimit.Max, base.ConnectivityHistoryLimit.Max)
+	if out.ConnectivityHistoryLimit.Default > out.ConnectivityHistoryLimit.Max {
+		out.ConnectivityHistoryLimit.Default = out.ConnectivityHistoryLimit.Max
+	}
+
+	if out.IngestDedupeTTL <= 0 {
+		out.IngestDedupeTTL = base.IngestDedupeTTL
+	}
+	if out.IngestDedupeCleanupInterval <= 0 {
+		out.IngestDedupeCleanupInterval = base.IngestDedupeCleanupInterval
+	}
+	if out.CommandTTL <= 0 {
+		out.CommandTTL = base.CommandTTL
+	}
+	if out.CommandAckTimeout < 0 {
+		out.CommandAckTimeout = base.CommandAckTimeout
+	}
+	out.CommandMaxAttempts = normalizePositiveInt(out.CommandMaxAttempts, base.CommandMaxAttempts)
+	if out.CommandReapInterval <= 0 {
+		out.CommandReapInterval = base.CommandReapInterval
+	}
+	out.CommandHistoryLimit.Default = normalizePositiveInt(out.CommandHistoryLimit.Default, base.CommandHistoryLimit.Default)
+	out.CommandHistoryLimit.Max = normalizePositiveInt(out.CommandHistoryLimit.Max, base.CommandHistoryLimit.Max)
+	if out.CommandHistoryLimit.Default > out.CommandHistoryLimit.Max {
+		out.CommandHistoryLimit.Default = out.CommandHistoryLimit.Max
+	}
+	if out.SchedulePollInterval <= 0 {
+		out.SchedulePollInterval = base.SchedulePollInterval
+	}
+	if out.OtaPollInterval <= 0 {
+		out.OtaPollInterval = base.OtaPollInterval
+	}
+	out.OtaChunkSize = normalizePositiveInt(out.OtaChunkSize, base.OtaChunkSize)
+	if out.OtaVerifyTimeout <= 0 {
+		out.OtaVerifyTimeout = base.OtaVerifyTimeout
+	}
+	if out.DiagnosticsSampleInterval < 0 {
+		out.DiagnosticsSampleInterval = base.DiagnosticsSampleInterval
+	}
+	out.DiagnosticsHistoryLimit.Default = normalizePositiveInt(out.DiagnosticsHistoryLimit.Default, base.DiagnosticsHistoryLimit.Default)
+	out.DiagnosticsHistoryLimit.Max = normalizePositiveInt(out.DiagnosticsHistoryLimit.Max, base.DiagnosticsHistoryLimit.Max)
+	if out.DiagnosticsHistoryLimit.Default > out.DiagnosticsHistoryLimit.Max {
+		out.DiagnosticsHistoryLimit.Default = out.DiagnosticsHistoryLimit.Max
+	}
+	if out.DiagnosticsMetricKeys == nil {
+		out.DiagnosticsMetricKeys = map[string]uint8{}
+	}
+	if out.RetentionInterval <= 0 {
+		out.RetentionInterval = base.RetentionInterval
+	}
+	out.RetentionBatchSize = normalizePositiveInt(out.RetentionBatchSize, base.RetentionBatchSize)
+	if out.RetentionBatchPause < 0 {
+		out.RetentionBatchPause = base.RetentionBatchPause
+	}
+	defaults := make(map[inter.RetentionDataClass]time.Duration, len(base.RetentionDefaults))
+	for class, fallback := range base.RetentionDefaults {
+		defaults[class] = fallback
+		if period, ok := out.RetentionDefaults[class]; ok && period >= 0 {
+			defaults[class] = period
+		}
+	}
+	out.RetentionDefaults = defaults
+	if out.LatestMetricTTL <= 0 {
+		out.LatestMetricTTL = base.LatestMetricTTL
+	}
+	if out.LatestMetricWarmWindow <= 0 {
+		out.LatestMetricWarmWindow = base.LatestMetricWarmWindow
+	}
+	out.LatestMetricWarmLimit = normalizePositiveInt(out.LatestMetricWarmLimit, base.LatestMetricWarmLimit)
 	return out
 }
 
+// defaultRetentionPeriods 返回平台默认保留期：原始指标 30 天后汇总为小时数据，小时数据保留一年，天汇总永久保留。
+func defaultRetentionPeriods() map[inter.RetentionDataClass]time.Duration {
+	const day = 24 * time.Hour
+	return map[inter.RetentionDataClass]time.Duration{
+		inter.RetentionMetrics:       30 * day,
+		inter.RetentionMetricsHourly: 365 * day,
+		inter.RetentionMetricsDaily:  0,
+		inter.RetentionLogs:          30 * day,
+		inter.RetentionCommands:      90 * day,
+		inter.RetentionObservations:  90 * day,
+	}
+}
+
 func NormalizeDBConfig(cfg DBConfig) DBConfig {
 	base := DefaultDBConfig()
 	out := cfg
@@ -275,6 +465,15 @@ func NormalizeDBConfig(cfg DBConfig) DBConfig {
 	return out
 }
 
+func normalizeQueueBackend(raw string, fallback string) string {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case QueueBackendMemory, QueueBackendDatabase:
+		return strings.ToLower(strings.TrimSpace(raw))
+	default:
+		return fallback
+	}
+}
+
 func normalizeDBSchemaMode(raw string, fallback string) string {
 	switch strings.ToLower(strings.TrimSpace(raw)) {
 	case "bootstrap", "managed":
@@ -316,10 +515,12 @@ func prepareViper(v *viper.Viper) error {
 	v.SetDefault("web.http_addr", defaultWebHTTPAddr)
 	v.SetDefault("web.api_cors_allow_origins", defaultAPICORSAllowOrigins)
 	v.SetDefault("web.max_api_body_bytes", defaultMaxAPIBodyBytes)
+	v.SetDefault("web.max_firmware_bytes", defaultMaxFirmwareBytes)
 	v.SetDefault("web.device_list.default_page_size", 100)
 	v.SetDefault("web.device_list.max_page_size", 1000)
 	v.SetDefault("web.metrics.min_valid_timestamp_ms", defaultMetricsMinValidTimestampMs)
 	v.SetDefault("web.metrics.default_range_label", defaultMetricsRangeLabel)
+	v.SetDefault("web.metrics.max_points", defaultMetricsMaxPoints)
 	v.SetDefault("web.login_protection.max_failures", defaultLoginMaxFailures)
 	v.SetDefault("web.login_protection.window", defaultLoginFailureWindow.String())
 	v.SetDefault("web.login_protection.lockout", defaultLoginLockout.String())
@@ -329,15 +530,48 @@ func prepareViper(v *viper.Viper) error {
 	v.SetDefault("auth.remember_cookie_max_age_seconds", 86400*30)
 
 	v.SetDefault("ingress.token", "")
+	v.SetDefault("ingress.require_credentials", false)
 
 	v.SetDefault("captcha.verify_timeout", "5s")
 
 	v.SetDefault("device_manager.queue_capacity", 100)
+	v.SetDefault("device_manager.queue_backend", QueueBackendMemory)
+	v.SetDefault("device_manager.queue_claim_lease", "1m")
 	v.SetDefault("device_manager.heartbeat_deadline", "60s")
 	v.SetDefault("device_manager.external_list.default_size", 100)
 	v.SetDefault("device_manager.external_list.max_size", 1000)
 	v.SetDefault("device_manager.external_observation.default_limit", 1000)
 	v.SetDefault("device_manager.external_observation.max_limit", 10000)
+	v.SetDefault("device_manager.state_history.default_limit", 1000)
+	v.SetDefault("device_manager.state_history.max_limit", 10000)
+	v.SetDefault("device_manager.presence.sweep_interval", "15s")
+	v.SetDefault("device_manager.connectivity_history.default_limit", 500)
+	v.SetDefault("device_manager.connectivity_history.max_limit", 5000)
+	v.SetDefault("device_manager.ingest_dedupe.ttl", "24h")
+	v.SetDefault("device_manager.ingest_dedupe.cleanup_interval", "10m")
+	v.SetDefault("device_manager.command.ttl", "24h")
+	v.SetDefault("device_manager.command.ack_timeout", "0s")
+	v.SetDefault("device_manager.command.max_attempts", 3)
+	v.SetDefault("device_manager.command.reap_interval", "30s")
+	v.SetDefault("device_manager.command.history_default_limit", 100)
+	v.SetDefault("device_manager.command.history_max_limit", 1000)
+	v.SetDefault("device_manager.schedule.poll_interval", "15s")
+	v.SetDefault("device_manager.ota.poll_interval", "10s")
+	v.SetDefault("device_manager.ota.chunk_size", 16*1024)
+	v.SetDefault("device_manager.ota.verify_timeout", "30m")
+	v.SetDefault("device_manager.diagnostics.sample_interval", "5m")
+	v.SetDefault("device_manager.diagnostics.default_limit", 500)
+	v.SetDefault("device_manager.diagnostics.max_limit", 5000)
+	v.SetDefault("device_manager.diagnostics.metric_keys", "")
+	v.SetDefault("device_manager.retention.interval", "1h")
+	v.SetDefault("device_manager.retention.batch_size", 1000)
+	v.SetDefault("device_manager.retention.batch_pause", "50ms")
+	v.SetDefault("device_manager.retention.metrics", "30d")
+	v.SetDefault("device_manager.retention.metrics_hourly", "365d")
+	v.SetDefault("device_manager.retention.metrics_daily", "0")
+	v.SetDefault("device_manager.retention.logs", "30d")
+	v.SetDefault("device_manager.retention.commands", "90d")
+	v.SetDefault("device_manager.retention.observations", "90d")
 
 	v.SetDefault("logger.level", "info")
 	v.SetDefault("logger.format", "text")
@@ -352,10 +586,12 @@ func prepareViper(v *viper.Viper) error {
 		"web.http_addr":                                     "WEB_HTTP_ADDR",
 		"web.api_cors_allow_origins":                        "API_CORS_ALLOW_ORIGINS",
 		"web.max_api_body_bytes":                            "WEB_API_MAX_BODY_BYTES",
+		"web.max_firmware_bytes":                            "WEB_MAX_FIRMWARE_BYTES",
 		"web.device_list.default_page_size":                 "WEB_DEVICE_LIST_DEFAULT_PAGE_SIZE",
 		"web.device_list.max_page_size":                     "WEB_DEVICE_LIST_MAX_PAGE_SIZE",
 		"web.metrics.min_valid_timestamp_ms":                "WEB_METRICS_MIN_VALID_TIMESTAMP_MS",
 		"web.metrics.default_range_label":                   "WEB_METRICS_DEFAULT_RANGE_LABEL",
+		"web.metrics.max_points":                            "WEB_METRICS_MAX_POINTS",
 		"web.login_protection.max_failures":                 "WEB_LOGIN_MAX_FAILURES",
 		"web.login_protection.window":                       "WEB_LOGIN_WINDOW",
 		"web.login_protection.lockout":                      "WEB_LOGIN_LOCKOUT",
@@ -366,16 +602,52 @@ func prepareViper(v *viper.Viper) error {
 		"auth.session_cookie_max_age_seconds":               "AUTH_SESSION_COOKIE_MAX_AGE_SECONDS",
 		"auth.remember_cookie_max_age_seconds":              "AUTH_REMEMBER_COOKIE_MAX_AGE_SECONDS",
 		"ingress.token":                                     "PROTOCOL_INGRESS_TOKEN",
+		"ingress.require_credentials":                       "PROTOCOL_INGRESS_REQUIRE_CREDENTIALS",
 		"captcha.provider":                                  "CAPTCHA_PROVIDER",
 		"captcha.site_key":                                  "CF_SITE_KEY",
 		"captcha.secret_key":                                "CF_SECRET_KEY",
 		"captcha.verify_timeout":                            "CAPTCHA_VERIFY_TIMEOUT",
 		"device_manager.queue_capacity":                     "DM_QUEUE_CAPACITY",
+		"device_manager.queue_backend":                      "DM_QUEUE_BACKEND",
+		"device_manager.queue_claim_lease":                  "DM_QUEUE_CLAIM_LEASE",
 		"device_manager.heartbeat_deadline":                 "DM_HEARTBEAT_DEADLINE",
 		"device_manager.external_list.default_size":         "DM_EXTERNAL_LIST_DEFAULT_SIZE",
 		"device_manager.external_list.max_size":             "DM_EXTERNAL_LIST_MAX_SIZE",
 		"device_manager.external_observation.default_limit": "DM_EXTERNAL_OBS_DEFAULT_LIMIT",
 		"device_manager.external_observation.max_limit":     "DM_EXTERNAL_OBS_MAX_LIMIT",
+		"device_manager.state_history.default_limit":        "DM_STATE_HISTORY_DEFAULT_LIMIT",
+		"device_manager.state_history.max_limit":            "DM_STATE_HISTORY_MAX_LIMIT",
+		"device_manager.presence.sweep_interval":            "DM_PRESENCE_SWEEP_INTERVAL",
+		"device_manager.connectivity_history.default_limit": "DM_CONNECTIVITY_HISTORY_DEFAULT_LIMIT",
+		"device_manager.connectivity_history.max_limit":     "DM_CONNECTIVITY_HISTORY_MAX_LIMIT",
+		"device_manager.ingest_dedupe.ttl":                  "DM_INGEST_DEDUPE_TTL",
+		"device_manager.ingest_dedupe.cleanup_interval":     "DM_INGEST_DEDUPE_CLEANUP_INTERVAL",
+		"device_manager.command.ttl":                        "DM_COMMAND_TTL",
+		"device_manager.command.ack_timeout":                "DM_COMMAND_ACK_TIMEOUT",
+		"device_manager.command.max_attempts":               "DM_COMMAND_MAX_ATTEMPTS",
+		"device_manager.command.reap_interval":              "DM_COMMAND_REAP_INTERVAL",
+		"device_manager.command.history_default_limit":      "DM_COMMAND_HISTORY_DEFAULT_LIMIT",
+		"device_manager.command.history_max_limit":          "DM_COMMAND_HISTORY_MAX_LIMIT",
+		"device_manager.schedule.poll_interval":             "DM_SCHEDULE_POLL_INTERVAL",
+		"device_manager.ota.poll_interval":                  "DM_OTA_POLL_INTERVAL",
+		"device_manager.ota.chunk_size":                     "DM_OTA_CHUNK_SIZE",
+		"device_manager.ota.verify_timeout":                 "DM_OTA_VERIFY_TIMEOUT",
+		"device_manager.diagnostics.sample_interval":        "DM_DIAGNOSTICS_SAMPLE_INTERVAL",
+		"device_manager.diagnostics.default_limit":          "DM_DIAGNOSTICS_HISTORY_DEFAULT_LIMIT",
+		"device_manager.diagnostics.max_limit":              "DM_DIAGNOSTICS_HISTORY_MAX_LIMIT",
+		"device_manager.diagnostics.metric_keys":            "DM_DIAGNOSTICS_METRIC_KEYS",
+		"device_manager.retention.interval":                 "DM_RETENTION_INTERVAL",
+		"device_manager.retention.batch_size":               "DM_RETENTION_BATCH_SIZE",
+		"device_manager.retention.batch_pause":              "DM_RETENTION_BATCH_PAUSE",
+		"device_manager.retention.metrics":                  "DM_RETENTION_METRICS",
+		"device_manager.retention.metrics_hourly":           "DM_RETENTION_METRICS_HOURLY",
+		"device_manager.retention.metrics_daily":            "DM_RETENTION_METRICS_DAILY",
+		"device_manager.retention.logs":                     "DM_RETENTION_LOGS",
+		"device_manager.retention.commands":                 "DM_RETENTION_COMMANDS",
+		"device_manager.retention.observations":             "DM_RETENTION_OBSERVATIONS",
+		"device_manager.latest_metrics.ttl":                 "DM_LATEST_METRICS_TTL",
+		"device_manager.latest_metrics.warm_window":         "DM_LATEST_METRICS_WARM_WINDOW",
+		"device_manager.latest_metrics.warm_limit":          "DM_LATEST_METRICS_WARM_LIMIT",
 		"logger.level":                                      "LOG_LEVEL",
 		"logger.format":                                     "LOG_FORMAT",
 		"logger.add_source":                                 "LOG_ADD_SOURCE",
@@ -407,7 +679,26 @@ func loadFromViper(v *viper.Viper) AppConfig {
 	cookieSecureRaw := strings.TrimSpace(v.GetString("auth.cookie_secure"))
 
 	captchaVerifyTimeout := parseDurationOrDefault(v.GetString("captcha.verify_timeout"), base.Captcha.VerifyTimeout)
+	queueClaimLease := parseDurationOrDefault(v.GetString("device_manager.queue_claim_lease"), base.DeviceManager.QueueClaimLease)
 	heartbeatDeadline := parseDurationOrDefault(v.GetString("device_manager.heartbeat_deadline"), base.DeviceManager.HeartbeatDeadline)
+	presenceSweep := parseDurationOrDefault(v.GetString("device_manager.presence.sweep_interval"), base.DeviceManager.PresenceSweepInterval)
+	dedupeTTL := parseDurationOrDefault(v.GetString("device_manager.ingest_dedupe.ttl"), base.DeviceManager.IngestDedupeTTL)
+	dedupeCleanup := parseDurationOrDefault(v.GetString("device_manager.ingest_dedupe.cleanup_interval"), base.DeviceManager.IngestDedupeCleanupInterval)
+	commandTTL := parseDurationOrDefault(v.GetString("device_manager.command.ttl"), base.DeviceManager.CommandTTL)
+	commandAckTimeout := parseDurationOrDefault(v.GetString("device_manager.command.ack_timeout"), base.DeviceManager.CommandAckTimeout)
+	commandReap := parseDurationOrDefault(v.GetString("device_manager.command.reap_interval"), base.DeviceManager.CommandReapInterval)
+	schedulePoll := parseDurationOrDefault(v.GetString("device_manager.schedule.poll_interval"), base.DeviceManager.SchedulePollInterval)
+	otaPoll := parseDurationOrDefault(v.GetString("device_manager.ota.poll_interval"), base.DeviceManager.OtaPollInterval)
+	otaVerify := parseDurationOrDefault(v.GetString("device_manager.ota.verify_timeout"), base.DeviceManager.OtaVerifyTimeout)
+	diagnosticsSample := parseDurationOrDefault(v.GetString("device_manager.diagnostics.sample_interval"), base.DeviceManager.DiagnosticsSampleInterval)
+	retentionInterval := parseDurationOrDefault(v.GetString("device_manager.retention.interval"), base.DeviceManager.RetentionInterval)
+	retentionPause := parseDurationOrDefault(v.GetString("device_manager.retention.batch_pause"), base.DeviceManager.RetentionBatchPause)
+	latestTTL := parseDurationOrDefault(v.GetString("device_manager.latest_metrics.ttl"), base.DeviceManager.LatestMetricTTL)
+	latestWarmWindow := parseDurationOrDefault(v.GetString("device_manager.latest_metrics.warm_window"), base.DeviceManager.LatestMetricWarmWindow)
+	retentionDefaults := make(map[inter.RetentionDataClass]time.Duration, len(base.DeviceManager.RetentionDefaults))
+	for class, fallback := range base.DeviceManager.RetentionDefaults {
+		retentionDefaults[class] = parseRetentionOrDefault(v.GetString("device_manager.retention."+string(class)), fallback)
+	}
 	loginWindow := parseDurationOrDefault(v.GetString("web.login_protection.window"), base.Web.LoginProtection.Window)
 	loginLockout := parseDurationOrDefault(v.GetString("web.login_protection.lockout"), base.Web.LoginProtection.Lockout)
 
@@ -422,6 +713,7 @@ func loadFromViper(v *viper.Viper) AppConfig {
 			HTTPAddr:            strings.TrimSpace(v.GetString("web.http_addr")),
 			APICORSAllowOrigins: strings.TrimSpace(v.GetString("web.api_cors_allow_origins")),
 			MaxAPIBodyBytes:     normalizePositiveInt64(v.GetInt64("web.max_api_body_bytes"), base.Web.MaxAPIBodyBytes),
+			MaxFirmwareBytes:    normalizePositiveInt64(v.GetInt64("web.max_firmware_bytes"), base.Web.MaxFirmwareBytes),
 			DeviceListPage: PaginationConfig{
 				DefaultSize: normalizePositiveInt(v.GetInt("web.device_list.default_page_size"), base.Web.DeviceListPage.DefaultSize),
 				MaxSize:     normalizePositiveInt(v.GetInt("web.device_list.max_page_size"), base.Web.DeviceListPage.MaxSize),
@@ -429,6 +721,7 @@ func loadFromViper(v *viper.Viper) AppConfig {
 			Metrics: MetricsConfig{
 				MinValidTimestampMs: normalizePositiveInt64(v.GetInt64("web.metrics.min_valid_timestamp_ms"), base.Web.Metrics.MinValidTimestampMs),
 				DefaultRangeLabel:   normalizeMetricsRangeLabel(v.GetString("web.metrics.default_range_label")),
+				MaxPoints:           normalizePositiveInt(v.GetInt("web.metrics.max_points"), base.Web.Metrics.MaxPoints),
 			},
 			LoginProtection: LoginProtectionConfig{
 				MaxFailures: normalizePositiveInt(v.GetInt("web.login_protection.max_failures"), base.Web.LoginProtection.MaxFailures),
@@ -445,7 +738,8 @@ func loadFromViper(v *viper.Viper) AppConfig {
 			RememberCookieMaxAgeSeconds: normalizePositiveInt(v.GetInt("auth.remember_cookie_max_age_seconds"), base.Auth.RememberCookieMaxAgeSeconds),
 		},
 		Ingress: IngressConfig{
-			Token: strings.TrimSpace(v.GetString("ingress.token")),
+			Token:              strings.TrimSpace(v.GetString("ingress.token")),
+			RequireCredentials: v.GetBool("ingress.require_credentials"),
 		},
 		Captcha: CaptchaConfig{
 			Provider:      strings.TrimSpace(v.GetString("captcha.provider")),
@@ -455,6 +749,8 @@ func loadFromViper(v *viper.Viper) AppConfig {
 		},
 		DeviceManager: DeviceManagerConfig{
 			QueueCapacity:     normalizePositiveInt(v.GetInt("device_manager.queue_capacity"), base.DeviceManager.QueueCapacity),
+			QueueBackend:      normalizeQueueBackend(v.GetString("device_manager.queue_backend"), base.DeviceManager.QueueBackend),
+			QueueClaimLease:   queueClaimLease,
 			HeartbeatDeadline: heartbeatDeadline,
 			ExternalListPage: PaginationConfig{
 				DefaultSize: normalizePositiveInt(v.GetInt("device_manager.external_list.default_size"), base.DeviceManager.ExternalListPage.DefaultSize),
@@ -464,6 +760,42 @@ func loadFromViper(v *viper.Viper) AppConfig {
 				Default: normalizePositiveInt(v.GetInt("device_manager.external_observation.default_limit"), base.DeviceManager.ExternalObservationLimit.Default),
 				Max:     normalizePositiveInt(v.GetInt("device_manager.external_observation.max_limit"), base.DeviceManager.ExternalObservationLimit.Max),
 			},
+			StateHistoryLimit: LimitConfig{
+				Default: normalizePositiveInt(v.GetInt("device_manager.state_history.default_limit"), base.DeviceManager.StateHistoryLimit.Default),
+				Max:     normalizePositiveInt(v.GetInt("device_manager.state_history.max_limit"), base.DeviceManager.StateHistoryLimit.Max),
+			},
+			PresenceSweepInterval: presenceSweep,
+			ConnectivityHistoryLimit: LimitConfig{
+				Default: normalizePositiveInt(v.GetInt("device_manager.connectivity_history.default_limit"), base.DeviceManager.ConnectivityHistoryLimit.Default),
+				Max:     normalizePositiveInt(v.GetInt("device_manager.connectivity_history.max_limit"), base.DeviceManager.ConnectivityHistoryLimit.Max),
+			},
+			IngestDedupeTTL:             dedupeTTL,
+			IngestDedupeCleanupInterval: dedupeCleanup,
+			CommandTTL:                  commandTTL,
+			CommandAckTimeout:           commandAckTimeout,
+			CommandMaxAttempts:          normalizePositiveInt(v.GetInt("device_manager.command.max_attempts"), base.DeviceManager.CommandMaxAttempts),
+			CommandReapInterval:         commandReap,
+			CommandHistoryLimit: LimitConfig{
+				Default: normalizePositiveInt(v.GetInt("device_manager.command.history_default_limit"), base.DeviceManager.CommandHistoryLimit.Default),
+				Max:     normalizePositiveInt(v.GetInt("device_manager.command.history_max_limit"), base.DeviceManager.CommandHistoryLimit.Max),
+			},
+			SchedulePollInterval:      schedulePoll,
+			OtaPollInterval:           otaPoll,
+			OtaChunkSize:              normalizePositiveInt(v.GetInt("device_manager.ota.chunk_size"), base.DeviceManager.OtaChunkSize),
+			OtaVerifyTimeout:          otaVerify,
+			DiagnosticsSampleInterval: diagnosticsSample,
+			DiagnosticsHistoryLimit: LimitConfig{
+				Default: normalizePositiveInt(v.GetInt("device_manager.diagnostics.default_limit"), base.DeviceManager.DiagnosticsHistoryLimit.Default),
+				Max:     normalizePositiveInt(v.GetInt("device_manager.diagnostics.max_limit"), base.DeviceManager.DiagnosticsHistoryLimit.Max),
+			},
+			DiagnosticsMetricKeys:  ParseDiagnosticsMetricKeys(v.GetString("device_manager.diagnostics.metric_keys")),
+			RetentionInterval:      retentionInterval,
+			RetentionBatchSize:     normalizePositiveInt(v.GetInt("device_manager.retention.batch_size"), base.DeviceManager.RetentionBatchSize),
+			RetentionBatchPause:    retentionPause,
+			RetentionDefaults:      retentionDefaults,
+			LatestMetricTTL:        latestTTL,
+			LatestMetricWarmWindow: latestWarmWindow,
+			LatestMetricWarmLimit:  normalizePositiveInt(v.GetInt("device_manager.latest_metrics.warm_limit"), base.DeviceManager.LatestMetricWarmLimit),
 		},
 		Logger: logger.Config{
 			Level:     normalizeLogLevel(v.GetString("logger.level")),
@@ -481,6 +813,24 @@ func loadFromViper(v *viper.Viper) AppConfig {
 	return out
 }
 
+// ParseDiagnosticsMetricKeys 解析 `battery:64,rssi:32` 形式的诊断键到 metric type 映射，非法条目会被忽略。
+func ParseDiagnosticsMetricKeys(raw string) map[string]uint8 {
+	out := map[string]uint8{}
+	for _, item := range strings.Split(raw, ",") {
+		key, typ, ok := strings.Cut(strings.TrimSpace(item), ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(typ), 10, 8)
+		if err != nil || n == 0 {
+			continue
+		}
+		out[key] = uint8(n)
+	}
+	return out
+}
+
 func normalizeLogLevel(raw string) string {
 	switch strings.ToLower(strings.TrimSpace(raw)) {
 	case "debug", "info", "warn", "error":
@@ -528,6 +878,25 @@ func normalizePositiveInt64(raw int64, fallback int64) int64 {
 	return raw
 }
 
+// parseRetentionOrDefault 解析保留期，接受 `30d` 这类天/周写法与 Go 时长，`0` 表示永久保留。
+func parseRetentionOrDefault(raw string, fallback time.Duration) time.Duration {
+	val := strings.TrimSpace(raw)
+	if val == "" {
+		return fallback
+	}
+	if val == "0" {
+		return 0
+	}
+	if parsed, err := inter.ParseMetricDuration(val); err == nil {
+		return parsed
+	}
+	parsed, err := time.ParseDuration(val)
+	if err != nil || parsed < 0 {
+		return fallback
+	}
+	return parsed
+}
+
 func parseDurationOrDefault(raw string, fallback time.Duration) time.Duration {
 	val := strings.TrimSpace(raw)
 	if val == "" {
@@ -541,10 +910,12 @@ func parseDurationOrDefault(raw string, fallback time.Duration) time.Duration {
 }
 
 func normalizeMetricsRangeLabel(raw string) string {
-	switch strings.TrimSpace(raw) {
-	case "1h", "6h", "24h", "7d", "all":
-		return strings.TrimSpace(raw)
-	default:
+	raw = strings.TrimSpace(raw)
+	if raw == "all" {
+		return raw
+	}
+	if _, err := inter.ParseMetricDuration(raw); err != nil {
 		return defaultMetricsRangeLabel
 	}
+	return raw
 }
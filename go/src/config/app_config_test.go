@@ -3,6 +3,8 @@ package config
 import (
 	"testing"
 	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
 )
 
 func TestLoadDefaults(t *testing.T) {
@@ -13,10 +15,12 @@ func TestLoadDefaults(t *testing.T) {
 	t.Setenv("WEB_HTTP_ADDR", "")
 	t.Setenv("API_CORS_ALLOW_ORIGINS", "")
 	t.Setenv("WEB_API_MAX_BODY_BYTES", "")
+	t.Setenv("WEB_MAX_FIRMWARE_BYTES", "")
 	t.Setenv("WEB_DEVICE_LIST_DEFAULT_PAGE_SIZE", "")
 	t.Setenv("WEB_DEVICE_LIST_MAX_PAGE_SIZE", "")
 	t.Setenv("WEB_METRICS_MIN_VALID_TIMESTAMP_MS", "")
 	t.Setenv("WEB_METRICS_DEFAULT_RANGE_LABEL", "")
+	t.Setenv("WEB_METRICS_MAX_POINTS", "")
 	t.Setenv("WEB_LOGIN_MAX_FAILURES", "")
 	t.Setenv("WEB_LOGIN_WINDOW", "")
 	t.Setenv("WEB_LOGIN_LOCKOUT", "")
@@ -27,11 +31,24 @@ func TestLoadDefaults(t *testing.T) {
 	t.Setenv("PROTOCOL_INGRESS_TOKEN", "")
 	t.Setenv("CAPTCHA_VERIFY_TIMEOUT", "")
 	t.Setenv("DM_QUEUE_CAPACITY", "")
+	t.Setenv("DM_QUEUE_BACKEND", "")
+	t.Setenv("DM_QUEUE_CLAIM_LEASE", "")
 	t.Setenv("DM_HEARTBEAT_DEADLINE", "")
 	t.Setenv("DM_EXTERNAL_LIST_DEFAULT_SIZE", "")
 	t.Setenv("DM_EXTERNAL_LIST_MAX_SIZE", "")
 	t.Setenv("DM_EXTERNAL_OBS_DEFAULT_LIMIT", "")
 	t.Setenv("DM_EXTERNAL_OBS_MAX_LIMIT", "")
+	t.Setenv("DM_DIAGNOSTICS_SAMPLE_INTERVAL", "")
+	t.Setenv("DM_DIAGNOSTICS_METRIC_KEYS", "")
+	t.Setenv("DM_COMMAND_HISTORY_DEFAULT_LIMIT", "")
+	t.Setenv("DM_COMMAND_HISTORY_MAX_LIMIT", "")
+	t.Setenv("DM_SCHEDULE_POLL_INTERVAL", "")
+	t.Setenv("DM_OTA_POLL_INTERVAL", "")
+	t.Setenv("DM_OTA_CHUNK_SIZE", "")
+	t.Setenv("DM_OTA_VERIFY_TIMEOUT", "")
+	t.Setenv("DM_RETENTION_INTERVAL", "")
+	t.Setenv("DM_RETENTION_METRICS", "")
+	t.Setenv("DM_RETENTION_LOGS", "")
 	t.Setenv("APP_ENV", "")
 	t.Setenv("LOG_LEVEL", "")
 	t.Setenv("LOG_FORMAT", "")
@@ -56,10 +73,13 @@ func TestLoadDefaults(t *testing.T) {
 	if cfg.Web.MaxAPIBodyBytes != defaultMaxAPIBodyBytes {
 		t.Fatalf("unexpected max api body bytes: %d", cfg.Web.MaxAPIBodyBytes)
 	}
+	if cfg.Web.MaxFirmwareBytes != defaultMaxFirmwareBytes {
+		t.Fatalf("unexpected max firmware bytes: %d", cfg.Web.MaxFirmwareBytes)
+	}
 	if cfg.Web.DeviceListPage.DefaultSize != 100 || cfg.Web.DeviceListPage.MaxSize != 1000 {
 		t.Fatalf("unexpected web device list page config: %+v", cfg.Web.DeviceListPage)
 	}
-	if cfg.Web.Metrics.MinValidTimestampMs != defaultMetricsMinValidTimestampMs || cfg.Web.Metrics.DefaultRangeLabel != defaultMetricsRangeLabel {
+	if cfg.Web.Metrics.MinValidTimestampMs != defaultMetricsMinValidTimestampMs || cfg.Web.Metrics.DefaultRangeLabel != defaultMetricsRangeLabel || cfg.Web.Metrics.MaxPoints != defaultMetricsMaxPoints {
 		t.Fatalf("unexpected web metrics config: %+v", cfg.Web.Metrics)
 	}
 	if cfg.Web.LoginProtection.MaxFailures != defaultLoginMaxFailures || cfg.Web.LoginProtection.Window != defaultLoginFailureWindow || cfg.Web.LoginProtection.Lockout != defaultLoginLockout {
@@ -80,12 +100,30 @@ func TestLoadDefaults(t *testing.T) {
 	if cfg.DeviceManager.QueueCapacity != 100 || cfg.DeviceManager.HeartbeatDeadline != 60*time.Second {
 		t.Fatalf("unexpected device manager base config: %+v", cfg.DeviceManager)
 	}
+	if cfg.DeviceManager.QueueBackend != QueueBackendMemory || cfg.DeviceManager.QueueClaimLease != time.Minute {
+		t.Fatalf("unexpected device manager queue config: %+v", cfg.DeviceManager)
+	}
+	if cfg.DeviceManager.CommandHistoryLimit.Default != 100 || cfg.DeviceManager.CommandHistoryLimit.Max != 1000 {
+		t.Fatalf("unexpected device manager command history config: %+v", cfg.DeviceManager.CommandHistoryLimit)
+	}
+	if cfg.DeviceManager.SchedulePollInterval != 15*time.Second {
+		t.Fatalf("unexpected device manager schedule poll interval: %s", cfg.DeviceManager.SchedulePollInterval)
+	}
+	if cfg.DeviceManager.OtaPollInterval != 10*time.Second || cfg.DeviceManager.OtaChunkSize != 16*1024 || cfg.DeviceManager.OtaVerifyTimeout != 30*time.Minute {
+		t.Fatalf("unexpected device manager ota config: %+v", cfg.DeviceManager)
+	}
 	if cfg.DeviceManager.ExternalListPage.DefaultSize != 100 || cfg.DeviceManager.ExternalListPage.MaxSize != 1000 {
 		t.Fatalf("unexpected device manager external list config: %+v", cfg.DeviceManager.ExternalListPage)
 	}
 	if cfg.DeviceManager.ExternalObservationLimit.Default != 1000 || cfg.DeviceManager.ExternalObservationLimit.Max != 10000 {
 		t.Fatalf("unexpected device manager external obs config: %+v", cfg.DeviceManager.ExternalObservationLimit)
 	}
+	if cfg.DeviceManager.DiagnosticsSampleInterval != 5*time.Minute || len(cfg.DeviceManager.DiagnosticsMetricKeys) != 0 {
+		t.Fatalf("unexpected device manager diagnostics config: %+v", cfg.DeviceManager)
+	}
+	if dm := cfg.DeviceManager; dm.RetentionInterval != time.Hour || dm.RetentionDefaults[inter.RetentionMetrics] != 30*24*time.Hour || dm.RetentionDefaults[inter.RetentionMetricsDaily] != 0 {
+		t.Fatalf("unexpected device manager retention config: %v %v", dm.RetentionInterval, dm.RetentionDefaults)
+	}
 	if cfg.Logger.Level != "info" || cfg.Logger.Format != "text" || cfg.Logger.Env != "dev" {
 		t.Fatalf("unexpected logger defaults: %+v", cfg.Logger)
 	}
@@ -99,10 +137,12 @@ func TestLoadEnvOverrides(t *testing.T) {
 	t.Setenv("WEB_HTTP_ADDR", ":9000")
 	t.Setenv("API_CORS_ALLOW_ORIGINS", "https://fe.example.com")
 	t.Setenv("WEB_API_MAX_BODY_BYTES", "2097152")
+	t.Setenv("WEB_MAX_FIRMWARE_BYTES", "4194304")
 	t.Setenv("WEB_DEVICE_LIST_DEFAULT_PAGE_SIZE", "30")
 	t.Setenv("WEB_DEVICE_LIST_MAX_PAGE_SIZE", "2000")
 	t.Setenv("WEB_METRICS_MIN_VALID_TIMESTAMP_MS", "1700000000000")
 	t.Setenv("WEB_METRICS_DEFAULT_RANGE_LABEL", "24h")
+	t.Setenv("WEB_METRICS_MAX_POINTS", "500")
 	t.Setenv("WEB_LOGIN_MAX_FAILURES", "7")
 	t.Setenv("WEB_LOGIN_WINDOW", "20m")
 	t.Setenv("WEB_LOGIN_LOCKOUT", "45m")
@@ -111,6 +151,7 @@ func TestLoadEnvOverrides(t *testing.T) {
 	t.Setenv("AUTH_SESSION_COOKIE_MAX_AGE_SECONDS", "120")
 	t.Setenv("AUTH_REMEMBER_COOKIE_MAX_AGE_SECONDS", "86400")
 	t.Setenv("PROTOCOL_INGRESS_TOKEN", "shared-ingress-secret")
+	t.Setenv("PROTOCOL_INGRESS_REQUIRE_CREDENTIALS", "true")
 	t.Setenv("GITHUB_CLIENT_ID", "gh_id")
 	t.Setenv("GITHUB_CLIENT_SECRET", "gh_secret")
 	t.Setenv("CAPTCHA_PROVIDER", "turnstile")
@@ -118,11 +159,24 @@ func TestLoadEnvOverrides(t *testing.T) {
 	t.Setenv("CF_SECRET_KEY", "secret_key")
 	t.Setenv("CAPTCHA_VERIFY_TIMEOUT", "3s")
 	t.Setenv("DM_QUEUE_CAPACITY", "256")
+	t.Setenv("DM_QUEUE_BACKEND", "Database")
+	t.Setenv("DM_QUEUE_CLAIM_LEASE", "30s")
 	t.Setenv("DM_HEARTBEAT_DEADLINE", "90s")
 	t.Setenv("DM_EXTERNAL_LIST_DEFAULT_SIZE", "50")
 	t.Setenv("DM_EXTERNAL_LIST_MAX_SIZE", "500")
 	t.Setenv("DM_EXTERNAL_OBS_DEFAULT_LIMIT", "2000")
 	t.Setenv("DM_EXTERNAL_OBS_MAX_LIMIT", "30000")
+	t.Setenv("DM_DIAGNOSTICS_SAMPLE_INTERVAL", "1m")
+	t.Setenv("DM_DIAGNOSTICS_METRIC_KEYS", "battery:64, rssi:32,bad")
+	t.Setenv("DM_COMMAND_HISTORY_DEFAULT_LIMIT", "20")
+	t.Setenv("DM_COMMAND_HISTORY_MAX_LIMIT", "200")
+	t.Setenv("DM_SCHEDULE_POLL_INTERVAL", "1m")
+	t.Setenv("DM_OTA_POLL_INTERVAL", "5s")
+	t.Setenv("DM_OTA_CHUNK_SIZE", "4096")
+	t.Setenv("DM_OTA_VERIFY_TIMEOUT", "1h")
+	t.Setenv("DM_RETENTION_INTERVAL", "15m")
+	t.Setenv("DM_RETENTION_METRICS", "7d")
+	t.Setenv("DM_RETENTION_LOGS", "0")
 	t.Setenv("LOG_LEVEL", "DEBUG")
 	t.Setenv("LOG_FORMAT", "json")
 	t.Setenv("LOG_ADD_SOURCE", "true")
@@ -146,10 +200,13 @@ func TestLoadEnvOverrides(t *testing.T) {
 	if cfg.Web.MaxAPIBodyBytes != 2097152 {
 		t.Fatalf("unexpected web max body bytes: %d", cfg.Web.MaxAPIBodyBytes)
 	}
+	if cfg.Web.MaxFirmwareBytes != 4194304 {
+		t.Fatalf("unexpected web max firmware bytes: %d", cfg.Web.MaxFirmwareBytes)
+	}
 	if cfg.Web.DeviceListPage.DefaultSize != 30 || cfg.Web.DeviceListPage.MaxSize != 2000 {
 		t.Fatalf("unexpected web page config: %+v", cfg.Web.DeviceListPage)
 	}
-	if cfg.Web.Metrics.MinValidTimestampMs != 1700000000000 || cfg.Web.Metrics.DefaultRangeLabel != "24h" {
+	if cfg.Web.Metrics.MinValidTimestampMs != 1700000000000 || cfg.Web.Metrics.DefaultRangeLabel != "24h" || cfg.Web.Metrics.MaxPoints != 500 {
 		t.Fatalf("unexpected web metrics config: %+v", cfg.Web.Metrics)
 	}
 	if cfg.Web.LoginProtection.MaxFailures != 7 || cfg.Web.LoginProtection.Window != 20*time.Minute || cfg.Web.LoginProtection.Lockout != 45*time.Minute {
@@ -164,8 +221,8 @@ func TestLoadEnvOverrides(t *testing.T) {
 	if cfg.Auth.GitHubClientID != "gh_id" || cfg.Auth.GitHubClientSecret != "gh_secret" {
 		t.Fatalf("unexpected github auth config: %+v", cfg.Auth)
 	}
-	if cfg.Ingress.Token != "shared-ingress-secret" {
-		t.Fatalf("unexpected ingress token: %q", cfg.Ingress.Token)
+	if cfg.Ingress.Token != "shared-ingress-secret" || !cfg.Ingress.RequireCredentials {
+		t.Fatalf("unexpected ingress config: %+v", cfg.Ingress)
 	}
 	if cfg.Captcha.Provider != "turnstile" || cfg.Captcha.SiteKey != "site_key" || cfg.Captcha.SecretKey != "secret_key" || cfg.Captcha.VerifyTimeout != 3*time.Second {
 		t.Fatalf("unexpected captcha config: %+v", cfg.Captcha)
@@ -173,12 +230,30 @@ func TestLoadEnvOverrides(t *testing.T) {
 	if cfg.DeviceManager.QueueCapacity != 256 || cfg.DeviceManager.HeartbeatDeadline != 90*time.Second {
 		t.Fatalf("unexpected device manager config: %+v", cfg.DeviceManager)
 	}
+	if cfg.DeviceManager.QueueBackend != QueueBackendDatabase || cfg.DeviceManager.QueueClaimLease != 30*time.Second {
+		t.Fatalf("unexpected dm queue config: %+v", cfg.DeviceManager)
+	}
+	if cfg.DeviceManager.CommandHistoryLimit.Default != 20 || cfg.DeviceManager.CommandHistoryLimit.Max != 200 {
+		t.Fatalf("unexpected dm command history config: %+v", cfg.DeviceManager.CommandHistoryLimit)
+	}
+	if cfg.DeviceManager.SchedulePollInterval != time.Minute {
+		t.Fatalf("unexpected dm schedule poll interval: %s", cfg.DeviceManager.SchedulePollInterval)
+	}
+	if cfg.DeviceManager.OtaPollInterval != 5*time.Second || cfg.DeviceManager.OtaChunkSize != 4096 || cfg.DeviceManager.OtaVerifyTimeout != time.Hour {
+		t.Fatalf("unexpected dm ota config: %+v", cfg.DeviceManager)
+	}
 	if cfg.DeviceManager.ExternalListPage.DefaultSize != 50 || cfg.DeviceManager.ExternalListPage.MaxSize != 500 {
 		t.Fatalf("unexpected dm list page config: %+v", cfg.DeviceManager.ExternalListPage)
 	}
 	if cfg.DeviceManager.ExternalObservationLimit.Default != 2000 || cfg.DeviceManager.ExternalObservationLimit.Max != 30000 {
 		t.Fatalf("unexpected dm obs limit config: %+v", cfg.DeviceManager.ExternalObservationLimit)
 	}
+	if keys := cfg.DeviceManager.DiagnosticsMetricKeys; cfg.DeviceManager.DiagnosticsSampleInterval != time.Minute || len(keys) != 2 || keys["battery"] != 64 || keys["rssi"] != 32 {
+		t.Fatalf("unexpected dm diagnostics config: %v %v", cfg.DeviceManager.DiagnosticsSampleInterval, keys)
+	}
+	if dm := cfg.DeviceManager; dm.RetentionInterval != 15*time.Minute || dm.RetentionDefaults[inter.RetentionMetrics] != 7*24*time.Hour || dm.RetentionDefaults[inter.RetentionLogs] != 0 || dm.RetentionDefaults[inter.RetentionCommands] != 90*24*time.Hour {
+		t.Fatalf("unexpected dm retention config: %v %v", dm.RetentionInterval, dm.RetentionDefaults)
+	}
 	if cfg.Logger.Level != "debug" || cfg.Logger.Format != "json" || !cfg.Logger.AddSource || cfg.Logger.Service != "iot-backend" || cfg.Logger.Env != "test" {
 		t.Fatalf("unexpected logger config: %+v", cfg.Logger)
 	}
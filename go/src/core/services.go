@@ -1,20 +1,38 @@
 package core
 
 import (
+	"errors"
+
 	appcfg "github.com/nhirsama/Goster-IoT/src/config"
 	"github.com/nhirsama/Goster-IoT/src/device_manager"
 	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
 )
 
 // Services 代表核心业务层对外暴露的一组标准服务。
 // 启动入口和测试夹具优先从这里取依赖，避免继续散落地手工拼装对象。
 type Services struct {
-	DeviceRegistry   inter.DeviceRegistry
-	DevicePresence   inter.DevicePresence
-	ExternalEntities inter.ExternalEntityService
-	TelemetryIngest  inter.TelemetryIngestService
-	DownlinkQueue    inter.DeviceCommandQueue
-	DownlinkCommands inter.DownlinkCommandService
+	DeviceRegistry     inter.DeviceRegistry
+	DevicePresence     inter.DevicePresence
+	ExternalEntities   inter.ExternalEntityService
+	ExternalCommands   inter.ExternalCommandService
+	DeviceStates       inter.DeviceStateService
+	DeviceShadows      inter.DeviceShadowService
+	DeviceTopology     inter.DeviceTopologyService
+	DeviceDiagnostics  inter.DeviceDiagnosticsService
+	TelemetryIngest    inter.TelemetryIngestService
+	LatestMetrics      inter.LatestMetricService
+	DownlinkQueue      inter.DeviceCommandQueue
+	DownlinkCommands   inter.DownlinkCommandService
+	CommandSchedules   inter.CommandScheduleService
+	CommandBatches     inter.CommandBatchService
+	DeviceGroups       inter.DeviceGroupService
+	Ota                inter.OtaService
+	DeviceConfigs      inter.DeviceConfigService
+	Retention          inter.RetentionService
+	CommandNotifier    inter.CommandNotifier
+	IngestDedupe       inter.IngestDedupeService
+	IngressCredentials inter.IngressCredentialService
 }
 
 // NewServices 使用默认配置构建核心服务集合。
@@ -29,18 +47,83 @@ func NewServicesWithConfig(ds inter.CoreStore, cfg appcfg.DeviceManagerConfig) S
 	}
 
 	n := appcfg.NormalizeDeviceManagerConfig(cfg)
-	presence := device_manager.NewDevicePresenceWithStore(n.HeartbeatDeadline, device_manager.NewInMemoryDevicePresenceStore())
+	// 影子服务依赖在线状态判断，在线状态又要在设备上线时触发影子对账，这里通过闭包延迟绑定。
+	var shadows inter.DeviceShadowService
+	var presence *device_manager.DevicePresenceService
+	topology := device_manager.NewDeviceTopologyService(ds)
+	presence = device_manager.NewDevicePresenceWithHooks(n.HeartbeatDeadline, device_manager.NewInMemoryDevicePresenceStore(), device_manager.DevicePresenceHooks{
+		OnOnline: func(uuid string) {
+			if shadows == nil {
+				return
+			}
+			if err := shadows.Reconcile(uuid); err != nil {
+				logger.Default().With(inter.String("module", "core")).Warn("设备上线后影子对账失败",
+					inter.String("uuid", uuid), inter.Err(err))
+			}
+		},
+		// 网关离线时其子设备也无法通达云端；子设备各自的离线钩子会继续向下级联。
+		OnOffline: func(uuid string) {
+			children, err := topology.ChildUUIDs(uuid)
+			if err != nil {
+				return
+			}
+			for _, child := range children {
+				presence.ReportAvailability(child, false, "gateway_offline")
+			}
+		},
+	})
+	presence.SetConnectivityHistory(ds, n)
+	latest := device_manager.NewLatestMetricService(ds, n)
+	telemetry := device_manager.NewTelemetryIngestServiceWithLatest(ds, latest)
+	diagnostics := device_manager.NewDeviceDiagnosticsService(ds, telemetry, n)
 	registry := device_manager.NewDeviceRegistryWithHooks(ds, device_manager.DeviceRegistryHooks{
-		OnDelete: presence.RemoveDevice,
+		OnDelete: func(uuid string) {
+			presence.RemoveDevice(uuid)
+			diagnostics.RemoveDevice(uuid)
+			latest.RemoveDevice(uuid)
+		},
+	})
+	var queue inter.DeviceCommandQueue = device_manager.NewDeviceCommandQueueWithStore(n.QueueCapacity, ds)
+	if n.QueueBackend == appcfg.QueueBackendDatabase {
+		queue = device_manager.NewDatabaseDeviceCommandQueue(ds, n.QueueCapacity, n.QueueClaimLease)
+	}
+	notifier := device_manager.NewCommandNotifier()
+	downlink := device_manager.NewDownlinkCommandServiceWithConfig(ds, queue, notifier, n)
+	shadows = device_manager.NewDeviceShadowService(ds, downlink, presence)
+	ota := device_manager.NewOtaService(ds, downlink, n)
+	downlink.SetPayloadRenderer(inter.CmdOtaData, ota.RenderChunk)
+	downlink.SetCapabilityLookup(func(uuid string) ([]inter.DeviceCapability, error) {
+		meta, err := ds.LoadConfig(uuid)
+		if errors.Is(err, inter.ErrDeviceNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return meta.Descriptor.Capabilities, nil
 	})
-	queue := device_manager.NewDeviceCommandQueue(n.QueueCapacity)
 
 	return Services{
-		DeviceRegistry:   registry,
-		DevicePresence:   presence,
-		ExternalEntities: device_manager.NewExternalEntityService(ds, n),
-		TelemetryIngest:  device_manager.NewTelemetryIngestService(ds),
-		DownlinkQueue:    queue,
-		DownlinkCommands: device_manager.NewDownlinkCommandService(ds, queue),
+		DeviceRegistry:     registry,
+		DevicePresence:     presence,
+		ExternalEntities:   device_manager.NewExternalEntityService(ds, n),
+		ExternalCommands:   device_manager.NewExternalCommandServiceWithNotifier(ds, notifier),
+		DeviceStates:       device_manager.NewDeviceStateService(ds, n),
+		DeviceShadows:      shadows,
+		DeviceTopology:     topology,
+		DeviceDiagnostics:  diagnostics,
+		TelemetryIngest:    telemetry,
+		LatestMetrics:      latest,
+		DownlinkQueue:      queue,
+		DownlinkCommands:   downlink,
+		CommandSchedules:   device_manager.NewCommandScheduleService(ds, downlink, n),
+		CommandBatches:     device_manager.NewCommandBatchService(ds, downlink),
+		DeviceGroups:       device_manager.NewDeviceGroupService(ds),
+		Ota:                ota,
+		DeviceConfigs:      device_manager.NewDeviceConfigService(ds, downlink),
+		Retention:          device_manager.NewRetentionService(ds, n),
+		CommandNotifier:    notifier,
+		IngestDedupe:       device_manager.NewIngestDedupeService(ds, n),
+		IngressCredentials: device_manager.NewIngressCredentialService(ds),
 	}
 }
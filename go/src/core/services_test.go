@@ -1,13 +1,17 @@
 package core
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"connectrpc.com/connect"
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
 	appcfg "github.com/nhirsama/Goster-IoT/src/config"
 	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/nhirsama/Goster-IoT/src/persistence"
+	"github.com/nhirsama/Goster-IoT/src/web/ingress"
 )
 
 func TestNewServicesWithConfigBuildsAllCoreServices(t *testing.T) {
@@ -63,3 +67,75 @@ func TestNewServicesDeleteDeviceClearsPresenceState(t *testing.T) {
 		t.Fatal("expected presence state to be cleared after delete")
 	}
 }
+
+func TestOtaCampaignSucceedsAfterDeviceReRegistersThroughIngress(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "core_ota.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	services := NewServicesWithConfig(ds, appcfg.DefaultDeviceManagerConfig())
+	ingressSvc := ingress.NewCoreService(services.DeviceRegistry, services.DevicePresence, services.TelemetryIngest, services.DownlinkCommands, ds, ingress.WithDeviceConfigs(services.DeviceConfigs))
+	ctx := context.Background()
+
+	register := func(version string) *ingressv1.RegisterDeviceResponse {
+		t.Helper()
+		resp, err := ingressSvc.RegisterDevice(ctx, connect.NewRequest(&ingressv1.RegisterDeviceRequest{Device: &ingressv1.DeviceDescriptor{
+			Name:            "ota-e2e",
+			SerialNumber:    "sn-ota",
+			MacAddress:      "AA:BB:CC:00:00:01",
+			FirmwareVersion: version,
+			Labels:          map[string]string{"fleet": "e2e"},
+		}}))
+		if err != nil {
+			t.Fatalf("RegisterDevice(%s) failed: %v", version, err)
+		}
+		return resp.Msg
+	}
+	uuid := register("1.0").GetUuid()
+	if err := services.DeviceRegistry.ApproveDevice(uuid); err != nil {
+		t.Fatalf("ApproveDevice failed: %v", err)
+	}
+	if resp := register("1.0"); resp.GetStatus() != ingressv1.RegistrationStatus_REGISTRATION_STATUS_ACCEPTED {
+		t.Fatalf("approved device should be accepted: %+v", resp)
+	}
+
+	artifact, err := services.Ota.UploadFirmware(inter.Scope{}, inter.FirmwareArtifact{Version: "2.0", Content: []byte("firmware-image")})
+	if err != nil {
+		t.Fatalf("UploadFirmware failed: %v", err)
+	}
+	campaign, err := services.Ota.CreateCampaign(inter.Scope{}, inter.OtaCampaign{ArtifactID: artifact.ID, Labels: map[string]string{"fleet": "e2e"}, RolloutPercent: 100})
+	if err != nil {
+		t.Fatalf("CreateCampaign failed: %v", err)
+	}
+	if sent, err := services.Ota.RunOnce(); err != nil || sent != 1 {
+		t.Fatalf("expected one ota frame, got %d err=%v", sent, err)
+	}
+	msg, ok, err := services.DownlinkCommands.PopDownlink(uuid)
+	if err != nil || !ok || msg.CmdID != inter.CmdOtaData {
+		t.Fatalf("expected ota frame, got %+v ok=%v err=%v", msg, ok, err)
+	}
+	if err := services.DownlinkCommands.MarkSent(msg.CommandID); err != nil {
+		t.Fatalf("MarkSent failed: %v", err)
+	}
+	if err := services.DownlinkCommands.MarkAcked(msg.CommandID); err != nil {
+		t.Fatalf("MarkAcked failed: %v", err)
+	}
+	if _, err := services.Ota.RunOnce(); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+
+	// 设备刷写后以新版本重新注册，版本校验据此判定升级成功。
+	if resp := register("2.0"); resp.GetStatus() != ingressv1.RegistrationStatus_REGISTRATION_STATUS_ACCEPTED {
+		t.Fatalf("upgraded device should be accepted: %+v", resp)
+	}
+	if _, err := services.Ota.RunOnce(); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	got, err := services.Ota.GetCampaign(inter.Scope{}, campaign.ID)
+	if err != nil || got.Status != inter.OtaCampaignCompleted || got.Progress.ByStatus["succeeded"] != 1 {
+		t.Fatalf("expected campaign completed by re-registration: %+v progress=%+v err=%v", got, got.Progress, err)
+	}
+}
@@ -2,7 +2,9 @@ package dbschema
 
 import (
 	"database/sql"
+	"fmt"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	_ "modernc.org/sqlite"
@@ -121,6 +123,56 @@ func TestEnsureSQLiteMigratesLegacyDeviceCommands(t *testing.T) {
 	}
 }
 
+func TestEnsureSQLiteNamesLegacyMetrics(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "schema_legacy_metrics.db")
+	if err := EnsureSQLite(dbPath); err != nil {
+		t.Fatalf("initial EnsureSQLite failed: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?_loc=Local")
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	defer db.Close()
+
+	// 还原到 0020 之前的 metrics 表结构。
+	for _, stmt := range []string{
+		`DELETE FROM schema_migrations WHERE version = '0020_named_metrics.sql'`,
+		`DROP TABLE metrics`,
+		`CREATE TABLE metrics (uuid TEXT NOT NULL, tenant_id TEXT NOT NULL DEFAULT 'tenant_legacy', ts BIGINT NOT NULL, value REAL, type INTEGER NOT NULL DEFAULT 0)`,
+		`INSERT INTO metrics (uuid, ts, value, type) VALUES ('dev-legacy', 1000, 21.5, 1), ('dev-legacy', 1000, 1, 16), ('dev-legacy', 1000, 3, 64)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("prepare legacy metrics failed: %v", err)
+		}
+	}
+
+	if err := EnsureSQLite(dbPath); err != nil {
+		t.Fatalf("second EnsureSQLite failed: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT type, name, unit, value_type FROM metrics ORDER BY type`)
+	if err != nil {
+		t.Fatalf("query migrated metrics failed: %v", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var (
+			metricType            int
+			name, unit, valueType string
+		)
+		if err := rows.Scan(&metricType, &name, &unit, &valueType); err != nil {
+			t.Fatalf("scan migrated metric failed: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%d:%s:%s:%s", metricType, name, unit, valueType))
+	}
+	want := []string{"1:temperature:°C:number", "16:access_signal_b::number", "64:::number"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected migrated metrics: %v", got)
+	}
+}
+
 func TestSplitSQLStatements(t *testing.T) {
 	sqlText := "INSERT INTO demo VALUES ('a;b');\nCREATE TABLE demo (id INTEGER);\n"
 	stmts := splitSQLStatements(sqlText)
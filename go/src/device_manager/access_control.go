@@ -66,7 +66,7 @@ func EvaluateAccessControl(points []inter.MetricPoint) AccessControlState {
 	return state
 }
 
-func normalizeAccessSignal(value float32) int {
+func normalizeAccessSignal(value float64) int {
 	if value >= 1 {
 		return 1
 	}
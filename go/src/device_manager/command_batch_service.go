@@ -0,0 +1,225 @@
+package device_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
+)
+
+// batchTargetPageSize 是展开批量任务目标设备时的分页大小。
+const batchTargetPageSize = 200
+
+// deviceTargetStore 是按分组或标签选择器展开目标设备所需的仓储能力。
+type deviceTargetStore interface {
+	GetDeviceGroup(tenantID, groupID string) (inter.DeviceGroup, error)
+	ListGroupDevices(groupID string, page, size int) ([]inter.DeviceRecord, error)
+	ListDevicesByTenant(tenantID string, status *inter.AuthenticateStatusType, page, size int) ([]inter.DeviceRecord, error)
+}
+
+// commandBatchStore 是批量指令服务依赖的最小仓储组合。
+type commandBatchStore interface {
+	inter.CommandBatchRepository
+	deviceTargetStore
+}
+
+// CommandBatchService 把一条指令展开为分组或标签选择器命中设备的逐台指令。
+// 每台设备的指令仍走普通下行队列，任务只记录指令 ID，进度在读取时按指令当前状态汇总。
+// 目标设备在创建任务时一并落库，逐台入队在后台进行；进程退出时尚未入队的设备由下次启动的 Resume 继续。
+type CommandBatchService struct {
+	dataStore commandBatchStore
+	downlink  inter.DownlinkCommandService
+	// fanouts 跟踪后台入队中的任务，Wait 等待它们结束。
+	fanouts sync.WaitGroup
+	mu      sync.Mutex
+	stopped bool
+	// stop 关闭后后台入队处理完当前设备即退出。
+	stop chan struct{}
+}
+
+// NewCommandBatchService 创建批量指令服务，逐台指令通过 downlink 入队。
+func NewCommandBatchService(ds commandBatchStore, downlink inter.DownlinkCommandService) *CommandBatchService {
+	return &CommandBatchService{dataStore: ds, downlink: downlink, stop: make(chan struct{})}
+}
+
+func (s *CommandBatchService) Create(scope inter.Scope, batch inter.CommandBatch, policy inter.DeviceCommandPolicy) (inter.CommandBatch, error) {
+	batch.TenantID = scopeTenantID(scope)
+	batch.GroupID = strings.TrimSpace(batch.GroupID)
+	batch.Command = strings.TrimSpace(strings.ToLower(batch.Command))
+	if batch.Command == "" || batch.CmdID == 0 {
+		return inter.CommandBatch{}, fmt.Errorf("%w: command is required", inter.ErrCommandBatchInvalid)
+	}
+	if batch.GroupID == "" && len(batch.Labels) == 0 {
+		return inter.CommandBatch{}, fmt.Errorf("%w: group_id or labels is required", inter.ErrCommandBatchInvalid)
+	}
+	if payload := strings.TrimSpace(string(batch.Payload)); payload != "" && !json.Valid([]byte(payload)) {
+		return inter.CommandBatch{}, fmt.Errorf("%w: payload must be valid json", inter.ErrCommandBatchInvalid)
+	}
+
+	targets, err := s.resolveTargets(batch)
+	if err != nil {
+		return inter.CommandBatch{}, err
+	}
+	if len(targets) == 0 {
+		return inter.CommandBatch{}, fmt.Errorf("%w: no authenticated device matches the target", inter.ErrCommandBatchInvalid)
+	}
+	batch.Total = len(targets)
+	batch.Policy = policy
+	batch.Items = make([]inter.CommandBatchItem, 0, len(targets))
+	for _, uuid := range targets {
+		batch.Items = append(batch.Items, inter.CommandBatchItem{UUID: uuid})
+	}
+	id, err := s.dataStore.CreateCommandBatch(batch)
+	if err != nil {
+		return inter.CommandBatch{}, err
+	}
+
+	created, err := s.dataStore.GetCommandBatch(batch.TenantID, id)
+	if err != nil {
+		return inter.CommandBatch{}, err
+	}
+	s.start(id, batch, targets)
+	return created, nil
+}
+
+// Resume 继续上次进程退出时尚未入队的设备，应在启动时调用一次。
+// 进程恰好在设备入队与记录结果之间退出时，该设备会再收到一条相同指令。
+func (s *CommandBatchService) Resume() error {
+	batches, err := s.dataStore.ListUnfinishedCommandBatches()
+	if err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		targets := make([]string, 0, len(batch.Items))
+		for _, item := range batch.Items {
+			targets = append(targets, item.UUID)
+		}
+		s.start(batch.ID, batch, targets)
+	}
+	return nil
+}
+
+// Stop 停止后台入队并等待进行中的设备处理完，剩余设备保持未入队，由下次启动的 Resume 继续。
+func (s *CommandBatchService) Stop() {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	s.fanouts.Wait()
+}
+
+// Wait 等待已创建任务的后台入队全部结束。
+func (s *CommandBatchService) Wait() {
+	s.fanouts.Wait()
+}
+
+// start 在后台逐台入队；服务已停止时不再启动，任务留待下次 Resume。
+func (s *CommandBatchService) start(id int64, batch inter.CommandBatch, targets []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.fanouts.Add(1)
+	go func() {
+		defer s.fanouts.Done()
+		s.fanout(id, batch, targets)
+	}()
+}
+
+// fanout 逐台入队并记录结果；结果写入失败只记录日志，该设备在进度中保持待处理。
+func (s *CommandBatchService) fanout(id int64, batch inter.CommandBatch, targets []string) {
+	deviceScope := inter.Scope{TenantID: batch.TenantID}
+	for _, uuid := range targets {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		item := inter.CommandBatchItem{UUID: uuid}
+		msg, err := s.downlink.EnqueueWithPolicy(deviceScope, uuid, batch.CmdID, batch.Command, batch.Payload, batch.Policy)
+		if err != nil {
+			item.ErrorText = err.Error()
+		} else {
+			item.CommandID = msg.CommandID
+		}
+		if err := s.dataStore.AddCommandBatchItem(id, item); err != nil {
+			logger.Default().With(inter.String("module", "device_manager")).Warn("记录批量指令结果失败",
+				inter.Int64("batch_id", id), inter.String("uuid", uuid), inter.Err(err))
+		}
+	}
+}
+
+func (s *CommandBatchService) Get(scope inter.Scope, id int64) (inter.CommandBatch, error) {
+	if id <= 0 {
+		return inter.CommandBatch{}, inter.ErrCommandBatchNotFound
+	}
+	return s.dataStore.GetCommandBatch(scopeTenantID(scope), id)
+}
+
+func (s *CommandBatchService) List(scope inter.Scope, limit int) ([]inter.CommandBatch, error) {
+	return s.dataStore.ListCommandBatches(scopeTenantID(scope), limit)
+}
+
+// resolveTargets 展开批量任务的目标设备 UUID。
+func (s *CommandBatchService) resolveTargets(batch inter.CommandBatch) ([]string, error) {
+	devices, err := resolveTargetDevices(s.dataStore, batch.TenantID, batch.GroupID, batch.Labels)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]string, 0, len(devices))
+	for _, device := range devices {
+		targets = append(targets, device.UUID)
+	}
+	return targets, nil
+}
+
+// resolveTargetDevices 展开目标设备：给出分组时只看分组成员，否则扫描整个租户；未认证设备不在其中。
+func resolveTargetDevices(ds deviceTargetStore, tenantID, groupID string, labels map[string]string) ([]inter.DeviceRecord, error) {
+	var list func(page int) ([]inter.DeviceRecord, error)
+	if groupID != "" {
+		if _, err := ds.GetDeviceGroup(tenantID, groupID); err != nil {
+			return nil, err
+		}
+		list = func(page int) ([]inter.DeviceRecord, error) {
+			return ds.ListGroupDevices(groupID, page, batchTargetPageSize)
+		}
+	} else {
+		authenticated := inter.Authenticated
+		list = func(page int) ([]inter.DeviceRecord, error) {
+			return ds.ListDevicesByTenant(tenantID, &authenticated, page, batchTargetPageSize)
+		}
+	}
+
+	var targets []inter.DeviceRecord
+	for page := 1; ; page++ {
+		devices, err := list(page)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			if device.Meta.AuthenticateStatus != inter.Authenticated || !matchLabels(device.Meta.Descriptor.Labels, labels) {
+				continue
+			}
+			targets = append(targets, device)
+		}
+		if len(devices) < batchTargetPageSize {
+			return targets, nil
+		}
+	}
+}
+
+// matchLabels 判断设备标签是否包含选择器中的全部键值。
+func matchLabels(labels, selector map[string]string) bool {
+	for key, value := range selector {
+		if got, ok := labels[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,235 @@
+package device_manager
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+func newBatchTestEnv(t *testing.T) (*persistence.Store, *DeviceGroupService, *CommandBatchService) {
+	t.Helper()
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "batch.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	cfg := appcfg.DefaultDeviceManagerConfig()
+	downlink := NewDownlinkCommandServiceWithConfig(ds, NewDeviceCommandQueue(8), nil, cfg)
+	return ds, NewDeviceGroupService(ds), NewCommandBatchService(ds, downlink)
+}
+
+func initLabeledDevice(t *testing.T, ds *persistence.Store, uuid string, status inter.AuthenticateStatusType, labels map[string]string) {
+	t.Helper()
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               uuid,
+		Token:              "tk-" + uuid,
+		AuthenticateStatus: status,
+		Descriptor:         inter.DeviceDescriptor{Labels: labels},
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+}
+
+func TestCommandBatchServiceGroupTarget(t *testing.T) {
+	ds, groups, batches := newBatchTestEnv(t)
+	initLabeledDevice(t, ds, "grp-a", inter.Authenticated, nil)
+	initLabeledDevice(t, ds, "grp-b", inter.Authenticated, nil)
+	initLabeledDevice(t, ds, "grp-pending", inter.AuthenticatePending, nil)
+	initLabeledDevice(t, ds, "outside", inter.Authenticated, nil)
+
+	group, err := groups.Create(inter.Scope{}, inter.DeviceGroup{Name: "lobby"})
+	if err != nil {
+		t.Fatalf("create group failed: %v", err)
+	}
+	for _, uuid := range []string{"grp-a", "grp-b", "grp-pending"} {
+		if err := groups.AddDevice(inter.Scope{}, group.ID, uuid); err != nil {
+			t.Fatalf("add %s failed: %v", uuid, err)
+		}
+	}
+	if err := groups.AddDevice(inter.Scope{TenantID: "tenant_other"}, group.ID, "outside"); !errors.Is(err, inter.ErrDeviceGroupNotFound) {
+		t.Fatalf("expected group to be invisible to other tenant, got %v", err)
+	}
+
+	batch, err := batches.Create(inter.Scope{}, inter.CommandBatch{
+		GroupID: group.ID,
+		Command: "action_exec",
+		CmdID:   inter.CmdActionExec,
+		Payload: []byte(`{"op":"refresh"}`),
+	}, inter.DeviceCommandPolicy{Key: "refresh"})
+	if err != nil {
+		t.Fatalf("create batch failed: %v", err)
+	}
+	// 创建时只保存任务，尚未写入结果的设备计为待处理。
+	if p := batch.Progress(); batch.Total != 2 || p.Pending != 2 || p.Done {
+		t.Fatalf("unexpected created batch: %+v progress=%+v", batch, p)
+	}
+	batches.Wait()
+	batch, err = batches.Get(inter.Scope{}, batch.ID)
+	if err != nil {
+		t.Fatalf("get batch failed: %v", err)
+	}
+	if batch.Total != 2 || len(batch.Items) != 2 || batch.Items[0].UUID != "grp-a" || batch.Items[0].CommandID == 0 {
+		t.Fatalf("unexpected batch: %+v", batch)
+	}
+	if p := batch.Progress(); p.Pending != 2 || p.Done {
+		t.Fatalf("unexpected progress: %+v", p)
+	}
+	for uuid, want := range map[string]int{"grp-a": 1, "grp-b": 1, "grp-pending": 0, "outside": 0} {
+		if got := len(scheduledCommands(t, ds, uuid)); got != want {
+			t.Fatalf("device %s got %d commands, want %d", uuid, got, want)
+		}
+	}
+
+	if err := ds.UpdateDeviceCommandStatus(batch.Items[0].CommandID, inter.DeviceCommandStatusAcked, ""); err != nil {
+		t.Fatalf("ack failed: %v", err)
+	}
+	if err := ds.UpdateDeviceCommandStatus(batch.Items[1].CommandID, inter.DeviceCommandStatusFailed, "timeout"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+	got, err := batches.Get(inter.Scope{}, batch.ID)
+	if err != nil {
+		t.Fatalf("get batch failed: %v", err)
+	}
+	if p := got.Progress(); p.Succeeded != 1 || p.Failed != 1 || p.Pending != 0 || !p.Done {
+		t.Fatalf("unexpected final progress: %+v", p)
+	}
+}
+
+func TestCommandBatchServiceLabelSelector(t *testing.T) {
+	ds, groups, batches := newBatchTestEnv(t)
+	initLabeledDevice(t, ds, "lab-1", inter.Authenticated, map[string]string{"site": "lab", "floor": "1"})
+	initLabeledDevice(t, ds, "lab-2", inter.Authenticated, map[string]string{"site": "lab", "floor": "2"})
+	initLabeledDevice(t, ds, "office-1", inter.Authenticated, map[string]string{"site": "office", "floor": "1"})
+
+	batch, err := batches.Create(inter.Scope{}, inter.CommandBatch{
+		Labels:  map[string]string{"site": "lab"},
+		Command: "config_push",
+		CmdID:   inter.CmdConfigPush,
+	}, inter.DeviceCommandPolicy{})
+	if err != nil {
+		t.Fatalf("create batch failed: %v", err)
+	}
+	batches.Wait()
+	if batch, err = batches.Get(inter.Scope{}, batch.ID); err != nil {
+		t.Fatalf("get batch failed: %v", err)
+	}
+	if batch.Total != 2 || len(batch.Items) != 2 || batch.Items[0].UUID != "lab-1" || batch.Items[1].UUID != "lab-2" {
+		t.Fatalf("unexpected label batch: %+v", batch)
+	}
+
+	// 分组与标签同时给出时取交集。
+	group, err := groups.Create(inter.Scope{}, inter.DeviceGroup{Name: "first floor"})
+	if err != nil {
+		t.Fatalf("create group failed: %v", err)
+	}
+	for _, uuid := range []string{"lab-1", "office-1"} {
+		if err := groups.AddDevice(inter.Scope{}, group.ID, uuid); err != nil {
+			t.Fatalf("add %s failed: %v", uuid, err)
+		}
+	}
+	batch, err = batches.Create(inter.Scope{}, inter.CommandBatch{
+		GroupID: group.ID,
+		Labels:  map[string]string{"site": "office"},
+		Command: "config_push",
+		CmdID:   inter.CmdConfigPush,
+	}, inter.DeviceCommandPolicy{})
+	batches.Wait()
+	if err == nil {
+		batch, err = batches.Get(inter.Scope{}, batch.ID)
+	}
+	if err != nil || batch.Total != 1 || len(batch.Items) != 1 || batch.Items[0].UUID != "office-1" {
+		t.Fatalf("unexpected intersected batch: %+v err=%v", batch, err)
+	}
+
+	listed, err := batches.List(inter.Scope{}, 10)
+	if err != nil || len(listed) != 2 || listed[0].ID != batch.ID {
+		t.Fatalf("unexpected batch list: %+v err=%v", listed, err)
+	}
+
+	invalid := []inter.CommandBatch{
+		{Command: "config_push", CmdID: inter.CmdConfigPush},
+		{Labels: map[string]string{"site": "lab"}},
+		{Labels: map[string]string{"site": "lab"}, Command: "config_push", CmdID: inter.CmdConfigPush, Payload: []byte(`{`)},
+		{Labels: map[string]string{"site": "warehouse"}, Command: "config_push", CmdID: inter.CmdConfigPush},
+	}
+	for i, tc := range invalid {
+		if _, err := batches.Create(inter.Scope{}, tc, inter.DeviceCommandPolicy{}); !errors.Is(err, inter.ErrCommandBatchInvalid) {
+			t.Fatalf("case %d: expected invalid batch error, got %v", i, err)
+		}
+	}
+	if _, err := batches.Create(inter.Scope{}, inter.CommandBatch{GroupID: "grp_missing", Command: "config_push", CmdID: inter.CmdConfigPush}, inter.DeviceCommandPolicy{}); !errors.Is(err, inter.ErrDeviceGroupNotFound) {
+		t.Fatalf("expected missing group error, got %v", err)
+	}
+}
+
+func TestCommandBatchServiceResumesUnfinishedTargets(t *testing.T) {
+	ds, _, batches := newBatchTestEnv(t)
+	for _, uuid := range []string{"resume-a", "resume-b", "resume-c"} {
+		initLabeledDevice(t, ds, uuid, inter.Authenticated, nil)
+	}
+	// 模拟上次进程在 resume-a 入队后退出：其余设备仍未入队。
+	done, err := ds.CreateDeviceCommand("resume-a", inter.CmdActionExec, "action_exec", nil)
+	if err != nil {
+		t.Fatalf("create command failed: %v", err)
+	}
+	id, err := ds.CreateCommandBatch(inter.CommandBatch{
+		Labels:  map[string]string{"site": "lab"},
+		Command: "action_exec",
+		CmdID:   inter.CmdActionExec,
+		Policy:  inter.DeviceCommandPolicy{MaxAttempts: 2},
+		Total:   3,
+		Items:   []inter.CommandBatchItem{{UUID: "resume-a", CommandID: done}, {UUID: "resume-b"}, {UUID: "resume-c"}},
+	})
+	if err != nil {
+		t.Fatalf("create batch failed: %v", err)
+	}
+	batch, err := batches.Get(inter.Scope{}, id)
+	if err != nil {
+		t.Fatalf("get batch failed: %v", err)
+	}
+	if p := batch.Progress(); p.Pending != 3 || p.Done {
+		t.Fatalf("targets not yet enqueued should count as pending, got %+v", p)
+	}
+
+	// 停止后的服务不再启动后台入队，任务保持未完成。
+	batches.Stop()
+	if err := batches.Resume(); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if got := len(scheduledCommands(t, ds, "resume-b")); got != 0 {
+		t.Fatalf("stopped service should not enqueue, got %d commands", got)
+	}
+
+	restarted := NewCommandBatchService(ds, batches.downlink)
+	if err := restarted.Resume(); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	restarted.Wait()
+	for uuid, want := range map[string]int{"resume-a": 1, "resume-b": 1, "resume-c": 1} {
+		items := scheduledCommands(t, ds, uuid)
+		if len(items) != want {
+			t.Fatalf("device %s got %d commands, want %d", uuid, len(items), want)
+		}
+		if uuid != "resume-a" && items[0].MaxAttempts != 2 {
+			t.Fatalf("resumed command should keep the batch policy, got %+v", items[0])
+		}
+	}
+	batch, err = restarted.Get(inter.Scope{}, id)
+	if err != nil {
+		t.Fatalf("get batch failed: %v", err)
+	}
+	for _, item := range batch.Items {
+		if item.CommandID == 0 {
+			t.Fatalf("every target should be enqueued after resume, got %+v", batch.Items)
+		}
+	}
+	if unfinished, err := ds.ListUnfinishedCommandBatches(); err != nil || len(unfinished) != 0 {
+		t.Fatalf("expected no unfinished batch, got %+v err=%v", unfinished, err)
+	}
+}
@@ -0,0 +1,108 @@
+package device_manager
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// CommandNotifier 是进程内的命令入队通知中心。
+// 通知只携带订阅键，订阅方收到后自行从队列领取命令，因此合并或丢失重复信号都不会丢命令。
+type CommandNotifier struct {
+	mu   sync.Mutex
+	subs map[string]map[*commandSubscription]struct{}
+}
+
+// NewCommandNotifier 创建命令通知中心。
+func NewCommandNotifier() *CommandNotifier {
+	return &CommandNotifier{subs: make(map[string]map[*commandSubscription]struct{})}
+}
+
+// Notify 唤醒订阅了 key 的全部订阅方；没有订阅方时直接忽略。
+func (n *CommandNotifier) Notify(key string) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return
+	}
+	n.mu.Lock()
+	targets := make([]*commandSubscription, 0, len(n.subs[key]))
+	for sub := range n.subs[key] {
+		targets = append(targets, sub)
+	}
+	n.mu.Unlock()
+	for _, sub := range targets {
+		sub.mark(key)
+	}
+}
+
+// Subscribe 订阅一组键上的入队通知。
+func (n *CommandNotifier) Subscribe(keys []string) inter.CommandSubscription {
+	sub := &commandSubscription{
+		notifier: n,
+		ready:    make(chan struct{}, 1),
+		pending:  make(map[string]struct{}),
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		sub.keys = append(sub.keys, key)
+		if n.subs[key] == nil {
+			n.subs[key] = make(map[*commandSubscription]struct{})
+		}
+		n.subs[key][sub] = struct{}{}
+	}
+	return sub
+}
+
+func (n *CommandNotifier) unsubscribe(sub *commandSubscription) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, key := range sub.keys {
+		delete(n.subs[key], sub)
+		if len(n.subs[key]) == 0 {
+			delete(n.subs, key)
+		}
+	}
+}
+
+type commandSubscription struct {
+	notifier *CommandNotifier
+	keys     []string
+	ready    chan struct{}
+	once     sync.Once
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+}
+
+func (s *commandSubscription) Ready() <-chan struct{} { return s.ready }
+
+func (s *commandSubscription) Drain() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.pending))
+	for key := range s.pending {
+		keys = append(keys, key)
+	}
+	s.pending = make(map[string]struct{})
+	return keys
+}
+
+func (s *commandSubscription) Close() {
+	s.once.Do(func() { s.notifier.unsubscribe(s) })
+}
+
+func (s *commandSubscription) mark(key string) {
+	s.mu.Lock()
+	s.pending[key] = struct{}{}
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,266 @@
+package device_manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
+)
+
+const (
+	// scheduleRunBatch 是单轮处理的到期计划上限，其余计划留到下一轮。
+	scheduleRunBatch = 100
+	// scheduleFanoutPageSize 是租户级计划分页列出设备的页大小。
+	scheduleFanoutPageSize = 200
+)
+
+// commandScheduleStore 是指令计划服务依赖的最小仓储组合。
+type commandScheduleStore interface {
+	inter.CommandScheduleRepository
+	ResolveDeviceTenant(uuid string) (string, error)
+	ListDevicesByTenant(tenantID string, status *inter.AuthenticateStatusType, page, size int) ([]inter.DeviceRecord, error)
+}
+
+// CommandScheduleService 保存一次性与 cron 周期指令计划，并在到期时物化为设备下行指令。
+// 下一次触发时间落库保存，Core 重启后从库中继续；多个实例通过 revision 抢占同一次触发，避免重复下发。
+type CommandScheduleService struct {
+	dataStore    commandScheduleStore
+	downlink     inter.DownlinkCommandService
+	pollInterval time.Duration
+	now          func() time.Time
+}
+
+// NewCommandScheduleService 创建指令计划服务，到期计划通过 downlink 入队。
+func NewCommandScheduleService(ds commandScheduleStore, downlink inter.DownlinkCommandService, cfg appcfg.DeviceManagerConfig) *CommandScheduleService {
+	n := appcfg.NormalizeDeviceManagerConfig(cfg)
+	return &CommandScheduleService{
+		dataStore:    ds,
+		downlink:     downlink,
+		pollInterval: n.SchedulePollInterval,
+		now:          time.Now,
+	}
+}
+
+func (s *CommandScheduleService) Create(scope inter.Scope, schedule inter.CommandSchedule) (inter.CommandSchedule, error) {
+	schedule.TenantID = scopeTenantID(scope)
+	if err := s.prepare(&schedule); err != nil {
+		return inter.CommandSchedule{}, err
+	}
+	id, err := s.dataStore.CreateCommandSchedule(schedule)
+	if err != nil {
+		return inter.CommandSchedule{}, err
+	}
+	return s.dataStore.GetCommandSchedule(schedule.TenantID, id)
+}
+
+func (s *CommandScheduleService) Get(scope inter.Scope, id int64) (inter.CommandSchedule, error) {
+	if id <= 0 {
+		return inter.CommandSchedule{}, inter.ErrCommandScheduleNotFound
+	}
+	return s.dataStore.GetCommandSchedule(scopeTenantID(scope), id)
+}
+
+func (s *CommandScheduleService) List(scope inter.Scope, uuid string) ([]inter.CommandSchedule, error) {
+	return s.dataStore.ListCommandSchedules(scopeTenantID(scope), uuid)
+}
+
+// Update 覆盖计划定义；已触发过的一次性计划重新启用后按新的 execute_at 再次触发。
+func (s *CommandScheduleService) Update(scope inter.Scope, schedule inter.CommandSchedule) (inter.CommandSchedule, error) {
+	current, err := s.Get(scope, schedule.ID)
+	if err != nil {
+		return inter.CommandSchedule{}, err
+	}
+	schedule.TenantID = current.TenantID
+	if err := s.prepare(&schedule); err != nil {
+		return inter.CommandSchedule{}, err
+	}
+	if err := s.dataStore.UpdateCommandSchedule(schedule); err != nil {
+		return inter.CommandSchedule{}, err
+	}
+	return s.dataStore.GetCommandSchedule(schedule.TenantID, schedule.ID)
+}
+
+func (s *CommandScheduleService) Delete(scope inter.Scope, id int64) error {
+	if id <= 0 {
+		return inter.ErrCommandScheduleNotFound
+	}
+	return s.dataStore.DeleteCommandSchedule(scopeTenantID(scope), id)
+}
+
+// RunDue 触发到期计划。停机期间错过的多次 cron 触发只补发一次，下一次时间从当前时刻重新计算。
+// 单个计划失败不影响同一轮的其他计划，各计划的错误合并后返回。
+func (s *CommandScheduleService) RunDue() (int, error) {
+	now := s.now()
+	due, err := s.dataStore.ListDueCommandSchedules(now, scheduleRunBatch)
+	if err != nil {
+		return 0, err
+	}
+	fired := 0
+	var errs []error
+	for _, schedule := range due {
+		ok, err := s.fire(schedule, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule %d: %w", schedule.ID, err))
+		}
+		if ok {
+			fired++
+		}
+	}
+	return fired, errors.Join(errs...)
+}
+
+// Run 按配置间隔周期触发到期计划，直到 ctx 结束。
+func (s *CommandScheduleService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.RunDue(); err != nil {
+				logger.Default().With(inter.String("module", "device_manager")).Warn("触发指令计划失败", inter.Err(err))
+			}
+		}
+	}
+}
+
+// fire 先抢占本次触发再下发指令，抢占失败说明其他实例已经处理或计划刚被修改。
+func (s *CommandScheduleService) fire(schedule inter.CommandSchedule, now time.Time) (bool, error) {
+	next, nextErr := s.nextRunAfter(schedule, now)
+	claimed, err := s.dataStore.ClaimCommandScheduleRun(schedule.ID, schedule.Revision, now, next)
+	if err != nil || !claimed {
+		return false, err
+	}
+	errorText := ""
+	if nextErr != nil {
+		// 库中的定义已无法解析，计划在抢占时被停用，这里只记录原因。
+		errorText = nextErr.Error()
+	} else if err := s.materialize(schedule); err != nil {
+		errorText = err.Error()
+	}
+	if err := s.dataStore.RecordCommandScheduleResult(schedule.ID, errorText); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// materialize 把计划入队到目标设备；租户级计划下发给租户内全部已认证设备。
+func (s *CommandScheduleService) materialize(schedule inter.CommandSchedule) error {
+	scope := inter.Scope{TenantID: schedule.TenantID}
+	if schedule.UUID != "" {
+		_, err := s.downlink.EnqueueWithPolicy(scope, schedule.UUID, schedule.CmdID, schedule.Command, schedule.Payload, schedule.Policy)
+		return err
+	}
+	authenticated := inter.Authenticated
+	total, failed := 0, 0
+	var firstErr error
+	for page := 1; ; page++ {
+		devices, err := s.dataStore.ListDevicesByTenant(schedule.TenantID, &authenticated, page, scheduleFanoutPageSize)
+		if err != nil {
+			return err
+		}
+		for _, device := range devices {
+			total++
+			if _, err := s.downlink.EnqueueWithPolicy(scope, device.UUID, schedule.CmdID, schedule.Command, schedule.Payload, schedule.Policy); err != nil {
+				failed++
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", device.UUID, err)
+				}
+			}
+		}
+		if len(devices) < scheduleFanoutPageSize {
+			break
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("enqueue failed for %d of %d devices: %w", failed, total, firstErr)
+	}
+	return nil
+}
+
+// prepare 校验计划定义并计算下一次触发时间；停用的计划不设置触发时间。
+func (s *CommandScheduleService) prepare(schedule *inter.CommandSchedule) error {
+	schedule.Name = strings.TrimSpace(schedule.Name)
+	schedule.UUID = strings.TrimSpace(schedule.UUID)
+	schedule.Command = strings.TrimSpace(strings.ToLower(schedule.Command))
+	schedule.Cron = strings.TrimSpace(schedule.Cron)
+	schedule.Timezone = strings.TrimSpace(schedule.Timezone)
+	if schedule.Command == "" || schedule.CmdID == 0 {
+		return fmt.Errorf("%w: command is required", inter.ErrCommandScheduleInvalid)
+	}
+	if payload := strings.TrimSpace(string(schedule.Payload)); payload != "" && !json.Valid([]byte(payload)) {
+		return fmt.Errorf("%w: payload must be valid json", inter.ErrCommandScheduleInvalid)
+	}
+	if (schedule.ExecuteAt == nil) == (schedule.Cron == "") {
+		return fmt.Errorf("%w: exactly one of execute_at and cron is required", inter.ErrCommandScheduleInvalid)
+	}
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", inter.ErrCommandScheduleInvalid, schedule.Timezone)
+	}
+	if schedule.UUID != "" {
+		tenantID, err := s.dataStore.ResolveDeviceTenant(schedule.UUID)
+		if err != nil {
+			return err
+		}
+		if tenantID != schedule.TenantID {
+			return inter.ErrDeviceTenantMismatch
+		}
+	}
+
+	schedule.NextRunAt = nil
+	if schedule.ExecuteAt != nil {
+		// 一次性计划的时间已过去时，在下一轮轮询立即触发。
+		at := schedule.ExecuteAt.UTC()
+		schedule.ExecuteAt = &at
+		if schedule.Enabled {
+			schedule.NextRunAt = &at
+		}
+		return nil
+	}
+	next, err := s.nextRunAfter(*schedule, s.now())
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		return fmt.Errorf("%w: cron expression never fires", inter.ErrCommandScheduleInvalid)
+	}
+	if schedule.Enabled {
+		schedule.NextRunAt = next
+	}
+	return nil
+}
+
+// nextRunAfter 返回 after 之后的下一次触发时间；一次性计划与不再触发的 cron 返回 nil。
+func (s *CommandScheduleService) nextRunAfter(schedule inter.CommandSchedule, after time.Time) (*time.Time, error) {
+	if schedule.Cron == "" {
+		return nil, nil
+	}
+	cron, err := parseCron(schedule.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", inter.ErrCommandScheduleInvalid, err)
+	}
+	timezone := schedule.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", inter.ErrCommandScheduleInvalid, timezone)
+	}
+	next, ok := cron.next(after, loc)
+	if !ok {
+		return nil, nil
+	}
+	next = next.UTC()
+	return &next, nil
+}
@@ -0,0 +1,337 @@
+package device_manager
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+func TestParseCronNext(t *testing.T) {
+	base := time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC) // 周一
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 3, 2, 10, 45, 0, 0, time.UTC)},
+		{"0 8 * * *", time.Date(2026, 3, 3, 8, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 3, 2, 11, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2026, 3, 8, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 10 2 * *", time.Date(2026, 4, 2, 10, 30, 0, 0, time.UTC)},
+		// 日与周都受限时任一匹配即触发：15 号或周三。
+		{"0 0 15 * 3", time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 6-8/2,20 * * 1-5", time.Date(2026, 3, 2, 20, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		c, err := parseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) failed: %v", tc.expr, err)
+		}
+		got, ok := c.next(base, time.UTC)
+		if !ok || !got.Equal(tc.want) {
+			t.Fatalf("next(%q) = %s, %v; want %s", tc.expr, got, ok, tc.want)
+		}
+	}
+
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	c, _ := parseCron("0 8 * * *")
+	got, _ := c.next(base, shanghai)
+	if want := time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("next in Asia/Shanghai = %s, want %s", got.UTC(), want)
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Fatalf("expected parseCron(%q) to fail", expr)
+		}
+	}
+	never, _ := parseCron("0 0 30 2 *")
+	if _, ok := never.next(base, time.UTC); ok {
+		t.Fatal("expected february 30th to never fire")
+	}
+}
+
+func TestParseCronNextAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	at := func(month time.Month, day, hour, min int, zone string) time.Time {
+		offset := -5 * time.Hour
+		if zone == "EDT" {
+			offset = -4 * time.Hour
+		}
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC).Add(-offset)
+	}
+	cases := []struct {
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		// 2026-03-08 02:00 EST 拨快到 03:00 EDT：跨过跳过区间的查找不能原地打转。
+		{"0 8 * * *", at(3, 7, 12, 0, "EST"), at(3, 8, 8, 0, "EDT")},
+		{"0 3 * * *", at(3, 8, 0, 30, "EST"), at(3, 8, 3, 0, "EDT")},
+		// 跳过的本地时间当天不触发。
+		{"30 2 * * *", at(3, 7, 12, 0, "EST"), at(3, 9, 2, 30, "EDT")},
+		{"*/30 * * * *", at(3, 8, 1, 30, "EST"), at(3, 8, 3, 0, "EDT")},
+		// 2026-11-01 02:00 EDT 回拨到 01:00 EST：限定小时的表达式只在第一次出现时触发。
+		{"30 1 * * *", at(10, 31, 12, 0, "EDT"), at(11, 1, 1, 30, "EDT")},
+		{"30 1 * * *", at(11, 1, 1, 30, "EDT"), at(11, 2, 1, 30, "EST")},
+		{"0 2 * * *", at(11, 1, 0, 30, "EDT"), at(11, 1, 2, 0, "EST")},
+		// 小时段为 * 时按实际经过的时间照常触发。
+		{"0 * * * *", at(11, 1, 1, 0, "EDT"), at(11, 1, 1, 0, "EST")},
+	}
+	for _, tc := range cases {
+		c, err := parseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) failed: %v", tc.expr, err)
+		}
+		got, ok := c.next(tc.after, ny)
+		if !ok || !got.Equal(tc.want) {
+			t.Fatalf("next(%q, %s) = %s, %v; want %s", tc.expr, tc.after.In(ny), got, ok, tc.want.In(ny))
+		}
+	}
+}
+
+func newScheduleTestEnv(t *testing.T) (*persistence.Store, *CommandScheduleService, *CommandScheduleService) {
+	t.Helper()
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "schedule.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	cfg := appcfg.DefaultDeviceManagerConfig()
+	downlink := NewDownlinkCommandServiceWithConfig(ds, NewDeviceCommandQueue(8), nil, cfg)
+	// 两个服务实例共享同一数据库，模拟多个 Core 实例。
+	return ds, NewCommandScheduleService(ds, downlink, cfg), NewCommandScheduleService(ds, downlink, cfg)
+}
+
+func initScheduleDevice(t *testing.T, ds *persistence.Store, uuid string, status inter.AuthenticateStatusType) {
+	t.Helper()
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               uuid,
+		Token:              "tk-" + uuid,
+		AuthenticateStatus: status,
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+}
+
+func scheduledCommands(t *testing.T, ds *persistence.Store, uuid string) []inter.DeviceCommand {
+	t.Helper()
+	items, err := ds.ListDeviceCommandsByTenant(inter.DefaultTenantID, uuid, inter.DeviceCommandQuery{})
+	if err != nil {
+		t.Fatalf("list commands failed: %v", err)
+	}
+	return items
+}
+
+func TestCommandScheduleServiceOneOffFiresOnce(t *testing.T) {
+	ds, service, other := newScheduleTestEnv(t)
+	initScheduleDevice(t, ds, "sched-dev", inter.Authenticated)
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	other.now = service.now
+
+	at := now.Add(time.Minute)
+	created, err := service.Create(inter.Scope{}, inter.CommandSchedule{
+		Name:      "morning",
+		UUID:      "sched-dev",
+		Command:   "screen_wy",
+		CmdID:     inter.CmdScreenWy,
+		Payload:   []byte(`{"text":"good morning"}`),
+		ExecuteAt: &at,
+		Enabled:   true,
+	})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if created.NextRunAt == nil || !created.NextRunAt.Equal(at) || created.Timezone != "UTC" {
+		t.Fatalf("unexpected created schedule: %+v", created)
+	}
+
+	if fired, err := service.RunDue(); err != nil || fired != 0 {
+		t.Fatalf("expected nothing due yet, fired=%d err=%v", fired, err)
+	}
+
+	now = at.Add(time.Second)
+	fired, err := service.RunDue()
+	if err != nil || fired != 1 {
+		t.Fatalf("expected one run, fired=%d err=%v", fired, err)
+	}
+	if fired, err := other.RunDue(); err != nil || fired != 0 {
+		t.Fatalf("expected second instance to find nothing, fired=%d err=%v", fired, err)
+	}
+
+	items := scheduledCommands(t, ds, "sched-dev")
+	if len(items) != 1 || items[0].Command != "screen_wy" || string(items[0].Payload) != `{"text":"good morning"}` {
+		t.Fatalf("unexpected materialized commands: %+v", items)
+	}
+	got, err := service.Get(inter.Scope{}, created.ID)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got.Enabled || got.NextRunAt != nil || got.RunCount != 1 || got.LastError != "" {
+		t.Fatalf("expected one-off schedule to be disabled after run: %+v", got)
+	}
+}
+
+func TestCommandScheduleServiceCronAdvancesWithoutDoubleFiring(t *testing.T) {
+	ds, service, other := newScheduleTestEnv(t)
+	initScheduleDevice(t, ds, "cron-dev", inter.Authenticated)
+
+	now := time.Date(2026, 3, 2, 8, 0, 30, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	other.now = service.now
+
+	created, err := service.Create(inter.Scope{}, inter.CommandSchedule{
+		UUID:    "cron-dev",
+		Command: "config_push",
+		CmdID:   inter.CmdConfigPush,
+		Cron:    "*/5 * * * *",
+		Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if want := time.Date(2026, 3, 2, 8, 5, 0, 0, time.UTC); created.NextRunAt == nil || !created.NextRunAt.Equal(want) {
+		t.Fatalf("unexpected first run: %+v", created.NextRunAt)
+	}
+
+	// 停机错过多次触发后只补发一次，下一次从当前时刻重新计算。
+	now = time.Date(2026, 3, 2, 8, 17, 0, 0, time.UTC)
+	due, err := ds.ListDueCommandSchedules(now, 10)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("expected one due schedule, got %+v err=%v", due, err)
+	}
+	if ok, err := service.fire(due[0], now); err != nil || !ok {
+		t.Fatalf("expected first instance to fire, ok=%v err=%v", ok, err)
+	}
+	// 另一个实例持有同一份扫描结果时抢占失败。
+	if ok, err := other.fire(due[0], now); err != nil || ok {
+		t.Fatalf("expected second instance to lose the claim, ok=%v err=%v", ok, err)
+	}
+
+	got, err := service.Get(inter.Scope{}, created.ID)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if want := time.Date(2026, 3, 2, 8, 20, 0, 0, time.UTC); got.NextRunAt == nil || !got.NextRunAt.Equal(want) || !got.Enabled || got.RunCount != 1 {
+		t.Fatalf("unexpected schedule after run: %+v", got)
+	}
+	if items := scheduledCommands(t, ds, "cron-dev"); len(items) != 1 {
+		t.Fatalf("expected exactly one materialized command, got %d", len(items))
+	}
+}
+
+func TestCommandScheduleServiceTenantFanout(t *testing.T) {
+	ds, service, _ := newScheduleTestEnv(t)
+	initScheduleDevice(t, ds, "fan-a", inter.Authenticated)
+	initScheduleDevice(t, ds, "fan-b", inter.Authenticated)
+	initScheduleDevice(t, ds, "fan-pending", inter.AuthenticatePending)
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	at := now
+	if _, err := service.Create(inter.Scope{}, inter.CommandSchedule{
+		Command:   "action_exec",
+		CmdID:     inter.CmdActionExec,
+		Payload:   []byte(`{"op":"refresh"}`),
+		ExecuteAt: &at,
+		Enabled:   true,
+	}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if fired, err := service.RunDue(); err != nil || fired != 1 {
+		t.Fatalf("expected one run, fired=%d err=%v", fired, err)
+	}
+	for uuid, want := range map[string]int{"fan-a": 1, "fan-b": 1, "fan-pending": 0} {
+		if got := len(scheduledCommands(t, ds, uuid)); got != want {
+			t.Fatalf("device %s got %d commands, want %d", uuid, got, want)
+		}
+	}
+}
+
+func TestCommandScheduleServiceRejectsInvalidDefinitions(t *testing.T) {
+	ds, service, _ := newScheduleTestEnv(t)
+	initScheduleDevice(t, ds, "invalid-dev", inter.Authenticated)
+
+	at := time.Now().Add(time.Hour)
+	cases := []inter.CommandSchedule{
+		{Command: "action_exec", CmdID: inter.CmdActionExec},
+		{Command: "action_exec", CmdID: inter.CmdActionExec, ExecuteAt: &at, Cron: "@daily"},
+		{Command: "action_exec", CmdID: inter.CmdActionExec, Cron: "61 * * * *"},
+		{Command: "action_exec", CmdID: inter.CmdActionExec, Cron: "0 0 30 2 *"},
+		{Command: "action_exec", CmdID: inter.CmdActionExec, Cron: "@daily", Timezone: "Mars/Base"},
+		{Command: "action_exec", CmdID: inter.CmdActionExec, Cron: "@daily", Payload: []byte(`{`)},
+	}
+	for i, tc := range cases {
+		if _, err := service.Create(inter.Scope{}, tc); !errors.Is(err, inter.ErrCommandScheduleInvalid) {
+			t.Fatalf("case %d: expected invalid schedule error, got %v", i, err)
+		}
+	}
+	_, err := service.Create(inter.Scope{TenantID: "tenant_other"}, inter.CommandSchedule{
+		UUID: "invalid-dev", Command: "action_exec", CmdID: inter.CmdActionExec, Cron: "@daily",
+	})
+	if !errors.Is(err, inter.ErrDeviceTenantMismatch) {
+		t.Fatalf("expected tenant mismatch, got %v", err)
+	}
+}
+
+// failingClaimStore 让指定计划的抢占失败，用于验证单个计划出错不会中断同一轮的其他计划。
+type failingClaimStore struct {
+	*persistence.Store
+	failID int64
+}
+
+func (s failingClaimStore) ClaimCommandScheduleRun(id, revision int64, ranAt time.Time, next *time.Time) (bool, error) {
+	if id == s.failID {
+		return false, errors.New("claim failed")
+	}
+	return s.Store.ClaimCommandScheduleRun(id, revision, ranAt, next)
+}
+
+func TestCommandScheduleServiceRunDueContinuesAfterFailure(t *testing.T) {
+	ds, service, _ := newScheduleTestEnv(t)
+	initScheduleDevice(t, ds, "due-a", inter.Authenticated)
+	initScheduleDevice(t, ds, "due-b", inter.Authenticated)
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	var ids []int64
+	for _, uuid := range []string{"due-a", "due-b"} {
+		at := now
+		created, err := service.Create(inter.Scope{}, inter.CommandSchedule{
+			UUID:      uuid,
+			Command:   "screen_wy",
+			CmdID:     inter.CmdScreenWy,
+			ExecuteAt: &at,
+			Enabled:   true,
+		})
+		if err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	failing := NewCommandScheduleService(failingClaimStore{Store: ds, failID: ids[0]}, service.downlink, appcfg.DefaultDeviceManagerConfig())
+	failing.now = service.now
+	fired, err := failing.RunDue()
+	if err == nil || fired != 1 {
+		t.Fatalf("expected one run and the claim error, fired=%d err=%v", fired, err)
+	}
+	if got := len(scheduledCommands(t, ds, "due-b")); got != 1 {
+		t.Fatalf("schedule after the failed one should still fire, got %d commands", got)
+	}
+}
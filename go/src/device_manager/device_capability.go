@@ -0,0 +1,231 @@
+package device_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// ValidateCapabilityValues 按设备声明的能力校验 set 命令中的属性取值，返回全部违规项；
+// 设备没有声明任何能力时不做校验，以兼容未上报能力的旧设备。
+func ValidateCapabilityValues(capabilities []inter.DeviceCapability, values map[string]interface{}) []inter.CapabilityViolation {
+	if len(capabilities) == 0 {
+		return nil
+	}
+	return validateCapabilityObject("", capabilityIndex(capabilities), values)
+}
+
+// ValidateCommandCapabilities 按命令编号取出将写入设备的属性并校验，不符时返回 *inter.CapabilityViolationError。
+// action_exec（含 set）的载荷本身就是属性对象；config_push 只校验影子下发的 state，配置文档不是设备属性。
+func ValidateCommandCapabilities(capabilities []inter.DeviceCapability, cmdID inter.CmdID, payload []byte) error {
+	if len(capabilities) == 0 {
+		return nil
+	}
+	var values map[string]interface{}
+	switch cmdID {
+	case inter.CmdActionExec:
+		if err := json.Unmarshal(payload, &values); err != nil || len(values) == 0 {
+			return &inter.CapabilityViolationError{Violations: []inter.CapabilityViolation{
+				{Reason: "invalid_payload", Message: "payload must be a non-empty object of property values"},
+			}}
+		}
+	case inter.CmdConfigPush:
+		var doc struct {
+			State map[string]interface{} `json:"state"`
+		}
+		if err := json.Unmarshal(payload, &doc); err != nil {
+			return nil
+		}
+		values = doc.State
+	default:
+		return nil
+	}
+	if violations := ValidateCapabilityValues(capabilities, values); len(violations) > 0 {
+		return &inter.CapabilityViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// capabilityIndex 以属性名索引能力。light、switch 等特定类型只是把 features 分组，
+// 其子能力直接对应顶层属性；composite 的取值是对象，需要保留层级。
+func capabilityIndex(capabilities []inter.DeviceCapability) map[string]inter.DeviceCapability {
+	index := make(map[string]inter.DeviceCapability, len(capabilities))
+	var walk func(items []inter.DeviceCapability)
+	walk = func(items []inter.DeviceCapability) {
+		for _, item := range items {
+			key := capabilityKey(item)
+			if len(item.Features) > 0 && (key == "" || !isObjectCapability(item)) {
+				walk(item.Features)
+				continue
+			}
+			if key != "" {
+				index[key] = item
+			}
+		}
+	}
+	walk(capabilities)
+	return index
+}
+
+func capabilityKey(capability inter.DeviceCapability) string {
+	if property := strings.TrimSpace(capability.Property); property != "" {
+		return property
+	}
+	return strings.TrimSpace(capability.Name)
+}
+
+func isObjectCapability(capability inter.DeviceCapability) bool {
+	switch strings.ToLower(capability.Type) {
+	case "composite", "object":
+		return true
+	default:
+		return false
+	}
+}
+
+func validateCapabilityObject(prefix string, index map[string]inter.DeviceCapability, values map[string]interface{}) []inter.CapabilityViolation {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var violations []inter.CapabilityViolation
+	for _, key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		capability, ok := index[key]
+		if !ok {
+			violations = append(violations, inter.CapabilityViolation{Property: path, Reason: "unknown_property", Message: "device does not declare this property"})
+			continue
+		}
+		violations = append(violations, validateCapabilityValue(path, capability, values[key])...)
+	}
+	return violations
+}
+
+func validateCapabilityValue(path string, capability inter.DeviceCapability, value interface{}) []inter.CapabilityViolation {
+	if !capability.Writable {
+		return []inter.CapabilityViolation{{Property: path, Reason: "not_writable", Message: "property is read-only"}}
+	}
+	typeMismatch := func(expected string) []inter.CapabilityViolation {
+		return []inter.CapabilityViolation{{Property: path, Reason: "type_mismatch", Message: "value must be " + expected, Expected: expected}}
+	}
+
+	switch strings.ToLower(capability.Type) {
+	case "binary", "bool", "boolean":
+		// binary 的取值可能是 ON/OFF 这类文本，声明了候选值时按候选值校验。
+		if len(capability.AllowedValues) > 0 {
+			return checkAllowedValue(path, capability.AllowedValues, value)
+		}
+		if _, ok := value.(bool); !ok {
+			return typeMismatch("boolean")
+		}
+	case "numeric", "number", "float", "int", "integer":
+		n, ok := value.(float64)
+		if !ok {
+			return typeMismatch("number")
+		}
+		if t := strings.ToLower(capability.Type); (t == "int" || t == "integer") && n != math.Trunc(n) {
+			return typeMismatch("integer")
+		}
+		return checkNumericRange(path, capability, n)
+	case "enum":
+		return checkAllowedValue(path, capability.AllowedValues, value)
+	case "text", "string":
+		if _, ok := value.(string); !ok {
+			return typeMismatch("string")
+		}
+	case "composite", "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return typeMismatch("object")
+		}
+		if len(capability.Features) > 0 {
+			return validateCapabilityObject(path, capabilityIndex(capability.Features), object)
+		}
+	case "list", "array":
+		if _, ok := value.([]interface{}); !ok {
+			return typeMismatch("array")
+		}
+	}
+	return nil
+}
+
+func checkAllowedValue(path string, allowed []string, value interface{}) []inter.CapabilityViolation {
+	if len(allowed) == 0 {
+		return nil
+	}
+	text, ok := scalarText(value)
+	if ok {
+		for _, item := range allowed {
+			if item == text {
+				return nil
+			}
+		}
+	}
+	return []inter.CapabilityViolation{{
+		Property: path,
+		Reason:   "not_allowed",
+		Message:  "value must be one of " + strings.Join(allowed, ", "),
+		Expected: allowed,
+	}}
+}
+
+func checkNumericRange(path string, capability inter.DeviceCapability, n float64) []inter.CapabilityViolation {
+	min, hasMin := parseCapabilityBound(capability.ValueMin)
+	max, hasMax := parseCapabilityBound(capability.ValueMax)
+	if (hasMin && n < min) || (hasMax && n > max) {
+		expected := map[string]interface{}{}
+		if hasMin {
+			expected["min"] = min
+		}
+		if hasMax {
+			expected["max"] = max
+		}
+		return []inter.CapabilityViolation{{
+			Property: path,
+			Reason:   "out_of_range",
+			Message:  fmt.Sprintf("value must be within [%s, %s]", boundText(capability.ValueMin, "-inf"), boundText(capability.ValueMax, "+inf")),
+			Expected: expected,
+		}}
+	}
+	return nil
+}
+
+func parseCapabilityBound(raw string) (float64, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(raw, 64)
+	return n, err == nil
+}
+
+func boundText(raw, fallback string) string {
+	if _, ok := parseCapabilityBound(raw); ok {
+		return strings.TrimSpace(raw)
+	}
+	return fallback
+}
+
+// scalarText 把 JSON 标量转换成与 allowed_values 可比较的文本。
+func scalarText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
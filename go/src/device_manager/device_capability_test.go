@@ -0,0 +1,63 @@
+package device_manager
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestValidateCapabilityValues(t *testing.T) {
+	capabilities := []inter.DeviceCapability{
+		{Type: "light", Features: []inter.DeviceCapability{
+			{Property: "state", Type: "binary", Writable: true, AllowedValues: []string{"ON", "OFF", "TOGGLE"}},
+			{Property: "brightness", Type: "numeric", Writable: true, ValueMin: "0", ValueMax: "254"},
+			{Property: "color", Type: "composite", Writable: true, Features: []inter.DeviceCapability{
+				{Property: "x", Type: "numeric", Writable: true},
+				{Property: "y", Type: "numeric", Writable: true},
+			}},
+		}},
+		{Property: "effect", Type: "enum", Writable: true, AllowedValues: []string{"blink", "breathe"}},
+		{Property: "linkquality", Type: "numeric", Readable: true},
+		{Property: "child_lock", Type: "boolean", Writable: true},
+		{Property: "level", Type: "integer", Writable: true},
+	}
+
+	decode := func(raw string) map[string]interface{} {
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &values); err != nil {
+			t.Fatalf("bad fixture %s: %v", raw, err)
+		}
+		return values
+	}
+
+	if got := ValidateCapabilityValues(capabilities, decode(`{"state":"ON","brightness":120,"color":{"x":0.3,"y":0.4},"effect":"blink","child_lock":true,"level":3}`)); len(got) != 0 {
+		t.Fatalf("valid values should pass, got %+v", got)
+	}
+
+	cases := []struct {
+		payload  string
+		property string
+		reason   string
+	}{
+		{`{"brightness":300}`, "brightness", "out_of_range"},
+		{`{"brightness":"high"}`, "brightness", "type_mismatch"},
+		{`{"state":"DIM"}`, "state", "not_allowed"},
+		{`{"effect":"rainbow"}`, "effect", "not_allowed"},
+		{`{"linkquality":10}`, "linkquality", "not_writable"},
+		{`{"child_lock":"yes"}`, "child_lock", "type_mismatch"},
+		{`{"level":1.5}`, "level", "type_mismatch"},
+		{`{"color":{"z":1}}`, "color.z", "unknown_property"},
+		{`{"power":1}`, "power", "unknown_property"},
+	}
+	for _, tc := range cases {
+		got := ValidateCapabilityValues(capabilities, decode(tc.payload))
+		if len(got) != 1 || got[0].Property != tc.property || got[0].Reason != tc.reason {
+			t.Fatalf("payload %s: expected %s/%s, got %+v", tc.payload, tc.property, tc.reason, got)
+		}
+	}
+
+	if got := ValidateCapabilityValues(nil, decode(`{"anything":1}`)); len(got) != 0 {
+		t.Fatalf("devices without capabilities should not be validated, got %+v", got)
+	}
+}
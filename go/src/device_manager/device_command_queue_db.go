@@ -0,0 +1,92 @@
+package device_manager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
+)
+
+// DatabaseDeviceCommandQueue 以 device_commands 表为准的设备下行队列。
+// 指令在创建时已经以 queued 状态落库，队列只负责排序、容量控制和领取，重启后未发送的指令会继续投递；
+// 重新入队时以库中记录为准，不使用调用方传入的负载。
+type DatabaseDeviceCommandQueue struct {
+	dataStore inter.DeviceCommandQueueRepository
+	capacity  int
+	lease     time.Duration
+	now       func() time.Time
+}
+
+// NewDatabaseDeviceCommandQueue 创建持久化的设备下行队列。
+// lease 是指令被领取后等待标记发送的时长，超过后视为投递中断，指令重新回到队列。
+func NewDatabaseDeviceCommandQueue(ds inter.DeviceCommandQueueRepository, capacity int, lease time.Duration) *DatabaseDeviceCommandQueue {
+	return &DatabaseDeviceCommandQueue{
+		dataStore: ds,
+		capacity:  capacity,
+		lease:     lease,
+		now:       time.Now,
+	}
+}
+
+// Enqueue 在队列超出容量时把最早的指令标记为 overflow，与内存队列的淘汰顺序一致。
+func (q *DatabaseDeviceCommandQueue) Enqueue(uuid string, message inter.DownlinkMessage) error {
+	if message.CommandID <= 0 {
+		return errors.New("database queue requires a persisted command id")
+	}
+	_, err := q.dataStore.TrimDeviceCommandQueue(uuid, q.capacity, q.claimedBefore())
+	return err
+}
+
+// Requeue 把指令排回队首；队列超出容量时淘汰排在最后的指令，保住重试项。
+func (q *DatabaseDeviceCommandQueue) Requeue(uuid string, message inter.DownlinkMessage) error {
+	if message.CommandID <= 0 {
+		return errors.New("database queue requires a persisted command id")
+	}
+	_, err := q.dataStore.RequeueDeviceCommandFront(uuid, message.CommandID, q.capacity, q.claimedBefore())
+	return err
+}
+
+func (q *DatabaseDeviceCommandQueue) Dequeue(uuid string) (inter.DownlinkMessage, bool, error) {
+	now := q.now()
+	record, ok, err := q.dataStore.ClaimNextDeviceCommand(uuid, now, now.Add(-q.lease))
+	if err != nil || !ok {
+		return inter.DownlinkMessage{}, false, err
+	}
+	msg := inter.DownlinkMessage{
+		CommandID:   record.ID,
+		CmdID:       record.CmdID,
+		Payload:     record.Payload,
+		Timeout:     time.Duration(record.TimeoutMs) * time.Millisecond,
+		MaxAttempts: record.MaxAttempts,
+		CreatedAt:   record.RequestedAt,
+	}
+	if record.ExpiresAt != nil {
+		msg.ExpiresAt = *record.ExpiresAt
+	}
+	return msg, true, nil
+}
+
+// IsEmpty 在查询失败时记录日志并按非空处理，调用方随后的 Dequeue 会返回具体错误，不会把待发指令误判为已清空。
+func (q *DatabaseDeviceCommandQueue) IsEmpty(uuid string) bool {
+	count, err := q.dataStore.CountQueuedDeviceCommands(uuid, q.claimedBefore())
+	if err != nil {
+		logger.Default().With(inter.String("module", "device_manager")).Warn("查询设备下行队列长度失败", inter.String("uuid", uuid), inter.Err(err))
+		return false
+	}
+	return count == 0
+}
+
+// Remove 无需额外操作：指令离开 queued 状态后自然不再属于队列。
+func (q *DatabaseDeviceCommandQueue) Remove(uuid string, commandID int64) error {
+	return nil
+}
+
+// Renew 刷新指令的领取时间，推送会话持有指令期间租约不会到期。
+func (q *DatabaseDeviceCommandQueue) Renew(commandIDs []int64) error {
+	return q.dataStore.RenewDeviceCommandClaims(commandIDs, q.now())
+}
+
+func (q *DatabaseDeviceCommandQueue) claimedBefore() time.Time {
+	return q.now().Add(-q.lease)
+}
@@ -1,9 +1,13 @@
 package device_manager
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
 
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
 	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
 )
 
 func TestInMemoryDeviceCommandQueueMaintainsFIFO(t *testing.T) {
@@ -66,6 +70,40 @@ func TestInMemoryDeviceCommandQueueDropsOldestWhenFull(t *testing.T) {
 	}
 }
 
+func TestInMemoryDeviceCommandQueueMarksDroppedCommandOverflow(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "memory_queue.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	if err := ds.InitDevice("device-1", inter.DeviceMetadata{Name: "d1", Token: "tk-1", AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("init device failed: %v", err)
+	}
+
+	queue := NewDeviceCommandQueueWithStore(1, ds)
+	ids := make([]int64, 0, 2)
+	for i := 0; i < 2; i++ {
+		id, err := ds.CreateDeviceCommand("device-1", inter.CmdActionExec, "action_exec", nil)
+		if err != nil {
+			t.Fatalf("create command failed: %v", err)
+		}
+		ids = append(ids, id)
+		if err := queue.Enqueue("device-1", inter.DownlinkMessage{CommandID: id, CmdID: inter.CmdActionExec}); err != nil {
+			t.Fatalf("enqueue %d failed: %v", id, err)
+		}
+	}
+
+	dropped, err := ds.GetDeviceCommand(ids[0])
+	if err != nil || dropped.Status != inter.DeviceCommandStatusOverflow {
+		t.Fatalf("dropped command should be marked overflow, got %+v err=%v", dropped, err)
+	}
+	if queue.Overflows() != 1 {
+		t.Fatalf("expected one overflow, got %d", queue.Overflows())
+	}
+}
+
 func TestInMemoryDeviceCommandQueueRequeueToFront(t *testing.T) {
 	queue := NewDeviceCommandQueue(3)
 
@@ -99,3 +137,67 @@ func TestInMemoryDeviceCommandQueueRequeueToFront(t *testing.T) {
 		t.Fatalf("expected original first message second, got %+v ok=%v", got, ok)
 	}
 }
+
+func TestDatabaseDeviceCommandQueueSurvivesRestartAndMarksOverflow(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	uuid := "device-db-queue"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-db-queue", AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+
+	cfg := appcfg.DefaultDeviceManagerConfig()
+	cfg.QueueCapacity = 2
+	newService := func() *DownlinkCommandService {
+		return NewDownlinkCommandServiceWithConfig(ds, NewDatabaseDeviceCommandQueue(ds, cfg.QueueCapacity, time.Minute), nil, cfg)
+	}
+
+	service := newService()
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		msg, err := service.Enqueue(inter.Scope{}, uuid, inter.CmdConfigPush, "config_push", []byte(`{"interval":30}`))
+		if err != nil {
+			t.Fatalf("enqueue %d failed: %v", i, err)
+		}
+		ids = append(ids, msg.CommandID)
+	}
+	dropped, err := ds.GetDeviceCommand(ids[0])
+	if err != nil || dropped.Status != inter.DeviceCommandStatusOverflow {
+		t.Fatalf("oldest command should be marked overflow, got %+v err=%v", dropped, err)
+	}
+
+	// 新的服务实例模拟 Core 重启，队列内容来自 device_commands。
+	restarted := newService()
+	msg, ok, err := restarted.PopDownlink(uuid)
+	if err != nil || !ok || msg.CommandID != ids[1] || string(msg.Payload) != `{"interval":30}` || msg.MaxAttempts != cfg.CommandMaxAttempts {
+		t.Fatalf("unexpected message after restart: %+v ok=%v err=%v", msg, ok, err)
+	}
+	if err := restarted.Requeue(uuid, msg); err != nil {
+		t.Fatalf("requeue failed: %v", err)
+	}
+	msg, ok, err = restarted.PopDownlink(uuid)
+	if err != nil || !ok || msg.CommandID != ids[1] {
+		t.Fatalf("requeued command should be delivered first, got %+v ok=%v err=%v", msg, ok, err)
+	}
+	if err := restarted.MarkSent(msg.CommandID); err != nil {
+		t.Fatalf("mark sent failed: %v", err)
+	}
+	msg, ok, err = restarted.PopDownlink(uuid)
+	if err != nil || !ok || msg.CommandID != ids[2] {
+		t.Fatalf("unexpected next message: %+v ok=%v err=%v", msg, ok, err)
+	}
+	if !restarted.queue.IsEmpty(uuid) {
+		t.Fatal("queue should be empty after all commands are claimed")
+	}
+
+	// 存储不可用时不能把队列报告为空。
+	_ = persistence.CloseIfPossible(ds)
+	if restarted.queue.IsEmpty(uuid) {
+		t.Fatal("queue should not report empty when the store fails")
+	}
+}
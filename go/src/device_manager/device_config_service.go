@@ -0,0 +1,354 @@
+package device_manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+const (
+	// configPushKey 是配置下发指令的替换键，新的下发会替换尚未发出的旧版本。
+	configPushKey = "device-config"
+	// configVersionLength 是由生效配置内容计算出的版本号长度。
+	configVersionLength    = 16
+	maxConfigCommentLength = 256
+)
+
+// deviceConfigStore 是配置服务依赖的最小仓储组合。
+type deviceConfigStore interface {
+	inter.DeviceConfigRepository
+	GetDeviceGroup(tenantID, groupID string) (inter.DeviceGroup, error)
+	ResolveDeviceTenant(uuid string) (string, error)
+	LoadConfig(uuid string) (inter.DeviceMetadata, error)
+	LoadConfigByTenant(tenantID, uuid string) (inter.DeviceMetadata, error)
+	GetDeviceCommand(commandID int64) (inter.DeviceCommand, error)
+}
+
+// configPushPayload 是 CmdConfigPush 的载荷：设备应用 config 后以 config_version 上报。
+type configPushPayload struct {
+	ConfigVersion string                 `json:"config_version"`
+	Config        map[string]interface{} `json:"config"`
+}
+
+// DeviceConfigService 按租户、分组、设备三层解析生效配置，并在设备注册或心跳时对账下发。
+// 生效配置的版本号由内容计算，回滚到相同内容时设备不会收到重复下发。
+type DeviceConfigService struct {
+	dataStore deviceConfigStore
+	downlink  inter.DownlinkCommandService
+	now       func() time.Time
+}
+
+// NewDeviceConfigService 创建配置服务，配置通过 downlink 以 CmdConfigPush 下发。
+func NewDeviceConfigService(ds deviceConfigStore, downlink inter.DownlinkCommandService) *DeviceConfigService {
+	return &DeviceConfigService{dataStore: ds, downlink: downlink, now: time.Now}
+}
+
+func (s *DeviceConfigService) SaveDocument(scope inter.Scope, doc inter.ConfigDocument) (inter.ConfigDocument, error) {
+	doc.TenantID = scopeTenantID(scope)
+	doc.ScopeID = strings.TrimSpace(doc.ScopeID)
+	doc.Comment = strings.TrimSpace(doc.Comment)
+	if err := s.checkScope(doc.TenantID, doc.ScopeType, doc.ScopeID); err != nil {
+		return inter.ConfigDocument{}, err
+	}
+	if len(doc.Comment) > maxConfigCommentLength {
+		return inter.ConfigDocument{}, fmt.Errorf("%w: comment exceeds %d characters", inter.ErrConfigDocumentInvalid, maxConfigCommentLength)
+	}
+	if doc.Content == nil {
+		doc.Content = map[string]interface{}{}
+	}
+	// 整个配置还要装进一条下行指令，单层文档不能超过下行载荷上限。
+	raw, err := json.Marshal(doc.Content)
+	if err != nil {
+		return inter.ConfigDocument{}, fmt.Errorf("%w: %v", inter.ErrConfigDocumentInvalid, err)
+	}
+	if len(raw) > inter.MaxDownlinkPayloadSize {
+		return inter.ConfigDocument{}, fmt.Errorf("%w: content exceeds %d bytes", inter.ErrConfigDocumentInvalid, inter.MaxDownlinkPayloadSize)
+	}
+	doc.ID = 0
+	doc.Version = 0
+	doc.CreatedAt = s.now().UTC()
+	return s.dataStore.CreateConfigDocument(doc)
+}
+
+func (s *DeviceConfigService) GetDocument(scope inter.Scope, scopeType inter.ConfigScopeType, scopeID string, version int64) (inter.ConfigDocument, error) {
+	tenantID := scopeTenantID(scope)
+	scopeID = strings.TrimSpace(scopeID)
+	if err := s.checkScope(tenantID, scopeType, scopeID); err != nil {
+		return inter.ConfigDocument{}, err
+	}
+	return s.dataStore.GetConfigDocument(tenantID, scopeType, scopeID, version)
+}
+
+func (s *DeviceConfigService) ListVersions(scope inter.Scope, scopeType inter.ConfigScopeType, scopeID string, limit int) ([]inter.ConfigDocument, error) {
+	tenantID := scopeTenantID(scope)
+	scopeID = strings.TrimSpace(scopeID)
+	if err := s.checkScope(tenantID, scopeType, scopeID); err != nil {
+		return nil, err
+	}
+	return s.dataStore.ListConfigDocuments(tenantID, scopeType, scopeID, limit)
+}
+
+func (s *DeviceConfigService) Rollback(scope inter.Scope, scopeType inter.ConfigScopeType, scopeID string, version int64, createdBy string) (inter.ConfigDocument, error) {
+	if version <= 0 {
+		return inter.ConfigDocument{}, fmt.Errorf("%w: version must be positive", inter.ErrConfigDocumentInvalid)
+	}
+	target, err := s.GetDocument(scope, scopeType, scopeID, version)
+	if err != nil {
+		return inter.ConfigDocument{}, err
+	}
+	return s.SaveDocument(scope, inter.ConfigDocument{
+		ScopeType:      target.ScopeType,
+		ScopeID:        target.ScopeID,
+		Content:        target.Content,
+		Comment:        fmt.Sprintf("rollback to version %d", version),
+		RolledBackFrom: version,
+		CreatedBy:      createdBy,
+	})
+}
+
+func (s *DeviceConfigService) GetEffective(scope inter.Scope, uuid string) (inter.EffectiveDeviceConfig, error) {
+	tenantID := scopeTenantID(scope)
+	uuid = strings.TrimSpace(uuid)
+	if _, err := s.dataStore.LoadConfigByTenant(tenantID, uuid); err != nil {
+		return inter.EffectiveDeviceConfig{}, err
+	}
+	effective, err := s.resolve(tenantID, uuid)
+	if err != nil {
+		return inter.EffectiveDeviceConfig{}, err
+	}
+	state, err := s.dataStore.GetDeviceConfigState(uuid)
+	if err != nil {
+		return inter.EffectiveDeviceConfig{}, err
+	}
+	state.TenantID = tenantID
+	effective.State = state
+	effective.InSync = state.CurrentVersion == effective.ConfigVersion
+	return effective, nil
+}
+
+func (s *DeviceConfigService) ListAcks(scope inter.Scope, uuid string, limit int) ([]inter.DeviceConfigAck, error) {
+	tenantID := scopeTenantID(scope)
+	uuid = strings.TrimSpace(uuid)
+	if _, err := s.dataStore.LoadConfigByTenant(tenantID, uuid); err != nil {
+		return nil, err
+	}
+	return s.dataStore.ListDeviceConfigAcks(tenantID, uuid, limit)
+}
+
+func (s *DeviceConfigService) Reconcile(uuid, reportedVersion string) error {
+	uuid = strings.TrimSpace(uuid)
+	meta, err := s.dataStore.LoadConfig(uuid)
+	if err != nil {
+		if errors.Is(err, inter.ErrDeviceNotFound) {
+			return nil
+		}
+		return err
+	}
+	if meta.AuthenticateStatus != inter.Authenticated {
+		return nil
+	}
+	tenantID, err := s.dataStore.ResolveDeviceTenant(uuid)
+	if err != nil {
+		return err
+	}
+	effective, err := s.resolve(tenantID, uuid)
+	if err != nil {
+		return err
+	}
+	state, err := s.dataStore.GetDeviceConfigState(uuid)
+	if err != nil {
+		return err
+	}
+	// 从未被管理过配置的设备不写状态，也不下发空配置。
+	if len(effective.Sources) == 0 && state.PushedVersion == "" && state.AckedVersion == "" {
+		return nil
+	}
+	before := state
+	state.TenantID = tenantID
+	now := s.now().UTC()
+
+	if state.CommandID > 0 {
+		if err := s.settlePush(&state, effective, now); err != nil {
+			return err
+		}
+	}
+	// 本次上报晚于此前的下发确认，以上报为准。
+	if reported := strings.TrimSpace(reportedVersion); reported != "" {
+		state.CurrentVersion = reported
+	}
+
+	switch {
+	case state.CurrentVersion == effective.ConfigVersion:
+		if state.AckedVersion != state.CurrentVersion {
+			if err := s.recordAck(&state, effective, inter.DeviceConfigAckReported, 0, now); err != nil {
+				return err
+			}
+		}
+	case state.CommandID > 0 && state.PushedVersion == effective.ConfigVersion:
+		// 同一版本已有在途下发，等待设备确认。
+	default:
+		if err := s.push(&state, effective, now); err != nil {
+			return err
+		}
+	}
+	if state == before {
+		return nil
+	}
+	state.UpdatedAt = now
+	return s.dataStore.SaveDeviceConfigState(state)
+}
+
+// ReconcileHeartbeat 只读取生效配置与对账状态，设备版本与生效版本一致、已记录确认且没有在途下发时直接返回，
+// 否则执行完整的 Reconcile；心跳频繁，稳定状态下不写库。
+func (s *DeviceConfigService) ReconcileHeartbeat(tenantID, uuid, reportedVersion string) error {
+	uuid = strings.TrimSpace(uuid)
+	effective, err := s.resolve(tenantID, uuid)
+	if err != nil {
+		return err
+	}
+	state, err := s.dataStore.GetDeviceConfigState(uuid)
+	if err != nil {
+		return err
+	}
+	if !configDrifted(state, effective, reportedVersion) {
+		return nil
+	}
+	return s.Reconcile(uuid, reportedVersion)
+}
+
+// configDrifted 判断设备是否需要对账：有在途下发待结算，或设备版本与生效版本不一致、尚未记录确认。
+func configDrifted(state inter.DeviceConfigState, effective inter.EffectiveDeviceConfig, reportedVersion string) bool {
+	if len(effective.Sources) == 0 && state.PushedVersion == "" && state.AckedVersion == "" {
+		return false
+	}
+	if state.CommandID > 0 {
+		return true
+	}
+	current := state.CurrentVersion
+	if reported := strings.TrimSpace(reportedVersion); reported != "" {
+		current = reported
+	}
+	return current != effective.ConfigVersion || state.AckedVersion != current
+}
+
+// settlePush 根据在途下发指令的当前状态更新对账状态：确认时记录审计，其余终态清除在途标记以便重新下发。
+func (s *DeviceConfigService) settlePush(state *inter.DeviceConfigState, effective inter.EffectiveDeviceConfig, now time.Time) error {
+	cmd, err := s.dataStore.GetDeviceCommand(state.CommandID)
+	if errors.Is(err, inter.ErrDeviceCommandNotFound) {
+		state.CommandID = 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch cmd.Status {
+	case inter.DeviceCommandStatusQueued, inter.DeviceCommandStatusSent:
+		return nil
+	case inter.DeviceCommandStatusAcked:
+		commandID := state.CommandID
+		state.CommandID = 0
+		state.CurrentVersion = state.PushedVersion
+		acked := effective
+		if state.PushedVersion != effective.ConfigVersion {
+			// 设备确认的是下发时的版本，之后配置又有变化时来源无法还原。
+			acked = inter.EffectiveDeviceConfig{ConfigVersion: state.PushedVersion}
+		}
+		return s.recordAck(state, acked, inter.DeviceConfigAckCommand, commandID, now)
+	default:
+		state.CommandID = 0
+		return nil
+	}
+}
+
+func (s *DeviceConfigService) recordAck(state *inter.DeviceConfigState, effective inter.EffectiveDeviceConfig, source inter.DeviceConfigAckSource, commandID int64, now time.Time) error {
+	if err := s.dataStore.RecordDeviceConfigAck(inter.DeviceConfigAck{
+		TenantID:      state.TenantID,
+		UUID:          state.UUID,
+		ConfigVersion: effective.ConfigVersion,
+		Sources:       effective.Sources,
+		Source:        source,
+		CommandID:     commandID,
+		AckedAt:       now,
+	}); err != nil {
+		return err
+	}
+	state.AckedVersion = effective.ConfigVersion
+	state.AckedAt = &now
+	return nil
+}
+
+func (s *DeviceConfigService) push(state *inter.DeviceConfigState, effective inter.EffectiveDeviceConfig, now time.Time) error {
+	if s.downlink == nil {
+		return nil
+	}
+	payload, err := json.Marshal(configPushPayload{ConfigVersion: effective.ConfigVersion, Config: effective.Config})
+	if err != nil {
+		return err
+	}
+	if len(payload) > inter.MaxDownlinkPayloadSize {
+		return fmt.Errorf("config for device %s exceeds %d bytes", state.UUID, inter.MaxDownlinkPayloadSize)
+	}
+	msg, err := s.downlink.EnqueueWithPolicy(inter.Scope{TenantID: state.TenantID}, state.UUID, inter.CmdConfigPush, "config_push", payload, inter.DeviceCommandPolicy{
+		Key:       configPushKey,
+		Supersede: true,
+	})
+	if err != nil {
+		return err
+	}
+	state.PushedVersion = effective.ConfigVersion
+	state.CommandID = msg.CommandID
+	state.PushedAt = &now
+	return nil
+}
+
+// resolve 按层合并设备的配置文档并计算版本号。
+func (s *DeviceConfigService) resolve(tenantID, uuid string) (inter.EffectiveDeviceConfig, error) {
+	layers, err := s.dataStore.ListDeviceConfigLayers(tenantID, uuid)
+	if err != nil {
+		return inter.EffectiveDeviceConfig{}, err
+	}
+	config := map[string]interface{}{}
+	sources := make([]inter.ConfigSource, 0, len(layers))
+	for _, layer := range layers {
+		config = mergeShadowMaps(config, layer.Content)
+		sources = append(sources, inter.ConfigSource{ScopeType: layer.ScopeType, ScopeID: layer.ScopeID, Version: layer.Version})
+	}
+	// encoding/json 按键排序输出，同样的内容总是得到同样的版本号。
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return inter.EffectiveDeviceConfig{}, err
+	}
+	sum := sha256.Sum256(raw)
+	return inter.EffectiveDeviceConfig{
+		UUID:          uuid,
+		TenantID:      tenantID,
+		ConfigVersion: hex.EncodeToString(sum[:])[:configVersionLength],
+		Config:        config,
+		Sources:       sources,
+	}, nil
+}
+
+// checkScope 校验作用对象属于当前租户。
+func (s *DeviceConfigService) checkScope(tenantID string, scopeType inter.ConfigScopeType, scopeID string) error {
+	switch scopeType {
+	case inter.ConfigScopeTenant:
+		if scopeID != "" {
+			return fmt.Errorf("%w: tenant scope does not take an id", inter.ErrConfigDocumentInvalid)
+		}
+		return nil
+	case inter.ConfigScopeGroup:
+		_, err := s.dataStore.GetDeviceGroup(tenantID, scopeID)
+		return err
+	case inter.ConfigScopeDevice:
+		_, err := s.dataStore.LoadConfigByTenant(tenantID, scopeID)
+		return err
+	default:
+		return fmt.Errorf("%w: unknown scope %q", inter.ErrConfigDocumentInvalid, scopeType)
+	}
+}
@@ -0,0 +1,255 @@
+package device_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+func newDeviceConfigTestEnv(t *testing.T) (*persistence.Store, *DownlinkCommandService, *DeviceConfigService) {
+	t.Helper()
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "config.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	downlink := NewDownlinkCommandServiceWithConfig(ds, NewDeviceCommandQueue(8), nil, appcfg.DefaultDeviceManagerConfig())
+	return ds, downlink, NewDeviceConfigService(ds, downlink)
+}
+
+// popConfigPush 取出设备的下一条配置下发并解析载荷。
+func popConfigPush(t *testing.T, downlink *DownlinkCommandService, uuid string) (inter.DownlinkMessage, configPushPayload) {
+	t.Helper()
+	msg, ok, err := downlink.PopDownlink(uuid)
+	if err != nil || !ok || msg.CmdID != inter.CmdConfigPush {
+		t.Fatalf("expected config push, got %+v ok=%v err=%v", msg, ok, err)
+	}
+	var payload configPushPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		t.Fatalf("invalid config push payload: %v", err)
+	}
+	return msg, payload
+}
+
+func TestDeviceConfigServiceResolvesLayers(t *testing.T) {
+	ds, _, svc := newDeviceConfigTestEnv(t)
+	scope := inter.Scope{}
+	uuid := "cfg-layers"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	group, err := ds.CreateDeviceGroup(inter.DeviceGroup{Name: "lab"})
+	if err != nil {
+		t.Fatalf("CreateDeviceGroup failed: %v", err)
+	}
+	if err := ds.AddGroupDevice(group.ID, uuid); err != nil {
+		t.Fatalf("AddGroupDevice failed: %v", err)
+	}
+
+	docs := []inter.ConfigDocument{
+		{ScopeType: inter.ConfigScopeTenant, Content: map[string]interface{}{"interval": float64(60), "mode": "normal", "net": map[string]interface{}{"retry": float64(3), "dns": "1.1.1.1"}}},
+		{ScopeType: inter.ConfigScopeGroup, ScopeID: group.ID, Content: map[string]interface{}{"interval": float64(30), "net": map[string]interface{}{"retry": float64(5)}}},
+		{ScopeType: inter.ConfigScopeDevice, ScopeID: uuid, Content: map[string]interface{}{"mode": nil}},
+	}
+	for _, doc := range docs {
+		if _, err := svc.SaveDocument(scope, doc); err != nil {
+			t.Fatalf("SaveDocument(%s) failed: %v", doc.ScopeType, err)
+		}
+	}
+
+	effective, err := svc.GetEffective(scope, uuid)
+	if err != nil {
+		t.Fatalf("GetEffective failed: %v", err)
+	}
+	if effective.Config["interval"] != float64(30) {
+		t.Fatalf("expected group override, got %+v", effective.Config)
+	}
+	if _, ok := effective.Config["mode"]; ok {
+		t.Fatalf("expected null override to remove mode, got %+v", effective.Config)
+	}
+	net, _ := effective.Config["net"].(map[string]interface{})
+	if net["retry"] != float64(5) || net["dns"] != "1.1.1.1" {
+		t.Fatalf("expected nested merge, got %+v", net)
+	}
+	if len(effective.Sources) != 3 || effective.ConfigVersion == "" || effective.InSync {
+		t.Fatalf("unexpected effective config: %+v", effective)
+	}
+
+	if _, err := svc.SaveDocument(scope, inter.ConfigDocument{ScopeType: inter.ConfigScopeTenant, ScopeID: "x"}); !errors.Is(err, inter.ErrConfigDocumentInvalid) {
+		t.Fatalf("expected invalid tenant scope id, got %v", err)
+	}
+	if _, err := svc.SaveDocument(scope, inter.ConfigDocument{ScopeType: inter.ConfigScopeGroup, ScopeID: "missing"}); !errors.Is(err, inter.ErrDeviceGroupNotFound) {
+		t.Fatalf("expected group not found, got %v", err)
+	}
+	if _, err := svc.GetEffective(inter.Scope{TenantID: "tenant_other"}, uuid); !errors.Is(err, inter.ErrDeviceNotFound) {
+		t.Fatalf("expected device hidden from other tenant, got %v", err)
+	}
+}
+
+func TestDeviceConfigServiceReconcilePushesAndRecordsAcks(t *testing.T) {
+	ds, downlink, svc := newDeviceConfigTestEnv(t)
+	scope := inter.Scope{}
+	uuid := "cfg-reconcile"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+
+	// 没有任何配置文档时不对账。
+	if err := svc.Reconcile(uuid, ""); err != nil {
+		t.Fatalf("Reconcile without documents failed: %v", err)
+	}
+	if _, ok, _ := downlink.PopDownlink(uuid); ok {
+		t.Fatal("expected no push without documents")
+	}
+
+	if _, err := svc.SaveDocument(scope, inter.ConfigDocument{ScopeType: inter.ConfigScopeTenant, Content: map[string]interface{}{"interval": float64(60)}}); err != nil {
+		t.Fatalf("SaveDocument failed: %v", err)
+	}
+	if err := svc.Reconcile(uuid, "stale"); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	// 在途下发未确认前，再次对账不会重复入队。
+	if err := svc.Reconcile(uuid, "stale"); err != nil {
+		t.Fatalf("second Reconcile failed: %v", err)
+	}
+	msg, payload := popConfigPush(t, downlink, uuid)
+	if payload.Config["interval"] != float64(60) {
+		t.Fatalf("unexpected pushed config: %+v", payload)
+	}
+	if _, ok, _ := downlink.PopDownlink(uuid); ok {
+		t.Fatal("expected a single pending config push")
+	}
+	if err := downlink.MarkAcked(msg.CommandID); err != nil {
+		t.Fatalf("MarkAcked failed: %v", err)
+	}
+	if err := svc.Reconcile(uuid, ""); err != nil {
+		t.Fatalf("Reconcile after ack failed: %v", err)
+	}
+	effective, err := svc.GetEffective(scope, uuid)
+	if err != nil || !effective.InSync || effective.State.AckedVersion != payload.ConfigVersion || effective.State.CommandID != 0 {
+		t.Fatalf("expected device in sync after ack: %+v err=%v", effective, err)
+	}
+
+	// 设备上报的版本与生效版本一致时只记录确认，不再下发。
+	if _, err := svc.SaveDocument(scope, inter.ConfigDocument{ScopeType: inter.ConfigScopeDevice, ScopeID: uuid, Content: map[string]interface{}{"interval": float64(10)}}); err != nil {
+		t.Fatalf("SaveDocument device failed: %v", err)
+	}
+	effective, _ = svc.GetEffective(scope, uuid)
+	if effective.InSync {
+		t.Fatalf("expected device out of sync after override: %+v", effective)
+	}
+	if err := svc.Reconcile(uuid, effective.ConfigVersion); err != nil {
+		t.Fatalf("Reconcile with reported version failed: %v", err)
+	}
+	if _, ok, _ := downlink.PopDownlink(uuid); ok {
+		t.Fatal("expected no push when reported version matches")
+	}
+
+	acks, err := svc.ListAcks(scope, uuid, 10)
+	if err != nil || len(acks) != 2 {
+		t.Fatalf("unexpected acks: %+v err=%v", acks, err)
+	}
+	if acks[0].Source != inter.DeviceConfigAckReported || acks[0].ConfigVersion != effective.ConfigVersion || len(acks[0].Sources) != 2 {
+		t.Fatalf("unexpected reported ack: %+v", acks[0])
+	}
+	if acks[1].Source != inter.DeviceConfigAckCommand || acks[1].CommandID != msg.CommandID || acks[1].ConfigVersion != payload.ConfigVersion {
+		t.Fatalf("unexpected command ack: %+v", acks[1])
+	}
+}
+
+func TestDeviceConfigServiceRollback(t *testing.T) {
+	ds, downlink, svc := newDeviceConfigTestEnv(t)
+	scope := inter.Scope{}
+	uuid := "cfg-rollback"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	for _, interval := range []float64{60, 15} {
+		if _, err := svc.SaveDocument(scope, inter.ConfigDocument{ScopeType: inter.ConfigScopeTenant, Content: map[string]interface{}{"interval": interval}}); err != nil {
+			t.Fatalf("SaveDocument failed: %v", err)
+		}
+	}
+	v2, _ := svc.GetEffective(scope, uuid)
+	if err := svc.Reconcile(uuid, v2.ConfigVersion); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+
+	doc, err := svc.Rollback(scope, inter.ConfigScopeTenant, "", 1, "alice")
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if doc.Version != 3 || doc.RolledBackFrom != 1 || doc.CreatedBy != "alice" || doc.Content["interval"] != float64(60) {
+		t.Fatalf("unexpected rollback document: %+v", doc)
+	}
+	if _, err := svc.Rollback(scope, inter.ConfigScopeTenant, "", 9, "alice"); !errors.Is(err, inter.ErrConfigDocumentNotFound) {
+		t.Fatalf("expected missing version, got %v", err)
+	}
+
+	if err := svc.Reconcile(uuid, v2.ConfigVersion); err != nil {
+		t.Fatalf("Reconcile after rollback failed: %v", err)
+	}
+	_, payload := popConfigPush(t, downlink, uuid)
+	if payload.Config["interval"] != float64(60) || payload.ConfigVersion == v2.ConfigVersion {
+		t.Fatalf("expected rolled back config pushed, got %+v", payload)
+	}
+	versions, err := svc.ListVersions(scope, inter.ConfigScopeTenant, "", 10)
+	if err != nil || len(versions) != 3 || versions[0].Version != 3 {
+		t.Fatalf("unexpected versions: %+v err=%v", versions, err)
+	}
+}
+
+func TestDeviceConfigServiceReconcileHeartbeatSkipsSettledDevices(t *testing.T) {
+	ds, downlink, svc := newDeviceConfigTestEnv(t)
+	scope := inter.Scope{}
+	uuid := "cfg-heartbeat"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	tenantID := inter.DefaultTenantID
+
+	// 未被管理配置的设备不写状态。
+	if err := svc.ReconcileHeartbeat(tenantID, uuid, "v0"); err != nil {
+		t.Fatalf("ReconcileHeartbeat without documents failed: %v", err)
+	}
+	if state, _ := ds.GetDeviceConfigState(uuid); state.CurrentVersion != "" {
+		t.Fatalf("unmanaged device should not get a config state: %+v", state)
+	}
+
+	// 新文档使生效版本变化，没有上报版本的心跳也会触发下发。
+	if _, err := svc.SaveDocument(scope, inter.ConfigDocument{ScopeType: inter.ConfigScopeTenant, Content: map[string]interface{}{"interval": float64(60)}}); err != nil {
+		t.Fatalf("SaveDocument failed: %v", err)
+	}
+	if err := svc.ReconcileHeartbeat(tenantID, uuid, ""); err != nil {
+		t.Fatalf("ReconcileHeartbeat failed: %v", err)
+	}
+	msg, payload := popConfigPush(t, downlink, uuid)
+	if err := downlink.MarkAcked(msg.CommandID); err != nil {
+		t.Fatalf("MarkAcked failed: %v", err)
+	}
+	// 在途下发确认后，下一次心跳结算确认。
+	if err := svc.ReconcileHeartbeat(tenantID, uuid, payload.ConfigVersion); err != nil {
+		t.Fatalf("ReconcileHeartbeat after ack failed: %v", err)
+	}
+	settled, err := ds.GetDeviceConfigState(uuid)
+	if err != nil || settled.CommandID != 0 || settled.AckedVersion != payload.ConfigVersion {
+		t.Fatalf("expected push to be settled: %+v err=%v", settled, err)
+	}
+
+	// 稳定状态下心跳不再写状态。
+	if err := svc.ReconcileHeartbeat(tenantID, uuid, payload.ConfigVersion); err != nil {
+		t.Fatalf("steady ReconcileHeartbeat failed: %v", err)
+	}
+	if state, _ := ds.GetDeviceConfigState(uuid); !state.UpdatedAt.Equal(settled.UpdatedAt) {
+		t.Fatalf("steady heartbeat should not rewrite state: %+v", state)
+	}
+	if _, ok, _ := downlink.PopDownlink(uuid); ok {
+		t.Fatal("expected no push for a settled device")
+	}
+}
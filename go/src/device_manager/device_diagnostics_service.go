@@ -0,0 +1,166 @@
+package device_manager
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// deviceDiagnosticsStore 是诊断服务依赖的最小仓储组合。
+type deviceDiagnosticsStore interface {
+	inter.DeviceDiagnosticsRepository
+	ResolveDeviceTenant(uuid string) (string, error)
+}
+
+// DeviceDiagnosticsService 保存心跳诊断快照，按采样间隔沉淀历史，并把配置的键转写为指标。
+type DeviceDiagnosticsService struct {
+	dataStore           deviceDiagnosticsStore
+	telemetry           inter.TelemetryIngestService
+	sampleInterval      time.Duration
+	metricKeys          map[string]uint8
+	historyDefaultLimit int
+	historyMaxLimit     int
+
+	mu          sync.Mutex
+	lastSampled map[string]int64
+}
+
+// NewDeviceDiagnosticsService 创建设备诊断服务；telemetry 为 nil 时不转写指标。
+func NewDeviceDiagnosticsService(ds deviceDiagnosticsStore, telemetry inter.TelemetryIngestService, cfg appcfg.DeviceManagerConfig) *DeviceDiagnosticsService {
+	n := appcfg.NormalizeDeviceManagerConfig(cfg)
+	return &DeviceDiagnosticsService{
+		dataStore:           ds,
+		telemetry:           telemetry,
+		sampleInterval:      n.DiagnosticsSampleInterval,
+		metricKeys:          n.DiagnosticsMetricKeys,
+		historyDefaultLimit: n.DiagnosticsHistoryLimit.Default,
+		historyMaxLimit:     n.DiagnosticsHistoryLimit.Max,
+		lastSampled:         make(map[string]int64),
+	}
+}
+
+func (s *DeviceDiagnosticsService) RecordHeartbeat(uuid string, state map[string]interface{}, observedAt int64) error {
+	uuid = strings.TrimSpace(uuid)
+	if uuid == "" {
+		return errors.New("uuid is required")
+	}
+	if len(state) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	if observedAt <= 0 {
+		observedAt = now
+	}
+
+	sample := s.shouldSample(uuid, observedAt)
+	if err := s.dataStore.SaveDeviceDiagnostics(inter.DeviceDiagnostics{
+		UUID:       uuid,
+		State:      state,
+		ObservedAt: observedAt,
+		ReceivedAt: now,
+	}, sample); err != nil {
+		return err
+	}
+	if sample {
+		s.mu.Lock()
+		s.lastSampled[uuid] = observedAt
+		s.mu.Unlock()
+	}
+
+	if s.telemetry == nil {
+		return nil
+	}
+	if points := s.promotedMetrics(state, observedAt); len(points) > 0 {
+		return s.telemetry.IngestMetrics(uuid, points)
+	}
+	return nil
+}
+
+func (s *DeviceDiagnosticsService) LatestDiagnostics(scope inter.Scope, uuid string) (inter.DeviceDiagnostics, error) {
+	tenantID, err := s.resolveTenant(scope, uuid)
+	if err != nil {
+		return inter.DeviceDiagnostics{}, err
+	}
+	return s.dataStore.GetDeviceDiagnosticsByTenant(tenantID, uuid)
+}
+
+func (s *DeviceDiagnosticsService) QueryDiagnosticsHistory(scope inter.Scope, uuid string, query inter.DeviceDiagnosticsQuery) ([]inter.DeviceDiagnostics, error) {
+	tenantID, err := s.resolveTenant(scope, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if query.Limit <= 0 {
+		query.Limit = s.historyDefaultLimit
+	}
+	if query.Limit > s.historyMaxLimit {
+		query.Limit = s.historyMaxLimit
+	}
+	return s.dataStore.QueryDeviceDiagnosticsHistoryByTenant(tenantID, uuid, query)
+}
+
+// RemoveDevice 清理已删除设备的采样记录。
+func (s *DeviceDiagnosticsService) RemoveDevice(uuid string) {
+	s.mu.Lock()
+	delete(s.lastSampled, strings.TrimSpace(uuid))
+	s.mu.Unlock()
+}
+
+// shouldSample 判断本次心跳是否写入历史。上次采样时间优先取内存，
+// 进程重启后从最新快照的 sampled_at 恢复，避免重启后立即重复采样。
+func (s *DeviceDiagnosticsService) shouldSample(uuid string, observedAt int64) bool {
+	s.mu.Lock()
+	last, ok := s.lastSampled[uuid]
+	s.mu.Unlock()
+	if !ok {
+		if tenantID, err := s.dataStore.ResolveDeviceTenant(uuid); err == nil {
+			if latest, err := s.dataStore.GetDeviceDiagnosticsByTenant(tenantID, uuid); err == nil {
+				last = latest.SampledAt
+			}
+		}
+	}
+	return last <= 0 || observedAt-last >= s.sampleInterval.Milliseconds()
+}
+
+// promotedMetrics 取出配置为指标的数值键，以键名作为指标名；布尔值按 0/1 记录，数字字符串也会被接受。
+func (s *DeviceDiagnosticsService) promotedMetrics(state map[string]interface{}, observedAt int64) []inter.MetricPoint {
+	var points []inter.MetricPoint
+	for key, metricType := range s.metricKeys {
+		raw, ok := state[key]
+		if !ok {
+			continue
+		}
+		var value float64
+		valueType := "number"
+		switch v := raw.(type) {
+		case float64:
+			value = v
+		case bool:
+			valueType = "bool"
+			if v {
+				value = 1
+			}
+		case string:
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				continue
+			}
+			value = n
+		default:
+			continue
+		}
+		points = append(points, inter.MetricPoint{Timestamp: observedAt, Name: key, ValueType: valueType, Value: value, Type: metricType})
+	}
+	return points
+}
+
+func (s *DeviceDiagnosticsService) resolveTenant(scope inter.Scope, uuid string) (string, error) {
+	if tenantID := strings.TrimSpace(scope.TenantID); tenantID != "" {
+		return tenantID, nil
+	}
+	return s.dataStore.ResolveDeviceTenant(uuid)
+}
@@ -0,0 +1,82 @@
+package device_manager
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+func TestDeviceDiagnosticsServiceSamplesHistoryAndPromotesMetrics(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "diagnostics.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+
+	uuid := "device-diagnostics"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               "Device Diagnostics",
+		SerialNumber:       "sn-diagnostics",
+		MACAddress:         "mac-diagnostics",
+		Token:              "tk-diagnostics",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+
+	cfg := appcfg.DefaultDeviceManagerConfig()
+	cfg.DiagnosticsSampleInterval = time.Minute
+	cfg.DiagnosticsMetricKeys = map[string]uint8{"battery": 64, "charging": 65}
+	service := NewDeviceDiagnosticsService(ds, NewTelemetryIngestService(ds), cfg)
+
+	base := time.Now().Add(-time.Hour).UnixMilli()
+	for i, offset := range []int64{0, 10_000, 61_000} {
+		state := map[string]interface{}{"battery": 90.0 - float64(i), "charging": i == 0, "fw": "1.0"}
+		if err := service.RecordHeartbeat(uuid, state, base+offset); err != nil {
+			t.Fatalf("RecordHeartbeat failed: %v", err)
+		}
+	}
+
+	latest, err := service.LatestDiagnostics(inter.Scope{}, uuid)
+	if err != nil {
+		t.Fatalf("LatestDiagnostics failed: %v", err)
+	}
+	if latest.ObservedAt != base+61_000 || latest.State["battery"] != 88.0 {
+		t.Fatalf("unexpected latest diagnostics: %+v", latest)
+	}
+	history, err := service.QueryDiagnosticsHistory(inter.Scope{}, uuid, inter.DeviceDiagnosticsQuery{Start: base - 1, End: base + 120_000})
+	if err != nil {
+		t.Fatalf("QueryDiagnosticsHistory failed: %v", err)
+	}
+	if len(history) != 2 || history[0].ObservedAt != base+61_000 || history[1].ObservedAt != base {
+		t.Fatalf("unexpected sampled history: %+v", history)
+	}
+
+	// 重启后从快照恢复上次采样时间，间隔内的心跳不会再次写入历史。
+	restarted := NewDeviceDiagnosticsService(ds, nil, cfg)
+	if err := restarted.RecordHeartbeat(uuid, map[string]interface{}{"battery": 87.0}, base+70_000); err != nil {
+		t.Fatalf("RecordHeartbeat after restart failed: %v", err)
+	}
+	history, err = restarted.QueryDiagnosticsHistory(inter.Scope{}, uuid, inter.DeviceDiagnosticsQuery{Start: base - 1, End: base + 120_000})
+	if err != nil || len(history) != 2 {
+		t.Fatalf("restart must not resample within interval, got %+v err=%v", history, err)
+	}
+
+	points, err := ds.QueryMetrics(uuid, base-1, base+120_000)
+	if err != nil {
+		t.Fatalf("query metrics failed: %v", err)
+	}
+	byType := map[uint8]int{}
+	for _, point := range points {
+		byType[point.Type]++
+	}
+	if len(points) != 6 || byType[64] != 3 || byType[65] != 3 {
+		t.Fatalf("unexpected promoted metrics: %+v", points)
+	}
+}
@@ -0,0 +1,117 @@
+package device_manager
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// maxGroupNameLength 是分组名称的最大字符数。
+const maxGroupNameLength = 128
+
+// deviceGroupStore 是设备分组服务依赖的最小仓储组合。
+type deviceGroupStore interface {
+	inter.DeviceGroupRepository
+	ResolveDeviceTenant(uuid string) (string, error)
+}
+
+// DeviceGroupService 管理租户内的设备分组，成员只能是同租户设备。
+type DeviceGroupService struct {
+	dataStore deviceGroupStore
+}
+
+// NewDeviceGroupService 创建设备分组服务。
+func NewDeviceGroupService(ds deviceGroupStore) *DeviceGroupService {
+	return &DeviceGroupService{dataStore: ds}
+}
+
+func (s *DeviceGroupService) Create(scope inter.Scope, group inter.DeviceGroup) (inter.DeviceGroup, error) {
+	name, err := normalizeGroupName(group.Name)
+	if err != nil {
+		return inter.DeviceGroup{}, err
+	}
+	group.Name = name
+	group.TenantID = scopeTenantID(scope)
+	return s.dataStore.CreateDeviceGroup(group)
+}
+
+func (s *DeviceGroupService) Get(scope inter.Scope, groupID string) (inter.DeviceGroup, error) {
+	groupID = strings.TrimSpace(groupID)
+	if groupID == "" {
+		return inter.DeviceGroup{}, inter.ErrDeviceGroupNotFound
+	}
+	return s.dataStore.GetDeviceGroup(scopeTenantID(scope), groupID)
+}
+
+func (s *DeviceGroupService) List(scope inter.Scope, page, size int) ([]inter.DeviceGroup, int, error) {
+	return s.dataStore.ListDeviceGroups(scopeTenantID(scope), page, size)
+}
+
+func (s *DeviceGroupService) Update(scope inter.Scope, groupID string, name, description *string) (inter.DeviceGroup, error) {
+	group, err := s.Get(scope, groupID)
+	if err != nil {
+		return inter.DeviceGroup{}, err
+	}
+	if name != nil {
+		if group.Name, err = normalizeGroupName(*name); err != nil {
+			return inter.DeviceGroup{}, err
+		}
+	}
+	if description != nil {
+		group.Description = *description
+	}
+	return s.dataStore.UpdateDeviceGroup(group)
+}
+
+func (s *DeviceGroupService) Delete(scope inter.Scope, groupID string) error {
+	group, err := s.Get(scope, groupID)
+	if err != nil {
+		return err
+	}
+	return s.dataStore.DeleteDeviceGroup(group.TenantID, group.ID)
+}
+
+func (s *DeviceGroupService) AddDevice(scope inter.Scope, groupID, uuid string) error {
+	group, err := s.Get(scope, groupID)
+	if err != nil {
+		return err
+	}
+	uuid = strings.TrimSpace(uuid)
+	tenantID, err := s.dataStore.ResolveDeviceTenant(uuid)
+	if err != nil {
+		return err
+	}
+	if tenantID != group.TenantID {
+		return inter.ErrDeviceTenantMismatch
+	}
+	return s.dataStore.AddGroupDevice(group.ID, uuid)
+}
+
+func (s *DeviceGroupService) RemoveDevice(scope inter.Scope, groupID, uuid string) error {
+	group, err := s.Get(scope, groupID)
+	if err != nil {
+		return err
+	}
+	return s.dataStore.RemoveGroupDevice(group.ID, uuid)
+}
+
+func (s *DeviceGroupService) ListDevices(scope inter.Scope, groupID string, page, size int) ([]inter.DeviceRecord, error) {
+	group, err := s.Get(scope, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return s.dataStore.ListGroupDevices(group.ID, page, size)
+}
+
+func normalizeGroupName(raw string) (string, error) {
+	name := strings.TrimSpace(raw)
+	if name == "" {
+		return "", fmt.Errorf("%w: name is required", inter.ErrDeviceGroupInvalid)
+	}
+	if utf8.RuneCountInString(name) > maxGroupNameLength {
+		return "", fmt.Errorf("%w: name exceeds %d characters", inter.ErrDeviceGroupInvalid, maxGroupNameLength)
+	}
+	return name, nil
+}
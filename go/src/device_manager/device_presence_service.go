@@ -1,30 +1,76 @@
 package device_manager
 
 import (
+	"context"
 	"errors"
 	"strings"
+	"sync"
 	"time"
 
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
 	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
 )
 
+// DevicePresenceHooks 描述设备在线状态变化时需要触发的运行时副作用。
+type DevicePresenceHooks struct {
+	// OnOnline 在设备由离线（或从未上线）转为在线时调用。
+	OnOnline func(uuid string)
+	// OnOffline 在设备被显式标记离线或心跳超时被扫描为离线时调用。
+	OnOffline func(uuid string)
+}
+
+// deviceConnectivityStore 是连通性历史依赖的最小仓储组合。
+type deviceConnectivityStore interface {
+	inter.DeviceConnectivityRepository
+	ResolveDeviceTenant(uuid string) (string, error)
+}
+
+// presenceState 是服务记录的最近一次连通性结论，用来识别切换并去重。
+type presenceState struct {
+	online    bool
+	offlineAt time.Time // 显式离线时间；收到新的心跳或上线信号前一直视为离线
+}
+
 // DevicePresenceService 负责设备心跳与在线状态判定。
 type DevicePresenceService struct {
 	store    inter.DevicePresenceStore
 	deadline time.Duration
+	hooks    DevicePresenceHooks
+
+	mu     sync.Mutex
+	states map[string]*presenceState
+
+	history             deviceConnectivityStore
+	sweepInterval       time.Duration
+	historyDefaultLimit int
+	historyMaxLimit     int
+	now                 func() time.Time
 }
 
 // NewDevicePresenceWithStore 创建设备在线状态服务。
 func NewDevicePresenceWithStore(deadline time.Duration, store inter.DevicePresenceStore) *DevicePresenceService {
+	return NewDevicePresenceWithHooks(deadline, store, DevicePresenceHooks{})
+}
+
+// NewDevicePresenceWithHooks 创建带状态变化钩子的设备在线状态服务。
+func NewDevicePresenceWithHooks(deadline time.Duration, store inter.DevicePresenceStore, hooks DevicePresenceHooks) *DevicePresenceService {
 	if store == nil {
 		store = NewInMemoryDevicePresenceStore()
 	}
 	if deadline <= 0 {
 		deadline = 60 * time.Second
 	}
+	base := appcfg.DefaultDeviceManagerConfig()
 	return &DevicePresenceService{
-		store:    store,
-		deadline: deadline,
+		store:               store,
+		deadline:            deadline,
+		hooks:               hooks,
+		states:              make(map[string]*presenceState),
+		sweepInterval:       base.PresenceSweepInterval,
+		historyDefaultLimit: base.ConnectivityHistoryLimit.Default,
+		historyMaxLimit:     base.ConnectivityHistoryLimit.Max,
+		now:                 time.Now,
 	}
 }
 
@@ -35,6 +81,15 @@ func (s *DevicePresenceService) SetDeadline(deadline time.Duration) {
 	}
 }
 
+// SetConnectivityHistory 启用连通性历史落库，并按配置设置扫描间隔与查询上限。
+func (s *DevicePresenceService) SetConnectivityHistory(history deviceConnectivityStore, cfg appcfg.DeviceManagerConfig) {
+	n := appcfg.NormalizeDeviceManagerConfig(cfg)
+	s.history = history
+	s.sweepInterval = n.PresenceSweepInterval
+	s.historyDefaultLimit = n.ConnectivityHistoryLimit.Default
+	s.historyMaxLimit = n.ConnectivityHistoryLimit.Max
+}
+
 // RemoveDevice 清理设备在运行时在线状态中的残留记录。
 // 设备被删除后，装配层可以通过它同步清理内存态或共享态的在线信息。
 func (s *DevicePresenceService) RemoveDevice(uuid string) {
@@ -43,11 +98,21 @@ func (s *DevicePresenceService) RemoveDevice(uuid string) {
 
 // HandleHeartbeat 记录最新心跳时间。
 func (s *DevicePresenceService) HandleHeartbeat(uuid string) {
+	s.markOnline(strings.TrimSpace(uuid), "heartbeat")
+}
+
+// ReportAvailability 处理显式的上线/离线信号。离线信号会立即生效，不必等待心跳超时。
+func (s *DevicePresenceService) ReportAvailability(uuid string, online bool, reason string) {
 	uuid = strings.TrimSpace(uuid)
-	if uuid == "" {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		reason = "availability"
+	}
+	if online {
+		s.markOnline(uuid, reason)
 		return
 	}
-	s.store.SaveLastSeen(uuid, time.Now())
+	s.markOffline(uuid, reason)
 }
 
 // QueryDeviceStatus 根据最近一次心跳时间计算设备逻辑在线状态。
@@ -61,17 +126,181 @@ func (s *DevicePresenceService) QueryDeviceStatus(uuid string) (inter.DeviceStat
 	if !ok {
 		return inter.StatusOffline, errors.New("设备从未上线")
 	}
+	if s.explicitlyOffline(uuid) {
+		return inter.StatusOffline, nil
+	}
+	return s.statusAt(lastSeen, s.now()), nil
+}
+
+// QueryConnectivityHistory 查询设备的在线/离线切换历史；未启用历史落库时返回空列表。
+func (s *DevicePresenceService) QueryConnectivityHistory(scope inter.Scope, uuid string, query inter.DeviceConnectivityQuery) ([]inter.DeviceConnectivityEvent, error) {
+	if s.history == nil {
+		return []inter.DeviceConnectivityEvent{}, nil
+	}
+	tenantID := strings.TrimSpace(scope.TenantID)
+	if tenantID == "" {
+		resolved, err := s.history.ResolveDeviceTenant(uuid)
+		if err != nil {
+			return nil, err
+		}
+		tenantID = resolved
+	}
+	if query.Limit <= 0 {
+		query.Limit = s.historyDefaultLimit
+	}
+	if query.Limit > s.historyMaxLimit {
+		query.Limit = s.historyMaxLimit
+	}
+	return s.history.QueryDeviceConnectivityByTenant(tenantID, uuid, query)
+}
+
+// Run 按扫描间隔检查心跳超时的设备，把仍记为在线的设备切换为离线。
+func (s *DevicePresenceService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
+
+// Sweep 执行一次心跳超时扫描，返回本次被判定离线的设备。
+func (s *DevicePresenceService) Sweep() []string {
+	now := s.now()
+	s.mu.Lock()
+	candidates := make([]string, 0)
+	for uuid, state := range s.states {
+		if state.online {
+			candidates = append(candidates, uuid)
+		}
+	}
+	s.mu.Unlock()
+
+	expired := make([]string, 0)
+	for _, uuid := range candidates {
+		lastSeen, ok := s.store.LoadLastSeen(uuid)
+		if ok && s.statusAt(lastSeen, now) != inter.StatusOffline {
+			continue
+		}
+		at := now
+		if ok {
+			at = lastSeen.Add(2 * s.deadline)
+		}
+		if s.transition(uuid, false, "heartbeat_timeout", at, time.Time{}) {
+			expired = append(expired, uuid)
+		}
+	}
+	return expired
+}
+
+func (s *DevicePresenceService) markOnline(uuid, reason string) {
+	if uuid == "" {
+		return
+	}
+	now := s.now()
+	wasOffline := true
+	if lastSeen, ok := s.store.LoadLastSeen(uuid); ok {
+		wasOffline = now.Sub(lastSeen) >= 2*s.deadline
+		// 心跳中断期间扫描器尚未运行时，先补记超时离线，保证历史中的切换成对出现。
+		if wasOffline && s.recordedOnline(uuid) {
+			s.transition(uuid, false, "heartbeat_timeout", lastSeen.Add(2*s.deadline), time.Time{})
+		}
+	}
+	if s.explicitlyOffline(uuid) {
+		wasOffline = true
+	}
+	s.store.SaveLastSeen(uuid, now)
+	s.transition(uuid, true, reason, now, time.Time{})
+	if wasOffline && s.hooks.OnOnline != nil {
+		s.hooks.OnOnline(uuid)
+	}
+}
+
+func (s *DevicePresenceService) markOffline(uuid, reason string) {
+	if uuid == "" {
+		return
+	}
+	now := s.now()
+	s.transition(uuid, false, reason, now, now)
+}
+
+// transition 更新记录的连通状态；只有状态真正变化时才写历史并触发钩子，返回是否发生切换。
+// offlineAt 非零时同时把设备标记为显式离线。
+func (s *DevicePresenceService) transition(uuid string, online bool, reason string, at, offlineAt time.Time) bool {
+	s.mu.Lock()
+	state, ok := s.states[uuid]
+	if !ok {
+		state = &presenceState{}
+		s.states[uuid] = state
+	}
+	if online {
+		state.offlineAt = time.Time{}
+	} else if !offlineAt.IsZero() {
+		state.offlineAt = offlineAt
+	}
+	// 从未记录过状态的设备默认就是离线，离线信号不算切换。
+	changed := state.online != online
+	if !ok {
+		changed = online
+	}
+	state.online = online
+	s.mu.Unlock()
+
+	if !changed {
+		return false
+	}
+	if s.history != nil {
+		status := inter.ConnectivityOffline
+		if online {
+			status = inter.ConnectivityOnline
+		}
+		if err := s.history.AppendDeviceConnectivityEvent(inter.DeviceConnectivityEvent{
+			UUID:      uuid,
+			Status:    status,
+			Reason:    reason,
+			Timestamp: at.UnixMilli(),
+		}); err != nil {
+			logger.Default().With(inter.String("module", "device_manager")).Warn("写入设备连通性历史失败", inter.String("uuid", uuid), inter.String("status", string(status)), inter.Err(err))
+		}
+	}
+	if !online && s.hooks.OnOffline != nil {
+		s.hooks.OnOffline(uuid)
+	}
+	return true
+}
+
+func (s *DevicePresenceService) recordedOnline(uuid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[uuid]
+	return ok && state.online
+}
+
+func (s *DevicePresenceService) explicitlyOffline(uuid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[uuid]
+	return ok && !state.offlineAt.IsZero()
+}
 
-	delta := time.Since(lastSeen)
+func (s *DevicePresenceService) statusAt(lastSeen, now time.Time) inter.DeviceStatus {
+	delta := now.Sub(lastSeen)
 	if delta < s.deadline {
-		return inter.StatusOnline, nil
+		return inter.StatusOnline
 	}
 	if delta < 2*s.deadline {
-		return inter.StatusDelayed, nil
+		return inter.StatusDelayed
 	}
-	return inter.StatusOffline, nil
+	return inter.StatusOffline
 }
 
 func (s *DevicePresenceService) delete(uuid string) {
 	s.store.Delete(uuid)
+	s.mu.Lock()
+	delete(s.states, strings.TrimSpace(uuid))
+	s.mu.Unlock()
 }
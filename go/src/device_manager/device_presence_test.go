@@ -1,9 +1,11 @@
 package device_manager
 
 import (
+	"strings"
 	"testing"
 	"time"
 
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
 	"github.com/nhirsama/Goster-IoT/src/inter"
 )
 
@@ -45,3 +47,128 @@ func TestInMemoryDevicePresenceStoreDelete(t *testing.T) {
 		t.Fatal("expected heartbeat to be removed after delete")
 	}
 }
+
+func TestDevicePresenceServiceFiresOnOnlineAfterOffline(t *testing.T) {
+	var online []string
+	service := NewDevicePresenceWithHooks(20*time.Millisecond, NewInMemoryDevicePresenceStore(), DevicePresenceHooks{
+		OnOnline: func(uuid string) { online = append(online, uuid) },
+	})
+
+	service.HandleHeartbeat("dev-1")
+	service.HandleHeartbeat("dev-1")
+	if len(online) != 1 {
+		t.Fatalf("expected one online transition for consecutive heartbeats, got %v", online)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	service.HandleHeartbeat("dev-1")
+	if len(online) != 2 {
+		t.Fatalf("expected online transition after going offline, got %v", online)
+	}
+}
+
+type fakeConnectivityStore struct {
+	events []inter.DeviceConnectivityEvent
+}
+
+func (f *fakeConnectivityStore) AppendDeviceConnectivityEvent(event inter.DeviceConnectivityEvent) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeConnectivityStore) QueryDeviceConnectivityByTenant(tenantID, uuid string, query inter.DeviceConnectivityQuery) ([]inter.DeviceConnectivityEvent, error) {
+	return f.events, nil
+}
+
+func (f *fakeConnectivityStore) ResolveDeviceTenant(uuid string) (string, error) {
+	return inter.DefaultTenantID, nil
+}
+
+func (f *fakeConnectivityStore) transitions() []string {
+	out := make([]string, 0, len(f.events))
+	for _, event := range f.events {
+		out = append(out, string(event.Status)+":"+event.Reason)
+	}
+	return out
+}
+
+func TestDevicePresenceServiceAvailabilityAndSweep(t *testing.T) {
+	history := &fakeConnectivityStore{}
+	var offline []string
+	service := NewDevicePresenceWithHooks(time.Minute, NewInMemoryDevicePresenceStore(), DevicePresenceHooks{
+		OnOffline: func(uuid string) { offline = append(offline, uuid) },
+	})
+	service.SetConnectivityHistory(history, appcfg.DefaultDeviceManagerConfig())
+	now := time.Unix(1700000000, 0)
+	service.now = func() time.Time { return now }
+
+	service.HandleHeartbeat("dev-1")
+	service.HandleHeartbeat("dev-1")
+	service.ReportAvailability("dev-1", false, "mqtt_disconnect")
+	if status, err := service.QueryDeviceStatus("dev-1"); err != nil || status != inter.StatusOffline {
+		t.Fatalf("explicit offline should take effect immediately, got status=%v err=%v", status, err)
+	}
+	service.ReportAvailability("dev-1", false, "mqtt_disconnect")
+	service.ReportAvailability("dev-1", true, "")
+	if status, _ := service.QueryDeviceStatus("dev-1"); status != inter.StatusOnline {
+		t.Fatalf("expected online after availability online, got %v", status)
+	}
+
+	now = now.Add(90 * time.Second)
+	if expired := service.Sweep(); len(expired) != 0 {
+		t.Fatalf("delayed device must not be swept, got %v", expired)
+	}
+	now = now.Add(time.Minute)
+	if expired := service.Sweep(); len(expired) != 1 || expired[0] != "dev-1" {
+		t.Fatalf("expected dev-1 to expire, got %v", expired)
+	}
+	if expired := service.Sweep(); len(expired) != 0 {
+		t.Fatalf("expired device must only be reported once, got %v", expired)
+	}
+
+	want := "online:heartbeat,offline:mqtt_disconnect,online:availability,offline:heartbeat_timeout"
+	if got := strings.Join(history.transitions(), ","); got != want {
+		t.Fatalf("unexpected transitions: %s", got)
+	}
+	if last := history.events[len(history.events)-1]; last.Timestamp != now.Add(-30*time.Second).UnixMilli() {
+		t.Fatalf("timeout should be recorded at the heartbeat deadline, got %d", last.Timestamp)
+	}
+	if len(offline) != 2 {
+		t.Fatalf("expected OnOffline for disconnect and timeout, got %v", offline)
+	}
+}
+
+func TestDevicePresenceServiceBackfillsTimeoutBeforeSweep(t *testing.T) {
+	history := &fakeConnectivityStore{}
+	service := NewDevicePresenceWithStore(time.Minute, NewInMemoryDevicePresenceStore())
+	service.SetConnectivityHistory(history, appcfg.DefaultDeviceManagerConfig())
+	now := time.Unix(1700000000, 0)
+	service.now = func() time.Time { return now }
+
+	service.HandleHeartbeat("dev-1")
+	now = now.Add(5 * time.Minute)
+	service.HandleHeartbeat("dev-1")
+
+	want := "online:heartbeat,offline:heartbeat_timeout,online:heartbeat"
+	if got := strings.Join(history.transitions(), ","); got != want {
+		t.Fatalf("unexpected transitions: %s", got)
+	}
+}
+
+func TestDevicePresenceServiceIgnoresOfflineForUnseenDevice(t *testing.T) {
+	history := &fakeConnectivityStore{}
+	var offline []string
+	service := NewDevicePresenceWithHooks(time.Minute, NewInMemoryDevicePresenceStore(), DevicePresenceHooks{
+		OnOffline: func(uuid string) { offline = append(offline, uuid) },
+	})
+	service.SetConnectivityHistory(history, appcfg.DefaultDeviceManagerConfig())
+
+	service.ReportAvailability("dev-1", false, "mqtt_disconnect")
+	if len(history.events) != 0 || len(offline) != 0 {
+		t.Fatalf("offline report for unseen device should be ignored, events=%v offline=%v", history.events, offline)
+	}
+	service.ReportAvailability("dev-1", true, "")
+	if got := strings.Join(history.transitions(), ","); got != "online:availability" {
+		t.Fatalf("unexpected transitions: %s", got)
+	}
+}
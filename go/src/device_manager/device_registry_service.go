@@ -49,6 +49,7 @@ func (s *DeviceRegistryService) RegisterDevice(meta inter.DeviceMetadata) error
 	uuid := s.GenerateUUID(meta)
 	meta.AuthenticateStatus = inter.AuthenticatePending
 	meta.Token = ""
+	meta.Identities = deviceIdentities(meta)
 	return s.dataStore.InitDevice(uuid, meta)
 }
 
@@ -66,6 +67,7 @@ func (s *DeviceRegistryService) ProvisionDevice(scope inter.Scope, meta inter.De
 
 	meta.AuthenticateStatus = inter.Authenticated
 	meta.Token = s.generateSecureToken()
+	meta.Identities = deviceIdentities(meta)
 	if err := s.dataStore.InitDeviceInTenant(tenantID, uuid, meta); err != nil {
 		return "", "", err
 	}
@@ -189,6 +191,85 @@ func (s *DeviceRegistryService) GetDeviceMetadataByScope(scope inter.Scope, uuid
 	return s.dataStore.LoadConfigByTenant(scope.TenantID, uuid)
 }
 
+func (s *DeviceRegistryService) ResolveDevice(identities []inter.DeviceIdentity) (string, error) {
+	normalized := NormalizeDeviceIdentities(identities)
+	if len(normalized) == 0 {
+		return "", inter.ErrDeviceNotFound
+	}
+	return s.dataStore.ResolveDeviceIdentities(normalized)
+}
+
+func (s *DeviceRegistryService) RefreshDevice(uuid string, meta inter.DeviceMetadata) error {
+	if err := s.dataStore.SaveDescriptor(uuid, meta); err != nil {
+		return err
+	}
+	return s.dataStore.BindDeviceIdentities(uuid, deviceIdentities(meta))
+}
+
+func (s *DeviceRegistryService) BindIdentities(uuid string, identities []inter.DeviceIdentity) error {
+	return s.dataStore.BindDeviceIdentities(uuid, NormalizeDeviceIdentities(identities))
+}
+
+func (s *DeviceRegistryService) UpdateCapabilities(uuid string, capabilities []inter.DeviceCapability) error {
+	if len(capabilities) == 0 {
+		return nil
+	}
+	return s.dataStore.SaveDeviceCapabilities(uuid, capabilities)
+}
+
+// deviceIdentities 合并基础字段中的序列号、MAC 与显式上报的身份。
+func deviceIdentities(meta inter.DeviceMetadata) []inter.DeviceIdentity {
+	items := append([]inter.DeviceIdentity{
+		{Type: inter.DeviceIdentitySerial, Value: meta.SerialNumber},
+		{Type: inter.DeviceIdentityMAC, Value: meta.MACAddress},
+	}, meta.Identities...)
+	return NormalizeDeviceIdentities(items)
+}
+
+// NormalizeDeviceIdentities 把 adapter 上报的身份类型归一为可登记的类型并去重，
+// uuid、token 等不可登记的类型会被丢弃。MAC 去掉分隔符并转小写，IEEE 地址转小写。
+func NormalizeDeviceIdentities(items []inter.DeviceIdentity) []inter.DeviceIdentity {
+	out := make([]inter.DeviceIdentity, 0, len(items))
+	seen := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		typ := canonicalIdentityType(item.Type)
+		value := strings.TrimSpace(item.Value)
+		switch typ {
+		case "":
+			continue
+		case inter.DeviceIdentityMAC:
+			value = strings.ToLower(strings.NewReplacer(":", "", "-", "", ".", "").Replace(value))
+		case inter.DeviceIdentityIEEEAddress:
+			value = strings.ToLower(value)
+		}
+		if value == "" {
+			continue
+		}
+		key := typ + "\x00" + value
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		out = append(out, inter.DeviceIdentity{Type: typ, Value: value, Issuer: strings.TrimSpace(item.Issuer)})
+	}
+	return out
+}
+
+func canonicalIdentityType(raw string) string {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "sn", "serial", "serial_number":
+		return inter.DeviceIdentitySerial
+	case "mac", "mac_address":
+		return inter.DeviceIdentityMAC
+	case "ieee_address", "ieee", "ieee_addr", "zigbee_ieee_address":
+		return inter.DeviceIdentityIEEEAddress
+	case "client_id", "mqtt_client_id":
+		return inter.DeviceIdentityClientID
+	default:
+		return ""
+	}
+}
+
 func (s *DeviceRegistryService) generateSecureToken() string {
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
@@ -1,6 +1,7 @@
 package device_manager
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -216,3 +217,51 @@ func TestDeviceRegistryDeleteClearsPresenceState(t *testing.T) {
 		t.Fatalf("presence should be cleared after delete: status=%v err=%v", status, err)
 	}
 }
+
+func TestDeviceRegistryResolvesNormalizedIdentities(t *testing.T) {
+	store := openRuntimeStoreForDeviceRegistry(t)
+	registry := NewDeviceRegistry(store)
+
+	meta := inter.DeviceMetadata{
+		Name:         "zigbee-bulb",
+		SerialNumber: "sn-z1",
+		MACAddress:   "AA:BB:CC:DD:EE:FF",
+		Identities: []inter.DeviceIdentity{
+			{Type: "ieee", Value: "0x00124B0001"},
+			{Type: "uuid", Value: "ignored"},
+		},
+	}
+	if err := registry.RegisterDevice(meta); err != nil {
+		t.Fatalf("RegisterDevice failed: %v", err)
+	}
+	uuid := registry.GenerateUUID(meta)
+
+	for _, identity := range []inter.DeviceIdentity{
+		{Type: "mac_address", Value: "aa-bb-cc-dd-ee-ff"},
+		{Type: "serial_number", Value: " sn-z1 "},
+		{Type: "ieee_address", Value: "0x00124b0001"},
+	} {
+		got, err := registry.ResolveDevice([]inter.DeviceIdentity{identity})
+		if err != nil || got != uuid {
+			t.Fatalf("ResolveDevice(%+v) = %q, %v; want %q", identity, got, err, uuid)
+		}
+	}
+	if _, err := registry.ResolveDevice([]inter.DeviceIdentity{{Type: "uuid", Value: uuid}}); !errors.Is(err, inter.ErrDeviceNotFound) {
+		t.Fatalf("uuid identity should not be resolvable, got %v", err)
+	}
+
+	if err := registry.RefreshDevice(uuid, inter.DeviceMetadata{
+		SWVersion:  "2.0.0",
+		Descriptor: inter.DeviceDescriptor{Manufacturer: "IKEA", DeviceType: "router"},
+		Identities: []inter.DeviceIdentity{{Type: "mqtt_client_id", Value: "bulb-1"}},
+	}); err != nil {
+		t.Fatalf("RefreshDevice failed: %v", err)
+	}
+	loaded, err := registry.GetDeviceMetadata(uuid)
+	if err != nil {
+		t.Fatalf("GetDeviceMetadata failed: %v", err)
+	}
+	if loaded.SWVersion != "2.0.0" || loaded.Descriptor.DeviceType != "router" || loaded.AuthenticateStatus != inter.AuthenticatePending || len(loaded.Identities) != 4 {
+		t.Fatalf("unexpected refreshed device: %+v", loaded)
+	}
+}
@@ -0,0 +1,270 @@
+package device_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// shadowSaveAttempts 是合并 desired 或 reported 遇到版本冲突时的最大重试次数。
+const shadowSaveAttempts = 3
+
+// deviceShadowStore 是设备影子服务依赖的最小仓储组合。
+type deviceShadowStore interface {
+	inter.DeviceShadowRepository
+	ResolveDeviceTenant(uuid string) (string, error)
+}
+
+// DeviceShadowService 负责影子文档的合并、delta 计算以及对账下发。
+type DeviceShadowService struct {
+	dataStore inter.DeviceShadowRepository
+	tenants   interface {
+		ResolveDeviceTenant(uuid string) (string, error)
+	}
+	downlink inter.DownlinkCommandService
+	presence inter.DevicePresence
+}
+
+// NewDeviceShadowService 创建设备影子服务。
+// presence 用于判断 desired 更新后是否需要立即下发，可以为 nil。
+func NewDeviceShadowService(ds deviceShadowStore, downlink inter.DownlinkCommandService, presence inter.DevicePresence) inter.DeviceShadowService {
+	return &DeviceShadowService{
+		dataStore: ds,
+		tenants:   ds,
+		downlink:  downlink,
+		presence:  presence,
+	}
+}
+
+func (s *DeviceShadowService) GetShadow(scope inter.Scope, uuid string) (inter.DeviceShadow, error) {
+	tenantID, err := s.resolveTenant(scope, uuid)
+	if err != nil {
+		return inter.DeviceShadow{}, err
+	}
+	shadow, err := s.load(tenantID, uuid)
+	if err != nil {
+		return inter.DeviceShadow{}, err
+	}
+	return withShadowDelta(shadow), nil
+}
+
+func (s *DeviceShadowService) UpdateDesired(scope inter.Scope, uuid string, patch map[string]interface{}, expectedVersion *int64) (inter.DeviceShadow, error) {
+	tenantID, err := s.resolveTenant(scope, uuid)
+	if err != nil {
+		return inter.DeviceShadow{}, err
+	}
+	var saved inter.DeviceShadow
+	for attempt := 1; ; attempt++ {
+		current, err := s.load(tenantID, uuid)
+		if err != nil {
+			return inter.DeviceShadow{}, err
+		}
+		if expectedVersion != nil && *expectedVersion != current.Version {
+			return inter.DeviceShadow{}, inter.ErrDeviceShadowConflict
+		}
+
+		desired, err := mergeShadowDocument(current.Desired, patch)
+		if err != nil {
+			return inter.DeviceShadow{}, err
+		}
+		if sameShadowDocument(desired, current.Desired) {
+			return withShadowDelta(current), nil
+		}
+		next := current
+		next.Desired = desired
+		next.DesiredUpdatedAt = time.Now().UnixMilli()
+		saved, err = s.dataStore.SaveDeviceShadow(next, current.Version)
+		if err == nil {
+			break
+		}
+		// 调用方没有指定版本时，并发写入（包括同时首次创建影子）造成的冲突按最新内容重新合并。
+		if expectedVersion != nil || !errors.Is(err, inter.ErrDeviceShadowConflict) || attempt >= shadowSaveAttempts {
+			return inter.DeviceShadow{}, err
+		}
+	}
+	saved = withShadowDelta(saved)
+
+	if len(saved.Delta) > 0 && s.isOnline(uuid) {
+		if err := s.push(saved); err != nil {
+			return inter.DeviceShadow{}, err
+		}
+	}
+	return saved, nil
+}
+
+func (s *DeviceShadowService) ReportState(uuid string, reported map[string]interface{}, observedAt int64) error {
+	uuid = strings.TrimSpace(uuid)
+	if uuid == "" {
+		return errors.New("uuid is required")
+	}
+	if len(reported) == 0 {
+		return nil
+	}
+	if observedAt <= 0 {
+		observedAt = time.Now().UnixMilli()
+	}
+
+	tenantID, err := s.tenants.ResolveDeviceTenant(uuid)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < shadowSaveAttempts; attempt++ {
+		current, err := s.load(tenantID, uuid)
+		if err != nil {
+			return err
+		}
+		merged, err := mergeShadowDocument(current.Reported, reported)
+		if err != nil {
+			return err
+		}
+		if sameShadowDocument(merged, current.Reported) {
+			return nil
+		}
+		next := current
+		next.Reported = merged
+		next.ReportedUpdatedAt = observedAt
+		_, err = s.dataStore.SaveDeviceShadowReported(next, current.ReportedVersion)
+		if !errors.Is(err, inter.ErrDeviceShadowConflict) {
+			return err
+		}
+	}
+	return inter.ErrDeviceShadowConflict
+}
+
+// Reconcile 在设备重新上线时由在线状态钩子调用，delta 为空时不产生下行命令。
+func (s *DeviceShadowService) Reconcile(uuid string) error {
+	shadow, err := s.dataStore.GetDeviceShadow(strings.TrimSpace(uuid))
+	if err != nil {
+		if errors.Is(err, inter.ErrDeviceShadowNotFound) {
+			return nil
+		}
+		return err
+	}
+	shadow = withShadowDelta(shadow)
+	if len(shadow.Delta) == 0 {
+		return nil
+	}
+	return s.push(shadow)
+}
+
+// shadowPushKeyPrefix 是影子下发指令的替换键前缀，与配置服务的下发互不替换。
+const shadowPushKeyPrefix = "shadow:"
+
+func (s *DeviceShadowService) push(shadow inter.DeviceShadow) error {
+	if s.downlink == nil {
+		return nil
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"version": shadow.Version,
+		"state":   shadow.Delta,
+	})
+	if err != nil {
+		return err
+	}
+	// 每次推送都携带完整 delta，新的推送替换设备上尚未发出的旧推送。
+	_, err = s.downlink.EnqueueWithPolicy(inter.Scope{TenantID: shadow.TenantID}, shadow.UUID, inter.CmdConfigPush, "config_push", payload, inter.DeviceCommandPolicy{
+		Key:       shadowPushKeyPrefix + shadow.UUID,
+		Supersede: true,
+	})
+	return err
+}
+
+func (s *DeviceShadowService) load(tenantID, uuid string) (inter.DeviceShadow, error) {
+	shadow, err := s.dataStore.GetDeviceShadowByTenant(tenantID, uuid)
+	if errors.Is(err, inter.ErrDeviceShadowNotFound) {
+		return inter.DeviceShadow{UUID: uuid, TenantID: tenantID}, nil
+	}
+	return shadow, err
+}
+
+func (s *DeviceShadowService) resolveTenant(scope inter.Scope, uuid string) (string, error) {
+	if tenantID := strings.TrimSpace(scope.TenantID); tenantID != "" {
+		return tenantID, nil
+	}
+	return s.tenants.ResolveDeviceTenant(uuid)
+}
+
+func (s *DeviceShadowService) isOnline(uuid string) bool {
+	if s.presence == nil {
+		return false
+	}
+	status, err := s.presence.QueryDeviceStatus(uuid)
+	return err == nil && status == inter.StatusOnline
+}
+
+func withShadowDelta(shadow inter.DeviceShadow) inter.DeviceShadow {
+	if shadow.Desired == nil {
+		shadow.Desired = map[string]interface{}{}
+	}
+	if shadow.Reported == nil {
+		shadow.Reported = map[string]interface{}{}
+	}
+	shadow.Delta = shadowDelta(shadow.Desired, shadow.Reported)
+	return shadow
+}
+
+// mergeShadowDocument 按 JSON Merge Patch (RFC 7386) 合并文档，值为 null 的键会被删除。
+// 结果经过一次 JSON 往返，保证数值类型与持久化后读回的一致。
+func mergeShadowDocument(base, patch map[string]interface{}) (map[string]interface{}, error) {
+	merged := mergeShadowMaps(base, patch)
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func mergeShadowMaps(base, patch map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base)+len(patch))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			existing, _ := out[k].(map[string]interface{})
+			out[k] = mergeShadowMaps(existing, sub)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func sameShadowDocument(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// shadowDelta 返回 desired 中与 reported 不一致的键，嵌套对象逐层比较。
+func shadowDelta(desired, reported map[string]interface{}) map[string]interface{} {
+	delta := map[string]interface{}{}
+	for k, want := range desired {
+		got, ok := reported[k]
+		wantMap, wantIsMap := want.(map[string]interface{})
+		gotMap, gotIsMap := got.(map[string]interface{})
+		if wantIsMap && gotIsMap {
+			if sub := shadowDelta(wantMap, gotMap); len(sub) > 0 {
+				delta[k] = sub
+			}
+			continue
+		}
+		if !ok || !reflect.DeepEqual(want, got) {
+			delta[k] = want
+		}
+	}
+	return delta
+}
@@ -0,0 +1,186 @@
+package device_manager
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+func TestDeviceShadowServiceDeltaAndReconcile(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "shadow.db")
+	ds, err := persistence.OpenSQLite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+
+	uuid := "device-shadow"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               "Device Shadow",
+		SerialNumber:       "sn-shadow",
+		MACAddress:         "mac-shadow",
+		Token:              "tk-shadow",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+
+	queue := NewDeviceCommandQueue(8)
+	var shadows inter.DeviceShadowService
+	presence := NewDevicePresenceWithHooks(time.Minute, NewInMemoryDevicePresenceStore(), DevicePresenceHooks{
+		OnOnline: func(uuid string) { _ = shadows.Reconcile(uuid) },
+	})
+	shadows = NewDeviceShadowService(ds, NewDownlinkCommandService(ds, queue), presence)
+
+	empty, err := shadows.GetShadow(inter.Scope{}, uuid)
+	if err != nil {
+		t.Fatalf("get empty shadow failed: %v", err)
+	}
+	if empty.Version != 0 || len(empty.Delta) != 0 {
+		t.Fatalf("unexpected empty shadow: %+v", empty)
+	}
+
+	// 设备离线时更新 desired 只落库，不下发。
+	zero := int64(0)
+	updated, err := shadows.UpdateDesired(inter.Scope{}, uuid, map[string]interface{}{
+		"interval": 30,
+		"led":      map[string]interface{}{"on": true, "level": 80},
+	}, &zero)
+	if err != nil {
+		t.Fatalf("update desired failed: %v", err)
+	}
+	if updated.Version != 1 || len(updated.Delta) != 2 {
+		t.Fatalf("unexpected shadow after desired update: %+v", updated)
+	}
+	if !queue.IsEmpty(uuid) {
+		t.Fatal("offline device should not receive config push")
+	}
+
+	if _, err := shadows.UpdateDesired(inter.Scope{}, uuid, map[string]interface{}{"interval": 60}, &zero); !errors.Is(err, inter.ErrDeviceShadowConflict) {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+
+	if err := shadows.ReportState(uuid, map[string]interface{}{
+		"interval": 30,
+		"led":      map[string]interface{}{"on": true, "level": 20},
+	}, time.Now().UnixMilli()); err != nil {
+		t.Fatalf("report state failed: %v", err)
+	}
+	// 设备上报不递增 desired 版本，管理端仍可按原版本号提交 PATCH。
+	one := int64(1)
+	if reported, err := shadows.GetShadow(inter.Scope{}, uuid); err != nil || reported.Version != 1 || reported.ReportedVersion != 1 {
+		t.Fatalf("unexpected versions after report: %+v err=%v", reported, err)
+	}
+	if _, err := shadows.UpdateDesired(inter.Scope{}, uuid, map[string]interface{}{"interval": 30}, &one); err != nil {
+		t.Fatalf("desired update after report should not conflict: %v", err)
+	}
+
+	presence.HandleHeartbeat(uuid)
+	msg, ok, err := queue.Dequeue(uuid)
+	if err != nil || !ok {
+		t.Fatalf("expected config push after device comes online, ok=%v err=%v", ok, err)
+	}
+	if msg.CmdID != inter.CmdConfigPush {
+		t.Fatalf("unexpected reconcile command: %+v", msg)
+	}
+	var payload struct {
+		Version int64                  `json:"version"`
+		State   map[string]interface{} `json:"state"`
+	}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		t.Fatalf("decode config push payload failed: %v", err)
+	}
+	led, _ := payload.State["led"].(map[string]interface{})
+	if payload.Version != 1 || len(payload.State) != 1 || led["level"] != float64(80) || len(led) != 1 {
+		t.Fatalf("unexpected config push payload: %s", msg.Payload)
+	}
+
+	// 设备在线时更新 desired 会立即下发；删除键使用 null。
+	if _, err := shadows.UpdateDesired(inter.Scope{}, uuid, map[string]interface{}{"led": nil, "mode": "eco"}, nil); err != nil {
+		t.Fatalf("update desired while online failed: %v", err)
+	}
+	msg, ok, err = queue.Dequeue(uuid)
+	if err != nil || !ok || msg.CmdID != inter.CmdConfigPush {
+		t.Fatalf("expected immediate config push for online device, ok=%v err=%v msg=%+v", ok, err, msg)
+	}
+	current, err := shadows.GetShadow(inter.Scope{}, uuid)
+	if err != nil {
+		t.Fatalf("get shadow failed: %v", err)
+	}
+	if _, exists := current.Desired["led"]; exists || current.Delta["mode"] != "eco" {
+		t.Fatalf("unexpected shadow after merge patch: %+v", current)
+	}
+
+	// 尚未发出的推送被下一次推送替换，队列里只保留最新的 delta。
+	for _, mode := range []string{"boost", "quiet"} {
+		if _, err := shadows.UpdateDesired(inter.Scope{}, uuid, map[string]interface{}{"mode": mode}, nil); err != nil {
+			t.Fatalf("update desired failed: %v", err)
+		}
+	}
+	msg, ok, err = queue.Dequeue(uuid)
+	if err != nil || !ok || !strings.Contains(string(msg.Payload), `"quiet"`) {
+		t.Fatalf("expected latest config push, ok=%v err=%v msg=%s", ok, err, msg.Payload)
+	}
+	if !queue.IsEmpty(uuid) {
+		t.Fatal("superseded config push should leave the queue")
+	}
+}
+
+// racingShadowStore 在第一次保存 desired 之前抢先创建影子，模拟并发的首次写入。
+type racingShadowStore struct {
+	*persistence.Store
+	raced bool
+}
+
+func (s *racingShadowStore) SaveDeviceShadow(shadow inter.DeviceShadow, expectedVersion int64) (inter.DeviceShadow, error) {
+	if !s.raced {
+		s.raced = true
+		other := shadow
+		other.Desired = map[string]interface{}{"interval": 60}
+		if _, err := s.Store.SaveDeviceShadow(other, expectedVersion); err != nil {
+			return inter.DeviceShadow{}, err
+		}
+	}
+	return s.Store.SaveDeviceShadow(shadow, expectedVersion)
+}
+
+func TestDeviceShadowServiceRetriesConcurrentCreate(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "shadow_race.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	for _, uuid := range []string{"shadow-race", "shadow-race-versioned"} {
+		if err := ds.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+			t.Fatalf("failed to init device: %v", err)
+		}
+	}
+	store := &racingShadowStore{Store: ds}
+	shadows := NewDeviceShadowService(store, NewDownlinkCommandService(ds, NewDeviceCommandQueue(8)), nil)
+
+	// 未指定版本的更新与并发创建冲突后按最新内容重新合并。
+	updated, err := shadows.UpdateDesired(inter.Scope{}, "shadow-race", map[string]interface{}{"led": true}, nil)
+	if err != nil {
+		t.Fatalf("update desired failed: %v", err)
+	}
+	if updated.Version != 2 || updated.Desired["led"] != true || updated.Desired["interval"] == nil {
+		t.Fatalf("expected patch merged onto concurrent shadow, got %+v", updated)
+	}
+
+	// 指定了版本的更新把冲突交还给调用方。
+	store.raced = false
+	zero := int64(0)
+	if _, err := shadows.UpdateDesired(inter.Scope{}, "shadow-race-versioned", map[string]interface{}{"led": true}, &zero); !errors.Is(err, inter.ErrDeviceShadowConflict) {
+		t.Fatalf("expected ErrDeviceShadowConflict, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package device_manager
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// deviceStateStore 是设备状态服务依赖的最小仓储组合。
+type deviceStateStore interface {
+	inter.DeviceStateRepository
+	ResolveDeviceTenant(uuid string) (string, error)
+}
+
+// DeviceStateService 负责设备状态点的归一化、落库与查询。
+type DeviceStateService struct {
+	dataStore           deviceStateStore
+	historyDefaultLimit int
+	historyMaxLimit     int
+}
+
+// NewDeviceStateService 创建设备状态服务。
+func NewDeviceStateService(ds deviceStateStore, cfg appcfg.DeviceManagerConfig) inter.DeviceStateService {
+	n := appcfg.NormalizeDeviceManagerConfig(cfg)
+	return &DeviceStateService{
+		dataStore:           ds,
+		historyDefaultLimit: n.StateHistoryLimit.Default,
+		historyMaxLimit:     n.StateHistoryLimit.Max,
+	}
+}
+
+func (s *DeviceStateService) IngestStates(uuid string, states []inter.DeviceState) error {
+	uuid = strings.TrimSpace(uuid)
+	if uuid == "" {
+		return errors.New("uuid is required")
+	}
+	if len(states) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	normalized := make([]inter.DeviceState, 0, len(states))
+	for _, item := range states {
+		item.UUID = uuid
+		item.Name = strings.TrimSpace(item.Name)
+		item.EntityID = strings.TrimSpace(item.EntityID)
+		if item.Name == "" {
+			return errors.New("state name is required")
+		}
+		if item.Timestamp <= 0 {
+			item.Timestamp = now
+		}
+		item.ValueType = deviceStateValueType(item)
+		normalized = append(normalized, item)
+	}
+	return s.dataStore.UpsertDeviceStates(uuid, normalized)
+}
+
+func (s *DeviceStateService) ListStates(scope inter.Scope, uuid string) ([]inter.DeviceState, error) {
+	tenantID, err := s.resolveTenant(scope, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return s.dataStore.ListDeviceStatesByTenant(tenantID, uuid)
+}
+
+func (s *DeviceStateService) QueryStateHistory(scope inter.Scope, uuid string, query inter.DeviceStateHistoryQuery) ([]inter.DeviceState, error) {
+	tenantID, err := s.resolveTenant(scope, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if query.Limit <= 0 {
+		query.Limit = s.historyDefaultLimit
+	}
+	if query.Limit > s.historyMaxLimit {
+		query.Limit = s.historyMaxLimit
+	}
+	return s.dataStore.QueryDeviceStateHistoryByTenant(tenantID, uuid, query)
+}
+
+func (s *DeviceStateService) resolveTenant(scope inter.Scope, uuid string) (string, error) {
+	if tenantID := strings.TrimSpace(scope.TenantID); tenantID != "" {
+		return tenantID, nil
+	}
+	return s.dataStore.ResolveDeviceTenant(uuid)
+}
+
+// deviceStateValueType 以实际携带的值为准推断值类型，忽略调用方传入的声明。
+func deviceStateValueType(item inter.DeviceState) string {
+	switch {
+	case item.ValueNum != nil:
+		return "number"
+	case item.ValueBool != nil:
+		return "bool"
+	case len(item.ValueJSON) > 0:
+		return "json"
+	default:
+		return "string"
+	}
+}
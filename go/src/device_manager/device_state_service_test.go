@@ -0,0 +1,91 @@
+package device_manager
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+func TestDeviceStateServiceKeepsLatestAndHistory(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "state.db")
+	ds, err := persistence.OpenSQLite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+
+	uuid := "device-state"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               "Device State",
+		SerialNumber:       "sn-state",
+		MACAddress:         "mac-state",
+		Token:              "tk-state",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+
+	service := NewDeviceStateService(ds, appcfg.DefaultDeviceManagerConfig())
+	base := time.Now().Add(-time.Minute).UnixMilli()
+	on, off := true, false
+	temp := 21.5
+	steps := [][]inter.DeviceState{
+		{{Name: " switch ", EntityID: "relay_1", ValueType: "string", ValueBool: &on, Timestamp: base}},
+		// 值未变化只刷新时间戳，不追加历史。
+		{{Name: "switch", EntityID: "relay_1", ValueBool: &on, Timestamp: base + 1000}},
+		{{Name: "switch", EntityID: "relay_1", ValueBool: &off, Timestamp: base + 2000}},
+		// 乱序的旧值不能覆盖最新值。
+		{{Name: "switch", EntityID: "relay_1", ValueBool: &on, Timestamp: base + 1500}},
+		{{Name: "temperature", ValueNum: &temp, Unit: "C", Timestamp: base + 2000}},
+	}
+	for _, step := range steps {
+		if err := service.IngestStates(uuid, step); err != nil {
+			t.Fatalf("ingest states failed: %v", err)
+		}
+	}
+
+	latest, err := service.ListStates(inter.Scope{}, uuid)
+	if err != nil {
+		t.Fatalf("list states failed: %v", err)
+	}
+	if len(latest) != 2 {
+		t.Fatalf("unexpected state count: got %d want 2", len(latest))
+	}
+	sw := latest[0]
+	if sw.Name != "switch" || sw.ValueType != "bool" || sw.ValueBool == nil || *sw.ValueBool {
+		t.Fatalf("unexpected latest switch state: %+v", sw)
+	}
+	if sw.Timestamp != base+2000 {
+		t.Fatalf("unexpected latest switch ts: got %d want %d", sw.Timestamp, base+2000)
+	}
+	if latest[1].ValueType != "number" || latest[1].ValueNum == nil || *latest[1].ValueNum != temp {
+		t.Fatalf("unexpected latest temperature state: %+v", latest[1])
+	}
+
+	history, err := service.QueryStateHistory(inter.Scope{TenantID: "tenant_legacy"}, uuid, inter.DeviceStateHistoryQuery{
+		Name:     "switch",
+		EntityID: "relay_1",
+		Start:    base - 1,
+		End:      base + 5000,
+	})
+	if err != nil {
+		t.Fatalf("query state history failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("unexpected history count: got %d want 2", len(history))
+	}
+
+	other, err := service.ListStates(inter.Scope{TenantID: "tenant_other"}, uuid)
+	if err != nil {
+		t.Fatalf("list states in other tenant failed: %v", err)
+	}
+	if len(other) != 0 {
+		t.Fatalf("expected no states outside device tenant, got %d", len(other))
+	}
+}
@@ -0,0 +1,216 @@
+package device_manager
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// maxTopologyDepth 限制沿上级回溯的层数，防止脏数据形成的环导致死循环。
+const maxTopologyDepth = 16
+
+// deviceTopologyStore 是拓扑服务依赖的最小仓储组合。
+type deviceTopologyStore interface {
+	inter.DeviceTopologyRepository
+	ResolveDeviceTenant(uuid string) (string, error)
+}
+
+// DeviceTopologyService 维护网关与子设备的挂载关系。
+// 子设备不一定在设备表中注册（例如 Zigbee 终端），网关快照中的子设备跟随网关租户。
+type DeviceTopologyService struct {
+	dataStore deviceTopologyStore
+}
+
+// NewDeviceTopologyService 创建设备拓扑服务。
+func NewDeviceTopologyService(ds deviceTopologyStore) *DeviceTopologyService {
+	return &DeviceTopologyService{dataStore: ds}
+}
+
+// ApplyTopology 以网关快照替换其子设备；已注册的子设备与网关的上级都必须与网关同租户，否则整份快照被拒绝。
+func (s *DeviceTopologyService) ApplyTopology(gateway inter.DeviceTopologyNode, children []inter.DeviceTopologyNode) error {
+	gateway.UUID = strings.TrimSpace(gateway.UUID)
+	if gateway.UUID == "" {
+		return errors.New("gateway uuid is required")
+	}
+	tenantID, err := s.resolveTenant(gateway.UUID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	gateway.ParentUUID = strings.TrimSpace(gateway.ParentUUID)
+	if gateway.ParentUUID != "" {
+		if err := s.checkParentTenant(tenantID, gateway.ParentUUID); err != nil {
+			return err
+		}
+		if err := s.checkCycle(tenantID, gateway.UUID, gateway.ParentUUID); err != nil {
+			return err
+		}
+	}
+	gateway.UpdatedAt = now
+	if err := s.dataStore.UpsertDeviceTopologyNode(tenantID, gateway); err != nil {
+		return err
+	}
+
+	items := make([]inter.DeviceTopologyNode, 0, len(children))
+	seen := make(map[string]struct{}, len(children))
+	for _, child := range children {
+		child.UUID = strings.TrimSpace(child.UUID)
+		if child.UUID == "" || child.UUID == gateway.UUID {
+			continue
+		}
+		if _, ok := seen[child.UUID]; ok {
+			continue
+		}
+		if err := s.checkChildTenant(tenantID, child.UUID); err != nil {
+			return err
+		}
+		if err := s.checkCycle(tenantID, child.UUID, gateway.UUID); err != nil {
+			return err
+		}
+		seen[child.UUID] = struct{}{}
+		child.UpdatedAt = now
+		items = append(items, child)
+	}
+	return s.dataStore.ReplaceDeviceChildren(tenantID, gateway.UUID, items)
+}
+
+// ReportParent 记录设备声明的上级；租户取自设备本身，上级必须属于同一租户。
+func (s *DeviceTopologyService) ReportParent(node inter.DeviceTopologyNode) error {
+	node.UUID = strings.TrimSpace(node.UUID)
+	node.ParentUUID = strings.TrimSpace(node.ParentUUID)
+	if node.UUID == "" || node.ParentUUID == "" {
+		return errors.New("uuid and parent uuid are required")
+	}
+	tenantID, err := s.resolveTenant(node.UUID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkParentTenant(tenantID, node.ParentUUID); err != nil {
+		return err
+	}
+	if err := s.checkCycle(tenantID, node.UUID, node.ParentUUID); err != nil {
+		return err
+	}
+	node.UpdatedAt = time.Now().UnixMilli()
+	return s.dataStore.UpsertDeviceTopologyNode(tenantID, node)
+}
+
+func (s *DeviceTopologyService) ListChildren(scope inter.Scope, uuid string) ([]inter.DeviceTopologyNode, error) {
+	return s.dataStore.ListDeviceChildren(s.scopeTenant(scope, uuid), strings.TrimSpace(uuid))
+}
+
+func (s *DeviceTopologyService) PathToCloud(scope inter.Scope, uuid string) ([]inter.DeviceTopologyNode, error) {
+	uuid = strings.TrimSpace(uuid)
+	tenantID := s.scopeTenant(scope, uuid)
+	path := make([]inter.DeviceTopologyNode, 0, 2)
+	current := uuid
+	for depth := 0; current != "" && depth < maxTopologyDepth; depth++ {
+		node, err := s.dataStore.GetDeviceTopologyNode(tenantID, current)
+		if errors.Is(err, inter.ErrDeviceTopologyNotFound) {
+			// 未出现在拓扑中的设备视为直连云端。
+			node = inter.DeviceTopologyNode{UUID: current}
+		} else if err != nil {
+			return nil, err
+		}
+		path = append(path, node)
+		current = node.ParentUUID
+	}
+	return path, nil
+}
+
+func (s *DeviceTopologyService) ChildUUIDs(uuid string) ([]string, error) {
+	uuid = strings.TrimSpace(uuid)
+	children, err := s.dataStore.ListDeviceChildren(s.tenantOf(uuid), uuid)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(children))
+	for _, child := range children {
+		out = append(out, child.UUID)
+	}
+	return out, nil
+}
+
+// checkParentTenant 确认上级属于 tenantID：已注册的上级按设备表比对，未注册的上级（如 Zigbee 路由）必须已在该租户的拓扑中。
+func (s *DeviceTopologyService) checkParentTenant(tenantID, parentUUID string) error {
+	parentTenant, err := s.dataStore.ResolveDeviceTenant(parentUUID)
+	if err == nil {
+		if parentTenant != tenantID {
+			return inter.ErrDeviceTopologyTenant
+		}
+		return nil
+	}
+	if !errors.Is(err, inter.ErrDeviceNotFound) {
+		return err
+	}
+	if _, err := s.dataStore.GetDeviceTopologyNode(tenantID, parentUUID); err != nil {
+		if errors.Is(err, inter.ErrDeviceTopologyNotFound) {
+			return inter.ErrDeviceTopologyTenant
+		}
+		return err
+	}
+	return nil
+}
+
+// checkChildTenant 确认已注册的子设备属于 tenantID；未注册的子设备（如 Zigbee 终端）跟随网关租户。
+func (s *DeviceTopologyService) checkChildTenant(tenantID, childUUID string) error {
+	childTenant, err := s.dataStore.ResolveDeviceTenant(childUUID)
+	switch {
+	case errors.Is(err, inter.ErrDeviceNotFound):
+		return nil
+	case err != nil:
+		return err
+	case childTenant != tenantID:
+		return inter.ErrDeviceTopologyTenant
+	}
+	return nil
+}
+
+// checkCycle 检查把 uuid 挂到 parentUUID 下是否会让 uuid 成为自己的祖先。
+func (s *DeviceTopologyService) checkCycle(tenantID, uuid, parentUUID string) error {
+	current := strings.TrimSpace(parentUUID)
+	for depth := 0; current != "" && depth < maxTopologyDepth; depth++ {
+		if current == uuid {
+			return inter.ErrDeviceTopologyCycle
+		}
+		node, err := s.dataStore.GetDeviceTopologyNode(tenantID, current)
+		if errors.Is(err, inter.ErrDeviceTopologyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		current = node.ParentUUID
+	}
+	return nil
+}
+
+func (s *DeviceTopologyService) scopeTenant(scope inter.Scope, uuid string) string {
+	if tenantID := strings.TrimSpace(scope.TenantID); tenantID != "" {
+		return tenantID
+	}
+	return s.tenantOf(uuid)
+}
+
+// resolveTenant 解析写入拓扑时的设备租户，解析失败直接返回错误，不回落到默认租户。
+func (s *DeviceTopologyService) resolveTenant(uuid string) (string, error) {
+	tenantID, err := s.dataStore.ResolveDeviceTenant(uuid)
+	if err != nil {
+		return "", err
+	}
+	if tenantID = strings.TrimSpace(tenantID); tenantID == "" {
+		return "", inter.ErrDeviceNotFound
+	}
+	return tenantID, nil
+}
+
+// tenantOf 解析只读查询使用的设备租户，未注册的设备回落到默认租户。
+func (s *DeviceTopologyService) tenantOf(uuid string) string {
+	tenantID, err := s.dataStore.ResolveDeviceTenant(uuid)
+	if err != nil || strings.TrimSpace(tenantID) == "" {
+		return inter.DefaultTenantID
+	}
+	return tenantID
+}
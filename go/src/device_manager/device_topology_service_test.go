@@ -0,0 +1,120 @@
+package device_manager
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+func TestDeviceTopologyServicePathAndCycles(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "topology.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	if err := ds.InitDevice("gw-root", inter.DeviceMetadata{Name: "Gateway", SerialNumber: "sn-gw-root", MACAddress: "mac-gw-root", Token: "tk-gw-root"}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+
+	if err := ds.InitDevice("sensor-1", inter.DeviceMetadata{Name: "Sensor", SerialNumber: "sn-sensor-1", MACAddress: "mac-sensor-1", Token: "tk-sensor-1"}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+
+	service := NewDeviceTopologyService(ds)
+	if err := service.ApplyTopology(inter.DeviceTopologyNode{UUID: "gw-root", DeviceType: "gateway"}, []inter.DeviceTopologyNode{
+		{UUID: "router-1", DeviceType: "router"},
+		{UUID: "router-1"},
+		{UUID: "gw-root"},
+	}); err != nil {
+		t.Fatalf("ApplyTopology failed: %v", err)
+	}
+	if err := service.ReportParent(inter.DeviceTopologyNode{UUID: "sensor-1", ParentUUID: "router-1", DeviceType: "enddevice"}); err != nil {
+		t.Fatalf("ReportParent failed: %v", err)
+	}
+
+	path, err := service.PathToCloud(inter.Scope{}, "sensor-1")
+	if err != nil {
+		t.Fatalf("PathToCloud failed: %v", err)
+	}
+	got := make([]string, 0, len(path))
+	for _, node := range path {
+		got = append(got, node.UUID)
+	}
+	if len(got) != 3 || got[0] != "sensor-1" || got[1] != "router-1" || got[2] != "gw-root" {
+		t.Fatalf("unexpected path: %v", got)
+	}
+
+	children, err := service.ChildUUIDs("gw-root")
+	if err != nil || len(children) != 1 || children[0] != "router-1" {
+		t.Fatalf("unexpected children: %v err=%v", children, err)
+	}
+
+	if err := service.ReportParent(inter.DeviceTopologyNode{UUID: "gw-root", ParentUUID: "sensor-1"}); !errors.Is(err, inter.ErrDeviceTopologyCycle) {
+		t.Fatalf("expected cycle to be rejected, got %v", err)
+	}
+	if path, err := service.PathToCloud(inter.Scope{}, "unknown"); err != nil || len(path) != 1 || path[0].UUID != "unknown" {
+		t.Fatalf("expected unknown device to be its own path, got %v err=%v", path, err)
+	}
+}
+
+// tenantOverrideStore 让测试可以把设备放进不同租户。
+type tenantOverrideStore struct {
+	deviceTopologyStore
+	tenants map[string]string
+}
+
+func (s tenantOverrideStore) ResolveDeviceTenant(uuid string) (string, error) {
+	if tenantID, ok := s.tenants[uuid]; ok {
+		return tenantID, nil
+	}
+	return s.deviceTopologyStore.ResolveDeviceTenant(uuid)
+}
+
+func TestDeviceTopologyServiceReportParentTenant(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "topology_tenant.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	service := NewDeviceTopologyService(tenantOverrideStore{
+		deviceTopologyStore: ds,
+		tenants:             map[string]string{"gw-a": "tenant_a", "gw-b": "tenant_b", "dev-a": "tenant_a"},
+	})
+
+	if err := service.ReportParent(inter.DeviceTopologyNode{UUID: "unknown", ParentUUID: "gw-a"}); !errors.Is(err, inter.ErrDeviceNotFound) {
+		t.Fatalf("unregistered child should be rejected, got %v", err)
+	}
+	if err := service.ReportParent(inter.DeviceTopologyNode{UUID: "dev-a", ParentUUID: "gw-b"}); !errors.Is(err, inter.ErrDeviceTopologyTenant) {
+		t.Fatalf("parent in another tenant should be rejected, got %v", err)
+	}
+	if err := service.ReportParent(inter.DeviceTopologyNode{UUID: "dev-a", ParentUUID: "router-x"}); !errors.Is(err, inter.ErrDeviceTopologyTenant) {
+		t.Fatalf("unknown parent should be rejected, got %v", err)
+	}
+	if err := service.ReportParent(inter.DeviceTopologyNode{UUID: "dev-a", ParentUUID: "gw-a"}); err != nil {
+		t.Fatalf("ReportParent failed: %v", err)
+	}
+	if children, err := service.ChildUUIDs("gw-b"); err != nil || len(children) != 0 {
+		t.Fatalf("other tenant gateway should have no children: %v err=%v", children, err)
+	}
+
+	// 网关快照不能挂载其他租户的设备，也不能把网关挂到其他租户的上级下。
+	if err := service.ApplyTopology(inter.DeviceTopologyNode{UUID: "gw-b"}, []inter.DeviceTopologyNode{{UUID: "zigbee-end"}, {UUID: "dev-a"}}); !errors.Is(err, inter.ErrDeviceTopologyTenant) {
+		t.Fatalf("child in another tenant should be rejected, got %v", err)
+	}
+	if children, err := service.ChildUUIDs("gw-b"); err != nil || len(children) != 0 {
+		t.Fatalf("rejected snapshot should not be applied: %v err=%v", children, err)
+	}
+	if err := service.ApplyTopology(inter.DeviceTopologyNode{UUID: "gw-b", ParentUUID: "gw-a"}, nil); !errors.Is(err, inter.ErrDeviceTopologyTenant) {
+		t.Fatalf("gateway parent in another tenant should be rejected, got %v", err)
+	}
+	if err := service.ApplyTopology(inter.DeviceTopologyNode{UUID: "gw-b"}, []inter.DeviceTopologyNode{{UUID: "zigbee-end"}}); err != nil {
+		t.Fatalf("unregistered child should follow gateway tenant: %v", err)
+	}
+}
@@ -1,70 +1,239 @@
 package device_manager
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"time"
 
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
 	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
 )
 
+// downlinkReapBatch 是单次扫描过期指令的上限，扫描会循环直到没有过期指令。
+const downlinkReapBatch = 500
+
 // DownlinkCommandService 负责下行命令的落库、入队和状态推进。
 type DownlinkCommandService struct {
-	dataStore inter.DeviceCommandRepository
-	queue     inter.DeviceCommandQueue
+	dataStore    inter.DeviceCommandRepository
+	queue        inter.DeviceCommandQueue
+	notifier     inter.CommandNotifier
+	defaults     inter.DeviceCommandPolicy
+	reapInterval time.Duration
+	historyLimit appcfg.LimitConfig
+	now          func() time.Time
+	// renderers 按命令编号把落库的载荷转换为实际下发的字节，例如 OTA 数据块只保存镜像引用。
+	renderers map[inter.CmdID]func(payload []byte) ([]byte, error)
+	// capabilities 返回设备声明的能力，用于在入队前校验写入属性的命令。
+	capabilities func(uuid string) ([]inter.DeviceCapability, error)
 }
 
 // NewDownlinkCommandService 创建默认的下行命令编排服务。
 func NewDownlinkCommandService(ds inter.DeviceCommandRepository, queue inter.DeviceCommandQueue) inter.DownlinkCommandService {
+	return NewDownlinkCommandServiceWithNotifier(ds, queue, nil)
+}
+
+// NewDownlinkCommandServiceWithNotifier 创建在命令入队时通知推送流的下行命令编排服务。
+func NewDownlinkCommandServiceWithNotifier(ds inter.DeviceCommandRepository, queue inter.DeviceCommandQueue, notifier inter.CommandNotifier) inter.DownlinkCommandService {
+	return NewDownlinkCommandServiceWithConfig(ds, queue, notifier, appcfg.DefaultDeviceManagerConfig())
+}
+
+// NewDownlinkCommandServiceWithConfig 按配置的默认有效期、确认超时与重试上限创建下行命令编排服务。
+func NewDownlinkCommandServiceWithConfig(ds inter.DeviceCommandRepository, queue inter.DeviceCommandQueue, notifier inter.CommandNotifier, cfg appcfg.DeviceManagerConfig) *DownlinkCommandService {
+	n := appcfg.NormalizeDeviceManagerConfig(cfg)
 	return &DownlinkCommandService{
 		dataStore: ds,
 		queue:     queue,
+		notifier:  notifier,
+		defaults: inter.DeviceCommandPolicy{
+			TTL:         n.CommandTTL,
+			Timeout:     n.CommandAckTimeout,
+			MaxAttempts: n.CommandMaxAttempts,
+		},
+		reapInterval: n.CommandReapInterval,
+		historyLimit: n.CommandHistoryLimit,
+		now:          time.Now,
+	}
+}
+
+// SetPayloadRenderer 注册出队时的载荷转换；转换失败的命令标记为 failed 并跳过。
+// 应在服务开始处理请求前调用。
+func (s *DownlinkCommandService) SetPayloadRenderer(cmdID inter.CmdID, render func(payload []byte) ([]byte, error)) {
+	if s.renderers == nil {
+		s.renderers = make(map[inter.CmdID]func(payload []byte) ([]byte, error))
 	}
+	s.renderers[cmdID] = render
+}
+
+// SetCapabilityLookup 注册设备能力查询；未注册时入队不做能力校验。
+// 应在服务开始处理请求前调用。
+func (s *DownlinkCommandService) SetCapabilityLookup(lookup func(uuid string) ([]inter.DeviceCapability, error)) {
+	s.capabilities = lookup
 }
 
 // Enqueue 创建命令记录并把下行消息推入设备队列。
 func (s *DownlinkCommandService) Enqueue(scope inter.Scope, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte) (inter.DownlinkMessage, error) {
-	commandID, err := s.dataStore.CreateDeviceCommandByTenant(scope.TenantID, uuid, cmdID, command, payloadJSON)
+	return s.EnqueueWithPolicy(scope, uuid, cmdID, command, payloadJSON, inter.DeviceCommandPolicy{})
+}
+
+// EnqueueWithPolicy 创建带有效期与重试限制的命令记录并推入设备队列。
+// policy.Supersede 为 true 时先取消同名同键的未发送命令，再把新命令入队。
+func (s *DownlinkCommandService) EnqueueWithPolicy(scope inter.Scope, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte, policy inter.DeviceCommandPolicy) (inter.DownlinkMessage, error) {
+	if err := s.checkCapabilities(uuid, cmdID, payloadJSON); err != nil {
+		return inter.DownlinkMessage{}, err
+	}
+	policy = s.resolvePolicy(policy)
+	commandID, err := s.dataStore.CreateDeviceCommandWithPolicy(scope.TenantID, uuid, cmdID, command, payloadJSON, policy)
 	if err != nil {
 		return inter.DownlinkMessage{}, err
 	}
+	if policy.Supersede {
+		superseded, err := s.dataStore.SupersedeDeviceCommands(uuid, command, policy.Key, commandID)
+		if err != nil {
+			_ = s.MarkFailed(commandID, err.Error())
+			return inter.DownlinkMessage{}, err
+		}
+		for _, id := range superseded {
+			if err := s.queue.Remove(uuid, id); err != nil {
+				return inter.DownlinkMessage{}, err
+			}
+		}
+	}
 
+	now := s.now().UTC()
 	msg := inter.DownlinkMessage{
-		CommandID: commandID,
-		CmdID:     cmdID,
-		Payload:   payloadJSON,
+		CommandID:   commandID,
+		CmdID:       cmdID,
+		Payload:     payloadJSON,
+		Timeout:     policy.Timeout,
+		MaxAttempts: policy.MaxAttempts,
+		CreatedAt:   now,
+	}
+	if policy.TTL > 0 {
+		msg.ExpiresAt = now.Add(policy.TTL)
 	}
 	if err := s.queue.Enqueue(uuid, msg); err != nil {
 		_ = s.MarkFailed(commandID, err.Error())
 		return inter.DownlinkMessage{}, err
 	}
+	s.notify(uuid)
 	return msg, nil
 }
 
-// PopDownlink 从设备队列中获取待发送命令。
+func (s *DownlinkCommandService) checkCapabilities(uuid string, cmdID inter.CmdID, payload []byte) error {
+	if s.capabilities == nil {
+		return nil
+	}
+	capabilities, err := s.capabilities(uuid)
+	if err != nil {
+		return err
+	}
+	return ValidateCommandCapabilities(capabilities, cmdID, payload)
+}
+
+// PopDownlink 从设备队列中获取待发送命令，已过有效期的命令会被标记为 expired 并跳过。
 func (s *DownlinkCommandService) PopDownlink(uuid string) (inter.DownlinkMessage, bool, error) {
-	return s.queue.Dequeue(uuid)
+	for {
+		msg, ok, err := s.queue.Dequeue(uuid)
+		if err != nil || !ok {
+			return msg, ok, err
+		}
+		if msg.ExpiresAt.IsZero() || s.now().Before(msg.ExpiresAt) {
+			render, ok := s.renderers[msg.CmdID]
+			if !ok {
+				return msg, true, nil
+			}
+			payload, err := render(msg.Payload)
+			if err == nil {
+				msg.Payload = payload
+				return msg, true, nil
+			}
+			if err := ignoreFinished(s.MarkFailed(msg.CommandID, "render payload: "+err.Error())); err != nil {
+				return inter.DownlinkMessage{}, false, err
+			}
+			continue
+		}
+		if _, err := s.dataStore.TransitionDeviceCommandStatus(msg.CommandID, inter.DeviceCommandStatusQueued, inter.DeviceCommandStatusExpired, "ttl exceeded before send"); err != nil {
+			return inter.DownlinkMessage{}, false, err
+		}
+	}
 }
 
 // Requeue 把暂时发送失败的下行消息重新放回队列。
+// 已结束、已过有效期或发送次数耗尽的命令不再回队，分别保持原状态、标记 expired 或 failed。
 func (s *DownlinkCommandService) Requeue(uuid string, message inter.DownlinkMessage) error {
 	if message.CommandID <= 0 {
 		return nil
 	}
+	record, err := s.dataStore.GetDeviceCommand(message.CommandID)
+	if err != nil {
+		return err
+	}
+	switch record.Status {
+	case inter.DeviceCommandStatusAcked, inter.DeviceCommandStatusFailed, inter.DeviceCommandStatusExpired,
+		inter.DeviceCommandStatusOverflow, inter.DeviceCommandStatusCancelled:
+		return nil
+	}
+	now := s.now()
+	// 读取记录后指令可能已被确认或取消，此时保持其当前状态。
+	if record.ExpiresAt != nil && !now.Before(*record.ExpiresAt) {
+		return ignoreFinished(s.MarkExpired(message.CommandID, "ttl exceeded before send"))
+	}
+	if record.MaxAttempts > 0 && record.Attempts >= record.MaxAttempts {
+		return ignoreFinished(s.MarkFailed(message.CommandID, fmt.Sprintf("max attempts exhausted (%d)", record.MaxAttempts)))
+	}
+
+	// 回队的是渲染后的载荷，恢复为落库的原始载荷，出队时重新渲染。
+	if _, ok := s.renderers[message.CmdID]; ok {
+		message.Payload = record.Payload
+	}
+	message.Timeout = time.Duration(record.TimeoutMs) * time.Millisecond
+	message.MaxAttempts = record.MaxAttempts
+	message.CreatedAt = record.RequestedAt
+	if record.ExpiresAt != nil {
+		message.ExpiresAt = *record.ExpiresAt
+	}
 	if err := s.queue.Requeue(uuid, message); err != nil {
+		if errors.Is(err, inter.ErrDeviceCommandNotQueued) {
+			// 读取记录后指令已被取消或结束，保持其当前状态。
+			return nil
+		}
 		_ = s.MarkFailed(message.CommandID, err.Error())
 		return err
 	}
-	return s.dataStore.UpdateDeviceCommandStatus(message.CommandID, inter.DeviceCommandStatusQueued, "")
+	if _, err := s.dataStore.TransitionDeviceCommandStatus(message.CommandID, inter.DeviceCommandStatusSent, inter.DeviceCommandStatusQueued, ""); err != nil {
+		return err
+	}
+	s.notify(uuid)
+	return nil
 }
 
-// MarkSent 标记下行命令已发往设备。
+// MarkSent 标记下行命令已发往设备，累加发送次数并按命令的确认超时设置截止时间。
 func (s *DownlinkCommandService) MarkSent(commandID int64) error {
+	return s.MarkSentVia(commandID, inter.CommandDelivery{})
+}
+
+// MarkSentVia 与 MarkSent 相同，另外记录投递命令的 ingress 实例与 adapter。
+func (s *DownlinkCommandService) MarkSentVia(commandID int64, via inter.CommandDelivery) error {
 	if commandID <= 0 {
 		return nil
 	}
-	return s.dataStore.UpdateDeviceCommandStatus(commandID, inter.DeviceCommandStatusSent, "")
+	record, err := s.dataStore.GetDeviceCommand(commandID)
+	if err != nil {
+		return err
+	}
+	now := s.now().UTC()
+	var ackDeadline *time.Time
+	if record.TimeoutMs > 0 {
+		deadline := now.Add(time.Duration(record.TimeoutMs) * time.Millisecond)
+		ackDeadline = &deadline
+	}
+	return s.dataStore.MarkDeviceCommandSent(commandID, now, ackDeadline, via)
 }
 
-// MarkAcked 标记下行命令已被设备确认。
+// MarkAcked 标记下行命令已被设备确认；命令已结束时返回 ErrDeviceCommandFinished，不改写原状态。
 func (s *DownlinkCommandService) MarkAcked(commandID int64) error {
 	if commandID <= 0 {
 		return nil
@@ -72,10 +241,162 @@ func (s *DownlinkCommandService) MarkAcked(commandID int64) error {
 	return s.dataStore.UpdateDeviceCommandStatus(commandID, inter.DeviceCommandStatusAcked, "")
 }
 
-// MarkFailed 标记下行命令发送失败。
+// MarkFailed 标记下行命令发送失败；命令已结束时返回 ErrDeviceCommandFinished。
 func (s *DownlinkCommandService) MarkFailed(commandID int64, errorText string) error {
 	if commandID <= 0 {
 		return nil
 	}
 	return s.dataStore.UpdateDeviceCommandStatus(commandID, inter.DeviceCommandStatusFailed, strings.TrimSpace(errorText))
 }
+
+// MarkExpired 标记下行命令已过期；命令已结束时返回 ErrDeviceCommandFinished。
+func (s *DownlinkCommandService) MarkExpired(commandID int64, errorText string) error {
+	if commandID <= 0 {
+		return nil
+	}
+	return s.dataStore.UpdateDeviceCommandStatus(commandID, inter.DeviceCommandStatusExpired, strings.TrimSpace(errorText))
+}
+
+// RenewClaims 续期已出队、尚未标记发送的命令的领取租约。
+func (s *DownlinkCommandService) RenewClaims(commandIDs []int64) error {
+	return s.queue.Renew(commandIDs)
+}
+
+// Cancel 取消仍在排队的命令并把它移出设备队列；reason 为空时记录为用户取消。
+func (s *DownlinkCommandService) Cancel(scope inter.Scope, commandID int64, reason string) (inter.DeviceCommand, error) {
+	record, err := s.GetCommand(scope, commandID)
+	if err != nil {
+		return inter.DeviceCommand{}, err
+	}
+	if record.Status != inter.DeviceCommandStatusQueued {
+		return record, inter.ErrDeviceCommandNotQueued
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		reason = "cancelled by user"
+	}
+	cancelled, err := s.dataStore.TransitionDeviceCommandStatus(commandID, inter.DeviceCommandStatusQueued, inter.DeviceCommandStatusCancelled, reason)
+	if err != nil {
+		return inter.DeviceCommand{}, err
+	}
+	if !cancelled {
+		// 读取与取消之间命令已被发出或结束。
+		record, err = s.GetCommand(scope, commandID)
+		if err != nil {
+			return inter.DeviceCommand{}, err
+		}
+		return record, inter.ErrDeviceCommandNotQueued
+	}
+	if err := s.queue.Remove(record.UUID, commandID); err != nil {
+		return inter.DeviceCommand{}, err
+	}
+	return s.GetCommand(scope, commandID)
+}
+
+// GetCommand 在授权租户内读取单条命令。
+func (s *DownlinkCommandService) GetCommand(scope inter.Scope, commandID int64) (inter.DeviceCommand, error) {
+	if commandID <= 0 {
+		return inter.DeviceCommand{}, inter.ErrDeviceCommandNotFound
+	}
+	return s.dataStore.GetDeviceCommandByTenant(scope.TenantID, commandID)
+}
+
+func (s *DownlinkCommandService) LookupCommand(commandID int64) (inter.DeviceCommand, error) {
+	if commandID <= 0 {
+		return inter.DeviceCommand{}, inter.ErrDeviceCommandNotFound
+	}
+	return s.dataStore.GetDeviceCommand(commandID)
+}
+
+// ListCommands 在授权租户内查询设备的命令历史，条数按配置的默认值与上限收敛。
+func (s *DownlinkCommandService) ListCommands(scope inter.Scope, uuid string, query inter.DeviceCommandQuery) ([]inter.DeviceCommand, int64, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = s.historyLimit.Default
+	}
+	if limit > s.historyLimit.Max {
+		limit = s.historyLimit.Max
+	}
+	// 多取一条判断是否还有下一页。
+	query.Limit = limit + 1
+	items, err := s.dataStore.ListDeviceCommandsByTenant(scope.TenantID, uuid, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(items) <= limit {
+		return items, 0, nil
+	}
+	items = items[:limit]
+	return items, items[limit-1].ID, nil
+}
+
+// ExpireStale 把超过有效期仍未发送、以及发送后确认超时的命令标记为 expired。
+// 状态更新以命令当前状态为前提，扫描期间刚被确认或发送的命令不会被误标。
+func (s *DownlinkCommandService) ExpireStale() (int64, error) {
+	var total int64
+	for {
+		items, err := s.dataStore.ListStaleDeviceCommands(s.now(), downlinkReapBatch)
+		if err != nil {
+			return total, err
+		}
+		for _, item := range items {
+			reason := "ttl exceeded before send"
+			if item.Status == inter.DeviceCommandStatusSent {
+				reason = "ack timeout"
+			}
+			expired, err := s.dataStore.TransitionDeviceCommandStatus(item.ID, item.Status, inter.DeviceCommandStatusExpired, reason)
+			if err != nil {
+				return total, err
+			}
+			if expired {
+				total++
+			}
+		}
+		if len(items) < downlinkReapBatch {
+			return total, nil
+		}
+	}
+}
+
+// Run 按配置间隔周期清理过期命令，直到 ctx 结束。
+func (s *DownlinkCommandService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ExpireStale(); err != nil {
+				logger.Default().With(inter.String("module", "device_manager")).Warn("清理过期下行指令失败", inter.Err(err))
+			}
+		}
+	}
+}
+
+// ignoreFinished 把“指令已结束”视为成功，用于内部收尾时与确认、取消并发的场景。
+func ignoreFinished(err error) error {
+	if errors.Is(err, inter.ErrDeviceCommandFinished) {
+		return nil
+	}
+	return err
+}
+
+func (s *DownlinkCommandService) resolvePolicy(policy inter.DeviceCommandPolicy) inter.DeviceCommandPolicy {
+	if policy.TTL <= 0 {
+		policy.TTL = s.defaults.TTL
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = s.defaults.Timeout
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = s.defaults.MaxAttempts
+	}
+	return policy
+}
+
+func (s *DownlinkCommandService) notify(uuid string) {
+	if s.notifier != nil {
+		s.notifier.Notify(uuid)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"path/filepath"
 	"testing"
+	"time"
 
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
 	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/nhirsama/Goster-IoT/src/persistence"
 )
@@ -59,6 +61,16 @@ func TestDownlinkCommandServiceEnqueueAndStatusFlow(t *testing.T) {
 	if err := service.MarkAcked(msg.CommandID); err != nil {
 		t.Fatalf("mark acked failed: %v", err)
 	}
+	// 迟到的失败或过期回执不能改写已确认的指令。
+	if err := service.MarkFailed(msg.CommandID, "late"); !errors.Is(err, inter.ErrDeviceCommandFinished) {
+		t.Fatalf("expected ErrDeviceCommandFinished, got %v", err)
+	}
+	if err := service.MarkExpired(msg.CommandID, "late"); !errors.Is(err, inter.ErrDeviceCommandFinished) {
+		t.Fatalf("expected ErrDeviceCommandFinished, got %v", err)
+	}
+	if err := service.MarkAcked(msg.CommandID + 1000); !errors.Is(err, inter.ErrDeviceCommandNotFound) {
+		t.Fatalf("expected ErrDeviceCommandNotFound, got %v", err)
+	}
 }
 
 type failingQueue struct{}
@@ -71,12 +83,18 @@ func (f failingQueue) Requeue(uuid string, message inter.DownlinkMessage) error
 	return errors.New("queue failed")
 }
 
+func (f failingQueue) Remove(uuid string, commandID int64) error {
+	return nil
+}
+
 func (f failingQueue) Dequeue(uuid string) (inter.DownlinkMessage, bool, error) {
 	return inter.DownlinkMessage{}, false, nil
 }
 
 func (f failingQueue) IsEmpty(uuid string) bool { return true }
 
+func (f failingQueue) Renew(commandIDs []int64) error { return nil }
+
 func TestDownlinkCommandServiceMarkFailedAndQueueError(t *testing.T) {
 	dbPath := filepath.Join(t.TempDir(), "downlink_failed.db")
 	ds, err := persistence.OpenSQLite(dbPath)
@@ -173,3 +191,349 @@ func TestDownlinkCommandServiceRequeueRestoresQueuedStatus(t *testing.T) {
 		t.Fatalf("unexpected command status after requeue: got %s want %s", status, inter.DeviceCommandStatusQueued)
 	}
 }
+
+func TestDownlinkCommandServiceNotifiesSubscribers(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "downlink_notify.db")
+	ds, err := persistence.OpenSQLite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+
+	uuid := "device-4"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               "Device 4",
+		SerialNumber:       "sn-4",
+		MACAddress:         "mac-4",
+		Token:              "tk-4",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+
+	notifier := NewCommandNotifier()
+	sub := notifier.Subscribe([]string{uuid, "other"})
+	service := NewDownlinkCommandServiceWithNotifier(ds, NewDeviceCommandQueue(8), notifier)
+
+	if _, err := service.Enqueue(inter.Scope{}, uuid, inter.CmdActionExec, "action_exec", []byte(`{"op":"reboot"}`)); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	notifier.Notify("unrelated")
+	select {
+	case <-sub.Ready():
+	default:
+		t.Fatal("expected subscription to be signalled")
+	}
+	if keys := sub.Drain(); len(keys) != 1 || keys[0] != uuid {
+		t.Fatalf("unexpected notified keys: %v", keys)
+	}
+
+	sub.Close()
+	notifier.Notify(uuid)
+	if keys := sub.Drain(); len(keys) != 0 {
+		t.Fatalf("closed subscription should not receive keys: %v", keys)
+	}
+}
+
+func openDownlinkTestStore(t *testing.T, uuid string) *persistence.Store {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "downlink_policy.db")
+	ds, err := persistence.OpenSQLite(dbPath)
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               uuid,
+		SerialNumber:       "sn-" + uuid,
+		MACAddress:         "mac-" + uuid,
+		Token:              "tk-" + uuid,
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+	return ds
+}
+
+func TestDownlinkCommandServiceExpiresQueuedAndUnackedCommands(t *testing.T) {
+	uuid := "device-5"
+	ds := openDownlinkTestStore(t, uuid)
+	cfg := appcfg.DefaultDeviceManagerConfig()
+	cfg.CommandTTL = time.Minute
+	service := NewDownlinkCommandServiceWithConfig(ds, NewDeviceCommandQueue(8), nil, cfg)
+	now := time.Now()
+	service.now = func() time.Time { return now }
+
+	stale, err := service.Enqueue(inter.Scope{}, uuid, inter.CmdActionExec, "action_exec", []byte(`{"op":"a"}`))
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if !stale.ExpiresAt.Equal(now.UTC().Add(time.Minute)) {
+		t.Fatalf("unexpected expires_at: %v", stale.ExpiresAt)
+	}
+	acked, err := service.EnqueueWithPolicy(inter.Scope{}, uuid, inter.CmdActionExec, "action_exec", []byte(`{"op":"b"}`), inter.DeviceCommandPolicy{TTL: time.Hour, Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatalf("enqueue with policy failed: %v", err)
+	}
+
+	// 推进时间后，第一条在发送前过期，PopDownlink 跳过它直接返回第二条。
+	now = now.Add(2 * time.Minute)
+	popped, ok, err := service.PopDownlink(uuid)
+	if err != nil || !ok || popped.CommandID != acked.CommandID || popped.Timeout != 10*time.Second {
+		t.Fatalf("expected live command after skipping expired one, got %+v ok=%v err=%v", popped, ok, err)
+	}
+	if record, err := ds.GetDeviceCommand(stale.CommandID); err != nil || record.Status != inter.DeviceCommandStatusExpired {
+		t.Fatalf("expected skipped command to be expired, got %+v err=%v", record, err)
+	}
+
+	if err := service.MarkSent(acked.CommandID); err != nil {
+		t.Fatalf("mark sent failed: %v", err)
+	}
+	if n, err := service.ExpireStale(); err != nil || n != 0 {
+		t.Fatalf("command within ack timeout should not expire: n=%d err=%v", n, err)
+	}
+	now = now.Add(11 * time.Second)
+	if n, err := service.ExpireStale(); err != nil || n != 1 {
+		t.Fatalf("expected ack timeout to expire one command: n=%d err=%v", n, err)
+	}
+	record, err := ds.GetDeviceCommand(acked.CommandID)
+	if err != nil || record.Status != inter.DeviceCommandStatusExpired || record.ErrorText != "ack timeout" || record.Attempts != 1 {
+		t.Fatalf("unexpected command after ack timeout: %+v err=%v", record, err)
+	}
+
+	// 过期后的迟到回执不会把命令拉回队列。
+	if err := service.Requeue(uuid, popped); err != nil {
+		t.Fatalf("requeue of expired command failed: %v", err)
+	}
+	if _, ok, _ := service.PopDownlink(uuid); ok {
+		t.Fatal("expired command must not be requeued")
+	}
+}
+
+func TestDownlinkCommandServiceRequeueStopsAfterMaxAttempts(t *testing.T) {
+	uuid := "device-6"
+	ds := openDownlinkTestStore(t, uuid)
+	service := NewDownlinkCommandServiceWithConfig(ds, NewDeviceCommandQueue(8), nil, appcfg.DefaultDeviceManagerConfig())
+
+	msg, err := service.EnqueueWithPolicy(inter.Scope{}, uuid, inter.CmdActionExec, "action_exec", []byte(`{"op":"retry"}`), inter.DeviceCommandPolicy{MaxAttempts: 2})
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	for attempt := 1; attempt <= 2; attempt++ {
+		popped, ok, err := service.PopDownlink(uuid)
+		if err != nil || !ok {
+			t.Fatalf("attempt %d: expected queued command, ok=%v err=%v", attempt, ok, err)
+		}
+		if err := service.MarkSent(popped.CommandID); err != nil {
+			t.Fatalf("attempt %d: mark sent failed: %v", attempt, err)
+		}
+		if err := service.Requeue(uuid, popped); err != nil {
+			t.Fatalf("attempt %d: requeue failed: %v", attempt, err)
+		}
+	}
+
+	if _, ok, _ := service.PopDownlink(uuid); ok {
+		t.Fatal("command should not be requeued after max attempts")
+	}
+	record, err := ds.GetDeviceCommand(msg.CommandID)
+	if err != nil || record.Status != inter.DeviceCommandStatusFailed || record.Attempts != 2 || record.MaxAttempts != 2 {
+		t.Fatalf("unexpected command after exhausting attempts: %+v err=%v", record, err)
+	}
+}
+
+func TestDownlinkCommandServiceListCommandsPagesWithCursor(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "downlink_history.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	uuid := "history-1"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               "History",
+		Token:              "tk-history",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+
+	cfg := appcfg.DefaultDeviceManagerConfig()
+	cfg.CommandHistoryLimit = appcfg.LimitConfig{Default: 2, Max: 3}
+	service := NewDownlinkCommandServiceWithConfig(ds, NewDeviceCommandQueue(8), nil, cfg)
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		msg, err := service.Enqueue(inter.Scope{}, uuid, inter.CmdActionExec, "action_exec", []byte(`{}`))
+		if err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+		ids = append(ids, msg.CommandID)
+	}
+	if err := service.MarkSentVia(ids[4], inter.CommandDelivery{InstanceID: "ingress-1", AdapterID: "tcp"}); err != nil {
+		t.Fatalf("mark sent failed: %v", err)
+	}
+
+	page, next, err := service.ListCommands(inter.Scope{}, uuid, inter.DeviceCommandQuery{})
+	if err != nil {
+		t.Fatalf("list commands failed: %v", err)
+	}
+	if len(page) != 2 || page[0].ID != ids[4] || next != ids[3] {
+		t.Fatalf("unexpected default page: %+v next=%d", page, next)
+	}
+	if page[0].DeliveredBy.InstanceID != "ingress-1" || page[0].DeliveredBy.AdapterID != "tcp" {
+		t.Fatalf("expected delivery to be recorded, got %+v", page[0].DeliveredBy)
+	}
+
+	page, next, err = service.ListCommands(inter.Scope{}, uuid, inter.DeviceCommandQuery{BeforeID: next, Limit: 10})
+	if err != nil {
+		t.Fatalf("list commands with cursor failed: %v", err)
+	}
+	if len(page) != 3 || page[0].ID != ids[2] || next != 0 {
+		t.Fatalf("unexpected clamped page: %+v next=%d", page, next)
+	}
+
+	cmd, err := service.GetCommand(inter.Scope{}, ids[0])
+	if err != nil || cmd.ID != ids[0] {
+		t.Fatalf("get command failed: %+v %v", cmd, err)
+	}
+	if _, err := service.GetCommand(inter.Scope{TenantID: "tenant_other"}, ids[0]); !errors.Is(err, inter.ErrDeviceCommandNotFound) {
+		t.Fatalf("expected not found for other tenant, got %v", err)
+	}
+}
+
+func TestDownlinkCommandServiceCancelAndSupersede(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "downlink_cancel.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	uuid := "cancel-1"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               "Cancel",
+		Token:              "tk-cancel",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+	service := NewDownlinkCommandService(ds, NewDeviceCommandQueue(8))
+
+	wrong, err := service.Enqueue(inter.Scope{}, uuid, inter.CmdConfigPush, "config_push", []byte(`{"interval":1}`))
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	cancelled, err := service.Cancel(inter.Scope{}, wrong.CommandID, "")
+	if err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	if cancelled.Status != inter.DeviceCommandStatusCancelled || cancelled.ErrorText != "cancelled by user" || cancelled.ExecutedAt == nil {
+		t.Fatalf("unexpected cancelled command: %+v", cancelled)
+	}
+	if _, ok, _ := service.PopDownlink(uuid); ok {
+		t.Fatal("cancelled command should be removed from the queue")
+	}
+	if _, err := service.Cancel(inter.Scope{}, wrong.CommandID, ""); !errors.Is(err, inter.ErrDeviceCommandNotQueued) {
+		t.Fatalf("expected not queued on second cancel, got %v", err)
+	}
+
+	policy := inter.DeviceCommandPolicy{Key: "report", Supersede: true}
+	older, err := service.EnqueueWithPolicy(inter.Scope{}, uuid, inter.CmdConfigPush, "config_push", []byte(`{"interval":5}`), policy)
+	if err != nil {
+		t.Fatalf("enqueue older failed: %v", err)
+	}
+	other, err := service.EnqueueWithPolicy(inter.Scope{}, uuid, inter.CmdConfigPush, "config_push", []byte(`{"mode":1}`), inter.DeviceCommandPolicy{Key: "mode"})
+	if err != nil {
+		t.Fatalf("enqueue other key failed: %v", err)
+	}
+	newer, err := service.EnqueueWithPolicy(inter.Scope{}, uuid, inter.CmdConfigPush, "config_push", []byte(`{"interval":10}`), policy)
+	if err != nil {
+		t.Fatalf("enqueue newer failed: %v", err)
+	}
+	record, err := ds.GetDeviceCommand(older.CommandID)
+	if err != nil {
+		t.Fatalf("get older failed: %v", err)
+	}
+	if record.Status != inter.DeviceCommandStatusCancelled || record.Key != "report" {
+		t.Fatalf("older command should be superseded: %+v", record)
+	}
+
+	var popped []int64
+	for {
+		msg, ok, err := service.PopDownlink(uuid)
+		if err != nil {
+			t.Fatalf("pop failed: %v", err)
+		}
+		if !ok {
+			break
+		}
+		popped = append(popped, msg.CommandID)
+	}
+	if len(popped) != 2 || popped[0] != other.CommandID || popped[1] != newer.CommandID {
+		t.Fatalf("unexpected delivery order after supersede: %v", popped)
+	}
+	if err := service.MarkSent(newer.CommandID); err != nil {
+		t.Fatalf("mark sent failed: %v", err)
+	}
+	if _, err := service.Cancel(inter.Scope{}, newer.CommandID, ""); !errors.Is(err, inter.ErrDeviceCommandNotQueued) {
+		t.Fatalf("expected sent command to be non-cancellable, got %v", err)
+	}
+}
+
+func TestDownlinkCommandServiceRejectsCapabilityViolations(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "downlink_capability.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+
+	uuid := "device-cap"
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               "Bulb",
+		SerialNumber:       "sn-cap",
+		Token:              "tk-cap",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+	queue := NewDeviceCommandQueue(8)
+	service := NewDownlinkCommandServiceWithConfig(ds, queue, nil, appcfg.DefaultDeviceManagerConfig())
+	service.SetCapabilityLookup(func(string) ([]inter.DeviceCapability, error) {
+		return []inter.DeviceCapability{
+			{Property: "brightness", Type: "numeric", Writable: true, ValueMin: "0", ValueMax: "254"},
+		}, nil
+	})
+
+	cases := []struct {
+		cmdID   inter.CmdID
+		command string
+		payload string
+	}{
+		{inter.CmdActionExec, "action_exec", `{"brightness":300}`},
+		{inter.CmdActionExec, "set", `"ON"`},
+		{inter.CmdConfigPush, "config_push", `{"version":2,"state":{"brightness":-1}}`},
+	}
+	for _, tc := range cases {
+		_, err := service.EnqueueWithPolicy(inter.Scope{}, uuid, tc.cmdID, tc.command, []byte(tc.payload), inter.DeviceCommandPolicy{})
+		var violation *inter.CapabilityViolationError
+		if !errors.Is(err, inter.ErrCapabilityViolation) || !errors.As(err, &violation) || len(violation.Violations) == 0 {
+			t.Fatalf("%s %s should violate capabilities, got %v", tc.command, tc.payload, err)
+		}
+	}
+	if _, ok, err := service.PopDownlink(uuid); err != nil || ok {
+		t.Fatalf("rejected commands must not be queued, ok=%v err=%v", ok, err)
+	}
+
+	if _, err := service.EnqueueWithPolicy(inter.Scope{}, uuid, inter.CmdConfigPush, "config_push", []byte(`{"config_version":1,"config":{"interval":30}}`), inter.DeviceCommandPolicy{}); err != nil {
+		t.Fatalf("config documents should not be validated against capabilities: %v", err)
+	}
+	if _, err := service.EnqueueWithPolicy(inter.Scope{}, uuid, inter.CmdActionExec, "set", []byte(`{"brightness":128}`), inter.DeviceCommandPolicy{}); err != nil {
+		t.Fatalf("valid set should be queued: %v", err)
+	}
+}
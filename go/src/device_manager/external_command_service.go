@@ -0,0 +1,143 @@
+package device_manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+type externalCommandStore interface {
+	inter.ExternalEntityRepository
+	inter.ExternalCommandRepository
+}
+
+// externalSwitchValues 是开关类命令在 zigbee2mqtt 中对应的状态值。
+var externalSwitchValues = map[string]string{
+	"turn_on":  "ON",
+	"turn_off": "OFF",
+	"toggle":   "TOGGLE",
+}
+
+// externalWritableDomains 列出可以接收命令的外部实体域，传感器类实体只读。
+var externalWritableDomains = map[string]struct{}{
+	"switch":  {},
+	"light":   {},
+	"number":  {},
+	"select":  {},
+	"lock":    {},
+	"cover":   {},
+	"climate": {},
+}
+
+// ExternalCommandService 负责把命令写入 integration_external_commands 并交给 adapter 拉取。
+type ExternalCommandService struct {
+	dataStore externalCommandStore
+	notifier  inter.CommandNotifier
+}
+
+// NewExternalCommandService 创建外部实体命令服务。
+func NewExternalCommandService(ds externalCommandStore) inter.ExternalCommandService {
+	return NewExternalCommandServiceWithNotifier(ds, nil)
+}
+
+// NewExternalCommandServiceWithNotifier 创建外部实体命令服务，新命令写入后按来源设备通知推送流。
+func NewExternalCommandServiceWithNotifier(ds externalCommandStore, notifier inter.CommandNotifier) inter.ExternalCommandService {
+	return &ExternalCommandService{dataStore: ds, notifier: notifier}
+}
+
+func (s *ExternalCommandService) Enqueue(scope inter.Scope, source, entityID, command string, payload map[string]interface{}) (inter.ExternalCommand, error) {
+	source = strings.TrimSpace(source)
+	entityID = strings.TrimSpace(entityID)
+	command = strings.ToLower(strings.TrimSpace(command))
+	if source == "" || entityID == "" {
+		return inter.ExternalCommand{}, errors.New("source/entity_id is required")
+	}
+	if command == "" {
+		return inter.ExternalCommand{}, errors.New("command is required")
+	}
+
+	var (
+		entity inter.ExternalEntity
+		err    error
+	)
+	if tenantID := strings.TrimSpace(scope.TenantID); tenantID != "" {
+		entity, err = s.dataStore.GetExternalEntityByTenant(tenantID, source, entityID)
+	} else {
+		entity, err = s.dataStore.GetExternalEntity(source, entityID)
+	}
+	if err != nil {
+		return inter.ExternalCommand{}, err
+	}
+	if _, ok := externalWritableDomains[entity.Domain]; !ok {
+		return inter.ExternalCommand{}, fmt.Errorf("%w: %s entity is read-only", inter.ErrExternalCommandInvalid, entity.Domain)
+	}
+	body, err := externalCommandPayload(entity, command, payload)
+	if err != nil {
+		return inter.ExternalCommand{}, err
+	}
+
+	cmd, err := s.dataStore.CreateExternalCommand(inter.ExternalCommand{
+		TenantID: entity.TenantID,
+		Source:   entity.Source,
+		EntityID: entity.EntityID,
+		Command:  command,
+		Payload:  body,
+		Status:   inter.ExternalCommandStatusPending,
+	})
+	if err != nil {
+		return inter.ExternalCommand{}, err
+	}
+	if s.notifier != nil && entity.DeviceID != "" {
+		s.notifier.Notify(inter.ExternalCommandKey(entity.Source, entity.DeviceID))
+	}
+	return cmd, nil
+}
+
+func (s *ExternalCommandService) ListCommands(scope inter.Scope, source, entityID string, limit int) ([]inter.ExternalCommand, error) {
+	source = strings.TrimSpace(source)
+	entityID = strings.TrimSpace(entityID)
+	if source == "" || entityID == "" {
+		return nil, errors.New("source/entity_id is required")
+	}
+	return s.dataStore.ListExternalCommandsByTenant(strings.TrimSpace(scope.TenantID), source, entityID, limit)
+}
+
+func (s *ExternalCommandService) PullPending(tenantID, source, deviceID string, limit int) ([]inter.ExternalCommand, error) {
+	return s.dataStore.ClaimPendingExternalCommands(tenantID, source, deviceID, limit)
+}
+
+func (s *ExternalCommandService) RenewClaims(tenantID string, ids []int64) error {
+	return s.dataStore.RenewExternalCommandClaims(tenantID, ids)
+}
+
+func (s *ExternalCommandService) UpdateStatus(tenantID string, id int64, status inter.ExternalCommandStatus, errorText string) error {
+	return s.dataStore.UpdateExternalCommandStatus(tenantID, id, status, errorText)
+}
+
+// externalCommandPayload 把通用命令翻译成集成平台可直接下发的指令体。
+// 实体 ID 形如 `<device_id>.<attribute>`，开关类命令写成 {"<attribute>":"ON"}。
+func externalCommandPayload(entity inter.ExternalEntity, command string, payload map[string]interface{}) (map[string]interface{}, error) {
+	attribute := strings.TrimPrefix(entity.EntityID, entity.DeviceID+".")
+	if entity.DeviceID == "" || attribute == "" {
+		attribute = "state"
+	}
+	body := make(map[string]interface{}, len(payload)+1)
+	switch command {
+	case "turn_on", "turn_off", "toggle":
+		for k, v := range payload {
+			body[k] = v
+		}
+		body[attribute] = externalSwitchValues[command]
+	case "set":
+		value, ok := payload["value"]
+		if !ok {
+			return nil, fmt.Errorf("%w: payload.value is required", inter.ErrExternalCommandInvalid)
+		}
+		body[attribute] = value
+	default:
+		return nil, fmt.Errorf("%w: unsupported command %q", inter.ErrExternalCommandInvalid, command)
+	}
+	return body, nil
+}
@@ -61,17 +61,52 @@ func (s *ExternalEntityService) UpsertExternalEntity(entity inter.ExternalEntity
 }
 
 func (s *ExternalEntityService) ListExternalEntities(source, domain string, page, size int) ([]inter.ExternalEntity, error) {
-	if page <= 0 {
-		page = 1
+	limit, offset := s.listWindow(page, size)
+	return s.dataStore.ListExternalEntities(source, domain, limit, offset)
+}
+
+func (s *ExternalEntityService) ListExternalEntitiesByScope(scope inter.Scope, filter inter.ExternalEntityFilter, page, size int) ([]inter.ExternalEntity, error) {
+	limit, offset := s.listWindow(page, size)
+	return s.dataStore.ListExternalEntitiesByTenant(strings.TrimSpace(scope.TenantID), filter, limit, offset)
+}
+
+func (s *ExternalEntityService) GetExternalEntityByScope(scope inter.Scope, source, entityID string) (inter.ExternalEntity, error) {
+	source = strings.TrimSpace(source)
+	entityID = strings.TrimSpace(entityID)
+	if source == "" || entityID == "" {
+		return inter.ExternalEntity{}, errors.New("source/entity_id is required")
 	}
-	if size <= 0 {
-		size = s.listDefaultSize
+	if tenantID := strings.TrimSpace(scope.TenantID); tenantID != "" {
+		return s.dataStore.GetExternalEntityByTenant(tenantID, source, entityID)
 	}
-	if size > s.listMaxSize {
-		size = s.listMaxSize
+	return s.dataStore.GetExternalEntity(source, entityID)
+}
+
+func (s *ExternalEntityService) QueryExternalObservationsByScope(scope inter.Scope, source, entityID string, start, end int64, limit int) ([]inter.ExternalObservation, error) {
+	tenantID := strings.TrimSpace(scope.TenantID)
+	if tenantID == "" {
+		return s.QueryExternalObservations(source, entityID, start, end, limit)
 	}
-	offset := (page - 1) * size
-	return s.dataStore.ListExternalEntities(source, domain, size, offset)
+	source = strings.TrimSpace(source)
+	entityID = strings.TrimSpace(entityID)
+	if source == "" || entityID == "" {
+		return nil, errors.New("source/entity_id is required")
+	}
+	return s.dataStore.QueryExternalObservationsByTenant(tenantID, source, entityID, start, end, s.observationLimit(limit))
+}
+
+// LinkExternalEntity 修改外部实体的 goster_uuid；调用方负责确认目标设备属于同一租户。
+func (s *ExternalEntityService) LinkExternalEntity(scope inter.Scope, source, entityID, gosterUUID string) (inter.ExternalEntity, error) {
+	entity, err := s.GetExternalEntityByScope(scope, source, entityID)
+	if err != nil {
+		return inter.ExternalEntity{}, err
+	}
+	gosterUUID = strings.TrimSpace(gosterUUID)
+	if err := s.dataStore.UpdateExternalEntityLink(entity.TenantID, entity.Source, entity.EntityID, gosterUUID); err != nil {
+		return inter.ExternalEntity{}, err
+	}
+	entity.GosterUUID = gosterUUID
+	return entity, nil
 }
 
 func (s *ExternalEntityService) BatchAppendExternalObservations(items []inter.ExternalObservation) error {
@@ -103,13 +138,30 @@ func (s *ExternalEntityService) QueryExternalObservations(source, entityID strin
 	if source == "" || entityID == "" {
 		return nil, errors.New("source/entity_id is required")
 	}
+	return s.dataStore.QueryExternalObservations(source, entityID, start, end, s.observationLimit(limit))
+}
+
+func (s *ExternalEntityService) listWindow(page, size int) (limit, offset int) {
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = s.listDefaultSize
+	}
+	if size > s.listMaxSize {
+		size = s.listMaxSize
+	}
+	return size, (page - 1) * size
+}
+
+func (s *ExternalEntityService) observationLimit(limit int) int {
 	if limit <= 0 {
 		limit = s.observationDefaultLimit
 	}
 	if limit > s.observationMaxLimit {
 		limit = s.observationMaxLimit
 	}
-	return s.dataStore.QueryExternalObservations(source, entityID, start, end, limit)
+	return limit
 }
 
 func (s *ExternalEntityService) buildExternalObservationSignature(item inter.ExternalObservation) string {
@@ -0,0 +1,98 @@
+package device_manager
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
+)
+
+// ingestDedupeCleanupBatch 是单次删除过期记录的上限，清理会循环直到没有过期记录。
+const ingestDedupeCleanupBatch = 1000
+
+// ingestDedupeLease 是处理中占用的租约；处理方崩溃没有完成或释放时，重试在租约过期后可以接管。
+const ingestDedupeLease = 30 * time.Second
+
+// IngestDedupeService 维护事件去重台账，记录保留 ttl 后由 Run 周期清理。
+type IngestDedupeService struct {
+	dataStore       inter.IngestDedupeRepository
+	ttl             time.Duration
+	cleanupInterval time.Duration
+	now             func() time.Time
+}
+
+// NewIngestDedupeService 创建事件去重服务。
+func NewIngestDedupeService(ds inter.IngestDedupeRepository, cfg appcfg.DeviceManagerConfig) inter.IngestDedupeService {
+	n := appcfg.NormalizeDeviceManagerConfig(cfg)
+	return &IngestDedupeService{
+		dataStore:       ds,
+		ttl:             n.IngestDedupeTTL,
+		cleanupInterval: n.IngestDedupeCleanupInterval,
+		now:             time.Now,
+	}
+}
+
+func (s *IngestDedupeService) Reserve(tenantID, key, eventID, uuid string) (inter.IngestDedupeRecord, bool, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return inter.IngestDedupeRecord{}, false, errors.New("dedupe key is required")
+	}
+	now := s.now()
+	record, reserved, err := s.dataStore.ReserveIngestDedupe(inter.IngestDedupeRecord{
+		TenantID:  strings.TrimSpace(tenantID),
+		Key:       key,
+		EventID:   strings.TrimSpace(eventID),
+		UUID:      strings.TrimSpace(uuid),
+		CreatedAt: now.UnixMilli(),
+		ExpiresAt: now.Add(ingestDedupeLease).UnixMilli(),
+	})
+	if err != nil {
+		return inter.IngestDedupeRecord{}, false, err
+	}
+	return record, !reserved, nil
+}
+
+// Complete 写入处理结果，并把记录保留期从占用租约延长到完整的去重窗口。
+func (s *IngestDedupeService) Complete(record inter.IngestDedupeRecord) error {
+	now := s.now()
+	if record.CompletedAt <= 0 {
+		record.CompletedAt = now.UnixMilli()
+	}
+	record.ExpiresAt = now.Add(s.ttl).UnixMilli()
+	return s.dataStore.CompleteIngestDedupe(record)
+}
+
+func (s *IngestDedupeService) Release(tenantID, key string) error {
+	return s.dataStore.ReleaseIngestDedupe(tenantID, key)
+}
+
+func (s *IngestDedupeService) Cleanup() (int64, error) {
+	before := s.now().UnixMilli()
+	var total int64
+	for {
+		n, err := s.dataStore.DeleteExpiredIngestDedupe(before, ingestDedupeCleanupBatch)
+		total += n
+		if err != nil || n < ingestDedupeCleanupBatch {
+			return total, err
+		}
+	}
+}
+
+func (s *IngestDedupeService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Cleanup(); err != nil {
+				logger.Default().With(inter.String("module", "device_manager")).Warn("清理过期事件去重记录失败", inter.Err(err))
+			}
+		}
+	}
+}
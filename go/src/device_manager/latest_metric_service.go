@@ -0,0 +1,217 @@
+package device_manager
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// latestSeriesKey 标识一个指标序列，与存储层 LatestMetrics 的分组一致。
+type latestSeriesKey struct {
+	name     string
+	entityID string
+	typ      uint8
+}
+
+// latestDeviceEntry 是单台设备的缓存；loadedAt 为零值时只含写入后观察到的序列，读取前需要从存储补齐。
+type latestDeviceEntry struct {
+	loadedAt time.Time
+	// usedAt 是最近一次加载或观察到写入的时间，超过 ttl 没有更新的条目会被淘汰。
+	usedAt time.Time
+	series map[latestSeriesKey]inter.MetricPoint
+	// observedAt 记录序列最近一次观察到写入的时间，重新加载时保留查询开始之后才写入的序列。
+	observedAt map[latestSeriesKey]time.Time
+}
+
+// LatestMetricService 是进程内的最新值缓存。
+// 所有合并都按时间戳取较新值，存储加载与写入观察的先后顺序不影响结果。
+// 其他实例写入的指标不会被本实例观察到，设备条目加载超过 ttl 后在下次读取时重新从存储加载，
+// 重新加载以存储为准替换序列，被保留期清理掉的序列随之消失；超过 ttl 既未读取加载也未写入的条目会被淘汰。
+type LatestMetricService struct {
+	dataStore  inter.MetricsRepository
+	ttl        time.Duration
+	warmWindow time.Duration
+	warmLimit  int
+	now        func() time.Time
+
+	mu      sync.RWMutex
+	devices map[string]*latestDeviceEntry
+	// sweptAt 是上一次淘汰空闲条目的时间，每个 ttl 周期最多扫描一次。
+	sweptAt time.Time
+}
+
+// NewLatestMetricService 创建最新值缓存，未加载或已过期的设备在读取时从 ds 加载。
+func NewLatestMetricService(ds inter.MetricsRepository, cfg appcfg.DeviceManagerConfig) *LatestMetricService {
+	n := appcfg.NormalizeDeviceManagerConfig(cfg)
+	return &LatestMetricService{
+		dataStore:  ds,
+		ttl:        n.LatestMetricTTL,
+		warmWindow: n.LatestMetricWarmWindow,
+		warmLimit:  n.LatestMetricWarmLimit,
+		now:        time.Now,
+		devices:    map[string]*latestDeviceEntry{},
+	}
+}
+
+func (s *LatestMetricService) Observe(uuid string, points []inter.MetricPoint) {
+	if uuid == "" || len(points) == 0 {
+		return
+	}
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	entry := s.entry(uuid)
+	for _, point := range points {
+		// 与存储写入时的规整保持一致，缓存中的序列键才能和存储加载的结果对上。
+		point = inter.NormalizeMetricPoint(point)
+		point.Unit = strings.TrimSpace(point.Unit)
+		point.EntityID = strings.TrimSpace(point.EntityID)
+		entry.observe(point, now)
+	}
+}
+
+func (s *LatestMetricService) Latest(tenantID string, uuids []string) (map[string][]inter.MetricPoint, error) {
+	now := s.now()
+	s.mu.RLock()
+	missing := make([]string, 0)
+	for _, uuid := range uuids {
+		if entry, ok := s.devices[uuid]; !ok || !entry.fresh(now, s.ttl) {
+			missing = append(missing, uuid)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(missing) > 0 {
+		loaded, err := s.dataStore.LatestMetrics(tenantID, missing)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.sweep(now)
+		for _, uuid := range missing {
+			s.entry(uuid).load(loaded[uuid], now)
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string][]inter.MetricPoint, len(uuids))
+	for _, uuid := range uuids {
+		entry, ok := s.devices[uuid]
+		if !ok {
+			continue
+		}
+		points := make([]inter.MetricPoint, 0, len(entry.series))
+		for _, point := range entry.series {
+			points = append(points, point)
+		}
+		sort.Slice(points, func(i, j int) bool {
+			if points[i].Name != points[j].Name {
+				return points[i].Name < points[j].Name
+			}
+			return points[i].EntityID < points[j].EntityID
+		})
+		out[uuid] = points
+	}
+	return out, nil
+}
+
+// Warm 只加载 warmWindow 内上报过指标、且按最近上报时间排在前 warmLimit 台的设备，避免启动时扫描全部历史；
+// 其余设备仍在首次读取时查询存储。
+func (s *LatestMetricService) Warm() error {
+	now := s.now()
+	uuids, err := s.dataStore.RecentMetricDevices(now.Add(-s.warmWindow).UnixMilli(), s.warmLimit)
+	if err != nil || len(uuids) == 0 {
+		return err
+	}
+	loaded, err := s.dataStore.LatestMetrics("", uuids)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, uuid := range uuids {
+		s.entry(uuid).load(loaded[uuid], now)
+	}
+	return nil
+}
+
+func (s *LatestMetricService) RemoveDevice(uuid string) {
+	s.mu.Lock()
+	delete(s.devices, uuid)
+	s.mu.Unlock()
+}
+
+// entry 返回设备的缓存，不存在时创建未加载的空缓存；调用方需持有写锁。
+func (s *LatestMetricService) entry(uuid string) *latestDeviceEntry {
+	entry, ok := s.devices[uuid]
+	if !ok {
+		entry = &latestDeviceEntry{
+			series:     map[latestSeriesKey]inter.MetricPoint{},
+			observedAt: map[latestSeriesKey]time.Time{},
+		}
+		s.devices[uuid] = entry
+	}
+	return entry
+}
+
+// sweep 淘汰超过 ttl 既未加载也未观察到写入的条目，它们在下次读取时会重新从存储加载；调用方需持有写锁。
+func (s *LatestMetricService) sweep(now time.Time) {
+	if now.Sub(s.sweptAt) < s.ttl {
+		return
+	}
+	s.sweptAt = now
+	for uuid, entry := range s.devices {
+		if now.Sub(entry.usedAt) >= s.ttl {
+			delete(s.devices, uuid)
+		}
+	}
+}
+
+// fresh 判断设备是否已从存储加载且未超过 ttl。
+func (e *latestDeviceEntry) fresh(now time.Time, ttl time.Duration) bool {
+	return !e.loadedAt.IsZero() && now.Sub(e.loadedAt) < ttl
+}
+
+// load 以存储中的最新值替换缓存，只保留查询开始之后才观察到写入的序列；
+// loadedAt 取查询开始的时间，过期判断偏保守。
+func (e *latestDeviceEntry) load(points []inter.MetricPoint, loadedAt time.Time) {
+	series := make(map[latestSeriesKey]inter.MetricPoint, len(points))
+	for _, point := range points {
+		mergeLatest(series, point)
+	}
+	for key, observedAt := range e.observedAt {
+		if observedAt.Before(loadedAt) {
+			delete(e.observedAt, key)
+			continue
+		}
+		if point, ok := e.series[key]; ok {
+			mergeLatest(series, point)
+		}
+	}
+	e.series = series
+	e.loadedAt = loadedAt
+	if loadedAt.After(e.usedAt) {
+		e.usedAt = loadedAt
+	}
+}
+
+func (e *latestDeviceEntry) observe(point inter.MetricPoint, now time.Time) {
+	mergeLatest(e.series, point)
+	e.observedAt[latestSeriesKey{name: point.Name, entityID: point.EntityID, typ: point.Type}] = now
+	e.usedAt = now
+}
+
+func mergeLatest(series map[latestSeriesKey]inter.MetricPoint, point inter.MetricPoint) {
+	key := latestSeriesKey{name: point.Name, entityID: point.EntityID, typ: point.Type}
+	if current, ok := series[key]; ok && current.Timestamp > point.Timestamp {
+		return
+	}
+	series[key] = point
+}
@@ -0,0 +1,189 @@
+package device_manager
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+func TestLatestMetricServiceMergesIngestAndStorage(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "latest.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	for _, uuid := range []string{"latest-warm", "latest-lazy"} {
+		if err := ds.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+			t.Fatalf("InitDevice failed: %v", err)
+		}
+	}
+	if err := ds.BatchAppendMetrics("latest-warm", []inter.MetricPoint{
+		{Timestamp: 1000, Name: "temp", Value: 20},
+		{Timestamp: 2000, Name: "temp", Value: 21},
+	}); err != nil {
+		t.Fatalf("BatchAppendMetrics failed: %v", err)
+	}
+
+	latest := NewLatestMetricService(ds, appcfg.DeviceManagerConfig{})
+	now := time.UnixMilli(10000)
+	latest.now = func() time.Time { return now }
+	if err := latest.Warm(); err != nil {
+		t.Fatalf("Warm failed: %v", err)
+	}
+	// 预热之后直接写存储的点不会进入已加载设备的缓存，说明读取没有再回查存储。
+	if err := ds.AppendMetric("latest-warm", inter.MetricPoint{Timestamp: 2500, Name: "temp", Value: 99}); err != nil {
+		t.Fatalf("AppendMetric failed: %v", err)
+	}
+	got, err := latest.Latest("", []string{"latest-warm"})
+	if err != nil || len(got["latest-warm"]) != 1 || got["latest-warm"][0].Value != 21 {
+		t.Fatalf("expected warmed value, got %+v err=%v", got, err)
+	}
+
+	// 未加载的设备先观察到写入，读取时再与存储中的其他序列合并。
+	if err := ds.AppendMetric("latest-lazy", inter.MetricPoint{Timestamp: 5000, Name: "humidity", Value: 40}); err != nil {
+		t.Fatalf("AppendMetric failed: %v", err)
+	}
+	ingest := NewTelemetryIngestServiceWithLatest(ds, latest)
+	if err := ingest.IngestMetrics("latest-lazy", []inter.MetricPoint{
+		{Timestamp: 6000, Name: "temp", EntityID: " room-1 ", Value: 23},
+		{Timestamp: 3000, Type: 8, Value: 1},
+	}); err != nil {
+		t.Fatalf("IngestMetrics failed: %v", err)
+	}
+	latest.Observe("latest-lazy", []inter.MetricPoint{{Timestamp: 4000, Name: "temp", EntityID: "room-1", Value: 10}})
+	got, err = latest.Latest("", []string{"latest-lazy", "latest-missing"})
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	points := got["latest-lazy"]
+	if len(points) != 3 || points[0].Name != "access_signal_a" || points[1].Name != "humidity" {
+		t.Fatalf("expected merged series sorted by name, got %+v", points)
+	}
+	if points[2].EntityID != "room-1" || points[2].Value != 23 {
+		t.Fatalf("older observation must not replace newer value: %+v", points[2])
+	}
+	if len(got["latest-missing"]) != 0 {
+		t.Fatalf("expected no metrics for unknown device, got %+v", got["latest-missing"])
+	}
+
+	latest.RemoveDevice("latest-warm")
+	got, err = latest.Latest("", []string{"latest-warm"})
+	if err != nil || got["latest-warm"][0].Value != 99 {
+		t.Fatalf("expected removed device reloaded from storage, got %+v err=%v", got, err)
+	}
+
+	// 其他实例直接写入存储的点在条目过期后才可见。
+	if err := ds.AppendMetric("latest-warm", inter.MetricPoint{Timestamp: 2600, Name: "temp", Value: 7}); err != nil {
+		t.Fatalf("AppendMetric failed: %v", err)
+	}
+	got, _ = latest.Latest("", []string{"latest-warm"})
+	if got["latest-warm"][0].Value != 99 {
+		t.Fatalf("expected cached value before ttl, got %+v", got)
+	}
+	now = now.Add(latest.ttl)
+	got, err = latest.Latest("", []string{"latest-warm"})
+	if err != nil || got["latest-warm"][0].Value != 7 {
+		t.Fatalf("expected expired device reloaded from storage, got %+v err=%v", got, err)
+	}
+}
+
+func TestLatestMetricServiceWarmLoadsRecentDevicesOnly(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "latest_warm.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	now := time.UnixMilli(10 * int64(time.Hour/time.Millisecond))
+	reported := map[string]int64{
+		"warm-stale":  now.Add(-2 * time.Hour).UnixMilli(),
+		"warm-older":  now.Add(-30 * time.Minute).UnixMilli(),
+		"warm-newest": now.Add(-time.Minute).UnixMilli(),
+	}
+	for uuid, ts := range reported {
+		if err := ds.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+			t.Fatalf("InitDevice failed: %v", err)
+		}
+		if err := ds.AppendMetric(uuid, inter.MetricPoint{Timestamp: ts, Name: "temp", Value: 1}); err != nil {
+			t.Fatalf("AppendMetric failed: %v", err)
+		}
+	}
+
+	cfg := appcfg.DeviceManagerConfig{LatestMetricWarmWindow: time.Hour, LatestMetricWarmLimit: 1}
+	latest := NewLatestMetricService(ds, cfg)
+	latest.now = func() time.Time { return now }
+	if err := latest.Warm(); err != nil {
+		t.Fatalf("Warm failed: %v", err)
+	}
+	// 窗口外与超出上限的设备不预热，首次读取时再按需加载。
+	if len(latest.devices) != 1 || latest.devices["warm-newest"] == nil {
+		t.Fatalf("expected only the most recent device warmed, got %+v", latest.devices)
+	}
+	got, err := latest.Latest("", []string{"warm-stale"})
+	if err != nil || len(got["warm-stale"]) != 1 {
+		t.Fatalf("expected stale device loaded lazily, got %+v err=%v", got, err)
+	}
+}
+
+func TestLatestMetricServiceReplacesPrunedSeriesAndEvictsIdleDevices(t *testing.T) {
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "latest_evict.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	for _, uuid := range []string{"evict-pruned", "evict-idle"} {
+		if err := ds.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+			t.Fatalf("InitDevice failed: %v", err)
+		}
+	}
+	if err := ds.BatchAppendMetrics("evict-pruned", []inter.MetricPoint{
+		{Timestamp: 1000, Name: "humidity", Value: 40},
+		{Timestamp: 5000, Name: "temp", Value: 21},
+	}); err != nil {
+		t.Fatalf("BatchAppendMetrics failed: %v", err)
+	}
+
+	latest := NewLatestMetricService(ds, appcfg.DeviceManagerConfig{})
+	now := time.UnixMilli(10000)
+	latest.now = func() time.Time { return now }
+	got, err := latest.Latest("", []string{"evict-pruned", "evict-idle"})
+	if err != nil || len(got["evict-pruned"]) != 2 {
+		t.Fatalf("expected both series loaded, got %+v err=%v", got, err)
+	}
+
+	// 保留期清理掉 humidity 之后，过期重新加载以存储为准，不再保留旧序列。
+	if _, err := ds.PruneRetentionBatch(inter.RetentionMetrics, inter.RetentionTarget{Before: 2000}, 100); err != nil {
+		t.Fatalf("PruneRetentionBatch failed: %v", err)
+	}
+	// 加载之后观察到的写入让条目保持活跃；没有落到存储的观察值在重新加载时也以存储为准。
+	now = now.Add(latest.ttl / 2)
+	latest.Observe("evict-pruned", []inter.MetricPoint{{Timestamp: 8000, Name: "pressure", Value: 1}})
+	now = now.Add(latest.ttl / 2)
+	// 查询开始之后观察到的写入在重新加载时保留。
+	latest.Observe("evict-pruned", []inter.MetricPoint{{Timestamp: 9000, Name: "wind", Value: 3}})
+	got, err = latest.Latest("", []string{"evict-pruned"})
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	points := got["evict-pruned"]
+	if len(points) != 2 || points[0].Name != "temp" || points[1].Name != "wind" {
+		t.Fatalf("expected pruned series dropped on reload, got %+v", points)
+	}
+
+	// evict-idle 超过 ttl 既未读取也未写入，下次扫描时被淘汰。
+	if latest.devices["evict-idle"] != nil {
+		t.Fatalf("expected idle device evicted, got %+v", latest.devices["evict-idle"])
+	}
+	if latest.devices["evict-pruned"] == nil {
+		t.Fatalf("expected active device kept")
+	}
+}
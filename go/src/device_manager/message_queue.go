@@ -2,8 +2,10 @@ package device_manager
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
 )
 
 // InMemoryDeviceCommandQueue 是设备下行队列的默认内存实现。
@@ -11,48 +13,81 @@ type InMemoryDeviceCommandQueue struct {
 	mu       sync.Mutex
 	queues   map[string][]inter.DownlinkMessage
 	capacity int
+	// dataStore 非空时把被淘汰的指令标记为 overflow，与 database 队列一致。
+	dataStore inter.DeviceCommandRepository
+	overflows atomic.Int64
 }
 
 // NewDeviceCommandQueue 创建默认内存态的设备下行队列。
 func NewDeviceCommandQueue(cap int) inter.DeviceCommandQueue {
+	return NewDeviceCommandQueueWithStore(cap, nil)
+}
+
+// NewDeviceCommandQueueWithStore 创建内存队列，队列满淘汰的指令会在 ds 中标记为 overflow。
+func NewDeviceCommandQueueWithStore(cap int, ds inter.DeviceCommandRepository) *InMemoryDeviceCommandQueue {
 	return &InMemoryDeviceCommandQueue{
-		queues:   make(map[string][]inter.DownlinkMessage),
-		capacity: cap,
+		queues:    make(map[string][]inter.DownlinkMessage),
+		capacity:  cap,
+		dataStore: ds,
 	}
 }
 
 func (m *InMemoryDeviceCommandQueue) Enqueue(uuid string, message inter.DownlinkMessage) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	queue := append([]inter.DownlinkMessage(nil), m.queues[uuid]...)
 	if m.capacity > 0 && len(queue) >= m.capacity {
 		// 队列满策略：丢弃最早的一条并压入新指令。
-		queue = append(queue[1:], message)
-		m.queues[uuid] = queue
+		evicted := queue[0]
+		m.queues[uuid] = append(queue[1:], message)
+		m.mu.Unlock()
+		m.overflow(uuid, evicted)
 		return nil
 	}
 	m.queues[uuid] = append(queue, message)
+	m.mu.Unlock()
 	return nil
 }
 
 func (m *InMemoryDeviceCommandQueue) Requeue(uuid string, message inter.DownlinkMessage) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	queue := append([]inter.DownlinkMessage(nil), m.queues[uuid]...)
+	var evicted []inter.DownlinkMessage
 	if m.capacity > 0 && len(queue) >= m.capacity {
 		// 重试命令优先级更高，队列满时淘汰最新的一条待发消息，保住重试项。
+		evicted = append(evicted, queue[len(queue)-1])
 		queue = queue[:len(queue)-1]
 	}
 	if m.capacity > 0 && len(queue) >= m.capacity {
+		m.mu.Unlock()
 		return inter.ErrDownlinkQueueFull
 	}
-	queue = append([]inter.DownlinkMessage{message}, queue...)
-	m.queues[uuid] = queue
+	m.queues[uuid] = append([]inter.DownlinkMessage{message}, queue...)
+	m.mu.Unlock()
+	for _, item := range evicted {
+		m.overflow(uuid, item)
+	}
 	return nil
 }
 
+// Overflows 返回进程启动以来因队列满被淘汰的指令数。
+func (m *InMemoryDeviceCommandQueue) Overflows() int64 {
+	return m.overflows.Load()
+}
+
+// overflow 记录被淘汰的指令；指令已离开排队状态时保持原状态。
+// 新指令已经入队，标记失败只记日志，不影响本次入队结果。
+func (m *InMemoryDeviceCommandQueue) overflow(uuid string, message inter.DownlinkMessage) {
+	m.overflows.Add(1)
+	log := logger.Default().With(inter.String("module", "device_manager"))
+	log.Warn("设备下行队列已满，淘汰指令", inter.String("uuid", uuid), inter.Int64("command_id", message.CommandID))
+	if m.dataStore == nil || message.CommandID <= 0 {
+		return
+	}
+	if _, err := m.dataStore.TransitionDeviceCommandStatus(message.CommandID, inter.DeviceCommandStatusQueued, inter.DeviceCommandStatusOverflow, "downlink queue overflow"); err != nil {
+		log.Warn("标记淘汰指令失败", inter.Int64("command_id", message.CommandID), inter.Err(err))
+	}
+}
+
 func (m *InMemoryDeviceCommandQueue) Dequeue(uuid string) (inter.DownlinkMessage, bool, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -71,6 +106,30 @@ func (m *InMemoryDeviceCommandQueue) Dequeue(uuid string) (inter.DownlinkMessage
 	return msg, true, nil
 }
 
+func (m *InMemoryDeviceCommandQueue) Remove(uuid string, commandID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queue := m.queues[uuid]
+	kept := make([]inter.DownlinkMessage, 0, len(queue))
+	for _, msg := range queue {
+		if msg.CommandID != commandID {
+			kept = append(kept, msg)
+		}
+	}
+	if len(kept) == 0 {
+		delete(m.queues, uuid)
+	} else {
+		m.queues[uuid] = kept
+	}
+	return nil
+}
+
+// Renew 内存队列出队即移除，没有领取租约。
+func (m *InMemoryDeviceCommandQueue) Renew(commandIDs []int64) error {
+	return nil
+}
+
 func (m *InMemoryDeviceCommandQueue) IsEmpty(uuid string) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -0,0 +1,539 @@
+package device_manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
+)
+
+const (
+	// otaCommandName 是数据块指令在指令历史中的名称。
+	otaCommandName = "ota_data"
+	// maxOtaChunkSize 是扣除帧头后单帧可携带的镜像字节数。
+	maxOtaChunkSize = inter.MaxDownlinkPayloadSize - inter.OtaFrameHeaderSize
+	// otaMaxChunkFailures 是同一偏移连续被设备拒绝的次数上限，超过后该设备升级失败。
+	otaMaxChunkFailures      = 5
+	maxFirmwareVersionLength = 64
+	maxFirmwareNameLength    = 128
+	maxHardwareVersions      = 32
+)
+
+// otaStore 是 OTA 服务依赖的最小仓储组合。
+type otaStore interface {
+	inter.OtaRepository
+	deviceTargetStore
+	LoadConfig(uuid string) (inter.DeviceMetadata, error)
+	GetDeviceCommand(commandID int64) (inter.DeviceCommand, error)
+}
+
+// otaChunkRef 是数据块指令落库的载荷，只引用镜像区间，出队时由 RenderChunk 读取镜像并组帧。
+type otaChunkRef struct {
+	CampaignID int64  `json:"campaign_id"`
+	ArtifactID string `json:"artifact_id"`
+	Version    string `json:"version"`
+	Offset     int64  `json:"offset"`
+	Length     int    `json:"length"`
+	Total      int64  `json:"total"`
+}
+
+// OtaService 按活动逐台推进固件传输：每台设备同一时刻只有一个在途数据块，确认后再发下一块。
+// 设备断线时数据块过期或回队，重新上线后从已确认的偏移继续；传输完成后等待设备以新版本重新注册。
+type OtaService struct {
+	dataStore     otaStore
+	downlink      inter.DownlinkCommandService
+	pollInterval  time.Duration
+	chunkSize     int
+	verifyTimeout time.Duration
+	now           func() time.Time
+}
+
+// NewOtaService 创建 OTA 服务，数据块通过 downlink 入队。
+func NewOtaService(ds otaStore, downlink inter.DownlinkCommandService, cfg appcfg.DeviceManagerConfig) *OtaService {
+	n := appcfg.NormalizeDeviceManagerConfig(cfg)
+	chunkSize := n.OtaChunkSize
+	if chunkSize > maxOtaChunkSize {
+		chunkSize = maxOtaChunkSize
+	}
+	return &OtaService{
+		dataStore:     ds,
+		downlink:      downlink,
+		pollInterval:  n.OtaPollInterval,
+		chunkSize:     chunkSize,
+		verifyTimeout: n.OtaVerifyTimeout,
+		now:           time.Now,
+	}
+}
+
+func (s *OtaService) UploadFirmware(scope inter.Scope, artifact inter.FirmwareArtifact) (inter.FirmwareArtifact, error) {
+	artifact.TenantID = scopeTenantID(scope)
+	artifact.ID = ""
+	artifact.Name = strings.TrimSpace(artifact.Name)
+	artifact.Version = strings.TrimSpace(artifact.Version)
+	if artifact.Version == "" || len(artifact.Version) > maxFirmwareVersionLength {
+		return inter.FirmwareArtifact{}, fmt.Errorf("%w: version is required and at most %d characters", inter.ErrFirmwareArtifactInvalid, maxFirmwareVersionLength)
+	}
+	if len(artifact.Name) > maxFirmwareNameLength {
+		return inter.FirmwareArtifact{}, fmt.Errorf("%w: name exceeds %d characters", inter.ErrFirmwareArtifactInvalid, maxFirmwareNameLength)
+	}
+	hardware := make([]string, 0, len(artifact.HardwareVersions))
+	for _, v := range artifact.HardwareVersions {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if len(v) > maxFirmwareVersionLength {
+			return inter.FirmwareArtifact{}, fmt.Errorf("%w: hardware version exceeds %d characters", inter.ErrFirmwareArtifactInvalid, maxFirmwareVersionLength)
+		}
+		hardware = append(hardware, v)
+	}
+	if len(hardware) > maxHardwareVersions {
+		return inter.FirmwareArtifact{}, fmt.Errorf("%w: at most %d hardware versions", inter.ErrFirmwareArtifactInvalid, maxHardwareVersions)
+	}
+	artifact.HardwareVersions = hardware
+	// 帧头中的偏移与总长是 uint32。
+	if len(artifact.Content) == 0 || int64(len(artifact.Content)) > math.MaxUint32 {
+		return inter.FirmwareArtifact{}, fmt.Errorf("%w: image is empty or too large", inter.ErrFirmwareArtifactInvalid)
+	}
+	sum := sha256.Sum256(artifact.Content)
+	digest := hex.EncodeToString(sum[:])
+	if expected := strings.TrimSpace(artifact.SHA256); expected != "" && !strings.EqualFold(expected, digest) {
+		return inter.FirmwareArtifact{}, fmt.Errorf("%w: sha256 mismatch, computed %s", inter.ErrFirmwareArtifactInvalid, digest)
+	}
+	artifact.SHA256 = digest
+	artifact.CreatedAt = s.now().UTC()
+	return s.dataStore.CreateFirmwareArtifact(artifact)
+}
+
+func (s *OtaService) GetFirmware(scope inter.Scope, id string) (inter.FirmwareArtifact, error) {
+	return s.dataStore.GetFirmwareArtifact(scopeTenantID(scope), id)
+}
+
+func (s *OtaService) ListFirmware(scope inter.Scope, limit int) ([]inter.FirmwareArtifact, error) {
+	return s.dataStore.ListFirmwareArtifacts(scopeTenantID(scope), limit)
+}
+
+func (s *OtaService) DeleteFirmware(scope inter.Scope, id string) error {
+	return s.dataStore.DeleteFirmwareArtifact(scopeTenantID(scope), id)
+}
+
+func (s *OtaService) CreateCampaign(scope inter.Scope, campaign inter.OtaCampaign) (inter.OtaCampaign, error) {
+	campaign.TenantID = scopeTenantID(scope)
+	campaign.Name = strings.TrimSpace(campaign.Name)
+	campaign.GroupID = strings.TrimSpace(campaign.GroupID)
+	if len(campaign.Name) > maxFirmwareNameLength {
+		return inter.OtaCampaign{}, fmt.Errorf("%w: name exceeds %d characters", inter.ErrOtaCampaignInvalid, maxFirmwareNameLength)
+	}
+	if campaign.GroupID == "" && len(campaign.Labels) == 0 {
+		return inter.OtaCampaign{}, fmt.Errorf("%w: group_id or labels is required", inter.ErrOtaCampaignInvalid)
+	}
+	if campaign.RolloutPercent == 0 {
+		campaign.RolloutPercent = 100
+	}
+	if campaign.RolloutPercent < 1 || campaign.RolloutPercent > 100 {
+		return inter.OtaCampaign{}, fmt.Errorf("%w: rollout_percent must be between 1 and 100", inter.ErrOtaCampaignInvalid)
+	}
+	if campaign.ChunkSize == 0 {
+		campaign.ChunkSize = s.chunkSize
+	}
+	if campaign.ChunkSize < 1 || campaign.ChunkSize > maxOtaChunkSize {
+		return inter.OtaCampaign{}, fmt.Errorf("%w: chunk_size must be between 1 and %d", inter.ErrOtaCampaignInvalid, maxOtaChunkSize)
+	}
+	artifact, err := s.dataStore.GetFirmwareArtifact(campaign.TenantID, campaign.ArtifactID)
+	if err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	targets, err := resolveTargetDevices(s.dataStore, campaign.TenantID, campaign.GroupID, campaign.Labels)
+	if err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	if len(targets) == 0 {
+		return inter.OtaCampaign{}, fmt.Errorf("%w: no authenticated device matches the target", inter.ErrOtaCampaignInvalid)
+	}
+
+	now := s.now().UTC()
+	devices := make([]inter.OtaDevice, 0, len(targets))
+	for _, target := range targets {
+		device := inter.OtaDevice{
+			UUID:        target.UUID,
+			Bucket:      rolloutBucket(artifact.ID, target.UUID),
+			Status:      inter.OtaDevicePending,
+			FromVersion: target.Meta.SWVersion,
+			UpdatedAt:   now,
+		}
+		switch {
+		case !artifact.Compatible(target.Meta.HWVersion):
+			device.Status = inter.OtaDeviceSkipped
+			device.ErrorText = fmt.Sprintf("hardware version %q is not supported", target.Meta.HWVersion)
+		case target.Meta.SWVersion == artifact.Version:
+			device.Status = inter.OtaDeviceSkipped
+			device.ErrorText = "already on target version"
+		}
+		devices = append(devices, device)
+	}
+	campaign.ArtifactID = artifact.ID
+	campaign.Status = inter.OtaCampaignRunning
+	campaign.CreatedAt = now
+	campaign.UpdatedAt = now
+	id, err := s.dataStore.CreateOtaCampaign(campaign, devices)
+	if err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	return s.GetCampaign(scope, id)
+}
+
+func (s *OtaService) GetCampaign(scope inter.Scope, id int64) (inter.OtaCampaign, error) {
+	if id <= 0 {
+		return inter.OtaCampaign{}, inter.ErrOtaCampaignNotFound
+	}
+	campaign, err := s.dataStore.GetOtaCampaign(scopeTenantID(scope), id)
+	if err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	return s.withProgress(campaign)
+}
+
+func (s *OtaService) ListCampaigns(scope inter.Scope, limit int) ([]inter.OtaCampaign, error) {
+	campaigns, err := s.dataStore.ListOtaCampaigns(scopeTenantID(scope), limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range campaigns {
+		if campaigns[i], err = s.withProgress(campaigns[i]); err != nil {
+			return nil, err
+		}
+	}
+	return campaigns, nil
+}
+
+func (s *OtaService) ListCampaignDevices(scope inter.Scope, id int64) ([]inter.OtaDevice, error) {
+	if id <= 0 {
+		return nil, inter.ErrOtaCampaignNotFound
+	}
+	if _, err := s.dataStore.GetOtaCampaign(scopeTenantID(scope), id); err != nil {
+		return nil, err
+	}
+	return s.dataStore.ListOtaDevices(id)
+}
+
+func (s *OtaService) SetRollout(scope inter.Scope, id int64, percent int) (inter.OtaCampaign, error) {
+	campaign, err := s.GetCampaign(scope, id)
+	if err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	if campaign.Status != inter.OtaCampaignRunning && campaign.Status != inter.OtaCampaignPaused {
+		return inter.OtaCampaign{}, fmt.Errorf("%w: campaign is %s", inter.ErrOtaCampaignState, campaign.Status)
+	}
+	if percent < campaign.RolloutPercent || percent > 100 {
+		return inter.OtaCampaign{}, fmt.Errorf("%w: rollout_percent must be between %d and 100", inter.ErrOtaCampaignInvalid, campaign.RolloutPercent)
+	}
+	if err := s.dataStore.UpdateOtaCampaignState(campaign.ID, campaign.Status, percent); err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	return s.GetCampaign(scope, id)
+}
+
+func (s *OtaService) Pause(scope inter.Scope, id int64) (inter.OtaCampaign, error) {
+	return s.transition(scope, id, inter.OtaCampaignRunning, inter.OtaCampaignPaused)
+}
+
+func (s *OtaService) Resume(scope inter.Scope, id int64) (inter.OtaCampaign, error) {
+	return s.transition(scope, id, inter.OtaCampaignPaused, inter.OtaCampaignRunning)
+}
+
+func (s *OtaService) Abort(scope inter.Scope, id int64) (inter.OtaCampaign, error) {
+	campaign, err := s.GetCampaign(scope, id)
+	if err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	if campaign.Status != inter.OtaCampaignRunning && campaign.Status != inter.OtaCampaignPaused {
+		return inter.OtaCampaign{}, fmt.Errorf("%w: campaign is %s", inter.ErrOtaCampaignState, campaign.Status)
+	}
+	// 先结束活动，后台推进不再处理它，再逐台收尾。
+	if err := s.dataStore.UpdateOtaCampaignState(campaign.ID, inter.OtaCampaignAborted, campaign.RolloutPercent); err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	devices, err := s.dataStore.ListOtaDevices(campaign.ID)
+	if err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	deviceScope := inter.Scope{TenantID: campaign.TenantID}
+	for _, device := range devices {
+		if device.Status.Terminal() {
+			continue
+		}
+		if device.CommandID > 0 {
+			if _, err := s.downlink.Cancel(deviceScope, device.CommandID, "ota campaign aborted"); err != nil &&
+				!errors.Is(err, inter.ErrDeviceCommandNotQueued) && !errors.Is(err, inter.ErrDeviceCommandNotFound) {
+				return inter.OtaCampaign{}, err
+			}
+		}
+		next := device
+		next.Status = inter.OtaDeviceAborted
+		next.CommandID = 0
+		next.ErrorText = "campaign aborted"
+		next.UpdatedAt = s.now().UTC()
+		if _, err := s.dataStore.UpdateOtaDevice(next, device.Revision); err != nil {
+			return inter.OtaCampaign{}, err
+		}
+	}
+	return s.GetCampaign(scope, id)
+}
+
+// RenderChunk 把数据块指令落库的镜像引用转换为 OTA_DATA 帧，注册为 CmdOtaData 的载荷渲染器。
+func (s *OtaService) RenderChunk(payload []byte) ([]byte, error) {
+	var ref otaChunkRef
+	if err := json.Unmarshal(payload, &ref); err != nil {
+		return nil, fmt.Errorf("decode chunk reference: %w", err)
+	}
+	data, err := s.dataStore.ReadFirmwareChunk(ref.ArtifactID, ref.Offset, ref.Length)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != ref.Length {
+		return nil, fmt.Errorf("firmware %s: short chunk at offset %d", ref.ArtifactID, ref.Offset)
+	}
+	return encodeOtaFrame(uint32(ref.Offset), uint32(ref.Total), data), nil
+}
+
+func (s *OtaService) RunOnce() (int, error) {
+	campaigns, err := s.dataStore.ListActiveOtaCampaigns()
+	if err != nil {
+		return 0, err
+	}
+	// 单个活动失败不影响其他活动推进，错误汇总后返回。
+	sent := 0
+	var errs []error
+	for _, campaign := range campaigns {
+		n, err := s.advanceCampaign(campaign)
+		sent += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ota campaign %d: %w", campaign.ID, err))
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+func (s *OtaService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.RunOnce(); err != nil {
+				logger.Default().With(inter.String("module", "device_manager")).Warn("推进 OTA 活动失败", inter.Err(err))
+			}
+		}
+	}
+}
+
+// advanceCampaign 推进一个活动内的全部设备；放量到 100% 且设备全部结束时活动完成。
+func (s *OtaService) advanceCampaign(campaign inter.OtaCampaign) (int, error) {
+	artifact, err := s.dataStore.GetFirmwareArtifact(campaign.TenantID, campaign.ArtifactID)
+	if err != nil {
+		return 0, err
+	}
+	devices, err := s.dataStore.ListOtaDevices(campaign.ID)
+	if err != nil {
+		return 0, err
+	}
+	running := campaign.Status == inter.OtaCampaignRunning
+	sent := 0
+	finished := true
+	for _, device := range devices {
+		switch device.Status {
+		case inter.OtaDevicePending:
+			if running && device.Bucket < campaign.RolloutPercent {
+				started := s.now().UTC()
+				device.Status = inter.OtaDeviceTransferring
+				device.StartedAt = &started
+				device, err = s.advanceTransfer(campaign, artifact, device, true, &sent)
+			}
+		case inter.OtaDeviceTransferring:
+			device, err = s.advanceTransfer(campaign, artifact, device, running, &sent)
+		case inter.OtaDeviceVerifying:
+			device, err = s.verify(artifact, device)
+		}
+		if err != nil {
+			return sent, err
+		}
+		if !device.Status.Terminal() {
+			finished = false
+		}
+	}
+	if running && finished && campaign.RolloutPercent == 100 {
+		return sent, s.dataStore.UpdateOtaCampaignState(campaign.ID, inter.OtaCampaignCompleted, campaign.RolloutPercent)
+	}
+	return sent, nil
+}
+
+// advanceTransfer 根据在途数据块的指令状态推进设备：确认后前移偏移，被拒绝时原偏移重发；send 为 false 时只记录结果不发新块。
+func (s *OtaService) advanceTransfer(campaign inter.OtaCampaign, artifact inter.FirmwareArtifact, device inter.OtaDevice, send bool, sent *int) (inter.OtaDevice, error) {
+	next := device
+	if device.CommandID > 0 {
+		command, err := s.dataStore.GetDeviceCommand(device.CommandID)
+		if err != nil && !errors.Is(err, inter.ErrDeviceCommandNotFound) {
+			return device, err
+		}
+		switch {
+		case err == nil && (command.Status == inter.DeviceCommandStatusQueued || command.Status == inter.DeviceCommandStatusSent):
+			return device, nil
+		case err == nil && command.Status == inter.DeviceCommandStatusAcked:
+			next.BytesSent += int64(chunkLength(campaign, artifact, device.BytesSent))
+			next.Attempts = 0
+			next.ErrorText = ""
+		case err == nil && command.Status == inter.DeviceCommandStatusFailed:
+			next.Attempts++
+			next.ErrorText = fmt.Sprintf("chunk at offset %d rejected: %s", device.BytesSent, command.ErrorText)
+			if next.Attempts >= otaMaxChunkFailures {
+				next.Status = inter.OtaDeviceFailed
+			}
+		}
+		// 过期、溢出或被取消的数据块通常是设备离线所致，不计入失败次数，设备回来后从原偏移重发。
+		next.CommandID = 0
+		if next.BytesSent >= artifact.Size {
+			transferred := s.now().UTC()
+			next.Status = inter.OtaDeviceVerifying
+			next.TransferredAt = &transferred
+		}
+	}
+	if next.Status != inter.OtaDeviceTransferring || !send {
+		return s.saveDevice(device, next)
+	}
+
+	// 先入队再以 revision 为条件登记指令 ID，其他实例抢先推进时撤回本次入队的数据块。
+	ref := otaChunkRef{
+		CampaignID: campaign.ID,
+		ArtifactID: artifact.ID,
+		Version:    artifact.Version,
+		Offset:     next.BytesSent,
+		Length:     chunkLength(campaign, artifact, next.BytesSent),
+		Total:      artifact.Size,
+	}
+	payload, err := json.Marshal(ref)
+	if err != nil {
+		return device, err
+	}
+	deviceScope := inter.Scope{TenantID: campaign.TenantID}
+	msg, err := s.downlink.EnqueueWithPolicy(deviceScope, device.UUID, inter.CmdOtaData, otaCommandName, payload,
+		inter.DeviceCommandPolicy{Key: fmt.Sprintf("campaign-%d", campaign.ID)})
+	if err != nil {
+		// 队列已满等入队失败留到下一轮重试，已确认的进度仍然保存。
+		return s.saveDevice(device, next)
+	}
+	next.CommandID = msg.CommandID
+	saved, err := s.saveDevice(device, next)
+	if err != nil || saved.Revision == device.Revision {
+		_, _ = s.downlink.Cancel(deviceScope, msg.CommandID, "ota progress changed concurrently")
+		return saved, err
+	}
+	*sent++
+	return saved, nil
+}
+
+// verify 检查设备是否已以目标版本重新注册，等待超时判定失败。
+func (s *OtaService) verify(artifact inter.FirmwareArtifact, device inter.OtaDevice) (inter.OtaDevice, error) {
+	next := device
+	meta, err := s.dataStore.LoadConfig(device.UUID)
+	switch {
+	case errors.Is(err, inter.ErrDeviceNotFound):
+		next.Status = inter.OtaDeviceFailed
+		next.ErrorText = "device deleted"
+	case err != nil:
+		return device, err
+	case meta.SWVersion == artifact.Version:
+		next.Status = inter.OtaDeviceSucceeded
+		next.ErrorText = ""
+	case device.TransferredAt != nil && s.now().Sub(*device.TransferredAt) > s.verifyTimeout:
+		next.Status = inter.OtaDeviceFailed
+		next.ErrorText = fmt.Sprintf("device still reports version %q after transfer", meta.SWVersion)
+	default:
+		return device, nil
+	}
+	return s.saveDevice(device, next)
+}
+
+// saveDevice 以 device 的 revision 为条件写入 next；内容未变化或其他实例已抢先写入时返回原值。
+func (s *OtaService) saveDevice(device, next inter.OtaDevice) (inter.OtaDevice, error) {
+	if next == device {
+		return device, nil
+	}
+	next.UpdatedAt = s.now().UTC()
+	ok, err := s.dataStore.UpdateOtaDevice(next, device.Revision)
+	if err != nil || !ok {
+		return device, err
+	}
+	next.Revision = device.Revision + 1
+	return next, nil
+}
+
+func (s *OtaService) transition(scope inter.Scope, id int64, from, to inter.OtaCampaignStatus) (inter.OtaCampaign, error) {
+	campaign, err := s.GetCampaign(scope, id)
+	if err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	if campaign.Status != from {
+		return inter.OtaCampaign{}, fmt.Errorf("%w: campaign is %s", inter.ErrOtaCampaignState, campaign.Status)
+	}
+	if err := s.dataStore.UpdateOtaCampaignState(campaign.ID, to, campaign.RolloutPercent); err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	return s.GetCampaign(scope, id)
+}
+
+func (s *OtaService) withProgress(campaign inter.OtaCampaign) (inter.OtaCampaign, error) {
+	devices, err := s.dataStore.ListOtaDevices(campaign.ID)
+	if err != nil {
+		return inter.OtaCampaign{}, err
+	}
+	progress := inter.OtaCampaignProgress{Total: len(devices), ByStatus: map[string]int{}, Done: true}
+	for _, device := range devices {
+		progress.ByStatus[string(device.Status)]++
+		progress.BytesSent += device.BytesSent
+		if !device.Status.Terminal() {
+			progress.Done = false
+		}
+	}
+	campaign.Progress = &progress
+	return campaign, nil
+}
+
+// chunkLength 返回从 offset 开始的数据块长度，最后一块可能不足 ChunkSize。
+func chunkLength(campaign inter.OtaCampaign, artifact inter.FirmwareArtifact, offset int64) int {
+	remaining := artifact.Size - offset
+	if remaining < int64(campaign.ChunkSize) {
+		return int(remaining)
+	}
+	return campaign.ChunkSize
+}
+
+// rolloutBucket 把设备稳定地映射到 0-99，同一镜像的多次活动按相同顺序放量。
+func rolloutBucket(artifactID, uuid string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(artifactID + "/" + uuid))
+	return int(h.Sum32() % 100)
+}
+
+// encodeOtaFrame 按 OTA_DATA 帧格式组帧：Offset、TotalSize、数据的 CRC32（IEEE），均为小端 uint32，随后是数据。
+func encodeOtaFrame(offset, total uint32, data []byte) []byte {
+	frame := make([]byte, inter.OtaFrameHeaderSize+len(data))
+	binary.LittleEndian.PutUint32(frame[0:], offset)
+	binary.LittleEndian.PutUint32(frame[4:], total)
+	binary.LittleEndian.PutUint32(frame[8:], crc32.ChecksumIEEE(data))
+	copy(frame[inter.OtaFrameHeaderSize:], data)
+	return frame
+}
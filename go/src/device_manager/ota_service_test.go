@@ -0,0 +1,221 @@
+package device_manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"path/filepath"
+	"testing"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/persistence"
+)
+
+func newOtaTestEnv(t *testing.T) (*persistence.Store, *DownlinkCommandService, *OtaService) {
+	t.Helper()
+	ds, err := persistence.OpenSQLite(filepath.Join(t.TempDir(), "ota.db"))
+	if err != nil {
+		t.Fatalf("failed to init runtime store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = persistence.CloseIfPossible(ds)
+	})
+	cfg := appcfg.DefaultDeviceManagerConfig()
+	downlink := NewDownlinkCommandServiceWithConfig(ds, NewDeviceCommandQueue(8), nil, cfg)
+	ota := NewOtaService(ds, downlink, cfg)
+	downlink.SetPayloadRenderer(inter.CmdOtaData, ota.RenderChunk)
+	return ds, downlink, ota
+}
+
+func initOtaDevice(t *testing.T, ds *persistence.Store, uuid, hw, sw string, labels map[string]string) {
+	t.Helper()
+	if err := ds.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               uuid,
+		Token:              "tk-" + uuid,
+		HWVersion:          hw,
+		SWVersion:          sw,
+		AuthenticateStatus: inter.Authenticated,
+		Descriptor:         inter.DeviceDescriptor{Labels: labels},
+	}); err != nil {
+		t.Fatalf("failed to init device: %v", err)
+	}
+}
+
+// popOtaFrame 取出设备的下一个数据块并校验帧头。
+func popOtaFrame(t *testing.T, downlink *DownlinkCommandService, uuid string, image []byte) (inter.DownlinkMessage, uint32) {
+	t.Helper()
+	msg, ok, err := downlink.PopDownlink(uuid)
+	if err != nil || !ok || msg.CmdID != inter.CmdOtaData {
+		t.Fatalf("expected ota frame, got %+v ok=%v err=%v", msg, ok, err)
+	}
+	offset := binary.LittleEndian.Uint32(msg.Payload[0:])
+	total := binary.LittleEndian.Uint32(msg.Payload[4:])
+	data := msg.Payload[inter.OtaFrameHeaderSize:]
+	if int(total) != len(image) || binary.LittleEndian.Uint32(msg.Payload[8:]) != crc32.ChecksumIEEE(data) {
+		t.Fatalf("unexpected frame header: % x", msg.Payload[:inter.OtaFrameHeaderSize])
+	}
+	end := int(offset) + len(data)
+	if end > len(image) || !bytes.Equal(data, image[offset:end]) {
+		t.Fatalf("frame at offset %d does not match image", offset)
+	}
+	return msg, offset
+}
+
+func runOta(t *testing.T, ota *OtaService, wantSent int) {
+	t.Helper()
+	sent, err := ota.RunOnce()
+	if err != nil || sent != wantSent {
+		t.Fatalf("RunOnce sent %d err=%v, want %d", sent, err, wantSent)
+	}
+}
+
+func TestOtaServiceTransfersChunksAndDetectsNewVersion(t *testing.T) {
+	ds, downlink, ota := newOtaTestEnv(t)
+	labels := map[string]string{"site": "lab"}
+	initOtaDevice(t, ds, "ota-a", "hw1", "1.0", labels)
+	initOtaDevice(t, ds, "ota-b", "hw9", "1.0", labels)
+	initOtaDevice(t, ds, "ota-c", "hw1", "2.0", labels)
+
+	image := []byte("0123456789abcdefghij")
+	artifact, err := ota.UploadFirmware(inter.Scope{}, inter.FirmwareArtifact{Version: "2.0", HardwareVersions: []string{"hw1"}, Content: image})
+	if err != nil || len(artifact.SHA256) != 64 {
+		t.Fatalf("upload failed: %+v err=%v", artifact, err)
+	}
+	if _, err := ota.UploadFirmware(inter.Scope{}, inter.FirmwareArtifact{Version: "2.0", SHA256: "00", Content: image}); !errors.Is(err, inter.ErrFirmwareArtifactInvalid) {
+		t.Fatalf("expected sha256 mismatch, got %v", err)
+	}
+
+	campaign, err := ota.CreateCampaign(inter.Scope{}, inter.OtaCampaign{ArtifactID: artifact.ID, Labels: labels, ChunkSize: 8})
+	if err != nil {
+		t.Fatalf("create campaign failed: %v", err)
+	}
+	if campaign.RolloutPercent != 100 || campaign.Progress.Total != 3 || campaign.Progress.ByStatus["skipped"] != 2 {
+		t.Fatalf("unexpected campaign: %+v progress=%+v", campaign, campaign.Progress)
+	}
+
+	runOta(t, ota, 1)
+	msg, offset := popOtaFrame(t, downlink, "ota-a", image)
+	if offset != 0 {
+		t.Fatalf("first frame offset = %d", offset)
+	}
+	// 在途数据块未确认前不再下发。
+	runOta(t, ota, 0)
+
+	// 设备拒绝后从原偏移重发。
+	_ = downlink.MarkSent(msg.CommandID)
+	_ = downlink.MarkFailed(msg.CommandID, "crc mismatch")
+	runOta(t, ota, 1)
+	msg, offset = popOtaFrame(t, downlink, "ota-a", image)
+	if offset != 0 {
+		t.Fatalf("retried frame offset = %d", offset)
+	}
+	_ = downlink.MarkSent(msg.CommandID)
+	_ = downlink.MarkAcked(msg.CommandID)
+
+	// 断线回队的数据块重新出队时仍是同一帧；过期后从已确认的偏移续传。
+	runOta(t, ota, 1)
+	msg, _ = popOtaFrame(t, downlink, "ota-a", image)
+	if err := downlink.Requeue("ota-a", msg); err != nil {
+		t.Fatalf("requeue failed: %v", err)
+	}
+	msg, offset = popOtaFrame(t, downlink, "ota-a", image)
+	if offset != 8 {
+		t.Fatalf("requeued frame offset = %d", offset)
+	}
+	_ = downlink.MarkExpired(msg.CommandID, "device offline")
+	runOta(t, ota, 1)
+	for _, want := range []uint32{8, 16} {
+		msg, offset = popOtaFrame(t, downlink, "ota-a", image)
+		if offset != want {
+			t.Fatalf("frame offset = %d, want %d", offset, want)
+		}
+		_ = downlink.MarkSent(msg.CommandID)
+		_ = downlink.MarkAcked(msg.CommandID)
+		if want == 8 {
+			runOta(t, ota, 1)
+		}
+	}
+	runOta(t, ota, 0)
+
+	devices, err := ota.ListCampaignDevices(inter.Scope{}, campaign.ID)
+	if err != nil || devices[0].Status != inter.OtaDeviceVerifying || devices[0].BytesSent != int64(len(image)) || devices[0].Attempts != 0 {
+		t.Fatalf("expected ota-a to be verifying: %+v err=%v", devices, err)
+	}
+
+	if err := ds.SaveDescriptor("ota-a", inter.DeviceMetadata{SWVersion: "2.0"}); err != nil {
+		t.Fatalf("SaveDescriptor failed: %v", err)
+	}
+	runOta(t, ota, 0)
+	got, err := ota.GetCampaign(inter.Scope{}, campaign.ID)
+	if err != nil || got.Status != inter.OtaCampaignCompleted || got.Progress.ByStatus["succeeded"] != 1 || !got.Progress.Done {
+		t.Fatalf("expected completed campaign: %+v progress=%+v err=%v", got, got.Progress, err)
+	}
+	if err := ota.DeleteFirmware(inter.Scope{}, artifact.ID); !errors.Is(err, inter.ErrFirmwareArtifactInUse) {
+		t.Fatalf("expected artifact in use, got %v", err)
+	}
+}
+
+func TestOtaServiceStagedRolloutPauseAndAbort(t *testing.T) {
+	ds, downlink, ota := newOtaTestEnv(t)
+	labels := map[string]string{"fleet": "a"}
+	uuids := []string{"roll-00", "roll-01", "roll-02", "roll-03", "roll-04", "roll-05", "roll-06", "roll-07", "roll-08", "roll-09"}
+	for _, uuid := range uuids {
+		initOtaDevice(t, ds, uuid, "hw1", "1.0", labels)
+	}
+	artifact, err := ota.UploadFirmware(inter.Scope{}, inter.FirmwareArtifact{Version: "2.0", Content: []byte("image")})
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	// 分桶取决于随机生成的镜像 ID，按最小分桶取放量比例，保证首批至少一台设备。
+	percent := 100
+	for _, uuid := range uuids {
+		if bucket := rolloutBucket(artifact.ID, uuid); bucket+1 < percent {
+			percent = bucket + 1
+		}
+	}
+	campaign, err := ota.CreateCampaign(inter.Scope{}, inter.OtaCampaign{ArtifactID: artifact.ID, Labels: labels, RolloutPercent: percent})
+	if err != nil {
+		t.Fatalf("create campaign failed: %v", err)
+	}
+
+	devices, _ := ota.ListCampaignDevices(inter.Scope{}, campaign.ID)
+	inRollout := 0
+	for _, device := range devices {
+		if device.Bucket < percent {
+			inRollout++
+		}
+	}
+	runOta(t, ota, inRollout)
+	runOta(t, ota, 0)
+
+	if _, err := ota.SetRollout(inter.Scope{}, campaign.ID, percent-1); !errors.Is(err, inter.ErrOtaCampaignInvalid) {
+		t.Fatalf("expected rollout decrease to be rejected, got %v", err)
+	}
+	if _, err := ota.Pause(inter.Scope{}, campaign.ID); err != nil {
+		t.Fatalf("pause failed: %v", err)
+	}
+	if _, err := ota.SetRollout(inter.Scope{}, campaign.ID, 100); err != nil {
+		t.Fatalf("set rollout failed: %v", err)
+	}
+	// 暂停时不会开始新的设备。
+	runOta(t, ota, 0)
+	if _, err := ota.Resume(inter.Scope{}, campaign.ID); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	runOta(t, ota, len(uuids)-inRollout)
+
+	aborted, err := ota.Abort(inter.Scope{}, campaign.ID)
+	if err != nil || aborted.Status != inter.OtaCampaignAborted || aborted.Progress.ByStatus["aborted"] != len(uuids) {
+		t.Fatalf("unexpected aborted campaign: %+v progress=%+v err=%v", aborted, aborted.Progress, err)
+	}
+	for _, uuid := range uuids {
+		if msg, ok, err := downlink.PopDownlink(uuid); err != nil || ok {
+			t.Fatalf("expected queued chunk for %s to be cancelled, got %+v ok=%v err=%v", uuid, msg, ok, err)
+		}
+	}
+	if _, err := ota.Resume(inter.Scope{}, campaign.ID); !errors.Is(err, inter.ErrOtaCampaignState) {
+		t.Fatalf("expected aborted campaign to reject resume, got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package device_manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
+)
+
+// RetentionService 按平台默认值与租户覆盖的保留期分批清理过期数据。
+// 原始指标与小时汇总在删除前先合并进下一级汇总表；每批一个短事务，批次之间暂停，避免长时间占用 SQLite 写锁。
+type RetentionService struct {
+	dataStore  inter.RetentionRepository
+	defaults   map[inter.RetentionDataClass]time.Duration
+	interval   time.Duration
+	batchSize  int
+	batchPause time.Duration
+	now        func() time.Time
+
+	// runMu 保证同一时刻只有一次清理在运行。
+	runMu    sync.Mutex
+	mu       sync.Mutex
+	progress inter.RetentionProgress
+}
+
+// NewRetentionService 创建保留期清理服务。
+func NewRetentionService(ds inter.RetentionRepository, cfg appcfg.DeviceManagerConfig) *RetentionService {
+	n := appcfg.NormalizeDeviceManagerConfig(cfg)
+	return &RetentionService{
+		dataStore:  ds,
+		defaults:   n.RetentionDefaults,
+		interval:   n.RetentionInterval,
+		batchSize:  n.RetentionBatchSize,
+		batchPause: n.RetentionBatchPause,
+		now:        time.Now,
+		progress:   inter.RetentionProgress{Classes: map[inter.RetentionDataClass]inter.RetentionClassProgress{}},
+	}
+}
+
+// ListPolicies 返回租户全部数据类别的生效保留期，未覆盖的类别使用平台默认值。
+func (s *RetentionService) ListPolicies(scope inter.Scope) ([]inter.RetentionPolicy, error) {
+	tenantID := scopeTenantID(scope)
+	overrides, err := s.dataStore.ListRetentionPolicies(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	byClass := make(map[inter.RetentionDataClass]inter.RetentionPolicy, len(overrides))
+	for _, policy := range overrides {
+		byClass[policy.DataClass] = policy
+	}
+	out := make([]inter.RetentionPolicy, 0, len(inter.RetentionDataClasses))
+	for _, class := range inter.RetentionDataClasses {
+		if policy, ok := byClass[class]; ok {
+			out = append(out, policy)
+			continue
+		}
+		out = append(out, s.defaultPolicy(tenantID, class))
+	}
+	return out, nil
+}
+
+func (s *RetentionService) SetPolicy(scope inter.Scope, class inter.RetentionDataClass, retention time.Duration, updatedBy string) (inter.RetentionPolicy, error) {
+	if !class.Valid() {
+		return inter.RetentionPolicy{}, fmt.Errorf("%w: unknown data class %q", inter.ErrRetentionPolicyInvalid, class)
+	}
+	if retention < 0 {
+		return inter.RetentionPolicy{}, fmt.Errorf("%w: retention must not be negative", inter.ErrRetentionPolicyInvalid)
+	}
+	return s.dataStore.UpsertRetentionPolicy(inter.RetentionPolicy{
+		TenantID:    scopeTenantID(scope),
+		DataClass:   class,
+		RetentionMs: retention.Milliseconds(),
+		UpdatedBy:   strings.TrimSpace(updatedBy),
+	})
+}
+
+func (s *RetentionService) ResetPolicy(scope inter.Scope, class inter.RetentionDataClass) (inter.RetentionPolicy, error) {
+	if !class.Valid() {
+		return inter.RetentionPolicy{}, fmt.Errorf("%w: unknown data class %q", inter.ErrRetentionPolicyInvalid, class)
+	}
+	tenantID := scopeTenantID(scope)
+	if _, err := s.dataStore.DeleteRetentionPolicy(tenantID, class); err != nil {
+		return inter.RetentionPolicy{}, err
+	}
+	return s.defaultPolicy(tenantID, class), nil
+}
+
+func (s *RetentionService) defaultPolicy(tenantID string, class inter.RetentionDataClass) inter.RetentionPolicy {
+	return inter.RetentionPolicy{
+		TenantID:    tenantID,
+		DataClass:   class,
+		RetentionMs: s.defaults[class].Milliseconds(),
+		Source:      inter.RetentionSourceDefault,
+	}
+}
+
+// Progress 返回当前或最近一次清理的进度快照。
+func (s *RetentionService) Progress() inter.RetentionProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyRetentionProgress(s.progress)
+}
+
+// Prune 依次清理 classes 中的数据类别：先按各租户的覆盖值，再对其余租户使用平台默认值。
+func (s *RetentionService) Prune(ctx context.Context, classes []inter.RetentionDataClass) (inter.RetentionProgress, error) {
+	if len(classes) == 0 {
+		classes = inter.RetentionDataClasses
+	}
+	for _, class := range classes {
+		if !class.Valid() {
+			return inter.RetentionProgress{}, fmt.Errorf("%w: unknown data class %q", inter.ErrRetentionPolicyInvalid, class)
+		}
+	}
+	if !s.runMu.TryLock() {
+		return s.Progress(), inter.ErrRetentionRunning
+	}
+	defer s.runMu.Unlock()
+
+	startedAt := s.now().UTC()
+	s.mu.Lock()
+	s.progress = inter.RetentionProgress{
+		Running:   true,
+		Runs:      s.progress.Runs + 1,
+		StartedAt: &startedAt,
+		Classes:   map[inter.RetentionDataClass]inter.RetentionClassProgress{},
+	}
+	s.mu.Unlock()
+
+	err := s.prune(ctx, classes)
+
+	finishedAt := s.now().UTC()
+	s.mu.Lock()
+	s.progress.Running = false
+	s.progress.CurrentClass = ""
+	s.progress.FinishedAt = &finishedAt
+	if err != nil {
+		s.progress.LastError = err.Error()
+	}
+	out := copyRetentionProgress(s.progress)
+	s.mu.Unlock()
+	return out, err
+}
+
+func (s *RetentionService) prune(ctx context.Context, classes []inter.RetentionDataClass) error {
+	overrides, err := s.dataStore.ListRetentionPolicies("")
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	for _, class := range classes {
+		s.mu.Lock()
+		s.progress.CurrentClass = class
+		s.mu.Unlock()
+
+		overridden := make([]string, 0)
+		for _, policy := range overrides {
+			if policy.DataClass != class {
+				continue
+			}
+			overridden = append(overridden, policy.TenantID)
+			if policy.RetentionMs <= 0 {
+				continue
+			}
+			target := inter.RetentionTarget{
+				Before:    retentionCutoff(class, now, time.Duration(policy.RetentionMs)*time.Millisecond),
+				TenantIDs: []string{policy.TenantID},
+			}
+			if err := s.pruneClass(ctx, class, target); err != nil {
+				return err
+			}
+		}
+		if period := s.defaults[class]; period > 0 {
+			target := inter.RetentionTarget{
+				Before:           retentionCutoff(class, now, period),
+				ExcludeTenantIDs: overridden,
+			}
+			if err := s.pruneClass(ctx, class, target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneClass 分批清理直到不足一批，每批之间检查 ctx 并暂停 batchPause。
+func (s *RetentionService) pruneClass(ctx context.Context, class inter.RetentionDataClass, target inter.RetentionTarget) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		res, err := s.dataStore.PruneRetentionBatch(class, target, s.batchSize)
+		if err != nil {
+			return fmt.Errorf("prune %s: %w", class, err)
+		}
+		s.mu.Lock()
+		p := s.progress.Classes[class]
+		p.Deleted += res.Deleted
+		p.RolledUp += res.RolledUp
+		p.Batches++
+		s.progress.Classes[class] = p
+		s.mu.Unlock()
+		if res.Deleted < int64(s.batchSize) {
+			return nil
+		}
+		if s.batchPause > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.batchPause):
+			}
+		}
+	}
+}
+
+// Run 按配置间隔周期清理，直到 ctx 结束。
+func (s *RetentionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// 手动触发的清理仍在进行时跳过本轮，退出时中断的清理不记录。
+			if _, err := s.Prune(ctx, nil); err != nil && !errors.Is(err, inter.ErrRetentionRunning) && ctx.Err() == nil {
+				logger.Default().With(inter.String("module", "device_manager")).Warn("定期清理过期数据失败", inter.Err(err))
+			}
+		}
+	}
+}
+
+// retentionCutoff 计算清理截止时间。原始指标对齐到整点、小时汇总对齐到零点，
+// 只有整个汇总桶都已过期时才会合并，下一级汇总不会混入仍在保留期内的数据。
+func retentionCutoff(class inter.RetentionDataClass, now time.Time, period time.Duration) int64 {
+	before := now.Add(-period).UnixMilli()
+	switch class {
+	case inter.RetentionMetrics:
+		return inter.MetricBucketStart(before, time.Hour.Milliseconds())
+	case inter.RetentionMetricsHourly:
+		return inter.MetricBucketStart(before, (24 * time.Hour).Milliseconds())
+	}
+	return before
+}
+
+func copyRetentionProgress(p inter.RetentionProgress) inter.RetentionProgress {
+	classes := make(map[inter.RetentionDataClass]inter.RetentionClassProgress, len(p.Classes))
+	for class, progress := range p.Classes {
+		classes[class] = progress
+	}
+	p.Classes = classes
+	return p
+}
@@ -0,0 +1,166 @@
+package device_manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// fakeRetentionStore 记录每次清理的范围，并按预设的行数模拟分批删除。
+type fakeRetentionStore struct {
+	policies []inter.RetentionPolicy
+	pending  map[string]int64
+	targets  []inter.RetentionTarget
+	classes  []inter.RetentionDataClass
+}
+
+func (f *fakeRetentionStore) ListRetentionPolicies(tenantID string) ([]inter.RetentionPolicy, error) {
+	out := make([]inter.RetentionPolicy, 0, len(f.policies))
+	for _, policy := range f.policies {
+		if tenantID == "" || policy.TenantID == tenantID {
+			out = append(out, policy)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRetentionStore) UpsertRetentionPolicy(policy inter.RetentionPolicy) (inter.RetentionPolicy, error) {
+	policy.Source = inter.RetentionSourceTenant
+	f.policies = append(f.policies, policy)
+	return policy, nil
+}
+
+func (f *fakeRetentionStore) DeleteRetentionPolicy(tenantID string, class inter.RetentionDataClass) (bool, error) {
+	for i, policy := range f.policies {
+		if policy.TenantID == tenantID && policy.DataClass == class {
+			f.policies = append(f.policies[:i], f.policies[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeRetentionStore) PruneRetentionBatch(class inter.RetentionDataClass, target inter.RetentionTarget, limit int) (inter.RetentionBatchResult, error) {
+	f.targets = append(f.targets, target)
+	f.classes = append(f.classes, class)
+	key := string(class)
+	if len(target.TenantIDs) > 0 {
+		key += "/" + target.TenantIDs[0]
+	}
+	n := f.pending[key]
+	if n > int64(limit) {
+		n = int64(limit)
+	}
+	f.pending[key] -= n
+	return inter.RetentionBatchResult{Deleted: n, RolledUp: n / 2}, nil
+}
+
+func newRetentionTestService(store *fakeRetentionStore) *RetentionService {
+	cfg := appcfg.DefaultDeviceManagerConfig()
+	cfg.RetentionBatchSize = 2
+	cfg.RetentionBatchPause = 0
+	cfg.RetentionDefaults = map[inter.RetentionDataClass]time.Duration{
+		inter.RetentionMetrics: 24 * time.Hour,
+		inter.RetentionLogs:    0,
+	}
+	svc := NewRetentionService(store, cfg)
+	svc.now = func() time.Time { return time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC) }
+	return svc
+}
+
+func TestRetentionServicePolicies(t *testing.T) {
+	store := &fakeRetentionStore{pending: map[string]int64{}}
+	svc := newRetentionTestService(store)
+	scope := inter.Scope{TenantID: "tenant_a"}
+
+	if _, err := svc.SetPolicy(scope, "audio", time.Hour, "alice"); !errors.Is(err, inter.ErrRetentionPolicyInvalid) {
+		t.Fatalf("expected invalid class, got %v", err)
+	}
+	if _, err := svc.SetPolicy(scope, inter.RetentionLogs, -time.Hour, "alice"); !errors.Is(err, inter.ErrRetentionPolicyInvalid) {
+		t.Fatalf("expected negative retention rejected, got %v", err)
+	}
+	if _, err := svc.SetPolicy(scope, inter.RetentionLogs, 7*24*time.Hour, "alice"); err != nil {
+		t.Fatalf("SetPolicy failed: %v", err)
+	}
+	policies, err := svc.ListPolicies(scope)
+	if err != nil || len(policies) != len(inter.RetentionDataClasses) {
+		t.Fatalf("expected every class listed, got %+v err=%v", policies, err)
+	}
+	for _, policy := range policies {
+		switch policy.DataClass {
+		case inter.RetentionLogs:
+			if policy.Source != inter.RetentionSourceTenant || policy.RetentionMs != (7*24*time.Hour).Milliseconds() {
+				t.Fatalf("unexpected logs override: %+v", policy)
+			}
+		case inter.RetentionMetricsDaily:
+			// 配置未给出的类别回落到内置默认值。
+			if policy.Source != inter.RetentionSourceDefault || policy.RetentionMs != 0 {
+				t.Fatalf("unexpected daily default: %+v", policy)
+			}
+		}
+	}
+	policy, err := svc.ResetPolicy(scope, inter.RetentionLogs)
+	if err != nil || policy.Source != inter.RetentionSourceDefault || policy.RetentionMs != 0 || len(store.policies) != 0 {
+		t.Fatalf("unexpected reset result: %+v err=%v", policy, err)
+	}
+}
+
+func TestRetentionServicePruneAppliesOverridesInBatches(t *testing.T) {
+	store := &fakeRetentionStore{
+		policies: []inter.RetentionPolicy{
+			{TenantID: "tenant_a", DataClass: inter.RetentionMetrics, RetentionMs: (2 * time.Hour).Milliseconds()},
+			{TenantID: "tenant_b", DataClass: inter.RetentionMetrics, RetentionMs: 0},
+			{TenantID: "tenant_a", DataClass: inter.RetentionLogs, RetentionMs: time.Hour.Milliseconds()},
+		},
+		pending: map[string]int64{"metrics/tenant_a": 3, "metrics": 5, "logs/tenant_a": 1},
+	}
+	svc := newRetentionTestService(store)
+
+	progress, err := svc.Prune(context.Background(), []inter.RetentionDataClass{inter.RetentionMetrics, inter.RetentionLogs})
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if progress.Running || progress.Runs != 1 || progress.FinishedAt == nil {
+		t.Fatalf("unexpected progress: %+v", progress)
+	}
+	if metrics := progress.Classes[inter.RetentionMetrics]; metrics.Deleted != 8 || metrics.Batches != 5 {
+		t.Fatalf("unexpected metrics progress: %+v", metrics)
+	}
+	if logs := progress.Classes[inter.RetentionLogs]; logs.Deleted != 1 || logs.Batches != 1 {
+		t.Fatalf("unexpected logs progress: %+v", logs)
+	}
+
+	// 租户覆盖单独清理，截止时间对齐到整点；默认值跳过所有已覆盖的租户，默认 0 的日志不做全局清理。
+	first := store.targets[0]
+	if first.TenantIDs[0] != "tenant_a" || first.Before != time.Date(2026, 3, 10, 13, 0, 0, 0, time.UTC).UnixMilli() {
+		t.Fatalf("unexpected override target: %+v", first)
+	}
+	var defaultTarget *inter.RetentionTarget
+	for i, target := range store.targets {
+		if store.classes[i] == inter.RetentionMetrics && len(target.TenantIDs) == 0 {
+			defaultTarget = &store.targets[i]
+			break
+		}
+	}
+	if defaultTarget == nil || len(defaultTarget.ExcludeTenantIDs) != 2 || defaultTarget.Before != time.Date(2026, 3, 9, 15, 0, 0, 0, time.UTC).UnixMilli() {
+		t.Fatalf("unexpected default target: %+v", defaultTarget)
+	}
+	for i, class := range store.classes {
+		if class == inter.RetentionLogs && len(store.targets[i].TenantIDs) == 0 {
+			t.Fatalf("logs kept forever by default must not be pruned globally: %+v", store.targets[i])
+		}
+	}
+
+	if _, err := svc.Prune(context.Background(), []inter.RetentionDataClass{"audio"}); !errors.Is(err, inter.ErrRetentionPolicyInvalid) {
+		t.Fatalf("expected unknown class rejected, got %v", err)
+	}
+	svc.runMu.Lock()
+	if _, err := svc.Prune(context.Background(), nil); !errors.Is(err, inter.ErrRetentionRunning) {
+		t.Fatalf("expected concurrent prune rejected, got %v", err)
+	}
+	svc.runMu.Unlock()
+}
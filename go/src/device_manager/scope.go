@@ -0,0 +1,16 @@
+package device_manager
+
+import (
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// scopeTenantID 返回授权范围的租户，未指定时归入默认租户；供按租户存储资源的服务共用。
+func scopeTenantID(scope inter.Scope) string {
+	tenantID := strings.TrimSpace(scope.TenantID)
+	if tenantID == "" {
+		return inter.DefaultTenantID
+	}
+	return tenantID
+}
@@ -10,6 +10,7 @@ import (
 // TelemetryIngestService 负责把设备解析后的指标、日志、事件沉淀到数据存储。
 type TelemetryIngestService struct {
 	dataStore inter.TelemetryStore
+	latest    inter.LatestMetricService
 }
 
 // NewTelemetryIngestService 创建默认遥测接收服务。
@@ -17,9 +18,20 @@ func NewTelemetryIngestService(ds inter.TelemetryStore) inter.TelemetryIngestSer
 	return &TelemetryIngestService{dataStore: ds}
 }
 
+// NewTelemetryIngestServiceWithLatest 创建遥测接收服务，指标写入成功后同步更新最新值缓存。
+func NewTelemetryIngestServiceWithLatest(ds inter.TelemetryStore, latest inter.LatestMetricService) inter.TelemetryIngestService {
+	return &TelemetryIngestService{dataStore: ds, latest: latest}
+}
+
 // IngestMetrics 批量写入设备指标。
 func (s *TelemetryIngestService) IngestMetrics(uuid string, points []inter.MetricPoint) error {
-	return s.dataStore.BatchAppendMetrics(uuid, points)
+	if err := s.dataStore.BatchAppendMetrics(uuid, points); err != nil {
+		return err
+	}
+	if s.latest != nil {
+		s.latest.Observe(uuid, points)
+	}
+	return nil
 }
 
 // IngestLog 写入设备运行日志。
@@ -1,6 +1,13 @@
 package inter
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type AuthenticateStatusType int
 
@@ -31,19 +38,470 @@ const (
 	DeviceCommandStatusSent   DeviceCommandStatus = "sent"
 	DeviceCommandStatusAcked  DeviceCommandStatus = "acked"
 	DeviceCommandStatusFailed DeviceCommandStatus = "failed"
+	// DeviceCommandStatusExpired 超过有效期仍未发送，或发送后超时未确认。
+	DeviceCommandStatusExpired DeviceCommandStatus = "expired"
+	// DeviceCommandStatusOverflow 设备队列已满，指令在发送前被淘汰。
+	DeviceCommandStatusOverflow DeviceCommandStatus = "overflow"
+	// DeviceCommandStatusCancelled 指令在发送前被用户取消，或被同名同键的新指令替换。
+	DeviceCommandStatusCancelled DeviceCommandStatus = "cancelled"
+)
+
+// DeviceCommandPolicy 描述下行指令的有效期与重试限制，零值字段表示不限制。
+type DeviceCommandPolicy struct {
+	// TTL 是指令入队后等待发送的最长时间。
+	TTL time.Duration
+	// Timeout 是指令发出后等待设备确认的最长时间。
+	Timeout time.Duration
+	// MaxAttempts 是指令最多发送的次数。
+	MaxAttempts int
+	// Key 标识指令的作用对象，例如配置项名称；与指令名一起决定替换范围。
+	Key string
+	// Supersede 为 true 时，同设备同名同 Key 的未发送指令会被新指令替换。
+	Supersede bool
+}
+
+// DeviceCommand 设备下行指令记录。
+type DeviceCommand struct {
+	ID            int64               `json:"id"`
+	TenantID      string              `json:"tenant_id"`
+	UUID          string              `json:"uuid"`
+	CmdID         CmdID               `json:"cmd_id"`
+	Command       string              `json:"command"`
+	Key           string              `json:"key,omitempty"`
+	Payload       []byte              `json:"-"`
+	Status        DeviceCommandStatus `json:"status"`
+	ErrorText     string              `json:"error_text,omitempty"`
+	Attempts      int                 `json:"attempts"`
+	MaxAttempts   int                 `json:"max_attempts"`
+	TimeoutMs     int64               `json:"timeout_ms"`
+	RequestedAt   time.Time           `json:"requested_at"`
+	ExpiresAt     *time.Time          `json:"expires_at,omitempty"`
+	SentAt        *time.Time          `json:"sent_at,omitempty"`
+	AckDeadlineAt *time.Time          `json:"ack_deadline_at,omitempty"`
+	ExecutedAt    *time.Time          `json:"executed_at,omitempty"`
+	// DeliveredBy 是最近一次把指令发往设备的 ingress 实例与 adapter。
+	DeliveredBy CommandDelivery `json:"delivered_by"`
+}
+
+// CommandDelivery 描述投递下行指令的 ingress 实例与 adapter，未知时为空。
+type CommandDelivery struct {
+	InstanceID string `json:"instance_id,omitempty"`
+	AdapterID  string `json:"adapter_id,omitempty"`
+}
+
+// DeviceGroup 是租户内的设备分组，一台设备可以属于多个分组。
+type DeviceGroup struct {
+	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	DeviceCount int       `json:"device_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CommandBatch 是一次批量下发任务：按分组或标签选择器展开目标设备，逐台入队并记录各自的指令 ID。
+type CommandBatch struct {
+	ID       int64  `json:"id"`
+	TenantID string `json:"tenant_id"`
+	GroupID  string `json:"group_id,omitempty"`
+	// Labels 是标签选择器，设备描述中的 labels 需包含全部键值；与 GroupID 同时给出时取交集。
+	Labels  map[string]string `json:"labels,omitempty"`
+	Command string            `json:"command"`
+	CmdID   CmdID             `json:"cmd_id"`
+	Payload []byte            `json:"-"`
+	// Policy 是逐台入队使用的有效期、重试与替换设置，随任务保存以便重启后继续入队。
+	Policy    DeviceCommandPolicy `json:"-"`
+	Total     int                 `json:"total"`
+	CreatedBy string              `json:"created_by,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+	Items     []CommandBatchItem  `json:"items"`
+}
+
+// CommandBatchItem 是批量任务中单台设备的下发结果，Status 取自对应指令的当前状态。
+// CommandID 与 ErrorText 都为空表示该设备尚未入队。
+type CommandBatchItem struct {
+	UUID      string              `json:"uuid"`
+	CommandID int64               `json:"command_id,omitempty"`
+	Status    DeviceCommandStatus `json:"status,omitempty"`
+	// ErrorText 为入队失败的原因；此时 CommandID 为 0。
+	ErrorText string `json:"error_text,omitempty"`
+}
+
+// Enqueued 报告该设备是否已经写入入队结果。
+func (i CommandBatchItem) Enqueued() bool {
+	return i.CommandID != 0 || i.ErrorText != ""
+}
+
+// CommandBatchProgress 是批量任务的汇总进度。
+type CommandBatchProgress struct {
+	Total int `json:"total"`
+	// Pending 为仍在排队或已发送待确认的设备数。
+	Pending   int  `json:"pending"`
+	Succeeded int  `json:"succeeded"`
+	Failed    int  `json:"failed"`
+	Rejected  int  `json:"rejected"`
+	Done      bool `json:"done"`
+	// ByStatus 按指令状态计数，入队失败计入 rejected。
+	ByStatus map[string]int `json:"by_status"`
+}
+
+// Progress 根据各设备指令的当前状态汇总进度。
+func (b CommandBatch) Progress() CommandBatchProgress {
+	p := CommandBatchProgress{Total: b.Total, ByStatus: map[string]int{}}
+	for _, item := range b.Items {
+		if !item.Enqueued() {
+			p.Pending++
+			continue
+		}
+		if item.CommandID == 0 {
+			p.Rejected++
+			p.ByStatus["rejected"]++
+			continue
+		}
+		p.ByStatus[string(item.Status)]++
+		switch item.Status {
+		case DeviceCommandStatusQueued, DeviceCommandStatusSent:
+			p.Pending++
+		case DeviceCommandStatusAcked:
+			p.Succeeded++
+		default:
+			p.Failed++
+		}
+	}
+	// 任务创建过程中中断时，尚未写入结果的设备按待处理计算。
+	p.Pending += b.Total - len(b.Items)
+	p.Done = p.Pending == 0
+	return p
+}
+
+// CommandSchedule 指令计划，ExecuteAt 与 Cron 二选一；UUID 为空时作用于租户内全部已认证设备。
+type CommandSchedule struct {
+	ID       int64  `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+	UUID     string `json:"uuid,omitempty"`
+	Command  string `json:"command"`
+	CmdID    CmdID  `json:"cmd_id"`
+	Payload  []byte `json:"-"`
+	// Policy 是物化指令时使用的有效期、重试与替换设置。
+	Policy    DeviceCommandPolicy `json:"-"`
+	ExecuteAt *time.Time          `json:"execute_at,omitempty"`
+	Cron      string              `json:"cron,omitempty"`
+	// Timezone 是解释 Cron 的 IANA 时区名，按该时区的本地时间计算：夏令时拨快跳过的时间当天不触发，
+	// 回拨重复出现的时间对限定了小时的表达式只触发一次。
+	Timezone  string     `json:"timezone"`
+	Enabled   bool       `json:"enabled"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	RunCount  int64      `json:"run_count"`
+	// Revision 每次修改或触发时加一，多个 Core 实例以它为条件抢占同一次触发。
+	Revision  int64     `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FirmwareArtifact 是上传的固件镜像，Content 只在读取数据块时按需加载。
+type FirmwareArtifact struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	// HardwareVersions 是兼容的硬件版本，为空表示不限制。
+	HardwareVersions []string  `json:"hardware_versions"`
+	Size             int64     `json:"size"`
+	SHA256           string    `json:"sha256"`
+	Content          []byte    `json:"-"`
+	CreatedBy        string    `json:"created_by,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Compatible 判断镜像是否适用于指定硬件版本。
+func (a FirmwareArtifact) Compatible(hwVersion string) bool {
+	if len(a.HardwareVersions) == 0 {
+		return true
+	}
+	for _, v := range a.HardwareVersions {
+		if v == hwVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// OtaCampaignStatus 升级活动状态
+type OtaCampaignStatus string
+
+const (
+	OtaCampaignRunning   OtaCampaignStatus = "running"
+	OtaCampaignPaused    OtaCampaignStatus = "paused"
+	OtaCampaignAborted   OtaCampaignStatus = "aborted"
+	OtaCampaignCompleted OtaCampaignStatus = "completed"
+)
+
+// OtaCampaign 是一次固件升级活动，按 RolloutPercent 分阶段放量到分组或标签选择器匹配的设备。
+type OtaCampaign struct {
+	ID         int64             `json:"id"`
+	TenantID   string            `json:"tenant_id"`
+	Name       string            `json:"name"`
+	ArtifactID string            `json:"artifact_id"`
+	GroupID    string            `json:"group_id,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// RolloutPercent 为 1-100，设备分桶值小于它时才开始传输。
+	RolloutPercent int               `json:"rollout_percent"`
+	Status         OtaCampaignStatus `json:"status"`
+	// ChunkSize 是单个 OTA_DATA 帧携带的镜像字节数，不含帧头。
+	ChunkSize int       `json:"chunk_size"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Progress 由服务层根据设备进度汇总，仓储不填充。
+	Progress *OtaCampaignProgress `json:"progress,omitempty"`
+}
+
+// OtaDeviceStatus 设备升级状态
+type OtaDeviceStatus string
+
+const (
+	OtaDevicePending      OtaDeviceStatus = "pending"
+	OtaDeviceTransferring OtaDeviceStatus = "transferring"
+	// OtaDeviceVerifying 表示镜像已全部确认，等待设备以新版本重新注册。
+	OtaDeviceVerifying OtaDeviceStatus = "verifying"
+	OtaDeviceSucceeded OtaDeviceStatus = "succeeded"
+	OtaDeviceFailed    OtaDeviceStatus = "failed"
+	// OtaDeviceSkipped 表示硬件版本不兼容或已是目标版本。
+	OtaDeviceSkipped OtaDeviceStatus = "skipped"
+	OtaDeviceAborted OtaDeviceStatus = "aborted"
+)
+
+// Terminal 判断设备升级是否已结束。
+func (s OtaDeviceStatus) Terminal() bool {
+	switch s {
+	case OtaDeviceSucceeded, OtaDeviceFailed, OtaDeviceSkipped, OtaDeviceAborted:
+		return true
+	}
+	return false
+}
+
+// OtaDevice 是单台设备在升级活动中的进度。
+type OtaDevice struct {
+	CampaignID int64  `json:"campaign_id"`
+	UUID       string `json:"uuid"`
+	// Bucket 是 0-99 的稳定分桶值，用于分阶段放量。
+	Bucket int             `json:"bucket"`
+	Status OtaDeviceStatus `json:"status"`
+	// BytesSent 是设备已确认的镜像字节数，断线重连后从这里续传。
+	BytesSent int64 `json:"bytes_sent"`
+	// CommandID 是当前在途数据块的指令 ID，0 表示没有在途数据块。
+	CommandID     int64      `json:"command_id,omitempty"`
+	Attempts      int        `json:"attempts"`
+	FromVersion   string     `json:"from_version,omitempty"`
+	ErrorText     string     `json:"error_text,omitempty"`
+	Revision      int64      `json:"-"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	TransferredAt *time.Time `json:"transferred_at,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// OtaCampaignProgress 是升级活动的汇总进度。
+type OtaCampaignProgress struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"`
+	// BytesSent 是全部设备已确认字节数之和。
+	BytesSent int64 `json:"bytes_sent"`
+	Done      bool  `json:"done"`
+}
+
+// ConfigScopeType 是配置文档的作用层级。
+type ConfigScopeType string
+
+const (
+	ConfigScopeTenant ConfigScopeType = "tenant"
+	ConfigScopeGroup  ConfigScopeType = "group"
+	ConfigScopeDevice ConfigScopeType = "device"
+)
+
+// Valid 判断作用层级是否受支持。
+func (t ConfigScopeType) Valid() bool {
+	switch t {
+	case ConfigScopeTenant, ConfigScopeGroup, ConfigScopeDevice:
+		return true
+	}
+	return false
+}
+
+// ConfigDocument 是某个作用对象的一个配置版本。
+// 同一作用对象的版本号从 1 递增且只追加，最新版本生效；回滚会以旧版本内容生成一个新版本。
+type ConfigDocument struct {
+	ID        int64           `json:"id"`
+	TenantID  string          `json:"tenant_id"`
+	ScopeType ConfigScopeType `json:"scope_type"`
+	// ScopeID 是分组 ID 或设备 UUID，租户层为空。
+	ScopeID string `json:"scope_id,omitempty"`
+	Version int64  `json:"version"`
+	// Content 在解析时按 JSON Merge Patch 覆盖上一层，值为 null 的键会删除继承来的配置。
+	Content map[string]interface{} `json:"content"`
+	Comment string                 `json:"comment,omitempty"`
+	// RolledBackFrom 是回滚时恢复的版本号，普通保存为 0。
+	RolledBackFrom int64     `json:"rolled_back_from,omitempty"`
+	CreatedBy      string    `json:"created_by,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ConfigSource 标识参与解析的一个配置版本。
+type ConfigSource struct {
+	ScopeType ConfigScopeType `json:"scope_type"`
+	ScopeID   string          `json:"scope_id,omitempty"`
+	Version   int64           `json:"version"`
+}
+
+// EffectiveDeviceConfig 是设备按租户、分组、设备逐层覆盖后的生效配置。
+type EffectiveDeviceConfig struct {
+	UUID     string `json:"uuid"`
+	TenantID string `json:"tenant_id"`
+	// ConfigVersion 由生效配置的内容计算，设备应用后以该值上报 config_version。
+	ConfigVersion string                 `json:"config_version"`
+	Config        map[string]interface{} `json:"config"`
+	Sources       []ConfigSource         `json:"sources"`
+	State         DeviceConfigState      `json:"state"`
+	// InSync 表示设备当前的配置版本与生效配置一致。
+	InSync bool `json:"in_sync"`
+}
+
+// DeviceConfigState 是设备配置的对账状态。
+type DeviceConfigState struct {
+	UUID     string `json:"uuid"`
+	TenantID string `json:"tenant_id"`
+	// CurrentVersion 是设备当前的配置版本：取最近一次注册或心跳上报的 config_version，
+	// 此后设备确认了下发指令时改为下发的版本。
+	CurrentVersion string `json:"current_version,omitempty"`
+	// PushedVersion 是最近一次下发的配置版本，CommandID 为其在途指令，0 表示没有在途指令。
+	PushedVersion string     `json:"pushed_version,omitempty"`
+	CommandID     int64      `json:"command_id,omitempty"`
+	PushedAt      *time.Time `json:"pushed_at,omitempty"`
+	AckedVersion  string     `json:"acked_version,omitempty"`
+	AckedAt       *time.Time `json:"acked_at,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// DeviceConfigAckSource 说明配置版本是如何被确认的。
+type DeviceConfigAckSource string
+
+const (
+	// DeviceConfigAckCommand 表示设备确认了配置下发指令。
+	DeviceConfigAckCommand DeviceConfigAckSource = "command"
+	// DeviceConfigAckReported 表示设备在注册或心跳中上报了该版本。
+	DeviceConfigAckReported DeviceConfigAckSource = "reported"
+)
+
+// DeviceConfigAck 是设备确认配置版本的审计记录。
+type DeviceConfigAck struct {
+	ID            int64                 `json:"id"`
+	TenantID      string                `json:"tenant_id"`
+	UUID          string                `json:"uuid"`
+	ConfigVersion string                `json:"config_version"`
+	Sources       []ConfigSource        `json:"sources"`
+	Source        DeviceConfigAckSource `json:"source"`
+	CommandID     int64                 `json:"command_id,omitempty"`
+	AckedAt       time.Time             `json:"acked_at"`
+}
+
+// DeviceCommandQuery 描述设备指令历史的查询条件，按 id 倒序分页。
+type DeviceCommandQuery struct {
+	Statuses []DeviceCommandStatus
+	Command  string
+	// Start、End 限定 requested_at，零值表示不限制。
+	Start time.Time
+	End   time.Time
+	// BeforeID 是分页游标，只返回 id 小于它的指令。
+	BeforeID int64
+	Limit    int
+}
+
+// ExternalCommandStatus 外部实体命令状态
+type ExternalCommandStatus string
+
+const (
+	ExternalCommandStatusPending ExternalCommandStatus = "pending"
+	ExternalCommandStatusSent    ExternalCommandStatus = "sent"
+	ExternalCommandStatusAcked   ExternalCommandStatus = "acked"
+	ExternalCommandStatusFailed  ExternalCommandStatus = "failed"
 )
 
 // DeviceMetadata 设备静态元数据
 type DeviceMetadata struct {
-	Name               string                 `json:"name"`               // 设备名称
-	HWVersion          string                 `json:"hw_version"`         // 硬件版本
-	SWVersion          string                 `json:"sw_version"`         // 固件/软件版本
-	ConfigVersion      string                 `json:"config_version"`     // 配置文件版本
-	SerialNumber       string                 `json:"sn"`                 // 序列号
-	MACAddress         string                 `json:"mac"`                // Mac 地址
-	CreatedAt          time.Time              `json:"created_at"`         // 首次注册时间
-	Token              string                 `json:"token"`              // 设备 Token
-	AuthenticateStatus AuthenticateStatusType `json:"authenticateStatus"` // 设备认证状态
+	Name               string                 `json:"name"`                 // 设备名称
+	HWVersion          string                 `json:"hw_version"`           // 硬件版本
+	SWVersion          string                 `json:"sw_version"`           // 固件/软件版本
+	ConfigVersion      string                 `json:"config_version"`       // 配置文件版本
+	SerialNumber       string                 `json:"sn"`                   // 序列号
+	MACAddress         string                 `json:"mac"`                  // Mac 地址
+	CreatedAt          time.Time              `json:"created_at"`           // 首次注册时间
+	Token              string                 `json:"token"`                // 设备 Token
+	AuthenticateStatus AuthenticateStatusType `json:"authenticateStatus"`   // 设备认证状态
+	Descriptor         DeviceDescriptor       `json:"descriptor"`           // 注册/发现时上报的扩展描述
+	Identities         []DeviceIdentity       `json:"identities,omitempty"` // 可用于解析设备的身份，列表查询不填充
+}
+
+// DeviceDescriptor 是六个基础字段之外的设备描述，来自 adapter 上报的 DeviceDescriptor。
+type DeviceDescriptor struct {
+	Manufacturer     string                 `json:"manufacturer,omitempty"`
+	Vendor           string                 `json:"vendor,omitempty"`
+	Model            string                 `json:"model,omitempty"`
+	ModelID          string                 `json:"model_id,omitempty"`
+	FirmwareVersion  string                 `json:"firmware_version,omitempty"`
+	HardwareRevision string                 `json:"hardware_revision,omitempty"`
+	SoftwareBuildID  string                 `json:"software_build_id,omitempty"`
+	PowerSource      string                 `json:"power_source,omitempty"`
+	DeviceType       string                 `json:"device_type,omitempty"`
+	Labels           map[string]string      `json:"labels,omitempty"`
+	Attributes       map[string]interface{} `json:"attributes,omitempty"`
+	// Entities 与 Endpoints 按 adapter 上报的结构原样保存为 JSON 数组。
+	Entities     json.RawMessage    `json:"entities,omitempty"`
+	Endpoints    json.RawMessage    `json:"endpoints,omitempty"`
+	Capabilities []DeviceCapability `json:"capabilities,omitempty"`
+}
+
+// DeviceCapability 描述设备的一个可读写属性，例如开关、亮度或色温。
+type DeviceCapability struct {
+	Name          string                 `json:"name,omitempty"`
+	Property      string                 `json:"property,omitempty"`
+	Type          string                 `json:"type,omitempty"`
+	Access        string                 `json:"access,omitempty"`
+	Readable      bool                   `json:"readable"`
+	Writable      bool                   `json:"writable"`
+	Unit          string                 `json:"unit,omitempty"`
+	ValueMin      string                 `json:"value_min,omitempty"`
+	ValueMax      string                 `json:"value_max,omitempty"`
+	Description   string                 `json:"description,omitempty"`
+	AllowedValues []string               `json:"allowed_values,omitempty"`
+	Features      []DeviceCapability     `json:"features,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// CapabilityViolation 描述 set 命令中某个属性与设备能力不符的原因。
+type CapabilityViolation struct {
+	Property string `json:"property"`
+	// Reason 取值为 unknown_property、not_writable、type_mismatch、not_allowed 或 out_of_range。
+	Reason   string      `json:"reason"`
+	Message  string      `json:"message"`
+	Expected interface{} `json:"expected,omitempty"`
+}
+
+// 可登记到 device_identities 并用于解析设备的身份类型。
+const (
+	DeviceIdentityMAC         = "mac"
+	DeviceIdentitySerial      = "sn"
+	DeviceIdentityIEEEAddress = "ieee_address"
+	DeviceIdentityClientID    = "client_id"
+)
+
+// DeviceIdentity 是设备的一个外部身份，同一类型的同一取值只能属于一台设备。
+type DeviceIdentity struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Issuer string `json:"issuer,omitempty"`
 }
 
 // DeviceRecord 设备记录（用于列表展示）
@@ -52,15 +510,155 @@ type DeviceRecord struct {
 	Meta DeviceMetadata `json:"meta"`
 }
 
-// MetricPoint 传感器采样点
+// MetricPoint 是一个具名指标采样点。
+// bool 值以 0/1 记入 Value 以便聚合，string 值只记入 ValueText。
 type MetricPoint struct {
-	Timestamp int64   `json:"ts"`    // Unix 时间戳
-	Value     float32 `json:"value"` // 物理数值
-	Type      uint8   `json:"type"`  // 数据类型 (1=Temp, 2=Humi, 4=Lux)
+	Timestamp int64             `json:"ts"` // Unix 时间戳（毫秒）
+	Name      string            `json:"name"`
+	Unit      string            `json:"unit,omitempty"`
+	EntityID  string            `json:"entity_id,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	ValueType string            `json:"value_type"` // number | bool | string
+	Value     float64           `json:"value"`
+	ValueText string            `json:"value_text,omitempty"`
+	Type      uint8             `json:"type"` // legacy metric type，没有对应关系的指标为 0
+}
+
+// LegacyMetric 是 legacy metric type 与具名指标的对应关系。
+type LegacyMetric struct {
+	Type uint8
+	Name string
+	Unit string
+}
+
+// LegacyMetrics 列出 METRICS_REPORT 的 DataType 对应的指标名；旧数据迁移时按同一张表补齐名称。
+var LegacyMetrics = []LegacyMetric{
+	{Type: 1, Name: "temperature", Unit: "°C"},
+	{Type: 2, Name: "humidity", Unit: "%"},
+	{Type: 4, Name: "illuminance", Unit: "lx"},
+	{Type: 8, Name: "access_signal_a"},
+	{Type: 16, Name: "access_signal_b"},
+}
+
+// NormalizeMetricPoint 按 legacy 对应表互相补齐 Name、Unit 与 Type，并把空的 ValueType 视为 number。
+func NormalizeMetricPoint(point MetricPoint) MetricPoint {
+	point.Name = strings.TrimSpace(point.Name)
+	for _, legacy := range LegacyMetrics {
+		if point.Name == "" && point.Type == legacy.Type {
+			point.Name = legacy.Name
+		}
+		if point.Name == legacy.Name {
+			if point.Type == 0 {
+				point.Type = legacy.Type
+			}
+			if point.Unit == "" {
+				point.Unit = legacy.Unit
+			}
+		}
+	}
+	if point.ValueType == "" {
+		point.ValueType = "number"
+	}
+	return point
+}
+
+// MetricQuery 描述指标查询条件；Names 为空时不按名称过滤，Tags 中的每一项都必须匹配。
+type MetricQuery struct {
+	Start    int64
+	End      int64
+	Names    []string
+	EntityID string
+	Tags     map[string]string
+}
+
+// MetricAggregation 是指标分桶聚合函数。
+type MetricAggregation string
+
+const (
+	MetricAggAvg        MetricAggregation = "avg"
+	MetricAggMin        MetricAggregation = "min"
+	MetricAggMax        MetricAggregation = "max"
+	MetricAggSum        MetricAggregation = "sum"
+	MetricAggCount      MetricAggregation = "count"
+	MetricAggFirst      MetricAggregation = "first"
+	MetricAggLast       MetricAggregation = "last"
+	MetricAggPercentile MetricAggregation = "percentile"
+)
+
+// MetricFill 描述没有采样点的桶如何补齐。
+type MetricFill string
+
+const (
+	MetricFillNone     MetricFill = "none"     // 不输出空桶
+	MetricFillNull     MetricFill = "null"     // 输出 value 为 null 的空桶
+	MetricFillZero     MetricFill = "zero"     // 空桶取 0
+	MetricFillPrevious MetricFill = "previous" // 空桶沿用上一个桶的值
+)
+
+// MetricAggregateQuery 描述分桶聚合查询；桶按 BucketMs 对齐到 Unix 纪元，Percentile 取值 0~1，仅在 Agg 为 percentile 时使用。
+// 字符串类型的指标不参与聚合。
+type MetricAggregateQuery struct {
+	MetricQuery
+	BucketMs   int64
+	Agg        MetricAggregation
+	Percentile float64
+	Fill       MetricFill
+}
+
+// MetricBucket 是一个聚合桶，Timestamp 为桶起点；补齐的空桶 Count 为 0。
+type MetricBucket struct {
+	Timestamp int64    `json:"ts"`
+	Value     *float64 `json:"value"`
+	Count     int64    `json:"count"`
+}
+
+// MetricSeries 是单个指标名下的聚合结果。
+type MetricSeries struct {
+	Name   string         `json:"name"`
+	Unit   string         `json:"unit,omitempty"`
+	Points []MetricBucket `json:"points"`
+}
+
+// MetricBucketStart 返回时间戳所在桶的起点。
+func MetricBucketStart(ts, bucketMs int64) int64 {
+	return ts - ts%bucketMs
+}
+
+// MetricBucketCount 返回 [start, end] 窗口按 bucketMs 切分后的桶数。
+func MetricBucketCount(start, end, bucketMs int64) int64 {
+	if bucketMs <= 0 || end < start {
+		return 0
+	}
+	return (MetricBucketStart(end, bucketMs)-MetricBucketStart(start, bucketMs))/bucketMs + 1
+}
+
+// ParseMetricDuration 解析形如 `90s`、`15m`、`6h`、`3d`、`2w` 的指标时长。
+func ParseMetricDuration(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) < 2 {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+	units := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+	unit, ok := units[raw[len(raw)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+	n, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+	if err != nil || n <= 0 || n > int64(math.MaxInt64/unit) {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+	return time.Duration(n) * unit, nil
 }
 
 // ExternalEntity 外部集成平台实体（如 Home Assistant 中的 entity）
 type ExternalEntity struct {
+	TenantID    string                 `json:"tenant_id,omitempty"`
 	Source      string                 `json:"source"`
 	EntityID    string                 `json:"entity_id"`
 	Domain      string                 `json:"domain"`
@@ -82,6 +680,7 @@ type ExternalEntity struct {
 
 // ExternalObservation 外部实体观测值（通用多类型）
 type ExternalObservation struct {
+	TenantID  string                 `json:"tenant_id,omitempty"`
 	Source    string                 `json:"source"`
 	EntityID  string                 `json:"entity_id"`
 	Timestamp int64                  `json:"ts"`
@@ -94,6 +693,258 @@ type ExternalObservation struct {
 	RawEvent  map[string]interface{} `json:"raw_event,omitempty"`
 }
 
+// ExternalCommand 发往外部实体的命令，Payload 是交给集成平台的原始指令体。
+type ExternalCommand struct {
+	ID          int64                  `json:"id"`
+	TenantID    string                 `json:"tenant_id"`
+	Source      string                 `json:"source"`
+	EntityID    string                 `json:"entity_id"`
+	Command     string                 `json:"command"`
+	Payload     map[string]interface{} `json:"payload,omitempty"`
+	Status      ExternalCommandStatus  `json:"status"`
+	ErrorText   string                 `json:"error_text,omitempty"`
+	RequestedAt time.Time              `json:"requested_at"`
+	ExecutedAt  *time.Time             `json:"executed_at,omitempty"`
+}
+
+// ExternalEntityFilter 外部实体列表的过滤条件，空字段表示不过滤。
+type ExternalEntityFilter struct {
+	Source string
+	Domain string
+	Room   string
+}
+
+// DeviceState 设备状态点，按 (uuid, name, entity_id) 保留最新值，变更时追加历史。
+type DeviceState struct {
+	UUID      string                 `json:"uuid"`
+	Name      string                 `json:"name"`
+	EntityID  string                 `json:"entity_id,omitempty"`
+	ValueType string                 `json:"value_type"` // number | bool | string | json
+	ValueNum  *float64               `json:"value_num,omitempty"`
+	ValueText *string                `json:"value_text,omitempty"`
+	ValueBool *bool                  `json:"value_bool,omitempty"`
+	ValueJSON map[string]interface{} `json:"value_json,omitempty"`
+	Unit      string                 `json:"unit,omitempty"`
+	Endpoint  string                 `json:"endpoint,omitempty"`
+	Tags      map[string]string      `json:"tags,omitempty"`
+	Timestamp int64                  `json:"ts"`
+}
+
+// DeviceStateHistoryQuery 描述设备状态历史的查询条件。
+type DeviceStateHistoryQuery struct {
+	Name     string
+	EntityID string
+	Start    int64
+	End      int64
+	Limit    int
+}
+
+// ConnectivityStatus 设备连通性切换后的状态。
+type ConnectivityStatus string
+
+const (
+	ConnectivityOnline  ConnectivityStatus = "online"
+	ConnectivityOffline ConnectivityStatus = "offline"
+)
+
+// DeviceConnectivityEvent 记录设备一次在线/离线切换及其原因，例如 heartbeat、heartbeat_timeout、mqtt_disconnect。
+type DeviceConnectivityEvent struct {
+	ID        int64              `json:"id"`
+	UUID      string             `json:"uuid"`
+	Status    ConnectivityStatus `json:"status"`
+	Reason    string             `json:"reason"`
+	Timestamp int64              `json:"ts"`
+}
+
+// DeviceConnectivityQuery 描述连通性历史的查询条件。
+type DeviceConnectivityQuery struct {
+	Start int64
+	End   int64
+	Limit int
+}
+
+// DeviceDiagnostics 是设备心跳携带的运行诊断快照，例如 RSSI、电量、运行时长与剩余内存。
+// SampledAt 记录最近一次写入历史的上报时间，用于按采样间隔抽取历史。
+type DeviceDiagnostics struct {
+	UUID       string                 `json:"uuid"`
+	State      map[string]interface{} `json:"state"`
+	ObservedAt int64                  `json:"observed_at"`
+	ReceivedAt int64                  `json:"received_at,omitempty"`
+	SampledAt  int64                  `json:"-"`
+}
+
+// DeviceDiagnosticsQuery 描述诊断历史的查询条件。
+type DeviceDiagnosticsQuery struct {
+	Start int64
+	End   int64
+	Limit int
+}
+
+// DeviceTopologyNode 网关/子设备拓扑中的一个节点，ParentUUID 为空表示设备直连云端。
+type DeviceTopologyNode struct {
+	UUID           string `json:"uuid"`
+	ParentUUID     string `json:"parent_uuid,omitempty"`
+	Name           string `json:"name,omitempty"`
+	DeviceType     string `json:"device_type,omitempty"`
+	NetworkAddress string `json:"network_address,omitempty"`
+	UpdatedAt      int64  `json:"updated_at"`
+}
+
+// DeviceShadow 设备影子文档。
+// version 只在 desired 实际变化时递增，供管理端做乐观并发控制；reported_version 在 reported 变化时递增，
+// 两者分开计数，设备上报不会让管理端的 PATCH 因版本冲突失败。delta 为 desired 中尚未被 reported 满足的部分。
+type DeviceShadow struct {
+	UUID              string                 `json:"uuid"`
+	TenantID          string                 `json:"tenant_id"`
+	Desired           map[string]interface{} `json:"desired"`
+	Reported          map[string]interface{} `json:"reported"`
+	Delta             map[string]interface{} `json:"delta"`
+	Version           int64                  `json:"version"`
+	ReportedVersion   int64                  `json:"reported_version"`
+	DesiredUpdatedAt  int64                  `json:"desired_updated_at,omitempty"`
+	ReportedUpdatedAt int64                  `json:"reported_updated_at,omitempty"`
+}
+
+// IngestDedupeRecord 事件去重台账中的一条记录，保存首次处理的结果。
+// CompletedAt 为 0 表示该事件仍在处理中。
+type IngestDedupeRecord struct {
+	TenantID     string
+	Key          string
+	EventID      string
+	UUID         string
+	Success      bool
+	ErrorCode    string
+	ErrorMessage string
+	CreatedAt    int64
+	CompletedAt  int64
+	ExpiresAt    int64
+}
+
+// RetentionDataClass 是保留策略管理的数据类别。
+type RetentionDataClass string
+
+const (
+	RetentionMetrics       RetentionDataClass = "metrics"        // 原始指标，过期后汇总进小时表
+	RetentionMetricsHourly RetentionDataClass = "metrics_hourly" // 小时汇总，过期后汇总进天表
+	RetentionMetricsDaily  RetentionDataClass = "metrics_daily"  // 天汇总
+	RetentionLogs          RetentionDataClass = "logs"
+	RetentionCommands      RetentionDataClass = "commands"     // 只清理已结束的下行指令
+	RetentionObservations  RetentionDataClass = "observations" // 外部集成观测值
+)
+
+// RetentionDataClasses 按清理顺序列出全部类别，原始指标必须先于小时汇总处理。
+var RetentionDataClasses = []RetentionDataClass{
+	RetentionMetrics,
+	RetentionMetricsHourly,
+	RetentionMetricsDaily,
+	RetentionLogs,
+	RetentionCommands,
+	RetentionObservations,
+}
+
+// Valid 判断数据类别是否受支持。
+func (c RetentionDataClass) Valid() bool {
+	for _, class := range RetentionDataClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// RetentionPolicySource 标明生效保留期来自平台默认值还是租户覆盖。
+type RetentionPolicySource string
+
+const (
+	RetentionSourceDefault RetentionPolicySource = "default"
+	RetentionSourceTenant  RetentionPolicySource = "tenant"
+)
+
+// RetentionPolicy 是某类数据的保留期，RetentionMs 为 0 表示永久保留。
+type RetentionPolicy struct {
+	TenantID    string                `json:"tenant_id"`
+	DataClass   RetentionDataClass    `json:"data_class"`
+	RetentionMs int64                 `json:"retention_ms"`
+	Source      RetentionPolicySource `json:"source"`
+	UpdatedBy   string                `json:"updated_by,omitempty"`
+	UpdatedAt   *time.Time            `json:"updated_at,omitempty"`
+}
+
+// RetentionTarget 描述一批清理的范围：早于 Before（毫秒）的数据；TenantIDs 非空时只处理这些租户，
+// 否则处理 ExcludeTenantIDs 以外的全部租户。
+type RetentionTarget struct {
+	Before           int64
+	TenantIDs        []string
+	ExcludeTenantIDs []string
+}
+
+// RetentionBatchResult 是一批清理的结果，RolledUp 为写入或合并的汇总行数。
+type RetentionBatchResult struct {
+	Deleted  int64
+	RolledUp int64
+}
+
+// RetentionClassProgress 是单个数据类别在一次清理中的累计进度。
+type RetentionClassProgress struct {
+	Deleted  int64 `json:"deleted"`
+	RolledUp int64 `json:"rolled_up"`
+	Batches  int64 `json:"batches"`
+}
+
+// RetentionProgress 描述当前或最近一次清理的进度。
+type RetentionProgress struct {
+	Running      bool                                          `json:"running"`
+	Runs         int64                                         `json:"runs"`
+	CurrentClass RetentionDataClass                            `json:"current_class,omitempty"`
+	StartedAt    *time.Time                                    `json:"started_at,omitempty"`
+	FinishedAt   *time.Time                                    `json:"finished_at,omitempty"`
+	LastError    string                                        `json:"last_error,omitempty"`
+	Classes      map[RetentionDataClass]RetentionClassProgress `json:"classes"`
+}
+
+// IngressCredentialStatus adapter 凭据状态
+type IngressCredentialStatus string
+
+const (
+	IngressCredentialStatusActive  IngressCredentialStatus = "active"
+	IngressCredentialStatusRevoked IngressCredentialStatus = "revoked"
+)
+
+// IngressCredential 是 Core 签发给 protocol-ingress 的服务间凭据。
+// 凭据绑定一个 ingress 实例；Adapters 与 TenantIDs 为空表示不限制。
+type IngressCredential struct {
+	ID          string                  `json:"id"`
+	Name        string                  `json:"name"`
+	InstanceID  string                  `json:"instance_id"`
+	Adapters    []string                `json:"adapters"`
+	TenantIDs   []string                `json:"tenant_ids"`
+	TokenPrefix string                  `json:"token_prefix"`
+	Status      IngressCredentialStatus `json:"status"`
+	CreatedBy   string                  `json:"created_by,omitempty"`
+	CreatedAt   time.Time               `json:"created_at"`
+	RotatedAt   *time.Time              `json:"rotated_at,omitempty"`
+	RevokedAt   *time.Time              `json:"revoked_at,omitempty"`
+}
+
+// AllowsAdapter 判断凭据是否允许以 adapterID 的身份调用。
+func (c IngressCredential) AllowsAdapter(adapterID string) bool {
+	return len(c.Adapters) == 0 || containsString(c.Adapters, adapterID)
+}
+
+// AllowsTenant 判断凭据是否允许处理 tenantID 下的设备。
+func (c IngressCredential) AllowsTenant(tenantID string) bool {
+	return len(c.TenantIDs) == 0 || containsString(c.TenantIDs, tenantID)
+}
+
+func containsString(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
+
 // DeviceRepository 描述设备主档、令牌与生命周期相关的持久化能力。
 type DeviceRepository interface {
 	// InitDevice 初始化一个新的设备存储空间。
@@ -111,6 +962,12 @@ type DeviceRepository interface {
 	// SaveMetadata 将元信息持久化到存储中。
 	SaveMetadata(uuid string, meta DeviceMetadata) error
 
+	// SaveDescriptor 刷新设备上报的版本与扩展描述，不改动名称、Token 与认证状态；空版本号保留原值。
+	SaveDescriptor(uuid string, meta DeviceMetadata) error
+
+	// SaveDeviceCapabilities 只替换设备的能力列表，用于发现流程中单独上报的能力。
+	SaveDeviceCapabilities(uuid string, capabilities []DeviceCapability) error
+
 	// ListDevices 分页查询已注册的设备列表。
 	ListDevices(page, size int) ([]DeviceRecord, error)
 
@@ -124,6 +981,18 @@ type DeviceRepository interface {
 	UpdateToken(uuid string, newToken string) error
 }
 
+// DeviceIdentityRepository 描述设备身份登记与解析能力。
+type DeviceIdentityRepository interface {
+	// BindDeviceIdentities 把身份登记到设备，已属于其他设备的身份保持不变。
+	BindDeviceIdentities(uuid string, identities []DeviceIdentity) error
+
+	// ResolveDeviceIdentities 按给定顺序查找第一个已登记的身份对应的设备，未命中时返回 ErrDeviceNotFound。
+	ResolveDeviceIdentities(identities []DeviceIdentity) (uuid string, err error)
+
+	// ListDeviceIdentities 列出设备已登记的身份。
+	ListDeviceIdentities(uuid string) ([]DeviceIdentity, error)
+}
+
 // ScopedDeviceRepository 描述带租户范围约束的设备查询能力。
 type ScopedDeviceRepository interface {
 	// ResolveDeviceTenant 查询设备所属租户。
@@ -142,6 +1011,17 @@ type MetricsRepository interface {
 	BatchAppendMetrics(uuid string, points []MetricPoint) error
 	QueryMetrics(uuid string, start, end int64) ([]MetricPoint, error)
 	QueryMetricsByTenant(tenantID, uuid string, start, end int64) ([]MetricPoint, error)
+
+	// QueryMetricSeries 在租户范围内按名称、实体与标签过滤设备指标，按时间升序返回。
+	QueryMetricSeries(tenantID, uuid string, query MetricQuery) ([]MetricPoint, error)
+	// AggregateMetricSeries 在数据库内按桶聚合指标，按指标名分组返回，并按 Fill 补齐空桶。
+	// avg/min/max/sum/count 同时读取原始指标过期后留下的小时与天汇总，first/last/percentile 与带标签的查询只基于原始指标。
+	AggregateMetricSeries(tenantID, uuid string, query MetricAggregateQuery) ([]MetricSeries, error)
+	// LatestMetrics 按设备分组返回每个序列（名称、实体与 legacy type 相同）的最新一条；
+	// tenantID 为空时不限租户，uuids 为空时不限设备。
+	LatestMetrics(tenantID string, uuids []string) (map[string][]MetricPoint, error)
+	// RecentMetricDevices 返回 since（毫秒）之后上报过指标的设备，按最近上报时间倒序，最多 limit 台。
+	RecentMetricDevices(since int64, limit int) ([]string, error)
 }
 
 // DeviceLogRepository 描述设备日志的持久化能力。
@@ -153,7 +1033,138 @@ type DeviceLogRepository interface {
 type DeviceCommandRepository interface {
 	CreateDeviceCommand(uuid string, cmdID CmdID, command string, payloadJSON []byte) (int64, error)
 	CreateDeviceCommandByTenant(tenantID, uuid string, cmdID CmdID, command string, payloadJSON []byte) (int64, error)
+	// UpdateDeviceCommandStatus 只更新排队中或已发送的指令，指令已结束时返回 ErrDeviceCommandFinished。
 	UpdateDeviceCommandStatus(commandID int64, status DeviceCommandStatus, errorText string) error
+	// CreateDeviceCommandWithPolicy 在租户范围内创建带有效期与重试限制的指令
+	CreateDeviceCommandWithPolicy(tenantID, uuid string, cmdID CmdID, command string, payloadJSON []byte, policy DeviceCommandPolicy) (int64, error)
+	// GetDeviceCommand 读取单条指令记录
+	GetDeviceCommand(commandID int64) (DeviceCommand, error)
+	// MarkDeviceCommandSent 标记指令已发送、累加发送次数并记录投递方，ackDeadline 为空表示不等待确认超时；
+	// 指令已不在 queued/sent 时返回 ErrDeviceCommandNotQueued
+	MarkDeviceCommandSent(commandID int64, sentAt time.Time, ackDeadline *time.Time, via CommandDelivery) error
+	// GetDeviceCommandByTenant 在租户范围内读取指令，不存在或不属于该租户时返回 ErrDeviceCommandNotFound
+	GetDeviceCommandByTenant(tenantID string, commandID int64) (DeviceCommand, error)
+	// ListDeviceCommandsByTenant 在租户范围内按 id 倒序列出设备的指令历史
+	ListDeviceCommandsByTenant(tenantID, uuid string, query DeviceCommandQuery) ([]DeviceCommand, error)
+	// SupersedeDeviceCommands 把同设备同名同键、id 小于 newerID 的 queued 指令标记为 cancelled，返回被替换的指令 id
+	SupersedeDeviceCommands(uuid, command, key string, newerID int64) ([]int64, error)
+	// ListStaleDeviceCommands 列出已过有效期的 queued 指令与确认超时的 sent 指令
+	ListStaleDeviceCommands(now time.Time, limit int) ([]DeviceCommand, error)
+	// TransitionDeviceCommandStatus 仅当指令仍处于 from 状态时更新，返回是否发生了更新
+	TransitionDeviceCommandStatus(commandID int64, from, to DeviceCommandStatus, errorText string) (bool, error)
+}
+
+// DeviceCommandQueueRepository 描述以 device_commands 表作为设备下行队列的能力。
+// 队列成员是 queued 状态且未被领取（或领取早于 claimedBefore、租约已过期）的指令，按 queue_order、id 排序。
+type DeviceCommandQueueRepository interface {
+	// TrimDeviceCommandQueue 在队列超过 capacity 时把排在最前的指令标记为 overflow，返回被淘汰的指令 ID
+	TrimDeviceCommandQueue(uuid string, capacity int, claimedBefore time.Time) ([]int64, error)
+	// RequeueDeviceCommandFront 把 queued/sent 的指令恢复为 queued 并排到队首，其他状态返回 ErrDeviceCommandNotQueued；
+	// 队列超过 capacity 时淘汰排在最后的其他指令
+	RequeueDeviceCommandFront(uuid string, commandID int64, capacity int, claimedBefore time.Time) ([]int64, error)
+	// ClaimNextDeviceCommand 领取队首指令并记录领取时间，队列为空时返回 false
+	ClaimNextDeviceCommand(uuid string, now, claimedBefore time.Time) (DeviceCommand, bool, error)
+	// RenewDeviceCommandClaims 把仍在排队的已领取指令的领取时间刷新为 now
+	RenewDeviceCommandClaims(commandIDs []int64, now time.Time) error
+	// CountQueuedDeviceCommands 统计设备队列中的指令数
+	CountQueuedDeviceCommands(uuid string, claimedBefore time.Time) (int, error)
+}
+
+// CommandScheduleRepository 描述指令计划的持久化与触发抢占能力。
+type CommandScheduleRepository interface {
+	CreateCommandSchedule(schedule CommandSchedule) (int64, error)
+	// GetCommandSchedule 在租户范围内读取计划，不存在时返回 ErrCommandScheduleNotFound
+	GetCommandSchedule(tenantID string, id int64) (CommandSchedule, error)
+	// ListCommandSchedules 列出租户的计划，uuid 非空时只返回该设备的计划
+	ListCommandSchedules(tenantID, uuid string) ([]CommandSchedule, error)
+	// UpdateCommandSchedule 覆盖计划定义与下一次触发时间，并使进行中的触发抢占失效
+	UpdateCommandSchedule(schedule CommandSchedule) error
+	DeleteCommandSchedule(tenantID string, id int64) error
+	// ListDueCommandSchedules 列出已启用且 next_run_at 不晚于 now 的计划
+	ListDueCommandSchedules(now time.Time, limit int) ([]CommandSchedule, error)
+	// ClaimCommandScheduleRun 仅当计划仍处于 revision 时记录本次触发并把下一次触发推进到 next，next 为空表示停用计划；返回是否抢占成功
+	ClaimCommandScheduleRun(id, revision int64, ranAt time.Time, next *time.Time) (bool, error)
+	// RecordCommandScheduleResult 记录最近一次触发的错误，errorText 为空表示成功
+	RecordCommandScheduleResult(id int64, errorText string) error
+}
+
+// DeviceGroupRepository 描述设备分组与成员关系的持久化能力。
+type DeviceGroupRepository interface {
+	// CreateDeviceGroup 创建分组并生成 ID，同租户内重名时返回 ErrDeviceGroupExists
+	CreateDeviceGroup(group DeviceGroup) (DeviceGroup, error)
+	// GetDeviceGroup 在租户范围内读取分组，不存在时返回 ErrDeviceGroupNotFound
+	GetDeviceGroup(tenantID, groupID string) (DeviceGroup, error)
+	// ListDeviceGroups 分页列出租户的分组，同时返回分组总数
+	ListDeviceGroups(tenantID string, page, size int) ([]DeviceGroup, int, error)
+	// UpdateDeviceGroup 更新分组名称与描述
+	UpdateDeviceGroup(group DeviceGroup) (DeviceGroup, error)
+	// DeleteDeviceGroup 删除分组及其成员关系，设备本身不受影响
+	DeleteDeviceGroup(tenantID, groupID string) error
+	// AddGroupDevice 把设备加入分组，已在分组内时返回 ErrGroupDeviceExists
+	AddGroupDevice(groupID, uuid string) error
+	// RemoveGroupDevice 把设备移出分组，不在分组内时返回 ErrGroupDeviceNotFound
+	RemoveGroupDevice(groupID, uuid string) error
+	// ListGroupDevices 分页列出分组内的设备
+	ListGroupDevices(groupID string, page, size int) ([]DeviceRecord, error)
+}
+
+// CommandBatchRepository 描述批量下发任务的持久化能力。
+type CommandBatchRepository interface {
+	// CreateCommandBatch 在同一事务中写入任务与 batch.Items 中的目标设备，设备初始为尚未入队
+	CreateCommandBatch(batch CommandBatch) (int64, error)
+	// AddCommandBatchItem 记录单台设备的入队结果，覆盖该设备已有的记录
+	AddCommandBatchItem(batchID int64, item CommandBatchItem) error
+	// ListUnfinishedCommandBatches 列出仍有设备尚未入队的任务，Items 只包含这些设备
+	ListUnfinishedCommandBatches() ([]CommandBatch, error)
+	// GetCommandBatch 在租户范围内读取任务及各设备指令的当前状态，不存在时返回 ErrCommandBatchNotFound
+	GetCommandBatch(tenantID string, id int64) (CommandBatch, error)
+	// ListCommandBatches 按 id 倒序列出租户最近的任务，包含各设备指令的当前状态
+	ListCommandBatches(tenantID string, limit int) ([]CommandBatch, error)
+}
+
+// OtaRepository 描述固件镜像与升级活动的持久化能力。
+type OtaRepository interface {
+	// CreateFirmwareArtifact 保存镜像，ID 为空时自动生成
+	CreateFirmwareArtifact(artifact FirmwareArtifact) (FirmwareArtifact, error)
+	// GetFirmwareArtifact 在租户范围内读取镜像元数据，不加载 Content，不存在时返回 ErrFirmwareArtifactNotFound
+	GetFirmwareArtifact(tenantID, id string) (FirmwareArtifact, error)
+	ListFirmwareArtifacts(tenantID string, limit int) ([]FirmwareArtifact, error)
+	// DeleteFirmwareArtifact 删除镜像，仍被升级活动引用时返回 ErrFirmwareArtifactInUse
+	DeleteFirmwareArtifact(tenantID, id string) error
+	// ReadFirmwareChunk 读取镜像从 offset 开始的最多 length 个字节
+	ReadFirmwareChunk(id string, offset int64, length int) ([]byte, error)
+	// CreateOtaCampaign 在同一事务中写入活动与全部目标设备
+	CreateOtaCampaign(campaign OtaCampaign, devices []OtaDevice) (int64, error)
+	// GetOtaCampaign 在租户范围内读取活动，不存在时返回 ErrOtaCampaignNotFound
+	GetOtaCampaign(tenantID string, id int64) (OtaCampaign, error)
+	// ListOtaCampaigns 按 id 倒序列出租户最近的活动
+	ListOtaCampaigns(tenantID string, limit int) ([]OtaCampaign, error)
+	// ListActiveOtaCampaigns 列出所有租户中运行或暂停的活动，供后台推进
+	ListActiveOtaCampaigns() ([]OtaCampaign, error)
+	// UpdateOtaCampaignState 更新活动状态与放量比例
+	UpdateOtaCampaignState(id int64, status OtaCampaignStatus, rolloutPercent int) error
+	// ListOtaDevices 按 uuid 升序列出活动内的设备进度
+	ListOtaDevices(campaignID int64) ([]OtaDevice, error)
+	// UpdateOtaDevice 在 revision 仍为 expectedRevision 时写入进度并使 revision 加一，返回是否写入成功
+	UpdateOtaDevice(device OtaDevice, expectedRevision int64) (bool, error)
+}
+
+// DeviceConfigRepository 描述配置文档、设备配置对账状态与确认审计的持久化能力。
+type DeviceConfigRepository interface {
+	// CreateConfigDocument 以作用对象当前最大版本号加一写入文档，返回写入后的文档
+	CreateConfigDocument(doc ConfigDocument) (ConfigDocument, error)
+	// GetConfigDocument 读取指定版本，version 为 0 时读取最新版本，不存在时返回 ErrConfigDocumentNotFound
+	GetConfigDocument(tenantID string, scopeType ConfigScopeType, scopeID string, version int64) (ConfigDocument, error)
+	// ListConfigDocuments 按版本倒序列出作用对象的历史版本
+	ListConfigDocuments(tenantID string, scopeType ConfigScopeType, scopeID string, limit int) ([]ConfigDocument, error)
+	// ListDeviceConfigLayers 按租户、分组（按分组 ID 升序）、设备的顺序返回设备各层的最新版本，没有文档的层不出现
+	ListDeviceConfigLayers(tenantID, uuid string) ([]ConfigDocument, error)
+	// GetDeviceConfigState 读取设备对账状态，尚无记录时返回只填充 UUID 的零值
+	GetDeviceConfigState(uuid string) (DeviceConfigState, error)
+	SaveDeviceConfigState(state DeviceConfigState) error
+	RecordDeviceConfigAck(ack DeviceConfigAck) error
+	// ListDeviceConfigAcks 按确认时间倒序列出设备的确认记录
+	ListDeviceConfigAcks(tenantID, uuid string, limit int) ([]DeviceConfigAck, error)
 }
 
 // ExternalEntityRepository 描述外部集成实体与观测值的持久化能力。
@@ -163,6 +1174,129 @@ type ExternalEntityRepository interface {
 	ListExternalEntities(source, domain string, limit, offset int) ([]ExternalEntity, error)
 	BatchAppendExternalObservations(items []ExternalObservation) error
 	QueryExternalObservations(source, entityID string, start, end int64, limit int) ([]ExternalObservation, error)
+
+	// GetExternalEntityByTenant 在指定租户范围内读取外部实体，不存在时返回 ErrExternalEntityNotFound。
+	GetExternalEntityByTenant(tenantID, source, entityID string) (ExternalEntity, error)
+
+	// ListExternalEntitiesByTenant 按条件分页列出外部实体，tenantID 为空时不按租户过滤。
+	ListExternalEntitiesByTenant(tenantID string, filter ExternalEntityFilter, limit, offset int) ([]ExternalEntity, error)
+
+	// QueryExternalObservationsByTenant 在指定租户范围内查询外部观测值。
+	QueryExternalObservationsByTenant(tenantID, source, entityID string, start, end int64, limit int) ([]ExternalObservation, error)
+
+	// UpdateExternalEntityLink 修改外部实体关联的 Goster 设备，gosterUUID 为空表示解除关联。
+	UpdateExternalEntityLink(tenantID, source, entityID, gosterUUID string) error
+}
+
+// ExternalCommandRepository 描述外部实体命令的持久化能力。
+type ExternalCommandRepository interface {
+	CreateExternalCommand(cmd ExternalCommand) (ExternalCommand, error)
+	GetExternalCommand(id int64) (ExternalCommand, error)
+	ListExternalCommandsByTenant(tenantID, source, entityID string, limit int) ([]ExternalCommand, error)
+
+	// ClaimPendingExternalCommands 领取租户内某个外部设备下待发送的命令；领取有租约，sent 由 adapter 发布成功后回执。
+	ClaimPendingExternalCommands(tenantID, source, deviceID string, limit int) ([]ExternalCommand, error)
+
+	// RenewExternalCommandClaims 续期租户内仍为 pending 的已领取命令的租约。
+	RenewExternalCommandClaims(tenantID string, ids []int64) error
+
+	// UpdateExternalCommandStatus 回填租户内命令的状态，同时刷新 executed_at；
+	// 命令已是 acked/failed 时返回 ErrExternalCommandFinished。
+	UpdateExternalCommandStatus(tenantID string, id int64, status ExternalCommandStatus, errorText string) error
+}
+
+// DeviceStateRepository 描述设备状态最新值与变更历史的持久化能力。
+type DeviceStateRepository interface {
+	UpsertDeviceStates(uuid string, states []DeviceState) error
+	ListDeviceStatesByTenant(tenantID, uuid string) ([]DeviceState, error)
+	QueryDeviceStateHistoryByTenant(tenantID, uuid string, query DeviceStateHistoryQuery) ([]DeviceState, error)
+}
+
+// DeviceDiagnosticsRepository 描述设备诊断快照与采样历史的持久化能力。
+type DeviceDiagnosticsRepository interface {
+	// SaveDeviceDiagnostics 覆盖最新快照；appendHistory 为 true 时同时写入一条历史并推进 SampledAt。
+	SaveDeviceDiagnostics(diagnostics DeviceDiagnostics, appendHistory bool) error
+
+	// GetDeviceDiagnosticsByTenant 读取最新快照，没有心跳记录时返回 ErrDeviceDiagnosticsNotFound。
+	GetDeviceDiagnosticsByTenant(tenantID, uuid string) (DeviceDiagnostics, error)
+
+	QueryDeviceDiagnosticsHistoryByTenant(tenantID, uuid string, query DeviceDiagnosticsQuery) ([]DeviceDiagnostics, error)
+}
+
+// DeviceConnectivityRepository 描述设备连通性历史的持久化能力。
+type DeviceConnectivityRepository interface {
+	AppendDeviceConnectivityEvent(event DeviceConnectivityEvent) error
+	QueryDeviceConnectivityByTenant(tenantID, uuid string, query DeviceConnectivityQuery) ([]DeviceConnectivityEvent, error)
+}
+
+// DeviceTopologyRepository 描述网关/子设备拓扑的持久化能力。
+type DeviceTopologyRepository interface {
+	// UpsertDeviceTopologyNode 写入单个节点；ParentUUID 为空时保留已有的上级。
+	UpsertDeviceTopologyNode(tenantID string, node DeviceTopologyNode) error
+
+	// ReplaceDeviceChildren 用快照替换网关的直连子设备，不在快照中的旧子设备会被解除挂载。
+	ReplaceDeviceChildren(tenantID, parentUUID string, children []DeviceTopologyNode) error
+
+	// GetDeviceTopologyNode 读取节点，不存在时返回 ErrDeviceTopologyNotFound。
+	GetDeviceTopologyNode(tenantID, uuid string) (DeviceTopologyNode, error)
+
+	ListDeviceChildren(tenantID, parentUUID string) ([]DeviceTopologyNode, error)
+}
+
+// DeviceShadowRepository 描述设备影子文档的持久化能力。
+type DeviceShadowRepository interface {
+	// GetDeviceShadow 读取设备影子，不存在时返回 ErrDeviceShadowNotFound。
+	GetDeviceShadow(uuid string) (DeviceShadow, error)
+
+	// GetDeviceShadowByTenant 在指定租户范围内读取设备影子。
+	GetDeviceShadowByTenant(tenantID, uuid string) (DeviceShadow, error)
+
+	// SaveDeviceShadow 以 expectedVersion 做比较后写入 desired，版本不一致时返回 ErrDeviceShadowConflict。
+	SaveDeviceShadow(shadow DeviceShadow, expectedVersion int64) (DeviceShadow, error)
+
+	// SaveDeviceShadowReported 以 expectedReportedVersion 做比较后写入 reported，不改变 desired 的版本。
+	SaveDeviceShadowReported(shadow DeviceShadow, expectedReportedVersion int64) (DeviceShadow, error)
+}
+
+// IngestDedupeRepository 描述事件去重台账的持久化能力。
+type IngestDedupeRepository interface {
+	// ReserveIngestDedupe 尝试占用 tenant+key；已被占用且未过期时返回已有记录和 false。
+	ReserveIngestDedupe(record IngestDedupeRecord) (IngestDedupeRecord, bool, error)
+
+	// CompleteIngestDedupe 写入首次处理的结果和新的过期时间。
+	CompleteIngestDedupe(record IngestDedupeRecord) error
+
+	// ReleaseIngestDedupe 删除占用记录，让失败的事件可以重试。
+	ReleaseIngestDedupe(tenantID, key string) error
+
+	// DeleteExpiredIngestDedupe 分批删除 expires_at 早于 before 的记录，返回删除条数。
+	DeleteExpiredIngestDedupe(before int64, limit int) (int64, error)
+}
+
+// RetentionRepository 描述保留策略与分批清理的持久化能力。
+type RetentionRepository interface {
+	// ListRetentionPolicies 列出租户覆盖的保留策略；tenantID 为空时列出全部租户。
+	ListRetentionPolicies(tenantID string) ([]RetentionPolicy, error)
+
+	UpsertRetentionPolicy(policy RetentionPolicy) (RetentionPolicy, error)
+
+	// DeleteRetentionPolicy 删除租户覆盖，返回是否存在。
+	DeleteRetentionPolicy(tenantID string, class RetentionDataClass) (bool, error)
+
+	// PruneRetentionBatch 在一个事务内清理至多 limit 行过期数据；指标类别会先把删除的行合并进下一级汇总表。
+	PruneRetentionBatch(class RetentionDataClass, target RetentionTarget, limit int) (RetentionBatchResult, error)
+}
+
+// IngressCredentialRepository 描述 adapter 凭据的持久化能力，库中只保存令牌摘要。
+type IngressCredentialRepository interface {
+	CreateIngressCredential(cred IngressCredential, tokenHash string) error
+	GetIngressCredential(id string) (IngressCredential, error)
+	// GetIngressCredentialByTokenHash 按令牌摘要查找凭据，包含已吊销的凭据。
+	GetIngressCredentialByTokenHash(tokenHash string) (IngressCredential, error)
+	ListIngressCredentials() ([]IngressCredential, error)
+	// RotateIngressCredential 替换活动凭据的令牌摘要，凭据不存在或已吊销时返回对应错误。
+	RotateIngressCredential(id, tokenHash, tokenPrefix string, rotatedAt time.Time) error
+	RevokeIngressCredential(id string, revokedAt time.Time) error
 }
 
 // UserRepository 描述平台用户与权限的持久化能力。
@@ -214,6 +1348,7 @@ type TenantRepository interface {
 type DeviceRegistryStore interface {
 	DeviceRepository
 	ScopedDeviceRepository
+	DeviceIdentityRepository
 }
 
 // TelemetryStore 是遥测接收服务依赖的最小仓储组合。
@@ -227,7 +1362,22 @@ type CoreStore interface {
 	DeviceRegistryStore
 	TelemetryStore
 	DeviceCommandRepository
+	DeviceCommandQueueRepository
+	CommandScheduleRepository
+	CommandBatchRepository
+	DeviceGroupRepository
+	OtaRepository
+	DeviceConfigRepository
 	ExternalEntityRepository
+	ExternalCommandRepository
+	DeviceStateRepository
+	DeviceShadowRepository
+	DeviceConnectivityRepository
+	DeviceDiagnosticsRepository
+	DeviceTopologyRepository
+	IngestDedupeRepository
+	IngressCredentialRepository
+	RetentionRepository
 }
 
 // WebV1Store 是当前 v1 HTTP 接口依赖的最小仓储组合。
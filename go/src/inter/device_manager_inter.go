@@ -1,6 +1,7 @@
 package inter
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -75,6 +76,18 @@ type DeviceRegistry interface {
 
 	// GetDeviceMetadataByScope 在给定授权范围内查询设备详情。
 	GetDeviceMetadataByScope(scope Scope, uuid string) (DeviceMetadata, error)
+
+	// ResolveDevice 按 mac、sn、ieee_address、client_id 等身份查找已登记的设备，未命中时返回 ErrDeviceNotFound。
+	ResolveDevice(identities []DeviceIdentity) (uuid string, err error)
+
+	// RefreshDevice 用重新上报的描述刷新版本与扩展信息，并登记新出现的身份。
+	RefreshDevice(uuid string, meta DeviceMetadata) error
+
+	// BindIdentities 把身份登记到设备，已属于其他设备的身份不会被改绑。
+	BindIdentities(uuid string, identities []DeviceIdentity) error
+
+	// UpdateCapabilities 用注册或发现时上报的能力替换设备的能力列表，空列表不做修改。
+	UpdateCapabilities(uuid string, capabilities []DeviceCapability) error
 }
 
 // DevicePresence 定义设备在线状态能力。
@@ -84,10 +97,31 @@ type DevicePresence interface {
 
 	// QueryDeviceStatus 查询设备在线状态
 	QueryDeviceStatus(uuid string) (DeviceStatus, error)
+
+	// ReportAvailability 处理显式的上线/离线信号（availability 事件、连接断开等），立即更新在线状态。
+	ReportAvailability(uuid string, online bool, reason string)
+
+	// QueryConnectivityHistory 在授权范围内查询设备的在线/离线切换历史。
+	QueryConnectivityHistory(scope Scope, uuid string, query DeviceConnectivityQuery) ([]DeviceConnectivityEvent, error)
+
+	// Run 周期扫描心跳超时的设备并记录离线切换，直到 ctx 结束。
+	Run(ctx context.Context)
+}
+
+// DeviceDiagnosticsService 定义心跳诊断的记录与查询能力。
+type DeviceDiagnosticsService interface {
+	// RecordHeartbeat 保存心跳 state 为最新诊断，按采样间隔写入历史，并把配置的键转写为指标。
+	RecordHeartbeat(uuid string, state map[string]interface{}, observedAt int64) error
+
+	// LatestDiagnostics 在授权范围内读取最新诊断，没有心跳记录时返回 ErrDeviceDiagnosticsNotFound。
+	LatestDiagnostics(scope Scope, uuid string) (DeviceDiagnostics, error)
+
+	// QueryDiagnosticsHistory 在授权范围内查询采样后的诊断历史。
+	QueryDiagnosticsHistory(scope Scope, uuid string, query DeviceDiagnosticsQuery) ([]DeviceDiagnostics, error)
 }
 
 // DeviceCommandQueue 定义面向设备的下行命令缓冲能力。
-// 当前默认实现仍在内存中，后续可替换为 Redis 等共享队列。
+// 默认实现在内存中；database 实现以 device_commands 表为准，重启后继续投递。
 type DeviceCommandQueue interface {
 	// Enqueue 将下行消息推入设备队列。
 	Enqueue(uuid string, message DownlinkMessage) error
@@ -97,17 +131,176 @@ type DeviceCommandQueue interface {
 	Dequeue(uuid string) (DownlinkMessage, bool, error)
 	// IsEmpty 检查设备队列是否为空。
 	IsEmpty(uuid string) bool
+	// Remove 从设备队列中移除指定指令，指令不在队列中时不报错。
+	Remove(uuid string, commandID int64) error
+	// Renew 延长已出队但尚未标记发送的指令的领取租约；没有领取租约的实现直接返回 nil。
+	Renew(commandIDs []int64) error
 }
 
 // DownlinkCommandService 定义下行命令的编排能力。
 // 它负责命令持久化、入队以及发送状态流转，避免由 Web 或 Gateway 直接操作底层队列和命令表。
 type DownlinkCommandService interface {
 	Enqueue(scope Scope, uuid string, cmdID CmdID, command string, payloadJSON []byte) (DownlinkMessage, error)
+	// EnqueueWithPolicy 按给定有效期与重试限制入队，零值字段使用配置默认值。
+	EnqueueWithPolicy(scope Scope, uuid string, cmdID CmdID, command string, payloadJSON []byte, policy DeviceCommandPolicy) (DownlinkMessage, error)
 	PopDownlink(uuid string) (DownlinkMessage, bool, error)
+	// Requeue 把发送失败的指令放回队列；已过期或发送次数耗尽的指令不再回队。
 	Requeue(uuid string, message DownlinkMessage) error
 	MarkSent(commandID int64) error
+	// MarkSentVia 标记指令已发送，并记录投递它的 ingress 实例与 adapter。
+	MarkSentVia(commandID int64, via CommandDelivery) error
 	MarkAcked(commandID int64) error
 	MarkFailed(commandID int64, errorText string) error
+	MarkExpired(commandID int64, errorText string) error
+	// RenewClaims 续期已推送给 ingress、尚未回执发送的指令的领取租约，避免租约到期后被重复投递。
+	RenewClaims(commandIDs []int64) error
+	// Cancel 在授权范围内取消仍在排队的指令；已发送或已结束的指令返回 ErrDeviceCommandNotQueued。
+	Cancel(scope Scope, commandID int64, reason string) (DeviceCommand, error)
+	// GetCommand 在授权范围内读取单条指令，不存在时返回 ErrDeviceCommandNotFound。
+	GetCommand(scope Scope, commandID int64) (DeviceCommand, error)
+	// LookupCommand 不做授权检查地读取指令，供 ingress 校验回执所属设备。
+	LookupCommand(commandID int64) (DeviceCommand, error)
+	// ListCommands 在授权范围内查询设备的指令历史，next 是下一页的 BeforeID 游标，没有更多记录时为 0。
+	ListCommands(scope Scope, uuid string, query DeviceCommandQuery) (items []DeviceCommand, next int64, err error)
+	// ExpireStale 把过期未发送与确认超时的指令标记为 expired，返回处理条数。
+	ExpireStale() (int64, error)
+	// Run 按配置间隔周期执行 ExpireStale，直到 ctx 结束。
+	Run(ctx context.Context)
+}
+
+// CommandScheduleService 管理指令计划，并按时把到期计划物化为设备下行指令。
+type CommandScheduleService interface {
+	// Create 校验并保存计划，计算首次触发时间。
+	Create(scope Scope, schedule CommandSchedule) (CommandSchedule, error)
+	Get(scope Scope, id int64) (CommandSchedule, error)
+	// List 列出授权范围内的计划，uuid 非空时只返回该设备的计划。
+	List(scope Scope, uuid string) ([]CommandSchedule, error)
+	// Update 覆盖计划定义并重新计算下一次触发时间。
+	Update(scope Scope, schedule CommandSchedule) (CommandSchedule, error)
+	Delete(scope Scope, id int64) error
+	// RunDue 触发全部到期计划，返回本实例抢占成功的触发次数。
+	RunDue() (int, error)
+	// Run 按配置间隔周期执行 RunDue，直到 ctx 结束。
+	Run(ctx context.Context)
+}
+
+// DeviceGroupService 在授权租户内管理设备分组与成员关系。
+type DeviceGroupService interface {
+	Create(scope Scope, group DeviceGroup) (DeviceGroup, error)
+	Get(scope Scope, groupID string) (DeviceGroup, error)
+	// List 分页列出分组，同时返回分组总数。
+	List(scope Scope, page, size int) ([]DeviceGroup, int, error)
+	// Update 只更新非 nil 的字段。
+	Update(scope Scope, groupID string, name, description *string) (DeviceGroup, error)
+	Delete(scope Scope, groupID string) error
+	// AddDevice 把同租户的设备加入分组，其他租户的设备返回 ErrDeviceTenantMismatch。
+	AddDevice(scope Scope, groupID, uuid string) error
+	RemoveDevice(scope Scope, groupID, uuid string) error
+	ListDevices(scope Scope, groupID string, page, size int) ([]DeviceRecord, error)
+}
+
+// CommandBatchService 把一条指令批量下发到分组或标签选择器匹配的设备，并跟踪整体进度。
+type CommandBatchService interface {
+	// Create 展开目标设备并保存任务后立即返回，逐台入队在后台进行；
+	// 单台设备入队失败不影响其他设备，结果陆续记录在 Items 中。
+	Create(scope Scope, batch CommandBatch, policy DeviceCommandPolicy) (CommandBatch, error)
+	Get(scope Scope, id int64) (CommandBatch, error)
+	// List 按 id 倒序列出最近的任务。
+	List(scope Scope, limit int) ([]CommandBatch, error)
+	// Resume 在启动时继续上次进程退出时尚未入队的设备。
+	Resume() error
+	// Stop 停止后台入队并等待进行中的设备处理完，剩余设备留待下次 Resume。
+	Stop()
+}
+
+// OtaService 管理固件镜像与升级活动，把镜像切分为 OTA_DATA 数据块逐台下发并跟踪进度。
+type OtaService interface {
+	// UploadFirmware 计算镜像 SHA-256 并保存；artifact.SHA256 非空时必须与计算结果一致。
+	UploadFirmware(scope Scope, artifact FirmwareArtifact) (FirmwareArtifact, error)
+	GetFirmware(scope Scope, id string) (FirmwareArtifact, error)
+	ListFirmware(scope Scope, limit int) ([]FirmwareArtifact, error)
+	DeleteFirmware(scope Scope, id string) error
+	// CreateCampaign 展开目标设备并按硬件版本与当前版本预先筛除不需要升级的设备。
+	CreateCampaign(scope Scope, campaign OtaCampaign) (OtaCampaign, error)
+	GetCampaign(scope Scope, id int64) (OtaCampaign, error)
+	ListCampaigns(scope Scope, limit int) ([]OtaCampaign, error)
+	ListCampaignDevices(scope Scope, id int64) ([]OtaDevice, error)
+	// SetRollout 扩大放量比例，不允许回调。
+	SetRollout(scope Scope, id int64, percent int) (OtaCampaign, error)
+	// Pause 暂停下发新的数据块，在途数据块与版本校验照常进行。
+	Pause(scope Scope, id int64) (OtaCampaign, error)
+	Resume(scope Scope, id int64) (OtaCampaign, error)
+	// Abort 取消尚未发出的数据块，未结束的设备标记为 aborted。
+	Abort(scope Scope, id int64) (OtaCampaign, error)
+	// RunOnce 推进全部运行中与暂停的活动，返回本轮下发的数据块数。
+	RunOnce() (int, error)
+	// Run 按配置间隔周期执行 RunOnce，直到 ctx 结束。
+	Run(ctx context.Context)
+}
+
+// DeviceConfigService 管理分层的配置文档，并让设备的配置版本与生效配置保持一致。
+type DeviceConfigService interface {
+	// SaveDocument 以 doc.Content 整体替换作用对象的配置，生成一个新版本。
+	SaveDocument(scope Scope, doc ConfigDocument) (ConfigDocument, error)
+	// GetDocument 读取指定版本，version 为 0 时读取最新版本。
+	GetDocument(scope Scope, scopeType ConfigScopeType, scopeID string, version int64) (ConfigDocument, error)
+	ListVersions(scope Scope, scopeType ConfigScopeType, scopeID string, limit int) ([]ConfigDocument, error)
+	// Rollback 以指定旧版本的内容生成一个新版本。
+	Rollback(scope Scope, scopeType ConfigScopeType, scopeID string, version int64, createdBy string) (ConfigDocument, error)
+	// GetEffective 返回设备解析后的生效配置与对账状态。
+	GetEffective(scope Scope, uuid string) (EffectiveDeviceConfig, error)
+	ListAcks(scope Scope, uuid string, limit int) ([]DeviceConfigAck, error)
+	// Reconcile 在设备注册时调用：记录上报版本与下发确认，版本过期且没有在途下发时推送生效配置。
+	// reportedVersion 为空表示本次没有上报，沿用最近一次确认的版本。
+	Reconcile(uuid, reportedVersion string) error
+	// ReconcileHeartbeat 是心跳时的轻量对账，只有设备版本与生效版本不一致或有在途下发时才执行 Reconcile。
+	ReconcileHeartbeat(tenantID, uuid, reportedVersion string) error
+}
+
+// LatestMetricService 在内存中缓存每台设备各指标序列的最新值，指标写入成功后更新，未加载或已过期的设备按需从存储读取。
+type LatestMetricService interface {
+	// Observe 用已写入存储的指标更新缓存，较旧的点不会覆盖较新的值
+	Observe(uuid string, points []MetricPoint)
+	// Latest 返回设备各序列的最新值，按设备分组；tenantID 只用于从存储加载未缓存的设备
+	Latest(tenantID string, uuids []string) (map[string][]MetricPoint, error)
+	// Warm 从存储加载近期上报过指标的设备的最新值，Core 启动时调用
+	Warm() error
+	RemoveDevice(uuid string)
+}
+
+// RetentionService 管理按租户覆盖的数据保留期，并在后台把过期指标汇总后分批清理。
+type RetentionService interface {
+	// ListPolicies 返回租户各数据类别的生效保留期。
+	ListPolicies(scope Scope) ([]RetentionPolicy, error)
+	// SetPolicy 覆盖租户某类数据的保留期，retention 为 0 表示永久保留。
+	SetPolicy(scope Scope, class RetentionDataClass, retention time.Duration, updatedBy string) (RetentionPolicy, error)
+	// ResetPolicy 删除租户覆盖，恢复平台默认值。
+	ResetPolicy(scope Scope, class RetentionDataClass) (RetentionPolicy, error)
+	// Prune 立即执行一次清理，classes 为空时处理全部类别；已有清理在运行时返回 ErrRetentionRunning。
+	Prune(ctx context.Context, classes []RetentionDataClass) (RetentionProgress, error)
+	Progress() RetentionProgress
+	// Run 按配置间隔周期清理，直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+// CommandNotifier 在下行命令入队或回队时通知订阅方，ingress 推送流据此立即下发而不必轮询。
+// 原生设备以 uuid 作为订阅键，外部集成设备使用 ExternalCommandKey。
+type CommandNotifier interface {
+	Notify(key string)
+	Subscribe(keys []string) CommandSubscription
+}
+
+// CommandSubscription 是一次命令通知订阅。
+// Ready 有信号时调用 Drain 取出自上次以来被通知的订阅键；用完必须 Close。
+type CommandSubscription interface {
+	Ready() <-chan struct{}
+	Drain() []string
+	Close()
+}
+
+// ExternalCommandKey 返回外部集成设备在命令通知中的订阅键。
+func ExternalCommandKey(source, deviceID string) string {
+	return source + "/" + deviceID
 }
 
 // ExternalEntityService 定义外部集成实体的管理能力。
@@ -126,6 +319,100 @@ type ExternalEntityService interface {
 
 	// QueryExternalObservations 查询外部观测值
 	QueryExternalObservations(source, entityID string, start, end int64, limit int) ([]ExternalObservation, error)
+
+	// ListExternalEntitiesByScope 在租户范围内按 source/domain/room 分页列出外部实体
+	ListExternalEntitiesByScope(scope Scope, filter ExternalEntityFilter, page, size int) ([]ExternalEntity, error)
+
+	// GetExternalEntityByScope 在租户范围内读取单个外部实体及其最新状态
+	GetExternalEntityByScope(scope Scope, source, entityID string) (ExternalEntity, error)
+
+	// QueryExternalObservationsByScope 在租户范围内查询外部观测值
+	QueryExternalObservationsByScope(scope Scope, source, entityID string, start, end int64, limit int) ([]ExternalObservation, error)
+
+	// LinkExternalEntity 把外部实体关联到 Goster 设备 UUID，gosterUUID 为空时解除关联
+	LinkExternalEntity(scope Scope, source, entityID, gosterUUID string) (ExternalEntity, error)
+}
+
+// IngestDedupeService 定义按租户与事件键去重的能力，保证 ingress 重试不会重复写入。
+type IngestDedupeService interface {
+	// Reserve 占用事件键；duplicate 为 true 时返回首次处理的记录
+	Reserve(tenantID, key, eventID, uuid string) (record IngestDedupeRecord, duplicate bool, err error)
+
+	// Complete 记录事件的处理结果
+	Complete(record IngestDedupeRecord) error
+
+	// Release 释放未成功处理的事件键
+	Release(tenantID, key string) error
+
+	// Cleanup 清理过期记录，返回删除条数
+	Cleanup() (int64, error)
+
+	// Run 按配置间隔周期清理，直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+// ExternalCommandService 定义发往外部实体的命令编排能力。
+type ExternalCommandService interface {
+	// Enqueue 为授权范围内的外部实体记录一条待发送命令
+	Enqueue(scope Scope, source, entityID, command string, payload map[string]interface{}) (ExternalCommand, error)
+
+	// ListCommands 列出外部实体最近的命令
+	ListCommands(scope Scope, source, entityID string, limit int) ([]ExternalCommand, error)
+
+	// PullPending 领取租户内某个外部设备（如 zigbee2mqtt friendly_name）下待发送的命令
+	PullPending(tenantID, source, deviceID string, limit int) ([]ExternalCommand, error)
+
+	// UpdateStatus 根据 adapter 回执更新租户内命令的状态，已结束的命令不再改变
+	UpdateStatus(tenantID string, id int64, status ExternalCommandStatus, errorText string) error
+
+	// RenewClaims 续期租户内已推送、尚未回执的命令的领取租约
+	RenewClaims(tenantID string, ids []int64) error
+}
+
+// DeviceStateService 定义设备状态的接收与查询能力。
+type DeviceStateService interface {
+	// IngestStates 写入设备上报的状态点，值未变化时只刷新时间戳。
+	IngestStates(uuid string, states []DeviceState) error
+
+	// ListStates 在授权范围内列出设备的全部最新状态。
+	ListStates(scope Scope, uuid string) ([]DeviceState, error)
+
+	// QueryStateHistory 在授权范围内查询设备状态变更历史。
+	QueryStateHistory(scope Scope, uuid string, query DeviceStateHistoryQuery) ([]DeviceState, error)
+}
+
+// DeviceShadowService 定义设备影子的读写与对账能力。
+type DeviceShadowService interface {
+	// GetShadow 在授权范围内读取设备影子，尚未创建时返回空文档。
+	GetShadow(scope Scope, uuid string) (DeviceShadow, error)
+
+	// UpdateDesired 以 JSON Merge Patch 语义合并 desired，expectedVersion 非空时要求与当前版本一致，
+	// 为空时遇到并发写入的版本冲突会按最新内容重新合并。
+	UpdateDesired(scope Scope, uuid string, patch map[string]interface{}, expectedVersion *int64) (DeviceShadow, error)
+
+	// ReportState 合并设备上报的 reported 状态。
+	ReportState(uuid string, reported map[string]interface{}, observedAt int64) error
+
+	// Reconcile 在 delta 非空时向设备下发一次配置推送。
+	Reconcile(uuid string) error
+}
+
+// DeviceTopologyService 定义网关/子设备拓扑的维护与查询能力。
+type DeviceTopologyService interface {
+	// ApplyTopology 用网关上报的快照刷新其直连子设备。
+	ApplyTopology(gateway DeviceTopologyNode, children []DeviceTopologyNode) error
+
+	// ReportParent 记录单个设备声明的上级网关，会拒绝形成环的挂载。
+	ReportParent(node DeviceTopologyNode) error
+
+	// ListChildren 在授权范围内列出网关的直连子设备。
+	ListChildren(scope Scope, uuid string) ([]DeviceTopologyNode, error)
+
+	// PathToCloud 返回设备经由各级网关到云端的路径，第一个元素是设备自身。
+	PathToCloud(scope Scope, uuid string) ([]DeviceTopologyNode, error)
+
+	// ChildUUIDs 不做授权检查地列出直连子设备，供在线状态联动使用。
+	ChildUUIDs(uuid string) ([]string, error)
 }
 
 // TelemetryIngestService 定义设备遥测数据的接收与落库能力。
@@ -161,3 +448,30 @@ type DevicePresenceStore interface {
 	LoadLastSeen(uuid string) (time.Time, bool)
 	Delete(uuid string)
 }
+
+// IngressCredentialInput 描述签发 adapter 凭据时的绑定范围。
+type IngressCredentialInput struct {
+	Name       string
+	InstanceID string
+	Adapters   []string
+	TenantIDs  []string
+	CreatedBy  string
+}
+
+// IngressCredentialService 管理 Core 签发给 protocol-ingress 的服务间凭据。
+type IngressCredentialService interface {
+	// Create 签发凭据；明文令牌只在返回值中出现一次
+	Create(input IngressCredentialInput) (IngressCredential, string, error)
+
+	// Rotate 为活动凭据换发新令牌，旧令牌立即失效
+	Rotate(id string) (IngressCredential, string, error)
+
+	// Revoke 吊销凭据
+	Revoke(id string) error
+
+	Get(id string) (IngressCredential, error)
+	List() ([]IngressCredential, error)
+
+	// Authenticate 校验 Bearer 令牌并返回对应的活动凭据
+	Authenticate(token string) (IngressCredential, error)
+}
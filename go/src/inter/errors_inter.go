@@ -4,17 +4,68 @@ import "errors"
 
 // 跨层共享的业务错误，供 Web/Service/Repository 使用 errors.Is 判断稳定语义。
 var (
-	ErrDeviceNotFound        = errors.New("device: not found")
-	ErrDeviceAlreadyExists   = errors.New("device: already exists")
-	ErrDeviceTokenNotFound   = errors.New("device: token not found")
-	ErrUserNotFound          = errors.New("user: not found")
-	ErrTenantNotFound        = errors.New("tenant: not found")
-	ErrTenantUserNotFound    = errors.New("tenant user: not found")
-	ErrDeviceTenantMismatch  = errors.New("device: tenant mismatch")
-	ErrDeviceCommandNotFound = errors.New("device command: not found")
-	ErrDownlinkQueueFull     = errors.New("downlink queue: full")
-	ErrCannotRemoveSelf      = errors.New("tenant: cannot remove yourself")
-	ErrInvitationNotFound    = errors.New("tenant invitation: not found")
-	ErrInvitationExpired     = errors.New("tenant invitation: expired")
-	ErrInvitationAccepted    = errors.New("tenant invitation: already processed")
+	ErrDeviceNotFound            = errors.New("device: not found")
+	ErrDeviceAlreadyExists       = errors.New("device: already exists")
+	ErrDeviceTokenNotFound       = errors.New("device: token not found")
+	ErrUserNotFound              = errors.New("user: not found")
+	ErrTenantNotFound            = errors.New("tenant: not found")
+	ErrTenantUserNotFound        = errors.New("tenant user: not found")
+	ErrDeviceTenantMismatch      = errors.New("device: tenant mismatch")
+	ErrDeviceCommandNotFound     = errors.New("device command: not found")
+	ErrDeviceCommandNotQueued    = errors.New("device command: no longer queued")
+	ErrDeviceCommandFinished     = errors.New("device command: already finished")
+	ErrCommandScheduleNotFound   = errors.New("command schedule: not found")
+	ErrCommandScheduleInvalid    = errors.New("command schedule: invalid")
+	ErrCommandBatchNotFound      = errors.New("command batch: not found")
+	ErrCommandBatchInvalid       = errors.New("command batch: invalid")
+	ErrDeviceGroupInvalid        = errors.New("device group: invalid")
+	ErrDeviceGroupNotFound       = errors.New("device group: not found")
+	ErrDeviceGroupExists         = errors.New("device group: name already exists")
+	ErrGroupDeviceExists         = errors.New("device group: device already in group")
+	ErrGroupDeviceNotFound       = errors.New("device group: device not in group")
+	ErrFirmwareArtifactNotFound  = errors.New("firmware artifact: not found")
+	ErrFirmwareArtifactInvalid   = errors.New("firmware artifact: invalid")
+	ErrFirmwareArtifactInUse     = errors.New("firmware artifact: referenced by campaign")
+	ErrOtaCampaignNotFound       = errors.New("ota campaign: not found")
+	ErrOtaCampaignInvalid        = errors.New("ota campaign: invalid")
+	ErrOtaCampaignState          = errors.New("ota campaign: invalid state transition")
+	ErrConfigDocumentNotFound    = errors.New("config document: not found")
+	ErrConfigDocumentInvalid     = errors.New("config document: invalid")
+	ErrRetentionPolicyInvalid    = errors.New("retention policy: invalid")
+	ErrRetentionRunning          = errors.New("retention: prune already running")
+	ErrDownlinkQueueFull         = errors.New("downlink queue: full")
+	ErrCapabilityViolation       = errors.New("downlink command: violates device capabilities")
+	ErrDeviceShadowNotFound      = errors.New("device shadow: not found")
+	ErrDeviceShadowConflict      = errors.New("device shadow: version conflict")
+	ErrDeviceDiagnosticsNotFound = errors.New("device diagnostics: not found")
+	ErrDeviceTopologyNotFound    = errors.New("device topology: not found")
+	ErrDeviceTopologyCycle       = errors.New("device topology: parent would create a cycle")
+	ErrDeviceTopologyTenant      = errors.New("device topology: parent or child belongs to another tenant")
+	ErrExternalEntityNotFound    = errors.New("external entity: not found")
+	ErrExternalCommandNotFound   = errors.New("external command: not found")
+	ErrExternalCommandInvalid    = errors.New("external command: invalid for entity")
+	ErrExternalCommandFinished   = errors.New("external command: already finished")
+	ErrIngressCredentialNotFound = errors.New("ingress credential: not found")
+	ErrIngressCredentialRevoked  = errors.New("ingress credential: revoked")
+	ErrIngressCredentialInvalid  = errors.New("ingress credential: invalid")
+	ErrCannotRemoveSelf          = errors.New("tenant: cannot remove yourself")
+	ErrInvitationNotFound        = errors.New("tenant invitation: not found")
+	ErrInvitationExpired         = errors.New("tenant invitation: expired")
+	ErrInvitationAccepted        = errors.New("tenant invitation: already processed")
 )
+
+// CapabilityViolationError 携带指令载荷与设备能力不符的全部违规项，errors.Is 可匹配 ErrCapabilityViolation。
+type CapabilityViolationError struct {
+	Violations []CapabilityViolation
+}
+
+func (e *CapabilityViolationError) Error() string {
+	if len(e.Violations) == 0 {
+		return ErrCapabilityViolation.Error()
+	}
+	return ErrCapabilityViolation.Error() + ": " + e.Violations[0].Message
+}
+
+func (e *CapabilityViolationError) Unwrap() error {
+	return ErrCapabilityViolation
+}
@@ -1,5 +1,7 @@
 package inter
 
+import "time"
+
 // CmdID 是平台保留的设备下行协议命令编号。
 // 具体帧编解码和设备连接已迁移到 protocol-ingress 微服务；
 // core-api 仅保留命令编号用于下行队列、持久化和 ingress RPC 状态回填。
@@ -17,9 +19,20 @@ const (
 	CmdScreenWy
 )
 
+// MaxDownlinkPayloadSize 是单条下行指令载荷的上限，与 gosterwy.MaxPayloadSize 保持一致。
+const MaxDownlinkPayloadSize = 64 * 1024
+
+// OtaFrameHeaderSize 是 OTA_DATA 帧头长度：Offset、TotalSize、CRC32 各 4 字节，小端序。
+const OtaFrameHeaderSize = 12
+
 // DownlinkMessage 表示一个待下发给设备的指令。
 type DownlinkMessage struct {
 	CommandID int64
 	CmdID     CmdID
 	Payload   []byte
+	// 以下字段来自指令的有效期与重试策略，零值表示不限制。
+	Timeout     time.Duration
+	MaxAttempts int
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
 }
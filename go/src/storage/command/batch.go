@@ -0,0 +1,182 @@
+package command
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+func (r *Repository) CreateCommandBatch(batch inter.CommandBatch) (int64, error) {
+	if batch.CreatedAt.IsZero() {
+		batch.CreatedAt = time.Now()
+	}
+	row := bunrepo.NewCommandBatchRow(batch)
+	if row.Command == "" {
+		return 0, errors.New("command is required")
+	}
+	err := r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().
+			Model(row).
+			ExcludeColumn("id").
+			Returning("id").
+			Exec(ctx); err != nil {
+			return err
+		}
+		if len(batch.Items) == 0 {
+			return nil
+		}
+		items := make([]bunrepo.CommandBatchItemRow, 0, len(batch.Items))
+		for _, item := range batch.Items {
+			items = append(items, newCommandBatchItemRow(row.ID, item))
+		}
+		_, err := tx.NewInsert().
+			Model(&items).
+			Returning("NULL").
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return row.ID, nil
+}
+
+func (r *Repository) AddCommandBatchItem(batchID int64, item inter.CommandBatchItem) error {
+	row := newCommandBatchItemRow(batchID, item)
+	_, err := r.db.NewInsert().
+		Model(&row).
+		On("CONFLICT (batch_id, uuid) DO UPDATE").
+		Set("command_id = EXCLUDED.command_id").
+		Set("error_text = EXCLUDED.error_text").
+		Returning("NULL").
+		Exec(context.Background())
+	return err
+}
+
+func newCommandBatchItemRow(batchID int64, item inter.CommandBatchItem) bunrepo.CommandBatchItemRow {
+	row := bunrepo.CommandBatchItemRow{
+		BatchID:   batchID,
+		UUID:      strings.TrimSpace(item.UUID),
+		ErrorText: bunrepo.NullableOptionalString(item.ErrorText),
+	}
+	if item.CommandID > 0 {
+		row.CommandID = &item.CommandID
+	}
+	return row
+}
+
+// ListUnfinishedCommandBatches 按 id 顺序列出仍有设备尚未入队的任务，供重启后继续入队。
+func (r *Repository) ListUnfinishedCommandBatches() ([]inter.CommandBatch, error) {
+	var items []bunrepo.CommandBatchItemRow
+	if err := r.db.NewSelect().
+		Model(&items).
+		Where("command_id IS NULL").
+		Where("error_text IS NULL").
+		OrderExpr("batch_id ASC, uuid ASC").
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	ids := make([]int64, 0)
+	for _, item := range items {
+		if len(ids) == 0 || ids[len(ids)-1] != item.BatchID {
+			ids = append(ids, item.BatchID)
+		}
+	}
+	var rows []bunrepo.CommandBatchRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Where("id IN (?)", bun.In(ids)).
+		OrderExpr("id ASC").
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	out := make([]inter.CommandBatch, 0, len(rows))
+	index := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		index[row.ID] = len(out)
+		out = append(out, row.ToCommandBatch())
+	}
+	for _, item := range items {
+		if i, ok := index[item.BatchID]; ok {
+			out[i].Items = append(out[i].Items, item.ToCommandBatchItem())
+		}
+	}
+	return out, nil
+}
+
+func (r *Repository) GetCommandBatch(tenantID string, id int64) (inter.CommandBatch, error) {
+	var row bunrepo.CommandBatchRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("id = ?", id).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.CommandBatch{}, inter.ErrCommandBatchNotFound
+		}
+		return inter.CommandBatch{}, err
+	}
+	batches, err := r.withBatchItems([]bunrepo.CommandBatchRow{row})
+	if err != nil {
+		return inter.CommandBatch{}, err
+	}
+	return batches[0], nil
+}
+
+func (r *Repository) ListCommandBatches(tenantID string, limit int) ([]inter.CommandBatch, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var rows []bunrepo.CommandBatchRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		OrderExpr("id DESC").
+		Limit(limit).
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	return r.withBatchItems(rows)
+}
+
+// withBatchItems 一次查询补齐多个任务的设备结果，状态取自 device_commands 的当前值。
+func (r *Repository) withBatchItems(rows []bunrepo.CommandBatchRow) ([]inter.CommandBatch, error) {
+	out := make([]inter.CommandBatch, 0, len(rows))
+	if len(rows) == 0 {
+		return out, nil
+	}
+	ids := make([]int64, 0, len(rows))
+	index := make(map[int64]int, len(rows))
+	for i, row := range rows {
+		ids = append(ids, row.ID)
+		index[row.ID] = i
+		out = append(out, row.ToCommandBatch())
+	}
+	var items []bunrepo.CommandBatchItemRow
+	if err := r.db.NewSelect().
+		Model(&items).
+		ColumnExpr("command_batch_item_row.*").
+		ColumnExpr("dc.status AS status").
+		Join("LEFT JOIN device_commands AS dc ON dc.id = command_batch_item_row.command_id").
+		Where("command_batch_item_row.batch_id IN (?)", bun.In(ids)).
+		OrderExpr("command_batch_item_row.batch_id ASC, command_batch_item_row.uuid ASC").
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		i := index[item.BatchID]
+		out[i].Items = append(out[i].Items, item.ToCommandBatchItem())
+	}
+	return out, nil
+}
@@ -0,0 +1,92 @@
+package command_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/command"
+	"github.com/nhirsama/Goster-IoT/src/storage/device"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+)
+
+func TestRepositoryCommandBatchTracksItemStatus(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "command_batch.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := command.NewRepository(base.DB, deviceRepo)
+
+	for _, uuid := range []string{"batch-a", "batch-b"} {
+		if err := deviceRepo.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+			t.Fatalf("InitDevice failed: %v", err)
+		}
+	}
+
+	batchID, err := repo.CreateCommandBatch(inter.CommandBatch{
+		Labels:    map[string]string{"site": "lab"},
+		Command:   "action_exec",
+		CmdID:     inter.CmdActionExec,
+		Payload:   []byte(`{"op":"reboot"}`),
+		Policy:    inter.DeviceCommandPolicy{TTL: time.Minute, MaxAttempts: 2, Key: "reboot"},
+		Total:     3,
+		CreatedBy: "admin",
+		Items:     []inter.CommandBatchItem{{UUID: "batch-a"}, {UUID: "batch-b"}, {UUID: "batch-c"}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCommandBatch failed: %v", err)
+	}
+	unfinished, err := repo.ListUnfinishedCommandBatches()
+	if err != nil || len(unfinished) != 1 || len(unfinished[0].Items) != 3 {
+		t.Fatalf("expected all targets to start unfinished, got %+v err=%v", unfinished, err)
+	}
+	if policy := unfinished[0].Policy; policy.TTL != time.Minute || policy.MaxAttempts != 2 || policy.Key != "reboot" {
+		t.Fatalf("batch policy should be stored for resume, got %+v", policy)
+	}
+
+	commandA, err := repo.CreateDeviceCommand("batch-a", inter.CmdActionExec, "action_exec", []byte(`{"op":"reboot"}`))
+	if err != nil {
+		t.Fatalf("CreateDeviceCommand failed: %v", err)
+	}
+	if err := repo.AddCommandBatchItem(batchID, inter.CommandBatchItem{UUID: "batch-a", CommandID: commandA}); err != nil {
+		t.Fatalf("AddCommandBatchItem failed: %v", err)
+	}
+	if err := repo.AddCommandBatchItem(batchID, inter.CommandBatchItem{UUID: "batch-b", ErrorText: "downlink queue: full"}); err != nil {
+		t.Fatalf("AddCommandBatchItem failed: %v", err)
+	}
+
+	// 入队结果覆盖创建时写入的待处理记录，只剩尚未入队的设备。
+	unfinished, err = repo.ListUnfinishedCommandBatches()
+	if err != nil || len(unfinished) != 1 || len(unfinished[0].Items) != 1 || unfinished[0].Items[0].UUID != "batch-c" {
+		t.Fatalf("expected only batch-c to remain unfinished, got %+v err=%v", unfinished, err)
+	}
+
+	got, err := repo.GetCommandBatch(inter.DefaultTenantID, batchID)
+	if err != nil {
+		t.Fatalf("GetCommandBatch failed: %v", err)
+	}
+	if got.Labels["site"] != "lab" || string(got.Payload) != `{"op":"reboot"}` || got.CreatedBy != "admin" || len(got.Items) != 3 {
+		t.Fatalf("unexpected batch: %+v", got)
+	}
+	if got.Items[0].Status != inter.DeviceCommandStatusQueued || got.Items[1].CommandID != 0 || got.Items[1].ErrorText == "" {
+		t.Fatalf("unexpected batch items: %+v", got.Items)
+	}
+	// 第三台设备尚未写入结果，按待处理计算。
+	if p := got.Progress(); p.Pending != 2 || p.Rejected != 1 || p.Done {
+		t.Fatalf("unexpected progress: %+v", p)
+	}
+
+	if err := repo.UpdateDeviceCommandStatus(commandA, inter.DeviceCommandStatusAcked, ""); err != nil {
+		t.Fatalf("UpdateDeviceCommandStatus failed: %v", err)
+	}
+	batches, err := repo.ListCommandBatches(inter.DefaultTenantID, 10)
+	if err != nil || len(batches) != 1 {
+		t.Fatalf("unexpected batch list: %+v err=%v", batches, err)
+	}
+	if batches[0].Items[0].Status != inter.DeviceCommandStatusAcked || batches[0].Progress().Succeeded != 1 {
+		t.Fatalf("expected acked status to be reflected, got %+v", batches[0].Items)
+	}
+
+	if _, err := repo.GetCommandBatch("tenant_other", batchID); !errors.Is(err, inter.ErrCommandBatchNotFound) {
+		t.Fatalf("expected not found for other tenant, got %v", err)
+	}
+}
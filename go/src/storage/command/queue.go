@@ -0,0 +1,190 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const overflowErrorText = "downlink queue overflow"
+
+func (r *Repository) TrimDeviceCommandQueue(uuid string, capacity int, claimedBefore time.Time) ([]int64, error) {
+	uuid = strings.TrimSpace(uuid)
+	if uuid == "" {
+		return nil, errors.New("uuid is required")
+	}
+	if capacity <= 0 {
+		return nil, nil
+	}
+	var evicted []int64
+	err := r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		evicted, err = trimQueue(ctx, tx, uuid, capacity, claimedBefore, 0, true)
+		return err
+	})
+	return evicted, err
+}
+
+func (r *Repository) RequeueDeviceCommandFront(uuid string, commandID int64, capacity int, claimedBefore time.Time) ([]int64, error) {
+	uuid = strings.TrimSpace(uuid)
+	if uuid == "" {
+		return nil, errors.New("uuid is required")
+	}
+	if commandID <= 0 {
+		return nil, errors.New("invalid command id")
+	}
+	var evicted []int64
+	err := r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		var front struct {
+			Order *int64 `bun:"front"`
+		}
+		if err := tx.NewSelect().
+			Table("device_commands").
+			Where(inQueueWhere, inQueueArgs(uuid, claimedBefore)...).
+			ColumnExpr("MIN(queue_order) AS front").
+			Where("id <> ?", commandID).
+			Scan(ctx, &front); err != nil {
+			return err
+		}
+		order := int64(0)
+		if front.Order != nil {
+			order = *front.Order
+		}
+		res, err := tx.NewUpdate().
+			Table("device_commands").
+			Set("status = ?", string(inter.DeviceCommandStatusQueued)).
+			Set("error_text = NULL").
+			Set("claimed_at = NULL").
+			Set("queue_order = ?", order-1).
+			Where("id = ?", commandID).
+			Where("uuid = ?", uuid).
+			Where("status IN (?)", bun.In(deliverableStatuses())).
+			Returning("NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if rows, err := res.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			return r.notDeliverable(ctx, tx, commandID)
+		}
+		evicted, err = trimQueue(ctx, tx, uuid, capacity, claimedBefore, commandID, false)
+		return err
+	})
+	return evicted, err
+}
+
+// ClaimNextDeviceCommand 用单条 UPDATE ... WHERE id IN (子查询) 领取队首指令；
+// Postgres 上子查询带 FOR UPDATE SKIP LOCKED，多个 Core 实例并发出队时互不阻塞，也不会重复领取。
+func (r *Repository) ClaimNextDeviceCommand(uuid string, now, claimedBefore time.Time) (inter.DeviceCommand, bool, error) {
+	uuid = strings.TrimSpace(uuid)
+	if uuid == "" {
+		return inter.DeviceCommand{}, false, errors.New("uuid is required")
+	}
+	next := r.db.NewSelect().
+		Table("device_commands").
+		Where(inQueueWhere, inQueueArgs(uuid, claimedBefore)...).
+		Column("id").
+		OrderExpr("queue_order ASC, id ASC").
+		Limit(1)
+	if r.db.Dialect().Name() == dialect.PG {
+		next = next.For("UPDATE SKIP LOCKED")
+	}
+
+	var rows []bunrepo.DeviceCommandRow
+	if _, err := r.db.NewUpdate().
+		Table("device_commands").
+		Where(inQueueWhere, inQueueArgs(uuid, claimedBefore)...).
+		Set("claimed_at = ?", now.UTC()).
+		Where("id IN (?)", next).
+		Returning("*").
+		Exec(context.Background(), &rows); err != nil {
+		return inter.DeviceCommand{}, false, err
+	}
+	if len(rows) == 0 {
+		return inter.DeviceCommand{}, false, nil
+	}
+	return rows[0].ToDeviceCommand(), true, nil
+}
+
+// RenewDeviceCommandClaims 把仍在排队且已被领取的指令的领取时间刷新为 now，已发送或已结束的指令不受影响。
+func (r *Repository) RenewDeviceCommandClaims(commandIDs []int64, now time.Time) error {
+	if len(commandIDs) == 0 {
+		return nil
+	}
+	_, err := r.db.NewUpdate().
+		Table("device_commands").
+		Set("claimed_at = ?", now.UTC()).
+		Where("id IN (?)", bun.In(commandIDs)).
+		Where("status = ?", string(inter.DeviceCommandStatusQueued)).
+		Where("claimed_at IS NOT NULL").
+		Exec(context.Background())
+	return err
+}
+
+func (r *Repository) CountQueuedDeviceCommands(uuid string, claimedBefore time.Time) (int, error) {
+	return r.db.NewSelect().
+		Table("device_commands").
+		Where(inQueueWhere, inQueueArgs(strings.TrimSpace(uuid), claimedBefore)...).
+		Count(context.Background())
+}
+
+// trimQueue 淘汰超出容量的指令：fromFront 为 true 时淘汰排在最前的，否则淘汰排在最后的；keepID 不参与淘汰。
+func trimQueue(ctx context.Context, tx bun.Tx, uuid string, capacity int, claimedBefore time.Time, keepID int64, fromFront bool) ([]int64, error) {
+	if capacity <= 0 {
+		return nil, nil
+	}
+	order := "queue_order DESC, id DESC"
+	if fromFront {
+		order = "queue_order ASC, id ASC"
+	}
+	var ids []int64
+	if err := tx.NewSelect().
+		Table("device_commands").
+		Where(inQueueWhere, inQueueArgs(uuid, claimedBefore)...).
+		Column("id").
+		OrderExpr(order).
+		Scan(ctx, &ids); err != nil {
+		return nil, err
+	}
+	excess := len(ids) - capacity
+	if excess <= 0 {
+		return nil, nil
+	}
+	evicted := make([]int64, 0, excess)
+	for _, id := range ids {
+		if len(evicted) == excess {
+			break
+		}
+		if id != keepID {
+			evicted = append(evicted, id)
+		}
+	}
+	now := time.Now().UTC()
+	if _, err := tx.NewUpdate().
+		Table("device_commands").
+		Set("status = ?", string(inter.DeviceCommandStatusOverflow)).
+		Set("error_text = ?", overflowErrorText).
+		Set("executed_at = ?", now).
+		Where("id IN (?)", bun.In(evicted)).
+		Where("status = ?", string(inter.DeviceCommandStatusQueued)).
+		Returning("NULL").
+		Exec(ctx); err != nil {
+		return nil, err
+	}
+	return evicted, nil
+}
+
+// inQueueWhere 限定设备队列成员：queued 状态，且未被领取或领取租约已过期。
+const inQueueWhere = "uuid = ? AND status = ? AND (claimed_at IS NULL OR claimed_at <= ?)"
+
+func inQueueArgs(uuid string, claimedBefore time.Time) []interface{} {
+	return []interface{}{uuid, string(inter.DeviceCommandStatusQueued), claimedBefore.UTC()}
+}
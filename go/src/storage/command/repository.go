@@ -2,7 +2,9 @@ package command
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -29,14 +31,18 @@ func (r *Repository) CreateDeviceCommand(uuid string, cmdID inter.CmdID, command
 	if err != nil {
 		tenantID = bunrepo.DefaultTenantID
 	}
-	return r.createDeviceCommandRecord(tenantID, uuid, cmdID, command, payloadJSON, false)
+	return r.createDeviceCommandRecord(tenantID, uuid, cmdID, command, payloadJSON, false, inter.DeviceCommandPolicy{})
 }
 
 func (r *Repository) CreateDeviceCommandByTenant(tenantID, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte) (int64, error) {
-	return r.createDeviceCommandRecord(tenantID, uuid, cmdID, command, payloadJSON, true)
+	return r.createDeviceCommandRecord(tenantID, uuid, cmdID, command, payloadJSON, true, inter.DeviceCommandPolicy{})
 }
 
-func (r *Repository) createDeviceCommandRecord(tenantID, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte, validateTenant bool) (int64, error) {
+func (r *Repository) CreateDeviceCommandWithPolicy(tenantID, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte, policy inter.DeviceCommandPolicy) (int64, error) {
+	return r.createDeviceCommandRecord(tenantID, uuid, cmdID, command, payloadJSON, true, policy)
+}
+
+func (r *Repository) createDeviceCommandRecord(tenantID, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte, validateTenant bool, policy inter.DeviceCommandPolicy) (int64, error) {
 	tenantID = bunrepo.NormalizeTenantID(tenantID)
 	uuid = strings.TrimSpace(uuid)
 	command = strings.TrimSpace(strings.ToLower(command))
@@ -56,13 +62,26 @@ func (r *Repository) createDeviceCommandRecord(tenantID, uuid string, cmdID inte
 		}
 	}
 
+	now := time.Now().UTC()
 	row := &bunrepo.DeviceCommandRow{
 		TenantID:    tenantID,
 		UUID:        uuid,
 		CmdID:       int(cmdID),
 		Command:     command,
+		CommandKey:  strings.TrimSpace(policy.Key),
 		PayloadJSON: bunrepo.PayloadStringPtr(payloadJSON),
 		Status:      string(inter.DeviceCommandStatusQueued),
+		RequestedAt: now,
+	}
+	if policy.TTL > 0 {
+		expiresAt := now.Add(policy.TTL)
+		row.ExpiresAt = &expiresAt
+	}
+	if policy.Timeout > 0 {
+		row.TimeoutMs = policy.Timeout.Milliseconds()
+	}
+	if policy.MaxAttempts > 0 {
+		row.MaxAttempts = policy.MaxAttempts
 	}
 	if _, err := r.db.NewInsert().
 		Model(row).
@@ -81,19 +100,148 @@ func (r *Repository) UpdateDeviceCommandStatus(commandID int64, status inter.Dev
 		return errors.New("invalid command status")
 	}
 
-	var executedAt *time.Time
-	if status == inter.DeviceCommandStatusAcked || status == inter.DeviceCommandStatusFailed {
-		now := time.Now().UTC()
-		executedAt = &now
+	// 只有排队中或已发送的指令可以改状态，迟到或重复的回执不能改写已结束的指令。
+	res, err := r.statusUpdate(status, errorText).
+		Where("id = ?", commandID).
+		Where("status IN (?)", bun.In([]string{string(inter.DeviceCommandStatusQueued), string(inter.DeviceCommandStatusSent)})).
+		Returning("NULL").
+		Exec(context.Background())
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+	exists, err := r.db.NewSelect().
+		Model((*bunrepo.DeviceCommandRow)(nil)).
+		Where("id = ?", commandID).
+		Exists(context.Background())
+	if err != nil {
+		return err
+	}
+	if exists {
+		return inter.ErrDeviceCommandFinished
+	}
+	return inter.ErrDeviceCommandNotFound
+}
+
+func (r *Repository) TransitionDeviceCommandStatus(commandID int64, from, to inter.DeviceCommandStatus, errorText string) (bool, error) {
+	if commandID <= 0 {
+		return false, errors.New("invalid command id")
+	}
+	if !isValidDeviceCommandStatus(from) || !isValidDeviceCommandStatus(to) {
+		return false, errors.New("invalid command status")
+	}
+	res, err := r.statusUpdate(to, errorText).
+		Where("id = ?", commandID).
+		Where("status = ?", string(from)).
+		Returning("NULL").
+		Exec(context.Background())
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (r *Repository) GetDeviceCommand(commandID int64) (inter.DeviceCommand, error) {
+	var row bunrepo.DeviceCommandRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Where("id = ?", commandID).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.DeviceCommand{}, inter.ErrDeviceCommandNotFound
+		}
+		return inter.DeviceCommand{}, err
 	}
-	errText := strings.TrimSpace(errorText)
+	return row.ToDeviceCommand(), nil
+}
 
+func (r *Repository) GetDeviceCommandByTenant(tenantID string, commandID int64) (inter.DeviceCommand, error) {
+	var row bunrepo.DeviceCommandRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("id = ?", commandID).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.DeviceCommand{}, inter.ErrDeviceCommandNotFound
+		}
+		return inter.DeviceCommand{}, err
+	}
+	return row.ToDeviceCommand(), nil
+}
+
+func (r *Repository) ListDeviceCommandsByTenant(tenantID, uuid string, query inter.DeviceCommandQuery) ([]inter.DeviceCommand, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	q := r.db.NewSelect().
+		Model((*bunrepo.DeviceCommandRow)(nil)).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("uuid = ?", strings.TrimSpace(uuid))
+	if len(query.Statuses) > 0 {
+		statuses := make([]string, 0, len(query.Statuses))
+		for _, status := range query.Statuses {
+			statuses = append(statuses, string(status))
+		}
+		q = q.Where("status IN (?)", bun.In(statuses))
+	}
+	if command := strings.TrimSpace(strings.ToLower(query.Command)); command != "" {
+		q = q.Where("command = ?", command)
+	}
+	if !query.Start.IsZero() {
+		q = q.Where("requested_at >= ?", query.Start.UTC())
+	}
+	if !query.End.IsZero() {
+		q = q.Where("requested_at <= ?", query.End.UTC())
+	}
+	if query.BeforeID > 0 {
+		q = q.Where("id < ?", query.BeforeID)
+	}
+
+	var rows []bunrepo.DeviceCommandRow
+	if err := q.OrderExpr("id DESC").Limit(limit).Scan(context.Background(), &rows); err != nil {
+		return nil, err
+	}
+	out := make([]inter.DeviceCommand, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToDeviceCommand())
+	}
+	return out, nil
+}
+
+// MarkDeviceCommandSent 未携带投递方的回执不会覆盖此前记录的实例与 adapter。
+// 只更新仍在 queued/sent 的指令，迟到的回执不会复活已取消、被替代或已过期的指令。
+func (r *Repository) MarkDeviceCommandSent(commandID int64, sentAt time.Time, ackDeadline *time.Time, via inter.CommandDelivery) error {
+	if commandID <= 0 {
+		return errors.New("invalid command id")
+	}
+	sentAt = sentAt.UTC()
 	res, err := r.db.NewUpdate().
 		Table("device_commands").
-		Set("status = ?", string(status)).
-		Set("error_text = ?", bunrepo.NullableOptionalString(errText)).
-		Set("executed_at = COALESCE(?, executed_at)", executedAt).
+		Set("status = ?", string(inter.DeviceCommandStatusSent)).
+		Set("error_text = NULL").
+		Set("attempts = attempts + 1").
+		Set("sent_at = ?", sentAt).
+		Set("ack_deadline_at = ?", ackDeadline).
+		Set("delivered_instance = COALESCE(?, delivered_instance)", bunrepo.NullableOptionalString(via.InstanceID)).
+		Set("delivered_adapter = COALESCE(?, delivered_adapter)", bunrepo.NullableOptionalString(via.AdapterID)).
 		Where("id = ?", commandID).
+		Where("status IN (?)", bun.In(deliverableStatuses())).
 		Returning("NULL").
 		Exec(context.Background())
 	if err != nil {
@@ -104,14 +252,109 @@ func (r *Repository) UpdateDeviceCommandStatus(commandID int64, status inter.Dev
 		return err
 	}
 	if rows == 0 {
-		return inter.ErrDeviceCommandNotFound
+		return r.notDeliverable(context.Background(), r.db, commandID)
 	}
 	return nil
 }
 
+// deliverableStatuses 是仍可发送或回队的指令状态。
+func deliverableStatuses() []string {
+	return []string{string(inter.DeviceCommandStatusQueued), string(inter.DeviceCommandStatusSent)}
+}
+
+// notDeliverable 在带状态条件的更新未命中时区分指令不存在和已离开可投递状态。
+func (r *Repository) notDeliverable(ctx context.Context, db bun.IDB, commandID int64) error {
+	exists, err := db.NewSelect().
+		Table("device_commands").
+		Where("id = ?", commandID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return inter.ErrDeviceCommandNotFound
+	}
+	return inter.ErrDeviceCommandNotQueued
+}
+
+func (r *Repository) SupersedeDeviceCommands(uuid, command, key string, newerID int64) ([]int64, error) {
+	if newerID <= 0 {
+		return nil, errors.New("invalid command id")
+	}
+	var rows []bunrepo.DeviceCommandRow
+	if _, err := r.statusUpdate(inter.DeviceCommandStatusCancelled, fmt.Sprintf("superseded by command %d", newerID)).
+		Where("uuid = ?", strings.TrimSpace(uuid)).
+		Where("command = ?", strings.TrimSpace(strings.ToLower(command))).
+		Where("command_key = ?", strings.TrimSpace(key)).
+		Where("status = ?", string(inter.DeviceCommandStatusQueued)).
+		Where("id < ?", newerID).
+		Returning("id").
+		Exec(context.Background(), &rows); err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	return ids, nil
+}
+
+func (r *Repository) ListStaleDeviceCommands(now time.Time, limit int) ([]inter.DeviceCommand, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	now = now.UTC()
+	var rows []bunrepo.DeviceCommandRow
+	err := r.db.NewSelect().
+		Model(&rows).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				WhereGroup(" OR ", func(q *bun.SelectQuery) *bun.SelectQuery {
+					return q.Where("status = ?", string(inter.DeviceCommandStatusQueued)).Where("expires_at IS NOT NULL").Where("expires_at <= ?", now)
+				}).
+				WhereGroup(" OR ", func(q *bun.SelectQuery) *bun.SelectQuery {
+					return q.Where("status = ?", string(inter.DeviceCommandStatusSent)).Where("ack_deadline_at IS NOT NULL").Where("ack_deadline_at <= ?", now)
+				})
+		}).
+		OrderExpr("id ASC").
+		Limit(limit).
+		Scan(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]inter.DeviceCommand, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToDeviceCommand())
+	}
+	return out, nil
+}
+
+func (r *Repository) statusUpdate(status inter.DeviceCommandStatus, errorText string) *bun.UpdateQuery {
+	var executedAt *time.Time
+	if isTerminalDeviceCommandStatus(status) {
+		now := time.Now().UTC()
+		executedAt = &now
+	}
+	return r.db.NewUpdate().
+		Table("device_commands").
+		Set("status = ?", string(status)).
+		Set("error_text = ?", bunrepo.NullableOptionalString(errorText)).
+		Set("executed_at = COALESCE(?, executed_at)", executedAt)
+}
+
 func isValidDeviceCommandStatus(status inter.DeviceCommandStatus) bool {
 	switch status {
-	case inter.DeviceCommandStatusQueued, inter.DeviceCommandStatusSent, inter.DeviceCommandStatusAcked, inter.DeviceCommandStatusFailed:
+	case inter.DeviceCommandStatusQueued, inter.DeviceCommandStatusSent:
+		return true
+	default:
+		return isTerminalDeviceCommandStatus(status)
+	}
+}
+
+func isTerminalDeviceCommandStatus(status inter.DeviceCommandStatus) bool {
+	switch status {
+	case inter.DeviceCommandStatusAcked, inter.DeviceCommandStatusFailed, inter.DeviceCommandStatusExpired,
+		inter.DeviceCommandStatusOverflow, inter.DeviceCommandStatusCancelled:
 		return true
 	default:
 		return false
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/nhirsama/Goster-IoT/src/storage/command"
@@ -77,3 +78,244 @@ func TestRepositoryCreateDeviceCommandByTenantRejectsMismatch(t *testing.T) {
 		t.Fatalf("expected tenant mismatch sentinel, got %v", err)
 	}
 }
+
+func TestRepositoryDeviceCommandQueueOrderingOverflowAndLease(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "command_queue.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := command.NewRepository(base.DB, deviceRepo)
+
+	uuid := "queue-device"
+	if err := deviceRepo.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "queue-token", AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	ids := make([]int64, 0, 3)
+	for i := 0; i < 3; i++ {
+		id, err := repo.CreateDeviceCommand(uuid, inter.CmdConfigPush, "config_push", []byte(`{"interval":30}`))
+		if err != nil {
+			t.Fatalf("CreateDeviceCommand failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	now := time.Now()
+	lease := now.Add(-time.Minute)
+	evicted, err := repo.TrimDeviceCommandQueue(uuid, 2, lease)
+	if err != nil || len(evicted) != 1 || evicted[0] != ids[0] {
+		t.Fatalf("expected oldest command to overflow, got %v err=%v", evicted, err)
+	}
+	overflowed, err := repo.GetDeviceCommand(ids[0])
+	if err != nil || overflowed.Status != inter.DeviceCommandStatusOverflow || overflowed.ExecutedAt == nil {
+		t.Fatalf("unexpected overflowed command: %+v err=%v", overflowed, err)
+	}
+
+	claimed, ok, err := repo.ClaimNextDeviceCommand(uuid, now, lease)
+	if err != nil || !ok || claimed.ID != ids[1] || string(claimed.Payload) != `{"interval":30}` {
+		t.Fatalf("unexpected claimed command: %+v ok=%v err=%v", claimed, ok, err)
+	}
+	if count, err := repo.CountQueuedDeviceCommands(uuid, lease); err != nil || count != 1 {
+		t.Fatalf("claimed command must leave the queue, count=%d err=%v", count, err)
+	}
+
+	// 续期后的领取时间晚于租约截止，指令仍不可见。
+	if err := repo.RenewDeviceCommandClaims([]int64{ids[1], ids[2]}, now.Add(2*time.Second)); err != nil {
+		t.Fatalf("RenewDeviceCommandClaims failed: %v", err)
+	}
+	if count, err := repo.CountQueuedDeviceCommands(uuid, now.Add(time.Second)); err != nil || count != 1 {
+		t.Fatalf("renewed claim must stay out of the queue, count=%d err=%v", count, err)
+	}
+	// 租约过期后仍未标记发送的指令重新可见；未领取的指令不会被续期。
+	if count, err := repo.CountQueuedDeviceCommands(uuid, now.Add(3*time.Second)); err != nil || count != 2 {
+		t.Fatalf("expired claim should return to the queue, count=%d err=%v", count, err)
+	}
+
+	if _, err := repo.RequeueDeviceCommandFront(uuid, ids[2], 2, lease); err != nil {
+		t.Fatalf("RequeueDeviceCommandFront failed: %v", err)
+	}
+	if _, err := repo.RequeueDeviceCommandFront(uuid, ids[1], 2, lease); err != nil {
+		t.Fatalf("RequeueDeviceCommandFront failed: %v", err)
+	}
+	first, ok, err := repo.ClaimNextDeviceCommand(uuid, now, lease)
+	if err != nil || !ok || first.ID != ids[1] {
+		t.Fatalf("requeued command must be claimed first, got %+v ok=%v err=%v", first, ok, err)
+	}
+	second, ok, err := repo.ClaimNextDeviceCommand(uuid, now, lease)
+	if err != nil || !ok || second.ID != ids[2] {
+		t.Fatalf("unexpected second claim: %+v ok=%v err=%v", second, ok, err)
+	}
+	if _, ok, err := repo.ClaimNextDeviceCommand(uuid, now, lease); err != nil || ok {
+		t.Fatalf("queue should be empty, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestRepositoryListDeviceCommandsByTenantFiltersAndDelivery(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "command_repo_history.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := command.NewRepository(base.DB, deviceRepo)
+
+	if err := deviceRepo.InitDevice("history-device", inter.DeviceMetadata{
+		Name:               "history-device",
+		Token:              "history-token",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+
+	var ids []int64
+	for _, command := range []string{"action_exec", "config_push", "action_exec"} {
+		id, err := repo.CreateDeviceCommandByTenant("", "history-device", inter.CmdActionExec, command, []byte(`{}`))
+		if err != nil {
+			t.Fatalf("CreateDeviceCommandByTenant failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	sentAt := time.Now().UTC()
+	via := inter.CommandDelivery{InstanceID: "ingress-a", AdapterID: "mqtt"}
+	if err := repo.MarkDeviceCommandSent(ids[0], sentAt, nil, via); err != nil {
+		t.Fatalf("MarkDeviceCommandSent failed: %v", err)
+	}
+	// 未携带投递方的再次发送不覆盖已记录的实例与 adapter。
+	if err := repo.MarkDeviceCommandSent(ids[0], sentAt, nil, inter.CommandDelivery{}); err != nil {
+		t.Fatalf("MarkDeviceCommandSent retry failed: %v", err)
+	}
+
+	got, err := repo.GetDeviceCommandByTenant("", ids[0])
+	if err != nil {
+		t.Fatalf("GetDeviceCommandByTenant failed: %v", err)
+	}
+	if got.DeliveredBy != via || got.Attempts != 2 || got.Status != inter.DeviceCommandStatusSent {
+		t.Fatalf("unexpected command: %+v", got)
+	}
+	if _, err := repo.GetDeviceCommandByTenant("tenant_other", ids[0]); !errors.Is(err, inter.ErrDeviceCommandNotFound) {
+		t.Fatalf("expected not found for other tenant, got %v", err)
+	}
+
+	all, err := repo.ListDeviceCommandsByTenant("", "history-device", inter.DeviceCommandQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListDeviceCommandsByTenant failed: %v", err)
+	}
+	if len(all) != 2 || all[0].ID != ids[2] || all[1].ID != ids[1] {
+		t.Fatalf("unexpected first page: %+v", all)
+	}
+	rest, err := repo.ListDeviceCommandsByTenant("", "history-device", inter.DeviceCommandQuery{BeforeID: all[1].ID, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListDeviceCommandsByTenant cursor failed: %v", err)
+	}
+	if len(rest) != 1 || rest[0].ID != ids[0] {
+		t.Fatalf("unexpected second page: %+v", rest)
+	}
+
+	filtered, err := repo.ListDeviceCommandsByTenant("", "history-device", inter.DeviceCommandQuery{
+		Statuses: []inter.DeviceCommandStatus{inter.DeviceCommandStatusQueued},
+		Command:  "action_exec",
+	})
+	if err != nil {
+		t.Fatalf("ListDeviceCommandsByTenant filter failed: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != ids[2] {
+		t.Fatalf("unexpected filtered commands: %+v", filtered)
+	}
+
+	future, err := repo.ListDeviceCommandsByTenant("", "history-device", inter.DeviceCommandQuery{Start: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("ListDeviceCommandsByTenant range failed: %v", err)
+	}
+	if len(future) != 0 {
+		t.Fatalf("expected no commands after start, got %+v", future)
+	}
+
+	other, err := repo.ListDeviceCommandsByTenant("tenant_other", "history-device", inter.DeviceCommandQuery{})
+	if err != nil {
+		t.Fatalf("ListDeviceCommandsByTenant other tenant failed: %v", err)
+	}
+	if len(other) != 0 {
+		t.Fatalf("expected no commands for other tenant, got %+v", other)
+	}
+}
+
+func TestRepositorySupersedeDeviceCommandsMatchesCommandAndKey(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "command_repo_supersede.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := command.NewRepository(base.DB, deviceRepo)
+
+	if err := deviceRepo.InitDevice("supersede-device", inter.DeviceMetadata{
+		Name:               "supersede-device",
+		Token:              "supersede-token",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	create := func(command, key string) int64 {
+		t.Helper()
+		id, err := repo.CreateDeviceCommandWithPolicy("", "supersede-device", inter.CmdConfigPush, command, []byte(`{}`), inter.DeviceCommandPolicy{Key: key})
+		if err != nil {
+			t.Fatalf("CreateDeviceCommandWithPolicy failed: %v", err)
+		}
+		return id
+	}
+	sent := create("config_push", "interval")
+	if err := repo.MarkDeviceCommandSent(sent, time.Now(), nil, inter.CommandDelivery{}); err != nil {
+		t.Fatalf("MarkDeviceCommandSent failed: %v", err)
+	}
+	queued := create("config_push", "interval")
+	otherKey := create("config_push", "mode")
+	otherCommand := create("action_exec", "interval")
+	newer := create("config_push", "interval")
+
+	ids, err := repo.SupersedeDeviceCommands("supersede-device", "config_push", "interval", newer)
+	if err != nil {
+		t.Fatalf("SupersedeDeviceCommands failed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != queued {
+		t.Fatalf("unexpected superseded ids: %v", ids)
+	}
+	for id, want := range map[int64]inter.DeviceCommandStatus{
+		sent:         inter.DeviceCommandStatusSent,
+		queued:       inter.DeviceCommandStatusCancelled,
+		otherKey:     inter.DeviceCommandStatusQueued,
+		otherCommand: inter.DeviceCommandStatusQueued,
+		newer:        inter.DeviceCommandStatusQueued,
+	} {
+		got, err := repo.GetDeviceCommand(id)
+		if err != nil {
+			t.Fatalf("GetDeviceCommand(%d) failed: %v", id, err)
+		}
+		if got.Status != want {
+			t.Fatalf("command %d status = %s, want %s", id, got.Status, want)
+		}
+	}
+}
+
+func TestRepositoryLateReceiptsDoNotReviveFinishedCommands(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "command_repo_late.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := command.NewRepository(base.DB, deviceRepo)
+
+	if err := deviceRepo.InitDevice("late-device", inter.DeviceMetadata{
+		Name:               "late-device",
+		Token:              "late-token",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	id, err := repo.CreateDeviceCommand("late-device", inter.CmdActionExec, "action_exec", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("CreateDeviceCommand failed: %v", err)
+	}
+	if err := repo.UpdateDeviceCommandStatus(id, inter.DeviceCommandStatusCancelled, "cancelled"); err != nil {
+		t.Fatalf("UpdateDeviceCommandStatus failed: %v", err)
+	}
+
+	if err := repo.MarkDeviceCommandSent(id, time.Now(), nil, inter.CommandDelivery{}); !errors.Is(err, inter.ErrDeviceCommandNotQueued) {
+		t.Fatalf("late sent receipt should conflict, got %v", err)
+	}
+	if _, err := repo.RequeueDeviceCommandFront("late-device", id, 10, time.Now()); !errors.Is(err, inter.ErrDeviceCommandNotQueued) {
+		t.Fatalf("requeue of cancelled command should conflict, got %v", err)
+	}
+	if err := repo.MarkDeviceCommandSent(9999, time.Now(), nil, inter.CommandDelivery{}); !errors.Is(err, inter.ErrDeviceCommandNotFound) {
+		t.Fatalf("unknown command should be not found, got %v", err)
+	}
+	got, err := repo.GetDeviceCommand(id)
+	if err != nil || got.Status != inter.DeviceCommandStatusCancelled {
+		t.Fatalf("cancelled command should stay cancelled: %+v err=%v", got, err)
+	}
+}
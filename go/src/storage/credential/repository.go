@@ -0,0 +1,126 @@
+package credential
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+type Repository struct {
+	db *bun.DB
+}
+
+func NewRepository(db *bun.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateIngressCredential(cred inter.IngressCredential, tokenHash string) error {
+	if strings.TrimSpace(tokenHash) == "" {
+		return errors.New("token hash is required")
+	}
+	row, err := bunrepo.NewIngressCredentialRow(cred, tokenHash)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.NewInsert().Model(row).Returning("NULL").Exec(context.Background())
+	return err
+}
+
+func (r *Repository) GetIngressCredential(id string) (inter.IngressCredential, error) {
+	return r.getBy("id = ?", strings.TrimSpace(id))
+}
+
+func (r *Repository) GetIngressCredentialByTokenHash(tokenHash string) (inter.IngressCredential, error) {
+	return r.getBy("token_hash = ?", tokenHash)
+}
+
+func (r *Repository) getBy(where string, arg string) (inter.IngressCredential, error) {
+	var row bunrepo.IngressCredentialRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Where(where, arg).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.IngressCredential{}, inter.ErrIngressCredentialNotFound
+		}
+		return inter.IngressCredential{}, err
+	}
+	return row.ToIngressCredential()
+}
+
+func (r *Repository) ListIngressCredentials() ([]inter.IngressCredential, error) {
+	var rows []bunrepo.IngressCredentialRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		OrderExpr("created_at ASC, id ASC").
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	out := make([]inter.IngressCredential, 0, len(rows))
+	for _, row := range rows {
+		cred, err := row.ToIngressCredential()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, cred)
+	}
+	return out, nil
+}
+
+// RotateIngressCredential 只替换活动凭据的令牌，旧令牌立即失效。
+func (r *Repository) RotateIngressCredential(id, tokenHash, tokenPrefix string, rotatedAt time.Time) error {
+	if strings.TrimSpace(tokenHash) == "" {
+		return errors.New("token hash is required")
+	}
+	res, err := r.db.NewUpdate().
+		Model((*bunrepo.IngressCredentialRow)(nil)).
+		Set("token_hash = ?", tokenHash).
+		Set("token_prefix = ?", tokenPrefix).
+		Set("rotated_at = ?", rotatedAt.UnixMilli()).
+		Where("id = ?", strings.TrimSpace(id)).
+		Where("status = ?", string(inter.IngressCredentialStatusActive)).
+		Returning("NULL").
+		Exec(context.Background())
+	if err != nil {
+		return err
+	}
+	return r.checkUpdated(res, id)
+}
+
+func (r *Repository) RevokeIngressCredential(id string, revokedAt time.Time) error {
+	res, err := r.db.NewUpdate().
+		Model((*bunrepo.IngressCredentialRow)(nil)).
+		Set("status = ?", string(inter.IngressCredentialStatusRevoked)).
+		Set("revoked_at = ?", revokedAt.UnixMilli()).
+		Where("id = ?", strings.TrimSpace(id)).
+		Where("status = ?", string(inter.IngressCredentialStatusActive)).
+		Returning("NULL").
+		Exec(context.Background())
+	if err != nil {
+		return err
+	}
+	return r.checkUpdated(res, id)
+}
+
+// checkUpdated 在没有行被更新时区分凭据不存在与已吊销。
+func (r *Repository) checkUpdated(res sql.Result, id string) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	if _, err := r.GetIngressCredential(id); err != nil {
+		return err
+	}
+	return inter.ErrIngressCredentialRevoked
+}
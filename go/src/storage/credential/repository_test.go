@@ -0,0 +1,66 @@
+package credential_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/credential"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+)
+
+func TestRepositoryIngressCredentialLifecycle(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "credential_repo.db")
+	repo := credential.NewRepository(base.DB)
+
+	createdAt := time.UnixMilli(1700000000000)
+	cred := inter.IngressCredential{
+		ID:          "ic_1",
+		Name:        "edge",
+		InstanceID:  "ingress-1",
+		Adapters:    []string{"mqtt"},
+		TenantIDs:   []string{"tenant_a"},
+		TokenPrefix: "gic_aaaaaaaa",
+		Status:      inter.IngressCredentialStatusActive,
+		CreatedBy:   "admin",
+		CreatedAt:   createdAt,
+	}
+	if err := repo.CreateIngressCredential(cred, "hash-1"); err != nil {
+		t.Fatalf("CreateIngressCredential failed: %v", err)
+	}
+
+	got, err := repo.GetIngressCredentialByTokenHash("hash-1")
+	if err != nil {
+		t.Fatalf("GetIngressCredentialByTokenHash failed: %v", err)
+	}
+	if got.InstanceID != "ingress-1" || len(got.Adapters) != 1 || got.TenantIDs[0] != "tenant_a" || !got.CreatedAt.Equal(createdAt) || got.RotatedAt != nil {
+		t.Fatalf("unexpected credential: %+v", got)
+	}
+
+	if err := repo.RotateIngressCredential("ic_1", "hash-2", "gic_bbbbbbbb", createdAt.Add(time.Hour)); err != nil {
+		t.Fatalf("RotateIngressCredential failed: %v", err)
+	}
+	if _, err := repo.GetIngressCredentialByTokenHash("hash-1"); !errors.Is(err, inter.ErrIngressCredentialNotFound) {
+		t.Fatalf("old hash should be gone, got %v", err)
+	}
+	rotated, err := repo.GetIngressCredential("ic_1")
+	if err != nil || rotated.TokenPrefix != "gic_bbbbbbbb" || rotated.RotatedAt == nil {
+		t.Fatalf("unexpected rotated credential: %+v err=%v", rotated, err)
+	}
+
+	if err := repo.RevokeIngressCredential("ic_1", createdAt.Add(2*time.Hour)); err != nil {
+		t.Fatalf("RevokeIngressCredential failed: %v", err)
+	}
+	if err := repo.RotateIngressCredential("ic_1", "hash-3", "gic_cccccccc", createdAt.Add(3*time.Hour)); !errors.Is(err, inter.ErrIngressCredentialRevoked) {
+		t.Fatalf("rotate after revoke should fail with revoked, got %v", err)
+	}
+	if err := repo.RevokeIngressCredential("ic_missing", createdAt); !errors.Is(err, inter.ErrIngressCredentialNotFound) {
+		t.Fatalf("revoke missing credential should fail with not found, got %v", err)
+	}
+
+	list, err := repo.ListIngressCredentials()
+	if err != nil || len(list) != 1 || list[0].Status != inter.IngressCredentialStatusRevoked || list[0].RevokedAt == nil {
+		t.Fatalf("unexpected list: %+v err=%v", list, err)
+	}
+}
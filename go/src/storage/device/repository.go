@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
@@ -25,11 +26,15 @@ func (r *Repository) InitDevice(uuid string, meta inter.DeviceMetadata) error {
 }
 
 func (r *Repository) InitDeviceInTenant(tenantID string, uuid string, meta inter.DeviceMetadata) error {
-	_, err := r.db.NewInsert().
-		Model(bunrepo.NewDeviceModelInTenant(tenantID, uuid, meta)).
-		Returning("NULL").
-		Exec(context.Background())
-	return err
+	return r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().
+			Model(bunrepo.NewDeviceModelInTenant(tenantID, uuid, meta)).
+			Returning("NULL").
+			Exec(ctx); err != nil {
+			return err
+		}
+		return bindIdentities(ctx, tx, bunrepo.NormalizeTenantID(tenantID), uuid, meta.Identities)
+	})
 }
 
 func (r *Repository) DestroyDevice(uuid string) error {
@@ -55,6 +60,27 @@ func (r *Repository) DestroyDevice(uuid string) error {
 		if _, err := tx.NewRaw("DELETE FROM logs WHERE uuid = ?", uuid).Exec(ctx); err != nil {
 			return err
 		}
+		if _, err := tx.NewRaw("DELETE FROM device_states WHERE uuid = ?", uuid).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewRaw("DELETE FROM device_state_history WHERE uuid = ?", uuid).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewRaw("DELETE FROM device_diagnostics WHERE uuid = ?", uuid).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewRaw("DELETE FROM device_diagnostics_history WHERE uuid = ?", uuid).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewRaw("DELETE FROM device_shadows WHERE uuid = ?", uuid).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewRaw("DELETE FROM device_identities WHERE uuid = ?", uuid).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewRaw("DELETE FROM group_devices WHERE device_uuid = ?", uuid).Exec(ctx); err != nil {
+			return err
+		}
 		return nil
 	})
 }
@@ -72,7 +98,18 @@ func (r *Repository) LoadConfig(uuid string) (inter.DeviceMetadata, error) {
 		}
 		return inter.DeviceMetadata{}, err
 	}
-	return row.ToMetadata(), nil
+	return r.withIdentities(row)
+}
+
+// withIdentities 为单设备查询补齐已登记的身份，列表查询不做这一步。
+func (r *Repository) withIdentities(row bunrepo.DeviceModel) (inter.DeviceMetadata, error) {
+	meta := row.ToMetadata()
+	identities, err := r.ListDeviceIdentities(row.UUID)
+	if err != nil {
+		return inter.DeviceMetadata{}, err
+	}
+	meta.Identities = identities
+	return meta, nil
 }
 
 func (r *Repository) SaveMetadata(uuid string, meta inter.DeviceMetadata) error {
@@ -92,6 +129,67 @@ func (r *Repository) SaveMetadata(uuid string, meta inter.DeviceMetadata) error
 	return err
 }
 
+// SaveDescriptor 只刷新设备上报的版本与扩展描述，不改动名称、Token 与认证状态；未上报的版本保留原值。
+func (r *Repository) SaveDescriptor(uuid string, meta inter.DeviceMetadata) error {
+	model := bunrepo.DeviceModel{}
+	model.SetDescriptor(meta.Descriptor)
+	res, err := r.db.NewUpdate().
+		Model((*bunrepo.DeviceModel)(nil)).
+		Set("hw_version = COALESCE(NULLIF(?, ''), hw_version)", meta.HWVersion).
+		Set("sw_version = COALESCE(NULLIF(?, ''), sw_version)", meta.SWVersion).
+		Set("config_version = COALESCE(NULLIF(?, ''), config_version)", meta.ConfigVersion).
+		Set("manufacturer = ?", model.Manufacturer).
+		Set("vendor = ?", model.Vendor).
+		Set("model = ?", model.Model).
+		Set("model_id = ?", model.ModelID).
+		Set("firmware_version = ?", model.FirmwareVersion).
+		Set("hardware_revision = ?", model.HardwareRevision).
+		Set("software_build_id = ?", model.SoftwareBuildID).
+		Set("power_source = ?", model.PowerSource).
+		Set("device_type = ?", model.DeviceType).
+		Set("labels_json = ?", model.LabelsJSON).
+		Set("attributes_json = ?", model.AttributesJSON).
+		Set("entities_json = ?", model.EntitiesJSON).
+		Set("endpoints_json = ?", model.EndpointsJSON).
+		Set("capabilities_json = ?", model.CapabilitiesJSON).
+		Where("uuid = ?", uuid).
+		Returning("NULL").
+		Exec(context.Background())
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return inter.ErrDeviceNotFound
+	}
+	return nil
+}
+
+func (r *Repository) SaveDeviceCapabilities(uuid string, capabilities []inter.DeviceCapability) error {
+	model := bunrepo.DeviceModel{}
+	model.SetDescriptor(inter.DeviceDescriptor{Capabilities: capabilities})
+	res, err := r.db.NewUpdate().
+		Model((*bunrepo.DeviceModel)(nil)).
+		Set("capabilities_json = ?", model.CapabilitiesJSON).
+		Where("uuid = ?", uuid).
+		Returning("NULL").
+		Exec(context.Background())
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return inter.ErrDeviceNotFound
+	}
+	return nil
+}
+
 func (r *Repository) ListDevices(page, size int) ([]inter.DeviceRecord, error) {
 	if page <= 0 {
 		page = 1
@@ -221,7 +319,7 @@ func (r *Repository) LoadConfigByTenant(tenantID, uuid string) (inter.DeviceMeta
 		}
 		return inter.DeviceMetadata{}, err
 	}
-	return row.ToMetadata(), nil
+	return r.withIdentities(row)
 }
 
 func (r *Repository) ListDevicesByTenant(tenantID string, status *inter.AuthenticateStatusType, page, size int) ([]inter.DeviceRecord, error) {
@@ -253,3 +351,83 @@ func (r *Repository) ListDevicesByTenant(tenantID string, status *inter.Authenti
 	}
 	return out, nil
 }
+
+func (r *Repository) BindDeviceIdentities(uuid string, identities []inter.DeviceIdentity) error {
+	if len(identities) == 0 {
+		return nil
+	}
+	tenantID, err := r.ResolveDeviceTenant(uuid)
+	if err != nil {
+		return err
+	}
+	return r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		return bindIdentities(ctx, tx, tenantID, uuid, identities)
+	})
+}
+
+func bindIdentities(ctx context.Context, tx bun.Tx, tenantID, uuid string, identities []inter.DeviceIdentity) error {
+	now := time.Now().UnixMilli()
+	for _, identity := range identities {
+		if identity.Type == "" || identity.Value == "" {
+			continue
+		}
+		row := &bunrepo.DeviceIdentityModel{
+			Type:      identity.Type,
+			Value:     identity.Value,
+			UUID:      uuid,
+			TenantID:  tenantID,
+			Issuer:    identity.Issuer,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		// 身份已属于其他设备时保持原绑定，避免伪造的上报把身份劫持到另一台设备。
+		if _, err := tx.NewInsert().
+			Model(row).
+			On("CONFLICT (identity_type, identity_value) DO UPDATE").
+			Set("issuer = CASE WHEN ?TableAlias.uuid = EXCLUDED.uuid THEN EXCLUDED.issuer ELSE ?TableAlias.issuer END").
+			Set("updated_at = CASE WHEN ?TableAlias.uuid = EXCLUDED.uuid THEN EXCLUDED.updated_at ELSE ?TableAlias.updated_at END").
+			Returning("NULL").
+			Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) ResolveDeviceIdentities(identities []inter.DeviceIdentity) (string, error) {
+	for _, identity := range identities {
+		if identity.Type == "" || identity.Value == "" {
+			continue
+		}
+		var row bunrepo.DeviceIdentityModel
+		err := r.db.NewSelect().
+			Model(&row).
+			Where("identity_type = ?", identity.Type).
+			Where("identity_value = ?", identity.Value).
+			Limit(1).
+			Scan(context.Background())
+		if err == nil {
+			return row.UUID, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+	}
+	return "", inter.ErrDeviceNotFound
+}
+
+func (r *Repository) ListDeviceIdentities(uuid string) ([]inter.DeviceIdentity, error) {
+	var rows []bunrepo.DeviceIdentityModel
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Where("uuid = ?", uuid).
+		OrderExpr("identity_type ASC, identity_value ASC").
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	out := make([]inter.DeviceIdentity, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToIdentity())
+	}
+	return out, nil
+}
@@ -258,3 +258,95 @@ func TestRepositoryGetDeviceByTokenMissingWrapsError(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestRepositoryDescriptorAndIdentities(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "device_descriptor.db")
+	repo := device.NewRepository(base.DB)
+
+	meta := inter.DeviceMetadata{
+		Name:      "bulb",
+		SWVersion: "1.0.0",
+		Descriptor: inter.DeviceDescriptor{
+			Manufacturer: "IKEA",
+			Model:        "LED1545G12",
+			PowerSource:  "mains",
+			Labels:       map[string]string{"room": "kitchen"},
+			Attributes:   map[string]interface{}{"zcl_version": float64(3)},
+			Entities:     []byte(`[{"entity_id":"bulb.state"}]`),
+			Capabilities: []inter.DeviceCapability{{Property: "brightness", Type: "numeric", Writable: true, ValueMin: "0", ValueMax: "254"}},
+		},
+		Identities: []inter.DeviceIdentity{{Type: inter.DeviceIdentityIEEEAddress, Value: "0x00124b0001"}},
+	}
+	if err := repo.InitDevice("uuid-bulb", meta); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	if err := repo.InitDevice("uuid-other", inter.DeviceMetadata{Name: "other"}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+
+	loaded, err := repo.LoadConfig("uuid-bulb")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	d := loaded.Descriptor
+	if d.Manufacturer != "IKEA" || d.Labels["room"] != "kitchen" || d.Attributes["zcl_version"] != float64(3) || string(d.Entities) != `[{"entity_id":"bulb.state"}]` || d.Endpoints != nil {
+		t.Fatalf("unexpected descriptor: %+v", d)
+	}
+	if len(d.Capabilities) != 1 || !d.Capabilities[0].Writable || d.Capabilities[0].ValueMax != "254" {
+		t.Fatalf("unexpected capabilities: %+v", d.Capabilities)
+	}
+	if len(loaded.Identities) != 1 || loaded.Identities[0].Value != "0x00124b0001" {
+		t.Fatalf("unexpected identities: %+v", loaded.Identities)
+	}
+
+	// 已属于 uuid-bulb 的身份不能被其他设备改绑。
+	if err := repo.BindDeviceIdentities("uuid-other", []inter.DeviceIdentity{
+		{Type: inter.DeviceIdentityIEEEAddress, Value: "0x00124b0001"},
+		{Type: inter.DeviceIdentityClientID, Value: "other-client"},
+	}); err != nil {
+		t.Fatalf("BindDeviceIdentities failed: %v", err)
+	}
+	owner, err := repo.ResolveDeviceIdentities([]inter.DeviceIdentity{{Type: inter.DeviceIdentityIEEEAddress, Value: "0x00124b0001"}})
+	if err != nil || owner != "uuid-bulb" {
+		t.Fatalf("identity should stay with original device, got %q err=%v", owner, err)
+	}
+	owner, err = repo.ResolveDeviceIdentities([]inter.DeviceIdentity{{Type: inter.DeviceIdentityMAC, Value: "missing"}, {Type: inter.DeviceIdentityClientID, Value: "other-client"}})
+	if err != nil || owner != "uuid-other" {
+		t.Fatalf("expected second identity to resolve, got %q err=%v", owner, err)
+	}
+	if _, err := repo.ResolveDeviceIdentities([]inter.DeviceIdentity{{Type: inter.DeviceIdentityMAC, Value: "missing"}}); !errors.Is(err, inter.ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
+	}
+
+	if err := repo.SaveDescriptor("uuid-bulb", inter.DeviceMetadata{HWVersion: "rev-b", Descriptor: inter.DeviceDescriptor{Manufacturer: "IKEA of Sweden"}}); err != nil {
+		t.Fatalf("SaveDescriptor failed: %v", err)
+	}
+	refreshed, err := repo.LoadConfig("uuid-bulb")
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if refreshed.SWVersion != "1.0.0" || refreshed.HWVersion != "rev-b" || refreshed.Name != "bulb" || refreshed.Descriptor.Manufacturer != "IKEA of Sweden" || refreshed.Descriptor.Capabilities != nil {
+		t.Fatalf("unexpected refreshed metadata: %+v", refreshed)
+	}
+	if err := repo.SaveDescriptor("missing", inter.DeviceMetadata{}); !errors.Is(err, inter.ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
+	}
+
+	if err := repo.SaveDeviceCapabilities("uuid-bulb", []inter.DeviceCapability{{Property: "state", Type: "binary", Writable: true}}); err != nil {
+		t.Fatalf("SaveDeviceCapabilities failed: %v", err)
+	}
+	refreshed, err = repo.LoadConfig("uuid-bulb")
+	if err != nil || len(refreshed.Descriptor.Capabilities) != 1 || refreshed.Descriptor.Manufacturer != "IKEA of Sweden" {
+		t.Fatalf("capabilities should be replaced without touching the descriptor: %+v err=%v", refreshed.Descriptor, err)
+	}
+	if err := repo.SaveDeviceCapabilities("missing", nil); !errors.Is(err, inter.ErrDeviceNotFound) {
+		t.Fatalf("expected ErrDeviceNotFound, got %v", err)
+	}
+
+	if err := repo.DestroyDevice("uuid-bulb"); err != nil {
+		t.Fatalf("DestroyDevice failed: %v", err)
+	}
+	if identities, err := repo.ListDeviceIdentities("uuid-bulb"); err != nil || len(identities) != 0 {
+		t.Fatalf("identities should be removed with the device: %+v err=%v", identities, err)
+	}
+}
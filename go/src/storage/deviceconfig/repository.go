@@ -0,0 +1,212 @@
+package deviceconfig
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+type Repository struct {
+	db *bun.DB
+}
+
+func NewRepository(db *bun.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateConfigDocument(doc inter.ConfigDocument) (inter.ConfigDocument, error) {
+	if !doc.ScopeType.Valid() {
+		return inter.ConfigDocument{}, inter.ErrConfigDocumentInvalid
+	}
+	if doc.CreatedAt.IsZero() {
+		doc.CreatedAt = time.Now()
+	}
+	row := bunrepo.NewConfigDocumentRow(doc)
+	err := r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		// 并发保存同一作用对象时，唯一索引会让后到的写入失败，而不是产生重复版本。
+		var latest int64
+		if err := tx.NewSelect().
+			Model((*bunrepo.ConfigDocumentRow)(nil)).
+			ColumnExpr("COALESCE(MAX(version), 0)").
+			Where("tenant_id = ?", row.TenantID).
+			Where("scope_type = ?", row.ScopeType).
+			Where("scope_id = ?", row.ScopeID).
+			Scan(ctx, &latest); err != nil {
+			return err
+		}
+		row.Version = latest + 1
+		_, err := tx.NewInsert().
+			Model(row).
+			ExcludeColumn("id").
+			Returning("id").
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return inter.ConfigDocument{}, err
+	}
+	return row.ToConfigDocument(), nil
+}
+
+func (r *Repository) GetConfigDocument(tenantID string, scopeType inter.ConfigScopeType, scopeID string, version int64) (inter.ConfigDocument, error) {
+	var row bunrepo.ConfigDocumentRow
+	q := r.db.NewSelect().
+		Model(&row).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("scope_type = ?", string(scopeType)).
+		Where("scope_id = ?", strings.TrimSpace(scopeID))
+	if version > 0 {
+		q = q.Where("version = ?", version)
+	} else {
+		q = q.Order("version DESC")
+	}
+	if err := q.Limit(1).Scan(context.Background()); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.ConfigDocument{}, inter.ErrConfigDocumentNotFound
+		}
+		return inter.ConfigDocument{}, err
+	}
+	return row.ToConfigDocument(), nil
+}
+
+func (r *Repository) ListConfigDocuments(tenantID string, scopeType inter.ConfigScopeType, scopeID string, limit int) ([]inter.ConfigDocument, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var rows []bunrepo.ConfigDocumentRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("scope_type = ?", string(scopeType)).
+		Where("scope_id = ?", strings.TrimSpace(scopeID)).
+		Order("version DESC").
+		Limit(limit).
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	docs := make([]inter.ConfigDocument, 0, len(rows))
+	for _, row := range rows {
+		docs = append(docs, row.ToConfigDocument())
+	}
+	return docs, nil
+}
+
+func (r *Repository) ListDeviceConfigLayers(tenantID, uuid string) ([]inter.ConfigDocument, error) {
+	tenantID = bunrepo.NormalizeTenantID(tenantID)
+	uuid = strings.TrimSpace(uuid)
+	var groupIDs []string
+	if err := r.db.NewSelect().
+		TableExpr("group_devices AS gd").
+		Join("JOIN device_groups AS g ON g.id = gd.group_id").
+		ColumnExpr("gd.group_id").
+		Where("gd.device_uuid = ?", uuid).
+		Where("g.tenant_id = ?", tenantID).
+		Order("gd.group_id ASC").
+		Scan(context.Background(), &groupIDs); err != nil {
+		return nil, err
+	}
+
+	scopes := make([]inter.ConfigSource, 0, len(groupIDs)+2)
+	scopes = append(scopes, inter.ConfigSource{ScopeType: inter.ConfigScopeTenant})
+	for _, groupID := range groupIDs {
+		scopes = append(scopes, inter.ConfigSource{ScopeType: inter.ConfigScopeGroup, ScopeID: groupID})
+	}
+	scopes = append(scopes, inter.ConfigSource{ScopeType: inter.ConfigScopeDevice, ScopeID: uuid})
+
+	var layers []inter.ConfigDocument
+	for _, scope := range scopes {
+		doc, err := r.GetConfigDocument(tenantID, scope.ScopeType, scope.ScopeID, 0)
+		if errors.Is(err, inter.ErrConfigDocumentNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, doc)
+	}
+	return layers, nil
+}
+
+func (r *Repository) GetDeviceConfigState(uuid string) (inter.DeviceConfigState, error) {
+	uuid = strings.TrimSpace(uuid)
+	var row bunrepo.DeviceConfigStateRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Where("uuid = ?", uuid).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.DeviceConfigState{UUID: uuid}, nil
+		}
+		return inter.DeviceConfigState{}, err
+	}
+	return row.ToDeviceConfigState(), nil
+}
+
+func (r *Repository) SaveDeviceConfigState(state inter.DeviceConfigState) error {
+	if state.UpdatedAt.IsZero() {
+		state.UpdatedAt = time.Now()
+	}
+	row := bunrepo.NewDeviceConfigStateRow(state)
+	if row.UUID == "" {
+		return errors.New("uuid is required")
+	}
+	_, err := r.db.NewInsert().
+		Model(row).
+		On("CONFLICT (uuid) DO UPDATE").
+		Set("tenant_id = EXCLUDED.tenant_id").
+		Set("current_version = EXCLUDED.current_version").
+		Set("pushed_version = EXCLUDED.pushed_version").
+		Set("command_id = EXCLUDED.command_id").
+		Set("pushed_at = EXCLUDED.pushed_at").
+		Set("acked_version = EXCLUDED.acked_version").
+		Set("acked_at = EXCLUDED.acked_at").
+		Set("updated_at = EXCLUDED.updated_at").
+		Returning("NULL").
+		Exec(context.Background())
+	return err
+}
+
+func (r *Repository) RecordDeviceConfigAck(ack inter.DeviceConfigAck) error {
+	if ack.AckedAt.IsZero() {
+		ack.AckedAt = time.Now()
+	}
+	row := bunrepo.NewDeviceConfigAckRow(ack)
+	if row.UUID == "" || row.ConfigVersion == "" {
+		return errors.New("uuid and config_version are required")
+	}
+	_, err := r.db.NewInsert().
+		Model(row).
+		ExcludeColumn("id").
+		Returning("NULL").
+		Exec(context.Background())
+	return err
+}
+
+func (r *Repository) ListDeviceConfigAcks(tenantID, uuid string, limit int) ([]inter.DeviceConfigAck, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var rows []bunrepo.DeviceConfigAckRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("uuid = ?", strings.TrimSpace(uuid)).
+		Order("id DESC").
+		Limit(limit).
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	acks := make([]inter.DeviceConfigAck, 0, len(rows))
+	for _, row := range rows {
+		acks = append(acks, row.ToDeviceConfigAck())
+	}
+	return acks, nil
+}
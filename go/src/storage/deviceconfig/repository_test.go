@@ -0,0 +1,135 @@
+package deviceconfig_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/device"
+	"github.com/nhirsama/Goster-IoT/src/storage/deviceconfig"
+	"github.com/nhirsama/Goster-IoT/src/storage/group"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+)
+
+func TestRepositoryConfigDocumentsAndLayers(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "config_repo.db")
+	deviceRepo := device.NewRepository(base.DB)
+	groupRepo := group.NewRepository(base.DB)
+	repo := deviceconfig.NewRepository(base.DB)
+
+	uuid := "cfg-dev"
+	if err := deviceRepo.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	var groupIDs []string
+	for _, name := range []string{"lab", "floor"} {
+		g, err := groupRepo.CreateDeviceGroup(inter.DeviceGroup{Name: name})
+		if err != nil {
+			t.Fatalf("CreateDeviceGroup failed: %v", err)
+		}
+		if err := groupRepo.AddGroupDevice(g.ID, uuid); err != nil {
+			t.Fatalf("AddGroupDevice failed: %v", err)
+		}
+		groupIDs = append(groupIDs, g.ID)
+	}
+
+	for i := 1; i <= 2; i++ {
+		doc, err := repo.CreateConfigDocument(inter.ConfigDocument{
+			ScopeType: inter.ConfigScopeTenant,
+			Content:   map[string]interface{}{"interval": float64(i * 10)},
+		})
+		if err != nil {
+			t.Fatalf("CreateConfigDocument failed: %v", err)
+		}
+		if doc.Version != int64(i) || doc.ID == 0 || doc.TenantID != inter.DefaultTenantID {
+			t.Fatalf("unexpected tenant document: %+v", doc)
+		}
+	}
+	if _, err := repo.CreateConfigDocument(inter.ConfigDocument{ScopeType: "site"}); !errors.Is(err, inter.ErrConfigDocumentInvalid) {
+		t.Fatalf("expected invalid scope error, got %v", err)
+	}
+	if _, err := repo.CreateConfigDocument(inter.ConfigDocument{ScopeType: inter.ConfigScopeGroup, ScopeID: groupIDs[1], Content: map[string]interface{}{"mode": "eco"}}); err != nil {
+		t.Fatalf("create group document failed: %v", err)
+	}
+	if _, err := repo.CreateConfigDocument(inter.ConfigDocument{ScopeType: inter.ConfigScopeDevice, ScopeID: uuid, Content: map[string]interface{}{"mode": nil}}); err != nil {
+		t.Fatalf("create device document failed: %v", err)
+	}
+
+	latest, err := repo.GetConfigDocument("", inter.ConfigScopeTenant, "", 0)
+	if err != nil || latest.Version != 2 || latest.Content["interval"] != float64(20) {
+		t.Fatalf("unexpected latest document: %+v err=%v", latest, err)
+	}
+	first, err := repo.GetConfigDocument("", inter.ConfigScopeTenant, "", 1)
+	if err != nil || first.Content["interval"] != float64(10) {
+		t.Fatalf("unexpected first document: %+v err=%v", first, err)
+	}
+	if _, err := repo.GetConfigDocument("tenant_other", inter.ConfigScopeTenant, "", 0); !errors.Is(err, inter.ErrConfigDocumentNotFound) {
+		t.Fatalf("expected not found for other tenant, got %v", err)
+	}
+	history, err := repo.ListConfigDocuments("", inter.ConfigScopeTenant, "", 10)
+	if err != nil || len(history) != 2 || history[0].Version != 2 {
+		t.Fatalf("unexpected history: %+v err=%v", history, err)
+	}
+
+	// 没有文档的分组不出现在层级里，设备层保留值为 null 的键。
+	layers, err := repo.ListDeviceConfigLayers("", uuid)
+	if err != nil || len(layers) != 3 {
+		t.Fatalf("unexpected layers: %+v err=%v", layers, err)
+	}
+	if layers[0].ScopeType != inter.ConfigScopeTenant || layers[1].ScopeID != groupIDs[1] || layers[2].ScopeType != inter.ConfigScopeDevice {
+		t.Fatalf("unexpected layer order: %+v", layers)
+	}
+	if v, ok := layers[2].Content["mode"]; !ok || v != nil {
+		t.Fatalf("expected null override to survive storage, got %+v", layers[2].Content)
+	}
+	if other, err := repo.ListDeviceConfigLayers("tenant_other", uuid); err != nil || len(other) != 0 {
+		t.Fatalf("expected no layers for other tenant, got %+v err=%v", other, err)
+	}
+}
+
+func TestRepositoryDeviceConfigStateAndAcks(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "config_state_repo.db")
+	repo := deviceconfig.NewRepository(base.DB)
+
+	state, err := repo.GetDeviceConfigState("cfg-state")
+	if err != nil || state.UUID != "cfg-state" || state.PushedVersion != "" {
+		t.Fatalf("unexpected empty state: %+v err=%v", state, err)
+	}
+	pushedAt := time.Now()
+	state.PushedVersion = "abc"
+	state.CommandID = 7
+	state.PushedAt = &pushedAt
+	if err := repo.SaveDeviceConfigState(state); err != nil {
+		t.Fatalf("SaveDeviceConfigState failed: %v", err)
+	}
+	state.CommandID = 0
+	state.AckedVersion = "abc"
+	state.AckedAt = &pushedAt
+	if err := repo.SaveDeviceConfigState(state); err != nil {
+		t.Fatalf("SaveDeviceConfigState update failed: %v", err)
+	}
+	got, err := repo.GetDeviceConfigState("cfg-state")
+	if err != nil || got.TenantID != inter.DefaultTenantID || got.CommandID != 0 || got.AckedVersion != "abc" || got.PushedAt == nil {
+		t.Fatalf("unexpected saved state: %+v err=%v", got, err)
+	}
+
+	for _, version := range []string{"v1", "v2"} {
+		if err := repo.RecordDeviceConfigAck(inter.DeviceConfigAck{
+			UUID:          "cfg-state",
+			ConfigVersion: version,
+			Sources:       []inter.ConfigSource{{ScopeType: inter.ConfigScopeTenant, Version: 1}},
+			Source:        inter.DeviceConfigAckCommand,
+			CommandID:     7,
+		}); err != nil {
+			t.Fatalf("RecordDeviceConfigAck failed: %v", err)
+		}
+	}
+	acks, err := repo.ListDeviceConfigAcks("", "cfg-state", 10)
+	if err != nil || len(acks) != 2 || acks[0].ConfigVersion != "v2" || len(acks[0].Sources) != 1 {
+		t.Fatalf("unexpected acks: %+v err=%v", acks, err)
+	}
+	if acks, err := repo.ListDeviceConfigAcks("tenant_other", "cfg-state", 10); err != nil || len(acks) != 0 {
+		t.Fatalf("expected no acks for other tenant, got %+v err=%v", acks, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sort"
 	"strings"
 	"time"
 
@@ -40,9 +41,10 @@ func (r *Repository) UpsertExternalEntity(entity inter.ExternalEntity) error {
 	}
 	_, err = r.db.NewInsert().
 		Model(row).
-		On("CONFLICT (source, entity_id) DO UPDATE").
+		On("CONFLICT (tenant_id, source, entity_id) DO UPDATE").
 		Set("domain = EXCLUDED.domain").
-		Set("goster_uuid = EXCLUDED.goster_uuid").
+		// goster_uuid 只在首次插入时写入，之后只能通过 UpdateExternalEntityLink 修改；
+		// 上报不会覆盖，也不会把运维显式解除的关联重新连上。
 		Set("device_id = EXCLUDED.device_id").
 		Set("model = EXCLUDED.model").
 		Set("name = EXCLUDED.name").
@@ -63,16 +65,30 @@ func (r *Repository) UpsertExternalEntity(entity inter.ExternalEntity) error {
 }
 
 func (r *Repository) GetExternalEntity(source, entityID string) (inter.ExternalEntity, error) {
+	return r.getExternalEntity("", source, entityID)
+}
+
+// GetExternalEntityByTenant 在指定租户范围内读取外部实体。
+func (r *Repository) GetExternalEntityByTenant(tenantID, source, entityID string) (inter.ExternalEntity, error) {
+	if strings.TrimSpace(tenantID) == "" {
+		return inter.ExternalEntity{}, errors.New("tenant_id is required")
+	}
+	return r.getExternalEntity(tenantID, source, entityID)
+}
+
+func (r *Repository) getExternalEntity(tenantID, source, entityID string) (inter.ExternalEntity, error) {
 	var row bunrepo.ExternalEntityRow
-	err := r.db.NewSelect().
+	query := r.db.NewSelect().
 		Model(&row).
-		Where("source = ?", source).
-		Where("entity_id = ?", entityID).
-		Limit(1).
-		Scan(context.Background())
-	if err != nil {
+		Where("source = ?", strings.TrimSpace(source)).
+		Where("entity_id = ?", strings.TrimSpace(entityID)).
+		Limit(1)
+	if tenantID = strings.TrimSpace(tenantID); tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	if err := query.Scan(context.Background()); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return inter.ExternalEntity{}, errors.New("external entity not found")
+			return inter.ExternalEntity{}, inter.ErrExternalEntityNotFound
 		}
 		return inter.ExternalEntity{}, err
 	}
@@ -80,6 +96,15 @@ func (r *Repository) GetExternalEntity(source, entityID string) (inter.ExternalE
 }
 
 func (r *Repository) ListExternalEntities(source, domain string, limit, offset int) ([]inter.ExternalEntity, error) {
+	return r.listExternalEntities("", inter.ExternalEntityFilter{Source: source, Domain: domain}, limit, offset)
+}
+
+// ListExternalEntitiesByTenant 按 source/domain/room 分页列出外部实体，tenantID 为空时不按租户过滤。
+func (r *Repository) ListExternalEntitiesByTenant(tenantID string, filter inter.ExternalEntityFilter, limit, offset int) ([]inter.ExternalEntity, error) {
+	return r.listExternalEntities(tenantID, filter, limit, offset)
+}
+
+func (r *Repository) listExternalEntities(tenantID string, filter inter.ExternalEntityFilter, limit, offset int) ([]inter.ExternalEntity, error) {
 	if limit <= 0 {
 		limit = 100
 	}
@@ -92,11 +117,17 @@ func (r *Repository) ListExternalEntities(source, domain string, limit, offset i
 		OrderExpr("last_seen_ts DESC, id DESC").
 		Limit(limit).
 		Offset(offset)
-	if strings.TrimSpace(source) != "" {
-		query = query.Where("source = ?", strings.TrimSpace(source))
+	if tenantID = strings.TrimSpace(tenantID); tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	if source := strings.TrimSpace(filter.Source); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if domain := strings.TrimSpace(filter.Domain); domain != "" {
+		query = query.Where("domain = ?", domain)
 	}
-	if strings.TrimSpace(domain) != "" {
-		query = query.Where("domain = ?", strings.TrimSpace(domain))
+	if room := strings.TrimSpace(filter.Room); room != "" {
+		query = query.Where("room_name = ?", room)
 	}
 
 	var rows []bunrepo.ExternalEntityRow
@@ -115,6 +146,28 @@ func (r *Repository) ListExternalEntities(source, domain string, limit, offset i
 	return out, nil
 }
 
+// UpdateExternalEntityLink 修改外部实体关联的 Goster 设备 UUID。
+func (r *Repository) UpdateExternalEntityLink(tenantID, source, entityID, gosterUUID string) error {
+	if strings.TrimSpace(tenantID) == "" {
+		return errors.New("tenant_id is required")
+	}
+	res, err := r.db.NewUpdate().
+		Model((*bunrepo.ExternalEntityRow)(nil)).
+		Set("goster_uuid = ?", strings.TrimSpace(gosterUUID)).
+		Set("updated_at = CURRENT_TIMESTAMP").
+		Where("tenant_id = ?", strings.TrimSpace(tenantID)).
+		Where("source = ?", strings.TrimSpace(source)).
+		Where("entity_id = ?", strings.TrimSpace(entityID)).
+		Exec(context.Background())
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return inter.ErrExternalEntityNotFound
+	}
+	return nil
+}
+
 func (r *Repository) BatchAppendExternalObservations(items []inter.ExternalObservation) error {
 	if len(items) == 0 {
 		return nil
@@ -145,13 +198,25 @@ func (r *Repository) BatchAppendExternalObservations(items []inter.ExternalObser
 
 	_, err := r.db.NewInsert().
 		Model(&rows).
-		On("CONFLICT (source, entity_id, ts, value_sig) DO NOTHING").
+		On("CONFLICT (tenant_id, source, entity_id, ts, value_sig) DO NOTHING").
 		Returning("NULL").
 		Exec(context.Background())
 	return err
 }
 
 func (r *Repository) QueryExternalObservations(source, entityID string, start, end int64, limit int) ([]inter.ExternalObservation, error) {
+	return r.queryExternalObservations("", source, entityID, start, end, limit)
+}
+
+// QueryExternalObservationsByTenant 在指定租户范围内查询外部观测值。
+func (r *Repository) QueryExternalObservationsByTenant(tenantID, source, entityID string, start, end int64, limit int) ([]inter.ExternalObservation, error) {
+	if strings.TrimSpace(tenantID) == "" {
+		return nil, errors.New("tenant_id is required")
+	}
+	return r.queryExternalObservations(tenantID, source, entityID, start, end, limit)
+}
+
+func (r *Repository) queryExternalObservations(tenantID, source, entityID string, start, end int64, limit int) ([]inter.ExternalObservation, error) {
 	if end <= 0 {
 		end = time.Now().UnixMilli()
 	}
@@ -163,15 +228,17 @@ func (r *Repository) QueryExternalObservations(source, entityID string, start, e
 	}
 
 	var rows []bunrepo.ExternalObservationRow
-	err := r.db.NewSelect().
+	query := r.db.NewSelect().
 		Model(&rows).
 		Where("source = ?", strings.TrimSpace(source)).
 		Where("entity_id = ?", strings.TrimSpace(entityID)).
 		Where("ts BETWEEN ? AND ?", start, end).
 		OrderExpr("ts ASC").
-		Limit(limit).
-		Scan(context.Background())
-	if err != nil {
+		Limit(limit)
+	if tenantID = strings.TrimSpace(tenantID); tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	if err := query.Scan(context.Background()); err != nil {
 		return nil, err
 	}
 
@@ -185,3 +252,201 @@ func (r *Repository) QueryExternalObservations(source, entityID string, start, e
 	}
 	return out, nil
 }
+
+// CreateExternalCommand 记录一条发往外部实体的命令，默认状态为 pending。
+func (r *Repository) CreateExternalCommand(cmd inter.ExternalCommand) (inter.ExternalCommand, error) {
+	if strings.TrimSpace(cmd.Source) == "" || strings.TrimSpace(cmd.EntityID) == "" {
+		return inter.ExternalCommand{}, errors.New("source/entity_id is required")
+	}
+	if strings.TrimSpace(cmd.Command) == "" {
+		return inter.ExternalCommand{}, errors.New("command is required")
+	}
+	row, err := bunrepo.NewExternalCommandRow(cmd)
+	if err != nil {
+		return inter.ExternalCommand{}, err
+	}
+	if _, err := r.db.NewInsert().
+		Model(row).
+		Returning("id").
+		Exec(context.Background()); err != nil {
+		return inter.ExternalCommand{}, err
+	}
+	return row.ToExternalCommand()
+}
+
+func (r *Repository) GetExternalCommand(id int64) (inter.ExternalCommand, error) {
+	var row bunrepo.ExternalCommandRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Where("id = ?", id).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.ExternalCommand{}, inter.ErrExternalCommandNotFound
+		}
+		return inter.ExternalCommand{}, err
+	}
+	return row.ToExternalCommand()
+}
+
+// ListExternalCommandsByTenant 按请求时间倒序列出外部实体的命令。
+func (r *Repository) ListExternalCommandsByTenant(tenantID, source, entityID string, limit int) ([]inter.ExternalCommand, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var rows []bunrepo.ExternalCommandRow
+	query := r.db.NewSelect().
+		Model(&rows).
+		Where("source = ?", strings.TrimSpace(source)).
+		Where("entity_id = ?", strings.TrimSpace(entityID)).
+		OrderExpr("requested_at DESC, id DESC").
+		Limit(limit)
+	if tenantID = strings.TrimSpace(tenantID); tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	if err := query.Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	return toExternalCommands(rows)
+}
+
+// externalCommandClaimLease 是领取租约；adapter 在租约内没有回执时命令可被重新领取。
+const externalCommandClaimLease = time.Minute
+
+// ClaimPendingExternalCommands 以单条 UPDATE ... RETURNING 领取命令，并发拉取时同一命令在租约内只会被领取一次。
+// 领取不改变 pending 状态，adapter 发布成功后回执 sent 才算发出；实体与命令都限定在 tenantID 内。
+func (r *Repository) ClaimPendingExternalCommands(tenantID, source, deviceID string, limit int) ([]inter.ExternalCommand, error) {
+	tenantID = strings.TrimSpace(tenantID)
+	source = strings.TrimSpace(source)
+	deviceID = strings.TrimSpace(deviceID)
+	if tenantID == "" || source == "" || deviceID == "" {
+		return nil, errors.New("tenant_id/source/device_id is required")
+	}
+	if limit <= 0 {
+		limit = 1
+	}
+
+	now := time.Now().UTC()
+	cutoff := now.Add(-externalCommandClaimLease)
+	entities := r.db.NewSelect().
+		Table("integration_external_entities").
+		Column("entity_id").
+		Where("tenant_id = ?", tenantID).
+		Where("source = ?", source).
+		Where("device_id = ?", deviceID)
+	pending := r.db.NewSelect().
+		Table("integration_external_commands").
+		Column("id").
+		Where("tenant_id = ?", tenantID).
+		Where("source = ?", source).
+		Where("status = ?", string(inter.ExternalCommandStatusPending)).
+		Where("(claimed_at IS NULL OR claimed_at < ?)", cutoff).
+		Where("entity_id IN (?)", entities).
+		OrderExpr("requested_at ASC, id ASC").
+		Limit(limit)
+
+	var rows []bunrepo.ExternalCommandRow
+	if _, err := r.db.NewUpdate().
+		Table("integration_external_commands").
+		Set("claimed_at = ?", now).
+		Where("id IN (?)", pending).
+		Where("status = ?", string(inter.ExternalCommandStatusPending)).
+		Where("(claimed_at IS NULL OR claimed_at < ?)", cutoff).
+		Returning("*").
+		Exec(context.Background(), &rows); err != nil {
+		return nil, err
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].RequestedAt.Equal(rows[j].RequestedAt) {
+			return rows[i].ID < rows[j].ID
+		}
+		return rows[i].RequestedAt.Before(rows[j].RequestedAt)
+	})
+	return toExternalCommands(rows)
+}
+
+// RenewExternalCommandClaims 续期 tenantID 内仍为 pending 且已被领取的命令，推送会话持有命令期间不会被重新领取。
+func (r *Repository) RenewExternalCommandClaims(tenantID string, ids []int64) error {
+	tenantID = strings.TrimSpace(tenantID)
+	if tenantID == "" || len(ids) == 0 {
+		return nil
+	}
+	_, err := r.db.NewUpdate().
+		Table("integration_external_commands").
+		Set("claimed_at = ?", time.Now().UTC()).
+		Where("tenant_id = ?", tenantID).
+		Where("id IN (?)", bun.In(ids)).
+		Where("status = ?", string(inter.ExternalCommandStatusPending)).
+		Where("claimed_at IS NOT NULL").
+		Exec(context.Background())
+	return err
+}
+
+// UpdateExternalCommandStatus 只更新 tenantID 内仍为 pending/sent 的命令，迟到的回执不会改写已确认或已失败的命令。
+func (r *Repository) UpdateExternalCommandStatus(tenantID string, id int64, status inter.ExternalCommandStatus, errorText string) error {
+	tenantID = strings.TrimSpace(tenantID)
+	if id <= 0 || tenantID == "" {
+		return errors.New("invalid command id")
+	}
+	switch status {
+	case inter.ExternalCommandStatusPending, inter.ExternalCommandStatusSent, inter.ExternalCommandStatusAcked, inter.ExternalCommandStatusFailed:
+	default:
+		return errors.New("invalid command status")
+	}
+
+	// adapter 的每次回执都刷新 executed_at；重新排队时保留上次时间并释放领取租约。
+	var executedAt *time.Time
+	if status != inter.ExternalCommandStatusPending {
+		now := time.Now().UTC()
+		executedAt = &now
+	}
+	query := r.db.NewUpdate().
+		Table("integration_external_commands").
+		Set("status = ?", string(status)).
+		Set("error_text = ?", bunrepo.NullableOptionalString(errorText)).
+		Set("executed_at = COALESCE(?, executed_at)", executedAt)
+	if status == inter.ExternalCommandStatusPending {
+		query = query.Set("claimed_at = NULL")
+	}
+	res, err := query.
+		Where("id = ?", id).
+		Where("tenant_id = ?", tenantID).
+		Where("status IN (?)", bun.In([]string{string(inter.ExternalCommandStatusPending), string(inter.ExternalCommandStatusSent)})).
+		Returning("NULL").
+		Exec(context.Background())
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+	exists, err := r.db.NewSelect().
+		Table("integration_external_commands").
+		Where("id = ?", id).
+		Where("tenant_id = ?", tenantID).
+		Exists(context.Background())
+	if err != nil {
+		return err
+	}
+	if exists {
+		return inter.ErrExternalCommandFinished
+	}
+	return inter.ErrExternalCommandNotFound
+}
+
+func toExternalCommands(rows []bunrepo.ExternalCommandRow) ([]inter.ExternalCommand, error) {
+	out := make([]inter.ExternalCommand, 0, len(rows))
+	for _, row := range rows {
+		item, err := row.ToExternalCommand()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
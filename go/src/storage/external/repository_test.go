@@ -1,6 +1,7 @@
 package external_test
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -76,3 +77,176 @@ func TestRepositoryExternalEntityAndObservationFlow(t *testing.T) {
 		t.Fatalf("unexpected external entity list: %+v", list)
 	}
 }
+
+func TestRepositoryExternalEntityTenantScopeAndLink(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "external_tenant.db")
+	repo := external.NewRepository(base.DB)
+
+	now := time.Now().UnixMilli()
+	for _, entity := range []inter.ExternalEntity{
+		{TenantID: "tenant_a", Source: "zigbee2mqtt", EntityID: "kitchen.temperature", Domain: "sensor", RoomName: "kitchen", GosterUUID: "ext_kitchen", LastStateTS: now},
+		{TenantID: "tenant_a", Source: "zigbee2mqtt", EntityID: "hall.contact", Domain: "binary_sensor", RoomName: "hall", LastStateTS: now},
+		{TenantID: "tenant_b", Source: "zigbee2mqtt", EntityID: "garage.temperature", Domain: "sensor", RoomName: "kitchen", LastStateTS: now},
+	} {
+		if err := repo.UpsertExternalEntity(entity); err != nil {
+			t.Fatalf("UpsertExternalEntity failed: %v", err)
+		}
+	}
+
+	list, err := repo.ListExternalEntitiesByTenant("tenant_a", inter.ExternalEntityFilter{Room: "kitchen"}, 10, 0)
+	if err != nil {
+		t.Fatalf("ListExternalEntitiesByTenant failed: %v", err)
+	}
+	if len(list) != 1 || list[0].EntityID != "kitchen.temperature" || list[0].TenantID != "tenant_a" {
+		t.Fatalf("unexpected tenant entity list: %+v", list)
+	}
+	if _, err := repo.GetExternalEntityByTenant("tenant_b", "zigbee2mqtt", "kitchen.temperature"); !errors.Is(err, inter.ErrExternalEntityNotFound) {
+		t.Fatalf("expected not found across tenants, got %v", err)
+	}
+
+	if err := repo.UpdateExternalEntityLink("tenant_a", "zigbee2mqtt", "kitchen.temperature", "dev-1"); err != nil {
+		t.Fatalf("UpdateExternalEntityLink failed: %v", err)
+	}
+	// 后续上报携带的自动 UUID 不能覆盖手动关联。
+	if err := repo.UpsertExternalEntity(inter.ExternalEntity{TenantID: "tenant_a", Source: "zigbee2mqtt", EntityID: "kitchen.temperature", Domain: "sensor", GosterUUID: "ext_kitchen", LastStateTS: now + 1}); err != nil {
+		t.Fatalf("UpsertExternalEntity after link failed: %v", err)
+	}
+	got, err := repo.GetExternalEntityByTenant("tenant_a", "zigbee2mqtt", "kitchen.temperature")
+	if err != nil {
+		t.Fatalf("GetExternalEntityByTenant failed: %v", err)
+	}
+	if got.GosterUUID != "dev-1" {
+		t.Fatalf("link should survive upsert, got %q", got.GosterUUID)
+	}
+	if err := repo.UpdateExternalEntityLink("tenant_b", "zigbee2mqtt", "kitchen.temperature", ""); !errors.Is(err, inter.ErrExternalEntityNotFound) {
+		t.Fatalf("expected not found when unlinking across tenants, got %v", err)
+	}
+	// 显式解除关联后，后续上报不能把关联重新连上。
+	if err := repo.UpdateExternalEntityLink("tenant_a", "zigbee2mqtt", "kitchen.temperature", ""); err != nil {
+		t.Fatalf("unlink failed: %v", err)
+	}
+	if err := repo.UpsertExternalEntity(inter.ExternalEntity{TenantID: "tenant_a", Source: "zigbee2mqtt", EntityID: "kitchen.temperature", Domain: "sensor", GosterUUID: "ext_kitchen", LastStateTS: now + 2}); err != nil {
+		t.Fatalf("UpsertExternalEntity after unlink failed: %v", err)
+	}
+	if got, err := repo.GetExternalEntityByTenant("tenant_a", "zigbee2mqtt", "kitchen.temperature"); err != nil || got.GosterUUID != "" {
+		t.Fatalf("unlinked entity should stay unlinked, got %+v err=%v", got, err)
+	}
+
+	// 不同租户上报相同 source/entity_id 时各自保存，互不覆盖。
+	if err := repo.UpsertExternalEntity(inter.ExternalEntity{TenantID: "tenant_b", Source: "zigbee2mqtt", EntityID: "kitchen.temperature", Domain: "sensor", RoomName: "lab", LastStateTS: now}); err != nil {
+		t.Fatalf("UpsertExternalEntity for second tenant failed: %v", err)
+	}
+	if got, err := repo.GetExternalEntityByTenant("tenant_a", "zigbee2mqtt", "kitchen.temperature"); err != nil || got.RoomName == "lab" {
+		t.Fatalf("second tenant overwrote the first tenant entity: %+v err=%v", got, err)
+	}
+	if got, err := repo.GetExternalEntityByTenant("tenant_b", "zigbee2mqtt", "kitchen.temperature"); err != nil || got.RoomName != "lab" {
+		t.Fatalf("expected second tenant entity stored separately, got %+v err=%v", got, err)
+	}
+
+	if err := repo.BatchAppendExternalObservations([]inter.ExternalObservation{
+		{TenantID: "tenant_a", Source: "zigbee2mqtt", EntityID: "kitchen.temperature", Timestamp: now},
+	}); err != nil {
+		t.Fatalf("BatchAppendExternalObservations failed: %v", err)
+	}
+	items, err := repo.QueryExternalObservationsByTenant("tenant_b", "zigbee2mqtt", "kitchen.temperature", now-1000, now+1000, 10)
+	if err != nil {
+		t.Fatalf("QueryExternalObservationsByTenant failed: %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("expected no observations across tenants, got %+v", items)
+	}
+	if err := repo.BatchAppendExternalObservations([]inter.ExternalObservation{
+		{TenantID: "tenant_b", Source: "zigbee2mqtt", EntityID: "kitchen.temperature", Timestamp: now},
+	}); err != nil {
+		t.Fatalf("BatchAppendExternalObservations for second tenant failed: %v", err)
+	}
+	if items, err := repo.QueryExternalObservationsByTenant("tenant_b", "zigbee2mqtt", "kitchen.temperature", now-1000, now+1000, 10); err != nil || len(items) != 1 {
+		t.Fatalf("identical observation from another tenant should be kept, got %+v err=%v", items, err)
+	}
+}
+
+func TestRepositoryExternalCommandClaimAndStatus(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "external_cmd.db")
+	repo := external.NewRepository(base.DB)
+
+	for _, entity := range []inter.ExternalEntity{
+		{TenantID: "tenant_a", Source: "zigbee2mqtt", EntityID: "plug.state", DeviceID: "plug", Domain: "switch"},
+		{TenantID: "tenant_a", Source: "zigbee2mqtt", EntityID: "lamp.state", DeviceID: "lamp", Domain: "switch"},
+	} {
+		if err := repo.UpsertExternalEntity(entity); err != nil {
+			t.Fatalf("UpsertExternalEntity failed: %v", err)
+		}
+	}
+	first, err := repo.CreateExternalCommand(inter.ExternalCommand{TenantID: "tenant_a", Source: "zigbee2mqtt", EntityID: "plug.state", Command: "turn_on", Payload: map[string]interface{}{"state": "ON"}})
+	if err != nil {
+		t.Fatalf("CreateExternalCommand failed: %v", err)
+	}
+	if first.ID <= 0 || first.Status != inter.ExternalCommandStatusPending {
+		t.Fatalf("unexpected created command: %+v", first)
+	}
+	if _, err := repo.CreateExternalCommand(inter.ExternalCommand{TenantID: "tenant_a", Source: "zigbee2mqtt", EntityID: "lamp.state", Command: "turn_off"}); err != nil {
+		t.Fatalf("CreateExternalCommand failed: %v", err)
+	}
+
+	// 其他租户即使知道 source/device_id 也领取不到命令。
+	if other, err := repo.ClaimPendingExternalCommands("tenant_b", "zigbee2mqtt", "plug", 10); err != nil || len(other) != 0 {
+		t.Fatalf("other tenant should not claim commands: %+v err=%v", other, err)
+	}
+	claimed, err := repo.ClaimPendingExternalCommands("tenant_a", "zigbee2mqtt", "plug", 10)
+	if err != nil {
+		t.Fatalf("ClaimPendingExternalCommands failed: %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != first.ID || claimed[0].Status != inter.ExternalCommandStatusPending || claimed[0].Payload["state"] != "ON" {
+		t.Fatalf("unexpected claimed commands: %+v", claimed)
+	}
+	again, err := repo.ClaimPendingExternalCommands("tenant_a", "zigbee2mqtt", "plug", 10)
+	if err != nil || len(again) != 0 {
+		t.Fatalf("claimed command should not be returned twice: %+v err=%v", again, err)
+	}
+
+	// 重新排队会释放租约，命令可以再次领取。
+	if err := repo.UpdateExternalCommandStatus("tenant_a", first.ID, inter.ExternalCommandStatusPending, ""); err != nil {
+		t.Fatalf("UpdateExternalCommandStatus failed: %v", err)
+	}
+	requeued, err := repo.ClaimPendingExternalCommands("tenant_a", "zigbee2mqtt", "plug", 10)
+	if err != nil || len(requeued) != 1 || requeued[0].ID != first.ID {
+		t.Fatalf("requeued command should be claimable: %+v err=%v", requeued, err)
+	}
+	if err := repo.UpdateExternalCommandStatus("tenant_a", first.ID, inter.ExternalCommandStatusSent, ""); err != nil {
+		t.Fatalf("UpdateExternalCommandStatus failed: %v", err)
+	}
+	if sent, err := repo.GetExternalCommand(first.ID); err != nil || sent.Status != inter.ExternalCommandStatusSent {
+		t.Fatalf("command should be sent after adapter receipt: %+v err=%v", sent, err)
+	}
+
+	if err := repo.UpdateExternalCommandStatus("tenant_a", first.ID, inter.ExternalCommandStatusAcked, ""); err != nil {
+		t.Fatalf("UpdateExternalCommandStatus failed: %v", err)
+	}
+	got, err := repo.GetExternalCommand(first.ID)
+	if err != nil {
+		t.Fatalf("GetExternalCommand failed: %v", err)
+	}
+	if got.Status != inter.ExternalCommandStatusAcked || got.ExecutedAt == nil {
+		t.Fatalf("unexpected acked command: %+v", got)
+	}
+	if err := repo.UpdateExternalCommandStatus("tenant_a", 9999, inter.ExternalCommandStatusFailed, "x"); !errors.Is(err, inter.ErrExternalCommandNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	// 已确认的命令不会被迟到的回执改写，其他租户的回执视为命令不存在。
+	for _, status := range []inter.ExternalCommandStatus{inter.ExternalCommandStatusPending, inter.ExternalCommandStatusFailed} {
+		if err := repo.UpdateExternalCommandStatus("tenant_a", first.ID, status, "late"); !errors.Is(err, inter.ErrExternalCommandFinished) {
+			t.Fatalf("expected finished for late %s receipt, got %v", status, err)
+		}
+	}
+	if err := repo.UpdateExternalCommandStatus("tenant_b", first.ID, inter.ExternalCommandStatusAcked, ""); !errors.Is(err, inter.ErrExternalCommandNotFound) {
+		t.Fatalf("expected not found for other tenant, got %v", err)
+	}
+	if got, err := repo.GetExternalCommand(first.ID); err != nil || got.Status != inter.ExternalCommandStatusAcked {
+		t.Fatalf("acked command should stay acked: %+v err=%v", got, err)
+	}
+
+	items, err := repo.ListExternalCommandsByTenant("tenant_b", "zigbee2mqtt", "plug.state", 10)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("other tenant should not see commands: %+v err=%v", items, err)
+	}
+}
@@ -0,0 +1,242 @@
+package group
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+// deviceCountExpr 只统计仍然存在的设备，设备删除后残留的成员关系不计入。
+const deviceCountExpr = "(SELECT COUNT(*) FROM group_devices AS gd JOIN devices AS d ON d.uuid = gd.device_uuid WHERE gd.group_id = device_group_row.id) AS device_count"
+
+type Repository struct {
+	db *bun.DB
+}
+
+func NewRepository(db *bun.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateDeviceGroup(group inter.DeviceGroup) (inter.DeviceGroup, error) {
+	name := strings.TrimSpace(group.Name)
+	if name == "" {
+		return inter.DeviceGroup{}, errors.New("group name is required")
+	}
+	tenantID := bunrepo.NormalizeTenantID(group.TenantID)
+	if err := r.ensureNameAvailable(tenantID, name, ""); err != nil {
+		return inter.DeviceGroup{}, err
+	}
+	id, err := newGroupID()
+	if err != nil {
+		return inter.DeviceGroup{}, err
+	}
+	now := time.Now().UTC()
+	row := &bunrepo.DeviceGroupRow{
+		ID:          id,
+		TenantID:    tenantID,
+		Name:        name,
+		Description: strings.TrimSpace(group.Description),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := r.db.NewInsert().
+		Model(row).
+		Returning("NULL").
+		Exec(context.Background()); err != nil {
+		return inter.DeviceGroup{}, err
+	}
+	return row.ToDeviceGroup(), nil
+}
+
+func (r *Repository) GetDeviceGroup(tenantID, groupID string) (inter.DeviceGroup, error) {
+	var row bunrepo.DeviceGroupRow
+	err := r.db.NewSelect().
+		Model(&row).
+		ColumnExpr("device_group_row.*").
+		ColumnExpr(deviceCountExpr).
+		Where("device_group_row.tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("device_group_row.id = ?", strings.TrimSpace(groupID)).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.DeviceGroup{}, inter.ErrDeviceGroupNotFound
+		}
+		return inter.DeviceGroup{}, err
+	}
+	return row.ToDeviceGroup(), nil
+}
+
+func (r *Repository) ListDeviceGroups(tenantID string, page, size int) ([]inter.DeviceGroup, int, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 100
+	}
+	tenantID = bunrepo.NormalizeTenantID(tenantID)
+	total, err := r.db.NewSelect().
+		Model((*bunrepo.DeviceGroupRow)(nil)).
+		Where("tenant_id = ?", tenantID).
+		Count(context.Background())
+	if err != nil {
+		return nil, 0, err
+	}
+	var rows []bunrepo.DeviceGroupRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		ColumnExpr("device_group_row.*").
+		ColumnExpr(deviceCountExpr).
+		Where("device_group_row.tenant_id = ?", tenantID).
+		OrderExpr("device_group_row.name ASC, device_group_row.id ASC").
+		Limit(size).
+		Offset((page - 1) * size).
+		Scan(context.Background()); err != nil {
+		return nil, 0, err
+	}
+	out := make([]inter.DeviceGroup, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToDeviceGroup())
+	}
+	return out, total, nil
+}
+
+func (r *Repository) UpdateDeviceGroup(group inter.DeviceGroup) (inter.DeviceGroup, error) {
+	name := strings.TrimSpace(group.Name)
+	if name == "" {
+		return inter.DeviceGroup{}, errors.New("group name is required")
+	}
+	tenantID := bunrepo.NormalizeTenantID(group.TenantID)
+	if err := r.ensureNameAvailable(tenantID, name, group.ID); err != nil {
+		return inter.DeviceGroup{}, err
+	}
+	res, err := r.db.NewUpdate().
+		Model((*bunrepo.DeviceGroupRow)(nil)).
+		Set("name = ?", name).
+		Set("description = ?", strings.TrimSpace(group.Description)).
+		Set("updated_at = ?", time.Now().UTC()).
+		Where("tenant_id = ?", tenantID).
+		Where("id = ?", group.ID).
+		Returning("NULL").
+		Exec(context.Background())
+	if err := expectAffected(res, err, inter.ErrDeviceGroupNotFound); err != nil {
+		return inter.DeviceGroup{}, err
+	}
+	return r.GetDeviceGroup(tenantID, group.ID)
+}
+
+func (r *Repository) DeleteDeviceGroup(tenantID, groupID string) error {
+	return r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().
+			Model((*bunrepo.DeviceGroupRow)(nil)).
+			Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+			Where("id = ?", groupID).
+			Returning("NULL").
+			Exec(ctx)
+		if err := expectAffected(res, err, inter.ErrDeviceGroupNotFound); err != nil {
+			return err
+		}
+		if _, err := tx.NewRaw("DELETE FROM group_devices WHERE group_id = ?", groupID).Exec(ctx); err != nil {
+			return err
+		}
+		_, err = tx.NewRaw("DELETE FROM group_users WHERE group_id = ?", groupID).Exec(ctx)
+		return err
+	})
+}
+
+func (r *Repository) AddGroupDevice(groupID, uuid string) error {
+	res, err := r.db.NewInsert().
+		Model(&bunrepo.GroupDeviceRow{
+			GroupID:    groupID,
+			DeviceUUID: strings.TrimSpace(uuid),
+			CreatedAt:  time.Now().UTC(),
+		}).
+		On("CONFLICT (group_id, device_uuid) DO NOTHING").
+		Returning("NULL").
+		Exec(context.Background())
+	return expectAffected(res, err, inter.ErrGroupDeviceExists)
+}
+
+func (r *Repository) RemoveGroupDevice(groupID, uuid string) error {
+	res, err := r.db.NewDelete().
+		Model((*bunrepo.GroupDeviceRow)(nil)).
+		Where("group_id = ?", groupID).
+		Where("device_uuid = ?", strings.TrimSpace(uuid)).
+		Returning("NULL").
+		Exec(context.Background())
+	return expectAffected(res, err, inter.ErrGroupDeviceNotFound)
+}
+
+func (r *Repository) ListGroupDevices(groupID string, page, size int) ([]inter.DeviceRecord, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = 100
+	}
+	var rows []bunrepo.DeviceModel
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Join("JOIN group_devices AS gd ON gd.device_uuid = device_model.uuid").
+		Where("gd.group_id = ?", groupID).
+		OrderExpr("gd.created_at ASC, device_model.uuid ASC").
+		Limit(size).
+		Offset((page - 1) * size).
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	out := make([]inter.DeviceRecord, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToRecord())
+	}
+	return out, nil
+}
+
+// ensureNameAvailable 检查租户内是否已有同名分组，exceptID 用于更新时排除分组自身。
+func (r *Repository) ensureNameAvailable(tenantID, name, exceptID string) error {
+	q := r.db.NewSelect().
+		Model((*bunrepo.DeviceGroupRow)(nil)).
+		Where("tenant_id = ?", tenantID).
+		Where("name = ?", name)
+	if exceptID != "" {
+		q = q.Where("id <> ?", exceptID)
+	}
+	exists, err := q.Exists(context.Background())
+	if err != nil {
+		return err
+	}
+	if exists {
+		return inter.ErrDeviceGroupExists
+	}
+	return nil
+}
+
+func expectAffected(res sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func newGroupID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return "grp_" + hex.EncodeToString(b[:]), nil
+}
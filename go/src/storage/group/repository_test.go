@@ -0,0 +1,91 @@
+package group_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/device"
+	"github.com/nhirsama/Goster-IoT/src/storage/group"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+)
+
+func TestRepositoryDeviceGroupCRUDAndMembership(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "group_repo.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := group.NewRepository(base.DB)
+
+	for _, uuid := range []string{"group-dev-a", "group-dev-b"} {
+		if err := deviceRepo.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid}); err != nil {
+			t.Fatalf("InitDevice failed: %v", err)
+		}
+	}
+
+	created, err := repo.CreateDeviceGroup(inter.DeviceGroup{Name: " floor-1 ", Description: "first floor"})
+	if err != nil {
+		t.Fatalf("CreateDeviceGroup failed: %v", err)
+	}
+	if created.ID == "" || created.Name != "floor-1" || created.TenantID != inter.DefaultTenantID {
+		t.Fatalf("unexpected created group: %+v", created)
+	}
+	if _, err := repo.CreateDeviceGroup(inter.DeviceGroup{Name: "floor-1"}); !errors.Is(err, inter.ErrDeviceGroupExists) {
+		t.Fatalf("expected duplicate name error, got %v", err)
+	}
+	if _, err := repo.GetDeviceGroup("tenant_other", created.ID); !errors.Is(err, inter.ErrDeviceGroupNotFound) {
+		t.Fatalf("expected not found for other tenant, got %v", err)
+	}
+
+	for _, uuid := range []string{"group-dev-a", "group-dev-b"} {
+		if err := repo.AddGroupDevice(created.ID, uuid); err != nil {
+			t.Fatalf("AddGroupDevice(%s) failed: %v", uuid, err)
+		}
+	}
+	if err := repo.AddGroupDevice(created.ID, "group-dev-a"); !errors.Is(err, inter.ErrGroupDeviceExists) {
+		t.Fatalf("expected duplicate member error, got %v", err)
+	}
+	devices, err := repo.ListGroupDevices(created.ID, 1, 10)
+	if err != nil || len(devices) != 2 || devices[0].UUID != "group-dev-a" || devices[0].Meta.Name != "group-dev-a" {
+		t.Fatalf("unexpected group devices: %+v err=%v", devices, err)
+	}
+
+	// 设备删除后不再计入分组设备数。
+	if err := deviceRepo.DestroyDevice("group-dev-b"); err != nil {
+		t.Fatalf("DestroyDevice failed: %v", err)
+	}
+	got, err := repo.GetDeviceGroup(inter.DefaultTenantID, created.ID)
+	if err != nil || got.DeviceCount != 1 {
+		t.Fatalf("expected one remaining member, got %+v err=%v", got, err)
+	}
+
+	if _, err := repo.CreateDeviceGroup(inter.DeviceGroup{Name: "floor-2"}); err != nil {
+		t.Fatalf("CreateDeviceGroup failed: %v", err)
+	}
+	got.Name = "floor-2"
+	if _, err := repo.UpdateDeviceGroup(got); !errors.Is(err, inter.ErrDeviceGroupExists) {
+		t.Fatalf("expected rename conflict, got %v", err)
+	}
+	got.Name = "ground floor"
+	got.Description = ""
+	updated, err := repo.UpdateDeviceGroup(got)
+	if err != nil || updated.Name != "ground floor" || updated.Description != "" || updated.DeviceCount != 1 {
+		t.Fatalf("unexpected updated group: %+v err=%v", updated, err)
+	}
+
+	groups, total, err := repo.ListDeviceGroups(inter.DefaultTenantID, 1, 1)
+	if err != nil || total != 2 || len(groups) != 1 || groups[0].Name != "floor-2" {
+		t.Fatalf("unexpected group page: %+v total=%d err=%v", groups, total, err)
+	}
+
+	if err := repo.RemoveGroupDevice(created.ID, "group-dev-a"); err != nil {
+		t.Fatalf("RemoveGroupDevice failed: %v", err)
+	}
+	if err := repo.RemoveGroupDevice(created.ID, "group-dev-a"); !errors.Is(err, inter.ErrGroupDeviceNotFound) {
+		t.Fatalf("expected missing member error, got %v", err)
+	}
+	if err := repo.DeleteDeviceGroup(inter.DefaultTenantID, created.ID); err != nil {
+		t.Fatalf("DeleteDeviceGroup failed: %v", err)
+	}
+	if err := repo.DeleteDeviceGroup(inter.DefaultTenantID, created.ID); !errors.Is(err, inter.ErrDeviceGroupNotFound) {
+		t.Fatalf("expected deleted group to be missing, got %v", err)
+	}
+}
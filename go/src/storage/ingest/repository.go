@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+type Repository struct {
+	db *bun.DB
+}
+
+func NewRepository(db *bun.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// ReserveIngestDedupe 用一条 upsert 完成占用：新键直接插入，已过期的旧记录被覆盖，未过期的记录保持不变。
+func (r *Repository) ReserveIngestDedupe(record inter.IngestDedupeRecord) (inter.IngestDedupeRecord, bool, error) {
+	if strings.TrimSpace(record.Key) == "" {
+		return inter.IngestDedupeRecord{}, false, errors.New("dedupe key is required")
+	}
+	row := bunrepo.NewIngestDedupeRow(record)
+	row.Success = false
+	row.ErrorCode = nil
+	row.ErrorMessage = nil
+	row.CompletedAt = 0
+
+	ctx := context.Background()
+	res, err := r.db.NewInsert().
+		Model(row).
+		On("CONFLICT (tenant_id, dedupe_key) DO UPDATE").
+		Set("event_id = EXCLUDED.event_id").
+		Set("uuid = EXCLUDED.uuid").
+		Set("success = EXCLUDED.success").
+		Set("error_code = NULL").
+		Set("error_message = NULL").
+		Set("created_at = EXCLUDED.created_at").
+		Set("completed_at = 0").
+		Set("expires_at = EXCLUDED.expires_at").
+		Where("?TableAlias.expires_at < ?", row.CreatedAt).
+		Returning("NULL").
+		Exec(ctx)
+	if err != nil {
+		return inter.IngestDedupeRecord{}, false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return inter.IngestDedupeRecord{}, false, err
+	}
+	if affected > 0 {
+		return row.ToIngestDedupeRecord(), true, nil
+	}
+
+	var existing bunrepo.IngestDedupeRow
+	if err := r.db.NewSelect().
+		Model(&existing).
+		Where("tenant_id = ?", row.TenantID).
+		Where("dedupe_key = ?", row.DedupeKey).
+		Limit(1).
+		Scan(ctx); err != nil {
+		return inter.IngestDedupeRecord{}, false, err
+	}
+	return existing.ToIngestDedupeRecord(), false, nil
+}
+
+func (r *Repository) CompleteIngestDedupe(record inter.IngestDedupeRecord) error {
+	row := bunrepo.NewIngestDedupeRow(record)
+	_, err := r.db.NewUpdate().
+		Model(row).
+		Column("uuid", "success", "error_code", "error_message", "completed_at", "expires_at").
+		WherePK().
+		Exec(context.Background())
+	return err
+}
+
+func (r *Repository) ReleaseIngestDedupe(tenantID, key string) error {
+	_, err := r.db.NewDelete().
+		Model((*bunrepo.IngestDedupeRow)(nil)).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("dedupe_key = ?", strings.TrimSpace(key)).
+		Exec(context.Background())
+	return err
+}
+
+// DeleteExpiredIngestDedupe 每次最多删除 limit 条，避免一次清理长时间占用写锁。
+func (r *Repository) DeleteExpiredIngestDedupe(before int64, limit int) (int64, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	expired := r.db.NewSelect().
+		Model((*bunrepo.IngestDedupeRow)(nil)).
+		Column("tenant_id", "dedupe_key").
+		Where("expires_at < ?", before).
+		OrderExpr("expires_at ASC").
+		Limit(limit)
+	res, err := r.db.NewDelete().
+		Model((*bunrepo.IngestDedupeRow)(nil)).
+		Where("(tenant_id, dedupe_key) IN (?)", expired).
+		Exec(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,108 @@
+package ingest_test
+
+import (
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/ingest"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+)
+
+func TestRepositoryIngestDedupeLifecycle(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "ingest_dedupe.db")
+	repo := ingest.NewRepository(base.DB)
+
+	record := inter.IngestDedupeRecord{TenantID: "tenant_a", Key: "event:e1", EventID: "e1", UUID: "dev-1", CreatedAt: 100, ExpiresAt: 1000}
+	reserved, ok, err := repo.ReserveIngestDedupe(record)
+	if err != nil || !ok {
+		t.Fatalf("first reserve should succeed: ok=%v err=%v", ok, err)
+	}
+	reserved.Success = true
+	reserved.CompletedAt = 120
+	if err := repo.CompleteIngestDedupe(reserved); err != nil {
+		t.Fatalf("CompleteIngestDedupe failed: %v", err)
+	}
+
+	retry := record
+	retry.EventID = "e1-retry"
+	retry.CreatedAt = 200
+	existing, ok, err := repo.ReserveIngestDedupe(retry)
+	if err != nil || ok {
+		t.Fatalf("duplicate reserve should return existing record: ok=%v err=%v", ok, err)
+	}
+	if existing.EventID != "e1" || !existing.Success || existing.CompletedAt != 120 || existing.UUID != "dev-1" {
+		t.Fatalf("unexpected existing record: %+v", existing)
+	}
+
+	other := record
+	other.TenantID = "tenant_b"
+	if _, ok, err := repo.ReserveIngestDedupe(other); err != nil || !ok {
+		t.Fatalf("same key in another tenant should reserve: ok=%v err=%v", ok, err)
+	}
+
+	if err := repo.ReleaseIngestDedupe("tenant_b", "event:e1"); err != nil {
+		t.Fatalf("ReleaseIngestDedupe failed: %v", err)
+	}
+	if _, ok, err := repo.ReserveIngestDedupe(other); err != nil || !ok {
+		t.Fatalf("released key should be reservable again: ok=%v err=%v", ok, err)
+	}
+
+	expiredRetry := record
+	expiredRetry.EventID = "e1-late"
+	expiredRetry.CreatedAt = 2000
+	expiredRetry.ExpiresAt = 3000
+	renewed, ok, err := repo.ReserveIngestDedupe(expiredRetry)
+	if err != nil || !ok {
+		t.Fatalf("expired record should be replaced: ok=%v err=%v", ok, err)
+	}
+	if renewed.EventID != "e1-late" || renewed.Success || renewed.CompletedAt != 0 {
+		t.Fatalf("unexpected renewed record: %+v", renewed)
+	}
+
+	deleted, err := repo.DeleteExpiredIngestDedupe(2500, 10)
+	if err != nil {
+		t.Fatalf("DeleteExpiredIngestDedupe failed: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("expected only tenant_b record to expire, deleted=%d", deleted)
+	}
+	if _, ok, err := repo.ReserveIngestDedupe(expiredRetry); err != nil || ok {
+		t.Fatalf("tenant_a record should remain: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestRepositoryIngestDedupeLeaseTakeover(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "ingest_dedupe_lease.db")
+	repo := ingest.NewRepository(base.DB)
+
+	// 处理中的占用只有短租约，处理方崩溃后重试可以接管。
+	record := inter.IngestDedupeRecord{TenantID: "tenant_a", Key: "event:e1", EventID: "e1", CreatedAt: 100, ExpiresAt: 130}
+	if _, ok, err := repo.ReserveIngestDedupe(record); err != nil || !ok {
+		t.Fatalf("first reserve should succeed: ok=%v err=%v", ok, err)
+	}
+	inLease := record
+	inLease.CreatedAt = 120
+	if existing, ok, err := repo.ReserveIngestDedupe(inLease); err != nil || ok || existing.CompletedAt != 0 {
+		t.Fatalf("reserve within lease should see in-progress record: %+v ok=%v err=%v", existing, ok, err)
+	}
+	takeover := record
+	takeover.EventID = "e1-retry"
+	takeover.CreatedAt = 140
+	takeover.ExpiresAt = 170
+	reserved, ok, err := repo.ReserveIngestDedupe(takeover)
+	if err != nil || !ok || reserved.EventID != "e1-retry" {
+		t.Fatalf("reserve after lease should take over: %+v ok=%v err=%v", reserved, ok, err)
+	}
+
+	reserved.Success = true
+	reserved.CompletedAt = 150
+	reserved.ExpiresAt = 10000
+	if err := repo.CompleteIngestDedupe(reserved); err != nil {
+		t.Fatalf("CompleteIngestDedupe failed: %v", err)
+	}
+	late := record
+	late.CreatedAt = 5000
+	if existing, ok, err := repo.ReserveIngestDedupe(late); err != nil || ok || !existing.Success {
+		t.Fatalf("completed record should keep full dedupe window: %+v ok=%v err=%v", existing, ok, err)
+	}
+}
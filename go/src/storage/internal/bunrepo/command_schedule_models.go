@@ -0,0 +1,106 @@
+package bunrepo
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type CommandScheduleRow struct {
+	bun.BaseModel `bun:"table:command_schedules"`
+
+	ID          int64      `bun:"id,pk,autoincrement"`
+	TenantID    string     `bun:"tenant_id"`
+	Name        string     `bun:"name"`
+	UUID        *string    `bun:"uuid"`
+	Command     string     `bun:"command"`
+	CmdID       int        `bun:"cmd_id"`
+	PayloadJSON *string    `bun:"payload_json"`
+	CommandKey  string     `bun:"command_key"`
+	Supersede   bool       `bun:"supersede"`
+	TTLMs       int64      `bun:"ttl_ms"`
+	TimeoutMs   int64      `bun:"timeout_ms"`
+	MaxAttempts int        `bun:"max_attempts"`
+	ExecuteAt   *time.Time `bun:"execute_at"`
+	CronExpr    string     `bun:"cron_expr"`
+	Timezone    string     `bun:"timezone"`
+	Enabled     bool       `bun:"enabled"`
+	NextRunAt   *time.Time `bun:"next_run_at"`
+	LastRunAt   *time.Time `bun:"last_run_at"`
+	LastError   *string    `bun:"last_error"`
+	RunCount    int64      `bun:"run_count"`
+	Revision    int64      `bun:"revision"`
+	CreatedAt   time.Time  `bun:"created_at"`
+	UpdatedAt   time.Time  `bun:"updated_at"`
+}
+
+func NewCommandScheduleRow(schedule inter.CommandSchedule) *CommandScheduleRow {
+	return &CommandScheduleRow{
+		ID:          schedule.ID,
+		TenantID:    NormalizeTenantID(schedule.TenantID),
+		Name:        strings.TrimSpace(schedule.Name),
+		UUID:        NullableOptionalString(schedule.UUID),
+		Command:     strings.TrimSpace(strings.ToLower(schedule.Command)),
+		CmdID:       int(schedule.CmdID),
+		PayloadJSON: PayloadStringPtr(schedule.Payload),
+		CommandKey:  strings.TrimSpace(schedule.Policy.Key),
+		Supersede:   schedule.Policy.Supersede,
+		TTLMs:       schedule.Policy.TTL.Milliseconds(),
+		TimeoutMs:   schedule.Policy.Timeout.Milliseconds(),
+		MaxAttempts: schedule.Policy.MaxAttempts,
+		ExecuteAt:   utcTimePtr(schedule.ExecuteAt),
+		CronExpr:    strings.TrimSpace(schedule.Cron),
+		Timezone:    strings.TrimSpace(schedule.Timezone),
+		Enabled:     schedule.Enabled,
+		NextRunAt:   utcTimePtr(schedule.NextRunAt),
+		CreatedAt:   schedule.CreatedAt.UTC(),
+		UpdatedAt:   schedule.UpdatedAt.UTC(),
+	}
+}
+
+func (r CommandScheduleRow) ToCommandSchedule() inter.CommandSchedule {
+	schedule := inter.CommandSchedule{
+		ID:       r.ID,
+		TenantID: r.TenantID,
+		Name:     r.Name,
+		Command:  r.Command,
+		CmdID:    inter.CmdID(r.CmdID),
+		Policy: inter.DeviceCommandPolicy{
+			TTL:         time.Duration(r.TTLMs) * time.Millisecond,
+			Timeout:     time.Duration(r.TimeoutMs) * time.Millisecond,
+			MaxAttempts: r.MaxAttempts,
+			Key:         r.CommandKey,
+			Supersede:   r.Supersede,
+		},
+		ExecuteAt: r.ExecuteAt,
+		Cron:      r.CronExpr,
+		Timezone:  r.Timezone,
+		Enabled:   r.Enabled,
+		NextRunAt: r.NextRunAt,
+		LastRunAt: r.LastRunAt,
+		RunCount:  r.RunCount,
+		Revision:  r.Revision,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+	if r.UUID != nil {
+		schedule.UUID = *r.UUID
+	}
+	if r.PayloadJSON != nil {
+		schedule.Payload = []byte(*r.PayloadJSON)
+	}
+	if r.LastError != nil {
+		schedule.LastError = *r.LastError
+	}
+	return schedule
+}
+
+func utcTimePtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
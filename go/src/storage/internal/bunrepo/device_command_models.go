@@ -3,20 +3,66 @@ package bunrepo
 import (
 	"time"
 
+	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/uptrace/bun"
 )
 
 type DeviceCommandRow struct {
 	bun.BaseModel `bun:"table:device_commands"`
 
-	ID          int64      `bun:"id,pk,autoincrement"`
-	TenantID    string     `bun:"tenant_id"`
-	UUID        string     `bun:"uuid"`
-	CmdID       int        `bun:"cmd_id"`
-	Command     string     `bun:"command"`
-	PayloadJSON *string    `bun:"payload_json"`
-	Status      string     `bun:"status"`
-	ErrorText   *string    `bun:"error_text"`
-	RequestedAt time.Time  `bun:"requested_at"`
-	ExecutedAt  *time.Time `bun:"executed_at"`
+	ID            int64      `bun:"id,pk,autoincrement"`
+	TenantID      string     `bun:"tenant_id"`
+	UUID          string     `bun:"uuid"`
+	CmdID         int        `bun:"cmd_id"`
+	Command       string     `bun:"command"`
+	CommandKey    string     `bun:"command_key"`
+	PayloadJSON   *string    `bun:"payload_json"`
+	Status        string     `bun:"status"`
+	ErrorText     *string    `bun:"error_text"`
+	Attempts      int        `bun:"attempts"`
+	MaxAttempts   int        `bun:"max_attempts"`
+	TimeoutMs     int64      `bun:"timeout_ms"`
+	RequestedAt   time.Time  `bun:"requested_at"`
+	ExpiresAt     *time.Time `bun:"expires_at"`
+	SentAt        *time.Time `bun:"sent_at"`
+	AckDeadlineAt *time.Time `bun:"ack_deadline_at"`
+	ExecutedAt    *time.Time `bun:"executed_at"`
+	QueueOrder    int64      `bun:"queue_order"`
+	ClaimedAt     *time.Time `bun:"claimed_at"`
+
+	DeliveredInstance *string `bun:"delivered_instance"`
+	DeliveredAdapter  *string `bun:"delivered_adapter"`
+}
+
+func (r DeviceCommandRow) ToDeviceCommand() inter.DeviceCommand {
+	cmd := inter.DeviceCommand{
+		ID:            r.ID,
+		TenantID:      r.TenantID,
+		UUID:          r.UUID,
+		CmdID:         inter.CmdID(r.CmdID),
+		Command:       r.Command,
+		Key:           r.CommandKey,
+		Status:        inter.DeviceCommandStatus(r.Status),
+		Attempts:      r.Attempts,
+		MaxAttempts:   r.MaxAttempts,
+		TimeoutMs:     r.TimeoutMs,
+		RequestedAt:   r.RequestedAt,
+		ExpiresAt:     r.ExpiresAt,
+		SentAt:        r.SentAt,
+		AckDeadlineAt: r.AckDeadlineAt,
+		ExecutedAt:    r.ExecutedAt,
+	}
+	if r.PayloadJSON != nil {
+		cmd.Payload = []byte(*r.PayloadJSON)
+	}
+	if r.ErrorText != nil {
+		cmd.ErrorText = *r.ErrorText
+	}
+	if r.DeliveredInstance != nil {
+		cmd.DeliveredBy.InstanceID = *r.DeliveredInstance
+	}
+	if r.DeliveredAdapter != nil {
+		cmd.DeliveredBy.AdapterID = *r.DeliveredAdapter
+	}
+	return cmd
 }
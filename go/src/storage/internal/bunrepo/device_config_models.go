@@ -0,0 +1,138 @@
+package bunrepo
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type ConfigDocumentRow struct {
+	bun.BaseModel `bun:"table:config_documents"`
+
+	ID             int64     `bun:"id,pk,autoincrement"`
+	TenantID       string    `bun:"tenant_id"`
+	ScopeType      string    `bun:"scope_type"`
+	ScopeID        string    `bun:"scope_id"`
+	Version        int64     `bun:"version"`
+	ContentJSON    string    `bun:"content_json"`
+	Comment        string    `bun:"comment"`
+	RolledBackFrom int64     `bun:"rolled_back_from"`
+	CreatedBy      string    `bun:"created_by"`
+	CreatedAt      time.Time `bun:"created_at"`
+}
+
+func NewConfigDocumentRow(doc inter.ConfigDocument) *ConfigDocumentRow {
+	return &ConfigDocumentRow{
+		TenantID:       NormalizeTenantID(doc.TenantID),
+		ScopeType:      string(doc.ScopeType),
+		ScopeID:        strings.TrimSpace(doc.ScopeID),
+		Version:        doc.Version,
+		ContentJSON:    marshalOr(doc.Content, "{}"),
+		Comment:        strings.TrimSpace(doc.Comment),
+		RolledBackFrom: doc.RolledBackFrom,
+		CreatedBy:      strings.TrimSpace(doc.CreatedBy),
+		CreatedAt:      doc.CreatedAt.UTC(),
+	}
+}
+
+func (r ConfigDocumentRow) ToConfigDocument() inter.ConfigDocument {
+	doc := inter.ConfigDocument{
+		ID:             r.ID,
+		TenantID:       r.TenantID,
+		ScopeType:      inter.ConfigScopeType(r.ScopeType),
+		ScopeID:        r.ScopeID,
+		Version:        r.Version,
+		Content:        map[string]interface{}{},
+		Comment:        r.Comment,
+		RolledBackFrom: r.RolledBackFrom,
+		CreatedBy:      r.CreatedBy,
+		CreatedAt:      r.CreatedAt,
+	}
+	_ = json.Unmarshal([]byte(r.ContentJSON), &doc.Content)
+	return doc
+}
+
+type DeviceConfigStateRow struct {
+	bun.BaseModel `bun:"table:device_config_states"`
+
+	UUID           string     `bun:"uuid,pk"`
+	TenantID       string     `bun:"tenant_id"`
+	CurrentVersion string     `bun:"current_version"`
+	PushedVersion  string     `bun:"pushed_version"`
+	CommandID      int64      `bun:"command_id"`
+	PushedAt       *time.Time `bun:"pushed_at"`
+	AckedVersion   string     `bun:"acked_version"`
+	AckedAt        *time.Time `bun:"acked_at"`
+	UpdatedAt      time.Time  `bun:"updated_at"`
+}
+
+func NewDeviceConfigStateRow(state inter.DeviceConfigState) *DeviceConfigStateRow {
+	return &DeviceConfigStateRow{
+		UUID:           strings.TrimSpace(state.UUID),
+		TenantID:       NormalizeTenantID(state.TenantID),
+		CurrentVersion: state.CurrentVersion,
+		PushedVersion:  state.PushedVersion,
+		CommandID:      state.CommandID,
+		PushedAt:       utcTimePtr(state.PushedAt),
+		AckedVersion:   state.AckedVersion,
+		AckedAt:        utcTimePtr(state.AckedAt),
+		UpdatedAt:      state.UpdatedAt.UTC(),
+	}
+}
+
+func (r DeviceConfigStateRow) ToDeviceConfigState() inter.DeviceConfigState {
+	return inter.DeviceConfigState{
+		UUID:           r.UUID,
+		TenantID:       r.TenantID,
+		CurrentVersion: r.CurrentVersion,
+		PushedVersion:  r.PushedVersion,
+		CommandID:      r.CommandID,
+		PushedAt:       r.PushedAt,
+		AckedVersion:   r.AckedVersion,
+		AckedAt:        r.AckedAt,
+		UpdatedAt:      r.UpdatedAt,
+	}
+}
+
+type DeviceConfigAckRow struct {
+	bun.BaseModel `bun:"table:device_config_acks"`
+
+	ID            int64     `bun:"id,pk,autoincrement"`
+	TenantID      string    `bun:"tenant_id"`
+	UUID          string    `bun:"uuid"`
+	ConfigVersion string    `bun:"config_version"`
+	SourcesJSON   string    `bun:"sources_json"`
+	Source        string    `bun:"source"`
+	CommandID     int64     `bun:"command_id"`
+	AckedAt       time.Time `bun:"acked_at"`
+}
+
+func NewDeviceConfigAckRow(ack inter.DeviceConfigAck) *DeviceConfigAckRow {
+	return &DeviceConfigAckRow{
+		TenantID:      NormalizeTenantID(ack.TenantID),
+		UUID:          strings.TrimSpace(ack.UUID),
+		ConfigVersion: ack.ConfigVersion,
+		SourcesJSON:   marshalOr(ack.Sources, "[]"),
+		Source:        string(ack.Source),
+		CommandID:     ack.CommandID,
+		AckedAt:       ack.AckedAt.UTC(),
+	}
+}
+
+func (r DeviceConfigAckRow) ToDeviceConfigAck() inter.DeviceConfigAck {
+	ack := inter.DeviceConfigAck{
+		ID:            r.ID,
+		TenantID:      r.TenantID,
+		UUID:          r.UUID,
+		ConfigVersion: r.ConfigVersion,
+		Sources:       []inter.ConfigSource{},
+		Source:        inter.DeviceConfigAckSource(r.Source),
+		CommandID:     r.CommandID,
+		AckedAt:       r.AckedAt,
+	}
+	_ = json.Unmarshal([]byte(r.SourcesJSON), &ack.Sources)
+	return ack
+}
@@ -0,0 +1,39 @@
+package bunrepo
+
+import (
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type DeviceConnectivityRow struct {
+	bun.BaseModel `bun:"table:device_connectivity_events"`
+
+	ID       int64  `bun:"id,pk,autoincrement"`
+	TenantID string `bun:"tenant_id"`
+	UUID     string `bun:"uuid"`
+	Status   string `bun:"status"`
+	Reason   string `bun:"reason"`
+	TS       int64  `bun:"ts"`
+}
+
+func NewDeviceConnectivityRow(tenantID string, event inter.DeviceConnectivityEvent) *DeviceConnectivityRow {
+	return &DeviceConnectivityRow{
+		TenantID: NormalizeTenantID(tenantID),
+		UUID:     strings.TrimSpace(event.UUID),
+		Status:   string(event.Status),
+		Reason:   strings.TrimSpace(event.Reason),
+		TS:       event.Timestamp,
+	}
+}
+
+func (r DeviceConnectivityRow) ToDeviceConnectivityEvent() inter.DeviceConnectivityEvent {
+	return inter.DeviceConnectivityEvent{
+		ID:        r.ID,
+		UUID:      r.UUID,
+		Status:    inter.ConnectivityStatus(r.Status),
+		Reason:    r.Reason,
+		Timestamp: r.TS,
+	}
+}
@@ -0,0 +1,74 @@
+package bunrepo
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type DeviceDiagnosticsRow struct {
+	bun.BaseModel `bun:"table:device_diagnostics"`
+
+	UUID       string `bun:"uuid,pk"`
+	TenantID   string `bun:"tenant_id"`
+	StateJSON  string `bun:"state_json"`
+	ObservedAt int64  `bun:"observed_at"`
+	ReceivedAt int64  `bun:"received_at"`
+	SampledAt  int64  `bun:"sampled_at"`
+}
+
+type DeviceDiagnosticsHistoryRow struct {
+	bun.BaseModel `bun:"table:device_diagnostics_history"`
+
+	ID         int64  `bun:"id,pk,autoincrement"`
+	TenantID   string `bun:"tenant_id"`
+	UUID       string `bun:"uuid"`
+	StateJSON  string `bun:"state_json"`
+	ObservedAt int64  `bun:"observed_at"`
+}
+
+func NewDeviceDiagnosticsRow(tenantID string, diagnostics inter.DeviceDiagnostics) *DeviceDiagnosticsRow {
+	return &DeviceDiagnosticsRow{
+		UUID:       strings.TrimSpace(diagnostics.UUID),
+		TenantID:   NormalizeTenantID(tenantID),
+		StateJSON:  marshalOr(diagnostics.State, "{}"),
+		ObservedAt: diagnostics.ObservedAt,
+		ReceivedAt: diagnostics.ReceivedAt,
+		SampledAt:  diagnostics.SampledAt,
+	}
+}
+
+func (r DeviceDiagnosticsRow) ToDeviceDiagnostics() inter.DeviceDiagnostics {
+	return inter.DeviceDiagnostics{
+		UUID:       r.UUID,
+		State:      unmarshalState(r.StateJSON),
+		ObservedAt: r.ObservedAt,
+		ReceivedAt: r.ReceivedAt,
+		SampledAt:  r.SampledAt,
+	}
+}
+
+func (r DeviceDiagnosticsRow) HistoryRow() *DeviceDiagnosticsHistoryRow {
+	return &DeviceDiagnosticsHistoryRow{
+		TenantID:   r.TenantID,
+		UUID:       r.UUID,
+		StateJSON:  r.StateJSON,
+		ObservedAt: r.ObservedAt,
+	}
+}
+
+func (r DeviceDiagnosticsHistoryRow) ToDeviceDiagnostics() inter.DeviceDiagnostics {
+	return inter.DeviceDiagnostics{
+		UUID:       r.UUID,
+		State:      unmarshalState(r.StateJSON),
+		ObservedAt: r.ObservedAt,
+	}
+}
+
+func unmarshalState(raw string) map[string]interface{} {
+	out := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(raw), &out)
+	return out
+}
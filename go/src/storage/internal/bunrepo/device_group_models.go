@@ -0,0 +1,138 @@
+package bunrepo
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type DeviceGroupRow struct {
+	bun.BaseModel `bun:"table:device_groups"`
+
+	ID          string    `bun:"id,pk"`
+	TenantID    string    `bun:"tenant_id"`
+	Name        string    `bun:"name"`
+	Description string    `bun:"description"`
+	DeviceCount int       `bun:"device_count,scanonly"`
+	CreatedAt   time.Time `bun:"created_at"`
+	UpdatedAt   time.Time `bun:"updated_at"`
+}
+
+func (r DeviceGroupRow) ToDeviceGroup() inter.DeviceGroup {
+	return inter.DeviceGroup{
+		ID:          r.ID,
+		TenantID:    r.TenantID,
+		Name:        r.Name,
+		Description: r.Description,
+		DeviceCount: r.DeviceCount,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+}
+
+type GroupDeviceRow struct {
+	bun.BaseModel `bun:"table:group_devices"`
+
+	GroupID    string    `bun:"group_id,pk"`
+	DeviceUUID string    `bun:"device_uuid,pk"`
+	CreatedAt  time.Time `bun:"created_at"`
+}
+
+type CommandBatchRow struct {
+	bun.BaseModel `bun:"table:command_batches"`
+
+	ID          int64     `bun:"id,pk,autoincrement"`
+	TenantID    string    `bun:"tenant_id"`
+	GroupID     string    `bun:"group_id"`
+	LabelsJSON  *string   `bun:"labels_json"`
+	Command     string    `bun:"command"`
+	CmdID       int       `bun:"cmd_id"`
+	PayloadJSON *string   `bun:"payload_json"`
+	CommandKey  string    `bun:"command_key"`
+	Supersede   bool      `bun:"supersede"`
+	TTLMs       int64     `bun:"ttl_ms"`
+	TimeoutMs   int64     `bun:"timeout_ms"`
+	MaxAttempts int       `bun:"max_attempts"`
+	Total       int       `bun:"total"`
+	CreatedBy   string    `bun:"created_by"`
+	CreatedAt   time.Time `bun:"created_at"`
+}
+
+func NewCommandBatchRow(batch inter.CommandBatch) *CommandBatchRow {
+	row := &CommandBatchRow{
+		TenantID:    NormalizeTenantID(batch.TenantID),
+		GroupID:     strings.TrimSpace(batch.GroupID),
+		Command:     strings.TrimSpace(strings.ToLower(batch.Command)),
+		CmdID:       int(batch.CmdID),
+		PayloadJSON: PayloadStringPtr(batch.Payload),
+		CommandKey:  strings.TrimSpace(batch.Policy.Key),
+		Supersede:   batch.Policy.Supersede,
+		TTLMs:       batch.Policy.TTL.Milliseconds(),
+		TimeoutMs:   batch.Policy.Timeout.Milliseconds(),
+		MaxAttempts: batch.Policy.MaxAttempts,
+		Total:       batch.Total,
+		CreatedBy:   strings.TrimSpace(batch.CreatedBy),
+		CreatedAt:   batch.CreatedAt.UTC(),
+	}
+	if len(batch.Labels) > 0 {
+		labels := marshalOr(batch.Labels, "{}")
+		row.LabelsJSON = &labels
+	}
+	return row
+}
+
+func (r CommandBatchRow) ToCommandBatch() inter.CommandBatch {
+	batch := inter.CommandBatch{
+		ID:       r.ID,
+		TenantID: r.TenantID,
+		GroupID:  r.GroupID,
+		Command:  r.Command,
+		CmdID:    inter.CmdID(r.CmdID),
+		Policy: inter.DeviceCommandPolicy{
+			TTL:         time.Duration(r.TTLMs) * time.Millisecond,
+			Timeout:     time.Duration(r.TimeoutMs) * time.Millisecond,
+			MaxAttempts: r.MaxAttempts,
+			Key:         r.CommandKey,
+			Supersede:   r.Supersede,
+		},
+		Total:     r.Total,
+		CreatedBy: r.CreatedBy,
+		CreatedAt: r.CreatedAt,
+		Items:     []inter.CommandBatchItem{},
+	}
+	if r.LabelsJSON != nil {
+		_ = json.Unmarshal([]byte(*r.LabelsJSON), &batch.Labels)
+	}
+	if r.PayloadJSON != nil {
+		batch.Payload = []byte(*r.PayloadJSON)
+	}
+	return batch
+}
+
+type CommandBatchItemRow struct {
+	bun.BaseModel `bun:"table:command_batch_items"`
+
+	BatchID   int64   `bun:"batch_id,pk"`
+	UUID      string  `bun:"uuid,pk"`
+	CommandID *int64  `bun:"command_id"`
+	ErrorText *string `bun:"error_text"`
+	// Status 来自关联的 device_commands，只用于读取。
+	Status *string `bun:"status,scanonly"`
+}
+
+func (r CommandBatchItemRow) ToCommandBatchItem() inter.CommandBatchItem {
+	item := inter.CommandBatchItem{UUID: r.UUID}
+	if r.CommandID != nil {
+		item.CommandID = *r.CommandID
+	}
+	if r.Status != nil {
+		item.Status = inter.DeviceCommandStatus(*r.Status)
+	}
+	if r.ErrorText != nil {
+		item.ErrorText = *r.ErrorText
+	}
+	return item
+}
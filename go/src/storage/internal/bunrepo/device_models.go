@@ -2,6 +2,8 @@ package bunrepo
 
 import (
 	"database/sql"
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/nhirsama/Goster-IoT/src/inter"
@@ -22,6 +24,21 @@ type DeviceModel struct {
 	CreatedAt     time.Time      `bun:"created_at"`
 	Token         sql.NullString `bun:"token"`
 	AuthStatus    int            `bun:"auth_status"`
+
+	Manufacturer     string `bun:"manufacturer"`
+	Vendor           string `bun:"vendor"`
+	Model            string `bun:"model"`
+	ModelID          string `bun:"model_id"`
+	FirmwareVersion  string `bun:"firmware_version"`
+	HardwareRevision string `bun:"hardware_revision"`
+	SoftwareBuildID  string `bun:"software_build_id"`
+	PowerSource      string `bun:"power_source"`
+	DeviceType       string `bun:"device_type"`
+	LabelsJSON       string `bun:"labels_json"`
+	AttributesJSON   string `bun:"attributes_json"`
+	EntitiesJSON     string `bun:"entities_json"`
+	EndpointsJSON    string `bun:"endpoints_json"`
+	CapabilitiesJSON string `bun:"capabilities_json"`
 }
 
 func NewDeviceModel(uuid string, meta inter.DeviceMetadata) *DeviceModel {
@@ -29,7 +46,7 @@ func NewDeviceModel(uuid string, meta inter.DeviceMetadata) *DeviceModel {
 }
 
 func NewDeviceModelInTenant(tenantID string, uuid string, meta inter.DeviceMetadata) *DeviceModel {
-	return &DeviceModel{
+	m := &DeviceModel{
 		UUID:          uuid,
 		TenantID:      NormalizeTenantID(tenantID),
 		Name:          meta.Name,
@@ -42,6 +59,79 @@ func NewDeviceModelInTenant(tenantID string, uuid string, meta inter.DeviceMetad
 		Token:         NullableToken(meta.Token),
 		AuthStatus:    int(meta.AuthenticateStatus),
 	}
+	m.SetDescriptor(meta.Descriptor)
+	return m
+}
+
+// SetDescriptor 把扩展描述写入对应列，JSON 列始终保存合法的空对象或空数组。
+func (m *DeviceModel) SetDescriptor(d inter.DeviceDescriptor) {
+	m.Manufacturer = d.Manufacturer
+	m.Vendor = d.Vendor
+	m.Model = d.Model
+	m.ModelID = d.ModelID
+	m.FirmwareVersion = d.FirmwareVersion
+	m.HardwareRevision = d.HardwareRevision
+	m.SoftwareBuildID = d.SoftwareBuildID
+	m.PowerSource = d.PowerSource
+	m.DeviceType = d.DeviceType
+	m.LabelsJSON = marshalOr(d.Labels, "{}")
+	m.AttributesJSON = marshalOr(d.Attributes, "{}")
+	m.EntitiesJSON = rawJSONOr(d.Entities, "[]")
+	m.EndpointsJSON = rawJSONOr(d.Endpoints, "[]")
+	m.CapabilitiesJSON = marshalOr(d.Capabilities, "[]")
+}
+
+// Descriptor 还原扩展描述；历史数据中无法解析的 JSON 列按空值处理。
+func (m DeviceModel) Descriptor() inter.DeviceDescriptor {
+	d := inter.DeviceDescriptor{
+		Manufacturer:     m.Manufacturer,
+		Vendor:           m.Vendor,
+		Model:            m.Model,
+		ModelID:          m.ModelID,
+		FirmwareVersion:  m.FirmwareVersion,
+		HardwareRevision: m.HardwareRevision,
+		SoftwareBuildID:  m.SoftwareBuildID,
+		PowerSource:      m.PowerSource,
+		DeviceType:       m.DeviceType,
+		Entities:         nonEmptyRawJSON(m.EntitiesJSON),
+		Endpoints:        nonEmptyRawJSON(m.EndpointsJSON),
+	}
+	_ = json.Unmarshal([]byte(m.LabelsJSON), &d.Labels)
+	_ = json.Unmarshal([]byte(m.AttributesJSON), &d.Attributes)
+	_ = json.Unmarshal([]byte(m.CapabilitiesJSON), &d.Capabilities)
+	if len(d.Labels) == 0 {
+		d.Labels = nil
+	}
+	if len(d.Attributes) == 0 {
+		d.Attributes = nil
+	}
+	if len(d.Capabilities) == 0 {
+		d.Capabilities = nil
+	}
+	return d
+}
+
+func marshalOr(v interface{}, empty string) string {
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return empty
+	}
+	return string(b)
+}
+
+func rawJSONOr(raw json.RawMessage, empty string) string {
+	if !json.Valid(raw) {
+		return empty
+	}
+	return string(raw)
+}
+
+func nonEmptyRawJSON(raw string) json.RawMessage {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "[]" || raw == "{}" || raw == "null" || !json.Valid([]byte(raw)) {
+		return nil
+	}
+	return json.RawMessage(raw)
 }
 
 func (m DeviceModel) ToMetadata() inter.DeviceMetadata {
@@ -54,6 +144,7 @@ func (m DeviceModel) ToMetadata() inter.DeviceMetadata {
 		MACAddress:         m.MACAddress,
 		CreatedAt:          m.CreatedAt,
 		AuthenticateStatus: inter.AuthenticateStatusType(m.AuthStatus),
+		Descriptor:         m.Descriptor(),
 	}
 	if m.Token.Valid {
 		out.Token = m.Token.String
@@ -67,3 +158,19 @@ func (m DeviceModel) ToRecord() inter.DeviceRecord {
 		Meta: m.ToMetadata(),
 	}
 }
+
+type DeviceIdentityModel struct {
+	bun.BaseModel `bun:"table:device_identities"`
+
+	Type      string `bun:"identity_type,pk"`
+	Value     string `bun:"identity_value,pk"`
+	UUID      string `bun:"uuid"`
+	TenantID  string `bun:"tenant_id"`
+	Issuer    string `bun:"issuer"`
+	CreatedAt int64  `bun:"created_at"`
+	UpdatedAt int64  `bun:"updated_at"`
+}
+
+func (m DeviceIdentityModel) ToIdentity() inter.DeviceIdentity {
+	return inter.DeviceIdentity{Type: m.Type, Value: m.Value, Issuer: m.Issuer}
+}
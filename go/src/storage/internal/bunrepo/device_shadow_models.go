@@ -0,0 +1,64 @@
+package bunrepo
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type DeviceShadowRow struct {
+	bun.BaseModel `bun:"table:device_shadows"`
+
+	UUID              string         `bun:"uuid,pk"`
+	TenantID          string         `bun:"tenant_id"`
+	DesiredJSON       sql.NullString `bun:"desired_json"`
+	ReportedJSON      sql.NullString `bun:"reported_json"`
+	Version           int64          `bun:"version"`
+	ReportedVersion   int64          `bun:"reported_version"`
+	DesiredUpdatedAt  int64          `bun:"desired_updated_at"`
+	ReportedUpdatedAt int64          `bun:"reported_updated_at"`
+}
+
+func NewDeviceShadowRow(shadow inter.DeviceShadow) (*DeviceShadowRow, error) {
+	desired, err := NullableJSONString(shadow.Desired)
+	if err != nil {
+		return nil, err
+	}
+	reported, err := NullableJSONString(shadow.Reported)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceShadowRow{
+		UUID:              strings.TrimSpace(shadow.UUID),
+		TenantID:          NormalizeTenantID(shadow.TenantID),
+		DesiredJSON:       desired,
+		ReportedJSON:      reported,
+		Version:           shadow.Version,
+		ReportedVersion:   shadow.ReportedVersion,
+		DesiredUpdatedAt:  shadow.DesiredUpdatedAt,
+		ReportedUpdatedAt: shadow.ReportedUpdatedAt,
+	}, nil
+}
+
+func (r DeviceShadowRow) ToDeviceShadow() (inter.DeviceShadow, error) {
+	desired, err := ParseNullableJSONMap(r.DesiredJSON)
+	if err != nil {
+		return inter.DeviceShadow{}, err
+	}
+	reported, err := ParseNullableJSONMap(r.ReportedJSON)
+	if err != nil {
+		return inter.DeviceShadow{}, err
+	}
+	return inter.DeviceShadow{
+		UUID:              r.UUID,
+		TenantID:          r.TenantID,
+		Desired:           desired,
+		Reported:          reported,
+		Version:           r.Version,
+		ReportedVersion:   r.ReportedVersion,
+		DesiredUpdatedAt:  r.DesiredUpdatedAt,
+		ReportedUpdatedAt: r.ReportedUpdatedAt,
+	}, nil
+}
@@ -0,0 +1,190 @@
+package bunrepo
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type DeviceStateRow struct {
+	bun.BaseModel `bun:"table:device_states"`
+
+	ID        int64           `bun:"id,pk,autoincrement"`
+	TenantID  string          `bun:"tenant_id"`
+	UUID      string          `bun:"uuid"`
+	Name      string          `bun:"name"`
+	EntityID  string          `bun:"entity_id"`
+	ValueType string          `bun:"value_type"`
+	ValueNum  sql.NullFloat64 `bun:"value_num"`
+	ValueText sql.NullString  `bun:"value_text"`
+	ValueBool sql.NullInt64   `bun:"value_bool"`
+	ValueJSON sql.NullString  `bun:"value_json"`
+	Unit      string          `bun:"unit"`
+	Endpoint  string          `bun:"endpoint"`
+	TagsJSON  sql.NullString  `bun:"tags_json"`
+	ValueSig  string          `bun:"value_sig"`
+	TS        int64           `bun:"ts"`
+}
+
+type DeviceStateHistoryRow struct {
+	bun.BaseModel `bun:"table:device_state_history"`
+
+	ID        int64           `bun:"id,pk,autoincrement"`
+	TenantID  string          `bun:"tenant_id"`
+	UUID      string          `bun:"uuid"`
+	Name      string          `bun:"name"`
+	EntityID  string          `bun:"entity_id"`
+	ValueType string          `bun:"value_type"`
+	ValueNum  sql.NullFloat64 `bun:"value_num"`
+	ValueText sql.NullString  `bun:"value_text"`
+	ValueBool sql.NullInt64   `bun:"value_bool"`
+	ValueJSON sql.NullString  `bun:"value_json"`
+	Unit      string          `bun:"unit"`
+	ValueSig  string          `bun:"value_sig"`
+	TS        int64           `bun:"ts"`
+}
+
+func NewDeviceStateRow(tenantID string, state inter.DeviceState) (*DeviceStateRow, error) {
+	valueJSON, err := NullableJSONString(state.ValueJSON)
+	if err != nil {
+		return nil, err
+	}
+	tagsJSON, err := nullableStringMapJSON(state.Tags)
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceStateRow{
+		TenantID:  NormalizeTenantID(tenantID),
+		UUID:      strings.TrimSpace(state.UUID),
+		Name:      strings.TrimSpace(state.Name),
+		EntityID:  strings.TrimSpace(state.EntityID),
+		ValueType: strings.TrimSpace(state.ValueType),
+		ValueNum:  NullableFloat64(state.ValueNum),
+		ValueText: nullableRawString(state.ValueText),
+		ValueBool: BoolPtrToNullableInt(state.ValueBool),
+		ValueJSON: valueJSON,
+		Unit:      strings.TrimSpace(state.Unit),
+		Endpoint:  strings.TrimSpace(state.Endpoint),
+		TagsJSON:  tagsJSON,
+		ValueSig:  DeviceStateSignature(state),
+		TS:        state.Timestamp,
+	}, nil
+}
+
+// HistoryRow 把最新值行转换为一条历史记录。
+func (r DeviceStateRow) HistoryRow() DeviceStateHistoryRow {
+	return DeviceStateHistoryRow{
+		TenantID:  r.TenantID,
+		UUID:      r.UUID,
+		Name:      r.Name,
+		EntityID:  r.EntityID,
+		ValueType: r.ValueType,
+		ValueNum:  r.ValueNum,
+		ValueText: r.ValueText,
+		ValueBool: r.ValueBool,
+		ValueJSON: r.ValueJSON,
+		Unit:      r.Unit,
+		ValueSig:  r.ValueSig,
+		TS:        r.TS,
+	}
+}
+
+func (r DeviceStateRow) ToDeviceState() (inter.DeviceState, error) {
+	valueJSON, err := ParseNullableJSONMap(r.ValueJSON)
+	if err != nil {
+		return inter.DeviceState{}, err
+	}
+	tags, err := parseNullableStringMap(r.TagsJSON)
+	if err != nil {
+		return inter.DeviceState{}, err
+	}
+	return inter.DeviceState{
+		UUID:      r.UUID,
+		Name:      r.Name,
+		EntityID:  r.EntityID,
+		ValueType: r.ValueType,
+		ValueNum:  nullableFloatOut(r.ValueNum),
+		ValueText: nullableStringOut(r.ValueText),
+		ValueBool: NullIntToBoolPtr(r.ValueBool),
+		ValueJSON: valueJSON,
+		Unit:      r.Unit,
+		Endpoint:  r.Endpoint,
+		Tags:      tags,
+		Timestamp: r.TS,
+	}, nil
+}
+
+func (r DeviceStateHistoryRow) ToDeviceState() (inter.DeviceState, error) {
+	valueJSON, err := ParseNullableJSONMap(r.ValueJSON)
+	if err != nil {
+		return inter.DeviceState{}, err
+	}
+	return inter.DeviceState{
+		UUID:      r.UUID,
+		Name:      r.Name,
+		EntityID:  r.EntityID,
+		ValueType: r.ValueType,
+		ValueNum:  nullableFloatOut(r.ValueNum),
+		ValueText: nullableStringOut(r.ValueText),
+		ValueBool: NullIntToBoolPtr(r.ValueBool),
+		ValueJSON: valueJSON,
+		Unit:      r.Unit,
+		Timestamp: r.TS,
+	}, nil
+}
+
+// DeviceStateSignature 计算状态值签名，用于判断状态是否发生变化。
+func DeviceStateSignature(state inter.DeviceState) string {
+	var payload string
+	switch {
+	case state.ValueNum != nil:
+		payload = fmt.Sprintf("n:%g|u:%s", *state.ValueNum, state.Unit)
+	case state.ValueBool != nil:
+		payload = fmt.Sprintf("b:%t|u:%s", *state.ValueBool, state.Unit)
+	case state.ValueText != nil:
+		payload = fmt.Sprintf("t:%s|u:%s", *state.ValueText, state.Unit)
+	case len(state.ValueJSON) > 0:
+		b, _ := json.Marshal(state.ValueJSON)
+		payload = fmt.Sprintf("j:%s|u:%s", string(b), state.Unit)
+	default:
+		payload = fmt.Sprintf("empty|u:%s", state.Unit)
+	}
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:8])
+}
+
+// nullableRawString 与 NullableStringPtr 不同，保留空字符串这类合法的状态值。
+func nullableRawString(v *string) sql.NullString {
+	if v == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *v, Valid: true}
+}
+
+func nullableStringMapJSON(v map[string]string) (sql.NullString, error) {
+	if len(v) == 0 {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+func parseNullableStringMap(raw sql.NullString) (map[string]string, error) {
+	if !raw.Valid || strings.TrimSpace(raw.String) == "" {
+		return nil, nil
+	}
+	var out map[string]string
+	if err := json.Unmarshal([]byte(raw.String), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,43 @@
+package bunrepo
+
+import (
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type DeviceTopologyRow struct {
+	bun.BaseModel `bun:"table:device_topology"`
+
+	TenantID       string `bun:"tenant_id,pk"`
+	UUID           string `bun:"uuid,pk"`
+	ParentUUID     string `bun:"parent_uuid"`
+	Name           string `bun:"name"`
+	DeviceType     string `bun:"device_type"`
+	NetworkAddress string `bun:"network_address"`
+	UpdatedAt      int64  `bun:"updated_at"`
+}
+
+func NewDeviceTopologyRow(tenantID string, node inter.DeviceTopologyNode) *DeviceTopologyRow {
+	return &DeviceTopologyRow{
+		TenantID:       NormalizeTenantID(tenantID),
+		UUID:           strings.TrimSpace(node.UUID),
+		ParentUUID:     strings.TrimSpace(node.ParentUUID),
+		Name:           strings.TrimSpace(node.Name),
+		DeviceType:     strings.TrimSpace(node.DeviceType),
+		NetworkAddress: strings.TrimSpace(node.NetworkAddress),
+		UpdatedAt:      node.UpdatedAt,
+	}
+}
+
+func (r DeviceTopologyRow) ToDeviceTopologyNode() inter.DeviceTopologyNode {
+	return inter.DeviceTopologyNode{
+		UUID:           r.UUID,
+		ParentUUID:     r.ParentUUID,
+		Name:           r.Name,
+		DeviceType:     r.DeviceType,
+		NetworkAddress: r.NetworkAddress,
+		UpdatedAt:      r.UpdatedAt,
+	}
+}
@@ -3,6 +3,7 @@ package bunrepo
 import (
 	"database/sql"
 	"strings"
+	"time"
 
 	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/uptrace/bun"
@@ -54,8 +55,12 @@ func NewExternalEntityRow(entity inter.ExternalEntity) (*ExternalEntityRow, erro
 	if err != nil {
 		return nil, err
 	}
+	tenantID := strings.TrimSpace(entity.TenantID)
+	if tenantID == "" {
+		tenantID = DefaultTenantID
+	}
 	return &ExternalEntityRow{
-		TenantID:       DefaultTenantID,
+		TenantID:       tenantID,
 		Source:         strings.TrimSpace(entity.Source),
 		EntityID:       strings.TrimSpace(entity.EntityID),
 		Domain:         strings.TrimSpace(entity.Domain),
@@ -82,6 +87,7 @@ func (r ExternalEntityRow) ToExternalEntity() (inter.ExternalEntity, error) {
 		return inter.ExternalEntity{}, err
 	}
 	return inter.ExternalEntity{
+		TenantID:    r.TenantID,
 		Source:      r.Source,
 		EntityID:    r.EntityID,
 		Domain:      r.Domain,
@@ -111,8 +117,12 @@ func NewExternalObservationRow(item inter.ExternalObservation) (*ExternalObserva
 	if err != nil {
 		return nil, err
 	}
+	tenantID := strings.TrimSpace(item.TenantID)
+	if tenantID == "" {
+		tenantID = DefaultTenantID
+	}
 	return &ExternalObservationRow{
-		TenantID:     DefaultTenantID,
+		TenantID:     tenantID,
 		Source:       strings.TrimSpace(item.Source),
 		EntityID:     strings.TrimSpace(item.EntityID),
 		TS:           item.Timestamp,
@@ -136,6 +146,7 @@ func (r ExternalObservationRow) ToExternalObservation() (inter.ExternalObservati
 		return inter.ExternalObservation{}, err
 	}
 	return inter.ExternalObservation{
+		TenantID:  r.TenantID,
 		Source:    r.Source,
 		EntityID:  r.EntityID,
 		Timestamp: r.TS,
@@ -148,3 +159,67 @@ func (r ExternalObservationRow) ToExternalObservation() (inter.ExternalObservati
 		RawEvent:  rawEvent,
 	}, nil
 }
+
+type ExternalCommandRow struct {
+	bun.BaseModel `bun:"table:integration_external_commands"`
+
+	ID          int64          `bun:"id,pk,autoincrement"`
+	TenantID    string         `bun:"tenant_id"`
+	Source      string         `bun:"source"`
+	EntityID    string         `bun:"entity_id"`
+	Command     string         `bun:"command"`
+	PayloadJSON sql.NullString `bun:"payload_json"`
+	Status      string         `bun:"status"`
+	ErrorText   *string        `bun:"error_text"`
+	RequestedAt time.Time      `bun:"requested_at"`
+	ExecutedAt  *time.Time     `bun:"executed_at"`
+	ClaimedAt   *time.Time     `bun:"claimed_at"`
+}
+
+func NewExternalCommandRow(cmd inter.ExternalCommand) (*ExternalCommandRow, error) {
+	payloadJSON, err := NullableJSONString(cmd.Payload)
+	if err != nil {
+		return nil, err
+	}
+	status := cmd.Status
+	if status == "" {
+		status = inter.ExternalCommandStatusPending
+	}
+	requestedAt := cmd.RequestedAt
+	if requestedAt.IsZero() {
+		requestedAt = time.Now().UTC()
+	}
+	return &ExternalCommandRow{
+		TenantID:    NormalizeTenantID(cmd.TenantID),
+		Source:      strings.TrimSpace(cmd.Source),
+		EntityID:    strings.TrimSpace(cmd.EntityID),
+		Command:     strings.TrimSpace(cmd.Command),
+		PayloadJSON: payloadJSON,
+		Status:      string(status),
+		ErrorText:   NullableOptionalString(cmd.ErrorText),
+		RequestedAt: requestedAt,
+		ExecutedAt:  cmd.ExecutedAt,
+	}, nil
+}
+
+func (r ExternalCommandRow) ToExternalCommand() (inter.ExternalCommand, error) {
+	payload, err := ParseNullableJSONMap(r.PayloadJSON)
+	if err != nil {
+		return inter.ExternalCommand{}, err
+	}
+	cmd := inter.ExternalCommand{
+		ID:          r.ID,
+		TenantID:    r.TenantID,
+		Source:      r.Source,
+		EntityID:    r.EntityID,
+		Command:     r.Command,
+		Payload:     payload,
+		Status:      inter.ExternalCommandStatus(r.Status),
+		RequestedAt: r.RequestedAt,
+		ExecutedAt:  r.ExecutedAt,
+	}
+	if r.ErrorText != nil {
+		cmd.ErrorText = *r.ErrorText
+	}
+	return cmd, nil
+}
@@ -0,0 +1,58 @@
+package bunrepo
+
+import (
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type IngestDedupeRow struct {
+	bun.BaseModel `bun:"table:ingest_event_dedupe"`
+
+	TenantID     string  `bun:"tenant_id,pk"`
+	DedupeKey    string  `bun:"dedupe_key,pk"`
+	EventID      string  `bun:"event_id"`
+	UUID         string  `bun:"uuid"`
+	Success      bool    `bun:"success"`
+	ErrorCode    *string `bun:"error_code"`
+	ErrorMessage *string `bun:"error_message"`
+	CreatedAt    int64   `bun:"created_at"`
+	CompletedAt  int64   `bun:"completed_at"`
+	ExpiresAt    int64   `bun:"expires_at"`
+}
+
+func NewIngestDedupeRow(record inter.IngestDedupeRecord) *IngestDedupeRow {
+	return &IngestDedupeRow{
+		TenantID:     NormalizeTenantID(record.TenantID),
+		DedupeKey:    strings.TrimSpace(record.Key),
+		EventID:      strings.TrimSpace(record.EventID),
+		UUID:         strings.TrimSpace(record.UUID),
+		Success:      record.Success,
+		ErrorCode:    NullableOptionalString(record.ErrorCode),
+		ErrorMessage: NullableOptionalString(record.ErrorMessage),
+		CreatedAt:    record.CreatedAt,
+		CompletedAt:  record.CompletedAt,
+		ExpiresAt:    record.ExpiresAt,
+	}
+}
+
+func (r IngestDedupeRow) ToIngestDedupeRecord() inter.IngestDedupeRecord {
+	record := inter.IngestDedupeRecord{
+		TenantID:    r.TenantID,
+		Key:         r.DedupeKey,
+		EventID:     r.EventID,
+		UUID:        r.UUID,
+		Success:     r.Success,
+		CreatedAt:   r.CreatedAt,
+		CompletedAt: r.CompletedAt,
+		ExpiresAt:   r.ExpiresAt,
+	}
+	if r.ErrorCode != nil {
+		record.ErrorCode = *r.ErrorCode
+	}
+	if r.ErrorMessage != nil {
+		record.ErrorMessage = *r.ErrorMessage
+	}
+	return record
+}
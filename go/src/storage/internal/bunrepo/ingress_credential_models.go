@@ -0,0 +1,99 @@
+package bunrepo
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type IngressCredentialRow struct {
+	bun.BaseModel `bun:"table:ingress_credentials"`
+
+	ID          string `bun:"id,pk"`
+	Name        string `bun:"name"`
+	InstanceID  string `bun:"instance_id"`
+	Adapters    string `bun:"adapters"`
+	TenantIDs   string `bun:"tenant_ids"`
+	TokenHash   string `bun:"token_hash"`
+	TokenPrefix string `bun:"token_prefix"`
+	Status      string `bun:"status"`
+	CreatedBy   string `bun:"created_by"`
+	CreatedAt   int64  `bun:"created_at"`
+	RotatedAt   int64  `bun:"rotated_at"`
+	RevokedAt   int64  `bun:"revoked_at"`
+}
+
+func NewIngressCredentialRow(cred inter.IngressCredential, tokenHash string) (*IngressCredentialRow, error) {
+	adapters, err := json.Marshal(nonNilStrings(cred.Adapters))
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := json.Marshal(nonNilStrings(cred.TenantIDs))
+	if err != nil {
+		return nil, err
+	}
+	status := cred.Status
+	if status == "" {
+		status = inter.IngressCredentialStatusActive
+	}
+	return &IngressCredentialRow{
+		ID:          strings.TrimSpace(cred.ID),
+		Name:        strings.TrimSpace(cred.Name),
+		InstanceID:  strings.TrimSpace(cred.InstanceID),
+		Adapters:    string(adapters),
+		TenantIDs:   string(tenants),
+		TokenHash:   tokenHash,
+		TokenPrefix: cred.TokenPrefix,
+		Status:      string(status),
+		CreatedBy:   strings.TrimSpace(cred.CreatedBy),
+		CreatedAt:   cred.CreatedAt.UnixMilli(),
+		RotatedAt:   optionalUnixMilli(cred.RotatedAt),
+		RevokedAt:   optionalUnixMilli(cred.RevokedAt),
+	}, nil
+}
+
+func (r IngressCredentialRow) ToIngressCredential() (inter.IngressCredential, error) {
+	cred := inter.IngressCredential{
+		ID:          r.ID,
+		Name:        r.Name,
+		InstanceID:  r.InstanceID,
+		TokenPrefix: r.TokenPrefix,
+		Status:      inter.IngressCredentialStatus(r.Status),
+		CreatedBy:   r.CreatedBy,
+		CreatedAt:   time.UnixMilli(r.CreatedAt).UTC(),
+		RotatedAt:   timeFromUnixMilli(r.RotatedAt),
+		RevokedAt:   timeFromUnixMilli(r.RevokedAt),
+	}
+	if err := json.Unmarshal([]byte(r.Adapters), &cred.Adapters); err != nil {
+		return inter.IngressCredential{}, err
+	}
+	if err := json.Unmarshal([]byte(r.TenantIDs), &cred.TenantIDs); err != nil {
+		return inter.IngressCredential{}, err
+	}
+	return cred, nil
+}
+
+func nonNilStrings(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
+
+func optionalUnixMilli(t *time.Time) int64 {
+	if t == nil || t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func timeFromUnixMilli(ms int64) *time.Time {
+	if ms <= 0 {
+		return nil
+	}
+	t := time.UnixMilli(ms).UTC()
+	return &t
+}
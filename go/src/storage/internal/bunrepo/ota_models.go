@@ -0,0 +1,182 @@
+package bunrepo
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type FirmwareArtifactRow struct {
+	bun.BaseModel `bun:"table:firmware_artifacts"`
+
+	ID                   string    `bun:"id,pk"`
+	TenantID             string    `bun:"tenant_id"`
+	Name                 string    `bun:"name"`
+	Version              string    `bun:"version"`
+	HardwareVersionsJSON string    `bun:"hardware_versions_json"`
+	Size                 int64     `bun:"size"`
+	SHA256               string    `bun:"sha256"`
+	Content              []byte    `bun:"content"`
+	CreatedBy            string    `bun:"created_by"`
+	CreatedAt            time.Time `bun:"created_at"`
+}
+
+// FirmwareArtifactColumns 是读取镜像元数据时的列，不包含 content。
+var FirmwareArtifactColumns = []string{"id", "tenant_id", "name", "version", "hardware_versions_json", "size", "sha256", "created_by", "created_at"}
+
+func NewFirmwareArtifactRow(artifact inter.FirmwareArtifact) *FirmwareArtifactRow {
+	hardware := make([]string, 0, len(artifact.HardwareVersions))
+	for _, v := range artifact.HardwareVersions {
+		if v = strings.TrimSpace(v); v != "" {
+			hardware = append(hardware, v)
+		}
+	}
+	return &FirmwareArtifactRow{
+		ID:                   strings.TrimSpace(artifact.ID),
+		TenantID:             NormalizeTenantID(artifact.TenantID),
+		Name:                 strings.TrimSpace(artifact.Name),
+		Version:              strings.TrimSpace(artifact.Version),
+		HardwareVersionsJSON: marshalOr(hardware, "[]"),
+		Size:                 int64(len(artifact.Content)),
+		SHA256:               strings.ToLower(strings.TrimSpace(artifact.SHA256)),
+		Content:              artifact.Content,
+		CreatedBy:            strings.TrimSpace(artifact.CreatedBy),
+		CreatedAt:            artifact.CreatedAt.UTC(),
+	}
+}
+
+func (r FirmwareArtifactRow) ToFirmwareArtifact() inter.FirmwareArtifact {
+	artifact := inter.FirmwareArtifact{
+		ID:               r.ID,
+		TenantID:         r.TenantID,
+		Name:             r.Name,
+		Version:          r.Version,
+		HardwareVersions: []string{},
+		Size:             r.Size,
+		SHA256:           r.SHA256,
+		CreatedBy:        r.CreatedBy,
+		CreatedAt:        r.CreatedAt,
+	}
+	_ = json.Unmarshal([]byte(r.HardwareVersionsJSON), &artifact.HardwareVersions)
+	return artifact
+}
+
+type OtaCampaignRow struct {
+	bun.BaseModel `bun:"table:ota_campaigns"`
+
+	ID             int64     `bun:"id,pk,autoincrement"`
+	TenantID       string    `bun:"tenant_id"`
+	Name           string    `bun:"name"`
+	ArtifactID     string    `bun:"artifact_id"`
+	GroupID        string    `bun:"group_id"`
+	LabelsJSON     *string   `bun:"labels_json"`
+	RolloutPercent int       `bun:"rollout_percent"`
+	Status         string    `bun:"status"`
+	ChunkSize      int       `bun:"chunk_size"`
+	CreatedBy      string    `bun:"created_by"`
+	CreatedAt      time.Time `bun:"created_at"`
+	UpdatedAt      time.Time `bun:"updated_at"`
+}
+
+func NewOtaCampaignRow(campaign inter.OtaCampaign) *OtaCampaignRow {
+	row := &OtaCampaignRow{
+		TenantID:       NormalizeTenantID(campaign.TenantID),
+		Name:           strings.TrimSpace(campaign.Name),
+		ArtifactID:     strings.TrimSpace(campaign.ArtifactID),
+		GroupID:        strings.TrimSpace(campaign.GroupID),
+		RolloutPercent: campaign.RolloutPercent,
+		Status:         string(campaign.Status),
+		ChunkSize:      campaign.ChunkSize,
+		CreatedBy:      strings.TrimSpace(campaign.CreatedBy),
+		CreatedAt:      campaign.CreatedAt.UTC(),
+		UpdatedAt:      campaign.UpdatedAt.UTC(),
+	}
+	if len(campaign.Labels) > 0 {
+		labels := marshalOr(campaign.Labels, "{}")
+		row.LabelsJSON = &labels
+	}
+	return row
+}
+
+func (r OtaCampaignRow) ToOtaCampaign() inter.OtaCampaign {
+	campaign := inter.OtaCampaign{
+		ID:             r.ID,
+		TenantID:       r.TenantID,
+		Name:           r.Name,
+		ArtifactID:     r.ArtifactID,
+		GroupID:        r.GroupID,
+		RolloutPercent: r.RolloutPercent,
+		Status:         inter.OtaCampaignStatus(r.Status),
+		ChunkSize:      r.ChunkSize,
+		CreatedBy:      r.CreatedBy,
+		CreatedAt:      r.CreatedAt,
+		UpdatedAt:      r.UpdatedAt,
+	}
+	if r.LabelsJSON != nil {
+		_ = json.Unmarshal([]byte(*r.LabelsJSON), &campaign.Labels)
+	}
+	return campaign
+}
+
+type OtaDeviceRow struct {
+	bun.BaseModel `bun:"table:ota_devices"`
+
+	CampaignID    int64      `bun:"campaign_id,pk"`
+	UUID          string     `bun:"uuid,pk"`
+	Bucket        int        `bun:"bucket"`
+	Status        string     `bun:"status"`
+	BytesSent     int64      `bun:"bytes_sent"`
+	CommandID     int64      `bun:"command_id"`
+	Attempts      int        `bun:"attempts"`
+	FromVersion   string     `bun:"from_version"`
+	ErrorText     *string    `bun:"error_text"`
+	Revision      int64      `bun:"revision"`
+	StartedAt     *time.Time `bun:"started_at"`
+	TransferredAt *time.Time `bun:"transferred_at"`
+	UpdatedAt     time.Time  `bun:"updated_at"`
+}
+
+func NewOtaDeviceRow(device inter.OtaDevice) *OtaDeviceRow {
+	row := &OtaDeviceRow{
+		CampaignID:    device.CampaignID,
+		UUID:          strings.TrimSpace(device.UUID),
+		Bucket:        device.Bucket,
+		Status:        string(device.Status),
+		BytesSent:     device.BytesSent,
+		CommandID:     device.CommandID,
+		Attempts:      device.Attempts,
+		FromVersion:   device.FromVersion,
+		Revision:      device.Revision,
+		StartedAt:     utcTimePtr(device.StartedAt),
+		TransferredAt: utcTimePtr(device.TransferredAt),
+		UpdatedAt:     device.UpdatedAt.UTC(),
+	}
+	if text := strings.TrimSpace(device.ErrorText); text != "" {
+		row.ErrorText = &text
+	}
+	return row
+}
+
+func (r OtaDeviceRow) ToOtaDevice() inter.OtaDevice {
+	device := inter.OtaDevice{
+		CampaignID:    r.CampaignID,
+		UUID:          r.UUID,
+		Bucket:        r.Bucket,
+		Status:        inter.OtaDeviceStatus(r.Status),
+		BytesSent:     r.BytesSent,
+		CommandID:     r.CommandID,
+		Attempts:      r.Attempts,
+		FromVersion:   r.FromVersion,
+		Revision:      r.Revision,
+		StartedAt:     r.StartedAt,
+		TransferredAt: r.TransferredAt,
+		UpdatedAt:     r.UpdatedAt,
+	}
+	if r.ErrorText != nil {
+		device.ErrorText = *r.ErrorText
+	}
+	return device
+}
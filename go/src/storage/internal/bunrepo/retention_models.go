@@ -0,0 +1,87 @@
+package bunrepo
+
+import (
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/uptrace/bun"
+)
+
+type RetentionPolicyRow struct {
+	bun.BaseModel `bun:"table:retention_policies"`
+
+	TenantID    string    `bun:"tenant_id,pk"`
+	DataClass   string    `bun:"data_class,pk"`
+	RetentionMs int64     `bun:"retention_ms"`
+	UpdatedBy   string    `bun:"updated_by"`
+	UpdatedAt   time.Time `bun:"updated_at"`
+}
+
+func NewRetentionPolicyRow(policy inter.RetentionPolicy) *RetentionPolicyRow {
+	row := &RetentionPolicyRow{
+		TenantID:    NormalizeTenantID(policy.TenantID),
+		DataClass:   string(policy.DataClass),
+		RetentionMs: policy.RetentionMs,
+		UpdatedBy:   policy.UpdatedBy,
+		UpdatedAt:   time.Now().UTC(),
+	}
+	if policy.UpdatedAt != nil {
+		row.UpdatedAt = policy.UpdatedAt.UTC()
+	}
+	return row
+}
+
+func (r RetentionPolicyRow) ToRetentionPolicy() inter.RetentionPolicy {
+	updatedAt := r.UpdatedAt
+	return inter.RetentionPolicy{
+		TenantID:    r.TenantID,
+		DataClass:   inter.RetentionDataClass(r.DataClass),
+		RetentionMs: r.RetentionMs,
+		Source:      inter.RetentionSourceTenant,
+		UpdatedBy:   r.UpdatedBy,
+		UpdatedAt:   &updatedAt,
+	}
+}
+
+// MetricRollup 是指标汇总行的公共列，小时表与天表结构相同。
+type MetricRollup struct {
+	TenantID string  `bun:"tenant_id,pk"`
+	UUID     string  `bun:"uuid,pk"`
+	Name     string  `bun:"name,pk"`
+	EntityID string  `bun:"entity_id,pk"`
+	BucketTS int64   `bun:"bucket_ts,pk"`
+	Unit     string  `bun:"unit"`
+	Count    int64   `bun:"value_count"`
+	Sum      float64 `bun:"value_sum"`
+	Min      float64 `bun:"value_min"`
+	Max      float64 `bun:"value_max"`
+}
+
+// Merge 把同一桶的另一段汇总并入当前行。
+func (r *MetricRollup) Merge(other MetricRollup) {
+	if r.Count == 0 {
+		*r = other
+		return
+	}
+	r.Count += other.Count
+	r.Sum += other.Sum
+	if other.Min < r.Min {
+		r.Min = other.Min
+	}
+	if other.Max > r.Max {
+		r.Max = other.Max
+	}
+	if other.Unit != "" {
+		r.Unit = other.Unit
+	}
+}
+
+type MetricHourlyRollupRow struct {
+	bun.BaseModel `bun:"table:metric_rollups_hourly,alias:mr"`
+	MetricRollup
+}
+
+type MetricDailyRollupRow struct {
+	bun.BaseModel `bun:"table:metric_rollups_daily,alias:mr"`
+	MetricRollup
+}
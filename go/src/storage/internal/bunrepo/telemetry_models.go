@@ -1,6 +1,8 @@
 package bunrepo
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/nhirsama/Goster-IoT/src/inter"
@@ -10,11 +12,35 @@ import (
 type MetricRow struct {
 	bun.BaseModel `bun:"table:metrics"`
 
-	UUID     string  `bun:"uuid"`
-	TenantID string  `bun:"tenant_id"`
-	TS       int64   `bun:"ts"`
-	Value    float32 `bun:"value"`
-	Type     uint8   `bun:"type"`
+	UUID      string  `bun:"uuid"`
+	TenantID  string  `bun:"tenant_id"`
+	TS        int64   `bun:"ts"`
+	Value     float64 `bun:"value"`
+	Type      uint8   `bun:"type"`
+	Name      string  `bun:"name"`
+	Unit      string  `bun:"unit"`
+	EntityID  string  `bun:"entity_id"`
+	TagsJSON  string  `bun:"tags_json"`
+	ValueType string  `bun:"value_type"`
+	ValueText string  `bun:"value_text"`
+}
+
+// NewMetricRow 在写入前按 legacy 对应表补齐名称与类型。
+func NewMetricRow(uuid, tenantID string, point inter.MetricPoint) MetricRow {
+	point = inter.NormalizeMetricPoint(point)
+	return MetricRow{
+		UUID:      uuid,
+		TenantID:  tenantID,
+		TS:        point.Timestamp,
+		Value:     point.Value,
+		Type:      point.Type,
+		Name:      point.Name,
+		Unit:      strings.TrimSpace(point.Unit),
+		EntityID:  strings.TrimSpace(point.EntityID),
+		TagsJSON:  marshalOr(point.Tags, "{}"),
+		ValueType: point.ValueType,
+		ValueText: point.ValueText,
+	}
 }
 
 type LogRow struct {
@@ -31,11 +57,24 @@ type LogRow struct {
 func ToMetricPoints(rows []MetricRow) []inter.MetricPoint {
 	out := make([]inter.MetricPoint, 0, len(rows))
 	for _, row := range rows {
-		out = append(out, inter.MetricPoint{
-			Timestamp: row.TS,
-			Value:     row.Value,
-			Type:      row.Type,
-		})
+		out = append(out, row.ToMetricPoint())
 	}
 	return out
 }
+
+func (r MetricRow) ToMetricPoint() inter.MetricPoint {
+	point := inter.MetricPoint{
+		Timestamp: r.TS,
+		Name:      r.Name,
+		Unit:      r.Unit,
+		EntityID:  r.EntityID,
+		ValueType: r.ValueType,
+		Value:     r.Value,
+		ValueText: r.ValueText,
+		Type:      r.Type,
+	}
+	if r.TagsJSON != "" && r.TagsJSON != "{}" {
+		_ = json.Unmarshal([]byte(r.TagsJSON), &point.Tags)
+	}
+	return inter.NormalizeMetricPoint(point)
+}
@@ -0,0 +1,316 @@
+package ota
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// deviceInsertBatch 限制单条 INSERT 写入的设备行数，避免超出 SQLite 的参数上限。
+const deviceInsertBatch = 200
+
+type Repository struct {
+	db *bun.DB
+}
+
+func NewRepository(db *bun.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateFirmwareArtifact(artifact inter.FirmwareArtifact) (inter.FirmwareArtifact, error) {
+	if artifact.CreatedAt.IsZero() {
+		artifact.CreatedAt = time.Now()
+	}
+	row := bunrepo.NewFirmwareArtifactRow(artifact)
+	if row.Version == "" || len(row.Content) == 0 {
+		return inter.FirmwareArtifact{}, inter.ErrFirmwareArtifactInvalid
+	}
+	if row.ID == "" {
+		id, err := newArtifactID()
+		if err != nil {
+			return inter.FirmwareArtifact{}, err
+		}
+		row.ID = id
+	}
+	if _, err := r.db.NewInsert().
+		Model(row).
+		Returning("NULL").
+		Exec(context.Background()); err != nil {
+		return inter.FirmwareArtifact{}, err
+	}
+	return row.ToFirmwareArtifact(), nil
+}
+
+func (r *Repository) GetFirmwareArtifact(tenantID, id string) (inter.FirmwareArtifact, error) {
+	var row bunrepo.FirmwareArtifactRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Column(bunrepo.FirmwareArtifactColumns...).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("id = ?", strings.TrimSpace(id)).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.FirmwareArtifact{}, inter.ErrFirmwareArtifactNotFound
+		}
+		return inter.FirmwareArtifact{}, err
+	}
+	return row.ToFirmwareArtifact(), nil
+}
+
+func (r *Repository) ListFirmwareArtifacts(tenantID string, limit int) ([]inter.FirmwareArtifact, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var rows []bunrepo.FirmwareArtifactRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Column(bunrepo.FirmwareArtifactColumns...).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		OrderExpr("created_at DESC, id DESC").
+		Limit(limit).
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	out := make([]inter.FirmwareArtifact, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToFirmwareArtifact())
+	}
+	return out, nil
+}
+
+func (r *Repository) DeleteFirmwareArtifact(tenantID, id string) error {
+	id = strings.TrimSpace(id)
+	return r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		inUse, err := tx.NewSelect().
+			Model((*bunrepo.OtaCampaignRow)(nil)).
+			Where("artifact_id = ?", id).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return inter.ErrFirmwareArtifactInUse
+		}
+		res, err := tx.NewDelete().
+			Model((*bunrepo.FirmwareArtifactRow)(nil)).
+			Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+			Where("id = ?", id).
+			Returning("NULL").
+			Exec(ctx)
+		return expectAffected(res, err, inter.ErrFirmwareArtifactNotFound)
+	})
+}
+
+func (r *Repository) ReadFirmwareChunk(id string, offset int64, length int) ([]byte, error) {
+	if offset < 0 || length <= 0 {
+		return nil, inter.ErrFirmwareArtifactInvalid
+	}
+	// 两种方言的子串函数都从 1 开始计数。
+	query := "SELECT substr(content, ?, ?) FROM firmware_artifacts WHERE id = ?"
+	if r.db.Dialect().Name() == dialect.PG {
+		query = "SELECT substring(content from ? for ?) FROM firmware_artifacts WHERE id = ?"
+	}
+	var chunk []byte
+	err := r.db.QueryRowContext(context.Background(), query, offset+1, length, strings.TrimSpace(id)).Scan(&chunk)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, inter.ErrFirmwareArtifactNotFound
+		}
+		return nil, err
+	}
+	return chunk, nil
+}
+
+func (r *Repository) CreateOtaCampaign(campaign inter.OtaCampaign, devices []inter.OtaDevice) (int64, error) {
+	now := time.Now()
+	if campaign.CreatedAt.IsZero() {
+		campaign.CreatedAt = now
+	}
+	if campaign.UpdatedAt.IsZero() {
+		campaign.UpdatedAt = campaign.CreatedAt
+	}
+	row := bunrepo.NewOtaCampaignRow(campaign)
+	if row.ArtifactID == "" || row.Status == "" {
+		return 0, inter.ErrOtaCampaignInvalid
+	}
+	err := r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().
+			Model(row).
+			ExcludeColumn("id").
+			Returning("id").
+			Exec(ctx); err != nil {
+			return err
+		}
+		rows := make([]*bunrepo.OtaDeviceRow, 0, len(devices))
+		for _, device := range devices {
+			device.CampaignID = row.ID
+			if device.UpdatedAt.IsZero() {
+				device.UpdatedAt = now
+			}
+			rows = append(rows, bunrepo.NewOtaDeviceRow(device))
+		}
+		for start := 0; start < len(rows); start += deviceInsertBatch {
+			end := start + deviceInsertBatch
+			if end > len(rows) {
+				end = len(rows)
+			}
+			batch := rows[start:end]
+			if _, err := tx.NewInsert().
+				Model(&batch).
+				Returning("NULL").
+				Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return row.ID, nil
+}
+
+func (r *Repository) GetOtaCampaign(tenantID string, id int64) (inter.OtaCampaign, error) {
+	var row bunrepo.OtaCampaignRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("id = ?", id).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.OtaCampaign{}, inter.ErrOtaCampaignNotFound
+		}
+		return inter.OtaCampaign{}, err
+	}
+	return row.ToOtaCampaign(), nil
+}
+
+func (r *Repository) ListOtaCampaigns(tenantID string, limit int) ([]inter.OtaCampaign, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var rows []bunrepo.OtaCampaignRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		OrderExpr("id DESC").
+		Limit(limit).
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	return campaignsFromRows(rows), nil
+}
+
+func (r *Repository) ListActiveOtaCampaigns() ([]inter.OtaCampaign, error) {
+	var rows []bunrepo.OtaCampaignRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Where("status IN (?)", bun.In([]string{string(inter.OtaCampaignRunning), string(inter.OtaCampaignPaused)})).
+		OrderExpr("id ASC").
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	return campaignsFromRows(rows), nil
+}
+
+func (r *Repository) UpdateOtaCampaignState(id int64, status inter.OtaCampaignStatus, rolloutPercent int) error {
+	res, err := r.db.NewUpdate().
+		Model((*bunrepo.OtaCampaignRow)(nil)).
+		Set("status = ?", string(status)).
+		Set("rollout_percent = ?", rolloutPercent).
+		Set("updated_at = ?", time.Now().UTC()).
+		Where("id = ?", id).
+		Returning("NULL").
+		Exec(context.Background())
+	return expectAffected(res, err, inter.ErrOtaCampaignNotFound)
+}
+
+func (r *Repository) ListOtaDevices(campaignID int64) ([]inter.OtaDevice, error) {
+	var rows []bunrepo.OtaDeviceRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Where("campaign_id = ?", campaignID).
+		OrderExpr("uuid ASC").
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	out := make([]inter.OtaDevice, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToOtaDevice())
+	}
+	return out, nil
+}
+
+func (r *Repository) UpdateOtaDevice(device inter.OtaDevice, expectedRevision int64) (bool, error) {
+	if device.UpdatedAt.IsZero() {
+		device.UpdatedAt = time.Now()
+	}
+	row := bunrepo.NewOtaDeviceRow(device)
+	res, err := r.db.NewUpdate().
+		Model((*bunrepo.OtaDeviceRow)(nil)).
+		Set("status = ?", row.Status).
+		Set("bytes_sent = ?", row.BytesSent).
+		Set("command_id = ?", row.CommandID).
+		Set("attempts = ?", row.Attempts).
+		Set("error_text = ?", row.ErrorText).
+		Set("started_at = ?", row.StartedAt).
+		Set("transferred_at = ?", row.TransferredAt).
+		Set("updated_at = ?", row.UpdatedAt).
+		Set("revision = ?", expectedRevision+1).
+		Where("campaign_id = ?", row.CampaignID).
+		Where("uuid = ?", row.UUID).
+		Where("revision = ?", expectedRevision).
+		Returning("NULL").
+		Exec(context.Background())
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func campaignsFromRows(rows []bunrepo.OtaCampaignRow) []inter.OtaCampaign {
+	out := make([]inter.OtaCampaign, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToOtaCampaign())
+	}
+	return out
+}
+
+func expectAffected(res sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func newArtifactID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return "fw_" + hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,96 @@
+package ota_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+	"github.com/nhirsama/Goster-IoT/src/storage/ota"
+)
+
+func TestRepositoryFirmwareArtifactAndCampaign(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "ota_repo.db")
+	repo := ota.NewRepository(base.DB)
+
+	image := []byte{0x00, 0x01, 0xfe, 0xff, 0x20, 0x0a, 0x41, 0x42, 0x43}
+	artifact, err := repo.CreateFirmwareArtifact(inter.FirmwareArtifact{
+		Name:             "sensor",
+		Version:          "1.2.0",
+		HardwareVersions: []string{"v1", " ", "v2"},
+		SHA256:           "ABC",
+		Content:          image,
+		CreatedBy:        "admin",
+	})
+	if err != nil {
+		t.Fatalf("CreateFirmwareArtifact failed: %v", err)
+	}
+	if artifact.ID == "" || artifact.Size != int64(len(image)) || len(artifact.HardwareVersions) != 2 || artifact.SHA256 != "abc" {
+		t.Fatalf("unexpected artifact: %+v", artifact)
+	}
+	if _, err := repo.GetFirmwareArtifact("tenant_other", artifact.ID); !errors.Is(err, inter.ErrFirmwareArtifactNotFound) {
+		t.Fatalf("expected not found for other tenant, got %v", err)
+	}
+
+	// 数据块按字节原样读取，包含前导零与换行。
+	chunk, err := repo.ReadFirmwareChunk(artifact.ID, 2, 4)
+	if err != nil || !bytes.Equal(chunk, image[2:6]) {
+		t.Fatalf("unexpected chunk %x err=%v", chunk, err)
+	}
+	tail, err := repo.ReadFirmwareChunk(artifact.ID, 7, 16)
+	if err != nil || !bytes.Equal(tail, image[7:]) {
+		t.Fatalf("unexpected tail %x err=%v", tail, err)
+	}
+
+	campaignID, err := repo.CreateOtaCampaign(inter.OtaCampaign{
+		Name:           "rollout",
+		ArtifactID:     artifact.ID,
+		Labels:         map[string]string{"site": "lab"},
+		RolloutPercent: 10,
+		Status:         inter.OtaCampaignRunning,
+		ChunkSize:      4,
+	}, []inter.OtaDevice{
+		{UUID: "ota-b", Bucket: 42, Status: inter.OtaDevicePending, FromVersion: "1.0.0"},
+		{UUID: "ota-a", Bucket: 3, Status: inter.OtaDeviceSkipped, ErrorText: "incompatible"},
+	})
+	if err != nil {
+		t.Fatalf("CreateOtaCampaign failed: %v", err)
+	}
+	if err := repo.DeleteFirmwareArtifact(inter.DefaultTenantID, artifact.ID); !errors.Is(err, inter.ErrFirmwareArtifactInUse) {
+		t.Fatalf("expected artifact in use, got %v", err)
+	}
+
+	campaign, err := repo.GetOtaCampaign(inter.DefaultTenantID, campaignID)
+	if err != nil || campaign.Labels["site"] != "lab" || campaign.RolloutPercent != 10 || campaign.ChunkSize != 4 {
+		t.Fatalf("unexpected campaign: %+v err=%v", campaign, err)
+	}
+	if err := repo.UpdateOtaCampaignState(campaignID, inter.OtaCampaignPaused, 50); err != nil {
+		t.Fatalf("UpdateOtaCampaignState failed: %v", err)
+	}
+	active, err := repo.ListActiveOtaCampaigns()
+	if err != nil || len(active) != 1 || active[0].Status != inter.OtaCampaignPaused || active[0].RolloutPercent != 50 {
+		t.Fatalf("unexpected active campaigns: %+v err=%v", active, err)
+	}
+
+	devices, err := repo.ListOtaDevices(campaignID)
+	if err != nil || len(devices) != 2 || devices[0].UUID != "ota-a" || devices[0].ErrorText != "incompatible" {
+		t.Fatalf("unexpected devices: %+v err=%v", devices, err)
+	}
+	device := devices[1]
+	device.Status = inter.OtaDeviceTransferring
+	device.BytesSent = 4
+	device.CommandID = 7
+	ok, err := repo.UpdateOtaDevice(device, device.Revision)
+	if err != nil || !ok {
+		t.Fatalf("UpdateOtaDevice failed: ok=%v err=%v", ok, err)
+	}
+	// 旧 revision 的写入不再生效。
+	if ok, err := repo.UpdateOtaDevice(device, device.Revision); err != nil || ok {
+		t.Fatalf("expected stale revision to be rejected: ok=%v err=%v", ok, err)
+	}
+	devices, _ = repo.ListOtaDevices(campaignID)
+	if got := devices[1]; got.BytesSent != 4 || got.CommandID != 7 || got.Revision != 1 || got.FromVersion != "1.0.0" {
+		t.Fatalf("unexpected updated device: %+v", got)
+	}
+}
@@ -0,0 +1,108 @@
+package presence
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+// SaveDeviceDiagnostics 覆盖设备的最新诊断快照，需要采样时在同一事务内追加历史。
+func (r *Repository) SaveDeviceDiagnostics(diagnostics inter.DeviceDiagnostics, appendHistory bool) error {
+	diagnostics.UUID = strings.TrimSpace(diagnostics.UUID)
+	if diagnostics.UUID == "" {
+		return errors.New("uuid is required")
+	}
+	now := time.Now().UnixMilli()
+	if diagnostics.ReceivedAt <= 0 {
+		diagnostics.ReceivedAt = now
+	}
+	if diagnostics.ObservedAt <= 0 {
+		diagnostics.ObservedAt = diagnostics.ReceivedAt
+	}
+	if appendHistory {
+		diagnostics.SampledAt = diagnostics.ObservedAt
+	}
+	tenantID, err := r.tenantResolver.ResolveDeviceTenant(diagnostics.UUID)
+	if err != nil {
+		tenantID = bunrepo.DefaultTenantID
+	}
+	row := bunrepo.NewDeviceDiagnosticsRow(tenantID, diagnostics)
+
+	return r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		q := tx.NewInsert().
+			Model(row).
+			On("CONFLICT (uuid) DO UPDATE").
+			Set("tenant_id = EXCLUDED.tenant_id").
+			Set("state_json = EXCLUDED.state_json").
+			Set("observed_at = EXCLUDED.observed_at").
+			Set("received_at = EXCLUDED.received_at")
+		if appendHistory {
+			q = q.Set("sampled_at = EXCLUDED.sampled_at")
+		}
+		if _, err := q.Returning("NULL").Exec(ctx); err != nil {
+			return err
+		}
+		if !appendHistory {
+			return nil
+		}
+		_, err := tx.NewInsert().Model(row.HistoryRow()).Returning("NULL").Exec(ctx)
+		return err
+	})
+}
+
+func (r *Repository) GetDeviceDiagnosticsByTenant(tenantID, uuid string) (inter.DeviceDiagnostics, error) {
+	var row bunrepo.DeviceDiagnosticsRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("uuid = ?", strings.TrimSpace(uuid)).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.DeviceDiagnostics{}, inter.ErrDeviceDiagnosticsNotFound
+		}
+		return inter.DeviceDiagnostics{}, err
+	}
+	return row.ToDeviceDiagnostics(), nil
+}
+
+// QueryDeviceDiagnosticsHistoryByTenant 按上报时间倒序返回诊断历史，默认查询最近 24 小时。
+func (r *Repository) QueryDeviceDiagnosticsHistoryByTenant(tenantID, uuid string, query inter.DeviceDiagnosticsQuery) ([]inter.DeviceDiagnostics, error) {
+	end := query.End
+	if end <= 0 {
+		end = time.Now().UnixMilli()
+	}
+	start := query.Start
+	if start <= 0 || start > end {
+		start = end - int64(24*time.Hour/time.Millisecond)
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 500
+	}
+
+	var rows []bunrepo.DeviceDiagnosticsHistoryRow
+	err := r.db.NewSelect().
+		Model(&rows).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("uuid = ?", strings.TrimSpace(uuid)).
+		Where("observed_at BETWEEN ? AND ?", start, end).
+		OrderExpr("observed_at DESC, id DESC").
+		Limit(limit).
+		Scan(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]inter.DeviceDiagnostics, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToDeviceDiagnostics())
+	}
+	return out, nil
+}
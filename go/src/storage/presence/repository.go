@@ -0,0 +1,81 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+type Repository struct {
+	db             *bun.DB
+	tenantResolver interface {
+		ResolveDeviceTenant(uuid string) (string, error)
+	}
+}
+
+func NewRepository(db *bun.DB, tenantResolver interface {
+	ResolveDeviceTenant(uuid string) (string, error)
+}) *Repository {
+	return &Repository{db: db, tenantResolver: tenantResolver}
+}
+
+// AppendDeviceConnectivityEvent 追加一条在线/离线切换记录，租户按设备归属解析。
+func (r *Repository) AppendDeviceConnectivityEvent(event inter.DeviceConnectivityEvent) error {
+	uuid := strings.TrimSpace(event.UUID)
+	if uuid == "" {
+		return errors.New("uuid is required")
+	}
+	if event.Status != inter.ConnectivityOnline && event.Status != inter.ConnectivityOffline {
+		return errors.New("invalid connectivity status")
+	}
+	if event.Timestamp <= 0 {
+		event.Timestamp = time.Now().UnixMilli()
+	}
+	tenantID, err := r.tenantResolver.ResolveDeviceTenant(uuid)
+	if err != nil {
+		tenantID = bunrepo.DefaultTenantID
+	}
+	_, err = r.db.NewInsert().
+		Model(bunrepo.NewDeviceConnectivityRow(tenantID, event)).
+		Returning("NULL").
+		Exec(context.Background())
+	return err
+}
+
+func (r *Repository) QueryDeviceConnectivityByTenant(tenantID, uuid string, query inter.DeviceConnectivityQuery) ([]inter.DeviceConnectivityEvent, error) {
+	end := query.End
+	if end <= 0 {
+		end = time.Now().UnixMilli()
+	}
+	start := query.Start
+	if start <= 0 || start > end {
+		start = end - int64(24*time.Hour/time.Millisecond)
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 500
+	}
+
+	var rows []bunrepo.DeviceConnectivityRow
+	err := r.db.NewSelect().
+		Model(&rows).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("uuid = ?", strings.TrimSpace(uuid)).
+		Where("ts BETWEEN ? AND ?", start, end).
+		OrderExpr("ts ASC, id ASC").
+		Limit(limit).
+		Scan(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]inter.DeviceConnectivityEvent, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToDeviceConnectivityEvent())
+	}
+	return out, nil
+}
@@ -0,0 +1,95 @@
+package presence_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/device"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+	"github.com/nhirsama/Goster-IoT/src/storage/presence"
+)
+
+func TestRepositoryDeviceConnectivityHistory(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "presence_repo.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := presence.NewRepository(base.DB, deviceRepo)
+
+	uuid := "device-presence-repo"
+	if err := deviceRepo.InitDeviceInTenant("tenant_a", uuid, inter.DeviceMetadata{Name: "Presence", SerialNumber: "sn-presence-repo"}); err != nil {
+		t.Fatalf("InitDeviceInTenant failed: %v", err)
+	}
+
+	now := time.Now().UnixMilli()
+	for i, event := range []inter.DeviceConnectivityEvent{
+		{UUID: uuid, Status: inter.ConnectivityOnline, Reason: "heartbeat"},
+		{UUID: uuid, Status: inter.ConnectivityOffline, Reason: "mqtt_disconnect"},
+	} {
+		event.Timestamp = now - int64(2-i)*1000
+		if err := repo.AppendDeviceConnectivityEvent(event); err != nil {
+			t.Fatalf("AppendDeviceConnectivityEvent failed: %v", err)
+		}
+	}
+	if err := repo.AppendDeviceConnectivityEvent(inter.DeviceConnectivityEvent{UUID: uuid, Status: "flapping"}); err == nil {
+		t.Fatal("expected invalid status to be rejected")
+	}
+
+	items, err := repo.QueryDeviceConnectivityByTenant("tenant_a", uuid, inter.DeviceConnectivityQuery{Start: now - 10000, End: now})
+	if err != nil {
+		t.Fatalf("QueryDeviceConnectivityByTenant failed: %v", err)
+	}
+	if len(items) != 2 || items[0].Status != inter.ConnectivityOnline || items[1].Reason != "mqtt_disconnect" {
+		t.Fatalf("unexpected connectivity history: %+v", items)
+	}
+
+	limited, err := repo.QueryDeviceConnectivityByTenant("tenant_a", uuid, inter.DeviceConnectivityQuery{Start: now - 10000, End: now, Limit: 1})
+	if err != nil || len(limited) != 1 {
+		t.Fatalf("expected limit to apply, got %+v err=%v", limited, err)
+	}
+
+	other, err := repo.QueryDeviceConnectivityByTenant("tenant_b", uuid, inter.DeviceConnectivityQuery{Start: now - 10000, End: now})
+	if err != nil || len(other) != 0 {
+		t.Fatalf("history must be tenant scoped, got %+v err=%v", other, err)
+	}
+}
+
+func TestRepositoryDeviceDiagnosticsSnapshotAndHistory(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "presence_diagnostics.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := presence.NewRepository(base.DB, deviceRepo)
+
+	uuid := "device-diagnostics-repo"
+	if err := deviceRepo.InitDeviceInTenant("tenant_a", uuid, inter.DeviceMetadata{Name: "Diagnostics", SerialNumber: "sn-diagnostics-repo"}); err != nil {
+		t.Fatalf("InitDeviceInTenant failed: %v", err)
+	}
+	if _, err := repo.GetDeviceDiagnosticsByTenant("tenant_a", uuid); err != inter.ErrDeviceDiagnosticsNotFound {
+		t.Fatalf("expected ErrDeviceDiagnosticsNotFound, got %v", err)
+	}
+
+	now := time.Now().UnixMilli()
+	if err := repo.SaveDeviceDiagnostics(inter.DeviceDiagnostics{UUID: uuid, State: map[string]interface{}{"rssi": -61.0}, ObservedAt: now - 2000}, true); err != nil {
+		t.Fatalf("SaveDeviceDiagnostics failed: %v", err)
+	}
+	if err := repo.SaveDeviceDiagnostics(inter.DeviceDiagnostics{UUID: uuid, State: map[string]interface{}{"rssi": -55.0}, ObservedAt: now - 1000}, false); err != nil {
+		t.Fatalf("SaveDeviceDiagnostics failed: %v", err)
+	}
+
+	latest, err := repo.GetDeviceDiagnosticsByTenant("tenant_a", uuid)
+	if err != nil {
+		t.Fatalf("GetDeviceDiagnosticsByTenant failed: %v", err)
+	}
+	if latest.State["rssi"] != -55.0 || latest.ObservedAt != now-1000 || latest.SampledAt != now-2000 {
+		t.Fatalf("unexpected latest diagnostics: %+v", latest)
+	}
+
+	history, err := repo.QueryDeviceDiagnosticsHistoryByTenant("tenant_a", uuid, inter.DeviceDiagnosticsQuery{Start: now - 10000, End: now})
+	if err != nil {
+		t.Fatalf("QueryDeviceDiagnosticsHistoryByTenant failed: %v", err)
+	}
+	if len(history) != 1 || history[0].State["rssi"] != -61.0 {
+		t.Fatalf("only sampled heartbeats should enter history, got %+v", history)
+	}
+	if _, err := repo.GetDeviceDiagnosticsByTenant("tenant_b", uuid); err != inter.ErrDeviceDiagnosticsNotFound {
+		t.Fatalf("diagnostics must be tenant scoped, got %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const (
+	hourMs = int64(time.Hour / time.Millisecond)
+	dayMs  = 24 * hourMs
+)
+
+// finishedCommandStatuses 是可以清理的下行指令状态，排队与在途的指令不受保留期影响。
+var finishedCommandStatuses = []inter.DeviceCommandStatus{
+	inter.DeviceCommandStatusAcked,
+	inter.DeviceCommandStatusFailed,
+	inter.DeviceCommandStatusExpired,
+	inter.DeviceCommandStatusOverflow,
+	inter.DeviceCommandStatusCancelled,
+}
+
+type Repository struct {
+	db *bun.DB
+}
+
+func NewRepository(db *bun.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) ListRetentionPolicies(tenantID string) ([]inter.RetentionPolicy, error) {
+	var rows []bunrepo.RetentionPolicyRow
+	q := r.db.NewSelect().
+		Model(&rows).
+		OrderExpr("tenant_id ASC, data_class ASC")
+	if tenantID = strings.TrimSpace(tenantID); tenantID != "" {
+		q = q.Where("tenant_id = ?", tenantID)
+	}
+	if err := q.Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	out := make([]inter.RetentionPolicy, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToRetentionPolicy())
+	}
+	return out, nil
+}
+
+func (r *Repository) UpsertRetentionPolicy(policy inter.RetentionPolicy) (inter.RetentionPolicy, error) {
+	if !policy.DataClass.Valid() || policy.RetentionMs < 0 {
+		return inter.RetentionPolicy{}, inter.ErrRetentionPolicyInvalid
+	}
+	row := bunrepo.NewRetentionPolicyRow(policy)
+	_, err := r.db.NewInsert().
+		Model(row).
+		On("CONFLICT (tenant_id, data_class) DO UPDATE").
+		Set("retention_ms = EXCLUDED.retention_ms").
+		Set("updated_by = EXCLUDED.updated_by").
+		Set("updated_at = EXCLUDED.updated_at").
+		Returning("NULL").
+		Exec(context.Background())
+	if err != nil {
+		return inter.RetentionPolicy{}, err
+	}
+	return row.ToRetentionPolicy(), nil
+}
+
+func (r *Repository) DeleteRetentionPolicy(tenantID string, class inter.RetentionDataClass) (bool, error) {
+	res, err := r.db.NewDelete().
+		Model((*bunrepo.RetentionPolicyRow)(nil)).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("data_class = ?", string(class)).
+		Exec(context.Background())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *Repository) PruneRetentionBatch(class inter.RetentionDataClass, target inter.RetentionTarget, limit int) (inter.RetentionBatchResult, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	ctx := context.Background()
+	before := time.UnixMilli(target.Before).UTC()
+	switch class {
+	case inter.RetentionMetrics:
+		return r.rollupMetrics(ctx, target, limit)
+	case inter.RetentionMetricsHourly:
+		return r.rollupHourly(ctx, target, limit)
+	case inter.RetentionMetricsDaily:
+		return r.deleteBatch(ctx, (*bunrepo.MetricDailyRollupRow)(nil), r.rowKey(), target, limit, func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("bucket_ts < ?", target.Before)
+		})
+	case inter.RetentionLogs:
+		return r.deleteBatch(ctx, (*bunrepo.LogRow)(nil), "id", target, limit, func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("created_at < ?", before)
+		})
+	case inter.RetentionCommands:
+		return r.deleteBatch(ctx, (*bunrepo.DeviceCommandRow)(nil), "id", target, limit, func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("requested_at < ?", before).
+				Where("status IN (?)", bun.In(finishedCommandStatuses))
+		})
+	case inter.RetentionObservations:
+		return r.deleteBatch(ctx, (*bunrepo.ExternalObservationRow)(nil), "id", target, limit, func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("ts < ?", target.Before)
+		})
+	default:
+		return inter.RetentionBatchResult{}, fmt.Errorf("%w: unknown data class %q", inter.ErrRetentionPolicyInvalid, class)
+	}
+}
+
+// rowKey 返回没有自增主键的表用来定位一批行的系统列。
+func (r *Repository) rowKey() string {
+	if r.db.Dialect().Name() == dialect.PG {
+		return "ctid"
+	}
+	return "rowid"
+}
+
+// batchQuery 选出一批待清理行的定位列，供 DELETE 以子查询限定范围。
+func batchQuery(db bun.IDB, model interface{}, key string, target inter.RetentionTarget, limit int, filter func(*bun.SelectQuery) *bun.SelectQuery) *bun.SelectQuery {
+	q := db.NewSelect().
+		Model(model).
+		ColumnExpr(key)
+	if len(target.TenantIDs) > 0 {
+		q = q.Where("tenant_id IN (?)", bun.In(target.TenantIDs))
+	}
+	if len(target.ExcludeTenantIDs) > 0 {
+		q = q.Where("tenant_id NOT IN (?)", bun.In(target.ExcludeTenantIDs))
+	}
+	return filter(q).Limit(limit)
+}
+
+func (r *Repository) deleteBatch(ctx context.Context, model interface{}, key string, target inter.RetentionTarget, limit int, filter func(*bun.SelectQuery) *bun.SelectQuery) (inter.RetentionBatchResult, error) {
+	res, err := r.db.NewDelete().
+		Model(model).
+		Where(key+" IN (?)", batchQuery(r.db, model, key, target, limit, filter)).
+		Exec(ctx)
+	if err != nil {
+		return inter.RetentionBatchResult{}, err
+	}
+	n, err := res.RowsAffected()
+	return inter.RetentionBatchResult{Deleted: n}, err
+}
+
+// rollupMetrics 删除一批过期的原始指标，并在同一事务内把它们按小时合并进 metric_rollups_hourly。
+// 先 DELETE ... RETURNING 再汇总，并发的清理不会把同一行重复计入汇总。string 类型的指标不汇总。
+func (r *Repository) rollupMetrics(ctx context.Context, target inter.RetentionTarget, limit int) (inter.RetentionBatchResult, error) {
+	var result inter.RetentionBatchResult
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var rows []bunrepo.MetricRow
+		err := tx.NewDelete().
+			Model((*bunrepo.MetricRow)(nil)).
+			Where(r.rowKey()+" IN (?)", batchQuery(tx, (*bunrepo.MetricRow)(nil), r.rowKey(), target, limit, func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.Where("ts < ?", target.Before)
+			})).
+			Returning("*").
+			Scan(ctx, &rows)
+		if err != nil {
+			return err
+		}
+		result.Deleted = int64(len(rows))
+
+		buckets := map[bunrepo.MetricRollup]*bunrepo.MetricRollup{}
+		for _, row := range rows {
+			if row.ValueType == "string" {
+				continue
+			}
+			mergeRollup(buckets, bunrepo.MetricRollup{
+				TenantID: row.TenantID,
+				UUID:     row.UUID,
+				Name:     row.Name,
+				EntityID: row.EntityID,
+				BucketTS: inter.MetricBucketStart(row.TS, hourMs),
+				Unit:     row.Unit,
+				Count:    1,
+				Sum:      row.Value,
+				Min:      row.Value,
+				Max:      row.Value,
+			})
+		}
+		hourly := make([]bunrepo.MetricHourlyRollupRow, 0, len(buckets))
+		for _, rollup := range buckets {
+			hourly = append(hourly, bunrepo.MetricHourlyRollupRow{MetricRollup: *rollup})
+		}
+		result.RolledUp = int64(len(hourly))
+		return r.upsertRollups(ctx, tx, &hourly, len(hourly))
+	})
+	return result, err
+}
+
+// rollupHourly 删除一批过期的小时汇总，并按天合并进 metric_rollups_daily。
+func (r *Repository) rollupHourly(ctx context.Context, target inter.RetentionTarget, limit int) (inter.RetentionBatchResult, error) {
+	var result inter.RetentionBatchResult
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var rows []bunrepo.MetricHourlyRollupRow
+		err := tx.NewDelete().
+			Model((*bunrepo.MetricHourlyRollupRow)(nil)).
+			Where(r.rowKey()+" IN (?)", batchQuery(tx, (*bunrepo.MetricHourlyRollupRow)(nil), r.rowKey(), target, limit, func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.Where("bucket_ts < ?", target.Before)
+			})).
+			Returning("*").
+			Scan(ctx, &rows)
+		if err != nil {
+			return err
+		}
+		result.Deleted = int64(len(rows))
+
+		buckets := map[bunrepo.MetricRollup]*bunrepo.MetricRollup{}
+		for _, row := range rows {
+			rollup := row.MetricRollup
+			rollup.BucketTS = inter.MetricBucketStart(rollup.BucketTS, dayMs)
+			mergeRollup(buckets, rollup)
+		}
+		daily := make([]bunrepo.MetricDailyRollupRow, 0, len(buckets))
+		for _, rollup := range buckets {
+			daily = append(daily, bunrepo.MetricDailyRollupRow{MetricRollup: *rollup})
+		}
+		result.RolledUp = int64(len(daily))
+		return r.upsertRollups(ctx, tx, &daily, len(daily))
+	})
+	return result, err
+}
+
+// mergeRollup 按汇总行的主键合并，键只取主键列。
+func mergeRollup(buckets map[bunrepo.MetricRollup]*bunrepo.MetricRollup, rollup bunrepo.MetricRollup) {
+	key := bunrepo.MetricRollup{TenantID: rollup.TenantID, UUID: rollup.UUID, Name: rollup.Name, EntityID: rollup.EntityID, BucketTS: rollup.BucketTS}
+	if existing, ok := buckets[key]; ok {
+		existing.Merge(rollup)
+		return
+	}
+	buckets[key] = &rollup
+}
+
+// upsertRollups 把汇总行合并进已有的桶；两种方言取较小/较大值的标量函数不同。
+func (r *Repository) upsertRollups(ctx context.Context, tx bun.Tx, rows interface{}, n int) error {
+	if n == 0 {
+		return nil
+	}
+	least, greatest := "MIN", "MAX"
+	if r.db.Dialect().Name() == dialect.PG {
+		least, greatest = "LEAST", "GREATEST"
+	}
+	_, err := tx.NewInsert().
+		Model(rows).
+		On("CONFLICT (tenant_id, uuid, name, entity_id, bucket_ts) DO UPDATE").
+		Set("unit = COALESCE(NULLIF(EXCLUDED.unit, ''), ?TableAlias.unit)").
+		Set("value_count = ?TableAlias.value_count + EXCLUDED.value_count").
+		Set("value_sum = ?TableAlias.value_sum + EXCLUDED.value_sum").
+		Set("value_min = " + least + "(?TableAlias.value_min, EXCLUDED.value_min)").
+		Set("value_max = " + greatest + "(?TableAlias.value_max, EXCLUDED.value_max)").
+		Returning("NULL").
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,187 @@
+package retention_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+	"github.com/nhirsama/Goster-IoT/src/storage/retention"
+)
+
+func TestRepositoryRetentionPolicies(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "retention_policy.db")
+	repo := retention.NewRepository(base.DB)
+
+	if _, err := repo.UpsertRetentionPolicy(inter.RetentionPolicy{TenantID: "tenant_a", DataClass: "bogus"}); !errors.Is(err, inter.ErrRetentionPolicyInvalid) {
+		t.Fatalf("expected invalid class, got %v", err)
+	}
+	for _, ms := range []int64{1000, 2000} {
+		if _, err := repo.UpsertRetentionPolicy(inter.RetentionPolicy{TenantID: "tenant_a", DataClass: inter.RetentionLogs, RetentionMs: ms, UpdatedBy: "alice"}); err != nil {
+			t.Fatalf("UpsertRetentionPolicy failed: %v", err)
+		}
+	}
+	if _, err := repo.UpsertRetentionPolicy(inter.RetentionPolicy{TenantID: "tenant_b", DataClass: inter.RetentionMetrics, RetentionMs: 5000}); err != nil {
+		t.Fatalf("UpsertRetentionPolicy failed: %v", err)
+	}
+
+	policies, err := repo.ListRetentionPolicies("tenant_a")
+	if err != nil || len(policies) != 1 || policies[0].RetentionMs != 2000 || policies[0].Source != inter.RetentionSourceTenant || policies[0].UpdatedBy != "alice" {
+		t.Fatalf("unexpected tenant policies: %+v err=%v", policies, err)
+	}
+	if all, err := repo.ListRetentionPolicies(""); err != nil || len(all) != 2 {
+		t.Fatalf("expected policies of all tenants, got %+v err=%v", all, err)
+	}
+	if ok, err := repo.DeleteRetentionPolicy("tenant_a", inter.RetentionLogs); err != nil || !ok {
+		t.Fatalf("DeleteRetentionPolicy failed: ok=%v err=%v", ok, err)
+	}
+	if ok, _ := repo.DeleteRetentionPolicy("tenant_a", inter.RetentionLogs); ok {
+		t.Fatal("expected second delete to report nothing removed")
+	}
+}
+
+func TestRepositoryPruneRollsUpMetrics(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "retention_metrics.db")
+	repo := retention.NewRepository(base.DB)
+	ctx := context.Background()
+
+	const hour = int64(time.Hour / time.Millisecond)
+	day := 24 * hour
+	rows := []bunrepo.MetricRow{
+		{TenantID: "tenant_a", UUID: "dev-a", Name: "temperature", Unit: "°C", TS: 10, Value: 20, ValueType: "number"},
+		{TenantID: "tenant_a", UUID: "dev-a", Name: "temperature", Unit: "°C", TS: 20, Value: 30, ValueType: "number"},
+		{TenantID: "tenant_a", UUID: "dev-a", Name: "temperature", Unit: "°C", TS: hour + 5, Value: 10, ValueType: "number"},
+		{TenantID: "tenant_a", UUID: "dev-a", Name: "status", TS: 30, ValueType: "string", ValueText: "ok"},
+		{TenantID: "tenant_a", UUID: "dev-a", Name: "temperature", Unit: "°C", TS: day + 1, Value: 99, ValueType: "number"},
+		{TenantID: "tenant_b", UUID: "dev-b", Name: "temperature", Unit: "°C", TS: 10, Value: 1, ValueType: "number"},
+	}
+	if _, err := base.DB.NewInsert().Model(&rows).Exec(ctx); err != nil {
+		t.Fatalf("insert metrics failed: %v", err)
+	}
+
+	// 分两批清理 tenant_a 的原始指标，小时桶跨批次累加。
+	target := inter.RetentionTarget{Before: day, TenantIDs: []string{"tenant_a"}}
+	var deleted int64
+	for {
+		res, err := repo.PruneRetentionBatch(inter.RetentionMetrics, target, 2)
+		if err != nil {
+			t.Fatalf("PruneRetentionBatch metrics failed: %v", err)
+		}
+		deleted += res.Deleted
+		if res.Deleted < 2 {
+			break
+		}
+	}
+	if deleted != 4 {
+		t.Fatalf("expected 4 raw metrics pruned, got %d", deleted)
+	}
+	remaining, err := base.DB.NewSelect().Model((*bunrepo.MetricRow)(nil)).Count(ctx)
+	if err != nil || remaining != 2 {
+		t.Fatalf("expected newer and other-tenant metrics kept, got %d err=%v", remaining, err)
+	}
+
+	var hourly []bunrepo.MetricHourlyRollupRow
+	if err := base.DB.NewSelect().Model(&hourly).OrderExpr("bucket_ts ASC").Scan(ctx); err != nil {
+		t.Fatalf("select hourly rollups failed: %v", err)
+	}
+	if len(hourly) != 2 {
+		t.Fatalf("expected two hourly buckets without string metrics, got %+v", hourly)
+	}
+	first := hourly[0].MetricRollup
+	if first.BucketTS != 0 || first.Count != 2 || first.Sum != 50 || first.Min != 20 || first.Max != 30 || first.Unit != "°C" {
+		t.Fatalf("unexpected first hourly bucket: %+v", first)
+	}
+
+	// 小时汇总再合并进天汇总，已存在的天桶按计数累加。
+	existing := bunrepo.MetricDailyRollupRow{MetricRollup: bunrepo.MetricRollup{TenantID: "tenant_a", UUID: "dev-a", Name: "temperature", BucketTS: 0, Count: 1, Sum: 5, Min: 5, Max: 5}}
+	if _, err := base.DB.NewInsert().Model(&existing).Exec(ctx); err != nil {
+		t.Fatalf("insert daily rollup failed: %v", err)
+	}
+	res, err := repo.PruneRetentionBatch(inter.RetentionMetricsHourly, inter.RetentionTarget{Before: day}, 100)
+	if err != nil || res.Deleted != 2 || res.RolledUp != 1 {
+		t.Fatalf("unexpected hourly prune result: %+v err=%v", res, err)
+	}
+	var daily bunrepo.MetricDailyRollupRow
+	if err := base.DB.NewSelect().Model(&daily).Where("bucket_ts = 0").Scan(ctx); err != nil {
+		t.Fatalf("select daily rollup failed: %v", err)
+	}
+	if daily.Count != 4 || daily.Sum != 65 || daily.Min != 5 || daily.Max != 30 || daily.Unit != "°C" {
+		t.Fatalf("unexpected daily rollup: %+v", daily.MetricRollup)
+	}
+
+	res, err = repo.PruneRetentionBatch(inter.RetentionMetricsDaily, inter.RetentionTarget{Before: day, ExcludeTenantIDs: []string{"tenant_a"}}, 100)
+	if err != nil || res.Deleted != 0 {
+		t.Fatalf("expected excluded tenant daily rollups kept, got %+v err=%v", res, err)
+	}
+	res, err = repo.PruneRetentionBatch(inter.RetentionMetricsDaily, inter.RetentionTarget{Before: day}, 100)
+	if err != nil || res.Deleted != 1 {
+		t.Fatalf("expected daily rollup pruned, got %+v err=%v", res, err)
+	}
+}
+
+func TestRepositoryPruneRollsUpMetricsPerEntity(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "retention_metric_entities.db")
+	repo := retention.NewRepository(base.DB)
+	ctx := context.Background()
+
+	rows := []bunrepo.MetricRow{
+		{TenantID: "tenant_a", UUID: "dev-a", Name: "temperature", EntityID: "room", TS: 10, Value: 20, ValueType: "number"},
+		{TenantID: "tenant_a", UUID: "dev-a", Name: "temperature", EntityID: "hall", TS: 20, Value: 30, ValueType: "number"},
+		{TenantID: "tenant_a", UUID: "dev-a", Name: "temperature", EntityID: "room", TS: 30, Value: 40, ValueType: "number"},
+	}
+	if _, err := base.DB.NewInsert().Model(&rows).Exec(ctx); err != nil {
+		t.Fatalf("insert metrics failed: %v", err)
+	}
+	if _, err := repo.PruneRetentionBatch(inter.RetentionMetrics, inter.RetentionTarget{Before: 100}, 100); err != nil {
+		t.Fatalf("PruneRetentionBatch metrics failed: %v", err)
+	}
+
+	// 同名指标的不同实体各自汇总，不会合并进同一行。
+	var hourly []bunrepo.MetricHourlyRollupRow
+	if err := base.DB.NewSelect().Model(&hourly).OrderExpr("entity_id ASC").Scan(ctx); err != nil {
+		t.Fatalf("select hourly rollups failed: %v", err)
+	}
+	if len(hourly) != 2 || hourly[0].EntityID != "hall" || hourly[0].Count != 1 || hourly[1].EntityID != "room" || hourly[1].Count != 2 || hourly[1].Sum != 60 {
+		t.Fatalf("expected per-entity hourly rollups, got %+v", hourly)
+	}
+}
+
+func TestRepositoryPruneLogsAndFinishedCommands(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "retention_rows.db")
+	repo := retention.NewRepository(base.DB)
+	ctx := context.Background()
+
+	old := time.Now().Add(-48 * time.Hour).UTC()
+	logs := []bunrepo.LogRow{
+		{TenantID: "tenant_a", UUID: "dev-a", Level: "info", Message: "old", CreatedAt: old},
+		{TenantID: "tenant_a", UUID: "dev-a", Level: "info", Message: "new", CreatedAt: time.Now().UTC()},
+	}
+	if _, err := base.DB.NewInsert().Model(&logs).Exec(ctx); err != nil {
+		t.Fatalf("insert logs failed: %v", err)
+	}
+	commands := []bunrepo.DeviceCommandRow{
+		{TenantID: "tenant_a", UUID: "dev-a", Command: "reboot", Status: string(inter.DeviceCommandStatusAcked), RequestedAt: old},
+		{TenantID: "tenant_a", UUID: "dev-a", Command: "reboot", Status: string(inter.DeviceCommandStatusQueued), RequestedAt: old},
+	}
+	if _, err := base.DB.NewInsert().Model(&commands).Exec(ctx); err != nil {
+		t.Fatalf("insert commands failed: %v", err)
+	}
+
+	before := time.Now().Add(-24 * time.Hour).UnixMilli()
+	if res, err := repo.PruneRetentionBatch(inter.RetentionLogs, inter.RetentionTarget{Before: before}, 10); err != nil || res.Deleted != 1 {
+		t.Fatalf("expected one old log pruned, got %+v err=%v", res, err)
+	}
+	if res, err := repo.PruneRetentionBatch(inter.RetentionCommands, inter.RetentionTarget{Before: before}, 10); err != nil || res.Deleted != 1 {
+		t.Fatalf("expected only the finished command pruned, got %+v err=%v", res, err)
+	}
+	var left bunrepo.DeviceCommandRow
+	if err := base.DB.NewSelect().Model(&left).Scan(ctx); err != nil || left.Status != string(inter.DeviceCommandStatusQueued) {
+		t.Fatalf("expected queued command kept, got %+v err=%v", left, err)
+	}
+	if res, err := repo.PruneRetentionBatch(inter.RetentionObservations, inter.RetentionTarget{Before: before}, 10); err != nil || res.Deleted != 0 {
+		t.Fatalf("unexpected observations prune: %+v err=%v", res, err)
+	}
+}
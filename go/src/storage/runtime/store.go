@@ -1,13 +1,26 @@
 package runtime
 
 import (
+	"time"
+
 	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/nhirsama/Goster-IoT/src/storage/command"
+	"github.com/nhirsama/Goster-IoT/src/storage/credential"
 	"github.com/nhirsama/Goster-IoT/src/storage/device"
+	"github.com/nhirsama/Goster-IoT/src/storage/deviceconfig"
 	"github.com/nhirsama/Goster-IoT/src/storage/external"
+	"github.com/nhirsama/Goster-IoT/src/storage/group"
+	"github.com/nhirsama/Goster-IoT/src/storage/ingest"
 	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/nhirsama/Goster-IoT/src/storage/ota"
+	"github.com/nhirsama/Goster-IoT/src/storage/presence"
+	"github.com/nhirsama/Goster-IoT/src/storage/retention"
+	"github.com/nhirsama/Goster-IoT/src/storage/schedule"
+	"github.com/nhirsama/Goster-IoT/src/storage/shadow"
+	"github.com/nhirsama/Goster-IoT/src/storage/state"
 	"github.com/nhirsama/Goster-IoT/src/storage/telemetry"
 	"github.com/nhirsama/Goster-IoT/src/storage/tenant"
+	"github.com/nhirsama/Goster-IoT/src/storage/topology"
 	"github.com/nhirsama/Goster-IoT/src/storage/user"
 )
 
@@ -19,23 +32,49 @@ type Store struct {
 	*device.Repository
 	telemetryRepo *telemetry.Repository
 	commandRepo   *command.Repository
+	scheduleRepo  *schedule.Repository
+	groupRepo     *group.Repository
+	otaRepo       *ota.Repository
+	configRepo    *deviceconfig.Repository
 	externalRepo  *external.Repository
+	stateRepo     *state.Repository
+	shadowRepo    *shadow.Repository
+	presenceRepo  *presence.Repository
+	topologyRepo  *topology.Repository
+	dedupeRepo    *ingest.Repository
+	ingressRepo   *credential.Repository
+	retentionRepo *retention.Repository
 	userRepo      *user.Repository
 	tenantRepo    *tenant.Repository
 }
 
 var (
-	_ inter.DeviceRepository         = (*Store)(nil)
-	_ inter.ScopedDeviceRepository   = (*Store)(nil)
-	_ inter.MetricsRepository        = (*Store)(nil)
-	_ inter.DeviceLogRepository      = (*Store)(nil)
-	_ inter.DeviceCommandRepository  = (*Store)(nil)
-	_ inter.ExternalEntityRepository = (*Store)(nil)
-	_ inter.UserRepository           = (*Store)(nil)
-	_ inter.TenantRoleRepository     = (*Store)(nil)
-	_ inter.TenantRepository         = (*Store)(nil)
-	_ inter.CoreStore                = (*Store)(nil)
-	_ inter.WebV1Store               = (*Store)(nil)
+	_ inter.DeviceRepository             = (*Store)(nil)
+	_ inter.ScopedDeviceRepository       = (*Store)(nil)
+	_ inter.MetricsRepository            = (*Store)(nil)
+	_ inter.DeviceLogRepository          = (*Store)(nil)
+	_ inter.DeviceCommandRepository      = (*Store)(nil)
+	_ inter.DeviceCommandQueueRepository = (*Store)(nil)
+	_ inter.CommandScheduleRepository    = (*Store)(nil)
+	_ inter.CommandBatchRepository       = (*Store)(nil)
+	_ inter.DeviceGroupRepository        = (*Store)(nil)
+	_ inter.OtaRepository                = (*Store)(nil)
+	_ inter.DeviceConfigRepository       = (*Store)(nil)
+	_ inter.ExternalEntityRepository     = (*Store)(nil)
+	_ inter.ExternalCommandRepository    = (*Store)(nil)
+	_ inter.DeviceStateRepository        = (*Store)(nil)
+	_ inter.DeviceShadowRepository       = (*Store)(nil)
+	_ inter.DeviceConnectivityRepository = (*Store)(nil)
+	_ inter.DeviceDiagnosticsRepository  = (*Store)(nil)
+	_ inter.DeviceTopologyRepository     = (*Store)(nil)
+	_ inter.IngestDedupeRepository       = (*Store)(nil)
+	_ inter.IngressCredentialRepository  = (*Store)(nil)
+	_ inter.RetentionRepository          = (*Store)(nil)
+	_ inter.UserRepository               = (*Store)(nil)
+	_ inter.TenantRoleRepository         = (*Store)(nil)
+	_ inter.TenantRepository             = (*Store)(nil)
+	_ inter.CoreStore                    = (*Store)(nil)
+	_ inter.WebV1Store                   = (*Store)(nil)
 )
 
 func OpenSQLite(path string) (*Store, error) {
@@ -59,6 +98,11 @@ func newStore(base *bunrepo.Store) *Store {
 	telemetryRepo := telemetry.NewWithDevice(base.DB, deviceRepo)
 	commandRepo := command.NewRepository(base.DB, deviceRepo)
 	externalRepo := external.NewRepository(base.DB)
+	stateRepo := state.NewRepository(base.DB, deviceRepo)
+	shadowRepo := shadow.NewRepository(base.DB, deviceRepo)
+	presenceRepo := presence.NewRepository(base.DB, deviceRepo)
+	topologyRepo := topology.NewRepository(base.DB)
+	dedupeRepo := ingest.NewRepository(base.DB)
 	userRepo := user.NewRepository(base.DB)
 	tenantRepo := tenant.NewRepository(base.DB)
 	return &Store{
@@ -66,7 +110,18 @@ func newStore(base *bunrepo.Store) *Store {
 		Repository:    deviceRepo,
 		telemetryRepo: telemetryRepo,
 		commandRepo:   commandRepo,
+		scheduleRepo:  schedule.NewRepository(base.DB),
+		groupRepo:     group.NewRepository(base.DB),
+		otaRepo:       ota.NewRepository(base.DB),
+		configRepo:    deviceconfig.NewRepository(base.DB),
 		externalRepo:  externalRepo,
+		stateRepo:     stateRepo,
+		shadowRepo:    shadowRepo,
+		presenceRepo:  presenceRepo,
+		topologyRepo:  topologyRepo,
+		dedupeRepo:    dedupeRepo,
+		ingressRepo:   credential.NewRepository(base.DB),
+		retentionRepo: retention.NewRepository(base.DB),
 		userRepo:      userRepo,
 		tenantRepo:    tenantRepo,
 	}
@@ -95,6 +150,22 @@ func (s *Store) QueryMetricsByTenant(tenantID, uuid string, start, end int64) ([
 	return s.telemetryRepo.QueryMetricsByTenant(tenantID, uuid, start, end)
 }
 
+func (s *Store) QueryMetricSeries(tenantID, uuid string, query inter.MetricQuery) ([]inter.MetricPoint, error) {
+	return s.telemetryRepo.QueryMetricSeries(tenantID, uuid, query)
+}
+
+func (s *Store) AggregateMetricSeries(tenantID, uuid string, query inter.MetricAggregateQuery) ([]inter.MetricSeries, error) {
+	return s.telemetryRepo.AggregateMetricSeries(tenantID, uuid, query)
+}
+
+func (s *Store) LatestMetrics(tenantID string, uuids []string) (map[string][]inter.MetricPoint, error) {
+	return s.telemetryRepo.LatestMetrics(tenantID, uuids)
+}
+
+func (s *Store) RecentMetricDevices(since int64, limit int) ([]string, error) {
+	return s.telemetryRepo.RecentMetricDevices(since, limit)
+}
+
 func (s *Store) WriteLog(uuid string, level string, message string) error {
 	return s.telemetryRepo.WriteLog(uuid, level, message)
 }
@@ -111,6 +182,238 @@ func (s *Store) UpdateDeviceCommandStatus(commandID int64, status inter.DeviceCo
 	return s.commandRepo.UpdateDeviceCommandStatus(commandID, status, errorText)
 }
 
+func (s *Store) CreateDeviceCommandWithPolicy(tenantID, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte, policy inter.DeviceCommandPolicy) (int64, error) {
+	return s.commandRepo.CreateDeviceCommandWithPolicy(tenantID, uuid, cmdID, command, payloadJSON, policy)
+}
+
+func (s *Store) GetDeviceCommand(commandID int64) (inter.DeviceCommand, error) {
+	return s.commandRepo.GetDeviceCommand(commandID)
+}
+
+func (s *Store) MarkDeviceCommandSent(commandID int64, sentAt time.Time, ackDeadline *time.Time, via inter.CommandDelivery) error {
+	return s.commandRepo.MarkDeviceCommandSent(commandID, sentAt, ackDeadline, via)
+}
+
+func (s *Store) GetDeviceCommandByTenant(tenantID string, commandID int64) (inter.DeviceCommand, error) {
+	return s.commandRepo.GetDeviceCommandByTenant(tenantID, commandID)
+}
+
+func (s *Store) ListDeviceCommandsByTenant(tenantID, uuid string, query inter.DeviceCommandQuery) ([]inter.DeviceCommand, error) {
+	return s.commandRepo.ListDeviceCommandsByTenant(tenantID, uuid, query)
+}
+
+func (s *Store) SupersedeDeviceCommands(uuid, command, key string, newerID int64) ([]int64, error) {
+	return s.commandRepo.SupersedeDeviceCommands(uuid, command, key, newerID)
+}
+
+func (s *Store) CreateCommandSchedule(item inter.CommandSchedule) (int64, error) {
+	return s.scheduleRepo.CreateCommandSchedule(item)
+}
+
+func (s *Store) GetCommandSchedule(tenantID string, id int64) (inter.CommandSchedule, error) {
+	return s.scheduleRepo.GetCommandSchedule(tenantID, id)
+}
+
+func (s *Store) ListCommandSchedules(tenantID, uuid string) ([]inter.CommandSchedule, error) {
+	return s.scheduleRepo.ListCommandSchedules(tenantID, uuid)
+}
+
+func (s *Store) UpdateCommandSchedule(item inter.CommandSchedule) error {
+	return s.scheduleRepo.UpdateCommandSchedule(item)
+}
+
+func (s *Store) DeleteCommandSchedule(tenantID string, id int64) error {
+	return s.scheduleRepo.DeleteCommandSchedule(tenantID, id)
+}
+
+func (s *Store) ListDueCommandSchedules(now time.Time, limit int) ([]inter.CommandSchedule, error) {
+	return s.scheduleRepo.ListDueCommandSchedules(now, limit)
+}
+
+func (s *Store) ClaimCommandScheduleRun(id, revision int64, ranAt time.Time, next *time.Time) (bool, error) {
+	return s.scheduleRepo.ClaimCommandScheduleRun(id, revision, ranAt, next)
+}
+
+func (s *Store) RecordCommandScheduleResult(id int64, errorText string) error {
+	return s.scheduleRepo.RecordCommandScheduleResult(id, errorText)
+}
+
+func (s *Store) CreateCommandBatch(batch inter.CommandBatch) (int64, error) {
+	return s.commandRepo.CreateCommandBatch(batch)
+}
+
+func (s *Store) AddCommandBatchItem(batchID int64, item inter.CommandBatchItem) error {
+	return s.commandRepo.AddCommandBatchItem(batchID, item)
+}
+
+func (s *Store) ListUnfinishedCommandBatches() ([]inter.CommandBatch, error) {
+	return s.commandRepo.ListUnfinishedCommandBatches()
+}
+
+func (s *Store) GetCommandBatch(tenantID string, id int64) (inter.CommandBatch, error) {
+	return s.commandRepo.GetCommandBatch(tenantID, id)
+}
+
+func (s *Store) ListCommandBatches(tenantID string, limit int) ([]inter.CommandBatch, error) {
+	return s.commandRepo.ListCommandBatches(tenantID, limit)
+}
+
+func (s *Store) CreateDeviceGroup(item inter.DeviceGroup) (inter.DeviceGroup, error) {
+	return s.groupRepo.CreateDeviceGroup(item)
+}
+
+func (s *Store) GetDeviceGroup(tenantID, groupID string) (inter.DeviceGroup, error) {
+	return s.groupRepo.GetDeviceGroup(tenantID, groupID)
+}
+
+func (s *Store) ListDeviceGroups(tenantID string, page, size int) ([]inter.DeviceGroup, int, error) {
+	return s.groupRepo.ListDeviceGroups(tenantID, page, size)
+}
+
+func (s *Store) UpdateDeviceGroup(item inter.DeviceGroup) (inter.DeviceGroup, error) {
+	return s.groupRepo.UpdateDeviceGroup(item)
+}
+
+func (s *Store) DeleteDeviceGroup(tenantID, groupID string) error {
+	return s.groupRepo.DeleteDeviceGroup(tenantID, groupID)
+}
+
+func (s *Store) AddGroupDevice(groupID, uuid string) error {
+	return s.groupRepo.AddGroupDevice(groupID, uuid)
+}
+
+func (s *Store) RemoveGroupDevice(groupID, uuid string) error {
+	return s.groupRepo.RemoveGroupDevice(groupID, uuid)
+}
+
+func (s *Store) ListGroupDevices(groupID string, page, size int) ([]inter.DeviceRecord, error) {
+	return s.groupRepo.ListGroupDevices(groupID, page, size)
+}
+
+func (s *Store) CreateFirmwareArtifact(artifact inter.FirmwareArtifact) (inter.FirmwareArtifact, error) {
+	return s.otaRepo.CreateFirmwareArtifact(artifact)
+}
+
+func (s *Store) GetFirmwareArtifact(tenantID, id string) (inter.FirmwareArtifact, error) {
+	return s.otaRepo.GetFirmwareArtifact(tenantID, id)
+}
+
+func (s *Store) ListFirmwareArtifacts(tenantID string, limit int) ([]inter.FirmwareArtifact, error) {
+	return s.otaRepo.ListFirmwareArtifacts(tenantID, limit)
+}
+
+func (s *Store) DeleteFirmwareArtifact(tenantID, id string) error {
+	return s.otaRepo.DeleteFirmwareArtifact(tenantID, id)
+}
+
+func (s *Store) ReadFirmwareChunk(id string, offset int64, length int) ([]byte, error) {
+	return s.otaRepo.ReadFirmwareChunk(id, offset, length)
+}
+
+func (s *Store) CreateOtaCampaign(campaign inter.OtaCampaign, devices []inter.OtaDevice) (int64, error) {
+	return s.otaRepo.CreateOtaCampaign(campaign, devices)
+}
+
+func (s *Store) GetOtaCampaign(tenantID string, id int64) (inter.OtaCampaign, error) {
+	return s.otaRepo.GetOtaCampaign(tenantID, id)
+}
+
+func (s *Store) ListOtaCampaigns(tenantID string, limit int) ([]inter.OtaCampaign, error) {
+	return s.otaRepo.ListOtaCampaigns(tenantID, limit)
+}
+
+func (s *Store) ListActiveOtaCampaigns() ([]inter.OtaCampaign, error) {
+	return s.otaRepo.ListActiveOtaCampaigns()
+}
+
+func (s *Store) UpdateOtaCampaignState(id int64, status inter.OtaCampaignStatus, rolloutPercent int) error {
+	return s.otaRepo.UpdateOtaCampaignState(id, status, rolloutPercent)
+}
+
+func (s *Store) ListOtaDevices(campaignID int64) ([]inter.OtaDevice, error) {
+	return s.otaRepo.ListOtaDevices(campaignID)
+}
+
+func (s *Store) UpdateOtaDevice(device inter.OtaDevice, expectedRevision int64) (bool, error) {
+	return s.otaRepo.UpdateOtaDevice(device, expectedRevision)
+}
+
+func (s *Store) CreateConfigDocument(doc inter.ConfigDocument) (inter.ConfigDocument, error) {
+	return s.configRepo.CreateConfigDocument(doc)
+}
+
+func (s *Store) GetConfigDocument(tenantID string, scopeType inter.ConfigScopeType, scopeID string, version int64) (inter.ConfigDocument, error) {
+	return s.configRepo.GetConfigDocument(tenantID, scopeType, scopeID, version)
+}
+
+func (s *Store) ListConfigDocuments(tenantID string, scopeType inter.ConfigScopeType, scopeID string, limit int) ([]inter.ConfigDocument, error) {
+	return s.configRepo.ListConfigDocuments(tenantID, scopeType, scopeID, limit)
+}
+
+func (s *Store) ListDeviceConfigLayers(tenantID, uuid string) ([]inter.ConfigDocument, error) {
+	return s.configRepo.ListDeviceConfigLayers(tenantID, uuid)
+}
+
+func (s *Store) GetDeviceConfigState(uuid string) (inter.DeviceConfigState, error) {
+	return s.configRepo.GetDeviceConfigState(uuid)
+}
+
+func (s *Store) SaveDeviceConfigState(state inter.DeviceConfigState) error {
+	return s.configRepo.SaveDeviceConfigState(state)
+}
+
+func (s *Store) RecordDeviceConfigAck(ack inter.DeviceConfigAck) error {
+	return s.configRepo.RecordDeviceConfigAck(ack)
+}
+
+func (s *Store) ListDeviceConfigAcks(tenantID, uuid string, limit int) ([]inter.DeviceConfigAck, error) {
+	return s.configRepo.ListDeviceConfigAcks(tenantID, uuid, limit)
+}
+
+func (s *Store) ListRetentionPolicies(tenantID string) ([]inter.RetentionPolicy, error) {
+	return s.retentionRepo.ListRetentionPolicies(tenantID)
+}
+
+func (s *Store) UpsertRetentionPolicy(policy inter.RetentionPolicy) (inter.RetentionPolicy, error) {
+	return s.retentionRepo.UpsertRetentionPolicy(policy)
+}
+
+func (s *Store) DeleteRetentionPolicy(tenantID string, class inter.RetentionDataClass) (bool, error) {
+	return s.retentionRepo.DeleteRetentionPolicy(tenantID, class)
+}
+
+func (s *Store) PruneRetentionBatch(class inter.RetentionDataClass, target inter.RetentionTarget, limit int) (inter.RetentionBatchResult, error) {
+	return s.retentionRepo.PruneRetentionBatch(class, target, limit)
+}
+
+func (s *Store) ListStaleDeviceCommands(now time.Time, limit int) ([]inter.DeviceCommand, error) {
+	return s.commandRepo.ListStaleDeviceCommands(now, limit)
+}
+
+func (s *Store) TransitionDeviceCommandStatus(commandID int64, from, to inter.DeviceCommandStatus, errorText string) (bool, error) {
+	return s.commandRepo.TransitionDeviceCommandStatus(commandID, from, to, errorText)
+}
+
+func (s *Store) TrimDeviceCommandQueue(uuid string, capacity int, claimedBefore time.Time) ([]int64, error) {
+	return s.commandRepo.TrimDeviceCommandQueue(uuid, capacity, claimedBefore)
+}
+
+func (s *Store) RequeueDeviceCommandFront(uuid string, commandID int64, capacity int, claimedBefore time.Time) ([]int64, error) {
+	return s.commandRepo.RequeueDeviceCommandFront(uuid, commandID, capacity, claimedBefore)
+}
+
+func (s *Store) RenewDeviceCommandClaims(commandIDs []int64, now time.Time) error {
+	return s.commandRepo.RenewDeviceCommandClaims(commandIDs, now)
+}
+
+func (s *Store) ClaimNextDeviceCommand(uuid string, now, claimedBefore time.Time) (inter.DeviceCommand, bool, error) {
+	return s.commandRepo.ClaimNextDeviceCommand(uuid, now, claimedBefore)
+}
+
+func (s *Store) CountQueuedDeviceCommands(uuid string, claimedBefore time.Time) (int, error) {
+	return s.commandRepo.CountQueuedDeviceCommands(uuid, claimedBefore)
+}
+
 func (s *Store) UpsertExternalEntity(entity inter.ExternalEntity) error {
 	return s.externalRepo.UpsertExternalEntity(entity)
 }
@@ -131,6 +434,150 @@ func (s *Store) QueryExternalObservations(source, entityID string, start, end in
 	return s.externalRepo.QueryExternalObservations(source, entityID, start, end, limit)
 }
 
+func (s *Store) GetExternalEntityByTenant(tenantID, source, entityID string) (inter.ExternalEntity, error) {
+	return s.externalRepo.GetExternalEntityByTenant(tenantID, source, entityID)
+}
+
+func (s *Store) ListExternalEntitiesByTenant(tenantID string, filter inter.ExternalEntityFilter, limit, offset int) ([]inter.ExternalEntity, error) {
+	return s.externalRepo.ListExternalEntitiesByTenant(tenantID, filter, limit, offset)
+}
+
+func (s *Store) QueryExternalObservationsByTenant(tenantID, source, entityID string, start, end int64, limit int) ([]inter.ExternalObservation, error) {
+	return s.externalRepo.QueryExternalObservationsByTenant(tenantID, source, entityID, start, end, limit)
+}
+
+func (s *Store) UpdateExternalEntityLink(tenantID, source, entityID, gosterUUID string) error {
+	return s.externalRepo.UpdateExternalEntityLink(tenantID, source, entityID, gosterUUID)
+}
+
+func (s *Store) CreateExternalCommand(cmd inter.ExternalCommand) (inter.ExternalCommand, error) {
+	return s.externalRepo.CreateExternalCommand(cmd)
+}
+
+func (s *Store) GetExternalCommand(id int64) (inter.ExternalCommand, error) {
+	return s.externalRepo.GetExternalCommand(id)
+}
+
+func (s *Store) ListExternalCommandsByTenant(tenantID, source, entityID string, limit int) ([]inter.ExternalCommand, error) {
+	return s.externalRepo.ListExternalCommandsByTenant(tenantID, source, entityID, limit)
+}
+
+func (s *Store) RenewExternalCommandClaims(tenantID string, ids []int64) error {
+	return s.externalRepo.RenewExternalCommandClaims(tenantID, ids)
+}
+
+func (s *Store) ClaimPendingExternalCommands(tenantID, source, deviceID string, limit int) ([]inter.ExternalCommand, error) {
+	return s.externalRepo.ClaimPendingExternalCommands(tenantID, source, deviceID, limit)
+}
+
+func (s *Store) UpdateExternalCommandStatus(tenantID string, id int64, status inter.ExternalCommandStatus, errorText string) error {
+	return s.externalRepo.UpdateExternalCommandStatus(tenantID, id, status, errorText)
+}
+
+func (s *Store) UpsertDeviceStates(uuid string, states []inter.DeviceState) error {
+	return s.stateRepo.UpsertDeviceStates(uuid, states)
+}
+
+func (s *Store) ListDeviceStatesByTenant(tenantID, uuid string) ([]inter.DeviceState, error) {
+	return s.stateRepo.ListDeviceStatesByTenant(tenantID, uuid)
+}
+
+func (s *Store) QueryDeviceStateHistoryByTenant(tenantID, uuid string, query inter.DeviceStateHistoryQuery) ([]inter.DeviceState, error) {
+	return s.stateRepo.QueryDeviceStateHistoryByTenant(tenantID, uuid, query)
+}
+
+func (s *Store) GetDeviceShadow(uuid string) (inter.DeviceShadow, error) {
+	return s.shadowRepo.GetDeviceShadow(uuid)
+}
+
+func (s *Store) GetDeviceShadowByTenant(tenantID, uuid string) (inter.DeviceShadow, error) {
+	return s.shadowRepo.GetDeviceShadowByTenant(tenantID, uuid)
+}
+
+func (s *Store) SaveDeviceShadow(shadow inter.DeviceShadow, expectedVersion int64) (inter.DeviceShadow, error) {
+	return s.shadowRepo.SaveDeviceShadow(shadow, expectedVersion)
+}
+
+func (s *Store) SaveDeviceShadowReported(shadow inter.DeviceShadow, expectedReportedVersion int64) (inter.DeviceShadow, error) {
+	return s.shadowRepo.SaveDeviceShadowReported(shadow, expectedReportedVersion)
+}
+
+func (s *Store) AppendDeviceConnectivityEvent(event inter.DeviceConnectivityEvent) error {
+	return s.presenceRepo.AppendDeviceConnectivityEvent(event)
+}
+
+func (s *Store) QueryDeviceConnectivityByTenant(tenantID, uuid string, query inter.DeviceConnectivityQuery) ([]inter.DeviceConnectivityEvent, error) {
+	return s.presenceRepo.QueryDeviceConnectivityByTenant(tenantID, uuid, query)
+}
+
+func (s *Store) SaveDeviceDiagnostics(diagnostics inter.DeviceDiagnostics, appendHistory bool) error {
+	return s.presenceRepo.SaveDeviceDiagnostics(diagnostics, appendHistory)
+}
+
+func (s *Store) GetDeviceDiagnosticsByTenant(tenantID, uuid string) (inter.DeviceDiagnostics, error) {
+	return s.presenceRepo.GetDeviceDiagnosticsByTenant(tenantID, uuid)
+}
+
+func (s *Store) QueryDeviceDiagnosticsHistoryByTenant(tenantID, uuid string, query inter.DeviceDiagnosticsQuery) ([]inter.DeviceDiagnostics, error) {
+	return s.presenceRepo.QueryDeviceDiagnosticsHistoryByTenant(tenantID, uuid, query)
+}
+
+func (s *Store) UpsertDeviceTopologyNode(tenantID string, node inter.DeviceTopologyNode) error {
+	return s.topologyRepo.UpsertDeviceTopologyNode(tenantID, node)
+}
+
+func (s *Store) ReplaceDeviceChildren(tenantID, parentUUID string, children []inter.DeviceTopologyNode) error {
+	return s.topologyRepo.ReplaceDeviceChildren(tenantID, parentUUID, children)
+}
+
+func (s *Store) GetDeviceTopologyNode(tenantID, uuid string) (inter.DeviceTopologyNode, error) {
+	return s.topologyRepo.GetDeviceTopologyNode(tenantID, uuid)
+}
+
+func (s *Store) ListDeviceChildren(tenantID, parentUUID string) ([]inter.DeviceTopologyNode, error) {
+	return s.topologyRepo.ListDeviceChildren(tenantID, parentUUID)
+}
+
+func (s *Store) ReserveIngestDedupe(record inter.IngestDedupeRecord) (inter.IngestDedupeRecord, bool, error) {
+	return s.dedupeRepo.ReserveIngestDedupe(record)
+}
+
+func (s *Store) CompleteIngestDedupe(record inter.IngestDedupeRecord) error {
+	return s.dedupeRepo.CompleteIngestDedupe(record)
+}
+
+func (s *Store) ReleaseIngestDedupe(tenantID, key string) error {
+	return s.dedupeRepo.ReleaseIngestDedupe(tenantID, key)
+}
+
+func (s *Store) DeleteExpiredIngestDedupe(before int64, limit int) (int64, error) {
+	return s.dedupeRepo.DeleteExpiredIngestDedupe(before, limit)
+}
+
+func (s *Store) CreateIngressCredential(cred inter.IngressCredential, tokenHash string) error {
+	return s.ingressRepo.CreateIngressCredential(cred, tokenHash)
+}
+
+func (s *Store) GetIngressCredential(id string) (inter.IngressCredential, error) {
+	return s.ingressRepo.GetIngressCredential(id)
+}
+
+func (s *Store) GetIngressCredentialByTokenHash(tokenHash string) (inter.IngressCredential, error) {
+	return s.ingressRepo.GetIngressCredentialByTokenHash(tokenHash)
+}
+
+func (s *Store) ListIngressCredentials() ([]inter.IngressCredential, error) {
+	return s.ingressRepo.ListIngressCredentials()
+}
+
+func (s *Store) RotateIngressCredential(id, tokenHash, tokenPrefix string, rotatedAt time.Time) error {
+	return s.ingressRepo.RotateIngressCredential(id, tokenHash, tokenPrefix, rotatedAt)
+}
+
+func (s *Store) RevokeIngressCredential(id string, revokedAt time.Time) error {
+	return s.ingressRepo.RevokeIngressCredential(id, revokedAt)
+}
+
 func (s *Store) GetUserCount() (int, error) {
 	return s.userRepo.GetUserCount()
 }
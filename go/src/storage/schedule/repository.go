@@ -0,0 +1,173 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+type Repository struct {
+	db *bun.DB
+}
+
+func NewRepository(db *bun.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateCommandSchedule(schedule inter.CommandSchedule) (int64, error) {
+	now := time.Now().UTC()
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+	row := bunrepo.NewCommandScheduleRow(schedule)
+	row.ID = 0
+	if row.Command == "" {
+		return 0, errors.New("command is required")
+	}
+	if _, err := r.db.NewInsert().
+		Model(row).
+		ExcludeColumn("id", "last_run_at", "last_error", "run_count", "revision").
+		Returning("id").
+		Exec(context.Background()); err != nil {
+		return 0, err
+	}
+	return row.ID, nil
+}
+
+func (r *Repository) GetCommandSchedule(tenantID string, id int64) (inter.CommandSchedule, error) {
+	var row bunrepo.CommandScheduleRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("id = ?", id).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.CommandSchedule{}, inter.ErrCommandScheduleNotFound
+		}
+		return inter.CommandSchedule{}, err
+	}
+	return row.ToCommandSchedule(), nil
+}
+
+func (r *Repository) ListCommandSchedules(tenantID, uuid string) ([]inter.CommandSchedule, error) {
+	q := r.db.NewSelect().
+		Model((*bunrepo.CommandScheduleRow)(nil)).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID))
+	if uuid = strings.TrimSpace(uuid); uuid != "" {
+		q = q.Where("uuid = ?", uuid)
+	}
+	var rows []bunrepo.CommandScheduleRow
+	if err := q.OrderExpr("id ASC").Scan(context.Background(), &rows); err != nil {
+		return nil, err
+	}
+	return toCommandSchedules(rows), nil
+}
+
+// UpdateCommandSchedule 覆盖计划定义；revision 加一，其他实例基于旧版本的触发抢占随之失效。
+func (r *Repository) UpdateCommandSchedule(schedule inter.CommandSchedule) error {
+	schedule.UpdatedAt = time.Now().UTC()
+	row := bunrepo.NewCommandScheduleRow(schedule)
+	res, err := r.db.NewUpdate().
+		Model(row).
+		Column("name", "uuid", "command", "cmd_id", "payload_json", "command_key", "supersede",
+			"ttl_ms", "timeout_ms", "max_attempts", "execute_at", "cron_expr", "timezone",
+			"enabled", "next_run_at", "updated_at").
+		Set("revision = revision + 1").
+		Where("id = ?", row.ID).
+		Where("tenant_id = ?", row.TenantID).
+		Returning("NULL").
+		Exec(context.Background())
+	return expectAffected(res, err)
+}
+
+func (r *Repository) DeleteCommandSchedule(tenantID string, id int64) error {
+	res, err := r.db.NewDelete().
+		Model((*bunrepo.CommandScheduleRow)(nil)).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("id = ?", id).
+		Returning("NULL").
+		Exec(context.Background())
+	return expectAffected(res, err)
+}
+
+func (r *Repository) ListDueCommandSchedules(now time.Time, limit int) ([]inter.CommandSchedule, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	var rows []bunrepo.CommandScheduleRow
+	if err := r.db.NewSelect().
+		Model(&rows).
+		Where("enabled = ?", true).
+		Where("next_run_at IS NOT NULL").
+		Where("next_run_at <= ?", now.UTC()).
+		OrderExpr("next_run_at ASC, id ASC").
+		Limit(limit).
+		Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	return toCommandSchedules(rows), nil
+}
+
+// ClaimCommandScheduleRun 以 revision 做 compare-and-swap，多个 Core 实例扫描到同一计划时只有一个能抢到本次触发。
+func (r *Repository) ClaimCommandScheduleRun(id, revision int64, ranAt time.Time, next *time.Time) (bool, error) {
+	q := r.db.NewUpdate().
+		Table("command_schedules").
+		Set("revision = revision + 1").
+		Set("run_count = run_count + 1").
+		Set("last_run_at = ?", ranAt.UTC()).
+		Set("next_run_at = ?", next).
+		Where("id = ?", id).
+		Where("revision = ?", revision).
+		Where("enabled = ?", true)
+	if next == nil {
+		q = q.Set("enabled = ?", false)
+	}
+	res, err := q.Returning("NULL").Exec(context.Background())
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (r *Repository) RecordCommandScheduleResult(id int64, errorText string) error {
+	res, err := r.db.NewUpdate().
+		Table("command_schedules").
+		Set("last_error = ?", bunrepo.NullableOptionalString(errorText)).
+		Where("id = ?", id).
+		Returning("NULL").
+		Exec(context.Background())
+	return expectAffected(res, err)
+}
+
+func expectAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return inter.ErrCommandScheduleNotFound
+	}
+	return nil
+}
+
+func toCommandSchedules(rows []bunrepo.CommandScheduleRow) []inter.CommandSchedule {
+	out := make([]inter.CommandSchedule, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToCommandSchedule())
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package schedule_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+	"github.com/nhirsama/Goster-IoT/src/storage/schedule"
+)
+
+func TestRepositoryCommandScheduleCRUD(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "schedule_crud.db")
+	repo := schedule.NewRepository(base.DB)
+
+	next := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	id, err := repo.CreateCommandSchedule(inter.CommandSchedule{
+		TenantID:  "tenant_a",
+		Name:      "morning screen",
+		UUID:      "schedule-device",
+		Command:   "screen_wy",
+		CmdID:     inter.CmdScreenWy,
+		Payload:   []byte(`{"text":"hello"}`),
+		Policy:    inter.DeviceCommandPolicy{Key: "screen", Supersede: true, TTL: time.Minute},
+		Cron:      "0 8 * * *",
+		Timezone:  "Asia/Shanghai",
+		Enabled:   true,
+		NextRunAt: &next,
+	})
+	if err != nil {
+		t.Fatalf("CreateCommandSchedule failed: %v", err)
+	}
+
+	got, err := repo.GetCommandSchedule("tenant_a", id)
+	if err != nil {
+		t.Fatalf("GetCommandSchedule failed: %v", err)
+	}
+	if got.Name != "morning screen" || got.UUID != "schedule-device" || got.CmdID != inter.CmdScreenWy ||
+		string(got.Payload) != `{"text":"hello"}` || got.Policy.Key != "screen" || !got.Policy.Supersede ||
+		got.Policy.TTL != time.Minute || got.Cron != "0 8 * * *" || got.Timezone != "Asia/Shanghai" ||
+		!got.Enabled || got.NextRunAt == nil || !got.NextRunAt.Equal(next) || got.Revision != 0 {
+		t.Fatalf("unexpected schedule: %+v", got)
+	}
+	if _, err := repo.GetCommandSchedule("tenant_b", id); !errors.Is(err, inter.ErrCommandScheduleNotFound) {
+		t.Fatalf("expected not found for other tenant, got %v", err)
+	}
+
+	got.Name = "renamed"
+	got.Enabled = false
+	got.NextRunAt = nil
+	if err := repo.UpdateCommandSchedule(got); err != nil {
+		t.Fatalf("UpdateCommandSchedule failed: %v", err)
+	}
+	updated, err := repo.GetCommandSchedule("tenant_a", id)
+	if err != nil {
+		t.Fatalf("GetCommandSchedule after update failed: %v", err)
+	}
+	if updated.Name != "renamed" || updated.Enabled || updated.NextRunAt != nil || updated.Revision != 1 {
+		t.Fatalf("unexpected updated schedule: %+v", updated)
+	}
+
+	items, err := repo.ListCommandSchedules("tenant_a", "other-device")
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected empty filtered list, got %+v err=%v", items, err)
+	}
+	items, err = repo.ListCommandSchedules("tenant_a", "")
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected one schedule, got %+v err=%v", items, err)
+	}
+
+	if err := repo.DeleteCommandSchedule("tenant_b", id); !errors.Is(err, inter.ErrCommandScheduleNotFound) {
+		t.Fatalf("expected not found deleting from other tenant, got %v", err)
+	}
+	if err := repo.DeleteCommandSchedule("tenant_a", id); err != nil {
+		t.Fatalf("DeleteCommandSchedule failed: %v", err)
+	}
+	if _, err := repo.GetCommandSchedule("tenant_a", id); !errors.Is(err, inter.ErrCommandScheduleNotFound) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+}
+
+func TestRepositoryClaimCommandScheduleRunIsExclusive(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "schedule_claim.db")
+	repo := schedule.NewRepository(base.DB)
+
+	now := time.Now().UTC()
+	due := now.Add(-time.Minute)
+	id, err := repo.CreateCommandSchedule(inter.CommandSchedule{
+		Command:   "action_exec",
+		CmdID:     inter.CmdActionExec,
+		ExecuteAt: &due,
+		Timezone:  "UTC",
+		Enabled:   true,
+		NextRunAt: &due,
+	})
+	if err != nil {
+		t.Fatalf("CreateCommandSchedule failed: %v", err)
+	}
+
+	items, err := repo.ListDueCommandSchedules(now, 10)
+	if err != nil || len(items) != 1 || items[0].ID != id {
+		t.Fatalf("expected one due schedule, got %+v err=%v", items, err)
+	}
+
+	claimed, err := repo.ClaimCommandScheduleRun(id, items[0].Revision, now, nil)
+	if err != nil || !claimed {
+		t.Fatalf("expected first claim to win, claimed=%v err=%v", claimed, err)
+	}
+	claimed, err = repo.ClaimCommandScheduleRun(id, items[0].Revision, now, nil)
+	if err != nil || claimed {
+		t.Fatalf("expected stale revision claim to lose, claimed=%v err=%v", claimed, err)
+	}
+	if err := repo.RecordCommandScheduleResult(id, "boom"); err != nil {
+		t.Fatalf("RecordCommandScheduleResult failed: %v", err)
+	}
+
+	got, err := repo.GetCommandSchedule(inter.DefaultTenantID, id)
+	if err != nil {
+		t.Fatalf("GetCommandSchedule failed: %v", err)
+	}
+	if got.Enabled || got.NextRunAt != nil || got.RunCount != 1 || got.LastRunAt == nil || got.LastError != "boom" {
+		t.Fatalf("unexpected claimed schedule: %+v", got)
+	}
+	items, err = repo.ListDueCommandSchedules(now.Add(time.Hour), 10)
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected no due schedules after one-off run, got %+v err=%v", items, err)
+	}
+}
@@ -0,0 +1,115 @@
+package shadow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+type tenantResolver interface {
+	ResolveDeviceTenant(uuid string) (string, error)
+}
+
+type Repository struct {
+	db            *bun.DB
+	deviceTenants tenantResolver
+}
+
+func NewRepository(db *bun.DB, deviceTenants tenantResolver) *Repository {
+	return &Repository{db: db, deviceTenants: deviceTenants}
+}
+
+func (r *Repository) GetDeviceShadow(uuid string) (inter.DeviceShadow, error) {
+	return r.loadShadow(r.db.NewSelect().Where("uuid = ?", strings.TrimSpace(uuid)))
+}
+
+func (r *Repository) GetDeviceShadowByTenant(tenantID, uuid string) (inter.DeviceShadow, error) {
+	return r.loadShadow(r.db.NewSelect().
+		Where("uuid = ?", strings.TrimSpace(uuid)).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)))
+}
+
+func (r *Repository) loadShadow(query *bun.SelectQuery) (inter.DeviceShadow, error) {
+	var row bunrepo.DeviceShadowRow
+	err := query.Model(&row).Limit(1).Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.DeviceShadow{}, inter.ErrDeviceShadowNotFound
+		}
+		return inter.DeviceShadow{}, err
+	}
+	return row.ToDeviceShadow()
+}
+
+// SaveDeviceShadow 以 compare-and-swap 方式写入 desired。
+// expectedVersion 为 0 表示尚未写过 desired；写入成功后版本号加一，reported 部分保持不变。
+func (r *Repository) SaveDeviceShadow(shadow inter.DeviceShadow, expectedVersion int64) (inter.DeviceShadow, error) {
+	shadow.Version = expectedVersion + 1
+	return r.save(shadow, "version", expectedVersion, "desired_json", "version", "desired_updated_at")
+}
+
+// SaveDeviceShadowReported 以 compare-and-swap 方式写入 reported，只比较并递增 reported_version。
+func (r *Repository) SaveDeviceShadowReported(shadow inter.DeviceShadow, expectedReportedVersion int64) (inter.DeviceShadow, error) {
+	shadow.ReportedVersion = expectedReportedVersion + 1
+	return r.save(shadow, "reported_version", expectedReportedVersion, "reported_json", "reported_version", "reported_updated_at")
+}
+
+// save 先按版本列做条件更新；期望版本为 0 且没有命中时影子可能尚不存在，改为插入整行。
+// desired 与 reported 各自只更新自己的列，写入后重新读取以返回另一半的最新内容。
+func (r *Repository) save(shadow inter.DeviceShadow, versionColumn string, expected int64, columns ...string) (inter.DeviceShadow, error) {
+	shadow.UUID = strings.TrimSpace(shadow.UUID)
+	if shadow.UUID == "" {
+		return inter.DeviceShadow{}, errors.New("uuid is required")
+	}
+	if strings.TrimSpace(shadow.TenantID) == "" {
+		tenantID, err := r.deviceTenants.ResolveDeviceTenant(shadow.UUID)
+		if err != nil {
+			return inter.DeviceShadow{}, err
+		}
+		shadow.TenantID = tenantID
+	}
+	row, err := bunrepo.NewDeviceShadowRow(shadow)
+	if err != nil {
+		return inter.DeviceShadow{}, err
+	}
+
+	ctx := context.Background()
+	res, err := r.db.NewUpdate().
+		Model(row).
+		Column(columns...).
+		Set("updated_at = CURRENT_TIMESTAMP").
+		WherePK().
+		Where("tenant_id = ?", row.TenantID).
+		Where("? = ?", bun.Ident(versionColumn), expected).
+		Returning("NULL").
+		Exec(ctx)
+	if err != nil {
+		return inter.DeviceShadow{}, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return inter.DeviceShadow{}, err
+	}
+	if rows == 0 && expected <= 0 {
+		res, err = r.db.NewInsert().
+			Model(row).
+			On("CONFLICT (uuid) DO NOTHING").
+			Returning("NULL").
+			Exec(ctx)
+		if err != nil {
+			return inter.DeviceShadow{}, err
+		}
+		if rows, err = res.RowsAffected(); err != nil {
+			return inter.DeviceShadow{}, err
+		}
+	}
+	if rows == 0 {
+		return inter.DeviceShadow{}, inter.ErrDeviceShadowConflict
+	}
+	return r.GetDeviceShadowByTenant(row.TenantID, row.UUID)
+}
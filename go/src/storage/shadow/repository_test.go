@@ -0,0 +1,117 @@
+package shadow_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/device"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+	"github.com/nhirsama/Goster-IoT/src/storage/shadow"
+	"github.com/uptrace/bun"
+)
+
+func TestRepositoryDeviceShadowCompareAndSwap(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "shadow_repo.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := shadow.NewRepository(base.DB, deviceRepo)
+
+	uuid := "device-shadow-repo"
+	if err := deviceRepo.InitDeviceInTenant("tenant_a", uuid, inter.DeviceMetadata{Name: "Shadow", SerialNumber: "sn-shadow-repo"}); err != nil {
+		t.Fatalf("InitDeviceInTenant failed: %v", err)
+	}
+
+	if _, err := repo.GetDeviceShadow(uuid); !errors.Is(err, inter.ErrDeviceShadowNotFound) {
+		t.Fatalf("expected ErrDeviceShadowNotFound, got %v", err)
+	}
+
+	created, err := repo.SaveDeviceShadow(inter.DeviceShadow{UUID: uuid, Desired: map[string]interface{}{"mode": "eco"}}, 0)
+	if err != nil {
+		t.Fatalf("SaveDeviceShadow create failed: %v", err)
+	}
+	if created.Version != 1 || created.TenantID != "tenant_a" {
+		t.Fatalf("unexpected created shadow: %+v", created)
+	}
+	if _, err := repo.SaveDeviceShadow(inter.DeviceShadow{UUID: uuid}, 0); !errors.Is(err, inter.ErrDeviceShadowConflict) {
+		t.Fatalf("duplicate create should conflict, got %v", err)
+	}
+
+	// reported 单独计数，写入后不影响 desired 的版本比较。
+	created.Reported = map[string]interface{}{"mode": "eco"}
+	reported, err := repo.SaveDeviceShadowReported(created, 0)
+	if err != nil {
+		t.Fatalf("SaveDeviceShadowReported failed: %v", err)
+	}
+	if reported.Version != 1 || reported.ReportedVersion != 1 {
+		t.Fatalf("unexpected versions after report: %+v", reported)
+	}
+	if _, err := repo.SaveDeviceShadowReported(created, 0); !errors.Is(err, inter.ErrDeviceShadowConflict) {
+		t.Fatalf("stale report should conflict, got %v", err)
+	}
+
+	created.Desired = map[string]interface{}{"mode": "boost"}
+	created.Reported = nil
+	if _, err := repo.SaveDeviceShadow(created, 1); err != nil {
+		t.Fatalf("SaveDeviceShadow update failed: %v", err)
+	}
+	if _, err := repo.SaveDeviceShadow(created, 1); !errors.Is(err, inter.ErrDeviceShadowConflict) {
+		t.Fatalf("stale update should conflict, got %v", err)
+	}
+
+	got, err := repo.GetDeviceShadowByTenant("tenant_a", uuid)
+	if err != nil {
+		t.Fatalf("GetDeviceShadowByTenant failed: %v", err)
+	}
+	if got.Version != 2 || got.ReportedVersion != 1 || got.Reported["mode"] != "eco" || got.Desired["mode"] != "boost" {
+		t.Fatalf("unexpected shadow: %+v", got)
+	}
+	if _, err := repo.GetDeviceShadowByTenant("tenant_b", uuid); !errors.Is(err, inter.ErrDeviceShadowNotFound) {
+		t.Fatalf("shadow should be tenant scoped, got %v", err)
+	}
+}
+
+// insertAfterUpdateHook 在第一次更新 device_shadows 之后抢先插入同一影子，模拟并发的首次写入。
+type insertAfterUpdateHook struct {
+	db   *bun.DB
+	uuid string
+	done bool
+}
+
+func (h *insertAfterUpdateHook) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *insertAfterUpdateHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	if h.done || !strings.HasPrefix(event.Query, `UPDATE "device_shadows"`) {
+		return
+	}
+	h.done = true
+	_, _ = h.db.ExecContext(ctx, "INSERT INTO device_shadows (uuid, tenant_id, version) VALUES (?, ?, 1)", h.uuid, "tenant_a")
+}
+
+func TestRepositoryDeviceShadowConcurrentCreateConflicts(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "shadow_race.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := shadow.NewRepository(base.DB, deviceRepo)
+
+	uuid := "device-shadow-race"
+	if err := deviceRepo.InitDeviceInTenant("tenant_a", uuid, inter.DeviceMetadata{Name: "Shadow", SerialNumber: "sn-shadow-race"}); err != nil {
+		t.Fatalf("InitDeviceInTenant failed: %v", err)
+	}
+
+	// 条件更新未命中之后另一个写入者先插入了影子，本次插入撞上唯一约束时应返回版本冲突。
+	hook := &insertAfterUpdateHook{db: base.DB, uuid: uuid}
+	base.DB.AddQueryHook(hook)
+	if _, err := repo.SaveDeviceShadow(inter.DeviceShadow{UUID: uuid, Desired: map[string]interface{}{"mode": "eco"}}, 0); !errors.Is(err, inter.ErrDeviceShadowConflict) {
+		t.Fatalf("expected ErrDeviceShadowConflict, got %v", err)
+	}
+	if !hook.done {
+		t.Fatal("expected concurrent insert to run")
+	}
+	got, err := repo.GetDeviceShadow(uuid)
+	if err != nil || got.Version != 1 || len(got.Desired) != 0 {
+		t.Fatalf("expected the concurrent shadow kept, got %+v err=%v", got, err)
+	}
+}
@@ -0,0 +1,202 @@
+package state
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+type Repository struct {
+	db             *bun.DB
+	tenantResolver interface {
+		ResolveDeviceTenant(uuid string) (string, error)
+	}
+}
+
+func NewRepository(db *bun.DB, tenantResolver interface {
+	ResolveDeviceTenant(uuid string) (string, error)
+}) *Repository {
+	return &Repository{db: db, tenantResolver: tenantResolver}
+}
+
+// UpsertDeviceStates 刷新设备状态最新值；值发生变化时同时追加一条历史记录。
+// 时间戳早于当前最新值的乱序上报会被忽略。
+func (r *Repository) UpsertDeviceStates(uuid string, states []inter.DeviceState) error {
+	uuid = strings.TrimSpace(uuid)
+	if uuid == "" {
+		return errors.New("uuid is required")
+	}
+	if len(states) == 0 {
+		return nil
+	}
+
+	// 设备归属解析失败时不能写入默认租户，否则状态会落到错误的租户下。
+	tenantID, err := r.tenantResolver.ResolveDeviceTenant(uuid)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]*bunrepo.DeviceStateRow, 0, len(states))
+	now := time.Now().UnixMilli()
+	for _, item := range states {
+		item.UUID = uuid
+		if strings.TrimSpace(item.Name) == "" {
+			return errors.New("state name is required")
+		}
+		if item.Timestamp <= 0 {
+			item.Timestamp = now
+		}
+		row, err := bunrepo.NewDeviceStateRow(tenantID, item)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+
+	return r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		for _, row := range rows {
+			if err := upsertStateRow(ctx, tx, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func upsertStateRow(ctx context.Context, tx bun.Tx, row *bunrepo.DeviceStateRow) error {
+	var existing bunrepo.DeviceStateRow
+	err := tx.NewSelect().
+		Model(&existing).
+		Where("tenant_id = ?", row.TenantID).
+		Where("uuid = ?", row.UUID).
+		Where("name = ?", row.Name).
+		Where("entity_id = ?", row.EntityID).
+		Limit(1).
+		Scan(ctx)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if _, err := tx.NewInsert().Model(row).Returning("NULL").Exec(ctx); err != nil {
+			return err
+		}
+		return appendHistory(ctx, tx, row.HistoryRow())
+	case err != nil:
+		return err
+	}
+
+	if row.TS < existing.TS {
+		return nil
+	}
+	if row.ValueSig == existing.ValueSig {
+		_, err := tx.NewUpdate().
+			Model((*bunrepo.DeviceStateRow)(nil)).
+			Set("ts = ?", row.TS).
+			Set("endpoint = ?", row.Endpoint).
+			Set("tags_json = ?", row.TagsJSON).
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Where("id = ?", existing.ID).
+			Exec(ctx)
+		return err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*bunrepo.DeviceStateRow)(nil)).
+		Set("value_type = ?", row.ValueType).
+		Set("value_num = ?", row.ValueNum).
+		Set("value_text = ?", row.ValueText).
+		Set("value_bool = ?", row.ValueBool).
+		Set("value_json = ?", row.ValueJSON).
+		Set("unit = ?", row.Unit).
+		Set("endpoint = ?", row.Endpoint).
+		Set("tags_json = ?", row.TagsJSON).
+		Set("value_sig = ?", row.ValueSig).
+		Set("ts = ?", row.TS).
+		Set("updated_at = CURRENT_TIMESTAMP").
+		Where("id = ?", existing.ID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return appendHistory(ctx, tx, row.HistoryRow())
+}
+
+func appendHistory(ctx context.Context, tx bun.Tx, row bunrepo.DeviceStateHistoryRow) error {
+	_, err := tx.NewInsert().
+		Model(&row).
+		On("CONFLICT (tenant_id, uuid, name, entity_id, ts, value_sig) DO NOTHING").
+		Returning("NULL").
+		Exec(ctx)
+	return err
+}
+
+func (r *Repository) ListDeviceStatesByTenant(tenantID, uuid string) ([]inter.DeviceState, error) {
+	var rows []bunrepo.DeviceStateRow
+	err := r.db.NewSelect().
+		Model(&rows).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("uuid = ?", strings.TrimSpace(uuid)).
+		OrderExpr("name ASC, entity_id ASC").
+		Scan(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]inter.DeviceState, 0, len(rows))
+	for _, row := range rows {
+		item, err := row.ToDeviceState()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func (r *Repository) QueryDeviceStateHistoryByTenant(tenantID, uuid string, query inter.DeviceStateHistoryQuery) ([]inter.DeviceState, error) {
+	end := query.End
+	if end <= 0 {
+		end = time.Now().UnixMilli()
+	}
+	start := query.Start
+	if start <= 0 || start > end {
+		start = end - int64(24*time.Hour/time.Millisecond)
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	q := r.db.NewSelect().
+		Model((*bunrepo.DeviceStateHistoryRow)(nil)).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("uuid = ?", strings.TrimSpace(uuid)).
+		Where("ts BETWEEN ? AND ?", start, end).
+		OrderExpr("ts ASC, id ASC").
+		Limit(limit)
+	if name := strings.TrimSpace(query.Name); name != "" {
+		q = q.Where("name = ?", name)
+	}
+	if entityID := strings.TrimSpace(query.EntityID); entityID != "" {
+		q = q.Where("entity_id = ?", entityID)
+	}
+
+	var rows []bunrepo.DeviceStateHistoryRow
+	if err := q.Scan(context.Background(), &rows); err != nil {
+		return nil, err
+	}
+
+	out := make([]inter.DeviceState, 0, len(rows))
+	for _, row := range rows {
+		item, err := row.ToDeviceState()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
@@ -0,0 +1,79 @@
+package state_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/device"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+	"github.com/nhirsama/Goster-IoT/src/storage/state"
+)
+
+func TestRepositoryDeviceStateLatestAndHistory(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "state_repo.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := state.NewRepository(base.DB, deviceRepo)
+
+	uuid := "device-state-repo"
+	if err := deviceRepo.InitDeviceInTenant("tenant_a", uuid, inter.DeviceMetadata{Name: "State", SerialNumber: "sn-state-repo"}); err != nil {
+		t.Fatalf("InitDeviceInTenant failed: %v", err)
+	}
+
+	ts := time.Now().UnixMilli()
+	empty := ""
+	level := 42.0
+	if err := repo.UpsertDeviceStates(uuid, []inter.DeviceState{
+		{Name: "label", ValueType: "string", ValueText: &empty, Timestamp: ts},
+		{Name: "level", ValueType: "number", ValueNum: &level, Unit: "%", Tags: map[string]string{"src": "z2m"}, Timestamp: ts},
+		{Name: "color", ValueType: "json", ValueJSON: map[string]interface{}{"x": 0.5}, Timestamp: ts},
+	}); err != nil {
+		t.Fatalf("UpsertDeviceStates failed: %v", err)
+	}
+	// 重复写入同样的值不应产生新的历史记录。
+	if err := repo.UpsertDeviceStates(uuid, []inter.DeviceState{
+		{Name: "level", ValueType: "number", ValueNum: &level, Unit: "%", Timestamp: ts + 10},
+	}); err != nil {
+		t.Fatalf("UpsertDeviceStates repeat failed: %v", err)
+	}
+
+	items, err := repo.ListDeviceStatesByTenant("tenant_a", uuid)
+	if err != nil {
+		t.Fatalf("ListDeviceStatesByTenant failed: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("unexpected state count: got %d want 3", len(items))
+	}
+	if items[0].Name != "color" || items[0].ValueJSON["x"] != 0.5 {
+		t.Fatalf("unexpected json state: %+v", items[0])
+	}
+	if items[1].Name != "label" || items[1].ValueText == nil || *items[1].ValueText != "" {
+		t.Fatalf("empty string state should be preserved: %+v", items[1])
+	}
+	if items[2].Timestamp != ts+10 || items[2].Tags != nil {
+		t.Fatalf("repeat write should refresh ts and tags: %+v", items[2])
+	}
+
+	history, err := repo.QueryDeviceStateHistoryByTenant("tenant_a", uuid, inter.DeviceStateHistoryQuery{Name: "level", Start: ts - 1, End: ts + 100})
+	if err != nil {
+		t.Fatalf("QueryDeviceStateHistoryByTenant failed: %v", err)
+	}
+	if len(history) != 1 || history[0].ValueNum == nil || *history[0].ValueNum != level {
+		t.Fatalf("unexpected state history: %+v", history)
+	}
+
+	other, err := repo.ListDeviceStatesByTenant("tenant_b", uuid)
+	if err != nil {
+		t.Fatalf("ListDeviceStatesByTenant other tenant failed: %v", err)
+	}
+	if len(other) != 0 {
+		t.Fatalf("states should be tenant scoped, got %d", len(other))
+	}
+
+	if err := repo.UpsertDeviceStates("device-state-unknown", []inter.DeviceState{
+		{Name: "level", ValueType: "number", ValueNum: &level, Timestamp: ts},
+	}); !errors.Is(err, inter.ErrDeviceNotFound) {
+		t.Fatalf("expected unknown device rejected instead of default tenant, got %v", err)
+	}
+}
@@ -2,11 +2,16 @@ package telemetry
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/nhirsama/Goster-IoT/src/storage/device"
 	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
 )
 
 type Repository struct {
@@ -32,14 +37,9 @@ func (r *Repository) AppendMetric(uuid string, point inter.MetricPoint) error {
 		tenantID = bunrepo.DefaultTenantID
 	}
 
+	row := bunrepo.NewMetricRow(uuid, tenantID, point)
 	_, err = r.db.NewInsert().
-		Model(&bunrepo.MetricRow{
-			UUID:     uuid,
-			TenantID: tenantID,
-			TS:       point.Timestamp,
-			Value:    point.Value,
-			Type:     point.Type,
-		}).
+		Model(&row).
 		Returning("NULL").
 		Exec(context.Background())
 	return err
@@ -57,13 +57,7 @@ func (r *Repository) BatchAppendMetrics(uuid string, points []inter.MetricPoint)
 
 	rows := make([]bunrepo.MetricRow, 0, len(points))
 	for _, point := range points {
-		rows = append(rows, bunrepo.MetricRow{
-			UUID:     uuid,
-			TenantID: tenantID,
-			TS:       point.Timestamp,
-			Value:    point.Value,
-			Type:     point.Type,
-		})
+		rows = append(rows, bunrepo.NewMetricRow(uuid, tenantID, point))
 	}
 
 	return r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
@@ -79,7 +73,6 @@ func (r *Repository) QueryMetrics(uuid string, start, end int64) ([]inter.Metric
 	var rows []bunrepo.MetricRow
 	err := r.db.NewSelect().
 		Model(&rows).
-		Column("ts", "value", "type").
 		Where("uuid = ?", uuid).
 		Where("ts BETWEEN ? AND ?", start, end).
 		OrderExpr("ts ASC").
@@ -94,7 +87,6 @@ func (r *Repository) QueryMetricsByTenant(tenantID, uuid string, start, end int6
 	var rows []bunrepo.MetricRow
 	err := r.db.NewSelect().
 		Model(&rows).
-		Column("ts", "value", "type").
 		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
 		Where("uuid = ?", uuid).
 		Where("ts BETWEEN ? AND ?", start, end).
@@ -106,6 +98,302 @@ func (r *Repository) QueryMetricsByTenant(tenantID, uuid string, start, end int6
 	return bunrepo.ToMetricPoints(rows), nil
 }
 
+func (r *Repository) QueryMetricSeries(tenantID, uuid string, query inter.MetricQuery) ([]inter.MetricPoint, error) {
+	var rows []bunrepo.MetricRow
+	q := r.filterMetrics(r.db.NewSelect().Model(&rows), tenantID, uuid, query)
+	if err := q.OrderExpr("ts ASC").Scan(context.Background()); err != nil {
+		return nil, err
+	}
+	return bunrepo.ToMetricPoints(rows), nil
+}
+
+func (r *Repository) filterMetrics(q *bun.SelectQuery, tenantID, uuid string, query inter.MetricQuery) *bun.SelectQuery {
+	q = q.Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("uuid = ?", uuid).
+		Where("ts BETWEEN ? AND ?", query.Start, query.End)
+	if len(query.Names) > 0 {
+		q = q.Where("name IN (?)", bun.In(query.Names))
+	}
+	if entityID := strings.TrimSpace(query.EntityID); entityID != "" {
+		q = q.Where("entity_id = ?", entityID)
+	}
+	for key, value := range query.Tags {
+		q = q.Where(metricTagCondition(r.db), key, value)
+	}
+	return q
+}
+
+// metricBucketRow 是分桶聚合的一行结果。
+type metricBucketRow struct {
+	Name   string          `bun:"name"`
+	Bucket int64           `bun:"bucket"`
+	Unit   string          `bun:"unit"`
+	Count  int64           `bun:"cnt"`
+	Value  sql.NullFloat64 `bun:"value"`
+}
+
+func (r *Repository) AggregateMetricSeries(tenantID, uuid string, query inter.MetricAggregateQuery) ([]inter.MetricSeries, error) {
+	if query.BucketMs <= 0 {
+		return nil, errors.New("bucket must be positive")
+	}
+	if query.Agg == "" {
+		query.Agg = inter.MetricAggAvg
+	}
+	if query.Agg == inter.MetricAggPercentile && (query.Percentile < 0 || query.Percentile > 1) {
+		return nil, errors.New("percentile must be between 0 and 1")
+	}
+
+	if rollupAggregatable(query) {
+		return r.aggregateWithRollups(tenantID, uuid, query)
+	}
+
+	inner := r.filterMetrics(r.db.NewSelect().TableExpr("metrics"), tenantID, uuid, query.MetricQuery).
+		Column("name", "unit", "ts", "value").
+		ColumnExpr("ts - ts % ? AS bucket", query.BucketMs).
+		Where("value_type <> ?", "string")
+	valueExpr, args, err := r.metricAggregateExpr(inner, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []metricBucketRow
+	err = r.db.NewSelect().
+		TableExpr("(?) AS m", inner).
+		ColumnExpr("name, bucket, MAX(unit) AS unit, COUNT(*) AS cnt").
+		ColumnExpr(valueExpr+" AS value", args...).
+		GroupExpr("name, bucket").
+		OrderExpr("name ASC, bucket ASC").
+		Scan(context.Background(), &rows)
+	if err != nil {
+		return nil, err
+	}
+	return fillMetricSeries(rows, query), nil
+}
+
+// rollupAggregatable 判断聚合能否由汇总行的计数、和与最值合并得到；汇总不保留标签，带标签过滤时只查原始指标。
+func rollupAggregatable(query inter.MetricAggregateQuery) bool {
+	if len(query.Tags) > 0 {
+		return false
+	}
+	switch query.Agg {
+	case inter.MetricAggAvg, inter.MetricAggMin, inter.MetricAggMax, inter.MetricAggSum, inter.MetricAggCount:
+		return true
+	default:
+		return false
+	}
+}
+
+// aggregateWithRollups 把原始指标与小时、天汇总各自按桶预聚合后合并。原始指标过期时才被移入汇总，三者不重叠；
+// 汇总行按其起点落入所在的桶，桶比汇总粒度细时整段汇总计入一个桶。
+func (r *Repository) aggregateWithRollups(tenantID, uuid string, query inter.MetricAggregateQuery) ([]inter.MetricSeries, error) {
+	raw := r.filterMetrics(r.db.NewSelect().TableExpr("metrics"), tenantID, uuid, query.MetricQuery).
+		ColumnExpr("name, ts - ts % ? AS bucket", query.BucketMs).
+		ColumnExpr("MAX(unit) AS unit, COUNT(*) AS cnt, SUM(value) AS total, MIN(value) AS low, MAX(value) AS high").
+		Where("value_type <> ?", "string").
+		GroupExpr("name, bucket")
+
+	var valueExpr string
+	switch query.Agg {
+	case inter.MetricAggAvg:
+		valueExpr = "SUM(total) / CAST(SUM(cnt) AS DOUBLE PRECISION)"
+	case inter.MetricAggMin:
+		valueExpr = "MIN(low)"
+	case inter.MetricAggMax:
+		valueExpr = "MAX(high)"
+	case inter.MetricAggSum:
+		valueExpr = "SUM(total)"
+	default:
+		valueExpr = "SUM(cnt)"
+	}
+
+	var rows []metricBucketRow
+	err := r.db.NewSelect().
+		TableExpr("(? UNION ALL ? UNION ALL ?) AS m", raw,
+			r.filterRollups("metric_rollups_hourly", tenantID, uuid, query),
+			r.filterRollups("metric_rollups_daily", tenantID, uuid, query)).
+		ColumnExpr("name, bucket, MAX(unit) AS unit, CAST(SUM(cnt) AS BIGINT) AS cnt").
+		ColumnExpr(valueExpr+" AS value").
+		GroupExpr("name, bucket").
+		OrderExpr("name ASC, bucket ASC").
+		Scan(context.Background(), &rows)
+	if err != nil {
+		return nil, err
+	}
+	return fillMetricSeries(rows, query), nil
+}
+
+// filterRollups 按桶预聚合一张汇总表，列与 aggregateWithRollups 中原始指标的预聚合一致。
+func (r *Repository) filterRollups(table, tenantID, uuid string, query inter.MetricAggregateQuery) *bun.SelectQuery {
+	q := r.db.NewSelect().
+		TableExpr(table).
+		ColumnExpr("name, bucket_ts - bucket_ts % ? AS bucket", query.BucketMs).
+		ColumnExpr("MAX(unit) AS unit, SUM(value_count) AS cnt, SUM(value_sum) AS total, MIN(value_min) AS low, MAX(value_max) AS high").
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("uuid = ?", uuid).
+		Where("bucket_ts BETWEEN ? AND ?", query.Start, query.End).
+		GroupExpr("name, bucket")
+	if len(query.Names) > 0 {
+		q = q.Where("name IN (?)", bun.In(query.Names))
+	}
+	if entityID := strings.TrimSpace(query.EntityID); entityID != "" {
+		q = q.Where("entity_id = ?", entityID)
+	}
+	return q
+}
+
+// metricAggregateExpr 返回外层分组使用的聚合表达式。Postgres 直接用有序聚合与 percentile_cont；
+// SQLite 没有对应的聚合函数，first/last 与分位数先在内层用窗口函数算出桶内排位。
+func (r *Repository) metricAggregateExpr(inner *bun.SelectQuery, query inter.MetricAggregateQuery) (string, []interface{}, error) {
+	pg := r.db.Dialect().Name() == dialect.PG
+	switch query.Agg {
+	case inter.MetricAggAvg, inter.MetricAggMin, inter.MetricAggMax, inter.MetricAggSum:
+		return strings.ToUpper(string(query.Agg)) + "(value)", nil, nil
+	case inter.MetricAggCount:
+		return "COUNT(*)", nil, nil
+	case inter.MetricAggFirst, inter.MetricAggLast:
+		order := "ASC"
+		if query.Agg == inter.MetricAggLast {
+			order = "DESC"
+		}
+		if pg {
+			return "(array_agg(value ORDER BY ts " + order + "))[1]", nil, nil
+		}
+		inner.ColumnExpr("FIRST_VALUE(value) OVER (PARTITION BY name, ts - ts % ? ORDER BY ts "+order+", rowid "+order+") AS edge", query.BucketMs)
+		return "MAX(edge)", nil, nil
+	case inter.MetricAggPercentile:
+		if pg {
+			return "percentile_cont(?) WITHIN GROUP (ORDER BY value)", []interface{}{query.Percentile}, nil
+		}
+		// 与 percentile_cont 一致：在第 p*(n-1) 位的上下两个值之间线性插值。
+		inner.ColumnExpr("ROW_NUMBER() OVER (PARTITION BY name, ts - ts % ? ORDER BY value) - 1 AS rn", query.BucketMs).
+			ColumnExpr("? * (COUNT(*) OVER (PARTITION BY name, ts - ts % ?) - 1) AS pos", query.Percentile, query.BucketMs)
+		lower := "MAX(CASE WHEN rn = CAST(pos AS INTEGER) THEN value END)"
+		upper := "MAX(CASE WHEN rn = CAST(pos AS INTEGER) + 1 THEN value END)"
+		return lower + " + MAX(pos - CAST(pos AS INTEGER)) * (COALESCE(" + upper + ", " + lower + ") - " + lower + ")", nil, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported aggregation %q", query.Agg)
+	}
+}
+
+// fillMetricSeries 按指标名组装结果，并在 Fill 不为 none 时补齐窗口内缺失的桶。
+func fillMetricSeries(rows []metricBucketRow, query inter.MetricAggregateQuery) []inter.MetricSeries {
+	series := make([]inter.MetricSeries, 0)
+	for _, row := range rows {
+		if len(series) == 0 || series[len(series)-1].Name != row.Name {
+			series = append(series, inter.MetricSeries{Name: row.Name, Unit: row.Unit, Points: []inter.MetricBucket{}})
+		}
+		current := &series[len(series)-1]
+		current.Points = append(current.Points, metricBucket(row))
+	}
+	if query.Fill == "" || query.Fill == inter.MetricFillNone {
+		return series
+	}
+
+	first := inter.MetricBucketStart(query.Start, query.BucketMs)
+	last := inter.MetricBucketStart(query.End, query.BucketMs)
+	for i := range series {
+		points := series[i].Points
+		filled := make([]inter.MetricBucket, 0, inter.MetricBucketCount(query.Start, query.End, query.BucketMs))
+		var previous *float64
+		for ts := first; ts <= last; ts += query.BucketMs {
+			if len(points) > 0 && points[0].Timestamp == ts {
+				previous = points[0].Value
+				filled = append(filled, points[0])
+				points = points[1:]
+				continue
+			}
+			point := inter.MetricBucket{Timestamp: ts}
+			switch query.Fill {
+			case inter.MetricFillZero:
+				zero := 0.0
+				point.Value = &zero
+			case inter.MetricFillPrevious:
+				point.Value = previous
+			}
+			filled = append(filled, point)
+		}
+		series[i].Points = filled
+	}
+	return series
+}
+
+func metricBucket(row metricBucketRow) inter.MetricBucket {
+	point := inter.MetricBucket{Timestamp: row.Bucket, Count: row.Count}
+	if row.Value.Valid {
+		value := row.Value.Float64
+		point.Value = &value
+	}
+	return point
+}
+
+// metricTagCondition 返回按单个标签过滤 tags_json 的条件，标签键与值都以参数绑定，不拼进 JSON 路径；
+// SQLite 的 JSON 路径无法转义引号，因此改用 json_each 比较键名。
+func metricTagCondition(db *bun.DB) string {
+	if db.Dialect().Name() == dialect.PG {
+		return "(tags_json::jsonb ->> ?) = ?"
+	}
+	return "EXISTS (SELECT 1 FROM json_each(tags_json) WHERE json_each.key = ? AND json_each.value = ?)"
+}
+
+// LatestMetrics 取每个序列时间戳最大的一行；同一时间戳有多行时只保留其中一行。
+func (r *Repository) LatestMetrics(tenantID string, uuids []string) (map[string][]inter.MetricPoint, error) {
+	latest := r.db.NewSelect().
+		Model((*bunrepo.MetricRow)(nil)).
+		Column("uuid", "name", "entity_id", "type").
+		ColumnExpr("MAX(ts) AS ts").
+		Group("uuid", "name", "entity_id", "type")
+	if strings.TrimSpace(tenantID) != "" {
+		latest = latest.Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID))
+	}
+	if len(uuids) > 0 {
+		latest = latest.Where("uuid IN (?)", bun.In(uuids))
+	}
+
+	var rows []bunrepo.MetricRow
+	err := r.db.NewSelect().
+		Model(&rows).
+		Join("JOIN (?) AS latest", latest).
+		JoinOn("latest.uuid = ?TableAlias.uuid").
+		JoinOn("latest.name = ?TableAlias.name").
+		JoinOn("latest.entity_id = ?TableAlias.entity_id").
+		JoinOn("latest.type = ?TableAlias.type").
+		JoinOn("latest.ts = ?TableAlias.ts").
+		Scan(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	type seriesKey struct {
+		uuid, name, entityID string
+		typ                  uint8
+	}
+	seen := make(map[seriesKey]bool, len(rows))
+	out := make(map[string][]inter.MetricPoint)
+	for _, row := range rows {
+		key := seriesKey{row.UUID, row.Name, row.EntityID, row.Type}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out[row.UUID] = append(out[row.UUID], row.ToMetricPoint())
+	}
+	return out, nil
+}
+
+// RecentMetricDevices 只扫描 ts 索引上 since 之后的区间，供启动预热限定加载范围。
+func (r *Repository) RecentMetricDevices(since int64, limit int) ([]string, error) {
+	var uuids []string
+	err := r.db.NewSelect().
+		Model((*bunrepo.MetricRow)(nil)).
+		Column("uuid").
+		Where("ts >= ?", since).
+		Group("uuid").
+		OrderExpr("MAX(ts) DESC").
+		Limit(limit).
+		Scan(context.Background(), &uuids)
+	return uuids, err
+}
+
 func (r *Repository) WriteLog(uuid string, level string, message string) error {
 	tenantID, err := r.deviceRepo.ResolveDeviceTenant(uuid)
 	if err != nil {
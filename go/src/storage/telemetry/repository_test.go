@@ -2,10 +2,12 @@ package telemetry_test
 
 import (
 	"context"
+	"math"
 	"testing"
 
 	"github.com/nhirsama/Goster-IoT/src/inter"
 	"github.com/nhirsama/Goster-IoT/src/storage/device"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
 	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
 	"github.com/nhirsama/Goster-IoT/src/storage/telemetry"
 )
@@ -55,3 +57,242 @@ func TestRepositoryMetricsAndLogsUseResolvedTenant(t *testing.T) {
 		t.Fatalf("unexpected log tenant: %s", tenantID)
 	}
 }
+
+func TestRepositoryQueryMetricSeriesFiltersByNameAndTags(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "telemetry_series_repo.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := telemetry.NewWithDevice(base.DB, deviceRepo)
+
+	uuid := "series-device"
+	if err := deviceRepo.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	if err := repo.BatchAppendMetrics(uuid, []inter.MetricPoint{
+		{Timestamp: 1000, Name: "co2", Unit: "ppm", Value: 612, Tags: map[string]string{"room": "kitchen"}},
+		{Timestamp: 2000, Name: "co2", Unit: "ppm", Value: 655, Tags: map[string]string{"room": "bedroom", `a"b\\c`: "x"}},
+		{Timestamp: 2000, Name: "window_open", ValueType: "bool", Value: 1, EntityID: "binary_sensor.window"},
+		{Timestamp: 3000, Name: "mode", ValueType: "string", ValueText: "eco"},
+		{Timestamp: 3000, Value: 22.5, Type: 1},
+	}); err != nil {
+		t.Fatalf("BatchAppendMetrics failed: %v", err)
+	}
+
+	all, err := repo.QueryMetricSeries("", uuid, inter.MetricQuery{Start: 0, End: 5000})
+	if err != nil || len(all) != 5 {
+		t.Fatalf("unexpected unfiltered series: %+v err=%v", all, err)
+	}
+	byName := map[string]inter.MetricPoint{}
+	for _, point := range all {
+		byName[point.Name] = point
+	}
+	if legacy := byName["temperature"]; legacy.Type != 1 || legacy.Unit != "°C" || legacy.ValueType != "number" {
+		t.Fatalf("expected legacy type to be named on write, got %+v", all)
+	}
+
+	kitchen, err := repo.QueryMetricSeries("", uuid, inter.MetricQuery{Start: 0, End: 5000, Names: []string{"co2"}, Tags: map[string]string{"room": "kitchen"}})
+	if err != nil || len(kitchen) != 1 || kitchen[0].Value != 612 || kitchen[0].Tags["room"] != "kitchen" {
+		t.Fatalf("unexpected tag-filtered series: %+v err=%v", kitchen, err)
+	}
+	// 含引号与反斜杠的标签键按原样匹配，不会破坏查询。
+	quoted, err := repo.QueryMetricSeries("", uuid, inter.MetricQuery{Start: 0, End: 5000, Tags: map[string]string{`a"b\\c`: "x"}})
+	if err != nil || len(quoted) != 1 || quoted[0].Value != 655 {
+		t.Fatalf("unexpected quoted-tag series: %+v err=%v", quoted, err)
+	}
+	named, err := repo.QueryMetricSeries("", uuid, inter.MetricQuery{Start: 0, End: 5000, Names: []string{"mode", "temperature"}})
+	if err != nil || len(named) != 2 || named[0].Name == named[1].Name || byName["mode"].ValueText != "eco" {
+		t.Fatalf("unexpected name-filtered series: %+v err=%v", named, err)
+	}
+	entity, err := repo.QueryMetricSeries("", uuid, inter.MetricQuery{Start: 0, End: 5000, EntityID: "binary_sensor.window"})
+	if err != nil || len(entity) != 1 || entity[0].ValueType != "bool" || entity[0].Value != 1 {
+		t.Fatalf("unexpected entity-filtered series: %+v err=%v", entity, err)
+	}
+	if other, err := repo.QueryMetricSeries("tenant_other", uuid, inter.MetricQuery{Start: 0, End: 5000}); err != nil || len(other) != 0 {
+		t.Fatalf("expected no points for other tenant, got %+v err=%v", other, err)
+	}
+}
+
+func TestRepositoryAggregateMetricSeries(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "telemetry_aggregate_repo.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := telemetry.NewWithDevice(base.DB, deviceRepo)
+
+	uuid := "aggregate-device"
+	if err := deviceRepo.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	if err := repo.BatchAppendMetrics(uuid, []inter.MetricPoint{
+		{Timestamp: 1000, Name: "co2", Unit: "ppm", Value: 1},
+		{Timestamp: 1500, Name: "co2", Unit: "ppm", Value: 3},
+		{Timestamp: 1900, Name: "co2", Unit: "ppm", Value: 2},
+		{Timestamp: 3200, Name: "co2", Unit: "ppm", Value: 10},
+		{Timestamp: 1200, Name: "mode", ValueType: "string", ValueText: "eco"},
+		{Timestamp: 1300, Name: "window_open", ValueType: "bool", Value: 1},
+	}); err != nil {
+		t.Fatalf("BatchAppendMetrics failed: %v", err)
+	}
+
+	window := inter.MetricQuery{Start: 1000, End: 3999, Names: []string{"co2"}}
+	expected := map[inter.MetricAggregation]float64{
+		inter.MetricAggAvg:   2,
+		inter.MetricAggMin:   1,
+		inter.MetricAggMax:   3,
+		inter.MetricAggSum:   6,
+		inter.MetricAggCount: 3,
+		inter.MetricAggFirst: 1,
+		inter.MetricAggLast:  2,
+	}
+	for agg, want := range expected {
+		series, err := repo.AggregateMetricSeries("", uuid, inter.MetricAggregateQuery{MetricQuery: window, BucketMs: 1000, Agg: agg})
+		if err != nil || len(series) != 1 || len(series[0].Points) != 2 {
+			t.Fatalf("%s: unexpected series: %+v err=%v", agg, series, err)
+		}
+		first := series[0].Points[0]
+		if first.Timestamp != 1000 || first.Count != 3 || first.Value == nil || *first.Value != want {
+			t.Fatalf("%s: expected %v in first bucket, got %+v", agg, want, first)
+		}
+	}
+
+	p90, err := repo.AggregateMetricSeries("", uuid, inter.MetricAggregateQuery{MetricQuery: window, BucketMs: 1000, Agg: inter.MetricAggPercentile, Percentile: 0.9})
+	if err != nil || len(p90) != 1 || math.Abs(*p90[0].Points[0].Value-2.8) > 1e-9 || *p90[0].Points[1].Value != 10 {
+		t.Fatalf("unexpected percentile series: %+v err=%v", p90, err)
+	}
+
+	filled, err := repo.AggregateMetricSeries("", uuid, inter.MetricAggregateQuery{MetricQuery: window, BucketMs: 1000, Agg: inter.MetricAggMax, Fill: inter.MetricFillPrevious})
+	if err != nil || len(filled) != 1 || len(filled[0].Points) != 3 {
+		t.Fatalf("unexpected filled series: %+v err=%v", filled, err)
+	}
+	if gap := filled[0].Points[1]; gap.Timestamp != 2000 || gap.Count != 0 || gap.Value == nil || *gap.Value != 3 {
+		t.Fatalf("expected previous value in gap bucket, got %+v", gap)
+	}
+	nulls, err := repo.AggregateMetricSeries("", uuid, inter.MetricAggregateQuery{MetricQuery: window, BucketMs: 1000, Fill: inter.MetricFillNull})
+	if err != nil || len(nulls[0].Points) != 3 || nulls[0].Points[1].Value != nil {
+		t.Fatalf("expected null gap bucket, got %+v err=%v", nulls, err)
+	}
+
+	all, err := repo.AggregateMetricSeries("", uuid, inter.MetricAggregateQuery{MetricQuery: inter.MetricQuery{Start: 0, End: 5000}, BucketMs: 5000, Agg: inter.MetricAggCount})
+	if err != nil || len(all) != 2 || all[0].Name != "co2" || all[0].Unit != "ppm" || all[1].Name != "window_open" {
+		t.Fatalf("expected string metrics to be skipped, got %+v err=%v", all, err)
+	}
+	if _, err := repo.AggregateMetricSeries("", uuid, inter.MetricAggregateQuery{MetricQuery: window}); err == nil {
+		t.Fatal("expected error without bucket")
+	}
+}
+
+func TestRepositoryAggregateMetricSeriesReadsRollups(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "telemetry_rollup_repo.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := telemetry.NewWithDevice(base.DB, deviceRepo)
+	ctx := context.Background()
+
+	uuid := "rollup-device"
+	if err := deviceRepo.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	if err := repo.BatchAppendMetrics(uuid, []inter.MetricPoint{
+		{Timestamp: 9500, Name: "co2", EntityID: "room", Unit: "ppm", Value: 40},
+	}); err != nil {
+		t.Fatalf("BatchAppendMetrics failed: %v", err)
+	}
+
+	// 原始指标过期后只剩汇总：小时汇总按实体区分，天汇总来自更早的数据。
+	tenantID := bunrepo.NormalizeTenantID("")
+	hourly := []bunrepo.MetricHourlyRollupRow{
+		{MetricRollup: bunrepo.MetricRollup{TenantID: tenantID, UUID: uuid, Name: "co2", EntityID: "room", Unit: "ppm", BucketTS: 5000, Count: 2, Sum: 20, Min: 5, Max: 15}},
+		{MetricRollup: bunrepo.MetricRollup{TenantID: tenantID, UUID: uuid, Name: "co2", EntityID: "hall", Unit: "ppm", BucketTS: 6000, Count: 1, Sum: 100, Min: 100, Max: 100}},
+	}
+	if _, err := base.DB.NewInsert().Model(&hourly).Exec(ctx); err != nil {
+		t.Fatalf("insert hourly rollups failed: %v", err)
+	}
+	daily := bunrepo.MetricDailyRollupRow{MetricRollup: bunrepo.MetricRollup{TenantID: tenantID, UUID: uuid, Name: "co2", EntityID: "room", Unit: "ppm", BucketTS: 0, Count: 3, Sum: 3, Min: 1, Max: 1}}
+	if _, err := base.DB.NewInsert().Model(&daily).Exec(ctx); err != nil {
+		t.Fatalf("insert daily rollup failed: %v", err)
+	}
+
+	window := inter.MetricQuery{Start: 0, End: 9999, Names: []string{"co2"}}
+	expected := map[inter.MetricAggregation]float64{
+		inter.MetricAggAvg:   163.0 / 7,
+		inter.MetricAggMin:   1,
+		inter.MetricAggMax:   100,
+		inter.MetricAggSum:   163,
+		inter.MetricAggCount: 7,
+	}
+	for agg, want := range expected {
+		series, err := repo.AggregateMetricSeries("", uuid, inter.MetricAggregateQuery{MetricQuery: window, BucketMs: 10000, Agg: agg})
+		if err != nil || len(series) != 1 || len(series[0].Points) != 1 || series[0].Unit != "ppm" {
+			t.Fatalf("%s: unexpected series: %+v err=%v", agg, series, err)
+		}
+		point := series[0].Points[0]
+		if point.Count != 7 || point.Value == nil || math.Abs(*point.Value-want) > 1e-9 {
+			t.Fatalf("%s: expected %v merged from raw and rollups, got %+v", agg, want, point)
+		}
+	}
+
+	room := window
+	room.EntityID = "room"
+	series, err := repo.AggregateMetricSeries("", uuid, inter.MetricAggregateQuery{MetricQuery: room, BucketMs: 5000, Agg: inter.MetricAggSum})
+	if err != nil || len(series) != 1 || len(series[0].Points) != 2 {
+		t.Fatalf("unexpected entity series: %+v err=%v", series, err)
+	}
+	if first, second := series[0].Points[0], series[0].Points[1]; *first.Value != 3 || first.Count != 3 || *second.Value != 60 || second.Count != 3 {
+		t.Fatalf("expected hall rollup excluded, got %+v %+v", first, second)
+	}
+
+	// 首值与分位数无法由汇总合并，只基于原始指标。
+	firsts, err := repo.AggregateMetricSeries("", uuid, inter.MetricAggregateQuery{MetricQuery: window, BucketMs: 10000, Agg: inter.MetricAggFirst})
+	if err != nil || len(firsts) != 1 || firsts[0].Points[0].Count != 1 || *firsts[0].Points[0].Value != 40 {
+		t.Fatalf("expected first to read raw metrics only, got %+v err=%v", firsts, err)
+	}
+}
+
+func TestRepositoryLatestMetricsPerSeries(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "telemetry_latest_repo.db")
+	deviceRepo := device.NewRepository(base.DB)
+	repo := telemetry.NewWithDevice(base.DB, deviceRepo)
+
+	for _, uuid := range []string{"latest-a", "latest-b"} {
+		if err := deviceRepo.InitDevice(uuid, inter.DeviceMetadata{Name: uuid, Token: "tk-" + uuid, AuthenticateStatus: inter.Authenticated}); err != nil {
+			t.Fatalf("InitDevice failed: %v", err)
+		}
+	}
+	if err := repo.BatchAppendMetrics("latest-a", []inter.MetricPoint{
+		{Timestamp: 1000, Name: "co2", Value: 400},
+		{Timestamp: 3000, Name: "co2", Value: 420},
+		{Timestamp: 2000, Name: "co2", Value: 410},
+		{Timestamp: 1500, Name: "co2", EntityID: "room-2", Value: 500},
+		{Timestamp: 2500, Type: 8, Value: 1},
+		{Timestamp: 2600, Name: "mode", ValueType: "string", ValueText: "eco"},
+	}); err != nil {
+		t.Fatalf("BatchAppendMetrics failed: %v", err)
+	}
+	if err := repo.AppendMetric("latest-b", inter.MetricPoint{Timestamp: 5000, Name: "co2", Value: 380}); err != nil {
+		t.Fatalf("AppendMetric failed: %v", err)
+	}
+
+	latest, err := repo.LatestMetrics(inter.DefaultTenantID, []string{"latest-a"})
+	if err != nil {
+		t.Fatalf("LatestMetrics failed: %v", err)
+	}
+	if _, ok := latest["latest-b"]; ok || len(latest["latest-a"]) != 4 {
+		t.Fatalf("expected four series for latest-a only, got %+v", latest)
+	}
+	for _, point := range latest["latest-a"] {
+		switch {
+		case point.Name == "co2" && point.EntityID == "" && (point.Timestamp != 3000 || point.Value != 420):
+			t.Fatalf("unexpected latest co2: %+v", point)
+		case point.Name == "co2" && point.EntityID == "room-2" && point.Value != 500:
+			t.Fatalf("unexpected latest room-2 co2: %+v", point)
+		case point.Name == "access_signal_a" && point.Type != 8:
+			t.Fatalf("expected legacy type kept on latest value: %+v", point)
+		case point.Name == "mode" && point.ValueText != "eco":
+			t.Fatalf("unexpected latest string metric: %+v", point)
+		}
+	}
+
+	all, err := repo.LatestMetrics("", nil)
+	if err != nil || len(all) != 2 || all["latest-b"][0].Value != 380 {
+		t.Fatalf("expected every device without filters, got %+v err=%v", all, err)
+	}
+	if other, err := repo.LatestMetrics("tenant_other", nil); err != nil || len(other) != 0 {
+		t.Fatalf("expected other tenant to see nothing, got %+v err=%v", other, err)
+	}
+}
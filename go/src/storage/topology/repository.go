@@ -0,0 +1,111 @@
+package topology
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/bunrepo"
+	"github.com/uptrace/bun"
+)
+
+type Repository struct {
+	db *bun.DB
+}
+
+func NewRepository(db *bun.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// UpsertDeviceTopologyNode 写入拓扑节点；上报中缺失的字段（含上级）保留库中已有的值。
+func (r *Repository) UpsertDeviceTopologyNode(tenantID string, node inter.DeviceTopologyNode) error {
+	return upsertNode(context.Background(), r.db, tenantID, node)
+}
+
+// ReplaceDeviceChildren 在同一事务中写入快照内的子设备，并解除快照外旧子设备的挂载。
+func (r *Repository) ReplaceDeviceChildren(tenantID, parentUUID string, children []inter.DeviceTopologyNode) error {
+	parentUUID = strings.TrimSpace(parentUUID)
+	if parentUUID == "" {
+		return errors.New("parent uuid is required")
+	}
+	tenantID = bunrepo.NormalizeTenantID(tenantID)
+	keep := make([]string, 0, len(children))
+	return r.db.RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		for _, child := range children {
+			child.ParentUUID = parentUUID
+			if err := upsertNode(ctx, tx, tenantID, child); err != nil {
+				return err
+			}
+			keep = append(keep, strings.TrimSpace(child.UUID))
+		}
+		query := tx.NewUpdate().
+			Model((*bunrepo.DeviceTopologyRow)(nil)).
+			Set("parent_uuid = ''").
+			Set("updated_at = ?", time.Now().UnixMilli()).
+			Where("tenant_id = ?", tenantID).
+			Where("parent_uuid = ?", parentUUID)
+		if len(keep) > 0 {
+			query = query.Where("uuid NOT IN (?)", bun.In(keep))
+		}
+		_, err := query.Returning("NULL").Exec(ctx)
+		return err
+	})
+}
+
+func (r *Repository) GetDeviceTopologyNode(tenantID, uuid string) (inter.DeviceTopologyNode, error) {
+	var row bunrepo.DeviceTopologyRow
+	err := r.db.NewSelect().
+		Model(&row).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("uuid = ?", strings.TrimSpace(uuid)).
+		Limit(1).
+		Scan(context.Background())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inter.DeviceTopologyNode{}, inter.ErrDeviceTopologyNotFound
+		}
+		return inter.DeviceTopologyNode{}, err
+	}
+	return row.ToDeviceTopologyNode(), nil
+}
+
+func (r *Repository) ListDeviceChildren(tenantID, parentUUID string) ([]inter.DeviceTopologyNode, error) {
+	var rows []bunrepo.DeviceTopologyRow
+	err := r.db.NewSelect().
+		Model(&rows).
+		Where("tenant_id = ?", bunrepo.NormalizeTenantID(tenantID)).
+		Where("parent_uuid = ?", strings.TrimSpace(parentUUID)).
+		OrderExpr("uuid ASC").
+		Scan(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]inter.DeviceTopologyNode, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.ToDeviceTopologyNode())
+	}
+	return out, nil
+}
+
+func upsertNode(ctx context.Context, db bun.IDB, tenantID string, node inter.DeviceTopologyNode) error {
+	if strings.TrimSpace(node.UUID) == "" {
+		return errors.New("uuid is required")
+	}
+	if node.UpdatedAt <= 0 {
+		node.UpdatedAt = time.Now().UnixMilli()
+	}
+	_, err := db.NewInsert().
+		Model(bunrepo.NewDeviceTopologyRow(tenantID, node)).
+		On("CONFLICT (tenant_id, uuid) DO UPDATE").
+		Set("parent_uuid = COALESCE(NULLIF(EXCLUDED.parent_uuid, ''), ?TableAlias.parent_uuid)").
+		Set("name = COALESCE(NULLIF(EXCLUDED.name, ''), ?TableAlias.name)").
+		Set("device_type = COALESCE(NULLIF(EXCLUDED.device_type, ''), ?TableAlias.device_type)").
+		Set("network_address = COALESCE(NULLIF(EXCLUDED.network_address, ''), ?TableAlias.network_address)").
+		Set("updated_at = EXCLUDED.updated_at").
+		Returning("NULL").
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,57 @@
+package topology_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/storage/internal/testhelper"
+	"github.com/nhirsama/Goster-IoT/src/storage/topology"
+)
+
+func TestRepositoryReplaceDeviceChildren(t *testing.T) {
+	base, _ := testhelper.OpenSQLiteStore(t, "topology_repo.db")
+	repo := topology.NewRepository(base.DB)
+
+	if err := repo.UpsertDeviceTopologyNode("tenant_a", inter.DeviceTopologyNode{UUID: "gw-1", DeviceType: "coordinator"}); err != nil {
+		t.Fatalf("UpsertDeviceTopologyNode failed: %v", err)
+	}
+	if err := repo.ReplaceDeviceChildren("tenant_a", "gw-1", []inter.DeviceTopologyNode{
+		{UUID: "child-a", DeviceType: "router", NetworkAddress: "0x01"},
+		{UUID: "child-b", DeviceType: "enddevice", Name: "Door"},
+	}); err != nil {
+		t.Fatalf("ReplaceDeviceChildren failed: %v", err)
+	}
+
+	// 第二次快照去掉 child-b，且缺失 network_address 时保留旧值。
+	if err := repo.ReplaceDeviceChildren("tenant_a", "gw-1", []inter.DeviceTopologyNode{{UUID: "child-a"}}); err != nil {
+		t.Fatalf("ReplaceDeviceChildren failed: %v", err)
+	}
+	children, err := repo.ListDeviceChildren("tenant_a", "gw-1")
+	if err != nil {
+		t.Fatalf("ListDeviceChildren failed: %v", err)
+	}
+	if len(children) != 1 || children[0].UUID != "child-a" || children[0].NetworkAddress != "0x01" || children[0].DeviceType != "router" {
+		t.Fatalf("unexpected children: %+v", children)
+	}
+
+	detached, err := repo.GetDeviceTopologyNode("tenant_a", "child-b")
+	if err != nil {
+		t.Fatalf("GetDeviceTopologyNode failed: %v", err)
+	}
+	if detached.ParentUUID != "" || detached.Name != "Door" {
+		t.Fatalf("expected child-b to be detached, got %+v", detached)
+	}
+
+	// 网关自身的上报不带上级时不会清空已有上级。
+	if err := repo.UpsertDeviceTopologyNode("tenant_a", inter.DeviceTopologyNode{UUID: "child-a"}); err != nil {
+		t.Fatalf("UpsertDeviceTopologyNode failed: %v", err)
+	}
+	if node, _ := repo.GetDeviceTopologyNode("tenant_a", "child-a"); node.ParentUUID != "gw-1" {
+		t.Fatalf("expected parent to be preserved, got %+v", node)
+	}
+
+	if _, err := repo.GetDeviceTopologyNode("tenant_b", "child-a"); !errors.Is(err, inter.ErrDeviceTopologyNotFound) {
+		t.Fatalf("expected tenant isolation, got %v", err)
+	}
+}
@@ -36,15 +36,29 @@ func buildAPIModules(deps WebServerDeps) []apiModule {
 // 后续新增 v2/v3 时，只需要追加新的 factory，不需要回头改根路由实现。
 func newAPIV1Module(deps WebServerDeps) apiModule {
 	return apiv1.New(apiv1.Deps{
-		DataStore:         deps.DataStore,
-		DeviceRegistry:    deps.DeviceRegistry,
-		DevicePresence:    deps.DevicePresence,
-		DownlinkCommands:  deps.DownlinkCommands,
-		Auth:              deps.Auth,
-		Captcha:           deps.Captcha,
-		Logger:            deps.Logger,
-		Config:            deps.Config,
-		LoginAttemptStore: apiv1.NewInMemoryLoginAttemptStore(),
+		DataStore:          deps.DataStore,
+		DeviceRegistry:     deps.DeviceRegistry,
+		DevicePresence:     deps.DevicePresence,
+		DownlinkCommands:   deps.DownlinkCommands,
+		CommandSchedules:   deps.CommandSchedules,
+		CommandBatches:     deps.CommandBatches,
+		DeviceGroups:       deps.DeviceGroups,
+		Ota:                deps.Ota,
+		DeviceConfigs:      deps.DeviceConfigs,
+		Retention:          deps.Retention,
+		LatestMetrics:      deps.LatestMetrics,
+		DeviceStates:       deps.DeviceStates,
+		DeviceShadows:      deps.DeviceShadows,
+		DeviceTopology:     deps.DeviceTopology,
+		DeviceDiagnostics:  deps.DeviceDiagnostics,
+		ExternalEntities:   deps.ExternalEntities,
+		ExternalCommands:   deps.ExternalCommands,
+		IngressCredentials: deps.IngressCredentials,
+		Auth:               deps.Auth,
+		Captcha:            deps.Captcha,
+		Logger:             deps.Logger,
+		Config:             deps.Config,
+		LoginAttemptStore:  apiv1.NewInMemoryLoginAttemptStore(),
 	})
 }
 
@@ -54,7 +68,7 @@ func (ws *webServer) registerAPIRoutes(mux *http.ServeMux) {
 	}
 	if ws.ingressHandler != nil {
 		path, handler := ingressv1connect.NewProtocolIngressCoreServiceHandler(ws.ingressHandler)
-		handler = withIngressBearerAuth(handler, ws.ingressToken)
+		handler = withIngressAuth(handler, ws.ingressAuth, ws.logger)
 		mux.Handle(path, handler)
 	}
 }
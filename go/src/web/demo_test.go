@@ -78,6 +78,11 @@ func TestRunServerAndStressTest(t *testing.T) {
 		DeviceRegistry:   services.DeviceRegistry,
 		DevicePresence:   services.DevicePresence,
 		DownlinkCommands: services.DownlinkCommands,
+		DeviceStates:     services.DeviceStates,
+		DeviceShadows:    services.DeviceShadows,
+		DeviceTopology:   services.DeviceTopology,
+		ExternalEntities: services.ExternalEntities,
+		ExternalCommands: services.ExternalCommands,
 		Auth:             authService,
 		Captcha:          &TurnstileService{Enabled: false},
 	})
@@ -163,7 +168,7 @@ func generateMetrics(ds *persistence.Store, uuid string, count int) {
 	for i := 0; i < count; i++ {
 		points = append(points, inter.MetricPoint{
 			Timestamp: now - int64(count-i)*60,
-			Value:     20.0 + rand.Float32()*10.0,
+			Value:     20.0 + rand.Float64()*10.0,
 		})
 	}
 	ds.BatchAppendMetrics(uuid, points)
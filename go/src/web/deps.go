@@ -24,11 +24,37 @@ type WebServerDeps struct {
 	DeviceRegistry   inter.DeviceRegistry
 	DevicePresence   inter.DevicePresence
 	DownlinkCommands inter.DownlinkCommandService
-	Auth             identity.Service
-	Captcha          CaptchaVerifier
-	Logger           inter.Logger
-	Config           appcfg.WebConfig
-	IngressToken     string
+	// CommandSchedules 为空时指令计划接口返回 404。
+	CommandSchedules inter.CommandScheduleService
+	// CommandBatches 与 DeviceGroups 为空时对应接口返回 404。
+	CommandBatches inter.CommandBatchService
+	DeviceGroups   inter.DeviceGroupService
+	// Ota 为空时固件与升级活动接口返回 404。
+	Ota inter.OtaService
+	// DeviceConfigs 为空时配置接口返回 404，ingress 也不做配置对账。
+	DeviceConfigs inter.DeviceConfigService
+	// LatestMetrics 为空时最新值接口与门禁状态直接查询存储。
+	LatestMetrics inter.LatestMetricService
+	// Retention 为空时保留策略接口返回 404。
+	Retention      inter.RetentionService
+	DeviceStates   inter.DeviceStateService
+	DeviceShadows  inter.DeviceShadowService
+	DeviceTopology inter.DeviceTopologyService
+	// DeviceDiagnostics 为空时不保存心跳诊断，设备详情也不返回 runtime.diagnostics。
+	DeviceDiagnostics inter.DeviceDiagnosticsService
+	ExternalEntities  inter.ExternalEntityService
+	ExternalCommands  inter.ExternalCommandService
+	IngestDedupe      inter.IngestDedupeService
+	CommandNotifier   inter.CommandNotifier
+	// IngressCredentials 为空时 ingress RPC 只支持共享密钥，凭据管理接口返回 404。
+	IngressCredentials inter.IngressCredentialService
+	Auth               identity.Service
+	Captcha            CaptchaVerifier
+	Logger             inter.Logger
+	Config             appcfg.WebConfig
+	IngressToken       string
+	// IngressRequireCredentials 开启后 ingress RPC 只接受 adapter 凭据。
+	IngressRequireCredentials bool
 }
 
 func (d *WebServerDeps) normalize() error {
@@ -47,9 +73,27 @@ func (d *WebServerDeps) normalize() error {
 	if d.IngressStore != nil && d.TelemetryIngest == nil {
 		return errors.New("web deps missing telemetry ingest service")
 	}
+	if d.DeviceStates == nil {
+		return errors.New("web deps missing device state service")
+	}
+	if d.DeviceShadows == nil {
+		return errors.New("web deps missing device shadow service")
+	}
+	if d.DeviceTopology == nil {
+		return errors.New("web deps missing device topology service")
+	}
+	if d.ExternalEntities == nil {
+		return errors.New("web deps missing external entity service")
+	}
+	if d.ExternalCommands == nil {
+		return errors.New("web deps missing external command service")
+	}
 	if d.Auth == nil {
 		return errors.New("web deps missing auth service")
 	}
+	if d.IngressRequireCredentials && d.IngressStore != nil && d.IngressCredentials == nil {
+		return errors.New("web deps missing ingress credential service")
+	}
 	if d.Captcha == nil {
 		d.Captcha = NewTurnstileServiceWithConfig(appcfg.DefaultCaptchaConfig())
 	}
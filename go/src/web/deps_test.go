@@ -25,6 +25,26 @@ type testWebDepsDownlinkCommands struct {
 	inter.DownlinkCommandService
 }
 
+type testWebDepsDeviceStates struct {
+	inter.DeviceStateService
+}
+
+type testWebDepsDeviceShadows struct {
+	inter.DeviceShadowService
+}
+
+type testWebDepsDeviceTopology struct {
+	inter.DeviceTopologyService
+}
+
+type testWebDepsExternalEntities struct {
+	inter.ExternalEntityService
+}
+
+type testWebDepsExternalCommands struct {
+	inter.ExternalCommandService
+}
+
 type testWebDepsAuth struct {
 	identitycore.Service
 }
@@ -35,6 +55,11 @@ func TestWebServerDepsNormalizeLogger(t *testing.T) {
 		DeviceRegistry:   testWebDepsRegistry{},
 		DevicePresence:   testWebDepsPresence{},
 		DownlinkCommands: testWebDepsDownlinkCommands{},
+		DeviceStates:     testWebDepsDeviceStates{},
+		DeviceShadows:    testWebDepsDeviceShadows{},
+		DeviceTopology:   testWebDepsDeviceTopology{},
+		ExternalEntities: testWebDepsExternalEntities{},
+		ExternalCommands: testWebDepsExternalCommands{},
 		Auth:             testWebDepsAuth{},
 		Captcha:          &TurnstileService{Enabled: false},
 		Logger:           nil,
@@ -72,6 +97,11 @@ func TestWebServerDepsNormalizeInjectsCaptchaAndConfig(t *testing.T) {
 		DeviceRegistry:   testWebDepsRegistry{},
 		DevicePresence:   testWebDepsPresence{},
 		DownlinkCommands: testWebDepsDownlinkCommands{},
+		DeviceStates:     testWebDepsDeviceStates{},
+		DeviceShadows:    testWebDepsDeviceShadows{},
+		DeviceTopology:   testWebDepsDeviceTopology{},
+		ExternalEntities: testWebDepsExternalEntities{},
+		ExternalCommands: testWebDepsExternalCommands{},
 		Auth:             testWebDepsAuth{},
 		Logger:           logger.NewNoop(),
 	}
@@ -0,0 +1,26 @@
+package ingress
+
+import (
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+)
+
+// reportAvailability 把 availability 事件转成显式的上线/离线信号；DELAYED 与未指定值不改变在线状态。
+func (s *CoreService) reportAvailability(uuid string, event *ingressv1.CanonicalDeviceEvent) {
+	reason := availabilityReason(event.GetContext(), "availability")
+	switch event.GetAvailability() {
+	case ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_ONLINE:
+		s.presence.ReportAvailability(uuid, true, reason)
+	case ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_OFFLINE:
+		s.presence.ReportAvailability(uuid, false, reason)
+	}
+}
+
+// availabilityReason 优先使用 adapter 写入的 availability_reason 标签，例如 mqtt_disconnect。
+func availabilityReason(ctx *ingressv1.IngressContext, fallback string) string {
+	if reason := strings.TrimSpace(ctx.GetLabels()["availability_reason"]); reason != "" {
+		return reason
+	}
+	return fallback
+}
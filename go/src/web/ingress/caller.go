@@ -0,0 +1,103 @@
+package ingress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+type callerCredentialKey struct{}
+
+// WithCallerCredential 把鉴权中间件识别出的 adapter 凭据挂到请求上下文。
+// 上下文中没有凭据（共享密钥或本地开发的匿名调用）时不做绑定范围检查。
+func WithCallerCredential(ctx context.Context, cred inter.IngressCredential) context.Context {
+	return context.WithValue(ctx, callerCredentialKey{}, cred)
+}
+
+func callerCredential(ctx context.Context) (inter.IngressCredential, bool) {
+	cred, ok := ctx.Value(callerCredentialKey{}).(inter.IngressCredential)
+	return cred, ok
+}
+
+// authorizeCaller 校验 IngressContext 声明的实例、adapter 与租户是否在调用方凭据的绑定范围内。
+func authorizeCaller(ctx context.Context, ictx *ingressv1.IngressContext) error {
+	cred, ok := callerCredential(ctx)
+	if !ok {
+		return nil
+	}
+	if instance := strings.TrimSpace(ictx.GetSourceInstance()); instance != cred.InstanceID {
+		return connect.NewError(connect.CodePermissionDenied, fmt.Errorf("source_instance %q is not bound to credential %s", instance, cred.ID))
+	}
+	if adapterID := strings.TrimSpace(ictx.GetAdapterId()); !cred.AllowsAdapter(adapterID) {
+		return connect.NewError(connect.CodePermissionDenied, fmt.Errorf("adapter %q is not allowed for credential %s", adapterID, cred.ID))
+	}
+	if tenantID := strings.TrimSpace(ictx.GetTenantId()); tenantID != "" && !cred.AllowsTenant(tenantID) {
+		return connect.NewError(connect.CodePermissionDenied, fmt.Errorf("tenant %q is not allowed for credential %s", tenantID, cred.ID))
+	}
+	return nil
+}
+
+// callerAllowsTenant 判断调用方凭据能否处理归属 tenantID 的设备。
+func callerAllowsTenant(ctx context.Context, tenantID string) bool {
+	cred, ok := callerCredential(ctx)
+	return !ok || cred.AllowsTenant(tenantID)
+}
+
+// callerTenant 返回外部集成设备的租户。外部设备不在设备表中，租户只能由调用方凭据决定：
+// 凭据只绑定一个租户时直接取它，绑定多个租户时要求 IngressContext 声明其中之一；
+// 没有凭据或凭据不限租户时沿用声明的租户，未声明则归入默认租户。
+func callerTenant(ctx context.Context, declared string) (string, error) {
+	declared = strings.TrimSpace(declared)
+	cred, ok := callerCredential(ctx)
+	switch {
+	case !ok || len(cred.TenantIDs) == 0:
+		if declared == "" {
+			return inter.DefaultTenantID, nil
+		}
+		return declared, nil
+	case declared != "":
+		if !cred.AllowsTenant(declared) {
+			return "", fmt.Errorf("tenant %q is not allowed for credential %s", declared, cred.ID)
+		}
+		return declared, nil
+	case len(cred.TenantIDs) == 1:
+		return cred.TenantIDs[0], nil
+	default:
+		return "", fmt.Errorf("credential %s is bound to several tenants, tenant_id is required", cred.ID)
+	}
+}
+
+// authorizeCommand 读取指令并按其所属设备校验调用方；请求声明的 uuid 必须与指令所属设备一致。
+func (s *CoreService) authorizeCommand(ctx context.Context, commandID int64, uuid string) (inter.DeviceCommand, error) {
+	record, err := s.downlinkCommands.LookupCommand(commandID)
+	if err != nil {
+		if errors.Is(err, inter.ErrDeviceCommandNotFound) {
+			return inter.DeviceCommand{}, connect.NewError(connect.CodeNotFound, err)
+		}
+		return inter.DeviceCommand{}, connect.NewError(connect.CodeInternal, fmt.Errorf("load device command failed: %w", err))
+	}
+	if uuid = strings.TrimSpace(uuid); uuid != "" && uuid != record.UUID {
+		return inter.DeviceCommand{}, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("command %d does not belong to device %s", commandID, uuid))
+	}
+	if _, err := s.authorizeDevice(ctx, record.UUID); err != nil {
+		return inter.DeviceCommand{}, err
+	}
+	return record, nil
+}
+
+// authorizeDevice 解析设备租户，并在租户超出调用方凭据范围时返回 PermissionDenied。
+func (s *CoreService) authorizeDevice(ctx context.Context, uuid string) (string, error) {
+	tenantID, err := s.resolveTenant(uuid)
+	if err != nil {
+		return "", connect.NewError(connect.CodeInternal, fmt.Errorf("resolve device tenant failed: %w", err))
+	}
+	if !callerAllowsTenant(ctx, tenantID) {
+		return tenantID, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("device %s belongs to a tenant outside the credential binding", uuid))
+	}
+	return tenantID, nil
+}
@@ -0,0 +1,456 @@
+package ingress
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
+)
+
+const (
+	// defaultWatchKeepalive 是推送流的保活间隔，同时驱动一次兜底扫描，覆盖未经过通知中心的回队路径。
+	defaultWatchKeepalive = 15 * time.Second
+	// defaultWatchResumeWindow 是推送会话断开后保留未确认命令的时长，超时后命令放回队列。
+	// 保留期间每个保活周期续期命令的领取租约，窗口可以长于队列的领取租约。
+	defaultWatchResumeWindow = 2 * time.Minute
+	defaultWatchBatch        = 16
+)
+
+// WithCommandNotifier 让 WatchCommands 在命令入队时立即推送；未设置时只在保活周期扫描队列。
+func WithCommandNotifier(notifier inter.CommandNotifier) CoreServiceOption {
+	return func(s *CoreService) {
+		s.notifier = notifier
+	}
+}
+
+// watchTarget 是推送流订阅的一个设备；外部集成设备带有来源与来源内身份。
+type watchTarget struct {
+	uuid     string
+	source   string
+	identity *ingressv1.DeviceIdentity
+	// tenantID 是外部设备所属租户，由调用方凭据决定。
+	tenantID string
+}
+
+func (t watchTarget) key() string {
+	if t.source != "" {
+		return inter.ExternalCommandKey(t.source, strings.TrimSpace(t.identity.GetValue()))
+	}
+	return t.uuid
+}
+
+// watchDelivery 是已推送但尚未被回执或游标确认的命令。
+type watchDelivery struct {
+	seq     int64
+	target  watchTarget
+	command *ingressv1.CanonicalCommand
+}
+
+func (d watchDelivery) commandKey() string {
+	return watchCommandKey(d.target.source != "", d.command.GetCommandId())
+}
+
+// watchCommandKey 区分设备命令与外部命令，两者的自增 ID 来自不同的表。
+func watchCommandKey(external bool, commandID int64) string {
+	if external {
+		return "ext:" + strconv.FormatInt(commandID, 10)
+	}
+	return "dev:" + strconv.FormatInt(commandID, 10)
+}
+
+// watchSession 记录一个 ingress 推送会话的进度，同一实例重连后据此补发。
+type watchSession struct {
+	streams    int
+	detachedAt time.Time
+	inflight   map[string]watchDelivery
+}
+
+// commandWatches 管理全部推送会话。游标从进程启动时刻起算，Core 重启后仍保持单调递增。
+type commandWatches struct {
+	mu       sync.Mutex
+	seq      int64
+	sessions map[string]*watchSession
+	owners   map[string]string
+	// renewedAt 是上一次续期领取租约的时间，多条推送流共用一次续期。
+	renewedAt time.Time
+}
+
+func newCommandWatches(now time.Time) *commandWatches {
+	return &commandWatches{
+		seq:      now.UnixMicro(),
+		sessions: make(map[string]*watchSession),
+		owners:   make(map[string]string),
+	}
+}
+
+// attach 登记一条推送流，确认 cursor 及之前的推送，并取出需要补发的命令。
+func (w *commandWatches) attach(key string, cursor int64) []watchDelivery {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	session, ok := w.sessions[key]
+	if !ok {
+		session = &watchSession{inflight: make(map[string]watchDelivery)}
+		w.sessions[key] = session
+	}
+	session.streams++
+	resend := make([]watchDelivery, 0)
+	for commandKey, item := range session.inflight {
+		if item.seq > cursor {
+			resend = append(resend, item)
+		}
+		delete(session.inflight, commandKey)
+		delete(w.owners, commandKey)
+	}
+	sort.Slice(resend, func(i, j int) bool { return resend[i].seq < resend[j].seq })
+	return resend
+}
+
+func (w *commandWatches) detach(key string, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if session, ok := w.sessions[key]; ok {
+		session.streams--
+		if session.streams <= 0 {
+			session.streams = 0
+			session.detachedAt = now
+		}
+	}
+}
+
+// record 为一批即将推送的命令分配游标并登记为未确认。
+func (w *commandWatches) record(key string, items []watchDelivery) int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	session, ok := w.sessions[key]
+	if !ok {
+		session = &watchSession{inflight: make(map[string]watchDelivery)}
+		w.sessions[key] = session
+	}
+	for _, item := range items {
+		item.seq = w.seq
+		commandKey := item.commandKey()
+		if owner, ok := w.owners[commandKey]; ok && owner != key {
+			if previous, ok := w.sessions[owner]; ok {
+				delete(previous.inflight, commandKey)
+			}
+		}
+		session.inflight[commandKey] = item
+		w.owners[commandKey] = key
+	}
+	return w.seq
+}
+
+// anonymousKey 为无法识别来源的推送流分配一次性会话键。
+func (w *commandWatches) anonymousKey() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	return "anonymous:" + strconv.FormatInt(w.seq, 10)
+}
+
+// settle 在收到命令回执后解除未确认登记。
+func (w *commandWatches) settle(commandKey string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	owner, ok := w.owners[commandKey]
+	if !ok {
+		return
+	}
+	delete(w.owners, commandKey)
+	if session, ok := w.sessions[owner]; ok {
+		delete(session.inflight, commandKey)
+	}
+}
+
+// expire 移除断开超过 window 的会话，返回其中仍未确认的命令。
+func (w *commandWatches) expire(now time.Time, window time.Duration) []watchDelivery {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]watchDelivery, 0)
+	for key, session := range w.sessions {
+		if session.streams > 0 || now.Sub(session.detachedAt) < window {
+			continue
+		}
+		for commandKey, item := range session.inflight {
+			out = append(out, item)
+			delete(w.owners, commandKey)
+		}
+		delete(w.sessions, key)
+	}
+	return out
+}
+
+// held 返回连接中或仍在恢复窗口内的会话所持有的未确认命令；距上次续期不足 every 时返回空。
+func (w *commandWatches) held(now time.Time, window, every time.Duration) []watchDelivery {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if now.Sub(w.renewedAt) < every {
+		return nil
+	}
+	w.renewedAt = now
+	out := make([]watchDelivery, 0)
+	for _, session := range w.sessions {
+		if session.streams <= 0 && now.Sub(session.detachedAt) >= window {
+			continue
+		}
+		for _, item := range session.inflight {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// WatchCommands 向订阅的 ingress 实例推送下行命令。
+// 流建立后先补发游标之后未确认的命令，再扫描全部订阅设备，之后按入队通知即时推送。
+func (s *CoreService) WatchCommands(ctx context.Context, req *connect.Request[ingressv1.WatchCommandsRequest], stream *connect.ServerStream[ingressv1.WatchCommandsResponse]) error {
+	if req == nil || req.Msg == nil {
+		return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("%w: request is required", errInvalidIngressRequest))
+	}
+	if err := authorizeCaller(ctx, req.Msg.GetContext()); err != nil {
+		return err
+	}
+	targets, err := s.watchTargets(req.Msg.GetSubscriptions())
+	if err != nil {
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	for key, target := range targets {
+		if _, err := s.authorizeDevice(ctx, target.uuid); err != nil {
+			return err
+		}
+		if target.source != "" {
+			if target.tenantID, err = callerTenant(ctx, req.Msg.GetContext().GetTenantId()); err != nil {
+				return connect.NewError(connect.CodePermissionDenied, err)
+			}
+			targets[key] = target
+		}
+	}
+	maxBatch := int(req.Msg.GetMaxBatch())
+	if maxBatch <= 0 {
+		maxBatch = defaultWatchBatch
+	}
+	w := &commandWatch{svc: s, stream: stream, session: s.watchSessionKey(req.Msg.GetContext()), targets: targets, maxBatch: maxBatch}
+
+	s.restoreExpiredWatches()
+	resend := s.watches.attach(w.session, req.Msg.GetCursor())
+	defer s.watches.detach(w.session, time.Now())
+	pending := make([]watchDelivery, 0, len(resend))
+	for _, item := range resend {
+		if _, ok := targets[item.target.key()]; ok {
+			pending = append(pending, item)
+			continue
+		}
+		// 设备已不在本次订阅中，放回队列交给新的订阅方。
+		_ = s.restoreDelivery(item)
+	}
+	if err := w.send(pending); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(targets))
+	for key := range targets {
+		keys = append(keys, key)
+	}
+	var ready <-chan struct{}
+	var sub inter.CommandSubscription
+	if s.notifier != nil {
+		sub = s.notifier.Subscribe(keys)
+		defer sub.Close()
+		ready = sub.Ready()
+	}
+	// 订阅建立之后再完整扫描一次，避免遗漏订阅前已经入队的命令。
+	if err := w.drain(keys); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.watchKeepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ready:
+			if err := w.drain(sub.Drain()); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			s.restoreExpiredWatches()
+			s.renewWatchClaims(ctx)
+			if err := w.drain(keys); err != nil {
+				return err
+			}
+			if err := stream.Send(&ingressv1.WatchCommandsResponse{Keepalive: true}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// commandWatch 是单条推送流的运行状态。
+type commandWatch struct {
+	svc      *CoreService
+	stream   *connect.ServerStream[ingressv1.WatchCommandsResponse]
+	session  string
+	targets  map[string]watchTarget
+	maxBatch int
+}
+
+func (w *commandWatch) drain(keys []string) error {
+	for _, key := range keys {
+		target, ok := w.targets[key]
+		if !ok {
+			continue
+		}
+		for {
+			items, err := w.svc.popWatchCommands(target, w.maxBatch)
+			// 出错前已经领取的命令也要先登记推送，否则会从队列中丢失。
+			if sendErr := w.send(items); sendErr != nil {
+				return sendErr
+			}
+			if err != nil {
+				return connect.NewError(connect.CodeInternal, err)
+			}
+			if len(items) < w.maxBatch {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// send 先登记再发送，发送失败的命令保留在会话中等待重连补发或超时回队。
+func (w *commandWatch) send(items []watchDelivery) error {
+	for len(items) > 0 {
+		n := len(items)
+		if n > w.maxBatch {
+			n = w.maxBatch
+		}
+		batch := items[:n]
+		items = items[n:]
+		cursor := w.svc.watches.record(w.session, batch)
+		commands := make([]*ingressv1.CanonicalCommand, 0, len(batch))
+		for _, item := range batch {
+			commands = append(commands, item.command)
+		}
+		if err := w.stream.Send(&ingressv1.WatchCommandsResponse{Commands: commands, Cursor: cursor}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CoreService) popWatchCommands(target watchTarget, maxCount int) ([]watchDelivery, error) {
+	var (
+		commands []*ingressv1.CanonicalCommand
+		err      error
+	)
+	if target.source != "" {
+		commands, err = s.pullExternalCommands(target.tenantID, target.uuid, target.source, target.identity, int32(maxCount))
+	} else {
+		commands, err = s.popDeviceCommands(target.uuid, maxCount)
+	}
+	items := make([]watchDelivery, 0, len(commands))
+	for _, cmd := range commands {
+		items = append(items, watchDelivery{target: target, command: cmd})
+	}
+	return items, err
+}
+
+// watchTargets 解析订阅列表；外部集成身份只有在启用外部命令时才按外部设备订阅。
+func (s *CoreService) watchTargets(subs []*ingressv1.CommandSubscription) (map[string]watchTarget, error) {
+	targets := make(map[string]watchTarget, len(subs))
+	for _, sub := range subs {
+		uuid := strings.TrimSpace(sub.GetUuid())
+		if uuid == "" {
+			uuid = strings.TrimSpace(sub.GetPrimaryIdentity().GetValue())
+		}
+		if uuid == "" {
+			uuid = identityValue(sub.GetIdentities(), "uuid")
+		}
+		if uuid == "" {
+			return nil, fmt.Errorf("%w: subscription uuid is required", errInvalidIngressRequest)
+		}
+		target := watchTarget{uuid: uuid}
+		if s.externalCommands != nil {
+			if source, identity := externalTarget(sub.GetPrimaryIdentity(), sub.GetIdentities()); source != "" {
+				target.source, target.identity = source, identity
+			}
+		}
+		targets[target.key()] = target
+	}
+	return targets, nil
+}
+
+// watchSessionKey 以 ingress 实例与 adapter 标识推送会话；两者都缺失时会话无法恢复。
+func (s *CoreService) watchSessionKey(ictx *ingressv1.IngressContext) string {
+	instance := strings.TrimSpace(ictx.GetSourceInstance())
+	adapterID := strings.TrimSpace(ictx.GetAdapterId())
+	if instance == "" && adapterID == "" {
+		return s.watches.anonymousKey()
+	}
+	return instance + "/" + adapterID
+}
+
+// restoreExpiredWatches 把超过恢复窗口仍未重连的会话中的命令放回队列。
+func (s *CoreService) restoreExpiredWatches() {
+	for _, item := range s.watches.expire(time.Now(), s.watchResume) {
+		_ = s.restoreDelivery(item)
+	}
+}
+
+// renewWatchClaims 续期推送会话持有的命令的领取租约，命令在回执或超时回队前不会被队列重新领取。
+func (s *CoreService) renewWatchClaims(ctx context.Context) {
+	items := s.watches.held(time.Now(), s.watchResume, s.watchKeepalive/2)
+	if len(items) == 0 {
+		return
+	}
+	devices := make([]int64, 0, len(items))
+	external := make(map[string][]int64)
+	for _, item := range items {
+		if item.target.source != "" {
+			external[item.target.tenantID] = append(external[item.target.tenantID], item.command.GetCommandId())
+			continue
+		}
+		devices = append(devices, item.command.GetCommandId())
+	}
+	if len(devices) > 0 {
+		if err := s.downlinkCommands.RenewClaims(devices); err != nil {
+			logger.FromContext(ctx).Warn("续期推送中指令的领取租约失败", inter.Err(err))
+		}
+	}
+	for tenantID, ids := range external {
+		if err := s.externalCommands.RenewClaims(tenantID, ids); err != nil {
+			logger.FromContext(ctx).Warn("续期推送中外部命令的领取租约失败", inter.String("tenant_id", tenantID), inter.Err(err))
+		}
+	}
+}
+
+func (s *CoreService) restoreDelivery(item watchDelivery) error {
+	cmd := item.command
+	if item.target.source != "" {
+		if err := s.externalCommands.UpdateStatus(item.target.tenantID, cmd.GetCommandId(), inter.ExternalCommandStatusPending, ""); err != nil {
+			return err
+		}
+		s.notify(item.target.key())
+		return nil
+	}
+	return s.downlinkCommands.Requeue(cmd.GetUuid(), inter.DownlinkMessage{
+		CommandID: cmd.GetCommandId(),
+		CmdID:     inter.CmdID(cmd.GetProtocolCommandCode()),
+		Payload:   rawPayloadBytes(cmd.GetPayload()),
+	})
+}
+
+func (s *CoreService) notify(key string) {
+	if s.notifier != nil {
+		s.notifier.Notify(key)
+	}
+}
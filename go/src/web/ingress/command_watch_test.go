@@ -0,0 +1,228 @@
+package ingress
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1/ingressv1connect"
+	"github.com/nhirsama/Goster-IoT/src/device_manager"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+type fakeCommandRepository struct {
+	mu       sync.Mutex
+	nextID   int64
+	statuses map[int64]inter.DeviceCommandStatus
+}
+
+func (f *fakeCommandRepository) CreateDeviceCommand(uuid string, cmdID inter.CmdID, command string, payloadJSON []byte) (int64, error) {
+	return f.CreateDeviceCommandByTenant("", uuid, cmdID, command, payloadJSON)
+}
+
+func (f *fakeCommandRepository) CreateDeviceCommandByTenant(tenantID, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte) (int64, error) {
+	return f.CreateDeviceCommandWithPolicy(tenantID, uuid, cmdID, command, payloadJSON, inter.DeviceCommandPolicy{})
+}
+
+func (f *fakeCommandRepository) CreateDeviceCommandWithPolicy(tenantID, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte, policy inter.DeviceCommandPolicy) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	return f.nextID, nil
+}
+
+func (f *fakeCommandRepository) UpdateDeviceCommandStatus(commandID int64, status inter.DeviceCommandStatus, errorText string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.statuses == nil {
+		f.statuses = map[int64]inter.DeviceCommandStatus{}
+	}
+	f.statuses[commandID] = status
+	return nil
+}
+
+func (f *fakeCommandRepository) TransitionDeviceCommandStatus(commandID int64, from, to inter.DeviceCommandStatus, errorText string) (bool, error) {
+	return true, f.UpdateDeviceCommandStatus(commandID, to, errorText)
+}
+
+func (f *fakeCommandRepository) GetDeviceCommand(commandID int64) (inter.DeviceCommand, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status, ok := f.statuses[commandID]
+	if !ok {
+		status = inter.DeviceCommandStatusQueued
+	}
+	return inter.DeviceCommand{ID: commandID, Status: status}, nil
+}
+
+func (f *fakeCommandRepository) GetDeviceCommandByTenant(tenantID string, commandID int64) (inter.DeviceCommand, error) {
+	return f.GetDeviceCommand(commandID)
+}
+
+func (f *fakeCommandRepository) ListDeviceCommandsByTenant(tenantID, uuid string, query inter.DeviceCommandQuery) ([]inter.DeviceCommand, error) {
+	return nil, nil
+}
+
+func (f *fakeCommandRepository) MarkDeviceCommandSent(commandID int64, sentAt time.Time, ackDeadline *time.Time, via inter.CommandDelivery) error {
+	return f.UpdateDeviceCommandStatus(commandID, inter.DeviceCommandStatusSent, "")
+}
+
+func (f *fakeCommandRepository) SupersedeDeviceCommands(uuid, command, key string, newerID int64) ([]int64, error) {
+	return nil, nil
+}
+
+func (f *fakeCommandRepository) ListStaleDeviceCommands(now time.Time, limit int) ([]inter.DeviceCommand, error) {
+	return nil, nil
+}
+
+func newWatchTestServer(t *testing.T) (*CoreService, inter.DownlinkCommandService, ingressv1connect.ProtocolIngressCoreServiceClient) {
+	t.Helper()
+	notifier := device_manager.NewCommandNotifier()
+	downlink := device_manager.NewDownlinkCommandServiceWithNotifier(&fakeCommandRepository{}, device_manager.NewDeviceCommandQueue(8), notifier)
+	resolver := fakeTenantResolver{tenants: map[string]string{"dev-1": "tenant-a"}}
+	svc := NewCoreService(newFakeRegistry(), &fakePresence{}, &fakeTelemetry{}, downlink, resolver, WithCommandNotifier(notifier))
+	svc.watchKeepalive = 50 * time.Millisecond
+
+	mux := http.NewServeMux()
+	mux.Handle(ingressv1connect.NewProtocolIngressCoreServiceHandler(svc))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return svc, downlink, ingressv1connect.NewProtocolIngressCoreServiceClient(server.Client(), server.URL)
+}
+
+func openWatch(t *testing.T, client ingressv1connect.ProtocolIngressCoreServiceClient, cursor int64) (*connect.ServerStreamForClient[ingressv1.WatchCommandsResponse], context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	stream, err := client.WatchCommands(ctx, connect.NewRequest(&ingressv1.WatchCommandsRequest{
+		Context:       &ingressv1.IngressContext{SourceInstance: "ingress-1", AdapterId: "mqtt"},
+		Subscriptions: []*ingressv1.CommandSubscription{{Uuid: "dev-1"}},
+		Cursor:        cursor,
+	}))
+	if err != nil {
+		cancel()
+		t.Fatalf("watch commands failed: %v", err)
+	}
+	return stream, func() {
+		cancel()
+		_ = stream.Close()
+	}
+}
+
+// nextBatch 跳过 keepalive 帧，返回下一个携带命令的批次。
+func nextBatch(t *testing.T, stream *connect.ServerStreamForClient[ingressv1.WatchCommandsResponse]) *ingressv1.WatchCommandsResponse {
+	t.Helper()
+	for stream.Receive() {
+		if msg := stream.Msg(); !msg.GetKeepalive() {
+			return msg
+		}
+	}
+	t.Fatalf("stream closed before next batch: %v", stream.Err())
+	return nil
+}
+
+func TestWatchCommandsPushesEnqueuedCommandsAndResumesFromCursor(t *testing.T) {
+	svc, downlink, client := newWatchTestServer(t)
+	first, err := downlink.Enqueue(inter.Scope{}, "dev-1", inter.CmdConfigPush, "config_push", []byte(`{"a":1}`))
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	stream, closeStream := openWatch(t, client, 0)
+	batch := nextBatch(t, stream)
+	if len(batch.GetCommands()) != 1 || batch.GetCommands()[0].GetCommandId() != first.CommandID || batch.GetCommands()[0].GetTenantId() != "tenant-a" {
+		t.Fatalf("expected queued command on subscribe, got %+v", batch.GetCommands())
+	}
+	processed := batch.GetCursor()
+
+	second, err := downlink.Enqueue(inter.Scope{}, "dev-1", inter.CmdActionExec, "action_exec", []byte(`{"op":"reboot"}`))
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	pushed := nextBatch(t, stream)
+	if len(pushed.GetCommands()) != 1 || pushed.GetCommands()[0].GetCommandId() != second.CommandID || pushed.GetCursor() <= processed {
+		t.Fatalf("expected pushed command with later cursor, got %+v cursor=%d", pushed.GetCommands(), pushed.GetCursor())
+	}
+	// 模拟 adapter 在处理第二批之前断线。
+	closeStream()
+
+	stream, closeStream = openWatch(t, client, processed)
+	resent := nextBatch(t, stream)
+	if len(resent.GetCommands()) != 1 || resent.GetCommands()[0].GetCommandId() != second.CommandID {
+		t.Fatalf("expected unprocessed command to be resent, got %+v", resent.GetCommands())
+	}
+	if _, err := svc.UpdateCommandStatus(context.Background(), connect.NewRequest(&ingressv1.UpdateCommandStatusRequest{
+		CommandId: second.CommandID,
+		Status:    ingressv1.CommandStatus_COMMAND_STATUS_SENT,
+	})); err != nil {
+		t.Fatalf("update status failed: %v", err)
+	}
+	closeStream()
+
+	// 第一条已由游标确认、第二条已回执，重连后不应再补发任何命令。
+	stream, closeStream = openWatch(t, client, 0)
+	defer closeStream()
+	if !stream.Receive() || !stream.Msg().GetKeepalive() {
+		t.Fatalf("expected only keepalive after settled commands, got %+v err=%v", stream.Msg(), stream.Err())
+	}
+}
+
+func TestCommandWatchesExpireDetachedSessions(t *testing.T) {
+	watches := newCommandWatches(time.Unix(100, 0))
+	watches.attach("ingress-1/mqtt", 0)
+	cursor := watches.record("ingress-1/mqtt", []watchDelivery{
+		{target: watchTarget{uuid: "dev-1"}, command: &ingressv1.CanonicalCommand{CommandId: 1, Uuid: "dev-1"}},
+		{target: watchTarget{uuid: "dev-1"}, command: &ingressv1.CanonicalCommand{CommandId: 2, Uuid: "dev-1"}},
+	})
+	watches.settle(watchCommandKey(false, 2))
+
+	now := time.Unix(200, 0)
+	if items := watches.expire(now, time.Minute); len(items) != 0 {
+		t.Fatalf("attached session should not expire: %+v", items)
+	}
+	watches.detach("ingress-1/mqtt", now)
+	if items := watches.expire(now.Add(30*time.Second), time.Minute); len(items) != 0 {
+		t.Fatalf("session within resume window should not expire: %+v", items)
+	}
+	items := watches.expire(now.Add(time.Minute), time.Minute)
+	if len(items) != 1 || items[0].command.GetCommandId() != 1 || items[0].seq != cursor {
+		t.Fatalf("expected unsettled command to expire, got %+v", items)
+	}
+	if resend := watches.attach("ingress-1/mqtt", 0); len(resend) != 0 {
+		t.Fatalf("expired session should start empty, got %+v", resend)
+	}
+}
+
+func TestRenewWatchClaimsCoversHeldCommands(t *testing.T) {
+	svc, _, _, _, downlink := newTestCoreService()
+	external := &fakeExternalCommands{}
+	WithExternalCommands(external)(svc)
+	svc.watchKeepalive = time.Minute
+	svc.watches.attach("ingress-1/mqtt", 0)
+	svc.watches.record("ingress-1/mqtt", []watchDelivery{
+		{target: watchTarget{uuid: "dev-1"}, command: &ingressv1.CanonicalCommand{CommandId: 1, Uuid: "dev-1"}},
+		{target: watchTarget{uuid: "dev-1"}, command: &ingressv1.CanonicalCommand{CommandId: 2, Uuid: "dev-1"}},
+		{target: watchTarget{uuid: "zb-1", source: "z2m", identity: &ingressv1.DeviceIdentity{Value: "zb-1"}, tenantID: "tenant-a"}, command: &ingressv1.CanonicalCommand{CommandId: 7}},
+	})
+	svc.watches.settle(watchCommandKey(false, 2))
+	// 断开但仍在恢复窗口内的会话继续持有命令。
+	svc.watches.detach("ingress-1/mqtt", time.Now())
+
+	svc.renewWatchClaims(context.Background())
+	if len(downlink.renewed) != 1 || downlink.renewed[0] != 1 {
+		t.Fatalf("expected held device command to be renewed, got %v", downlink.renewed)
+	}
+	if len(external.renewed) != 1 || external.renewed[0] != "tenant-a:7" {
+		t.Fatalf("expected held external command to be renewed in its tenant, got %v", external.renewed)
+	}
+
+	// 同一保活周期内多条推送流只续期一次。
+	svc.renewWatchClaims(context.Background())
+	if len(downlink.renewed) != 1 {
+		t.Fatalf("renewal should be shared within a keepalive period, got %v", downlink.renewed)
+	}
+}
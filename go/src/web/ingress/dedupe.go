@@ -0,0 +1,45 @@
+package ingress
+
+import (
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// WithIngestDedupe 按租户 + idempotency_key/event_id 对事件去重，ingress 重试时不会重复写入。
+func WithIngestDedupe(dedupe inter.IngestDedupeService) CoreServiceOption {
+	return func(s *CoreService) {
+		s.dedupe = dedupe
+	}
+}
+
+// dedupeKey 优先使用 idempotency_key，其次是 event_id；两者都为空的事件不参与去重。
+func dedupeKey(event *ingressv1.CanonicalDeviceEvent) string {
+	if key := strings.TrimSpace(event.GetIdempotencyKey()); key != "" {
+		return "idem:" + key
+	}
+	if id := strings.TrimSpace(event.GetEventId()); id != "" {
+		return "event:" + id
+	}
+	return ""
+}
+
+// duplicateResult 把台账记录还原成首次处理的结果；首次处理尚未结束时返回 in_progress，ingress 可稍后重试。
+func duplicateResult(event *ingressv1.CanonicalDeviceEvent, record inter.IngestDedupeRecord) *ingressv1.EventIngestResult {
+	result := &ingressv1.EventIngestResult{
+		EventId:   firstNonEmpty(record.EventID, event.GetEventId()),
+		Success:   record.Success,
+		Uuid:      record.UUID,
+		TenantId:  record.TenantID,
+		Duplicate: true,
+	}
+	if record.CompletedAt <= 0 {
+		result.ErrorCode = "in_progress"
+		result.ErrorMessage = "event is being processed"
+		return result
+	}
+	result.ErrorCode = record.ErrorCode
+	result.ErrorMessage = record.ErrorMessage
+	return result
+}
@@ -0,0 +1,279 @@
+package ingress
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var descriptorJSON = protojson.MarshalOptions{UseProtoNames: true}
+
+// ingestCapabilities 保存事件中设备及拓扑子设备上报的能力；尚未在 Core 登记的设备直接跳过，
+// 不属于网关租户或调用方凭据范围的子设备同样跳过，避免跨租户改写能力。
+func (s *CoreService) ingestCapabilities(ctx context.Context, uuid, tenantID string, event *ingressv1.CanonicalDeviceEvent) error {
+	if err := s.updateCapabilities(uuid, event.GetDevice()); err != nil {
+		return err
+	}
+	for _, child := range event.GetChildren() {
+		childUUID := topologyChildUUID(child)
+		if childUUID == "" || len(child.GetCapabilities()) == 0 {
+			continue
+		}
+		allowed, err := s.childInTenant(ctx, childUUID, tenantID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			continue
+		}
+		if err := s.updateCapabilities(childUUID, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// childInTenant 判断子设备能否随网关事件写入；未登记的子设备返回 false，由后续注册流程补齐。
+func (s *CoreService) childInTenant(ctx context.Context, childUUID, tenantID string) (bool, error) {
+	if s.tenantResolver == nil {
+		return true, nil
+	}
+	childTenant, err := s.tenantResolver.ResolveDeviceTenant(childUUID)
+	if errors.Is(err, inter.ErrDeviceNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if childTenant = strings.TrimSpace(childTenant); childTenant == "" {
+		childTenant = inter.DefaultTenantID
+	}
+	if childTenant != tenantID || !callerAllowsTenant(ctx, childTenant) {
+		logger.FromContext(ctx).Warn("子设备不属于网关租户，忽略其能力上报", inter.String("tenant_id", tenantID), inter.String("child_uuid", childUUID), inter.String("child_tenant_id", childTenant))
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *CoreService) updateCapabilities(uuid string, device *ingressv1.DeviceDescriptor) error {
+	capabilities := capabilitiesFromProto(device.GetCapabilities())
+	if len(capabilities) == 0 {
+		return nil
+	}
+	if err := s.registry.UpdateCapabilities(uuid, capabilities); err != nil && !errors.Is(err, inter.ErrDeviceNotFound) {
+		return err
+	}
+	return nil
+}
+
+// metadataFromDescriptor 把 adapter 上报的完整设备描述映射为 Core 设备模型。
+func metadataFromDescriptor(d *ingressv1.DeviceDescriptor) inter.DeviceMetadata {
+	if d == nil {
+		return inter.DeviceMetadata{}
+	}
+	return inter.DeviceMetadata{
+		Name:          d.GetName(),
+		SerialNumber:  d.GetSerialNumber(),
+		MACAddress:    d.GetMacAddress(),
+		HWVersion:     d.GetHardwareVersion(),
+		SWVersion:     firstNonEmpty(d.GetSoftwareVersion(), d.GetFirmwareVersion()),
+		ConfigVersion: d.GetConfigVersion(),
+		Descriptor: inter.DeviceDescriptor{
+			Manufacturer:     d.GetManufacturer(),
+			Vendor:           d.GetVendor(),
+			Model:            d.GetModel(),
+			ModelID:          d.GetModelId(),
+			FirmwareVersion:  d.GetFirmwareVersion(),
+			HardwareRevision: d.GetHardwareRevision(),
+			SoftwareBuildID:  d.GetSoftwareBuildId(),
+			PowerSource:      d.GetPowerSource(),
+			DeviceType:       d.GetDeviceType(),
+			Labels:           d.GetLabels(),
+			Attributes:       d.GetAttributes().AsMap(),
+			Entities:         marshalDescriptorList(d.GetEntities()),
+			Endpoints:        marshalDescriptorList(d.GetEndpoints()),
+			Capabilities:     capabilitiesFromProto(d.GetCapabilities()),
+		},
+		Identities: identitiesFromProto(d.GetIdentities()),
+	}
+}
+
+// deviceDescriptor 把 Core 设备模型回填为 DeviceDescriptor，labels 中附带设备所属租户。
+func deviceDescriptor(uuid string, meta inter.DeviceMetadata, tenantID string) *ingressv1.DeviceDescriptor {
+	d := meta.Descriptor
+	labels := make(map[string]string, len(d.Labels)+1)
+	for k, v := range d.Labels {
+		labels[k] = v
+	}
+	labels["tenant_id"] = tenantID
+	out := &ingressv1.DeviceDescriptor{
+		Uuid:             uuid,
+		Name:             meta.Name,
+		SerialNumber:     meta.SerialNumber,
+		MacAddress:       meta.MACAddress,
+		HardwareVersion:  meta.HWVersion,
+		SoftwareVersion:  meta.SWVersion,
+		ConfigVersion:    meta.ConfigVersion,
+		Manufacturer:     d.Manufacturer,
+		Vendor:           d.Vendor,
+		Model:            d.Model,
+		ModelId:          d.ModelID,
+		FirmwareVersion:  d.FirmwareVersion,
+		HardwareRevision: d.HardwareRevision,
+		SoftwareBuildId:  d.SoftwareBuildID,
+		PowerSource:      d.PowerSource,
+		DeviceType:       d.DeviceType,
+		Identities:       identitiesToProto(meta.Identities),
+		Entities:         unmarshalDescriptorList(d.Entities, func() *ingressv1.EntityDescriptor { return &ingressv1.EntityDescriptor{} }),
+		Endpoints:        unmarshalDescriptorList(d.Endpoints, func() *ingressv1.EndpointDescriptor { return &ingressv1.EndpointDescriptor{} }),
+		Capabilities:     capabilitiesToProto(d.Capabilities),
+		Labels:           labels,
+	}
+	if len(d.Attributes) > 0 {
+		if attrs, err := structpb.NewStruct(d.Attributes); err == nil {
+			out.Attributes = attrs
+		}
+	}
+	return out
+}
+
+// refreshedMetadata 返回用重新上报的版本与扩展描述覆盖后的设备模型，与 DeviceRegistry.RefreshDevice 的写入保持一致。
+func refreshedMetadata(existing, reported inter.DeviceMetadata) inter.DeviceMetadata {
+	existing.HWVersion = firstNonEmpty(reported.HWVersion, existing.HWVersion)
+	existing.SWVersion = firstNonEmpty(reported.SWVersion, existing.SWVersion)
+	existing.ConfigVersion = firstNonEmpty(reported.ConfigVersion, existing.ConfigVersion)
+	existing.Descriptor = reported.Descriptor
+	return existing
+}
+
+// descriptorIdentities 汇总请求中可用于解析设备的身份，显式身份优先于序列号与 MAC。
+func descriptorIdentities(meta inter.DeviceMetadata) []inter.DeviceIdentity {
+	return append(append([]inter.DeviceIdentity(nil), meta.Identities...),
+		inter.DeviceIdentity{Type: inter.DeviceIdentitySerial, Value: meta.SerialNumber},
+		inter.DeviceIdentity{Type: inter.DeviceIdentityMAC, Value: meta.MACAddress},
+	)
+}
+
+func identitiesFromProto(items []*ingressv1.DeviceIdentity) []inter.DeviceIdentity {
+	out := make([]inter.DeviceIdentity, 0, len(items))
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		out = append(out, inter.DeviceIdentity{Type: item.GetType(), Value: item.GetValue(), Issuer: item.GetIssuer()})
+	}
+	return out
+}
+
+func identitiesToProto(items []inter.DeviceIdentity) []*ingressv1.DeviceIdentity {
+	out := make([]*ingressv1.DeviceIdentity, 0, len(items))
+	for _, item := range items {
+		out = append(out, &ingressv1.DeviceIdentity{Type: item.Type, Value: item.Value, Issuer: item.Issuer})
+	}
+	return out
+}
+
+func capabilitiesFromProto(items []*ingressv1.CapabilityDescriptor) []inter.DeviceCapability {
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]inter.DeviceCapability, 0, len(items))
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		out = append(out, inter.DeviceCapability{
+			Name:          item.GetName(),
+			Property:      item.GetProperty(),
+			Type:          item.GetType(),
+			Access:        item.GetAccess(),
+			Readable:      item.GetReadable(),
+			Writable:      item.GetWritable(),
+			Unit:          item.GetUnit(),
+			ValueMin:      item.GetValueMin(),
+			ValueMax:      item.GetValueMax(),
+			Description:   item.GetDescription(),
+			AllowedValues: item.GetAllowedValues(),
+			Features:      capabilitiesFromProto(item.GetFeatures()),
+			Metadata:      item.GetMetadata().AsMap(),
+		})
+	}
+	return out
+}
+
+func capabilitiesToProto(items []inter.DeviceCapability) []*ingressv1.CapabilityDescriptor {
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]*ingressv1.CapabilityDescriptor, 0, len(items))
+	for _, item := range items {
+		c := &ingressv1.CapabilityDescriptor{
+			Name:          item.Name,
+			Property:      item.Property,
+			Type:          item.Type,
+			Access:        item.Access,
+			Readable:      item.Readable,
+			Writable:      item.Writable,
+			Unit:          item.Unit,
+			ValueMin:      item.ValueMin,
+			ValueMax:      item.ValueMax,
+			Description:   item.Description,
+			AllowedValues: item.AllowedValues,
+			Features:      capabilitiesToProto(item.Features),
+		}
+		if len(item.Metadata) > 0 {
+			if md, err := structpb.NewStruct(item.Metadata); err == nil {
+				c.Metadata = md
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// marshalDescriptorList 以 proto 字段名把实体、端点描述编码为 JSON 数组原样保存。
+func marshalDescriptorList[T proto.Message](items []T) json.RawMessage {
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		b, err := descriptorJSON.Marshal(item)
+		if err != nil {
+			continue
+		}
+		out = append(out, b)
+	}
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+func unmarshalDescriptorList[T proto.Message](raw json.RawMessage, newItem func() T) []T {
+	if len(raw) == 0 {
+		return nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil
+	}
+	out := make([]T, 0, len(items))
+	for _, item := range items {
+		msg := newItem()
+		if err := protojson.Unmarshal(item, msg); err != nil {
+			continue
+		}
+		out = append(out, msg)
+	}
+	return out
+}
@@ -0,0 +1,19 @@
+package ingress
+
+import "github.com/nhirsama/Goster-IoT/src/inter"
+
+// configVersionStateKey 是心跳 state 中携带设备当前配置版本的键。
+const configVersionStateKey = "config_version"
+
+// WithDeviceConfigs 启用配置对账：设备注册通过或心跳上报的配置版本落后于生效配置时自动下发。
+func WithDeviceConfigs(configs inter.DeviceConfigService) CoreServiceOption {
+	return func(s *CoreService) {
+		s.configs = configs
+	}
+}
+
+// heartbeatConfigVersion 从心跳 state 中取出配置版本，没有上报时返回空串。
+func heartbeatConfigVersion(state map[string]interface{}) string {
+	version, _ := state[configVersionStateKey].(string)
+	return version
+}
@@ -0,0 +1,10 @@
+package ingress
+
+import "github.com/nhirsama/Goster-IoT/src/inter"
+
+// WithDeviceDiagnostics 启用心跳诊断落库：心跳携带的 state 保存为设备最新诊断快照并按间隔采样。
+func WithDeviceDiagnostics(diagnostics inter.DeviceDiagnosticsService) CoreServiceOption {
+	return func(s *CoreService) {
+		s.diagnostics = diagnostics
+	}
+}
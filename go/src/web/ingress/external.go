@@ -0,0 +1,151 @@
+package ingress
+
+import (
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// externalSources 列出按外部实体入库的集成来源，其设备不在 Goster 设备表中注册。
+var externalSources = map[string]struct{}{
+	"zigbee2mqtt":    {},
+	"home_assistant": {},
+	"homeassistant":  {},
+}
+
+// metricDeviceClasses 把常见指标名映射为 Home Assistant 风格的 device_class。
+var metricDeviceClasses = map[string]string{
+	"temperature":        "temperature",
+	"device_temperature": "temperature",
+	"humidity":           "humidity",
+	"illuminance":        "illuminance",
+	"battery":            "battery",
+	"voltage":            "voltage",
+	"current":            "current",
+	"power":              "power",
+	"energy":             "energy",
+	"pressure":           "pressure",
+	"linkquality":        "signal_strength",
+}
+
+// binaryDeviceClasses 把布尔状态名映射为 binary_sensor 的 device_class。
+var binaryDeviceClasses = map[string]string{
+	"contact":     "door",
+	"occupancy":   "occupancy",
+	"presence":    "presence",
+	"water_leak":  "moisture",
+	"smoke":       "smoke",
+	"tamper":      "tamper",
+	"battery_low": "battery",
+}
+
+// WithExternalEntities 让外部集成事件写入外部实体与观测值，而不是按原生设备落库。
+func WithExternalEntities(externals inter.ExternalEntityService) CoreServiceOption {
+	return func(s *CoreService) {
+		s.externals = externals
+	}
+}
+
+// externalSource 返回事件所属的外部集成来源；原生 Goster 事件返回空串。
+// 依次检查 event_source、协议名、来源标签和身份类型前缀。
+func externalSource(event *ingressv1.CanonicalDeviceEvent) string {
+	candidates := []string{
+		event.GetEventSource(),
+		event.GetContext().GetProtocolName(),
+		event.GetContext().GetLabels()["source"],
+		event.GetDevice().GetLabels()["adapter_protocol"],
+	}
+	for _, candidate := range candidates {
+		candidate = strings.ToLower(strings.TrimSpace(candidate))
+		if _, ok := externalSources[candidate]; ok {
+			return candidate
+		}
+	}
+	identities := append([]*ingressv1.DeviceIdentity{event.GetPrimaryIdentity()}, event.GetIdentities()...)
+	for _, item := range identities {
+		typ := strings.ToLower(item.GetType())
+		for source := range externalSources {
+			if strings.HasPrefix(typ, source+"_") {
+				return source
+			}
+		}
+	}
+	return ""
+}
+
+// externalDeviceKey 返回外部设备在来源平台内的标识，例如 zigbee2mqtt 的 friendly_name。
+func externalDeviceKey(uuid string, event *ingressv1.CanonicalDeviceEvent) string {
+	if primary := event.GetPrimaryIdentity(); primary != nil && !strings.EqualFold(primary.GetType(), "uuid") {
+		if v := strings.TrimSpace(primary.GetValue()); v != "" {
+			return v
+		}
+	}
+	return firstNonEmpty(event.GetDevice().GetNetworkAddress(), event.GetDevice().GetName(), uuid)
+}
+
+// ingestExternal 把外部集成事件中的指标与状态点写成外部实体和观测值。
+// 外部实体与 Goster 设备的关联只能通过显式关联接口建立，这里不写 goster_uuid。
+func (s *CoreService) ingestExternal(uuid, tenantID, source string, event *ingressv1.CanonicalDeviceEvent) error {
+	deviceKey := externalDeviceKey(uuid, event)
+	device := event.GetDevice()
+	room := firstNonEmpty(device.GetLabels()["room"], device.GetLabels()["room_name"], event.GetContext().GetLabels()["room"])
+	var attributes map[string]interface{}
+	if device.GetAttributes() != nil {
+		attributes = device.GetAttributes().AsMap()
+	}
+
+	entities := make([]inter.ExternalEntity, 0, len(event.GetMetrics())+len(event.GetStates()))
+	observations := make([]inter.ExternalObservation, 0, cap(entities))
+	add := func(name, unit string, ts int64, entity inter.ExternalEntity, obs inter.ExternalObservation) {
+		entityID := deviceKey + "." + name
+		entity.TenantID, entity.Source, entity.EntityID = tenantID, source, entityID
+		entity.DeviceID = deviceKey
+		entity.Model = firstNonEmpty(device.GetModel(), device.GetModelId())
+		entity.Name = strings.TrimSpace(firstNonEmpty(device.GetName(), deviceKey) + " " + name)
+		entity.RoomName = room
+		entity.Unit = unit
+		entity.Attributes = attributes
+		entity.LastStateTS = ts
+		entities = append(entities, entity)
+
+		obs.TenantID, obs.Source, obs.EntityID = tenantID, source, entityID
+		obs.Timestamp = ts
+		obs.Unit = unit
+		observations = append(observations, obs)
+	}
+
+	for _, item := range event.GetMetrics() {
+		name := strings.TrimSpace(item.GetName())
+		if name == "" {
+			continue
+		}
+		if _, ok := item.GetValue().GetKind().(*ingressv1.Value_NumberValue); !ok {
+			continue
+		}
+		v := item.GetValue().GetNumberValue()
+		add(name, item.GetUnit(), timestampMillis(item.GetObservedAt().AsTime()),
+			inter.ExternalEntity{Domain: "sensor", ValueType: "number", DeviceClass: metricDeviceClasses[name], StateClass: "measurement", LastNum: &v},
+			inter.ExternalObservation{ValueNum: &v})
+	}
+	for _, state := range deviceStates(event.GetStates()) {
+		name := strings.TrimSpace(state.Name)
+		entity := inter.ExternalEntity{Domain: "sensor", ValueType: state.ValueType, LastNum: state.ValueNum, LastBool: state.ValueBool, LastText: state.ValueText}
+		switch {
+		case name == "state" || name == "switch":
+			entity.Domain = "switch"
+		case state.ValueBool != nil:
+			entity.Domain = "binary_sensor"
+			entity.DeviceClass = binaryDeviceClasses[name]
+		}
+		add(name, state.Unit, state.Timestamp, entity,
+			inter.ExternalObservation{ValueNum: state.ValueNum, ValueBool: state.ValueBool, ValueText: state.ValueText, ValueJSON: state.ValueJSON})
+	}
+
+	for _, entity := range entities {
+		if err := s.externals.UpsertExternalEntity(entity); err != nil {
+			return err
+		}
+	}
+	return s.externals.BatchAppendExternalObservations(observations)
+}
@@ -0,0 +1,107 @@
+package ingress
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// externalCommandUUIDPrefix 标记来自 integration_external_commands 的命令，回执据此与设备命令分流。
+const externalCommandUUIDPrefix = "extcmd_"
+
+// WithExternalCommands 让外部集成设备通过 PullCommands 领取发往外部实体的命令。
+func WithExternalCommands(commands inter.ExternalCommandService) CoreServiceOption {
+	return func(s *CoreService) {
+		s.externalCommands = commands
+	}
+}
+
+// externalTarget 从拉取或订阅请求的身份中找出外部来源与设备标识，例如 zigbee2mqtt_friendly_name。
+func externalTarget(primary *ingressv1.DeviceIdentity, others []*ingressv1.DeviceIdentity) (string, *ingressv1.DeviceIdentity) {
+	identities := append([]*ingressv1.DeviceIdentity{primary}, others...)
+	for _, item := range identities {
+		if strings.TrimSpace(item.GetValue()) == "" {
+			continue
+		}
+		typ := strings.ToLower(item.GetType())
+		for source := range externalSources {
+			if strings.HasPrefix(typ, source+"_") {
+				return source, item
+			}
+		}
+	}
+	return "", nil
+}
+
+// pullExternalCommands 只领取 tenantID 内的外部命令，tenantID 由 callerTenant 按调用方凭据得出。
+func (s *CoreService) pullExternalCommands(tenantID, uuid, source string, target *ingressv1.DeviceIdentity, maxCount int32) ([]*ingressv1.CanonicalCommand, error) {
+	items, err := s.externalCommands.PullPending(tenantID, source, strings.TrimSpace(target.GetValue()), int(maxCount))
+	if err != nil {
+		return nil, err
+	}
+	commands := make([]*ingressv1.CanonicalCommand, 0, len(items))
+	for _, item := range items {
+		body, err := json.Marshal(item.Payload)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, &ingressv1.CanonicalCommand{
+			CommandId:      item.ID,
+			CommandUuid:    externalCommandUUIDPrefix + strconv.FormatInt(item.ID, 10),
+			TenantId:       item.TenantID,
+			Uuid:           uuid,
+			TargetIdentity: &ingressv1.DeviceIdentity{Type: target.GetType(), Value: target.GetValue()},
+			TargetEntityId: item.EntityID,
+			Operation:      item.Command,
+			Payload:        &ingressv1.RawPayload{ContentType: "application/json", Body: body},
+			CreatedAt:      timestamppb.New(item.RequestedAt),
+			Labels:         map[string]string{"source": item.Source},
+		})
+	}
+	return commands, nil
+}
+
+// updateExternalCommandStatus 把 adapter 回执写回外部命令；REQUEUED 会让命令重新回到 pending 并唤醒推送流。
+func (s *CoreService) updateExternalCommandStatus(tenantID string, msg *ingressv1.UpdateCommandStatusRequest) error {
+	id := externalCommandID(msg)
+	var status inter.ExternalCommandStatus
+	switch msg.GetStatus() {
+	case ingressv1.CommandStatus_COMMAND_STATUS_SENT:
+		status = inter.ExternalCommandStatusSent
+	case ingressv1.CommandStatus_COMMAND_STATUS_ACKED:
+		status = inter.ExternalCommandStatusAcked
+	case ingressv1.CommandStatus_COMMAND_STATUS_FAILED, ingressv1.CommandStatus_COMMAND_STATUS_EXPIRED:
+		status = inter.ExternalCommandStatusFailed
+	case ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED:
+		status = inter.ExternalCommandStatusPending
+	default:
+		return fmt.Errorf("%w: unsupported command status: %s", errInvalidIngressRequest, msg.GetStatus())
+	}
+	if err := s.externalCommands.UpdateStatus(tenantID, id, status, msg.GetErrorText()); err != nil {
+		return err
+	}
+	if status == inter.ExternalCommandStatusPending {
+		if source, target := externalTarget(msg.GetTargetIdentity(), []*ingressv1.DeviceIdentity{msg.GetCommand().GetTargetIdentity()}); source != "" {
+			s.notify(inter.ExternalCommandKey(source, strings.TrimSpace(target.GetValue())))
+		}
+	}
+	return nil
+}
+
+func externalCommandID(msg *ingressv1.UpdateCommandStatusRequest) int64 {
+	id, err := strconv.ParseInt(strings.TrimPrefix(firstNonEmpty(msg.GetCommandUuid(), msg.GetCommand().GetCommandUuid()), externalCommandUUIDPrefix), 10, 64)
+	if err != nil || id <= 0 {
+		return msg.GetCommandId()
+	}
+	return id
+}
+
+func isExternalCommand(msg *ingressv1.UpdateCommandStatusRequest) bool {
+	return strings.HasPrefix(msg.GetCommandUuid(), externalCommandUUIDPrefix) ||
+		strings.HasPrefix(msg.GetCommand().GetCommandUuid(), externalCommandUUIDPrefix)
+}
@@ -2,16 +2,21 @@ package ingress
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"connectrpc.com/connect"
 	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
 	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/logger"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type CoreService struct {
@@ -19,23 +24,72 @@ type CoreService struct {
 	presence         inter.DevicePresence
 	telemetry        inter.TelemetryIngestService
 	downlinkCommands inter.DownlinkCommandService
+	states           inter.DeviceStateService
+	shadows          inter.DeviceShadowService
+	externals        inter.ExternalEntityService
+	externalCommands inter.ExternalCommandService
+	dedupe           inter.IngestDedupeService
+	topology         inter.DeviceTopologyService
+	diagnostics      inter.DeviceDiagnosticsService
+	configs          inter.DeviceConfigService
+	notifier         inter.CommandNotifier
+	watches          *commandWatches
+	watchKeepalive   time.Duration
+	watchResume      time.Duration
 	tenantResolver   interface {
 		ResolveDeviceTenant(uuid string) (string, error)
 	}
 }
 
+// CoreServiceOption 用于挂载 CoreService 的可选依赖。
+type CoreServiceOption func(*CoreService)
+
+// WithDeviceStates 启用设备状态点落库；未设置时事件中的状态点会被忽略。
+func WithDeviceStates(states inter.DeviceStateService) CoreServiceOption {
+	return func(s *CoreService) {
+		s.states = states
+	}
+}
+
+// WithDeviceShadows 把事件状态点与心跳 state 合并进设备影子的 reported。
+func WithDeviceShadows(shadows inter.DeviceShadowService) CoreServiceOption {
+	return func(s *CoreService) {
+		s.shadows = shadows
+	}
+}
+
 var errInvalidIngressRequest = errors.New("invalid ingress request")
 
+const tenantOutsideBindingReason = "device tenant is outside the adapter credential binding"
+
 func NewCoreService(registry inter.DeviceRegistry, presence inter.DevicePresence, telemetry inter.TelemetryIngestService, downlinkCommands inter.DownlinkCommandService, tenantResolver interface {
 	ResolveDeviceTenant(uuid string) (string, error)
-}) *CoreService {
-	return &CoreService{registry: registry, presence: presence, telemetry: telemetry, downlinkCommands: downlinkCommands, tenantResolver: tenantResolver}
+}, opts ...CoreServiceOption) *CoreService {
+	s := &CoreService{
+		registry:         registry,
+		presence:         presence,
+		telemetry:        telemetry,
+		downlinkCommands: downlinkCommands,
+		tenantResolver:   tenantResolver,
+		watches:          newCommandWatches(time.Now()),
+		watchKeepalive:   defaultWatchKeepalive,
+		watchResume:      defaultWatchResumeWindow,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+	return s
 }
 
 func (s *CoreService) AuthenticateDevice(ctx context.Context, req *connect.Request[ingressv1.AuthenticateDeviceRequest]) (*connect.Response[ingressv1.AuthenticateDeviceResponse], error) {
 	if req == nil || req.Msg == nil {
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("%w: request is required", errInvalidIngressRequest))
 	}
+	if err := authorizeCaller(ctx, req.Msg.GetContext()); err != nil {
+		return nil, err
+	}
 	token := credentialValue(req.Msg.GetCredentials(), "token")
 	if token == "" {
 		token = identityValue(req.Msg.GetIdentities(), "token")
@@ -47,7 +101,25 @@ func (s *CoreService) AuthenticateDevice(ctx context.Context, req *connect.Reque
 	if err != nil {
 		return connect.NewResponse(&ingressv1.AuthenticateDeviceResponse{Status: authStatusFromError(err), Reason: err.Error()}), nil
 	}
-	tenantID := s.resolveTenant(uuid)
+	tenantID, err := s.resolveTenant(uuid)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("resolve device tenant failed: %w", err))
+	}
+	if !callerAllowsTenant(ctx, tenantID) {
+		return connect.NewResponse(&ingressv1.AuthenticateDeviceResponse{Status: ingressv1.AuthStatus_AUTH_STATUS_REJECTED, Reason: tenantOutsideBindingReason}), nil
+	}
+	// 连接时声明的身份必须属于 token 对应的设备；未登记的身份在鉴权通过后登记到该设备。
+	identities := append(identitiesFromProto(req.Msg.GetIdentities()), identitiesFromProto(req.Msg.GetDeviceHint().GetIdentities())...)
+	owner, err := s.registry.ResolveDevice(identities)
+	switch {
+	case err == nil && owner != uuid:
+		return connect.NewResponse(&ingressv1.AuthenticateDeviceResponse{Status: ingressv1.AuthStatus_AUTH_STATUS_REJECTED, Reason: "identity is bound to another device"}), nil
+	case err != nil && !errors.Is(err, inter.ErrDeviceNotFound):
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("resolve device identity failed: %w", err))
+	}
+	if err := s.registry.BindIdentities(uuid, identities); err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("bind device identity failed: %w", err))
+	}
 	meta, err := s.registry.GetDeviceMetadata(uuid)
 	if err != nil {
 		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("load device metadata failed: %w", err))
@@ -64,11 +136,32 @@ func (s *CoreService) RegisterDevice(ctx context.Context, req *connect.Request[i
 	if req == nil || req.Msg == nil {
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("%w: request is required", errInvalidIngressRequest))
 	}
+	if err := authorizeCaller(ctx, req.Msg.GetContext()); err != nil {
+		return nil, err
+	}
 	meta := metadataFromDescriptor(req.Msg.GetDevice())
-	if strings.TrimSpace(meta.SerialNumber) == "" && strings.TrimSpace(meta.MACAddress) == "" {
-		return connect.NewResponse(&ingressv1.RegisterDeviceResponse{Status: ingressv1.RegistrationStatus_REGISTRATION_STATUS_REJECTED, Reason: "serial_number or mac_address is required"}), nil
+	hasSerial := strings.TrimSpace(meta.SerialNumber) != "" || strings.TrimSpace(meta.MACAddress) != ""
+	// 已登记的身份（例如更换网关后重新上报的 ieee_address）优先解析到原设备。
+	uuid, err := s.registry.ResolveDevice(descriptorIdentities(meta))
+	if err != nil {
+		if !errors.Is(err, inter.ErrDeviceNotFound) {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("resolve device identity failed: %w", err))
+		}
+		if !hasSerial {
+			return connect.NewResponse(&ingressv1.RegisterDeviceResponse{Status: ingressv1.RegistrationStatus_REGISTRATION_STATUS_REJECTED, Reason: "serial_number or mac_address is required"}), nil
+		}
+		uuid = s.registry.GenerateUUID(meta)
+	}
+	// 只有序列号与 MAC 生成的 uuid 与设备一致时才算同一台设备；单个身份命中只能重新挂回未通过认证的设备。
+	fullMatch := hasSerial && uuid == s.registry.GenerateUUID(meta)
+	// 新设备此时解析到默认租户，绑定了租户的凭据只能注册已预置到本租户的设备。
+	tenantID, err := s.resolveTenant(uuid)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("resolve device tenant failed: %w", err))
+	}
+	if !callerAllowsTenant(ctx, tenantID) {
+		return connect.NewResponse(&ingressv1.RegisterDeviceResponse{Status: ingressv1.RegistrationStatus_REGISTRATION_STATUS_REJECTED, Uuid: uuid, Reason: tenantOutsideBindingReason}), nil
 	}
-	uuid := s.registry.GenerateUUID(meta)
 	existing, err := s.registry.GetDeviceMetadata(uuid)
 	if err != nil {
 		if !errors.Is(err, inter.ErrDeviceNotFound) {
@@ -77,16 +170,34 @@ func (s *CoreService) RegisterDevice(ctx context.Context, req *connect.Request[i
 		if registerErr := s.registry.RegisterDevice(meta); registerErr != nil {
 			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("init device failed: %w", registerErr))
 		}
-		return connect.NewResponse(&ingressv1.RegisterDeviceResponse{Status: ingressv1.RegistrationStatus_REGISTRATION_STATUS_PENDING, Uuid: uuid, TenantId: s.resolveTenant(uuid), Device: deviceDescriptor(uuid, meta, s.resolveTenant(uuid))}), nil
+		if tenantID, err = s.resolveTenant(uuid); err != nil {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("resolve device tenant failed: %w", err))
+		}
+		return connect.NewResponse(&ingressv1.RegisterDeviceResponse{Status: ingressv1.RegistrationStatus_REGISTRATION_STATUS_PENDING, Uuid: uuid, TenantId: tenantID, Device: deviceDescriptor(uuid, meta, tenantID)}), nil
 	}
 
-	tenantID := s.resolveTenant(uuid)
+	// 注册请求未经设备认证：已认证设备只有序列号与 MAC 完全一致时才刷新描述，身份命中但序列号不符时拒绝且不返回 token。
+	if existing.AuthenticateStatus == inter.Authenticated && !fullMatch {
+		return connect.NewResponse(&ingressv1.RegisterDeviceResponse{Status: ingressv1.RegistrationStatus_REGISTRATION_STATUS_REJECTED, Uuid: uuid, TenantId: tenantID, Reason: "identity is bound to an authenticated device"}), nil
+	}
+	// 固件升级后设备会带着新版本重新注册，已认证设备同样刷新版本与扩展描述。
+	if existing.AuthenticateStatus == inter.AuthenticatePending || existing.AuthenticateStatus == inter.Authenticated {
+		if err := s.registry.RefreshDevice(uuid, meta); err != nil {
+			return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("refresh device descriptor failed: %w", err))
+		}
+		existing = refreshedMetadata(existing, meta)
+	}
 	switch existing.AuthenticateStatus {
 	case inter.AuthenticatePending:
 		return connect.NewResponse(&ingressv1.RegisterDeviceResponse{Status: ingressv1.RegistrationStatus_REGISTRATION_STATUS_PENDING, Uuid: uuid, TenantId: tenantID, Device: deviceDescriptor(uuid, existing, tenantID)}), nil
 	case inter.AuthenticateRefuse, inter.AuthenticateRevoked:
 		return connect.NewResponse(&ingressv1.RegisterDeviceResponse{Status: ingressv1.RegistrationStatus_REGISTRATION_STATUS_REJECTED, Uuid: uuid, TenantId: tenantID, Reason: "device registration refused", Device: deviceDescriptor(uuid, existing, tenantID)}), nil
 	case inter.Authenticated:
+		if s.configs != nil {
+			if err := s.configs.Reconcile(uuid, meta.ConfigVersion); err != nil {
+				return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("reconcile device config failed: %w", err))
+			}
+		}
 		return connect.NewResponse(&ingressv1.RegisterDeviceResponse{Status: ingressv1.RegistrationStatus_REGISTRATION_STATUS_ACCEPTED, Uuid: uuid, TenantId: tenantID, Credential: &ingressv1.Credential{Type: "token", Value: existing.Token}, Device: deviceDescriptor(uuid, existing, tenantID)}), nil
 	default:
 		return connect.NewResponse(&ingressv1.RegisterDeviceResponse{Status: ingressv1.RegistrationStatus_REGISTRATION_STATUS_REJECTED, Uuid: uuid, TenantId: tenantID, Reason: "unknown auth status", Device: deviceDescriptor(uuid, existing, tenantID)}), nil
@@ -107,47 +218,139 @@ func (s *CoreService) ReportHeartbeat(ctx context.Context, req *connect.Request[
 	if uuid == "" {
 		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("uuid is required"))
 	}
+	if err := authorizeCaller(ctx, req.Msg.GetContext()); err != nil {
+		return nil, err
+	}
+	tenantID, err := s.authorizeDevice(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	// 先合并 reported，确保设备上线触发的影子对账基于最新状态计算 delta。
+	var state map[string]interface{}
+	if len(req.Msg.GetState().GetFields()) > 0 {
+		state = req.Msg.GetState().AsMap()
+		observedAt := timestampMillis(req.Msg.GetObservedAt().AsTime())
+		if s.shadows != nil {
+			if err := s.shadows.ReportState(uuid, state, observedAt); err != nil {
+				return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("report shadow state failed: %w", err))
+			}
+		}
+		if s.diagnostics != nil {
+			if err := s.diagnostics.RecordHeartbeat(uuid, state, observedAt); err != nil {
+				return nil, connect.NewError(connect.CodeInternal, fmt.Errorf("record heartbeat diagnostics failed: %w", err))
+			}
+		}
+	}
+	if req.Msg.GetAvailability() == ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_OFFLINE {
+		s.presence.ReportAvailability(uuid, false, availabilityReason(req.Msg.GetContext(), "heartbeat_offline"))
+		return connect.NewResponse(&ingressv1.ReportHeartbeatResponse{Uuid: uuid, TenantId: tenantID, Availability: ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_OFFLINE}), nil
+	}
 	s.presence.HandleHeartbeat(uuid)
-	return connect.NewResponse(&ingressv1.ReportHeartbeatResponse{Uuid: uuid, TenantId: s.resolveTenant(uuid), Availability: ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_ONLINE}), nil
+	if s.configs != nil {
+		if err := s.configs.ReconcileHeartbeat(tenantID, uuid, heartbeatConfigVersion(state)); err != nil {
+			logger.FromContext(ctx).Warn("心跳配置对账失败，下一次心跳会重试", inter.String("uuid", uuid), inter.Err(err))
+		}
+	}
+	return connect.NewResponse(&ingressv1.ReportHeartbeatResponse{Uuid: uuid, TenantId: tenantID, Availability: ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_ONLINE}), nil
 }
 
 func (s *CoreService) IngestEvents(ctx context.Context, req *connect.Request[ingressv1.IngestEventsRequest]) (*connect.Response[ingressv1.IngestEventsResponse], error) {
 	if req == nil || req.Msg == nil {
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("%w: request is required", errInvalidIngressRequest))
 	}
-	results := make([]*ingressv1.EventIngestResult, 0, len(req.Msg.GetEvents()))
+	if err := authorizeCaller(ctx, req.Msg.GetContext()); err != nil {
+		return nil, err
+	}
+	resp := &ingressv1.IngestEventsResponse{Results: make([]*ingressv1.EventIngestResult, 0, len(req.Msg.GetEvents()))}
 	for _, event := range req.Msg.GetEvents() {
-		if event == nil {
-			results = append(results, &ingressv1.EventIngestResult{Success: false, ErrorCode: "event_required", ErrorMessage: "event is required"})
-			if !req.Msg.GetAllowPartialSuccess() {
-				return connect.NewResponse(&ingressv1.IngestEventsResponse{Results: results}), nil
-			}
+		result := s.ingestWithDedupe(ctx, req.Msg.GetContext(), event)
+		resp.Results = append(resp.Results, result)
+		if result.GetDuplicate() {
+			resp.DuplicateCount++
 			continue
 		}
-		uuid := event.GetDevice().GetUuid()
-		if uuid == "" {
-			uuid = event.GetPrimaryIdentity().GetValue()
+		if !result.GetSuccess() && !req.Msg.GetAllowPartialSuccess() {
+			break
+		}
+	}
+	return connect.NewResponse(resp), nil
+}
+
+// ingestWithDedupe 处理单个事件；带 event_id/idempotency_key 的成功事件会写入去重台账，失败事件释放占用以便重试。
+// 处理中的占用只有短租约，进程崩溃后重试可在租约过期后接管。
+// 设备租户超出调用方凭据绑定范围的事件以 tenant_forbidden 拒绝，不占用去重台账。
+// 外部集成事件的租户取自调用方凭据，reqCtx 是批量请求级别的上下文，事件未携带上下文时用它声明租户。
+func (s *CoreService) ingestWithDedupe(ctx context.Context, reqCtx *ingressv1.IngressContext, event *ingressv1.CanonicalDeviceEvent) *ingressv1.EventIngestResult {
+	if event == nil {
+		return &ingressv1.EventIngestResult{Success: false, ErrorCode: "event_required", ErrorMessage: "event is required"}
+	}
+	uuid := event.GetDevice().GetUuid()
+	if uuid == "" {
+		uuid = event.GetPrimaryIdentity().GetValue()
+	}
+	if uuid == "" {
+		uuid = identityValue(event.GetIdentities(), "uuid")
+	}
+	if uuid == "" {
+		return &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: false, ErrorCode: "uuid_required", ErrorMessage: "uuid is required"}
+	}
+	source := ""
+	if s.externals != nil {
+		source = externalSource(event)
+	}
+	if event.GetContext() != nil {
+		if err := authorizeCaller(ctx, event.GetContext()); err != nil {
+			return &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: false, Uuid: uuid, ErrorCode: "caller_forbidden", ErrorMessage: err.Error()}
+		}
+	}
+	var tenantID string
+	if source != "" {
+		var err error
+		tenantID, err = callerTenant(ctx, firstNonEmpty(event.GetContext().GetTenantId(), reqCtx.GetTenantId()))
+		if err != nil {
+			return &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: false, Uuid: uuid, ErrorCode: "tenant_forbidden", ErrorMessage: err.Error()}
 		}
-		if uuid == "" {
-			uuid = identityValue(event.GetIdentities(), "uuid")
+	} else {
+		var err error
+		if tenantID, err = s.resolveTenant(uuid); err != nil {
+			return &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: false, Uuid: uuid, ErrorCode: "tenant_unresolved", ErrorMessage: err.Error()}
 		}
-		if uuid == "" {
-			results = append(results, &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: false, ErrorCode: "uuid_required", ErrorMessage: "uuid is required"})
-			if !req.Msg.GetAllowPartialSuccess() {
-				return connect.NewResponse(&ingressv1.IngestEventsResponse{Results: results}), nil
-			}
-			continue
+		if !callerAllowsTenant(ctx, tenantID) {
+			return &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: false, Uuid: uuid, TenantId: tenantID, ErrorCode: "tenant_forbidden", ErrorMessage: tenantOutsideBindingReason}
 		}
-		if err := s.ingestOne(uuid, event); err != nil {
-			results = append(results, &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: false, Uuid: uuid, TenantId: s.resolveTenant(uuid), ErrorCode: "ingest_failed", ErrorMessage: err.Error()})
-			if !req.Msg.GetAllowPartialSuccess() {
-				return connect.NewResponse(&ingressv1.IngestEventsResponse{Results: results}), nil
+	}
+
+	key := ""
+	if s.dedupe != nil {
+		key = dedupeKey(event)
+	}
+	var record inter.IngestDedupeRecord
+	if key != "" {
+		existing, duplicate, err := s.dedupe.Reserve(tenantID, key, event.GetEventId(), uuid)
+		if err != nil {
+			return &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: false, Uuid: uuid, TenantId: tenantID, ErrorCode: "dedupe_failed", ErrorMessage: err.Error()}
+		}
+		if duplicate {
+			return duplicateResult(event, existing)
+		}
+		record = existing
+	}
+
+	if err := s.ingestEvent(ctx, uuid, tenantID, source, event); err != nil {
+		if key != "" {
+			if releaseErr := s.dedupe.Release(tenantID, key); releaseErr != nil {
+				logger.FromContext(ctx).Warn("释放事件去重占用失败，重试需等待占用租约过期", inter.String("tenant_id", tenantID), inter.String("dedupe_key", key), inter.Err(releaseErr))
 			}
-			continue
 		}
-		results = append(results, &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: true, Uuid: uuid, TenantId: s.resolveTenant(uuid)})
+		return &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: false, Uuid: uuid, TenantId: tenantID, ErrorCode: "ingest_failed", ErrorMessage: err.Error()}
+	}
+	if key != "" {
+		record.Success = true
+		if err := s.dedupe.Complete(record); err != nil {
+			logger.FromContext(ctx).Warn("写入事件去重结果失败，重复事件可能在占用租约过期后被再次处理", inter.String("tenant_id", tenantID), inter.String("dedupe_key", key), inter.Err(err))
+		}
 	}
-	return connect.NewResponse(&ingressv1.IngestEventsResponse{Results: results}), nil
+	return &ingressv1.EventIngestResult{EventId: event.GetEventId(), Success: true, Uuid: uuid, TenantId: tenantID}
 }
 
 func (s *CoreService) PullCommands(ctx context.Context, req *connect.Request[ingressv1.PullCommandsRequest]) (*connect.Response[ingressv1.PullCommandsResponse], error) {
@@ -164,22 +367,54 @@ func (s *CoreService) PullCommands(ctx context.Context, req *connect.Request[ing
 	if uuid == "" {
 		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("uuid is required"))
 	}
+	if err := authorizeCaller(ctx, req.Msg.GetContext()); err != nil {
+		return nil, err
+	}
+	if _, err := s.authorizeDevice(ctx, uuid); err != nil {
+		return nil, err
+	}
 	maxCount := req.Msg.GetMaxCount()
 	if maxCount <= 0 {
 		maxCount = 1
 	}
+	if s.externalCommands != nil {
+		if source, target := externalTarget(req.Msg.GetPrimaryIdentity(), req.Msg.GetIdentities()); source != "" {
+			tenantID, err := callerTenant(ctx, req.Msg.GetContext().GetTenantId())
+			if err != nil {
+				return nil, connect.NewError(connect.CodePermissionDenied, err)
+			}
+			commands, err := s.pullExternalCommands(tenantID, uuid, source, target, maxCount)
+			if err != nil {
+				return nil, connect.NewError(connect.CodeInternal, err)
+			}
+			return connect.NewResponse(&ingressv1.PullCommandsResponse{Commands: commands}), nil
+		}
+	}
+	commands, err := s.popDeviceCommands(uuid, int(maxCount))
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInternal, err)
+	}
+	return connect.NewResponse(&ingressv1.PullCommandsResponse{Commands: commands}), nil
+}
+
+// popDeviceCommands 从原生设备队列中最多领取 maxCount 条命令。
+func (s *CoreService) popDeviceCommands(uuid string, maxCount int) ([]*ingressv1.CanonicalCommand, error) {
+	tenantID, err := s.resolveTenant(uuid)
+	if err != nil {
+		return nil, err
+	}
 	commands := make([]*ingressv1.CanonicalCommand, 0, maxCount)
-	for i := int32(0); i < maxCount; i++ {
+	for i := 0; i < maxCount; i++ {
 		msg, ok, err := s.downlinkCommands.PopDownlink(uuid)
 		if err != nil {
-			return nil, connect.NewError(connect.CodeInternal, err)
+			return commands, err
 		}
 		if !ok {
 			break
 		}
-		commands = append(commands, canonicalCommand(uuid, s.resolveTenant(uuid), msg))
+		commands = append(commands, canonicalCommand(uuid, tenantID, msg))
 	}
-	return connect.NewResponse(&ingressv1.PullCommandsResponse{Commands: commands}), nil
+	return commands, nil
 }
 
 func (s *CoreService) UpdateCommandStatus(ctx context.Context, req *connect.Request[ingressv1.UpdateCommandStatusRequest]) (*connect.Response[ingressv1.UpdateCommandStatusResponse], error) {
@@ -190,41 +425,112 @@ func (s *CoreService) UpdateCommandStatus(ctx context.Context, req *connect.Requ
 	if commandID <= 0 {
 		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("%w: command_id is required", errInvalidIngressRequest))
 	}
+	if err := authorizeCaller(ctx, req.Msg.GetContext()); err != nil {
+		return nil, err
+	}
 	var err error
-	switch req.Msg.GetStatus() {
-	case ingressv1.CommandStatus_COMMAND_STATUS_SENT:
-		err = s.downlinkCommands.MarkSent(commandID)
-	case ingressv1.CommandStatus_COMMAND_STATUS_ACKED:
-		err = s.downlinkCommands.MarkAcked(commandID)
-	case ingressv1.CommandStatus_COMMAND_STATUS_FAILED, ingressv1.CommandStatus_COMMAND_STATUS_EXPIRED:
-		err = s.downlinkCommands.MarkFailed(commandID, req.Msg.GetErrorText())
-	case ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED:
-		err = s.requeue(req.Msg)
-	default:
-		err = fmt.Errorf("%w: unsupported command status: %s", errInvalidIngressRequest, req.Msg.GetStatus())
+	if s.externalCommands != nil && isExternalCommand(req.Msg) {
+		// 外部命令按调用方凭据的租户更新，其他租户的命令视为不存在。
+		tenantID, tenantErr := callerTenant(ctx, req.Msg.GetContext().GetTenantId())
+		if tenantErr != nil {
+			return nil, connect.NewError(connect.CodePermissionDenied, tenantErr)
+		}
+		if uuid := strings.TrimSpace(req.Msg.GetUuid()); uuid != "" {
+			if _, err := s.authorizeDevice(ctx, uuid); err != nil {
+				return nil, err
+			}
+		}
+		err = s.updateExternalCommandStatus(tenantID, req.Msg)
+		if err == nil || errors.Is(err, inter.ErrExternalCommandFinished) {
+			s.watches.settle(watchCommandKey(true, externalCommandID(req.Msg)))
+		}
+	} else {
+		record, authErr := s.authorizeCommand(ctx, commandID, req.Msg.GetUuid())
+		if authErr != nil {
+			return nil, authErr
+		}
+		s.watches.settle(watchCommandKey(false, commandID))
+		err = s.updateDeviceCommandStatus(record, req.Msg)
 	}
 	if err != nil {
 		if errors.Is(err, errInvalidIngressRequest) {
 			return nil, connect.NewError(connect.CodeInvalidArgument, err)
 		}
+		if errors.Is(err, inter.ErrExternalCommandNotFound) || errors.Is(err, inter.ErrDeviceCommandNotFound) {
+			return nil, connect.NewError(connect.CodeNotFound, err)
+		}
+		if errors.Is(err, inter.ErrDeviceCommandNotQueued) || errors.Is(err, inter.ErrDeviceCommandFinished) || errors.Is(err, inter.ErrExternalCommandFinished) {
+			return nil, connect.NewError(connect.CodeFailedPrecondition, err)
+		}
 		return nil, connect.NewError(connect.CodeInternal, err)
 	}
 	return connect.NewResponse(&ingressv1.UpdateCommandStatusResponse{Success: true, Status: req.Msg.GetStatus()}), nil
 }
 
+func (s *CoreService) updateDeviceCommandStatus(record inter.DeviceCommand, msg *ingressv1.UpdateCommandStatusRequest) error {
+	commandID := record.ID
+	switch msg.GetStatus() {
+	case ingressv1.CommandStatus_COMMAND_STATUS_SENT:
+		return s.downlinkCommands.MarkSentVia(commandID, commandDelivery(msg.GetContext()))
+	case ingressv1.CommandStatus_COMMAND_STATUS_ACKED:
+		return s.downlinkCommands.MarkAcked(commandID)
+	case ingressv1.CommandStatus_COMMAND_STATUS_FAILED:
+		return s.downlinkCommands.MarkFailed(commandID, msg.GetErrorText())
+	case ingressv1.CommandStatus_COMMAND_STATUS_EXPIRED:
+		return s.downlinkCommands.MarkExpired(commandID, msg.GetErrorText())
+	case ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED:
+		return s.requeue(record)
+	default:
+		return fmt.Errorf("%w: unsupported command status: %s", errInvalidIngressRequest, msg.GetStatus())
+	}
+}
+
+// ingestEvent 按事件来源分流：source 非空的外部集成事件写入 tenantID 下的外部实体，其余按原生设备处理。
+func (s *CoreService) ingestEvent(ctx context.Context, uuid, tenantID, source string, event *ingressv1.CanonicalDeviceEvent) error {
+	if event.GetEventType() == ingressv1.EventType_EVENT_TYPE_AVAILABILITY {
+		s.reportAvailability(uuid, event)
+	}
+	if err := s.ingestCapabilities(ctx, uuid, tenantID, event); err != nil {
+		return err
+	}
+	if s.topology != nil {
+		if snapshot, err := s.ingestTopology(uuid, event); err != nil || snapshot {
+			return err
+		}
+	}
+	if source != "" {
+		return s.ingestExternal(uuid, tenantID, source, event)
+	}
+	return s.ingestOne(uuid, event)
+}
+
 func (s *CoreService) ingestOne(uuid string, event *ingressv1.CanonicalDeviceEvent) error {
 	if len(event.GetMetrics()) > 0 {
 		if err := s.telemetry.IngestMetrics(uuid, metricPoints(event.GetMetrics())); err != nil {
 			return err
 		}
 	}
+	if len(event.GetStates()) > 0 {
+		states := deviceStates(event.GetStates())
+		if s.states != nil {
+			if err := s.states.IngestStates(uuid, states); err != nil {
+				return err
+			}
+		}
+		if s.shadows != nil {
+			reported, observedAt := shadowReported(states)
+			if err := s.shadows.ReportState(uuid, reported, observedAt); err != nil {
+				return err
+			}
+		}
+	}
 	for _, log := range event.GetLogs() {
 		if err := s.telemetry.IngestLog(uuid, logUploadData(log)); err != nil {
 			return err
 		}
 	}
 	if receipt := event.GetCommandReceipt(); receipt != nil {
-		if err := s.updateCommandReceipt(uuid, receipt); err != nil {
+		if err := s.updateCommandReceipt(uuid, receipt, event.GetContext()); err != nil {
 			return err
 		}
 	}
@@ -241,70 +547,65 @@ func (s *CoreService) ingestOne(uuid string, event *ingressv1.CanonicalDeviceEve
 	return nil
 }
 
-func (s *CoreService) requeue(req *ingressv1.UpdateCommandStatusRequest) error {
-	if req.GetCommandId() <= 0 {
-		return fmt.Errorf("%w: command_id is required for requeue", errInvalidIngressRequest)
-	}
-	uuid := strings.TrimSpace(req.GetUuid())
-	if uuid == "" {
-		uuid = strings.TrimSpace(req.GetCommand().GetUuid())
-	}
-	if uuid == "" {
-		uuid = strings.TrimSpace(req.GetTargetIdentity().GetValue())
+// commandDelivery 取出上报 SENT 的 ingress 实例与 adapter，写入命令的投递来源。
+func commandDelivery(ictx *ingressv1.IngressContext) inter.CommandDelivery {
+	return inter.CommandDelivery{
+		InstanceID: strings.TrimSpace(ictx.GetSourceInstance()),
+		AdapterID:  strings.TrimSpace(ictx.GetAdapterId()),
 	}
-	if uuid == "" {
-		return fmt.Errorf("%w: uuid is required for requeue", errInvalidIngressRequest)
-	}
-	cmdCode := req.GetProtocolCommandCode()
-	if cmdCode == 0 {
-		cmdCode = req.GetCommand().GetProtocolCommandCode()
-	}
-	if cmdCode == 0 {
-		return fmt.Errorf("%w: protocol_command_code is required for requeue", errInvalidIngressRequest)
-	}
-	payload := rawPayloadBytes(req.GetRaw())
-	if len(payload) == 0 {
-		payload = rawPayloadBytes(req.GetCommand().GetPayload())
-	}
-	if len(payload) == 0 {
-		return fmt.Errorf("%w: raw payload is required for requeue", errInvalidIngressRequest)
-	}
-	msg := inter.DownlinkMessage{CommandID: req.GetCommandId(), CmdID: inter.CmdID(cmdCode), Payload: payload}
-	return s.downlinkCommands.Requeue(uuid, msg)
 }
 
-func (s *CoreService) updateCommandReceipt(uuid string, receipt *ingressv1.CommandReceipt) error {
+// requeue 按落库的指令把它放回所属设备的队列，不采用回执中携带的 uuid 和载荷。
+func (s *CoreService) requeue(record inter.DeviceCommand) error {
+	msg := inter.DownlinkMessage{CommandID: record.ID, CmdID: record.CmdID, Payload: record.Payload}
+	return s.downlinkCommands.Requeue(record.UUID, msg)
+}
+
+func (s *CoreService) updateCommandReceipt(uuid string, receipt *ingressv1.CommandReceipt, ictx *ingressv1.IngressContext) error {
 	if receipt.GetCommandId() <= 0 {
 		return nil
 	}
+	if receipt.GetStatus() == ingressv1.CommandStatus_COMMAND_STATUS_UNSPECIFIED || receipt.GetStatus() == ingressv1.CommandStatus_COMMAND_STATUS_QUEUED {
+		return nil
+	}
+	// 事件的设备已经过租户校验，回执只能更新该设备自己的指令。
+	record, err := s.downlinkCommands.LookupCommand(receipt.GetCommandId())
+	if err != nil {
+		return err
+	}
+	if record.UUID != strings.TrimSpace(uuid) {
+		return fmt.Errorf("%w: command %d does not belong to device %s", errInvalidIngressRequest, record.ID, uuid)
+	}
+	s.watches.settle(watchCommandKey(false, receipt.GetCommandId()))
 	switch receipt.GetStatus() {
 	case ingressv1.CommandStatus_COMMAND_STATUS_SENT:
-		return s.downlinkCommands.MarkSent(receipt.GetCommandId())
+		return s.downlinkCommands.MarkSentVia(receipt.GetCommandId(), commandDelivery(ictx))
 	case ingressv1.CommandStatus_COMMAND_STATUS_ACKED:
 		return s.downlinkCommands.MarkAcked(receipt.GetCommandId())
-	case ingressv1.CommandStatus_COMMAND_STATUS_FAILED, ingressv1.CommandStatus_COMMAND_STATUS_EXPIRED:
+	case ingressv1.CommandStatus_COMMAND_STATUS_FAILED:
 		return s.downlinkCommands.MarkFailed(receipt.GetCommandId(), receipt.GetErrorText())
+	case ingressv1.CommandStatus_COMMAND_STATUS_EXPIRED:
+		return s.downlinkCommands.MarkExpired(receipt.GetCommandId(), receipt.GetErrorText())
 	case ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED:
-		cmdCode := receipt.GetProtocolCommandCode()
-		payload := rawPayloadBytes(receipt.GetRaw())
-		if strings.TrimSpace(uuid) == "" || cmdCode == 0 || len(payload) == 0 {
-			return fmt.Errorf("%w: command receipt requeue requires uuid, protocol_command_code and raw payload", errInvalidIngressRequest)
-		}
-		return s.downlinkCommands.Requeue(uuid, inter.DownlinkMessage{CommandID: receipt.GetCommandId(), CmdID: inter.CmdID(cmdCode), Payload: payload})
-	case ingressv1.CommandStatus_COMMAND_STATUS_UNSPECIFIED, ingressv1.CommandStatus_COMMAND_STATUS_QUEUED:
-		return nil
+		return s.requeue(record)
 	default:
 		return fmt.Errorf("%w: unsupported command receipt status: %s", errInvalidIngressRequest, receipt.GetStatus())
 	}
 }
 
-func (s *CoreService) resolveTenant(uuid string) string {
-	if s.tenantResolver != nil && strings.TrimSpace(uuid) != "" {
-		if tenantID, err := s.tenantResolver.ResolveDeviceTenant(uuid); err == nil && strings.TrimSpace(tenantID) != "" {
-			return strings.TrimSpace(tenantID)
-		}
+// resolveTenant 解析设备租户；尚未注册的设备归入默认租户，其他解析错误直接返回，不能按默认租户放行。
+func (s *CoreService) resolveTenant(uuid string) (string, error) {
+	if s.tenantResolver == nil || strings.TrimSpace(uuid) == "" {
+		return inter.DefaultTenantID, nil
+	}
+	tenantID, err := s.tenantResolver.ResolveDeviceTenant(uuid)
+	if err != nil && !errors.Is(err, inter.ErrDeviceNotFound) {
+		return "", err
 	}
-	return inter.DefaultTenantID
+	if tenantID = strings.TrimSpace(tenantID); tenantID == "" {
+		return inter.DefaultTenantID, nil
+	}
+	return tenantID, nil
 }
 
 func credentialValue(items []*ingressv1.Credential, typ string) string {
@@ -338,29 +639,118 @@ func authStatusFromError(err error) ingressv1.AuthStatus {
 	}
 }
 
-func metadataFromDescriptor(d *ingressv1.DeviceDescriptor) inter.DeviceMetadata {
-	if d == nil {
-		return inter.DeviceMetadata{}
-	}
-	return inter.DeviceMetadata{Name: d.GetName(), SerialNumber: d.GetSerialNumber(), MACAddress: d.GetMacAddress(), HWVersion: d.GetHardwareVersion(), SWVersion: firstNonEmpty(d.GetSoftwareVersion(), d.GetFirmwareVersion()), ConfigVersion: d.GetConfigVersion()}
-}
-
-func deviceDescriptor(uuid string, meta inter.DeviceMetadata, tenantID string) *ingressv1.DeviceDescriptor {
-	return &ingressv1.DeviceDescriptor{Uuid: uuid, Name: meta.Name, SerialNumber: meta.SerialNumber, MacAddress: meta.MACAddress, HardwareVersion: meta.HWVersion, SoftwareVersion: meta.SWVersion, ConfigVersion: meta.ConfigVersion, Labels: map[string]string{"tenant_id": tenantID}}
-}
-
+// metricPoints 转换指标点；没有名称也没有 legacy 类型、或取值不是数字/布尔/字符串的点会被丢弃。
 func metricPoints(items []*ingressv1.MetricPoint) []inter.MetricPoint {
 	out := make([]inter.MetricPoint, 0, len(items))
 	for _, item := range items {
 		if item == nil {
 			continue
 		}
-		value := float32(item.GetValue().GetNumberValue())
-		out = append(out, inter.MetricPoint{Timestamp: timestampMillis(item.GetObservedAt().AsTime()), Value: value, Type: uint8(item.GetLegacyMetricType())})
+		point := inter.MetricPoint{
+			Timestamp: timestampMillis(item.GetObservedAt().AsTime()),
+			Name:      strings.TrimSpace(item.GetName()),
+			Unit:      item.GetUnit(),
+			EntityID:  item.GetEntityId(),
+			Tags:      item.GetTags(),
+			Type:      uint8(item.GetLegacyMetricType()),
+		}
+		if point.Name == "" && point.Type == 0 {
+			continue
+		}
+		switch kind := item.GetValue().GetKind().(type) {
+		case *ingressv1.Value_NumberValue:
+			point.ValueType, point.Value = "number", kind.NumberValue
+		case *ingressv1.Value_BoolValue:
+			point.ValueType = "bool"
+			if kind.BoolValue {
+				point.Value = 1
+			}
+		case *ingressv1.Value_StringValue:
+			point.ValueType, point.ValueText = "string", kind.StringValue
+		default:
+			continue
+		}
+		out = append(out, point)
 	}
 	return out
 }
 
+func deviceStates(items []*ingressv1.StatePoint) []inter.DeviceState {
+	out := make([]inter.DeviceState, 0, len(items))
+	for _, item := range items {
+		if item == nil || strings.TrimSpace(item.GetName()) == "" {
+			continue
+		}
+		state := inter.DeviceState{Name: item.GetName(), EntityID: item.GetEntityId(), Unit: item.GetUnit(), Endpoint: endpointID(item.GetEndpoint()), Tags: item.GetTags(), Timestamp: timestampMillis(item.GetObservedAt().AsTime())}
+		switch kind := item.GetValue().GetKind().(type) {
+		case *ingressv1.Value_NumberValue:
+			v := kind.NumberValue
+			state.ValueType, state.ValueNum = "number", &v
+		case *ingressv1.Value_BoolValue:
+			v := kind.BoolValue
+			state.ValueType, state.ValueBool = "bool", &v
+		case *ingressv1.Value_StringValue:
+			v := kind.StringValue
+			state.ValueType, state.ValueText = "string", &v
+		case *ingressv1.Value_BytesValue:
+			v := base64.StdEncoding.EncodeToString(kind.BytesValue)
+			state.ValueType, state.ValueText = "string", &v
+		case *ingressv1.Value_JsonValue:
+			state.ValueType, state.ValueJSON = "json", kind.JsonValue.AsMap()
+		}
+		out = append(out, state)
+	}
+	return out
+}
+
+// shadowReported 把状态点折叠为影子 reported 文档；带 entity_id 的状态点按实体分组。
+func shadowReported(states []inter.DeviceState) (map[string]interface{}, int64) {
+	reported := map[string]interface{}{}
+	var observedAt int64
+	for _, item := range states {
+		var value interface{}
+		switch {
+		case item.ValueNum != nil:
+			value = *item.ValueNum
+		case item.ValueBool != nil:
+			value = *item.ValueBool
+		case item.ValueText != nil:
+			value = *item.ValueText
+		case item.ValueJSON != nil:
+			value = item.ValueJSON
+		default:
+			continue
+		}
+		if item.EntityID == "" {
+			reported[item.Name] = value
+		} else {
+			group, _ := reported[item.EntityID].(map[string]interface{})
+			if group == nil {
+				group = map[string]interface{}{}
+				reported[item.EntityID] = group
+			}
+			group[item.Name] = value
+		}
+		if item.Timestamp > observedAt {
+			observedAt = item.Timestamp
+		}
+	}
+	return reported, observedAt
+}
+
+func endpointID(ep *ingressv1.EndpointRef) string {
+	if ep == nil {
+		return ""
+	}
+	if id := strings.TrimSpace(ep.GetEndpointId()); id != "" {
+		return id
+	}
+	if ep.GetNumericEndpointId() > 0 {
+		return strconv.FormatUint(uint64(ep.GetNumericEndpointId()), 10)
+	}
+	return ""
+}
+
 func logUploadData(log *ingressv1.LogRecord) inter.LogUploadData {
 	return inter.LogUploadData{Timestamp: timestampMillis(log.GetObservedAt().AsTime()), Level: logLevel(log.GetLevel()), Message: log.GetMessage()}
 }
@@ -398,7 +788,18 @@ func logLevel(level ingressv1.LogLevel) inter.LogLevel {
 }
 
 func canonicalCommand(uuid, tenantID string, msg inter.DownlinkMessage) *ingressv1.CanonicalCommand {
-	return &ingressv1.CanonicalCommand{CommandId: msg.CommandID, TenantId: tenantID, Uuid: uuid, TargetIdentity: &ingressv1.DeviceIdentity{Type: "uuid", Value: uuid}, Operation: operationName(msg.CmdID), ProtocolCommandCode: uint32(msg.CmdID), Payload: &ingressv1.RawPayload{ContentType: "application/octet-stream", Body: msg.Payload}, AdapterOptions: structWithCommandCode(msg.CmdID)}
+	cmd := &ingressv1.CanonicalCommand{CommandId: msg.CommandID, TenantId: tenantID, Uuid: uuid, TargetIdentity: &ingressv1.DeviceIdentity{Type: "uuid", Value: uuid}, Operation: operationName(msg.CmdID), ProtocolCommandCode: uint32(msg.CmdID), Payload: &ingressv1.RawPayload{ContentType: "application/octet-stream", Body: msg.Payload}, AdapterOptions: structWithCommandCode(msg.CmdID), MaxAttempts: int32(msg.MaxAttempts)}
+	// adapter 据此在发送前丢弃已过期的命令，并按超时等待设备确认。
+	if msg.Timeout > 0 {
+		cmd.Timeout = durationpb.New(msg.Timeout)
+	}
+	if !msg.CreatedAt.IsZero() {
+		cmd.CreatedAt = timestamppb.New(msg.CreatedAt)
+	}
+	if !msg.ExpiresAt.IsZero() {
+		cmd.ExpiresAt = timestamppb.New(msg.ExpiresAt)
+	}
+	return cmd
 }
 
 func structWithCommandCode(cmd inter.CmdID) *structpb.Struct {
@@ -3,12 +3,14 @@ package ingress
 import (
 	"context"
 	"errors"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"connectrpc.com/connect"
 	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/src/device_manager"
 	"github.com/nhirsama/Goster-IoT/src/inter"
 	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -23,6 +25,9 @@ type fakeRegistry struct {
 	registerErr    error
 	lastAuthToken  string
 	metadataErrors map[string]error
+	identities     map[inter.DeviceIdentity]string
+	refreshed      []inter.DeviceMetadata
+	capabilities   map[string][]inter.DeviceCapability
 }
 
 func newFakeRegistry() *fakeRegistry {
@@ -31,6 +36,7 @@ func newFakeRegistry() *fakeRegistry {
 		tokens:         map[string]string{},
 		authErr:        map[string]error{},
 		metadataErrors: map[string]error{},
+		identities:     map[inter.DeviceIdentity]string{},
 	}
 }
 
@@ -108,18 +114,61 @@ func (f *fakeRegistry) ListDevices(status *inter.AuthenticateStatusType, page, s
 func (f *fakeRegistry) ListDevicesByScope(scope inter.Scope, status *inter.AuthenticateStatusType, page, size int) ([]inter.DeviceRecord, error) {
 	return nil, nil
 }
+func (f *fakeRegistry) ResolveDevice(identities []inter.DeviceIdentity) (string, error) {
+	for _, identity := range device_manager.NormalizeDeviceIdentities(identities) {
+		if uuid, ok := f.identities[inter.DeviceIdentity{Type: identity.Type, Value: identity.Value}]; ok {
+			return uuid, nil
+		}
+	}
+	return "", inter.ErrDeviceNotFound
+}
+func (f *fakeRegistry) RefreshDevice(uuid string, meta inter.DeviceMetadata) error {
+	f.refreshed = append(f.refreshed, meta)
+	return f.BindIdentities(uuid, meta.Identities)
+}
+func (f *fakeRegistry) BindIdentities(uuid string, identities []inter.DeviceIdentity) error {
+	for _, identity := range device_manager.NormalizeDeviceIdentities(identities) {
+		key := inter.DeviceIdentity{Type: identity.Type, Value: identity.Value}
+		if _, ok := f.identities[key]; !ok {
+			f.identities[key] = uuid
+		}
+	}
+	return nil
+}
+func (f *fakeRegistry) UpdateCapabilities(uuid string, capabilities []inter.DeviceCapability) error {
+	if _, ok := f.metas[uuid]; !ok {
+		return inter.ErrDeviceNotFound
+	}
+	if f.capabilities == nil {
+		f.capabilities = map[string][]inter.DeviceCapability{}
+	}
+	f.capabilities[uuid] = capabilities
+	return nil
+}
 func (f *fakeRegistry) GetDeviceMetadataByScope(scope inter.Scope, uuid string) (inter.DeviceMetadata, error) {
 	return f.GetDeviceMetadata(uuid)
 }
 
 type fakePresence struct {
-	heartbeats []string
+	heartbeats   []string
+	availability []string
 }
 
 func (f *fakePresence) HandleHeartbeat(uuid string) { f.heartbeats = append(f.heartbeats, uuid) }
 func (f *fakePresence) QueryDeviceStatus(uuid string) (inter.DeviceStatus, error) {
 	return inter.StatusOnline, nil
 }
+func (f *fakePresence) ReportAvailability(uuid string, online bool, reason string) {
+	state := "offline"
+	if online {
+		state = "online"
+	}
+	f.availability = append(f.availability, uuid+":"+state+":"+reason)
+}
+func (f *fakePresence) QueryConnectivityHistory(inter.Scope, string, inter.DeviceConnectivityQuery) ([]inter.DeviceConnectivityEvent, error) {
+	return nil, nil
+}
+func (f *fakePresence) Run(context.Context) {}
 
 type fakeTelemetry struct {
 	metrics []struct {
@@ -186,14 +235,19 @@ func (f *fakeTelemetry) IngestDeviceError(uuid string, payload []byte) error {
 }
 
 type fakeDownlink struct {
+	// commands 预置 LookupCommand 的结果；未预置的指令视为 dev-1 的指令。
+	commands map[int64]inter.DeviceCommand
 	queue    []inter.DownlinkMessage
 	requeues []struct {
 		uuid string
 		msg  inter.DownlinkMessage
 	}
-	sent   []int64
-	acked  []int64
-	failed []struct {
+	sent    []int64
+	renewed []int64
+	via     []inter.CommandDelivery
+	acked   []int64
+	expired []int64
+	failed  []struct {
 		id  int64
 		err string
 	}
@@ -201,7 +255,11 @@ type fakeDownlink struct {
 }
 
 func (f *fakeDownlink) Enqueue(scope inter.Scope, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte) (inter.DownlinkMessage, error) {
-	return inter.DownlinkMessage{CommandID: 1, CmdID: cmdID, Payload: payloadJSON}, nil
+	return f.EnqueueWithPolicy(scope, uuid, cmdID, command, payloadJSON, inter.DeviceCommandPolicy{})
+}
+
+func (f *fakeDownlink) EnqueueWithPolicy(scope inter.Scope, uuid string, cmdID inter.CmdID, command string, payloadJSON []byte, policy inter.DeviceCommandPolicy) (inter.DownlinkMessage, error) {
+	return inter.DownlinkMessage{CommandID: 1, CmdID: cmdID, Payload: payloadJSON, Timeout: policy.Timeout, MaxAttempts: policy.MaxAttempts}, nil
 }
 
 func (f *fakeDownlink) PopDownlink(uuid string) (inter.DownlinkMessage, bool, error) {
@@ -228,13 +286,37 @@ func (f *fakeDownlink) Requeue(uuid string, message inter.DownlinkMessage) error
 }
 
 func (f *fakeDownlink) MarkSent(commandID int64) error {
+	return f.MarkSentVia(commandID, inter.CommandDelivery{})
+}
+
+func (f *fakeDownlink) MarkSentVia(commandID int64, via inter.CommandDelivery) error {
 	if f.err != nil {
 		return f.err
 	}
 	f.sent = append(f.sent, commandID)
+	f.via = append(f.via, via)
 	return nil
 }
 
+func (f *fakeDownlink) Cancel(scope inter.Scope, commandID int64, reason string) (inter.DeviceCommand, error) {
+	return inter.DeviceCommand{}, inter.ErrDeviceCommandNotFound
+}
+
+func (f *fakeDownlink) GetCommand(scope inter.Scope, commandID int64) (inter.DeviceCommand, error) {
+	return inter.DeviceCommand{}, inter.ErrDeviceCommandNotFound
+}
+
+func (f *fakeDownlink) LookupCommand(commandID int64) (inter.DeviceCommand, error) {
+	if cmd, ok := f.commands[commandID]; ok {
+		return cmd, nil
+	}
+	return inter.DeviceCommand{ID: commandID, UUID: "dev-1", CmdID: inter.CmdActionExec}, nil
+}
+
+func (f *fakeDownlink) ListCommands(scope inter.Scope, uuid string, query inter.DeviceCommandQuery) ([]inter.DeviceCommand, int64, error) {
+	return nil, 0, nil
+}
+
 func (f *fakeDownlink) MarkAcked(commandID int64) error {
 	if f.err != nil {
 		return f.err
@@ -254,6 +336,155 @@ func (f *fakeDownlink) MarkFailed(commandID int64, errorText string) error {
 	return nil
 }
 
+func (f *fakeDownlink) MarkExpired(commandID int64, errorText string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.expired = append(f.expired, commandID)
+	return nil
+}
+
+func (f *fakeDownlink) RenewClaims(commandIDs []int64) error {
+	f.renewed = append(f.renewed, commandIDs...)
+	return f.err
+}
+
+func (f *fakeDownlink) ExpireStale() (int64, error) {
+	return 0, f.err
+}
+
+func (f *fakeDownlink) Run(ctx context.Context) {}
+
+type fakeDeviceStates struct {
+	ingested map[string][]inter.DeviceState
+}
+
+func (f *fakeDeviceStates) IngestStates(uuid string, states []inter.DeviceState) error {
+	if f.ingested == nil {
+		f.ingested = map[string][]inter.DeviceState{}
+	}
+	f.ingested[uuid] = append(f.ingested[uuid], states...)
+	return nil
+}
+func (f *fakeDeviceStates) ListStates(scope inter.Scope, uuid string) ([]inter.DeviceState, error) {
+	return f.ingested[uuid], nil
+}
+func (f *fakeDeviceStates) QueryStateHistory(scope inter.Scope, uuid string, query inter.DeviceStateHistoryQuery) ([]inter.DeviceState, error) {
+	return f.ingested[uuid], nil
+}
+
+type fakeDeviceShadows struct {
+	reported []map[string]interface{}
+}
+
+func (f *fakeDeviceShadows) GetShadow(scope inter.Scope, uuid string) (inter.DeviceShadow, error) {
+	return inter.DeviceShadow{UUID: uuid}, nil
+}
+func (f *fakeDeviceShadows) UpdateDesired(scope inter.Scope, uuid string, patch map[string]interface{}, expectedVersion *int64) (inter.DeviceShadow, error) {
+	return inter.DeviceShadow{UUID: uuid}, nil
+}
+func (f *fakeDeviceShadows) ReportState(uuid string, reported map[string]interface{}, observedAt int64) error {
+	f.reported = append(f.reported, reported)
+	return nil
+}
+func (f *fakeDeviceShadows) Reconcile(uuid string) error { return nil }
+
+type fakeDeviceDiagnostics struct {
+	inter.DeviceDiagnosticsService
+	states     []map[string]interface{}
+	observedAt []int64
+}
+
+func (f *fakeDeviceDiagnostics) RecordHeartbeat(uuid string, state map[string]interface{}, observedAt int64) error {
+	f.states = append(f.states, state)
+	f.observedAt = append(f.observedAt, observedAt)
+	return nil
+}
+
+type fakeDeviceConfigs struct {
+	inter.DeviceConfigService
+	reconciled   []string
+	versions     []string
+	heartbeats   []string
+	heartbeatErr error
+}
+
+func (f *fakeDeviceConfigs) Reconcile(uuid, reportedVersion string) error {
+	f.reconciled = append(f.reconciled, uuid)
+	f.versions = append(f.versions, reportedVersion)
+	return nil
+}
+
+func (f *fakeDeviceConfigs) ReconcileHeartbeat(tenantID, uuid, reportedVersion string) error {
+	f.heartbeats = append(f.heartbeats, tenantID+"/"+uuid+"@"+reportedVersion)
+	return f.heartbeatErr
+}
+
+type fakeExternalEntities struct {
+	inter.ExternalEntityService
+	entities     []inter.ExternalEntity
+	observations []inter.ExternalObservation
+}
+
+func (f *fakeExternalEntities) UpsertExternalEntity(entity inter.ExternalEntity) error {
+	f.entities = append(f.entities, entity)
+	return nil
+}
+func (f *fakeExternalEntities) BatchAppendExternalObservations(items []inter.ExternalObservation) error {
+	f.observations = append(f.observations, items...)
+	return nil
+}
+
+type fakeExternalCommands struct {
+	inter.ExternalCommandService
+	pending  []inter.ExternalCommand
+	pulled   []string
+	statuses map[int64]inter.ExternalCommandStatus
+	tenants  map[int64]string
+	renewed  []string
+}
+
+func (f *fakeExternalCommands) PullPending(tenantID, source, deviceID string, limit int) ([]inter.ExternalCommand, error) {
+	f.pulled = append(f.pulled, tenantID+":"+source+"/"+deviceID)
+	out := f.pending
+	f.pending = nil
+	return out, nil
+}
+func (f *fakeExternalCommands) RenewClaims(tenantID string, ids []int64) error {
+	for _, id := range ids {
+		f.renewed = append(f.renewed, tenantID+":"+strconv.FormatInt(id, 10))
+	}
+	return nil
+}
+func (f *fakeExternalCommands) UpdateStatus(tenantID string, id int64, status inter.ExternalCommandStatus, errorText string) error {
+	if f.statuses == nil {
+		f.statuses = map[int64]inter.ExternalCommandStatus{}
+		f.tenants = map[int64]string{}
+	}
+	f.statuses[id] = status
+	f.tenants[id] = tenantID
+	return nil
+}
+
+type fakeTopology struct {
+	inter.DeviceTopologyService
+	snapshots []string
+	parents   []string
+}
+
+func (f *fakeTopology) ApplyTopology(gateway inter.DeviceTopologyNode, children []inter.DeviceTopologyNode) error {
+	items := make([]string, 0, len(children))
+	for _, child := range children {
+		items = append(items, child.UUID+"/"+child.DeviceType)
+	}
+	f.snapshots = append(f.snapshots, gateway.UUID+"="+strings.Join(items, ","))
+	return nil
+}
+func (f *fakeTopology) ReportParent(node inter.DeviceTopologyNode) error {
+	f.parents = append(f.parents, node.UUID+"->"+node.ParentUUID)
+	return nil
+}
+
 type fakeTenantResolver struct {
 	tenants map[string]string
 	err     error
@@ -430,7 +661,7 @@ func TestIngestEventsWritesMetricsLogsRawAndCommandReceipts(t *testing.T) {
 	if len(resp.Msg.GetResults()) != 3 || !resp.Msg.GetResults()[0].GetSuccess() || !resp.Msg.GetResults()[1].GetSuccess() || !resp.Msg.GetResults()[2].GetSuccess() {
 		t.Fatalf("unexpected ingest response: %+v", resp.Msg)
 	}
-	if len(telemetry.metrics) != 1 || telemetry.metrics[0].uuid != "dev-1" || len(telemetry.metrics[0].points) != 1 || telemetry.metrics[0].points[0].Type != 1 || telemetry.metrics[0].points[0].Value != float32(21.5) {
+	if len(telemetry.metrics) != 1 || telemetry.metrics[0].uuid != "dev-1" || len(telemetry.metrics[0].points) != 1 || telemetry.metrics[0].points[0].Type != 1 || telemetry.metrics[0].points[0].Value != 21.5 || telemetry.metrics[0].points[0].ValueType != "number" {
 		t.Fatalf("unexpected metrics ingest: %+v", telemetry.metrics)
 	}
 	if len(telemetry.logs) != 1 || telemetry.logs[0].data.Level != inter.LogLevelWarn || telemetry.logs[0].data.Message != "battery low" {
@@ -447,6 +678,271 @@ func TestIngestEventsWritesMetricsLogsRawAndCommandReceipts(t *testing.T) {
 	}
 }
 
+func TestIngestEventsKeepsNamedMetrics(t *testing.T) {
+	svc, _, _, telemetry, _ := newTestCoreService()
+	attrs, _ := structpb.NewStruct(map[string]any{"x": 1})
+
+	_, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{{
+		EventId: "named-metrics",
+		Device:  &ingressv1.DeviceDescriptor{Uuid: "dev-1"},
+		Metrics: []*ingressv1.MetricPoint{
+			{Name: "co2", Unit: "ppm", EntityId: "sensor.co2", Tags: map[string]string{"room": "lab"}, Value: &ingressv1.Value{Kind: &ingressv1.Value_NumberValue{NumberValue: 640}}},
+			{Name: "occupied", Value: &ingressv1.Value{Kind: &ingressv1.Value_BoolValue{BoolValue: true}}},
+			{Name: "mode", Value: &ingressv1.Value{Kind: &ingressv1.Value_StringValue{StringValue: "eco"}}},
+			{Name: "color", Value: &ingressv1.Value{Kind: &ingressv1.Value_JsonValue{JsonValue: attrs}}},
+			{Value: &ingressv1.Value{Kind: &ingressv1.Value_NumberValue{NumberValue: 1}}},
+		},
+	}}}))
+	if err != nil {
+		t.Fatalf("IngestEvents failed: %v", err)
+	}
+	if len(telemetry.metrics) != 1 || len(telemetry.metrics[0].points) != 3 {
+		t.Fatalf("expected json and unnamed metrics to be dropped, got %+v", telemetry.metrics)
+	}
+	points := telemetry.metrics[0].points
+	if points[0].Name != "co2" || points[0].Unit != "ppm" || points[0].EntityID != "sensor.co2" || points[0].Tags["room"] != "lab" || points[0].Value != 640 {
+		t.Fatalf("unexpected number metric: %+v", points[0])
+	}
+	if points[1].ValueType != "bool" || points[1].Value != 1 || points[2].ValueType != "string" || points[2].ValueText != "eco" {
+		t.Fatalf("unexpected bool/string metrics: %+v", points[1:])
+	}
+}
+
+func TestIngestEventsWritesStatePoints(t *testing.T) {
+	registry := newFakeRegistry()
+	states := &fakeDeviceStates{}
+	svc := NewCoreService(registry, &fakePresence{}, &fakeTelemetry{}, &fakeDownlink{}, fakeTenantResolver{}, WithDeviceStates(states))
+	now := timestamppb.New(time.Unix(1700000000, 0))
+	attrs, _ := structpb.NewStruct(map[string]any{"x": 0.3, "y": 0.4})
+
+	resp, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{
+		{
+			EventId: "state-1",
+			Device:  &ingressv1.DeviceDescriptor{Uuid: "dev-1"},
+			States: []*ingressv1.StatePoint{
+				{Name: "state", Value: &ingressv1.Value{Kind: &ingressv1.Value_StringValue{StringValue: "ON"}}, EntityId: "light.l1", Endpoint: &ingressv1.EndpointRef{NumericEndpointId: 2}, ObservedAt: now},
+				{Name: "brightness", Value: &ingressv1.Value{Kind: &ingressv1.Value_NumberValue{NumberValue: 128}}, Unit: "lvl", ObservedAt: now},
+				{Name: "occupancy", Value: &ingressv1.Value{Kind: &ingressv1.Value_BoolValue{BoolValue: true}}, Tags: map[string]string{"room": "hall"}},
+				{Name: "color", Value: &ingressv1.Value{Kind: &ingressv1.Value_JsonValue{JsonValue: attrs}}},
+				{Name: "  "},
+			},
+		},
+	}}))
+	if err != nil {
+		t.Fatalf("IngestEvents failed: %v", err)
+	}
+	if len(resp.Msg.GetResults()) != 1 || !resp.Msg.GetResults()[0].GetSuccess() {
+		t.Fatalf("unexpected ingest response: %+v", resp.Msg)
+	}
+	got := states.ingested["dev-1"]
+	if len(got) != 4 {
+		t.Fatalf("unexpected state count: got %d want 4", len(got))
+	}
+	if got[0].ValueType != "string" || got[0].ValueText == nil || *got[0].ValueText != "ON" || got[0].EntityID != "light.l1" || got[0].Endpoint != "2" || got[0].Timestamp != now.AsTime().UnixMilli() {
+		t.Fatalf("unexpected string state: %+v", got[0])
+	}
+	if got[1].ValueType != "number" || got[1].ValueNum == nil || *got[1].ValueNum != 128 || got[1].Unit != "lvl" {
+		t.Fatalf("unexpected number state: %+v", got[1])
+	}
+	if got[2].ValueType != "bool" || got[2].ValueBool == nil || !*got[2].ValueBool || got[2].Tags["room"] != "hall" {
+		t.Fatalf("unexpected bool state: %+v", got[2])
+	}
+	if got[3].ValueType != "json" || got[3].ValueJSON["x"] != 0.3 {
+		t.Fatalf("unexpected json state: %+v", got[3])
+	}
+}
+
+func TestDeviceShadowReportedFromStatesAndHeartbeat(t *testing.T) {
+	shadows := &fakeDeviceShadows{}
+	presence := &fakePresence{}
+	svc := NewCoreService(newFakeRegistry(), presence, &fakeTelemetry{}, &fakeDownlink{}, fakeTenantResolver{}, WithDeviceShadows(shadows))
+
+	_, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{
+		{
+			Device: &ingressv1.DeviceDescriptor{Uuid: "dev-1"},
+			States: []*ingressv1.StatePoint{
+				{Name: "mode", Value: &ingressv1.Value{Kind: &ingressv1.Value_StringValue{StringValue: "eco"}}},
+				{Name: "on", EntityId: "led", Value: &ingressv1.Value{Kind: &ingressv1.Value_BoolValue{BoolValue: true}}},
+			},
+		},
+	}}))
+	if err != nil {
+		t.Fatalf("IngestEvents failed: %v", err)
+	}
+	if len(shadows.reported) != 1 || shadows.reported[0]["mode"] != "eco" || shadows.reported[0]["led"].(map[string]interface{})["on"] != true {
+		t.Fatalf("unexpected reported from states: %+v", shadows.reported)
+	}
+
+	state, _ := structpb.NewStruct(map[string]any{"interval": 30})
+	if _, err := svc.ReportHeartbeat(context.Background(), connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Uuid: "dev-1", State: state})); err != nil {
+		t.Fatalf("ReportHeartbeat failed: %v", err)
+	}
+	if len(shadows.reported) != 2 || shadows.reported[1]["interval"] != float64(30) {
+		t.Fatalf("unexpected reported from heartbeat: %+v", shadows.reported)
+	}
+	if len(presence.heartbeats) != 1 {
+		t.Fatalf("heartbeat should still update presence, got %+v", presence.heartbeats)
+	}
+}
+
+func TestReportHeartbeatRecordsDiagnostics(t *testing.T) {
+	diagnostics := &fakeDeviceDiagnostics{}
+	svc := NewCoreService(newFakeRegistry(), &fakePresence{}, &fakeTelemetry{}, &fakeDownlink{}, fakeTenantResolver{}, WithDeviceDiagnostics(diagnostics))
+
+	if _, err := svc.ReportHeartbeat(context.Background(), connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Uuid: "dev-1"})); err != nil {
+		t.Fatalf("ReportHeartbeat without state failed: %v", err)
+	}
+	if len(diagnostics.states) != 0 {
+		t.Fatalf("heartbeat without state must not record diagnostics: %+v", diagnostics.states)
+	}
+
+	state, _ := structpb.NewStruct(map[string]any{"rssi": -60, "uptime": 3600})
+	observedAt := time.UnixMilli(1700000000000)
+	if _, err := svc.ReportHeartbeat(context.Background(), connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Uuid: "dev-1", State: state, ObservedAt: timestamppb.New(observedAt)})); err != nil {
+		t.Fatalf("ReportHeartbeat failed: %v", err)
+	}
+	if len(diagnostics.states) != 1 || diagnostics.states[0]["rssi"] != float64(-60) || diagnostics.observedAt[0] != observedAt.UnixMilli() {
+		t.Fatalf("unexpected diagnostics: %+v %v", diagnostics.states, diagnostics.observedAt)
+	}
+}
+
+func TestRegisterAndHeartbeatReconcileDeviceConfig(t *testing.T) {
+	configs := &fakeDeviceConfigs{}
+	registry := newFakeRegistry()
+	svc := NewCoreService(registry, &fakePresence{}, &fakeTelemetry{}, &fakeDownlink{}, fakeTenantResolver{}, WithDeviceConfigs(configs))
+
+	registry.generatedUUID = "dev-1"
+	registry.metas["dev-1"] = inter.DeviceMetadata{SerialNumber: "SN1", Token: "tk", AuthenticateStatus: inter.AuthenticatePending}
+	if _, err := svc.RegisterDevice(context.Background(), connect.NewRequest(&ingressv1.RegisterDeviceRequest{Device: &ingressv1.DeviceDescriptor{SerialNumber: "SN1", ConfigVersion: "v0"}})); err != nil {
+		t.Fatalf("RegisterDevice pending failed: %v", err)
+	}
+	if len(configs.reconciled) != 0 {
+		t.Fatalf("pending device must not be reconciled: %+v", configs.reconciled)
+	}
+	registry.metas["dev-1"] = inter.DeviceMetadata{SerialNumber: "SN1", Token: "tk", AuthenticateStatus: inter.Authenticated}
+	if _, err := svc.RegisterDevice(context.Background(), connect.NewRequest(&ingressv1.RegisterDeviceRequest{Device: &ingressv1.DeviceDescriptor{SerialNumber: "SN1", ConfigVersion: "v1"}})); err != nil {
+		t.Fatalf("RegisterDevice accepted failed: %v", err)
+	}
+
+	state, _ := structpb.NewStruct(map[string]any{"config_version": "v2"})
+	if _, err := svc.ReportHeartbeat(context.Background(), connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Uuid: "dev-1", State: state})); err != nil {
+		t.Fatalf("ReportHeartbeat failed: %v", err)
+	}
+	if _, err := svc.ReportHeartbeat(context.Background(), connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Uuid: "dev-1"})); err != nil {
+		t.Fatalf("ReportHeartbeat without state failed: %v", err)
+	}
+	if len(configs.reconciled) != 1 || configs.versions[0] != "v1" {
+		t.Fatalf("unexpected registration reconciliations: %+v %+v", configs.reconciled, configs.versions)
+	}
+	if len(configs.heartbeats) != 2 || configs.heartbeats[0] != inter.DefaultTenantID+"/dev-1@v2" || configs.heartbeats[1] != inter.DefaultTenantID+"/dev-1@" {
+		t.Fatalf("unexpected heartbeat reconciliations: %+v", configs.heartbeats)
+	}
+
+	// 对账失败只记录日志，心跳照常成功。
+	configs.heartbeatErr = errors.New("db down")
+	if _, err := svc.ReportHeartbeat(context.Background(), connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Uuid: "dev-1", State: state})); err != nil {
+		t.Fatalf("ReportHeartbeat should ignore reconcile errors, got %v", err)
+	}
+}
+
+func TestIngestEventsRoutesExternalIntegrationEvents(t *testing.T) {
+	externals := &fakeExternalEntities{}
+	states := &fakeDeviceStates{}
+	telemetry := &fakeTelemetry{}
+	svc := NewCoreService(newFakeRegistry(), &fakePresence{}, telemetry, &fakeDownlink{}, fakeTenantResolver{}, WithDeviceStates(states), WithExternalEntities(externals))
+	now := timestamppb.New(time.UnixMilli(1700000000000))
+
+	resp, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{
+		{
+			EventId:         "evt-z2m",
+			EventSource:     "mqtt",
+			Context:         &ingressv1.IngressContext{ProtocolName: "zigbee2mqtt", Labels: map[string]string{"source": "zigbee2mqtt"}},
+			PrimaryIdentity: &ingressv1.DeviceIdentity{Type: "zigbee2mqtt_friendly_name", Value: "kitchen_sensor"},
+			Device:          &ingressv1.DeviceDescriptor{Uuid: "ext_abc", Name: "kitchen_sensor", Model: "WSDCGQ11LM", Labels: map[string]string{"room": "kitchen"}},
+			Metrics: []*ingressv1.MetricPoint{
+				{Name: "temperature", Unit: "°C", ObservedAt: now, Value: &ingressv1.Value{Kind: &ingressv1.Value_NumberValue{NumberValue: 22.5}}},
+			},
+			States: []*ingressv1.StatePoint{
+				{Name: "contact", ObservedAt: now, Value: &ingressv1.Value{Kind: &ingressv1.Value_BoolValue{BoolValue: false}}},
+				{Name: "state", ObservedAt: now, Value: &ingressv1.Value{Kind: &ingressv1.Value_StringValue{StringValue: "ON"}}},
+			},
+		},
+		{
+			Device: &ingressv1.DeviceDescriptor{Uuid: "dev-1"},
+			States: []*ingressv1.StatePoint{{Name: "mode", Value: &ingressv1.Value{Kind: &ingressv1.Value_StringValue{StringValue: "eco"}}}},
+		},
+	}}))
+	if err != nil {
+		t.Fatalf("IngestEvents failed: %v", err)
+	}
+	if len(resp.Msg.GetResults()) != 2 || !resp.Msg.GetResults()[0].GetSuccess() || resp.Msg.GetResults()[0].GetUuid() != "ext_abc" {
+		t.Fatalf("unexpected ingest response: %+v", resp.Msg)
+	}
+	if len(telemetry.metrics) != 0 || len(states.ingested["ext_abc"]) != 0 {
+		t.Fatalf("external event should not reach native storage: metrics=%+v states=%+v", telemetry.metrics, states.ingested)
+	}
+	if len(states.ingested["dev-1"]) != 1 {
+		t.Fatalf("native event should still reach device states, got %+v", states.ingested)
+	}
+
+	if len(externals.entities) != 3 || len(externals.observations) != 3 {
+		t.Fatalf("unexpected external writes: entities=%+v observations=%+v", externals.entities, externals.observations)
+	}
+	temp := externals.entities[0]
+	if temp.Source != "zigbee2mqtt" || temp.EntityID != "kitchen_sensor.temperature" || temp.Domain != "sensor" || temp.DeviceClass != "temperature" || temp.Unit != "°C" || temp.RoomName != "kitchen" || temp.GosterUUID != "" || temp.DeviceID != "kitchen_sensor" || temp.Model != "WSDCGQ11LM" || temp.LastNum == nil || *temp.LastNum != 22.5 {
+		t.Fatalf("unexpected temperature entity: %+v", temp)
+	}
+	if contact := externals.entities[1]; contact.Domain != "binary_sensor" || contact.DeviceClass != "door" || contact.ValueType != "bool" || contact.LastBool == nil || *contact.LastBool {
+		t.Fatalf("unexpected contact entity: %+v", contact)
+	}
+	if sw := externals.entities[2]; sw.Domain != "switch" || sw.LastText == nil || *sw.LastText != "ON" {
+		t.Fatalf("unexpected switch entity: %+v", sw)
+	}
+	obs := externals.observations[0]
+	if obs.Source != "zigbee2mqtt" || obs.EntityID != "kitchen_sensor.temperature" || obs.Timestamp != now.AsTime().UnixMilli() || obs.ValueNum == nil || *obs.ValueNum != 22.5 || obs.ValueSig != "" {
+		t.Fatalf("unexpected observation: %+v", obs)
+	}
+}
+
+func TestIngestExternalEventsTakeTenantFromCredential(t *testing.T) {
+	externals := &fakeExternalEntities{}
+	svc := NewCoreService(newFakeRegistry(), &fakePresence{}, &fakeTelemetry{}, &fakeDownlink{}, fakeTenantResolver{}, WithExternalEntities(externals))
+	bound := &ingressv1.IngressContext{SourceInstance: "ingress-1", AdapterId: "mqtt"}
+	event := func(id string) *ingressv1.CanonicalDeviceEvent {
+		return &ingressv1.CanonicalDeviceEvent{
+			EventId:         id,
+			EventSource:     "zigbee2mqtt",
+			PrimaryIdentity: &ingressv1.DeviceIdentity{Type: "zigbee2mqtt_friendly_name", Value: "hall_sensor"},
+			Device:          &ingressv1.DeviceDescriptor{Uuid: "ext_hall"},
+			Metrics:         []*ingressv1.MetricPoint{{Name: "temperature", Value: &ingressv1.Value{Kind: &ingressv1.Value_NumberValue{NumberValue: 20}}}},
+		}
+	}
+	credential := func(tenants ...string) context.Context {
+		return WithCallerCredential(context.Background(), inter.IngressCredential{ID: "ic_ext", InstanceID: "ingress-1", TenantIDs: tenants, Status: inter.IngressCredentialStatusActive})
+	}
+
+	resp, err := svc.IngestEvents(credential("tenant-a"), connect.NewRequest(&ingressv1.IngestEventsRequest{Context: bound, Events: []*ingressv1.CanonicalDeviceEvent{event("single")}}))
+	if err != nil || !resp.Msg.GetResults()[0].GetSuccess() || resp.Msg.GetResults()[0].GetTenantId() != "tenant-a" {
+		t.Fatalf("expected single-tenant credential to own the event, got %+v err=%v", resp, err)
+	}
+	if len(externals.entities) != 1 || externals.entities[0].TenantID != "tenant-a" || externals.observations[0].TenantID != "tenant-a" {
+		t.Fatalf("expected external writes under the credential tenant: %+v %+v", externals.entities, externals.observations)
+	}
+
+	resp, err = svc.IngestEvents(credential("tenant-a", "tenant-b"), connect.NewRequest(&ingressv1.IngestEventsRequest{Context: bound, Events: []*ingressv1.CanonicalDeviceEvent{event("ambiguous")}}))
+	if err != nil || resp.Msg.GetResults()[0].GetErrorCode() != "tenant_forbidden" {
+		t.Fatalf("expected multi-tenant credential without tenant_id rejected, got %+v err=%v", resp, err)
+	}
+	declared := &ingressv1.IngressContext{SourceInstance: "ingress-1", AdapterId: "mqtt", TenantId: "tenant-b"}
+	resp, err = svc.IngestEvents(credential("tenant-a", "tenant-b"), connect.NewRequest(&ingressv1.IngestEventsRequest{Context: declared, Events: []*ingressv1.CanonicalDeviceEvent{event("declared")}}))
+	if err != nil || !resp.Msg.GetResults()[0].GetSuccess() || externals.entities[len(externals.entities)-1].TenantID != "tenant-b" {
+		t.Fatalf("expected declared tenant within the binding accepted, got %+v err=%v", resp, err)
+	}
+	if len(externals.entities) != 2 {
+		t.Fatalf("rejected event should not be written: %+v", externals.entities)
+	}
+}
+
 func TestIngestEventsPartialAndStopOnFirstFailure(t *testing.T) {
 	svc, _, _, telemetry, _ := newTestCoreService()
 	telemetry.err = errors.New("store down")
@@ -526,13 +1022,15 @@ func TestUpdateCommandStatusSentAckedFailedAndRequeued(t *testing.T) {
 		t.Fatalf("unexpected status calls: sent=%+v acked=%+v failed=%+v", downlink.sent, downlink.acked, downlink.failed)
 	}
 
+	// 回队使用落库的指令，忽略回执中携带的载荷。
+	downlink.commands = map[int64]inter.DeviceCommand{21: {ID: 21, UUID: "dev-1", CmdID: inter.CmdActionExec, Payload: []byte("turn-on")}}
 	resp, err := svc.UpdateCommandStatus(context.Background(), connect.NewRequest(&ingressv1.UpdateCommandStatusRequest{
 		CommandId: 21,
 		Status:    ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED,
 		Command: &ingressv1.CanonicalCommand{
 			Uuid:                "dev-1",
-			ProtocolCommandCode: uint32(inter.CmdActionExec),
-			Payload:             &ingressv1.RawPayload{Text: "turn-on"},
+			ProtocolCommandCode: uint32(inter.CmdConfigPush),
+			Payload:             &ingressv1.RawPayload{Text: "forged"},
 		},
 	}))
 	if err != nil {
@@ -543,14 +1041,77 @@ func TestUpdateCommandStatusSentAckedFailedAndRequeued(t *testing.T) {
 	}
 }
 
+func TestPullCommandsAndReceiptsForExternalCommands(t *testing.T) {
+	downlink := &fakeDownlink{}
+	commands := &fakeExternalCommands{pending: []inter.ExternalCommand{
+		{ID: 7, TenantID: "tenant-a", Source: "zigbee2mqtt", EntityID: "living_plug.state", Command: "turn_on", Payload: map[string]interface{}{"state": "ON"}, RequestedAt: time.Now()},
+	}}
+	svc := NewCoreService(newFakeRegistry(), &fakePresence{}, &fakeTelemetry{}, downlink, fakeTenantResolver{}, WithExternalCommands(commands))
+	// 外部命令按调用方凭据的租户领取与回执。
+	ctx := WithCallerCredential(context.Background(), inter.IngressCredential{ID: "cred-a", TenantIDs: []string{"tenant-a", "tenant_legacy"}, Status: inter.IngressCredentialStatusActive})
+	ictx := &ingressv1.IngressContext{TenantId: "tenant-a"}
+
+	resp, err := svc.PullCommands(ctx, connect.NewRequest(&ingressv1.PullCommandsRequest{
+		Context:         ictx,
+		Uuid:            "ext_abc",
+		PrimaryIdentity: &ingressv1.DeviceIdentity{Type: "zigbee2mqtt_friendly_name", Value: "living_plug"},
+		MaxCount:        4,
+	}))
+	if err != nil {
+		t.Fatalf("PullCommands failed: %v", err)
+	}
+	if len(commands.pulled) != 1 || commands.pulled[0] != "tenant-a:zigbee2mqtt/living_plug" {
+		t.Fatalf("unexpected pull target: %+v", commands.pulled)
+	}
+	if len(resp.Msg.GetCommands()) != 1 {
+		t.Fatalf("unexpected commands: %+v", resp.Msg.GetCommands())
+	}
+	cmd := resp.Msg.GetCommands()[0]
+	if cmd.GetCommandId() != 7 || cmd.GetCommandUuid() != "extcmd_7" || cmd.GetTargetEntityId() != "living_plug.state" || cmd.GetOperation() != "turn_on" || cmd.GetTenantId() != "tenant-a" {
+		t.Fatalf("unexpected external command: %+v", cmd)
+	}
+	if cmd.GetTargetIdentity().GetType() != "zigbee2mqtt_friendly_name" || cmd.GetTargetIdentity().GetValue() != "living_plug" || string(cmd.GetPayload().GetBody()) != `{"state":"ON"}` {
+		t.Fatalf("unexpected external command target/payload: %+v", cmd)
+	}
+
+	for _, status := range []ingressv1.CommandStatus{ingressv1.CommandStatus_COMMAND_STATUS_SENT, ingressv1.CommandStatus_COMMAND_STATUS_FAILED} {
+		if _, err := svc.UpdateCommandStatus(ctx, connect.NewRequest(&ingressv1.UpdateCommandStatusRequest{Context: ictx, CommandId: 7, CommandUuid: "extcmd_7", Status: status})); err != nil {
+			t.Fatalf("UpdateCommandStatus(%s) failed: %v", status, err)
+		}
+	}
+	if commands.statuses[7] != inter.ExternalCommandStatusFailed || commands.tenants[7] != "tenant-a" {
+		t.Fatalf("unexpected external statuses: %+v tenants=%+v", commands.statuses, commands.tenants)
+	}
+	// 绑定多个租户的凭据不声明租户时无法确定外部命令的归属。
+	_, err = svc.UpdateCommandStatus(ctx, connect.NewRequest(&ingressv1.UpdateCommandStatusRequest{CommandId: 7, CommandUuid: "extcmd_7", Status: ingressv1.CommandStatus_COMMAND_STATUS_ACKED}))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Fatalf("receipt without resolvable tenant should be rejected, got %v", err)
+	}
+	if len(downlink.sent) != 0 || len(downlink.failed) != 0 {
+		t.Fatalf("external receipts should not touch device commands: sent=%+v failed=%+v", downlink.sent, downlink.failed)
+	}
+}
+
+func TestUpdateCommandStatusRecordsDeliveringIngress(t *testing.T) {
+	svc, _, _, _, downlink := newTestCoreService()
+	_, err := svc.UpdateCommandStatus(context.Background(), connect.NewRequest(&ingressv1.UpdateCommandStatusRequest{
+		CommandId: 30,
+		Status:    ingressv1.CommandStatus_COMMAND_STATUS_SENT,
+		Context:   &ingressv1.IngressContext{SourceInstance: " ingress-a ", AdapterId: "mqtt"},
+	}))
+	if err != nil {
+		t.Fatalf("UpdateCommandStatus failed: %v", err)
+	}
+	if len(downlink.via) != 1 || downlink.via[0] != (inter.CommandDelivery{InstanceID: "ingress-a", AdapterID: "mqtt"}) {
+		t.Fatalf("unexpected delivery: %+v", downlink.via)
+	}
+}
+
 func TestUpdateCommandStatusRejectsInvalidRequests(t *testing.T) {
 	svc, _, _, _, _ := newTestCoreService()
 	cases := []*ingressv1.UpdateCommandStatusRequest{
 		{Status: ingressv1.CommandStatus_COMMAND_STATUS_SENT},
 		{CommandId: 1, Status: ingressv1.CommandStatus_COMMAND_STATUS_UNSPECIFIED},
-		{CommandId: 2, Status: ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED, ProtocolCommandCode: uint32(inter.CmdActionExec), Raw: &ingressv1.RawPayload{Body: []byte("x")}},
-		{CommandId: 3, Status: ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED, Uuid: "dev-1", Raw: &ingressv1.RawPayload{Body: []byte("x")}},
-		{CommandId: 4, Status: ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED, Uuid: "dev-1", ProtocolCommandCode: uint32(inter.CmdActionExec)},
 	}
 	for _, req := range cases {
 		_, err := svc.UpdateCommandStatus(context.Background(), connect.NewRequest(req))
@@ -560,9 +1121,36 @@ func TestUpdateCommandStatusRejectsInvalidRequests(t *testing.T) {
 	}
 }
 
+func TestUpdateCommandStatusChecksCommandOwner(t *testing.T) {
+	svc, _, _, _, downlink := newTestCoreService()
+	downlink.commands = map[int64]inter.DeviceCommand{40: {ID: 40, UUID: "dev-1", CmdID: inter.CmdActionExec, Payload: []byte("on")}}
+
+	_, err := svc.UpdateCommandStatus(context.Background(), connect.NewRequest(&ingressv1.UpdateCommandStatusRequest{CommandId: 40, Uuid: "dev-2", Status: ingressv1.CommandStatus_COMMAND_STATUS_SENT}))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Fatalf("command of another device should be rejected, got %v", err)
+	}
+	// 不声明 uuid 时按指令所属设备的租户校验凭据。
+	ctx := WithCallerCredential(context.Background(), inter.IngressCredential{ID: "cred-b", TenantIDs: []string{"tenant-b"}, Status: inter.IngressCredentialStatusActive})
+	_, err = svc.UpdateCommandStatus(ctx, connect.NewRequest(&ingressv1.UpdateCommandStatusRequest{CommandId: 40, Status: ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED}))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Fatalf("command outside credential tenant should be rejected, got %v", err)
+	}
+	if len(downlink.sent) != 0 || len(downlink.requeues) != 0 {
+		t.Fatalf("rejected updates must not touch the command: sent=%v requeues=%+v", downlink.sent, downlink.requeues)
+	}
+
+	resp, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{{
+		Device:         &ingressv1.DeviceDescriptor{Uuid: "dev-2"},
+		CommandReceipt: &ingressv1.CommandReceipt{CommandId: 40, Status: ingressv1.CommandStatus_COMMAND_STATUS_ACKED},
+	}}}))
+	if err != nil || resp.Msg.GetResults()[0].GetSuccess() || len(downlink.acked) != 0 {
+		t.Fatalf("receipt for another device's command should fail: %+v err=%v acked=%v", resp.Msg, err, downlink.acked)
+	}
+}
+
 func TestResolveTenantFallbacksToLegacy(t *testing.T) {
 	registry := newFakeRegistry()
-	svc := NewCoreService(registry, &fakePresence{}, &fakeTelemetry{}, &fakeDownlink{}, fakeTenantResolver{err: errors.New("not found")})
+	svc := NewCoreService(registry, &fakePresence{}, &fakeTelemetry{}, &fakeDownlink{}, fakeTenantResolver{err: inter.ErrDeviceNotFound})
 	resp, err := svc.ReportHeartbeat(context.Background(), connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Uuid: "missing"}))
 	if err != nil {
 		t.Fatalf("ReportHeartbeat failed: %v", err)
@@ -570,4 +1158,340 @@ func TestResolveTenantFallbacksToLegacy(t *testing.T) {
 	if resp.Msg.GetTenantId() != inter.DefaultTenantID {
 		t.Fatalf("expected default tenant fallback, got %q", resp.Msg.GetTenantId())
 	}
+
+	// 其他解析错误不能回落到默认租户放行。
+	failing := NewCoreService(registry, &fakePresence{}, &fakeTelemetry{}, &fakeDownlink{}, fakeTenantResolver{err: errors.New("db down")})
+	if _, err := failing.ReportHeartbeat(context.Background(), connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Uuid: "dev-1"})); connect.CodeOf(err) != connect.CodeInternal {
+		t.Fatalf("resolve error should fail the request, got %v", err)
+	}
+}
+
+type fakeDedupe struct {
+	inter.IngestDedupeService
+	records  map[string]inter.IngestDedupeRecord
+	released []string
+}
+
+func (f *fakeDedupe) Reserve(tenantID, key, eventID, uuid string) (inter.IngestDedupeRecord, bool, error) {
+	if rec, ok := f.records[tenantID+"|"+key]; ok {
+		return rec, true, nil
+	}
+	rec := inter.IngestDedupeRecord{TenantID: tenantID, Key: key, EventID: eventID, UUID: uuid, CreatedAt: 1}
+	f.records[tenantID+"|"+key] = rec
+	return rec, false, nil
+}
+
+func (f *fakeDedupe) Complete(record inter.IngestDedupeRecord) error {
+	record.CompletedAt = 2
+	f.records[record.TenantID+"|"+record.Key] = record
+	return nil
+}
+
+func (f *fakeDedupe) Release(tenantID, key string) error {
+	delete(f.records, tenantID+"|"+key)
+	f.released = append(f.released, key)
+	return nil
+}
+
+func TestIngestEventsDeduplicatesRetriedEvents(t *testing.T) {
+	telemetry := &fakeTelemetry{}
+	dedupe := &fakeDedupe{records: map[string]inter.IngestDedupeRecord{}}
+	svc := NewCoreService(newFakeRegistry(), &fakePresence{}, telemetry, &fakeDownlink{}, fakeTenantResolver{}, WithIngestDedupe(dedupe))
+	value := &ingressv1.Value{Kind: &ingressv1.Value_NumberValue{NumberValue: 1}}
+	event := func(id, key string) *ingressv1.CanonicalDeviceEvent {
+		return &ingressv1.CanonicalDeviceEvent{
+			EventId:        id,
+			IdempotencyKey: key,
+			Device:         &ingressv1.DeviceDescriptor{Uuid: "dev-1"},
+			Metrics:        []*ingressv1.MetricPoint{{Value: value, LegacyMetricType: 1, ObservedAt: timestamppb.Now()}},
+		}
+	}
+
+	first, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{event("evt-1", ""), event("evt-2", "idem-2")}}))
+	if err != nil {
+		t.Fatalf("IngestEvents failed: %v", err)
+	}
+	if first.Msg.GetDuplicateCount() != 0 || len(telemetry.metrics) != 2 {
+		t.Fatalf("unexpected first ingest: %+v metrics=%d", first.Msg, len(telemetry.metrics))
+	}
+
+	retry, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{event("evt-1", ""), event("evt-2-retry", "idem-2"), event("", "")}}))
+	if err != nil {
+		t.Fatalf("IngestEvents retry failed: %v", err)
+	}
+	results := retry.Msg.GetResults()
+	if retry.Msg.GetDuplicateCount() != 2 || len(results) != 3 {
+		t.Fatalf("expected 2 duplicates, got %+v", retry.Msg)
+	}
+	if !results[0].GetDuplicate() || !results[0].GetSuccess() || results[0].GetUuid() != "dev-1" || results[0].GetTenantId() != "tenant_legacy" {
+		t.Fatalf("unexpected duplicate result: %+v", results[0])
+	}
+	if !results[1].GetDuplicate() || results[1].GetEventId() != "evt-2" {
+		t.Fatalf("idempotency key should map back to original event: %+v", results[1])
+	}
+	if results[2].GetDuplicate() || len(telemetry.metrics) != 3 {
+		t.Fatalf("events without ids must not be deduplicated: %+v metrics=%d", results[2], len(telemetry.metrics))
+	}
+
+	telemetry.err = errors.New("db down")
+	failed, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{event("evt-3", "")}}))
+	if err != nil {
+		t.Fatalf("IngestEvents failed: %v", err)
+	}
+	if failed.Msg.GetResults()[0].GetSuccess() || len(dedupe.released) != 1 || dedupe.released[0] != "event:evt-3" {
+		t.Fatalf("failed ingest should release dedupe key: %+v released=%v", failed.Msg, dedupe.released)
+	}
+}
+
+func TestAvailabilitySignalsUpdatePresence(t *testing.T) {
+	svc, _, presence, _, _ := newTestCoreService()
+
+	resp, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{
+		{
+			EventId:      "avail-1",
+			EventType:    ingressv1.EventType_EVENT_TYPE_AVAILABILITY,
+			Device:       &ingressv1.DeviceDescriptor{Uuid: "dev-1"},
+			Availability: ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_OFFLINE,
+			Context:      &ingressv1.IngressContext{Labels: map[string]string{"availability_reason": "mqtt_disconnect"}},
+		},
+		{
+			EventId:      "avail-2",
+			EventType:    ingressv1.EventType_EVENT_TYPE_AVAILABILITY,
+			Device:       &ingressv1.DeviceDescriptor{Uuid: "dev-2"},
+			Availability: ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_ONLINE,
+		},
+	}}))
+	if err != nil || len(resp.Msg.GetResults()) != 2 || !resp.Msg.GetResults()[1].GetSuccess() {
+		t.Fatalf("unexpected ingest response: %+v err=%v", resp, err)
+	}
+
+	hb, err := svc.ReportHeartbeat(context.Background(), connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Uuid: "dev-3", Availability: ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_OFFLINE}))
+	if err != nil {
+		t.Fatalf("ReportHeartbeat failed: %v", err)
+	}
+	if hb.Msg.GetAvailability() != ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_OFFLINE {
+		t.Fatalf("expected offline availability, got %v", hb.Msg.GetAvailability())
+	}
+
+	want := []string{"dev-1:offline:mqtt_disconnect", "dev-2:online:availability", "dev-3:offline:heartbeat_offline"}
+	if strings.Join(presence.availability, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected availability signals: %v", presence.availability)
+	}
+	if len(presence.heartbeats) != 0 {
+		t.Fatalf("offline heartbeat must not refresh last seen: %v", presence.heartbeats)
+	}
+}
+
+func TestTopologyEventsUpdateDeviceTopology(t *testing.T) {
+	svc, _, _, telemetry, _ := newTestCoreService()
+	topology := &fakeTopology{}
+	WithDeviceTopology(topology)(svc)
+
+	resp, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{
+		{
+			EventId:   "topo-1",
+			EventType: ingressv1.EventType_EVENT_TYPE_TOPOLOGY,
+			Device:    &ingressv1.DeviceDescriptor{Uuid: "dev-1", DeviceType: "coordinator"},
+			Children: []*ingressv1.DeviceDescriptor{
+				{Uuid: "child-1", DeviceType: "router"},
+				{Identities: []*ingressv1.DeviceIdentity{{Type: "ieee", Value: "0x00124b"}}, DeviceType: "enddevice"},
+				{NetworkAddress: "0x1a2b"},
+				{},
+			},
+		},
+		{
+			EventId:   "telemetry-1",
+			EventType: ingressv1.EventType_EVENT_TYPE_TELEMETRY,
+			Device:    &ingressv1.DeviceDescriptor{Uuid: "child-1", ParentUuid: "dev-1"},
+			Metrics:   []*ingressv1.MetricPoint{{Name: "temperature", Value: &ingressv1.Value{Kind: &ingressv1.Value_NumberValue{NumberValue: 21}}}},
+		},
+	}}))
+	if err != nil || !resp.Msg.GetResults()[0].GetSuccess() || !resp.Msg.GetResults()[1].GetSuccess() {
+		t.Fatalf("unexpected ingest response: %+v err=%v", resp, err)
+	}
+
+	if len(topology.snapshots) != 1 || topology.snapshots[0] != "dev-1=child-1/router,0x00124b/enddevice,0x1a2b/" {
+		t.Fatalf("unexpected topology snapshots: %v", topology.snapshots)
+	}
+	if len(topology.parents) != 1 || topology.parents[0] != "child-1->dev-1" {
+		t.Fatalf("unexpected parent reports: %v", topology.parents)
+	}
+	if len(telemetry.metrics) != 1 {
+		t.Fatalf("events with parent_uuid should still ingest metrics, got %d", len(telemetry.metrics))
+	}
+}
+
+func TestDiscoveryEventsStoreChildCapabilities(t *testing.T) {
+	svc, registry, _, _, _ := newTestCoreService()
+	WithDeviceTopology(&fakeTopology{})(svc)
+	svc.tenantResolver = fakeTenantResolver{tenants: map[string]string{"dev-1": "tenant-a", "child-1": "tenant-a", "child-other": "tenant-b"}}
+	registry.metas["child-1"] = inter.DeviceMetadata{Name: "Bulb", AuthenticateStatus: inter.Authenticated}
+	registry.metas["child-other"] = inter.DeviceMetadata{Name: "Plug", AuthenticateStatus: inter.Authenticated}
+	brightness := []*ingressv1.CapabilityDescriptor{{Property: "brightness", Type: "numeric", Writable: true, ValueMax: "254"}}
+
+	resp, err := svc.IngestEvents(context.Background(), connect.NewRequest(&ingressv1.IngestEventsRequest{Events: []*ingressv1.CanonicalDeviceEvent{{
+		EventId:   "topo-caps",
+		EventType: ingressv1.EventType_EVENT_TYPE_TOPOLOGY,
+		Device:    &ingressv1.DeviceDescriptor{Uuid: "dev-1", DeviceType: "coordinator"},
+		Children: []*ingressv1.DeviceDescriptor{
+			{Uuid: "child-1", Capabilities: []*ingressv1.CapabilityDescriptor{{Type: "light", Features: brightness}}},
+			{Uuid: "child-unknown", Capabilities: brightness},
+			{Uuid: "child-other", Capabilities: brightness},
+		},
+	}}}))
+	if err != nil || !resp.Msg.GetResults()[0].GetSuccess() {
+		t.Fatalf("unexpected ingest response: %+v err=%v", resp, err)
+	}
+	caps := registry.capabilities["child-1"]
+	if len(caps) != 1 || caps[0].Features[0].ValueMax != "254" {
+		t.Fatalf("expected child capabilities to be stored, got %+v", registry.capabilities)
+	}
+	if _, ok := registry.capabilities["child-unknown"]; ok {
+		t.Fatalf("unregistered child should be skipped")
+	}
+	if _, ok := registry.capabilities["child-other"]; ok {
+		t.Fatalf("child from another tenant should be skipped")
+	}
+}
+
+func TestCallerCredentialBindingRejectsOutOfScopeCalls(t *testing.T) {
+	svc, _, presence, telemetry, _ := newTestCoreService()
+	ctx := WithCallerCredential(context.Background(), inter.IngressCredential{
+		ID:         "ic_1",
+		InstanceID: "ingress-1",
+		Adapters:   []string{"mqtt"},
+		TenantIDs:  []string{"tenant-a"},
+		Status:     inter.IngressCredentialStatusActive,
+	})
+	bound := &ingressv1.IngressContext{SourceInstance: "ingress-1", AdapterId: "mqtt"}
+
+	resp, err := svc.IngestEvents(ctx, connect.NewRequest(&ingressv1.IngestEventsRequest{Context: bound, AllowPartialSuccess: true, Events: []*ingressv1.CanonicalDeviceEvent{
+		{EventId: "own", Device: &ingressv1.DeviceDescriptor{Uuid: "dev-1"}, EventType: ingressv1.EventType_EVENT_TYPE_DEVICE_EVENT, Raw: &ingressv1.RawPayload{ContentType: "text/plain", Text: "a"}},
+		{EventId: "foreign", Device: &ingressv1.DeviceDescriptor{Uuid: "dev-2"}, EventType: ingressv1.EventType_EVENT_TYPE_DEVICE_EVENT, Raw: &ingressv1.RawPayload{ContentType: "text/plain", Text: "b"}},
+		{EventId: "spoofed", Context: &ingressv1.IngressContext{SourceInstance: "ingress-2", AdapterId: "mqtt"}, Device: &ingressv1.DeviceDescriptor{Uuid: "dev-1"}, EventType: ingressv1.EventType_EVENT_TYPE_DEVICE_EVENT, Raw: &ingressv1.RawPayload{ContentType: "text/plain", Text: "c"}},
+	}}))
+	if err != nil {
+		t.Fatalf("IngestEvents failed: %v", err)
+	}
+	results := resp.Msg.GetResults()
+	if len(results) != 3 || !results[0].GetSuccess() || results[1].GetErrorCode() != "tenant_forbidden" || results[2].GetErrorCode() != "caller_forbidden" {
+		t.Fatalf("unexpected binding results: %+v", results)
+	}
+	if len(telemetry.events) != 1 || telemetry.events[0].uuid != "dev-1" {
+		t.Fatalf("only in-scope event should be written: %+v", telemetry.events)
+	}
+
+	_, err = svc.ReportHeartbeat(ctx, connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Context: bound, Uuid: "dev-2"}))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Fatalf("expected permission denied for foreign tenant heartbeat, got %v", err)
+	}
+	_, err = svc.ReportHeartbeat(ctx, connect.NewRequest(&ingressv1.ReportHeartbeatRequest{Context: &ingressv1.IngressContext{SourceInstance: "ingress-1", AdapterId: "custom_tcp"}, Uuid: "dev-1"}))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Fatalf("expected permission denied for unbound adapter, got %v", err)
+	}
+	if len(presence.heartbeats) != 0 {
+		t.Fatalf("rejected heartbeats should not update presence: %+v", presence.heartbeats)
+	}
+	_, err = svc.PullCommands(ctx, connect.NewRequest(&ingressv1.PullCommandsRequest{Context: bound, Uuid: "dev-2"}))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Fatalf("expected permission denied for foreign tenant pull, got %v", err)
+	}
+}
+
+func TestRegisterDeviceKeepsDescriptorAndResolvesIdentities(t *testing.T) {
+	svc, registry, _, _, _ := newTestCoreService()
+	attrs, _ := structpb.NewStruct(map[string]any{"zcl_version": 3})
+	device := &ingressv1.DeviceDescriptor{
+		Name:         "Bulb",
+		MacAddress:   "AA:BB",
+		Manufacturer: "IKEA",
+		Model:        "LED1545G12",
+		PowerSource:  "mains",
+		DeviceType:   "router",
+		Identities:   []*ingressv1.DeviceIdentity{{Type: "ieee_address", Value: "0x00124B0001"}},
+		Entities:     []*ingressv1.EntityDescriptor{{EntityId: "bulb.state", Domain: "light", Writable: true}},
+		Capabilities: []*ingressv1.CapabilityDescriptor{{Property: "brightness", Type: "numeric", Writable: true, ValueMax: "254"}},
+		Labels:       map[string]string{"room": "kitchen"},
+		Attributes:   attrs,
+	}
+	resp, err := svc.RegisterDevice(context.Background(), connect.NewRequest(&ingressv1.RegisterDeviceRequest{Device: device}))
+	if err != nil || resp.Msg.GetStatus() != ingressv1.RegistrationStatus_REGISTRATION_STATUS_PENDING {
+		t.Fatalf("RegisterDevice failed: %+v err=%v", resp, err)
+	}
+	uuid := resp.Msg.GetUuid()
+	registered := registry.registered[0]
+	if registered.Descriptor.Manufacturer != "IKEA" || registered.Descriptor.Labels["room"] != "kitchen" || registered.Descriptor.Attributes["zcl_version"] != float64(3) || len(registered.Descriptor.Capabilities) != 1 || len(registered.Identities) != 1 {
+		t.Fatalf("descriptor not mapped: %+v", registered)
+	}
+	if !strings.Contains(string(registered.Descriptor.Entities), `"entity_id":"bulb.state"`) {
+		t.Fatalf("entities should be stored with proto field names: %s", registered.Descriptor.Entities)
+	}
+	back := resp.Msg.GetDevice()
+	if back.GetModel() != "LED1545G12" || back.GetCapabilities()[0].GetValueMax() != "254" || back.GetEntities()[0].GetDomain() != "light" || back.GetLabels()["room"] != "kitchen" || back.GetLabels()["tenant_id"] == "" {
+		t.Fatalf("descriptor not returned: %+v", back)
+	}
+
+	// 换网关后只上报 ieee_address，也应解析回待审批的原设备并刷新描述。
+	registry.BindIdentities(uuid, registered.Identities)
+	registry.metas[uuid] = inter.DeviceMetadata{Name: "Bulb", MACAddress: "AA:BB", AuthenticateStatus: inter.AuthenticatePending}
+	rereport := &ingressv1.DeviceDescriptor{
+		FirmwareVersion: "2.0",
+		Identities:      []*ingressv1.DeviceIdentity{{Type: "ieee", Value: "0x00124b0001"}},
+	}
+	resp, err = svc.RegisterDevice(context.Background(), connect.NewRequest(&ingressv1.RegisterDeviceRequest{Device: rereport}))
+	if err != nil || resp.Msg.GetStatus() != ingressv1.RegistrationStatus_REGISTRATION_STATUS_PENDING || resp.Msg.GetUuid() != uuid {
+		t.Fatalf("identity should resolve to existing device: %+v err=%v", resp, err)
+	}
+	if len(registry.refreshed) != 1 || resp.Msg.GetDevice().GetSoftwareVersion() != "2.0" || resp.Msg.GetDevice().GetName() != "Bulb" {
+		t.Fatalf("existing device should be refreshed: %+v / %+v", registry.refreshed, resp.Msg.GetDevice())
+	}
+
+	// 已认证设备不能靠单个身份命中取回 token 或改写描述。
+	registry.metas[uuid] = inter.DeviceMetadata{Name: "Bulb", MACAddress: "AA:BB", AuthenticateStatus: inter.Authenticated, Token: "tok-bulb"}
+	resp, err = svc.RegisterDevice(context.Background(), connect.NewRequest(&ingressv1.RegisterDeviceRequest{Device: rereport}))
+	if err != nil || resp.Msg.GetStatus() != ingressv1.RegistrationStatus_REGISTRATION_STATUS_REJECTED || resp.Msg.GetCredential() != nil {
+		t.Fatalf("identity-only match must not expose an authenticated device: %+v err=%v", resp, err)
+	}
+	if len(registry.refreshed) != 1 {
+		t.Fatalf("authenticated device must not be refreshed: %+v", registry.refreshed)
+	}
+
+	// 序列号与 MAC 完全一致时，已认证设备升级后重新注册会刷新版本并取回 token。
+	upgraded := &ingressv1.DeviceDescriptor{Name: "Bulb", MacAddress: "AA:BB", FirmwareVersion: "3.0", HardwareVersion: "rev-b"}
+	resp, err = svc.RegisterDevice(context.Background(), connect.NewRequest(&ingressv1.RegisterDeviceRequest{Device: upgraded}))
+	if err != nil || resp.Msg.GetStatus() != ingressv1.RegistrationStatus_REGISTRATION_STATUS_ACCEPTED || resp.Msg.GetCredential().GetValue() != "tok-bulb" {
+		t.Fatalf("full match should accept authenticated device: %+v err=%v", resp, err)
+	}
+	if len(registry.refreshed) != 2 || registry.refreshed[1].SWVersion != "3.0" || registry.refreshed[1].HWVersion != "rev-b" {
+		t.Fatalf("authenticated device should be refreshed with new versions: %+v", registry.refreshed)
+	}
+	if back := resp.Msg.GetDevice(); back.GetSoftwareVersion() != "3.0" || back.GetHardwareVersion() != "rev-b" {
+		t.Fatalf("response should carry refreshed versions: %+v", back)
+	}
+}
+
+func TestAuthenticateDeviceRejectsIdentityOfAnotherDevice(t *testing.T) {
+	svc, registry, _, _, _ := newTestCoreService()
+	registry.tokens["tok-1"] = "dev-1"
+	registry.metas["dev-1"] = inter.DeviceMetadata{Name: "Device 1", AuthenticateStatus: inter.Authenticated, Token: "tok-1"}
+	registry.BindIdentities("dev-2", []inter.DeviceIdentity{{Type: "client_id", Value: "client-2"}})
+
+	resp, err := svc.AuthenticateDevice(context.Background(), connect.NewRequest(&ingressv1.AuthenticateDeviceRequest{
+		Credentials: []*ingressv1.Credential{{Type: "token", Value: "tok-1"}},
+		Identities:  []*ingressv1.DeviceIdentity{{Type: "mqtt_client_id", Value: "client-2"}},
+	}))
+	if err != nil || resp.Msg.GetStatus() != ingressv1.AuthStatus_AUTH_STATUS_REJECTED {
+		t.Fatalf("expected rejection for foreign identity, got %+v err=%v", resp, err)
+	}
+
+	resp, err = svc.AuthenticateDevice(context.Background(), connect.NewRequest(&ingressv1.AuthenticateDeviceRequest{
+		Credentials: []*ingressv1.Credential{{Type: "token", Value: "tok-1"}},
+		Identities:  []*ingressv1.DeviceIdentity{{Type: "mqtt_client_id", Value: "client-1"}},
+	}))
+	if err != nil || resp.Msg.GetStatus() != ingressv1.AuthStatus_AUTH_STATUS_ACCEPTED {
+		t.Fatalf("AuthenticateDevice failed: %+v err=%v", resp, err)
+	}
+	if owner, _ := registry.ResolveDevice([]inter.DeviceIdentity{{Type: "client_id", Value: "client-1"}}); owner != "dev-1" {
+		t.Fatalf("accepted identity should be bound, got %q", owner)
+	}
 }
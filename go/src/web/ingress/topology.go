@@ -0,0 +1,57 @@
+package ingress
+
+import (
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// WithDeviceTopology 启用网关/子设备拓扑维护：处理 TOPOLOGY 快照与设备声明的 parent_uuid。
+func WithDeviceTopology(topology inter.DeviceTopologyService) CoreServiceOption {
+	return func(s *CoreService) {
+		s.topology = topology
+	}
+}
+
+// ingestTopology 返回 true 表示事件是拓扑快照，已经处理完毕，不再按普通事件入库。
+func (s *CoreService) ingestTopology(uuid string, event *ingressv1.CanonicalDeviceEvent) (bool, error) {
+	device := event.GetDevice()
+	if event.GetEventType() == ingressv1.EventType_EVENT_TYPE_TOPOLOGY {
+		gateway := topologyNode(uuid, device)
+		children := make([]inter.DeviceTopologyNode, 0, len(event.GetChildren()))
+		for _, child := range event.GetChildren() {
+			if childUUID := topologyChildUUID(child); childUUID != "" {
+				children = append(children, topologyNode(childUUID, child))
+			}
+		}
+		return true, s.topology.ApplyTopology(gateway, children)
+	}
+	if strings.TrimSpace(device.GetParentUuid()) != "" {
+		return false, s.topology.ReportParent(topologyNode(uuid, device))
+	}
+	return false, nil
+}
+
+func topologyNode(uuid string, device *ingressv1.DeviceDescriptor) inter.DeviceTopologyNode {
+	return inter.DeviceTopologyNode{
+		UUID:           uuid,
+		ParentUUID:     strings.TrimSpace(device.GetParentUuid()),
+		Name:           strings.TrimSpace(device.GetName()),
+		DeviceType:     strings.TrimSpace(device.GetDeviceType()),
+		NetworkAddress: strings.TrimSpace(device.GetNetworkAddress()),
+	}
+}
+
+// topologyChildUUID 优先使用子设备自带的 uuid，缺失时退回到首个身份值或网络地址。
+func topologyChildUUID(child *ingressv1.DeviceDescriptor) string {
+	if uuid := strings.TrimSpace(child.GetUuid()); uuid != "" {
+		return uuid
+	}
+	for _, identity := range child.GetIdentities() {
+		if v := strings.TrimSpace(identity.GetValue()); v != "" {
+			return v
+		}
+	}
+	return strings.TrimSpace(child.GetNetworkAddress())
+}
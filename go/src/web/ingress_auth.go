@@ -2,36 +2,85 @@ package web
 
 import (
 	"crypto/subtle"
+	"errors"
 	"net/http"
 	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+	"github.com/nhirsama/Goster-IoT/src/web/ingress"
 )
 
-func withIngressBearerAuth(next http.Handler, token string) http.Handler {
-	token = strings.TrimSpace(token)
-	if token == "" {
+// ingressAuth 描述 protocol-ingress 调用方的鉴权方式。
+// adapter 凭据优先；共享密钥仅用于迁移期兼容，RequireCredentials 开启后不再接受。
+type ingressAuth struct {
+	token              string
+	credentials        inter.IngressCredentialService
+	requireCredentials bool
+}
+
+// allowAnonymous 保持本地开发的兼容行为：未配置共享密钥且未强制凭据时不要求鉴权。
+func (a ingressAuth) allowAnonymous() bool {
+	return a.token == "" && !a.requireCredentials
+}
+
+func withIngressAuth(next http.Handler, auth ingressAuth, logger inter.Logger) http.Handler {
+	auth.token = strings.TrimSpace(auth.token)
+	if auth.allowAnonymous() && auth.credentials == nil {
 		return next
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !validBearerToken(r.Header.Get("Authorization"), token) {
-			w.Header().Set("WWW-Authenticate", `Bearer realm="protocol-ingress"`)
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		token, ok := bearerToken(r.Header.Get("Authorization"))
+		if !ok {
+			if auth.allowAnonymous() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ingressUnauthorized(w)
 			return
 		}
-		next.ServeHTTP(w, r)
+		if auth.credentials != nil {
+			cred, err := auth.credentials.Authenticate(token)
+			switch {
+			case err == nil:
+				next.ServeHTTP(w, r.WithContext(ingress.WithCallerCredential(r.Context(), cred)))
+				return
+			case errors.Is(err, inter.ErrIngressCredentialRevoked):
+				ingressUnauthorized(w)
+				return
+			case !errors.Is(err, inter.ErrIngressCredentialInvalid):
+				logger.Error("校验 ingress 凭据失败", inter.Err(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if auth.allowAnonymous() || (!auth.requireCredentials && validBearerToken(r.Header.Get("Authorization"), auth.token)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ingressUnauthorized(w)
 	})
 }
 
+func ingressUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="protocol-ingress"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+func bearerToken(headerValue string) (string, bool) {
+	parts := strings.Fields(strings.TrimSpace(headerValue))
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+	return parts[1], true
+}
+
 func validBearerToken(headerValue, expectedToken string) bool {
 	expectedToken = strings.TrimSpace(expectedToken)
 	if expectedToken == "" {
 		return true
 	}
-	parts := strings.Fields(strings.TrimSpace(headerValue))
-	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-		return false
-	}
-	got := parts[1]
-	if len(got) != len(expectedToken) {
+	got, ok := bearerToken(headerValue)
+	if !ok || len(got) != len(expectedToken) {
 		return false
 	}
 	return subtle.ConstantTimeCompare([]byte(got), []byte(expectedToken)) == 1
@@ -111,6 +111,54 @@ func TestIngressRoutesAllowRequestsWhenTokenUnset(t *testing.T) {
 	}
 }
 
+func TestIngressRoutesAcceptIssuedCredentialsWhenRequired(t *testing.T) {
+	deps := newTestWebDeps(t)
+	store := deps.DataStore.(inter.CoreStore)
+	services := core.NewServices(store)
+	deps.IngressStore = store
+	deps.TelemetryIngest = services.TelemetryIngest
+	deps.IngressCredentials = services.IngressCredentials
+	deps.IngressToken = "shared-secret"
+	deps.IngressRequireCredentials = true
+
+	cred, token, err := services.IngressCredentials.Create(inter.IngressCredentialInput{InstanceID: "ingress-1"})
+	if err != nil {
+		t.Fatalf("create credential failed: %v", err)
+	}
+	ws, err := newWebServer(deps)
+	if err != nil {
+		t.Fatalf("newWebServer failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	ws.registerRoutes(mux)
+	call := func(header string) int {
+		req := httptest.NewRequest(http.MethodPost, ingressv1connect.ProtocolIngressCoreServiceAuthenticateDeviceProcedure, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := call("Bearer " + token); code == http.StatusUnauthorized {
+		t.Fatalf("issued credential should pass auth middleware, got %d", code)
+	}
+	// 强制凭据模式下共享密钥与匿名调用都被拒绝。
+	if code := call("Bearer shared-secret"); code != http.StatusUnauthorized {
+		t.Fatalf("shared token should be rejected when credentials are required, got %d", code)
+	}
+	if code := call(""); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous call should be rejected when credentials are required, got %d", code)
+	}
+	if err := services.IngressCredentials.Revoke(cred.ID); err != nil {
+		t.Fatalf("revoke credential failed: %v", err)
+	}
+	if code := call("Bearer " + token); code != http.StatusUnauthorized {
+		t.Fatalf("revoked credential should be rejected, got %d", code)
+	}
+}
+
 func TestServeRejectsNilListener(t *testing.T) {
 	ws := &webServer{}
 	if err := ws.Serve(nil, nil); err == nil {
@@ -145,6 +193,11 @@ func newTestWebDeps(t *testing.T) WebServerDeps {
 		DeviceRegistry:   services.DeviceRegistry,
 		DevicePresence:   services.DevicePresence,
 		DownlinkCommands: services.DownlinkCommands,
+		DeviceStates:     services.DeviceStates,
+		DeviceShadows:    services.DeviceShadows,
+		DeviceTopology:   services.DeviceTopology,
+		ExternalEntities: services.ExternalEntities,
+		ExternalCommands: services.ExternalCommands,
 		Auth:             authService,
 		Captcha:          &TurnstileService{Enabled: false},
 		Logger:           logger.NewNoop(),
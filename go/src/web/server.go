@@ -19,7 +19,7 @@ type webServer struct {
 	logger         inter.Logger
 	config         appcfg.WebConfig
 	ingressHandler *ingress.CoreService
-	ingressToken   string
+	ingressAuth    ingressAuth
 }
 
 func NewWebServer(deps WebServerDeps) (inter.WebServer, error) {
@@ -35,13 +35,17 @@ func newWebServer(deps WebServerDeps) (*webServer, error) {
 		return nil, err
 	}
 	ws := &webServer{
-		logger:       deps.Logger,
-		config:       deps.Config,
-		ingressToken: strings.TrimSpace(deps.IngressToken),
+		logger: deps.Logger,
+		config: deps.Config,
+		ingressAuth: ingressAuth{
+			token:              strings.TrimSpace(deps.IngressToken),
+			credentials:        deps.IngressCredentials,
+			requireCredentials: deps.IngressRequireCredentials,
+		},
 	}
 	ws.apiModules = buildAPIModules(deps)
 	if deps.IngressStore != nil {
-		ws.ingressHandler = ingress.NewCoreService(deps.DeviceRegistry, deps.DevicePresence, deps.TelemetryIngest, deps.DownlinkCommands, deps.IngressStore)
+		ws.ingressHandler = ingress.NewCoreService(deps.DeviceRegistry, deps.DevicePresence, deps.TelemetryIngest, deps.DownlinkCommands, deps.IngressStore, ingress.WithDeviceStates(deps.DeviceStates), ingress.WithDeviceShadows(deps.DeviceShadows), ingress.WithExternalEntities(deps.ExternalEntities), ingress.WithExternalCommands(deps.ExternalCommands), ingress.WithIngestDedupe(deps.IngestDedupe), ingress.WithDeviceTopology(deps.DeviceTopology), ingress.WithDeviceDiagnostics(deps.DeviceDiagnostics), ingress.WithDeviceConfigs(deps.DeviceConfigs), ingress.WithCommandNotifier(deps.CommandNotifier))
 	}
 	if len(ws.apiModules) == 0 {
 		return nil, errors.New("web api modules are required")
@@ -39,6 +39,11 @@ func TestWebServerStartStopsOnContextCancel(t *testing.T) {
 		DeviceRegistry:   services.DeviceRegistry,
 		DevicePresence:   services.DevicePresence,
 		DownlinkCommands: services.DownlinkCommands,
+		DeviceStates:     services.DeviceStates,
+		DeviceShadows:    services.DeviceShadows,
+		DeviceTopology:   services.DeviceTopology,
+		ExternalEntities: services.ExternalEntities,
+		ExternalCommands: services.ExternalCommands,
 		Auth:             authService,
 		Captcha:          &TurnstileService{Enabled: false},
 		Config: appcfg.WebConfig{
@@ -89,6 +94,11 @@ func TestWebServerStartReturnsListenErrorForInvalidAddr(t *testing.T) {
 		DeviceRegistry:   services.DeviceRegistry,
 		DevicePresence:   services.DevicePresence,
 		DownlinkCommands: services.DownlinkCommands,
+		DeviceStates:     services.DeviceStates,
+		DeviceShadows:    services.DeviceShadows,
+		DeviceTopology:   services.DeviceTopology,
+		ExternalEntities: services.ExternalEntities,
+		ExternalCommands: services.ExternalCommands,
 		Auth:             authService,
 		Captcha:          &TurnstileService{Enabled: false},
 		Config: appcfg.WebConfig{
@@ -7,8 +7,6 @@ import (
 	"github.com/nhirsama/Goster-IoT/src/device_manager"
 )
 
-const maxAccessControlMetricTimestampMs int64 = 1<<63 - 1
-
 // AccessControlHandler 返回设备门禁模块的当前计算状态。
 func (api *API) AccessControlHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -26,13 +24,14 @@ func (api *API) AccessControlHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	points, err := api.dataStore.QueryMetricsByTenant(api.tenantID(r), uuid, 0, maxAccessControlMetricTimestampMs)
+	// 门禁状态只取决于两路信号的最新值，直接读取最新值缓存，不扫描历史。
+	latest, err := api.lookupLatestMetrics(api.tenantID(r), []string{uuid})
 	if err != nil {
 		api.InternalError(w, r, 50051, err)
 		return
 	}
 
-	state := device_manager.EvaluateAccessControl(points)
+	state := device_manager.EvaluateAccessControl(latest[uuid])
 	api.OK(w, r, map[string]interface{}{
 		"uuid":            uuid,
 		"signal_a":        state.SignalA,
@@ -47,47 +47,89 @@ type CaptchaVerifier interface {
 
 // Deps 汇总了 v1 路由运行所需的依赖项。
 type Deps struct {
-	DataStore         inter.WebV1Store
-	DeviceRegistry    inter.DeviceRegistry
-	DevicePresence    inter.DevicePresence
-	DownlinkCommands  inter.DownlinkCommandService
-	Auth              identity.Service
-	Captcha           CaptchaVerifier
-	Logger            inter.Logger
-	Config            appcfg.WebConfig
-	PrincipalResolver identity.PrincipalResolver
-	LoginAttemptStore LoginAttemptStore  // 允许装配层替换登录失败状态存储，例如 Redis。
-	LoginGuard        *LoginAttemptGuard // 允许测试或高级场景直接注入登录保护器。
-	CSRFStore         CSRFTokenStore     // CSRF token 存储
+	DataStore          inter.WebV1Store
+	DeviceRegistry     inter.DeviceRegistry
+	DevicePresence     inter.DevicePresence
+	DownlinkCommands   inter.DownlinkCommandService
+	CommandSchedules   inter.CommandScheduleService
+	CommandBatches     inter.CommandBatchService
+	DeviceGroups       inter.DeviceGroupService
+	Ota                inter.OtaService
+	DeviceConfigs      inter.DeviceConfigService
+	Retention          inter.RetentionService
+	LatestMetrics      inter.LatestMetricService
+	DeviceStates       inter.DeviceStateService
+	DeviceShadows      inter.DeviceShadowService
+	DeviceTopology     inter.DeviceTopologyService
+	DeviceDiagnostics  inter.DeviceDiagnosticsService
+	ExternalEntities   inter.ExternalEntityService
+	ExternalCommands   inter.ExternalCommandService
+	IngressCredentials inter.IngressCredentialService
+	Auth               identity.Service
+	Captcha            CaptchaVerifier
+	Logger             inter.Logger
+	Config             appcfg.WebConfig
+	PrincipalResolver  identity.PrincipalResolver
+	LoginAttemptStore  LoginAttemptStore  // 允许装配层替换登录失败状态存储，例如 Redis。
+	LoginGuard         *LoginAttemptGuard // 允许测试或高级场景直接注入登录保护器。
+	CSRFStore          CSRFTokenStore     // CSRF token 存储
 }
 
 // API 负责 `/api/v1` 路由下的中间件、分发和处理逻辑。
 type API struct {
-	dataStore         inter.WebV1Store
-	registry          inter.DeviceRegistry
-	presence          inter.DevicePresence
-	downlinkCommands  inter.DownlinkCommandService
-	auth              identity.Service
-	captcha           CaptchaVerifier
-	logger            inter.Logger
-	config            appcfg.WebConfig
-	principalResolver identity.PrincipalResolver
-	loginGuard        *LoginAttemptGuard
-	csrfStore         CSRFTokenStore
+	dataStore          inter.WebV1Store
+	registry           inter.DeviceRegistry
+	presence           inter.DevicePresence
+	downlinkCommands   inter.DownlinkCommandService
+	commandSchedules   inter.CommandScheduleService
+	commandBatches     inter.CommandBatchService
+	deviceGroups       inter.DeviceGroupService
+	ota                inter.OtaService
+	deviceConfigs      inter.DeviceConfigService
+	retention          inter.RetentionService
+	latestMetrics      inter.LatestMetricService
+	deviceStates       inter.DeviceStateService
+	deviceShadows      inter.DeviceShadowService
+	deviceTopology     inter.DeviceTopologyService
+	deviceDiagnostics  inter.DeviceDiagnosticsService
+	externalEntities   inter.ExternalEntityService
+	externalCommands   inter.ExternalCommandService
+	ingressCredentials inter.IngressCredentialService
+	auth               identity.Service
+	captcha            CaptchaVerifier
+	logger             inter.Logger
+	config             appcfg.WebConfig
+	principalResolver  identity.PrincipalResolver
+	loginGuard         *LoginAttemptGuard
+	csrfStore          CSRFTokenStore
 }
 
 // New 根据 web 层注入的依赖构造一组 v1 API 处理器。
 func New(deps Deps) *API {
 	cfg := appcfg.NormalizeWebConfig(deps.Config)
 	api := &API{
-		dataStore:        deps.DataStore,
-		registry:         deps.DeviceRegistry,
-		presence:         deps.DevicePresence,
-		downlinkCommands: deps.DownlinkCommands,
-		auth:             deps.Auth,
-		captcha:          deps.Captcha,
-		logger:           deps.Logger,
-		config:           cfg,
+		dataStore:          deps.DataStore,
+		registry:           deps.DeviceRegistry,
+		presence:           deps.DevicePresence,
+		downlinkCommands:   deps.DownlinkCommands,
+		commandSchedules:   deps.CommandSchedules,
+		commandBatches:     deps.CommandBatches,
+		deviceGroups:       deps.DeviceGroups,
+		ota:                deps.Ota,
+		deviceConfigs:      deps.DeviceConfigs,
+		retention:          deps.Retention,
+		latestMetrics:      deps.LatestMetrics,
+		deviceStates:       deps.DeviceStates,
+		deviceShadows:      deps.DeviceShadows,
+		deviceTopology:     deps.DeviceTopology,
+		deviceDiagnostics:  deps.DeviceDiagnostics,
+		externalEntities:   deps.ExternalEntities,
+		externalCommands:   deps.ExternalCommands,
+		ingressCredentials: deps.IngressCredentials,
+		auth:               deps.Auth,
+		captcha:            deps.Captcha,
+		logger:             deps.Logger,
+		config:             cfg,
 	}
 	api.principalResolver = deps.PrincipalResolver
 	if api.principalResolver == nil {
@@ -126,9 +168,33 @@ func (api *API) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("/api/v1/devices", protectedWithCSRF(api.DevicesHandler, inter.PermissionReadOnly))
 	mux.Handle("/api/v1/devices/", protectedWithCSRF(api.DeviceByUUIDHandler, inter.PermissionReadOnly))
 
+	mux.Handle("/api/v1/commands/", protectedWithCSRF(api.CommandByIDHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/schedules", protectedWithCSRF(api.SchedulesHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/schedules/", protectedWithCSRF(api.ScheduleByIDHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/command-batches", protectedWithCSRF(api.CommandBatchesHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/command-batches/", protected(api.CommandBatchByIDHandler, inter.PermissionReadOnly))
+
+	mux.Handle("/api/v1/groups", protectedWithCSRF(api.GroupsHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/groups/", protectedWithCSRF(api.GroupByIDHandler, inter.PermissionReadOnly))
+
+	mux.Handle("/api/v1/firmware", protectedWithCSRF(api.FirmwareHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/firmware/", protectedWithCSRF(api.FirmwareByIDHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/ota/campaigns", protectedWithCSRF(api.OtaCampaignsHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/ota/campaigns/", protectedWithCSRF(api.OtaCampaignByIDHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/configs/", protectedWithCSRF(api.ConfigsHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/retention-policies", protected(api.RetentionPoliciesHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/retention-policies/", protectedWithCSRF(api.RetentionPolicyByClassHandler, inter.PermissionReadOnly))
+
 	mux.Handle("/api/v1/metrics/", protected(api.MetricsHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/metrics/latest", protected(api.LatestMetricsHandler, inter.PermissionReadOnly))
 	mux.Handle("/api/v1/access-control/", protected(api.AccessControlHandler, inter.PermissionReadOnly))
 
+	mux.Handle("/api/v1/external/entities", protected(api.ExternalEntitiesHandler, inter.PermissionReadOnly))
+	mux.Handle("/api/v1/external/entities/", protectedWithCSRF(api.ExternalEntityByIDHandler, inter.PermissionReadOnly))
+
+	mux.Handle("/api/v1/ingress/credentials", protectedWithCSRF(api.IngressCredentialsHandler, inter.PermissionAdmin))
+	mux.Handle("/api/v1/ingress/credentials/", protectedWithCSRF(api.IngressCredentialByIDHandler, inter.PermissionAdmin))
+
 	mux.Handle("/api/v1/users", protected(api.UsersHandler, inter.PermissionAdmin))
 	mux.Handle("/api/v1/users/", protectedWithCSRF(api.UserPermissionHandler, inter.PermissionAdmin))
 
@@ -174,3 +240,7 @@ func (api *API) metricsMinValidTimestampMs() int64 {
 func (api *API) metricsDefaultRangeLabel() string {
 	return api.webConfig().Metrics.DefaultRangeLabel
 }
+
+func (api *API) metricsMaxPoints() int {
+	return api.webConfig().Metrics.MaxPoints
+}
@@ -0,0 +1,197 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// maxCommandBatchListLimit 是批量任务列表单次返回的上限。
+const maxCommandBatchListLimit = 200
+
+// commandBatchRequest 是批量下发请求体；group_id 与 labels 至少给出一个，同时给出时取交集。
+type commandBatchRequest struct {
+	GroupID        string            `json:"group_id,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Command        string            `json:"command"`
+	Payload        json.RawMessage   `json:"payload,omitempty"`
+	Key            string            `json:"key,omitempty"`
+	Supersede      bool              `json:"supersede,omitempty"`
+	TTLSeconds     int64             `json:"ttl_seconds,omitempty"`
+	TimeoutSeconds int64             `json:"timeout_seconds,omitempty"`
+	MaxAttempts    int               `json:"max_attempts,omitempty"`
+}
+
+// CommandBatchesHandler 处理 `/api/v1/command-batches`：GET 列出最近的批量任务，POST 创建任务。
+func (api *API) CommandBatchesHandler(w http.ResponseWriter, r *http.Request) {
+	if api.commandBatches == nil {
+		api.Error(w, r, http.StatusNotFound, 40483, "command batch not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		limit, err := ParsePositiveIntQuery(r.URL.Query().Get("limit"), 50, maxCommandBatchListLimit)
+		if err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40089, "invalid limit",
+				&ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()})
+			return
+		}
+		batches, err := api.commandBatches.List(api.scopeFromRequest(r), limit)
+		if err != nil {
+			api.InternalError(w, r, 50086, err)
+			return
+		}
+		items := make([]map[string]interface{}, 0, len(batches))
+		for _, batch := range batches {
+			items = append(items, commandBatchPayload(batch, false))
+		}
+		api.OK(w, r, map[string]interface{}{
+			"items": items,
+			"total": len(items),
+		})
+	case http.MethodPost:
+		api.createCommandBatch(w, r, "")
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+// CommandBatchByIDHandler 处理 `/api/v1/command-batches/{id}`，返回逐台设备的结果与汇总进度。
+func (api *API) CommandBatchByIDHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	raw := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/command-batches/"), "/")
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		api.Error(w, r, http.StatusBadRequest, 40086, "invalid command batch id",
+			&ErrorDetail{Type: "validation_error", Field: "id"})
+		return
+	}
+	if api.commandBatches == nil {
+		api.Error(w, r, http.StatusNotFound, 40483, "command batch not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+		return
+	}
+	batch, err := api.commandBatches.Get(api.scopeFromRequest(r), id)
+	if err != nil {
+		api.commandBatchError(w, r, err, 50086)
+		return
+	}
+	api.OK(w, r, commandBatchPayload(batch, true))
+}
+
+// createCommandBatch 创建批量任务；groupID 非空时来自 `/api/v1/groups/{id}/commands`，覆盖请求体中的 group_id。
+func (api *API) createCommandBatch(w http.ResponseWriter, r *http.Request, groupID string) {
+	if api.commandBatches == nil {
+		api.Error(w, r, http.StatusNotFound, 40483, "command batch not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+		return
+	}
+	var payload commandBatchRequest
+	if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40082, "invalid json body",
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	if groupID != "" {
+		payload.GroupID = groupID
+	}
+	if field := negativeCommandPolicyField(payload.TTLSeconds, payload.TimeoutSeconds, payload.MaxAttempts); field != "" {
+		api.Error(w, r, http.StatusBadRequest, 40085, "invalid command batch",
+			&ErrorDetail{Type: "validation_error", Field: field})
+		return
+	}
+	if len(strings.TrimSpace(payload.Key)) > maxCommandKeyLength {
+		api.Error(w, r, http.StatusBadRequest, 40085, "invalid command batch",
+			&ErrorDetail{Type: "validation_error", Field: "key"})
+		return
+	}
+	cmdID, command, err := ParseDownlinkCommand(payload.Command)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40085, "invalid command batch",
+			&ErrorDetail{Type: "validation_error", Field: "command"})
+		return
+	}
+
+	createdBy, _ := r.Context().Value(ContextUsername).(string)
+	batch, err := api.commandBatches.Create(api.scopeFromRequest(r), inter.CommandBatch{
+		GroupID:   payload.GroupID,
+		Labels:    payload.Labels,
+		Command:   command,
+		CmdID:     cmdID,
+		Payload:   []byte(strings.TrimSpace(string(payload.Payload))),
+		CreatedBy: createdBy,
+	}, inter.DeviceCommandPolicy{
+		TTL:         time.Duration(payload.TTLSeconds) * time.Second,
+		Timeout:     time.Duration(payload.TimeoutSeconds) * time.Second,
+		MaxAttempts: payload.MaxAttempts,
+		Key:         strings.TrimSpace(payload.Key),
+		Supersede:   payload.Supersede,
+	})
+	if err != nil {
+		api.commandBatchError(w, r, err, 50085)
+		return
+	}
+	// 逐台入队在后台进行，客户端通过任务详情查看进度。
+	api.write(w, http.StatusAccepted, Envelope{
+		Code:      0,
+		Message:   "ok",
+		RequestID: api.requestID(r),
+		Data:      commandBatchPayload(batch, true),
+	})
+}
+
+func (api *API) commandBatchError(w http.ResponseWriter, r *http.Request, err error, internalCode int) {
+	switch {
+	case errors.Is(err, inter.ErrCommandBatchInvalid):
+		api.Error(w, r, http.StatusBadRequest, 40085, "invalid command batch",
+			&ErrorDetail{Type: "validation_error", Reason: err.Error()})
+	case errors.Is(err, inter.ErrCommandBatchNotFound):
+		api.Error(w, r, http.StatusNotFound, 40483, "command batch not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+	case errors.Is(err, inter.ErrDeviceGroupNotFound):
+		api.Error(w, r, http.StatusNotFound, 40481, "device group not found",
+			&ErrorDetail{Type: "not_found", Field: "group_id"})
+	default:
+		api.InternalError(w, r, internalCode, err)
+	}
+}
+
+// commandBatchPayload 展开批量任务；列表中省略逐台设备结果，只返回汇总进度。
+func commandBatchPayload(batch inter.CommandBatch, withItems bool) map[string]interface{} {
+	data := map[string]interface{}{
+		"id":         batch.ID,
+		"group_id":   batch.GroupID,
+		"command":    batch.Command,
+		"cmd_id":     int(batch.CmdID),
+		"total":      batch.Total,
+		"created_by": batch.CreatedBy,
+		"created_at": batch.CreatedAt.UTC(),
+		"progress":   batch.Progress(),
+	}
+	if len(batch.Labels) > 0 {
+		data["labels"] = batch.Labels
+	}
+	if payload := strings.TrimSpace(string(batch.Payload)); payload != "" && json.Valid([]byte(payload)) {
+		data["payload"] = json.RawMessage(payload)
+	}
+	if withItems {
+		items := batch.Items
+		if items == nil {
+			items = []inter.CommandBatchItem{}
+		}
+		data["items"] = items
+	}
+	return data
+}
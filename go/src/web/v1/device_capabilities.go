@@ -0,0 +1,59 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// deviceCapabilitiesHandler 处理 `/devices/{uuid}/capabilities`，返回设备声明的能力，便于前端按类型渲染控件。
+func (api *API) deviceCapabilitiesHandler(w http.ResponseWriter, r *http.Request, uuid string) {
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	meta, err := api.registry.GetDeviceMetadataByScope(api.scopeFromRequest(r), uuid)
+	if err != nil {
+		api.deviceScopeError(w, r, err, 40436)
+		return
+	}
+	items := meta.Descriptor.Capabilities
+	if items == nil {
+		items = []inter.DeviceCapability{}
+	}
+	api.OK(w, r, map[string]interface{}{
+		"uuid":  uuid,
+		"items": items,
+	})
+}
+
+// setPayloadDetail 校验 set 命令负载的形状：必须是非空的属性对象，合法时返回 nil。
+func setPayloadDetail(rawPayload []byte) *ErrorDetail {
+	var values map[string]interface{}
+	if err := json.Unmarshal(rawPayload, &values); err != nil || len(values) == 0 {
+		return &ErrorDetail{Type: "validation_error", Field: "payload", Reason: "set payload must be a non-empty object of property values"}
+	}
+	return nil
+}
+
+// capabilityViolationDetail 把能力校验错误转换为响应详情，其他错误返回 nil；
+// 第一个违规属性写入 field/reason，完整列表放在 details.violations 中。
+func capabilityViolationDetail(err error) *ErrorDetail {
+	var violation *inter.CapabilityViolationError
+	if !errors.As(err, &violation) || len(violation.Violations) == 0 {
+		return nil
+	}
+	first := violation.Violations[0]
+	field := "payload"
+	if first.Property != "" {
+		field += "." + first.Property
+	}
+	return &ErrorDetail{
+		Type:    "validation_error",
+		Field:   field,
+		Reason:  first.Message,
+		Details: map[string]interface{}{"violations": violation.Violations},
+	}
+}
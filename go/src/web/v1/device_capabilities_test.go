@@ -0,0 +1,88 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIDeviceCapabilitiesAndSetCommandValidation(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("e", 64)
+	if err := env.dataStore.InitDevice(uuid, inter.DeviceMetadata{
+		Name:               "Bulb",
+		SerialNumber:       "sn-bulb",
+		CreatedAt:          time.Now().UTC(),
+		Token:              "tk-bulb",
+		AuthenticateStatus: inter.Authenticated,
+	}); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+	if err := env.dataStore.SaveDeviceCapabilities(uuid, []inter.DeviceCapability{
+		{Type: "light", Features: []inter.DeviceCapability{
+			{Property: "state", Type: "binary", Writable: true, AllowedValues: []string{"ON", "OFF"}},
+			{Property: "brightness", Type: "numeric", Writable: true, ValueMin: "0", ValueMax: "254"},
+		}},
+		{Property: "linkquality", Type: "numeric", Readable: true},
+	}); err != nil {
+		t.Fatalf("SaveDeviceCapabilities failed: %v", err)
+	}
+
+	req := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/capabilities", nil), inter.PermissionReadOnly)
+	rec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("capabilities expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	items := mustJSONEnvelope(t, rec).Data.(map[string]interface{})["items"].([]interface{})
+	if len(items) != 2 || items[0].(map[string]interface{})["type"] != "light" {
+		t.Fatalf("unexpected capabilities: %+v", items)
+	}
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := withPerm(httptest.NewRequest(http.MethodPost, "/api/v1/devices/"+uuid+"/commands", strings.NewReader(body)), inter.PermissionReadWrite)
+		rec := httptest.NewRecorder()
+		env.api.DeviceByUUIDHandler(rec, req)
+		return rec
+	}
+
+	rec = send(`{"command":"set","payload":{"brightness":300,"linkquality":1,"state":"ON"}}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid set expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	envelope := mustJSONEnvelope(t, rec)
+	if envelope.Code != 40039 || envelope.Error == nil || envelope.Error.Field != "payload.brightness" {
+		t.Fatalf("unexpected validation error: %+v", envelope.Error)
+	}
+	violations := envelope.Error.Details["violations"].([]interface{})
+	if len(violations) != 2 || violations[1].(map[string]interface{})["reason"] != "not_writable" {
+		t.Fatalf("unexpected violations: %+v", violations)
+	}
+
+	if rec := send(`{"command":"set","payload":"ON"}`); rec.Code != http.StatusBadRequest || mustJSONEnvelope(t, rec).Error.Field != "payload" {
+		t.Fatalf("non-object set payload should be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = send(`{"command":"set","payload":{"state":"ON","brightness":128}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid set expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if data := mustJSONEnvelope(t, rec).Data.(map[string]interface{}); data["command"] != "set" || data["cmd_id"] != float64(inter.CmdActionExec) {
+		t.Fatalf("unexpected enqueue response: %+v", data)
+	}
+
+	// action_exec 与 set 走同一通道下发，同样按能力校验。
+	if rec := send(`{"command":"action_exec","payload":{"brightness":300}}`); rec.Code != http.StatusBadRequest || mustJSONEnvelope(t, rec).Code != 40039 {
+		t.Fatalf("action_exec should be validated against capabilities, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := send(`{"command":"config_push","payload":{"version":1,"state":{"linkquality":1}}}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("config_push state should be validated against capabilities, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := send(`{"command":"config_push","payload":{"config_version":1,"config":{"interval":30}}}`); rec.Code != http.StatusOK {
+		t.Fatalf("config documents should bypass capability validation, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,233 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// listDeviceCommands 处理 `GET /devices/{uuid}/commands`，按 id 倒序返回设备的命令历史。
+// 翻页时把上一页的 next_cursor 作为 cursor 传回，next_cursor 为空表示没有更多记录。
+func (api *API) listDeviceCommands(w http.ResponseWriter, r *http.Request, uuid string) {
+	if !api.ensureDeviceInScope(w, r, uuid, 40438) {
+		return
+	}
+	query, detail := parseDeviceCommandQuery(r)
+	if detail != nil {
+		api.Error(w, r, http.StatusBadRequest, 40042, "invalid command query", detail)
+		return
+	}
+
+	items := []inter.DeviceCommand{}
+	nextCursor := ""
+	if api.downlinkCommands != nil {
+		var err error
+		var next int64
+		items, next, err = api.downlinkCommands.ListCommands(api.scopeFromRequest(r), uuid, query)
+		if err != nil {
+			api.InternalError(w, r, 50040, err)
+			return
+		}
+		if next > 0 {
+			nextCursor = strconv.FormatInt(next, 10)
+		}
+	}
+	payload := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		payload = append(payload, deviceCommandPayload(item))
+	}
+	api.OK(w, r, map[string]interface{}{
+		"uuid":        uuid,
+		"items":       payload,
+		"next_cursor": nextCursor,
+	})
+}
+
+// CommandByIDHandler 处理 `/api/v1/commands/{id}`：GET 返回命令的完整生命周期，DELETE 取消仍在排队的命令。
+func (api *API) CommandByIDHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	if r.Method == http.MethodDelete && !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+		return
+	}
+	raw := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/commands/"), "/")
+	commandID, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || commandID <= 0 {
+		api.Error(w, r, http.StatusBadRequest, 40043, "invalid command id",
+			&ErrorDetail{Type: "validation_error", Field: "id"})
+		return
+	}
+	if api.downlinkCommands == nil {
+		api.Error(w, r, http.StatusNotFound, 40439, "command not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+		return
+	}
+	cmd, err := api.downlinkCommands.GetCommand(api.scopeFromRequest(r), commandID)
+	if err != nil {
+		if errors.Is(err, inter.ErrDeviceCommandNotFound) {
+			api.Error(w, r, http.StatusNotFound, 40439, "command not found",
+				&ErrorDetail{Type: "not_found", Field: "id"})
+			return
+		}
+		api.InternalError(w, r, 50042, err)
+		return
+	}
+	// 命令所属设备不在当前授权范围内时按不存在处理，不暴露其他设备的命令。
+	if _, err := api.registry.GetDeviceMetadataByScope(api.scopeFromRequest(r), cmd.UUID); err != nil {
+		if errors.Is(err, inter.ErrDeviceNotFound) || errors.Is(err, inter.ErrDeviceTenantMismatch) {
+			api.Error(w, r, http.StatusNotFound, 40439, "command not found",
+				&ErrorDetail{Type: "not_found", Field: "id"})
+			return
+		}
+		api.InternalError(w, r, 50042, err)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		api.cancelCommand(w, r, cmd)
+		return
+	}
+	api.OK(w, r, deviceCommandPayload(cmd))
+}
+
+// cancelCommand 取消排队中的命令；命令已发出或已结束时返回 409，并附带当前状态。
+func (api *API) cancelCommand(w http.ResponseWriter, r *http.Request, cmd inter.DeviceCommand) {
+	cancelled, err := api.downlinkCommands.Cancel(api.scopeFromRequest(r), cmd.ID, r.URL.Query().Get("reason"))
+	if err != nil {
+		if errors.Is(err, inter.ErrDeviceCommandNotQueued) {
+			api.Error(w, r, http.StatusConflict, 40924, "command is no longer queued",
+				&ErrorDetail{Type: "conflict", Field: "status", Reason: string(cancelled.Status)})
+			return
+		}
+		if errors.Is(err, inter.ErrDeviceCommandNotFound) {
+			api.Error(w, r, http.StatusNotFound, 40439, "command not found",
+				&ErrorDetail{Type: "not_found", Field: "id"})
+			return
+		}
+		api.InternalError(w, r, 50043, err)
+		return
+	}
+	api.OK(w, r, deviceCommandPayload(cancelled))
+}
+
+// parseDeviceCommandQuery 解析命令历史的过滤与分页参数，参数非法时返回对应的错误详情。
+func parseDeviceCommandQuery(r *http.Request) (inter.DeviceCommandQuery, *ErrorDetail) {
+	values := r.URL.Query()
+	var query inter.DeviceCommandQuery
+	if raw := strings.TrimSpace(values.Get("status")); raw != "" {
+		for _, item := range strings.Split(raw, ",") {
+			status, ok := parseDeviceCommandStatus(item)
+			if !ok {
+				return query, &ErrorDetail{Type: "validation_error", Field: "status", Reason: "unknown status " + strings.TrimSpace(item)}
+			}
+			query.Statuses = append(query.Statuses, status)
+		}
+	}
+	if raw := strings.TrimSpace(values.Get("command")); raw != "" {
+		_, command, err := ParseDownlinkCommand(raw)
+		if err != nil {
+			return query, &ErrorDetail{Type: "validation_error", Field: "command"}
+		}
+		query.Command = command
+	}
+	for _, field := range []string{"start_ms", "end_ms"} {
+		raw := strings.TrimSpace(values.Get(field))
+		if raw == "" {
+			continue
+		}
+		ms, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || ms < 0 {
+			return query, &ErrorDetail{Type: "validation_error", Field: field}
+		}
+		if field == "start_ms" {
+			query.Start = time.UnixMilli(ms)
+		} else {
+			query.End = time.UnixMilli(ms)
+		}
+	}
+	if !query.Start.IsZero() && !query.End.IsZero() && query.Start.After(query.End) {
+		return query, &ErrorDetail{Type: "validation_error", Field: "start_ms", Reason: "start_ms must be less than or equal to end_ms"}
+	}
+	if raw := strings.TrimSpace(values.Get("cursor")); raw != "" {
+		cursor, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || cursor <= 0 {
+			return query, &ErrorDetail{Type: "validation_error", Field: "cursor"}
+		}
+		query.BeforeID = cursor
+	}
+	limit, err := ParsePositiveIntQuery(values.Get("limit"), 0, 0)
+	if err != nil {
+		return query, &ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()}
+	}
+	query.Limit = limit
+	return query, nil
+}
+
+func parseDeviceCommandStatus(raw string) (inter.DeviceCommandStatus, bool) {
+	status := inter.DeviceCommandStatus(strings.TrimSpace(strings.ToLower(raw)))
+	switch status {
+	case inter.DeviceCommandStatusQueued,
+		inter.DeviceCommandStatusSent,
+		inter.DeviceCommandStatusAcked,
+		inter.DeviceCommandStatusFailed,
+		inter.DeviceCommandStatusExpired,
+		inter.DeviceCommandStatusOverflow,
+		inter.DeviceCommandStatusCancelled:
+		return status, true
+	default:
+		return "", false
+	}
+}
+
+// deviceCommandPayload 把命令记录展开为生命周期视图：终态时间按状态落到 acked_at、failed_at 或 expired_at。
+func deviceCommandPayload(cmd inter.DeviceCommand) map[string]interface{} {
+	data := map[string]interface{}{
+		"id":           cmd.ID,
+		"uuid":         cmd.UUID,
+		"command":      cmd.Command,
+		"key":          cmd.Key,
+		"cmd_id":       int(cmd.CmdID),
+		"status":       cmd.Status,
+		"attempts":     cmd.Attempts,
+		"max_attempts": cmd.MaxAttempts,
+		"timeout_ms":   cmd.TimeoutMs,
+		"queued_at":    cmd.RequestedAt.UTC(),
+		"delivered_by": cmd.DeliveredBy,
+	}
+	if payload := strings.TrimSpace(string(cmd.Payload)); payload != "" && json.Valid([]byte(payload)) {
+		data["payload"] = json.RawMessage(payload)
+	}
+	if cmd.ErrorText != "" {
+		data["error_text"] = cmd.ErrorText
+	}
+	if cmd.ExpiresAt != nil {
+		data["expires_at"] = cmd.ExpiresAt.UTC()
+	}
+	if cmd.SentAt != nil {
+		data["sent_at"] = cmd.SentAt.UTC()
+	}
+	if cmd.AckDeadlineAt != nil {
+		data["ack_deadline_at"] = cmd.AckDeadlineAt.UTC()
+	}
+	if cmd.ExecutedAt != nil {
+		executedAt := cmd.ExecutedAt.UTC()
+		data["completed_at"] = executedAt
+		switch cmd.Status {
+		case inter.DeviceCommandStatusAcked:
+			data["acked_at"] = executedAt
+		case inter.DeviceCommandStatusFailed:
+			data["failed_at"] = executedAt
+		case inter.DeviceCommandStatusExpired, inter.DeviceCommandStatusOverflow:
+			data["expired_at"] = executedAt
+		case inter.DeviceCommandStatusCancelled:
+			data["cancelled_at"] = executedAt
+		}
+	}
+	return data
+}
@@ -0,0 +1,136 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIDeviceCommandHistoryAndDetail(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("e", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+
+	var ids []int64
+	for _, command := range []string{"action_exec", "config_push", "action_exec"} {
+		msg, err := env.downlinkCommands.Enqueue(inter.Scope{}, uuid, inter.CmdActionExec, command, []byte(`{"op":"x"}`))
+		if err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+		ids = append(ids, msg.CommandID)
+	}
+	if err := env.downlinkCommands.MarkSentVia(ids[0], inter.CommandDelivery{InstanceID: "ingress-1", AdapterID: "mqtt"}); err != nil {
+		t.Fatalf("MarkSentVia failed: %v", err)
+	}
+	if err := env.downlinkCommands.MarkAcked(ids[0]); err != nil {
+		t.Fatalf("MarkAcked failed: %v", err)
+	}
+
+	list := func(query string) (int, map[string]interface{}, int) {
+		t.Helper()
+		req := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/commands"+query, nil), inter.PermissionReadOnly)
+		rec := httptest.NewRecorder()
+		env.api.DeviceByUUIDHandler(rec, req)
+		envelope := mustJSONEnvelope(t, rec)
+		data, _ := envelope.Data.(map[string]interface{})
+		return rec.Code, data, envelope.Code
+	}
+
+	status, data, _ := list("?limit=2")
+	if status != http.StatusOK {
+		t.Fatalf("list expected 200, got %d", status)
+	}
+	items := data["items"].([]interface{})
+	if len(items) != 2 || items[0].(map[string]interface{})["id"] != float64(ids[2]) || data["next_cursor"] != strconv.FormatInt(ids[1], 10) {
+		t.Fatalf("unexpected first page: %+v", data)
+	}
+	_, data, _ = list("?limit=2&cursor=" + data["next_cursor"].(string))
+	items = data["items"].([]interface{})
+	if len(items) != 1 || items[0].(map[string]interface{})["id"] != float64(ids[0]) || data["next_cursor"] != "" {
+		t.Fatalf("unexpected second page: %+v", data)
+	}
+
+	_, data, _ = list("?status=queued&command=config_push")
+	items = data["items"].([]interface{})
+	if len(items) != 1 || items[0].(map[string]interface{})["id"] != float64(ids[1]) {
+		t.Fatalf("unexpected filtered page: %+v", data)
+	}
+
+	if status, _, code := list("?status=bogus"); status != http.StatusBadRequest || code != 40042 {
+		t.Fatalf("invalid status expected 400/40042, got %d/%d", status, code)
+	}
+
+	detailReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/commands/"+strconv.FormatInt(ids[0], 10), nil), inter.PermissionReadOnly)
+	detailRec := httptest.NewRecorder()
+	env.api.CommandByIDHandler(detailRec, detailReq)
+	if detailRec.Code != http.StatusOK {
+		t.Fatalf("detail expected 200, got %d: %s", detailRec.Code, detailRec.Body.String())
+	}
+	detail := mustJSONEnvelope(t, detailRec).Data.(map[string]interface{})
+	delivered := detail["delivered_by"].(map[string]interface{})
+	if detail["status"] != "acked" || detail["attempts"] != float64(1) || detail["queued_at"] == nil || detail["sent_at"] == nil || detail["acked_at"] == nil ||
+		delivered["instance_id"] != "ingress-1" || delivered["adapter_id"] != "mqtt" {
+		t.Fatalf("unexpected command detail: %+v", detail)
+	}
+	if payload := detail["payload"].(map[string]interface{}); payload["op"] != "x" {
+		t.Fatalf("unexpected command payload: %+v", detail["payload"])
+	}
+
+	missingReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/commands/999999", nil), inter.PermissionReadOnly)
+	missingRec := httptest.NewRecorder()
+	env.api.CommandByIDHandler(missingRec, missingReq)
+	if code := mustJSONEnvelope(t, missingRec).Code; missingRec.Code != http.StatusNotFound || code != 40439 {
+		t.Fatalf("missing command expected 404/40439, got %d/%d", missingRec.Code, code)
+	}
+}
+
+func TestAPICancelAndSupersedeDeviceCommands(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("f", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+
+	enqueue := func(body string) map[string]interface{} {
+		t.Helper()
+		req := withPerm(httptest.NewRequest(http.MethodPost, "/api/v1/devices/"+uuid+"/commands", strings.NewReader(body)), inter.PermissionReadWrite)
+		rec := httptest.NewRecorder()
+		env.api.DeviceByUUIDHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("enqueue expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		return mustJSONEnvelope(t, rec).Data.(map[string]interface{})
+	}
+	cancel := func(id float64, perm inter.PermissionType) (int, map[string]interface{}, int) {
+		t.Helper()
+		req := withPerm(httptest.NewRequest(http.MethodDelete, "/api/v1/commands/"+strconv.FormatInt(int64(id), 10), nil), perm)
+		rec := httptest.NewRecorder()
+		env.api.CommandByIDHandler(rec, req)
+		envelope := mustJSONEnvelope(t, rec)
+		data, _ := envelope.Data.(map[string]interface{})
+		return rec.Code, data, envelope.Code
+	}
+
+	first := enqueue(`{"command":"config_push","payload":{"interval":5},"key":"interval","supersede":true}`)
+	if first["key"] != "interval" {
+		t.Fatalf("expected key in enqueue response: %+v", first)
+	}
+	second := enqueue(`{"command":"config_push","payload":{"interval":10},"key":"interval","supersede":true}`)
+
+	if status, _, _ := cancel(second["command_id"].(float64), inter.PermissionReadOnly); status != http.StatusForbidden {
+		t.Fatalf("read-only cancel expected 403, got %d", status)
+	}
+	status, data, _ := cancel(second["command_id"].(float64), inter.PermissionReadWrite)
+	if status != http.StatusOK || data["status"] != "cancelled" || data["cancelled_at"] == nil {
+		t.Fatalf("unexpected cancel response: %d %+v", status, data)
+	}
+	status, _, code := cancel(first["command_id"].(float64), inter.PermissionReadWrite)
+	if status != http.StatusConflict || code != 40924 {
+		t.Fatalf("superseded command cancel expected 409/40924, got %d/%d", status, code)
+	}
+	if msg, ok, err := env.downlinkCommands.PopDownlink(uuid); err != nil || ok {
+		t.Fatalf("queue should be empty after supersede and cancel, got %+v ok=%v err=%v", msg, ok, err)
+	}
+}
@@ -0,0 +1,235 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// maxConfigListLimit 是配置历史与确认记录单次返回的上限。
+const maxConfigListLimit = 200
+
+// configDocumentRequest 是保存配置文档的请求体，content 整体替换该层的配置。
+type configDocumentRequest struct {
+	Content map[string]interface{} `json:"content"`
+	Comment string                 `json:"comment,omitempty"`
+}
+
+// configRollbackRequest 是回滚配置的请求体。
+type configRollbackRequest struct {
+	Version int64 `json:"version"`
+}
+
+// ConfigsHandler 处理 `/api/v1/configs/{tenant|groups/{id}|devices/{uuid}}` 及其 versions、rollback 子路径。
+func (api *API) ConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/configs/"), "/"), "/")
+	var scopeType inter.ConfigScopeType
+	var scopeID string
+	var rest []string
+	switch {
+	case parts[0] == "tenant":
+		scopeType, rest = inter.ConfigScopeTenant, parts[1:]
+	case len(parts) >= 2 && (parts[0] == "groups" || parts[0] == "devices"):
+		scopeType = inter.ConfigScopeGroup
+		if parts[0] == "devices" {
+			scopeType = inter.ConfigScopeDevice
+		}
+		id, err := url.PathUnescape(parts[1])
+		if err != nil || strings.TrimSpace(id) == "" {
+			api.Error(w, r, http.StatusBadRequest, 40097, "invalid config document",
+				&ErrorDetail{Type: "validation_error", Field: "id"})
+			return
+		}
+		scopeID, rest = id, parts[2:]
+	default:
+		api.Error(w, r, http.StatusNotFound, 40486, "config document not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	if api.deviceConfigs == nil {
+		api.Error(w, r, http.StatusNotFound, 40486, "config document not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	scope := api.scopeFromRequest(r)
+
+	switch {
+	case len(rest) == 0:
+		switch r.Method {
+		case http.MethodGet:
+			doc, err := api.deviceConfigs.GetDocument(scope, scopeType, scopeID, 0)
+			if err != nil {
+				api.configError(w, r, err)
+				return
+			}
+			api.OK(w, r, doc)
+		case http.MethodPut:
+			api.saveConfigDocument(w, r, scopeType, scopeID)
+		default:
+			api.MethodNotAllowed(w, r)
+		}
+	case rest[0] == "versions" && len(rest) <= 2:
+		if r.Method != http.MethodGet {
+			api.MethodNotAllowed(w, r)
+			return
+		}
+		if len(rest) == 2 {
+			version, err := strconv.ParseInt(rest[1], 10, 64)
+			if err != nil || version <= 0 {
+				api.Error(w, r, http.StatusBadRequest, 40098, "invalid config version",
+					&ErrorDetail{Type: "validation_error", Field: "version"})
+				return
+			}
+			doc, err := api.deviceConfigs.GetDocument(scope, scopeType, scopeID, version)
+			if err != nil {
+				api.configError(w, r, err)
+				return
+			}
+			api.OK(w, r, doc)
+			return
+		}
+		limit, err := ParsePositiveIntQuery(r.URL.Query().Get("limit"), 50, maxConfigListLimit)
+		if err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40089, "invalid limit",
+				&ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()})
+			return
+		}
+		docs, err := api.deviceConfigs.ListVersions(scope, scopeType, scopeID, limit)
+		if err != nil {
+			api.configError(w, r, err)
+			return
+		}
+		api.OK(w, r, map[string]interface{}{
+			"items": docs,
+			"total": len(docs),
+		})
+	case rest[0] == "rollback" && len(rest) == 1:
+		if r.Method != http.MethodPost {
+			api.MethodNotAllowed(w, r)
+			return
+		}
+		if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+			return
+		}
+		var payload configRollbackRequest
+		if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40082, "invalid json body",
+				&ErrorDetail{Type: "validation_error"})
+			return
+		}
+		if payload.Version <= 0 {
+			api.Error(w, r, http.StatusBadRequest, 40098, "invalid config version",
+				&ErrorDetail{Type: "validation_error", Field: "version"})
+			return
+		}
+		createdBy, _ := r.Context().Value(ContextUsername).(string)
+		doc, err := api.deviceConfigs.Rollback(scope, scopeType, scopeID, payload.Version, createdBy)
+		if err != nil {
+			api.configError(w, r, err)
+			return
+		}
+		api.OK(w, r, doc)
+	default:
+		api.Error(w, r, http.StatusNotFound, 40486, "config document not found",
+			&ErrorDetail{Type: "not_found"})
+	}
+}
+
+func (api *API) saveConfigDocument(w http.ResponseWriter, r *http.Request, scopeType inter.ConfigScopeType, scopeID string) {
+	if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+		return
+	}
+	var payload configDocumentRequest
+	if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40082, "invalid json body",
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	if payload.Content == nil {
+		api.Error(w, r, http.StatusBadRequest, 40097, "invalid config document",
+			&ErrorDetail{Type: "validation_error", Field: "content", Reason: "content is required"})
+		return
+	}
+	createdBy, _ := r.Context().Value(ContextUsername).(string)
+	doc, err := api.deviceConfigs.SaveDocument(api.scopeFromRequest(r), inter.ConfigDocument{
+		ScopeType: scopeType,
+		ScopeID:   scopeID,
+		Content:   payload.Content,
+		Comment:   payload.Comment,
+		CreatedBy: createdBy,
+	})
+	if err != nil {
+		api.configError(w, r, err)
+		return
+	}
+	api.OK(w, r, doc)
+}
+
+// deviceConfigHandler 处理 `/devices/{uuid}/config`（生效配置与对账状态）与 `/devices/{uuid}/config/acks`（确认审计）。
+func (api *API) deviceConfigHandler(w http.ResponseWriter, r *http.Request, uuid string, rest []string) {
+	if len(rest) > 1 || (len(rest) == 1 && rest[0] != "acks") {
+		api.Error(w, r, http.StatusNotFound, 40413, "path not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	if !api.ensureDeviceInScope(w, r, uuid, 40487) {
+		return
+	}
+	if api.deviceConfigs == nil {
+		api.Error(w, r, http.StatusNotFound, 40486, "config document not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	scope := api.scopeFromRequest(r)
+	if len(rest) == 0 {
+		effective, err := api.deviceConfigs.GetEffective(scope, uuid)
+		if err != nil {
+			api.configError(w, r, err)
+			return
+		}
+		api.OK(w, r, effective)
+		return
+	}
+	limit, err := ParsePositiveIntQuery(r.URL.Query().Get("limit"), 50, maxConfigListLimit)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40089, "invalid limit",
+			&ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()})
+		return
+	}
+	acks, err := api.deviceConfigs.ListAcks(scope, uuid, limit)
+	if err != nil {
+		api.configError(w, r, err)
+		return
+	}
+	api.OK(w, r, map[string]interface{}{
+		"items": acks,
+		"total": len(acks),
+	})
+}
+
+func (api *API) configError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, inter.ErrConfigDocumentInvalid):
+		api.Error(w, r, http.StatusBadRequest, 40097, "invalid config document",
+			&ErrorDetail{Type: "validation_error", Reason: err.Error()})
+	case errors.Is(err, inter.ErrConfigDocumentNotFound):
+		api.Error(w, r, http.StatusNotFound, 40486, "config document not found",
+			&ErrorDetail{Type: "not_found", Field: "version"})
+	case errors.Is(err, inter.ErrDeviceGroupNotFound):
+		api.Error(w, r, http.StatusNotFound, 40481, "device group not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+	case errors.Is(err, inter.ErrDeviceNotFound):
+		api.Error(w, r, http.StatusNotFound, 40487, "device not found",
+			&ErrorDetail{Type: "not_found", Field: "uuid"})
+	default:
+		api.InternalError(w, r, 50089, err)
+	}
+}
@@ -0,0 +1,84 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIDeviceConfigDocumentsAndEffective(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("c", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+
+	call := func(method, path, body string, perm inter.PermissionType, handler http.HandlerFunc) (int, map[string]interface{}, int) {
+		t.Helper()
+		req := withPerm(httptest.NewRequest(method, path, strings.NewReader(body)), perm)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		envelope := mustJSONEnvelope(t, rec)
+		data, _ := envelope.Data.(map[string]interface{})
+		return rec.Code, data, envelope.Code
+	}
+
+	if status, _, code := call(http.MethodGet, "/api/v1/configs/tenant", "", inter.PermissionReadOnly, env.api.ConfigsHandler); status != http.StatusNotFound || code != 40486 {
+		t.Fatalf("empty tenant config expected 404/40486, got %d/%d", status, code)
+	}
+	if status, _, _ := call(http.MethodPut, "/api/v1/configs/tenant", `{"content":{"interval":60}}`, inter.PermissionReadOnly, env.api.ConfigsHandler); status != http.StatusForbidden {
+		t.Fatalf("read-only save expected 403, got %d", status)
+	}
+	if status, _, code := call(http.MethodPut, "/api/v1/configs/tenant", `{"comment":"no content"}`, inter.PermissionReadWrite, env.api.ConfigsHandler); status != http.StatusBadRequest || code != 40097 {
+		t.Fatalf("missing content expected 400/40097, got %d/%d", status, code)
+	}
+	for _, body := range []string{`{"content":{"interval":60,"mode":"eco"}}`, `{"content":{"interval":5},"comment":"debug"}`} {
+		if status, data, _ := call(http.MethodPut, "/api/v1/configs/tenant", body, inter.PermissionReadWrite, env.api.ConfigsHandler); status != http.StatusOK || data["scope_type"] != "tenant" {
+			t.Fatalf("save tenant config expected 200, got %d: %+v", status, data)
+		}
+	}
+	devicePath := "/api/v1/configs/devices/" + uuid
+	if status, data, _ := call(http.MethodPut, devicePath, `{"content":{"mode":"boost"}}`, inter.PermissionReadWrite, env.api.ConfigsHandler); status != http.StatusOK || data["version"] != float64(1) {
+		t.Fatalf("save device config expected 200, got %d: %+v", status, data)
+	}
+	if status, _, code := call(http.MethodPut, "/api/v1/configs/devices/missing", `{"content":{}}`, inter.PermissionReadWrite, env.api.ConfigsHandler); status != http.StatusNotFound || code != 40487 {
+		t.Fatalf("unknown device expected 404/40487, got %d/%d", status, code)
+	}
+	if status, _, code := call(http.MethodGet, "/api/v1/configs/groups/grp_missing", "", inter.PermissionReadOnly, env.api.ConfigsHandler); status != http.StatusNotFound || code != 40481 {
+		t.Fatalf("unknown group expected 404/40481, got %d/%d", status, code)
+	}
+
+	status, data, _ := call(http.MethodGet, "/api/v1/configs/tenant/versions", "", inter.PermissionReadOnly, env.api.ConfigsHandler)
+	if status != http.StatusOK || data["total"] != float64(2) {
+		t.Fatalf("list versions expected two, got %d: %+v", status, data)
+	}
+	if status, data, _ := call(http.MethodGet, "/api/v1/configs/tenant/versions/1", "", inter.PermissionReadOnly, env.api.ConfigsHandler); status != http.StatusOK || data["content"].(map[string]interface{})["interval"] != float64(60) {
+		t.Fatalf("get version 1 expected 200, got %d: %+v", status, data)
+	}
+	if status, _, code := call(http.MethodGet, "/api/v1/configs/tenant/versions/abc", "", inter.PermissionReadOnly, env.api.ConfigsHandler); status != http.StatusBadRequest || code != 40098 {
+		t.Fatalf("invalid version expected 400/40098, got %d/%d", status, code)
+	}
+	status, data, _ = call(http.MethodPost, "/api/v1/configs/tenant/rollback", `{"version":1}`, inter.PermissionReadWrite, env.api.ConfigsHandler)
+	if status != http.StatusOK || data["version"] != float64(3) || data["rolled_back_from"] != float64(1) {
+		t.Fatalf("rollback expected version 3, got %d: %+v", status, data)
+	}
+	if status, _, code := call(http.MethodPost, "/api/v1/configs/tenant/rollback", `{"version":9}`, inter.PermissionReadWrite, env.api.ConfigsHandler); status != http.StatusNotFound || code != 40486 {
+		t.Fatalf("rollback to missing version expected 404/40486, got %d/%d", status, code)
+	}
+
+	status, data, _ = call(http.MethodGet, "/api/v1/devices/"+uuid+"/config", "", inter.PermissionReadOnly, env.api.DeviceByUUIDHandler)
+	if status != http.StatusOK || data["in_sync"] != false {
+		t.Fatalf("effective config expected 200, got %d: %+v", status, data)
+	}
+	config := data["config"].(map[string]interface{})
+	if config["interval"] != float64(60) || config["mode"] != "boost" || len(data["sources"].([]interface{})) != 2 {
+		t.Fatalf("unexpected effective config: %+v", data)
+	}
+	if status, data, _ := call(http.MethodGet, "/api/v1/devices/"+uuid+"/config/acks", "", inter.PermissionReadOnly, env.api.DeviceByUUIDHandler); status != http.StatusOK || data["total"] != float64(0) {
+		t.Fatalf("acks expected empty list, got %d: %+v", status, data)
+	}
+	if status, _, code := call(http.MethodGet, "/api/v1/devices/missing/config", "", inter.PermissionReadOnly, env.api.DeviceByUUIDHandler); status != http.StatusNotFound || code != 40487 {
+		t.Fatalf("unknown device effective config expected 404/40487, got %d/%d", status, code)
+	}
+}
@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// deviceConnectivityHandler 处理 `/devices/{uuid}/connectivity`，返回在线/离线切换历史与当前状态。
+func (api *API) deviceConnectivityHandler(w http.ResponseWriter, r *http.Request, uuid string) {
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	if !api.ensureDeviceInScope(w, r, uuid, 40434) {
+		return
+	}
+	start, end, rangeLabel, err := ResolveMetricsRange(r, api.metricsMinValidTimestampMs(), api.metricsDefaultRangeLabel())
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40036, err.Error(),
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	limit, err := ParsePositiveIntQuery(r.URL.Query().Get("limit"), 0, 0)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40037, "invalid limit",
+			&ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()})
+		return
+	}
+
+	items, err := api.presence.QueryConnectivityHistory(api.scopeFromRequest(r), uuid, inter.DeviceConnectivityQuery{
+		Start: start,
+		End:   end,
+		Limit: limit,
+	})
+	if err != nil {
+		api.InternalError(w, r, 50036, err)
+		return
+	}
+	status, _ := api.presence.QueryDeviceStatus(uuid)
+	api.OK(w, r, map[string]interface{}{
+		"uuid":        uuid,
+		"status_text": deviceStatusText(status),
+		"range":       rangeLabel,
+		"start_ms":    start,
+		"end_ms":      end,
+		"items":       items,
+	})
+}
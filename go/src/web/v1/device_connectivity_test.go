@@ -0,0 +1,52 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIDeviceConnectivityHistory(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("e", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+
+	env.devicePresence.HandleHeartbeat(uuid)
+	env.devicePresence.ReportAvailability(uuid, false, "mqtt_disconnect")
+
+	req := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/connectivity?range=1h", nil), inter.PermissionReadOnly)
+	rec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("connectivity expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	data := mustJSONEnvelope(t, rec).Data.(map[string]interface{})
+	if data["status_text"] != "offline" {
+		t.Fatalf("expected offline status, got %v", data["status_text"])
+	}
+	items := data["items"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("unexpected connectivity history: %+v", items)
+	}
+	last := items[1].(map[string]interface{})
+	if last["status"] != "offline" || last["reason"] != "mqtt_disconnect" {
+		t.Fatalf("unexpected last transition: %+v", last)
+	}
+
+	badReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/connectivity?limit=-1", nil), inter.PermissionReadOnly)
+	badRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(badRec, badReq)
+	if code := mustJSONEnvelope(t, badRec).Code; badRec.Code != http.StatusBadRequest || code != 40037 {
+		t.Fatalf("invalid limit expected 400/40037, got %d/%d", badRec.Code, code)
+	}
+
+	missingReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+strings.Repeat("f", 64)+"/connectivity", nil), inter.PermissionReadOnly)
+	missingRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(missingRec, missingReq)
+	if code := mustJSONEnvelope(t, missingRec).Code; missingRec.Code != http.StatusNotFound || code != 40434 {
+		t.Fatalf("missing device expected 404/40434, got %d/%d", missingRec.Code, code)
+	}
+}
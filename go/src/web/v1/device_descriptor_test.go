@@ -0,0 +1,52 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIDeviceDetailIncludesDescriptorAndIdentities(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("d", 64)
+	meta := inter.DeviceMetadata{
+		Name:               "Bulb",
+		SerialNumber:       "sn-bulb",
+		CreatedAt:          time.Now().UTC(),
+		Token:              "tk-bulb",
+		AuthenticateStatus: inter.Authenticated,
+		Descriptor: inter.DeviceDescriptor{
+			Manufacturer: "IKEA",
+			Model:        "LED1545G12",
+			Labels:       map[string]string{"room": "kitchen"},
+			Capabilities: []inter.DeviceCapability{{Property: "state", Type: "enum", Writable: true, AllowedValues: []string{"ON", "OFF"}}},
+		},
+		Identities: []inter.DeviceIdentity{{Type: inter.DeviceIdentityIEEEAddress, Value: "0x00124b0001"}},
+	}
+	if err := env.dataStore.InitDevice(uuid, meta); err != nil {
+		t.Fatalf("InitDevice failed: %v", err)
+	}
+
+	req := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid, nil), inter.PermissionReadOnly)
+	rec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("device detail expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	data := mustJSONEnvelope(t, rec).Data.(map[string]interface{})
+	descriptor := data["descriptor"].(map[string]interface{})
+	if descriptor["manufacturer"] != "IKEA" || descriptor["model"] != "LED1545G12" || descriptor["labels"].(map[string]interface{})["room"] != "kitchen" {
+		t.Fatalf("unexpected descriptor: %+v", descriptor)
+	}
+	if caps := descriptor["capabilities"].([]interface{}); len(caps) != 1 || caps[0].(map[string]interface{})["property"] != "state" {
+		t.Fatalf("unexpected capabilities: %+v", descriptor["capabilities"])
+	}
+	identities := data["identities"].([]interface{})
+	if len(identities) != 1 || identities[0].(map[string]interface{})["type"] != inter.DeviceIdentityIEEEAddress {
+		t.Fatalf("unexpected identities: %+v", identities)
+	}
+}
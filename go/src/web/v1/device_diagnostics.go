@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// deviceDiagnosticsHandler 处理 `/devices/{uuid}/diagnostics`，返回心跳诊断的采样历史。
+func (api *API) deviceDiagnosticsHandler(w http.ResponseWriter, r *http.Request, uuid string) {
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	if !api.ensureDeviceInScope(w, r, uuid, 40437) {
+		return
+	}
+	start, end, rangeLabel, err := ResolveMetricsRange(r, api.metricsMinValidTimestampMs(), api.metricsDefaultRangeLabel())
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40040, err.Error(),
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	limit, err := ParsePositiveIntQuery(r.URL.Query().Get("limit"), 0, 0)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40041, "invalid limit",
+			&ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()})
+		return
+	}
+
+	items := []inter.DeviceDiagnostics{}
+	if api.deviceDiagnostics != nil {
+		items, err = api.deviceDiagnostics.QueryDiagnosticsHistory(api.scopeFromRequest(r), uuid, inter.DeviceDiagnosticsQuery{
+			Start: start,
+			End:   end,
+			Limit: limit,
+		})
+		if err != nil {
+			api.InternalError(w, r, 50039, err)
+			return
+		}
+	}
+	api.OK(w, r, map[string]interface{}{
+		"uuid":     uuid,
+		"range":    rangeLabel,
+		"start_ms": start,
+		"end_ms":   end,
+		"items":    items,
+	})
+}
+
+// latestDiagnosticsPayload 返回设备详情 runtime.diagnostics 字段；设备尚未上报诊断时返回 nil。
+func (api *API) latestDiagnosticsPayload(scope inter.Scope, uuid string) (map[string]interface{}, error) {
+	if api.deviceDiagnostics == nil {
+		return nil, nil
+	}
+	diag, err := api.deviceDiagnostics.LatestDiagnostics(scope, uuid)
+	if err != nil {
+		if errors.Is(err, inter.ErrDeviceDiagnosticsNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return map[string]interface{}{
+		"state":       diag.State,
+		"observed_at": diag.ObservedAt,
+		"received_at": diag.ReceivedAt,
+	}, nil
+}
@@ -0,0 +1,70 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIDeviceRuntimeDiagnostics(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("d", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+
+	getDevice := func() map[string]interface{} {
+		t.Helper()
+		req := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid, nil), inter.PermissionReadOnly)
+		rec := httptest.NewRecorder()
+		env.api.DeviceByUUIDHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("get device expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		data := mustJSONEnvelope(t, rec).Data.(map[string]interface{})
+		return data["runtime"].(map[string]interface{})
+	}
+	if _, ok := getDevice()["diagnostics"]; ok {
+		t.Fatal("device without heartbeat state should not expose diagnostics")
+	}
+
+	observedAt := time.Now().Add(-time.Minute).UnixMilli()
+	if err := env.deviceDiagnostics.RecordHeartbeat(uuid, map[string]interface{}{"rssi": -58.0, "fw": "1.2.0"}, observedAt); err != nil {
+		t.Fatalf("RecordHeartbeat failed: %v", err)
+	}
+	diagnostics, ok := getDevice()["diagnostics"].(map[string]interface{})
+	if !ok {
+		t.Fatal("expected runtime.diagnostics after heartbeat")
+	}
+	state := diagnostics["state"].(map[string]interface{})
+	if state["rssi"] != -58.0 || state["fw"] != "1.2.0" || diagnostics["observed_at"] != float64(observedAt) {
+		t.Fatalf("unexpected runtime diagnostics: %+v", diagnostics)
+	}
+
+	req := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/diagnostics?range=1h", nil), inter.PermissionReadOnly)
+	rec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("diagnostics history expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	items := mustJSONEnvelope(t, rec).Data.(map[string]interface{})["items"].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("unexpected diagnostics history: %+v", items)
+	}
+
+	badReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/diagnostics?limit=abc", nil), inter.PermissionReadOnly)
+	badRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(badRec, badReq)
+	if code := mustJSONEnvelope(t, badRec).Code; badRec.Code != http.StatusBadRequest || code != 40041 {
+		t.Fatalf("invalid limit expected 400/40041, got %d/%d", badRec.Code, code)
+	}
+
+	missingReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+strings.Repeat("c", 64)+"/diagnostics", nil), inter.PermissionReadOnly)
+	missingRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(missingRec, missingReq)
+	if code := mustJSONEnvelope(t, missingRec).Code; missingRec.Code != http.StatusNotFound || code != 40437 {
+		t.Fatalf("missing device expected 404/40437, got %d/%d", missingRec.Code, code)
+	}
+}
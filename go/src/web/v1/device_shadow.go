@@ -0,0 +1,69 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// deviceShadowHandler 处理 `/devices/{uuid}/shadow` 的读取与 desired 更新。
+func (api *API) deviceShadowHandler(w http.ResponseWriter, r *http.Request, uuid string) {
+	switch r.Method {
+	case http.MethodGet:
+		api.getDeviceShadow(w, r, uuid)
+	case http.MethodPatch:
+		api.patchDeviceShadow(w, r, uuid)
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+func (api *API) getDeviceShadow(w http.ResponseWriter, r *http.Request, uuid string) {
+	if !api.ensureDeviceInScope(w, r, uuid, 40433) {
+		return
+	}
+	shadow, err := api.deviceShadows.GetShadow(api.scopeFromRequest(r), uuid)
+	if err != nil {
+		api.InternalError(w, r, 50034, err)
+		return
+	}
+	api.OK(w, r, shadow)
+}
+
+func (api *API) patchDeviceShadow(w http.ResponseWriter, r *http.Request, uuid string) {
+	if !api.ensurePerm(w, r, inter.PermissionReadWrite) || !api.ensureDeviceInScope(w, r, uuid, 40433) {
+		return
+	}
+
+	var payload struct {
+		Desired map[string]interface{} `json:"desired"`
+		Version *int64                 `json:"version,omitempty"`
+	}
+	if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40034, "invalid json body",
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	if payload.Desired == nil {
+		api.Error(w, r, http.StatusBadRequest, 40035, "validation failed",
+			&ErrorDetail{Type: "validation_error", Field: "desired", Reason: "desired is required"})
+		return
+	}
+
+	shadow, err := api.deviceShadows.UpdateDesired(api.scopeFromRequest(r), uuid, payload.Desired, payload.Version)
+	if err != nil {
+		if errors.Is(err, inter.ErrDeviceShadowConflict) {
+			api.Error(w, r, http.StatusConflict, 40923, "shadow version conflict",
+				&ErrorDetail{Type: "conflict", Field: "version"})
+			return
+		}
+		if detail := capabilityViolationDetail(err); detail != nil {
+			api.Error(w, r, http.StatusBadRequest, 40039, "command violates device capabilities", detail)
+			return
+		}
+		api.InternalError(w, r, 50035, err)
+		return
+	}
+	api.OK(w, r, shadow)
+}
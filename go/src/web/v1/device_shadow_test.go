@@ -0,0 +1,58 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIDeviceShadowGetAndPatch(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("d", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+
+	getReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/shadow", nil), inter.PermissionReadOnly)
+	getRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(getRec, getReq)
+	if getRec.Code != http.StatusOK {
+		t.Fatalf("get shadow expected 200, got %d: %s", getRec.Code, getRec.Body.String())
+	}
+	if version := mustJSONEnvelope(t, getRec).Data.(map[string]interface{})["version"]; version != float64(0) {
+		t.Fatalf("empty shadow version should be 0, got %v", version)
+	}
+
+	readOnlyReq := withPerm(httptest.NewRequest(http.MethodPatch, "/api/v1/devices/"+uuid+"/shadow", strings.NewReader(`{"desired":{"mode":"eco"}}`)), inter.PermissionReadOnly)
+	readOnlyRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(readOnlyRec, readOnlyReq)
+	if readOnlyRec.Code != http.StatusForbidden {
+		t.Fatalf("read-only patch expected 403, got %d", readOnlyRec.Code)
+	}
+
+	patchReq := withPerm(httptest.NewRequest(http.MethodPatch, "/api/v1/devices/"+uuid+"/shadow", strings.NewReader(`{"desired":{"mode":"eco"},"version":0}`)), inter.PermissionReadWrite)
+	patchRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(patchRec, patchReq)
+	if patchRec.Code != http.StatusOK {
+		t.Fatalf("patch shadow expected 200, got %d: %s", patchRec.Code, patchRec.Body.String())
+	}
+	data := mustJSONEnvelope(t, patchRec).Data.(map[string]interface{})
+	if data["version"] != float64(1) || data["delta"].(map[string]interface{})["mode"] != "eco" {
+		t.Fatalf("unexpected patched shadow: %+v", data)
+	}
+
+	staleReq := withPerm(httptest.NewRequest(http.MethodPatch, "/api/v1/devices/"+uuid+"/shadow", strings.NewReader(`{"desired":{"mode":"boost"},"version":0}`)), inter.PermissionReadWrite)
+	staleRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(staleRec, staleReq)
+	if code := mustJSONEnvelope(t, staleRec).Code; staleRec.Code != http.StatusConflict || code != 40923 {
+		t.Fatalf("stale patch expected 409/40923, got %d/%d", staleRec.Code, code)
+	}
+
+	missingReq := withPerm(httptest.NewRequest(http.MethodPatch, "/api/v1/devices/"+uuid+"/shadow", strings.NewReader(`{"version":1}`)), inter.PermissionReadWrite)
+	missingRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(missingRec, missingReq)
+	if code := mustJSONEnvelope(t, missingRec).Code; missingRec.Code != http.StatusBadRequest || code != 40035 {
+		t.Fatalf("missing desired expected 400/40035, got %d/%d", missingRec.Code, code)
+	}
+}
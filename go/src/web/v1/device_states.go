@@ -0,0 +1,80 @@
+package v1
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// deviceStateHandler 处理 `/devices/{uuid}/state` 及其历史子路由。
+func (api *API) deviceStateHandler(w http.ResponseWriter, r *http.Request, uuid string, rest []string) {
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	switch {
+	case len(rest) == 0:
+		api.listDeviceStates(w, r, uuid)
+	case len(rest) == 1 && rest[0] == "history":
+		api.queryDeviceStateHistory(w, r, uuid)
+	default:
+		api.Error(w, r, http.StatusNotFound, 40413, "path not found",
+			&ErrorDetail{Type: "not_found"})
+	}
+}
+
+func (api *API) listDeviceStates(w http.ResponseWriter, r *http.Request, uuid string) {
+	if !api.ensureDeviceInScope(w, r, uuid, 40432) {
+		return
+	}
+	states, err := api.deviceStates.ListStates(api.scopeFromRequest(r), uuid)
+	if err != nil {
+		api.InternalError(w, r, 50032, err)
+		return
+	}
+	api.OK(w, r, map[string]interface{}{
+		"uuid":  uuid,
+		"items": states,
+	})
+}
+
+func (api *API) queryDeviceStateHistory(w http.ResponseWriter, r *http.Request, uuid string) {
+	if !api.ensureDeviceInScope(w, r, uuid, 40432) {
+		return
+	}
+	start, end, rangeLabel, err := ResolveMetricsRange(r, api.metricsMinValidTimestampMs(), api.metricsDefaultRangeLabel())
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40032, err.Error(),
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	limit, err := ParsePositiveIntQuery(r.URL.Query().Get("limit"), 0, 0)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40033, "invalid limit",
+			&ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()})
+		return
+	}
+
+	query := inter.DeviceStateHistoryQuery{
+		Name:     strings.TrimSpace(r.URL.Query().Get("name")),
+		EntityID: strings.TrimSpace(r.URL.Query().Get("entity_id")),
+		Start:    start,
+		End:      end,
+		Limit:    limit,
+	}
+	items, err := api.deviceStates.QueryStateHistory(api.scopeFromRequest(r), uuid, query)
+	if err != nil {
+		api.InternalError(w, r, 50033, err)
+		return
+	}
+	api.OK(w, r, map[string]interface{}{
+		"uuid":      uuid,
+		"name":      query.Name,
+		"entity_id": query.EntityID,
+		"range":     rangeLabel,
+		"start_ms":  start,
+		"end_ms":    end,
+		"items":     items,
+	})
+}
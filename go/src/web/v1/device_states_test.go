@@ -0,0 +1,72 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIDeviceStateAndHistory(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("c", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+
+	base := time.Now().Add(-time.Minute).UnixMilli()
+	on, off := true, false
+	for i, v := range []*bool{&on, &off} {
+		if err := env.deviceStates.IngestStates(uuid, []inter.DeviceState{
+			{Name: "switch", EntityID: "relay_1", ValueBool: v, Timestamp: base + int64(i)*1000},
+		}); err != nil {
+			t.Fatalf("ingest states failed: %v", err)
+		}
+	}
+
+	latestReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/state", nil), inter.PermissionReadOnly)
+	latestRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(latestRec, latestReq)
+	if latestRec.Code != http.StatusOK {
+		t.Fatalf("state expected 200, got %d: %s", latestRec.Code, latestRec.Body.String())
+	}
+	latestItems := mustJSONEnvelope(t, latestRec).Data.(map[string]interface{})["items"].([]interface{})
+	if len(latestItems) != 1 || latestItems[0].(map[string]interface{})["value_bool"] != false {
+		t.Fatalf("unexpected latest states: %+v", latestItems)
+	}
+
+	historyReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/state/history?name=switch&range=1h", nil), inter.PermissionReadOnly)
+	historyRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(historyRec, historyReq)
+	if historyRec.Code != http.StatusOK {
+		t.Fatalf("state history expected 200, got %d: %s", historyRec.Code, historyRec.Body.String())
+	}
+	historyItems := mustJSONEnvelope(t, historyRec).Data.(map[string]interface{})["items"].([]interface{})
+	if len(historyItems) != 2 {
+		t.Fatalf("unexpected history count: got %d want 2", len(historyItems))
+	}
+
+	badLimitReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/state/history?limit=0", nil), inter.PermissionReadOnly)
+	badLimitRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(badLimitRec, badLimitReq)
+	if code := mustJSONEnvelope(t, badLimitRec).Code; badLimitRec.Code != http.StatusBadRequest || code != 40033 {
+		t.Fatalf("invalid limit expected 400/40033, got %d/%d", badLimitRec.Code, code)
+	}
+
+	crossReq := httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+uuid+"/state", nil)
+	crossReq.Header.Set("X-Tenant-Id", "tenant_other")
+	crossReq = withPerm(crossReq, inter.PermissionReadOnly)
+	crossRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(crossRec, crossReq)
+	if code := mustJSONEnvelope(t, crossRec).Code; crossRec.Code != http.StatusNotFound || code != 40432 {
+		t.Fatalf("cross-tenant state expected 404/40432, got %d/%d", crossRec.Code, code)
+	}
+
+	postReq := withPerm(httptest.NewRequest(http.MethodPost, "/api/v1/devices/"+uuid+"/state", nil), inter.PermissionReadWrite)
+	postRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(postRec, postReq)
+	if postRec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("post state expected 405, got %d", postRec.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// deviceTopologyItem 在拓扑节点上附带当前在线状态，便于前端直接渲染网关下的设备树。
+type deviceTopologyItem struct {
+	inter.DeviceTopologyNode
+	StatusText string `json:"status_text"`
+}
+
+// deviceChildrenHandler 处理 `/devices/{uuid}/children`，列出网关的直连子设备。
+func (api *API) deviceChildrenHandler(w http.ResponseWriter, r *http.Request, uuid string) {
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	if !api.ensureDeviceInScope(w, r, uuid, 40435) {
+		return
+	}
+	children, err := api.deviceTopology.ListChildren(api.scopeFromRequest(r), uuid)
+	if err != nil {
+		api.InternalError(w, r, 50037, err)
+		return
+	}
+	api.OK(w, r, map[string]interface{}{
+		"uuid":  uuid,
+		"items": api.topologyItems(children),
+	})
+}
+
+// devicePathHandler 处理 `/devices/{uuid}/path`，返回设备经由各级网关到云端的路径。
+func (api *API) devicePathHandler(w http.ResponseWriter, r *http.Request, uuid string) {
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	if !api.ensureDeviceInScope(w, r, uuid, 40435) {
+		return
+	}
+	path, err := api.deviceTopology.PathToCloud(api.scopeFromRequest(r), uuid)
+	if err != nil {
+		api.InternalError(w, r, 50038, err)
+		return
+	}
+	api.OK(w, r, map[string]interface{}{
+		"uuid":  uuid,
+		"depth": len(path) - 1,
+		"items": api.topologyItems(path),
+	})
+}
+
+func (api *API) topologyItems(nodes []inter.DeviceTopologyNode) []deviceTopologyItem {
+	items := make([]deviceTopologyItem, 0, len(nodes))
+	for _, node := range nodes {
+		status, _ := api.presence.QueryDeviceStatus(node.UUID)
+		items = append(items, deviceTopologyItem{DeviceTopologyNode: node, StatusText: deviceStatusText(status)})
+	}
+	return items
+}
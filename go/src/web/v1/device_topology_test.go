@@ -0,0 +1,63 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIDeviceTopologyChildrenAndPath(t *testing.T) {
+	env := newTestAPI(t)
+	gateway := strings.Repeat("a", 64)
+	sensor := strings.Repeat("b", 64)
+	seedDevice(t, env.dataStore, gateway, inter.Authenticated)
+	seedDevice(t, env.dataStore, sensor, inter.Authenticated)
+
+	if err := env.deviceTopology.ApplyTopology(inter.DeviceTopologyNode{UUID: gateway, DeviceType: "gateway"}, []inter.DeviceTopologyNode{
+		{UUID: "router-1", DeviceType: "router"},
+		{UUID: sensor, DeviceType: "enddevice"},
+	}); err != nil {
+		t.Fatalf("ApplyTopology failed: %v", err)
+	}
+	env.devicePresence.HandleHeartbeat(gateway)
+	env.devicePresence.HandleHeartbeat(sensor)
+	env.devicePresence.ReportAvailability(gateway, false, "mqtt_disconnect")
+
+	req := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+gateway+"/children", nil), inter.PermissionReadOnly)
+	rec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("children expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	items := mustJSONEnvelope(t, rec).Data.(map[string]interface{})["items"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("unexpected children: %+v", items)
+	}
+	child := items[0].(map[string]interface{})
+	// 网关离线后子设备被联动标记为离线，不必等待心跳超时。
+	if child["uuid"] != sensor || child["parent_uuid"] != gateway || child["status_text"] != "offline" {
+		t.Fatalf("unexpected child: %+v", child)
+	}
+
+	pathReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+sensor+"/path", nil), inter.PermissionReadOnly)
+	pathRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(pathRec, pathReq)
+	if pathRec.Code != http.StatusOK {
+		t.Fatalf("path expected 200, got %d: %s", pathRec.Code, pathRec.Body.String())
+	}
+	data := mustJSONEnvelope(t, pathRec).Data.(map[string]interface{})
+	path := data["items"].([]interface{})
+	if data["depth"].(float64) != 1 || len(path) != 2 || path[1].(map[string]interface{})["uuid"] != gateway {
+		t.Fatalf("unexpected path: %+v", data)
+	}
+
+	missingReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+strings.Repeat("c", 64)+"/children", nil), inter.PermissionReadOnly)
+	missingRec := httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(missingRec, missingReq)
+	if code := mustJSONEnvelope(t, missingRec).Code; missingRec.Code != http.StatusNotFound || code != 40435 {
+		t.Fatalf("missing device expected 404/40435, got %d/%d", missingRec.Code, code)
+	}
+}
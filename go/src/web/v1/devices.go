@@ -54,20 +54,12 @@ func (api *API) listDevices(w http.ResponseWriter, r *http.Request) {
 	items := make([]map[string]interface{}, 0, len(devices))
 	for _, d := range devices {
 		runtimeStatus, _ := api.presence.QueryDeviceStatus(d.UUID)
-		statusText := "offline"
-		switch runtimeStatus {
-		case inter.StatusOnline:
-			statusText = "online"
-		case inter.StatusDelayed:
-			statusText = "delayed"
-		}
-
 		items = append(items, map[string]interface{}{
 			"uuid": d.UUID,
 			"meta": deviceMetadataPayload(d.Meta, includeToken),
 			"runtime": map[string]interface{}{
 				"status":      int(runtimeStatus),
-				"status_text": statusText,
+				"status_text": deviceStatusText(runtimeStatus),
 			},
 		})
 	}
@@ -181,6 +173,44 @@ func (api *API) DeviceByUUIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if parts[1] == "state" {
+		api.deviceStateHandler(w, r, uuid, parts[2:])
+		return
+	}
+	if len(parts) == 2 && parts[1] == "shadow" {
+		api.deviceShadowHandler(w, r, uuid)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "connectivity" {
+		api.deviceConnectivityHandler(w, r, uuid)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "children" {
+		api.deviceChildrenHandler(w, r, uuid)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "path" {
+		api.devicePathHandler(w, r, uuid)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "capabilities" {
+		api.deviceCapabilitiesHandler(w, r, uuid)
+		return
+	}
+	if len(parts) == 2 && parts[1] == "diagnostics" {
+		api.deviceDiagnosticsHandler(w, r, uuid)
+		return
+	}
+	if parts[1] == "config" {
+		api.deviceConfigHandler(w, r, uuid, parts[2:])
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "commands" && r.Method == http.MethodGet {
+		api.listDeviceCommands(w, r, uuid)
+		return
+	}
+
 	if len(parts) == 2 {
 		if r.Method != http.MethodPost {
 			api.MethodNotAllowed(w, r)
@@ -266,38 +296,74 @@ func (api *API) getDevice(w http.ResponseWriter, r *http.Request, uuid string) {
 	}
 
 	runtimeStatus, _ := api.presence.QueryDeviceStatus(uuid)
-	statusText := "offline"
-	switch runtimeStatus {
-	case inter.StatusOnline:
-		statusText = "online"
-	case inter.StatusDelayed:
-		statusText = "delayed"
+	runtime := map[string]interface{}{
+		"status":      int(runtimeStatus),
+		"status_text": deviceStatusText(runtimeStatus),
+	}
+	diagnostics, err := api.latestDiagnosticsPayload(api.scopeFromRequest(r), uuid)
+	if err != nil {
+		api.InternalError(w, r, 50039, err)
+		return
+	}
+	if diagnostics != nil {
+		runtime["diagnostics"] = diagnostics
 	}
 
+	identities := meta.Identities
+	if identities == nil {
+		identities = []inter.DeviceIdentity{}
+	}
 	api.OK(w, r, map[string]interface{}{
-		"uuid": uuid,
-		"meta": deviceMetadataPayload(meta, canViewDeviceToken(r)),
-		"runtime": map[string]interface{}{
-			"status":      int(runtimeStatus),
-			"status_text": statusText,
-		},
+		"uuid":       uuid,
+		"meta":       deviceMetadataPayload(meta, canViewDeviceToken(r)),
+		"descriptor": meta.Descriptor,
+		"identities": identities,
+		"runtime":    runtime,
 	})
 }
 
+func deviceStatusText(status inter.DeviceStatus) string {
+	switch status {
+	case inter.StatusOnline:
+		return "online"
+	case inter.StatusDelayed:
+		return "delayed"
+	default:
+		return "offline"
+	}
+}
+
 func (api *API) enqueueDeviceCommand(w http.ResponseWriter, r *http.Request, uuid string) {
-	if !api.ensureDeviceExists(w, r, uuid) {
+	if _, err := api.registry.GetDeviceMetadataByScope(api.scopeFromRequest(r), uuid); err != nil {
+		api.deviceScopeError(w, r, err, 40421)
 		return
 	}
 
 	var payload struct {
-		Command string          `json:"command"`
-		Payload json.RawMessage `json:"payload,omitempty"`
+		Command        string          `json:"command"`
+		Payload        json.RawMessage `json:"payload,omitempty"`
+		TTLSeconds     int64           `json:"ttl_seconds,omitempty"`
+		TimeoutSeconds int64           `json:"timeout_seconds,omitempty"`
+		MaxAttempts    int             `json:"max_attempts,omitempty"`
+		Key            string          `json:"key,omitempty"`
+		Supersede      bool            `json:"supersede,omitempty"`
 	}
 	if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
 		api.Error(w, r, http.StatusBadRequest, 40026, "invalid json body",
 			&ErrorDetail{Type: "validation_error"})
 		return
 	}
+	if field := negativeCommandPolicyField(payload.TTLSeconds, payload.TimeoutSeconds, payload.MaxAttempts); field != "" {
+		api.Error(w, r, http.StatusBadRequest, 40038, "invalid command policy",
+			&ErrorDetail{Type: "validation_error", Field: field})
+		return
+	}
+
+	if len(strings.TrimSpace(payload.Key)) > maxCommandKeyLength {
+		api.Error(w, r, http.StatusBadRequest, 40038, "invalid command policy",
+			&ErrorDetail{Type: "validation_error", Field: "key"})
+		return
+	}
 
 	cmdID, command, err := ParseDownlinkCommand(payload.Command)
 	if err != nil {
@@ -307,14 +373,32 @@ func (api *API) enqueueDeviceCommand(w http.ResponseWriter, r *http.Request, uui
 	}
 
 	rawPayload := []byte(strings.TrimSpace(string(payload.Payload)))
+	if command == "set" {
+		if detail := setPayloadDetail(rawPayload); detail != nil {
+			api.Error(w, r, http.StatusBadRequest, 40039, "command violates device capabilities", detail)
+			return
+		}
+	}
 	scope := api.scopeFromRequest(r)
-	msg, err := api.downlinkCommands.Enqueue(scope, uuid, cmdID, command, rawPayload)
+	// 未指定的字段使用服务端默认有效期、确认超时与重试上限。
+	policy := inter.DeviceCommandPolicy{
+		TTL:         time.Duration(payload.TTLSeconds) * time.Second,
+		Timeout:     time.Duration(payload.TimeoutSeconds) * time.Second,
+		MaxAttempts: payload.MaxAttempts,
+		Key:         strings.TrimSpace(payload.Key),
+		Supersede:   payload.Supersede,
+	}
+	msg, err := api.downlinkCommands.EnqueueWithPolicy(scope, uuid, cmdID, command, rawPayload, policy)
 	if err != nil {
 		if errors.Is(err, inter.ErrDeviceTenantMismatch) {
 			api.Error(w, r, http.StatusForbidden, 40321, "forbidden",
 				&ErrorDetail{Type: "cross_tenant_denied"})
 			return
 		}
+		if detail := capabilityViolationDetail(err); detail != nil {
+			api.Error(w, r, http.StatusBadRequest, 40039, "command violates device capabilities", detail)
+			return
+		}
 		if errors.Is(err, inter.ErrDownlinkQueueFull) {
 			api.Error(w, r, http.StatusConflict, 40921, "queue command failed",
 				&ErrorDetail{Type: "conflict", Field: "command"})
@@ -325,14 +409,44 @@ func (api *API) enqueueDeviceCommand(w http.ResponseWriter, r *http.Request, uui
 		return
 	}
 
-	api.OK(w, r, map[string]interface{}{
-		"command_id":  msg.CommandID,
-		"uuid":        uuid,
-		"command":     command,
-		"cmd_id":      int(cmdID),
-		"status":      inter.DeviceCommandStatusQueued,
-		"enqueued_at": time.Now().UTC(),
-	})
+	enqueuedAt := msg.CreatedAt
+	if enqueuedAt.IsZero() {
+		enqueuedAt = time.Now()
+	}
+	data := map[string]interface{}{
+		"command_id":      msg.CommandID,
+		"uuid":            uuid,
+		"command":         command,
+		"cmd_id":          int(cmdID),
+		"status":          inter.DeviceCommandStatusQueued,
+		"enqueued_at":     enqueuedAt.UTC(),
+		"max_attempts":    msg.MaxAttempts,
+		"timeout_seconds": int64(msg.Timeout / time.Second),
+	}
+	if policy.Key != "" {
+		data["key"] = policy.Key
+	}
+	if !msg.ExpiresAt.IsZero() {
+		data["expires_at"] = msg.ExpiresAt.UTC()
+	}
+	api.OK(w, r, data)
+}
+
+// maxCommandKeyLength 限制替换键长度，键通常是配置项或属性名。
+const maxCommandKeyLength = 128
+
+// negativeCommandPolicyField 返回第一个取值为负的策略字段名，全部合法时返回空串。
+func negativeCommandPolicyField(ttlSeconds, timeoutSeconds int64, maxAttempts int) string {
+	switch {
+	case ttlSeconds < 0:
+		return "ttl_seconds"
+	case timeoutSeconds < 0:
+		return "timeout_seconds"
+	case maxAttempts < 0:
+		return "max_attempts"
+	default:
+		return ""
+	}
 }
 
 func provisionedDevicePayload(tenantID, uuid, token string) map[string]interface{} {
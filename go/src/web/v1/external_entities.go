@@ -0,0 +1,280 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// ExternalEntitiesHandler 处理 `/external/entities` 列表查询。
+func (api *API) ExternalEntitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	page, err := ParsePositiveIntQuery(r.URL.Query().Get("page"), 1, 0)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40071, "invalid page",
+			&ErrorDetail{Type: "validation_error", Field: "page", Reason: err.Error()})
+		return
+	}
+	size, err := ParsePositiveIntQuery(r.URL.Query().Get("size"), 0, 0)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40072, "invalid size",
+			&ErrorDetail{Type: "validation_error", Field: "size", Reason: err.Error()})
+		return
+	}
+
+	filter := inter.ExternalEntityFilter{
+		Source: strings.TrimSpace(r.URL.Query().Get("source")),
+		Domain: strings.TrimSpace(r.URL.Query().Get("domain")),
+		Room:   strings.TrimSpace(r.URL.Query().Get("room")),
+	}
+	items, err := api.externalEntities.ListExternalEntitiesByScope(api.scopeFromRequest(r), filter, page, size)
+	if err != nil {
+		api.InternalError(w, r, 50071, err)
+		return
+	}
+	api.OK(w, r, map[string]interface{}{
+		"items": items,
+		"page": map[string]interface{}{
+			"page":     page,
+			"size":     size,
+			"returned": len(items),
+		},
+		"filter": map[string]interface{}{
+			"source": filter.Source,
+			"domain": filter.Domain,
+			"room":   filter.Room,
+		},
+	})
+}
+
+// ExternalEntityByIDHandler 处理 `/external/entities/{source}/{entity_id}` 及其子路由。
+// entity_id 中的 `/` 需要按 %2F 转义。
+func (api *API) ExternalEntityByIDHandler(w http.ResponseWriter, r *http.Request) {
+	suffix := strings.TrimPrefix(r.URL.EscapedPath(), "/api/v1/external/entities/")
+	parts := strings.Split(strings.Trim(suffix, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		api.Error(w, r, http.StatusNotFound, 40413, "path not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	source, sourceErr := url.PathUnescape(parts[0])
+	entityID, entityErr := url.PathUnescape(parts[1])
+	if sourceErr != nil || entityErr != nil || strings.TrimSpace(source) == "" || strings.TrimSpace(entityID) == "" {
+		api.Error(w, r, http.StatusBadRequest, 40073, "invalid entity path",
+			&ErrorDetail{Type: "validation_error", Field: "entity_id"})
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			api.MethodNotAllowed(w, r)
+			return
+		}
+		api.getExternalEntity(w, r, source, entityID)
+		return
+	}
+	switch parts[2] {
+	case "observations":
+		if r.Method != http.MethodGet {
+			api.MethodNotAllowed(w, r)
+			return
+		}
+		api.queryExternalObservations(w, r, source, entityID)
+	case "link":
+		switch r.Method {
+		case http.MethodPut:
+			api.linkExternalEntity(w, r, source, entityID)
+		case http.MethodDelete:
+			api.unlinkExternalEntity(w, r, source, entityID)
+		default:
+			api.MethodNotAllowed(w, r)
+		}
+	case "commands":
+		switch r.Method {
+		case http.MethodGet:
+			api.listExternalCommands(w, r, source, entityID)
+		case http.MethodPost:
+			api.enqueueExternalCommand(w, r, source, entityID)
+		default:
+			api.MethodNotAllowed(w, r)
+		}
+	default:
+		api.Error(w, r, http.StatusNotFound, 40413, "path not found",
+			&ErrorDetail{Type: "not_found"})
+	}
+}
+
+func (api *API) getExternalEntity(w http.ResponseWriter, r *http.Request, source, entityID string) {
+	entity, err := api.externalEntities.GetExternalEntityByScope(api.scopeFromRequest(r), source, entityID)
+	if err != nil {
+		api.externalEntityError(w, r, err, 50072)
+		return
+	}
+	api.OK(w, r, map[string]interface{}{
+		"entity":     entity,
+		"last_state": externalLastState(entity),
+	})
+}
+
+func (api *API) queryExternalObservations(w http.ResponseWriter, r *http.Request, source, entityID string) {
+	scope := api.scopeFromRequest(r)
+	if _, err := api.externalEntities.GetExternalEntityByScope(scope, source, entityID); err != nil {
+		api.externalEntityError(w, r, err, 50073)
+		return
+	}
+	start, end, rangeLabel, err := ResolveMetricsRange(r, api.metricsMinValidTimestampMs(), api.metricsDefaultRangeLabel())
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40074, err.Error(),
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	limit, err := ParsePositiveIntQuery(r.URL.Query().Get("limit"), 0, 0)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40075, "invalid limit",
+			&ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()})
+		return
+	}
+
+	items, err := api.externalEntities.QueryExternalObservationsByScope(scope, source, entityID, start, end, limit)
+	if err != nil {
+		api.InternalError(w, r, 50073, err)
+		return
+	}
+	api.OK(w, r, map[string]interface{}{
+		"source":    source,
+		"entity_id": entityID,
+		"range":     rangeLabel,
+		"start_ms":  start,
+		"end_ms":    end,
+		"items":     items,
+	})
+}
+
+func (api *API) linkExternalEntity(w http.ResponseWriter, r *http.Request, source, entityID string) {
+	if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+		return
+	}
+	var payload struct {
+		GosterUUID string `json:"goster_uuid"`
+	}
+	if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40076, "invalid json body",
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	uuid := strings.TrimSpace(payload.GosterUUID)
+	if uuid == "" {
+		api.Error(w, r, http.StatusBadRequest, 40077, "validation failed",
+			&ErrorDetail{Type: "validation_error", Field: "goster_uuid", Reason: "goster_uuid is required"})
+		return
+	}
+	if !api.ensureDeviceInScope(w, r, uuid, 40472) {
+		return
+	}
+	entity, err := api.externalEntities.LinkExternalEntity(api.scopeFromRequest(r), source, entityID, uuid)
+	if err != nil {
+		api.externalEntityError(w, r, err, 50074)
+		return
+	}
+	api.OK(w, r, entity)
+}
+
+func (api *API) unlinkExternalEntity(w http.ResponseWriter, r *http.Request, source, entityID string) {
+	if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+		return
+	}
+	entity, err := api.externalEntities.LinkExternalEntity(api.scopeFromRequest(r), source, entityID, "")
+	if err != nil {
+		api.externalEntityError(w, r, err, 50074)
+		return
+	}
+	api.OK(w, r, entity)
+}
+
+func (api *API) listExternalCommands(w http.ResponseWriter, r *http.Request, source, entityID string) {
+	scope := api.scopeFromRequest(r)
+	if _, err := api.externalEntities.GetExternalEntityByScope(scope, source, entityID); err != nil {
+		api.externalEntityError(w, r, err, 50076)
+		return
+	}
+	limit, err := ParsePositiveIntQuery(r.URL.Query().Get("limit"), 50, 200)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40080, "invalid limit",
+			&ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()})
+		return
+	}
+	items, err := api.externalCommands.ListCommands(scope, source, entityID, limit)
+	if err != nil {
+		api.InternalError(w, r, 50076, err)
+		return
+	}
+	api.OK(w, r, map[string]interface{}{
+		"source":    source,
+		"entity_id": entityID,
+		"items":     items,
+	})
+}
+
+func (api *API) enqueueExternalCommand(w http.ResponseWriter, r *http.Request, source, entityID string) {
+	if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+		return
+	}
+	var payload struct {
+		Command string                 `json:"command"`
+		Payload map[string]interface{} `json:"payload"`
+	}
+	if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40078, "invalid json body",
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	if strings.TrimSpace(payload.Command) == "" {
+		api.Error(w, r, http.StatusBadRequest, 40079, "validation failed",
+			&ErrorDetail{Type: "validation_error", Field: "command", Reason: "command is required"})
+		return
+	}
+	cmd, err := api.externalCommands.Enqueue(api.scopeFromRequest(r), source, entityID, payload.Command, payload.Payload)
+	if err != nil {
+		if errors.Is(err, inter.ErrExternalCommandInvalid) {
+			api.Error(w, r, http.StatusBadRequest, 40081, "invalid command",
+				&ErrorDetail{Type: "validation_error", Field: "command", Reason: err.Error()})
+			return
+		}
+		api.externalEntityError(w, r, err, 50075)
+		return
+	}
+	api.OK(w, r, cmd)
+}
+
+func (api *API) externalEntityError(w http.ResponseWriter, r *http.Request, err error, internalCode int) {
+	if errors.Is(err, inter.ErrExternalEntityNotFound) {
+		api.Error(w, r, http.StatusNotFound, 40471, "external entity not found",
+			&ErrorDetail{Type: "not_found", Field: "entity_id"})
+		return
+	}
+	api.InternalError(w, r, internalCode, err)
+}
+
+// externalLastState 把实体上的最新值折叠成单个 value 字段，便于前端直接展示。
+func externalLastState(entity inter.ExternalEntity) map[string]interface{} {
+	var value interface{}
+	switch {
+	case entity.LastNum != nil:
+		value = *entity.LastNum
+	case entity.LastBool != nil:
+		value = *entity.LastBool
+	case entity.LastText != nil:
+		value = *entity.LastText
+	}
+	return map[string]interface{}{
+		"ts":    entity.LastStateTS,
+		"value": value,
+		"unit":  entity.Unit,
+	}
+}
@@ -0,0 +1,163 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIExternalEntitiesListGetAndLink(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("e", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+
+	now := time.Now().UnixMilli()
+	temp := 21.5
+	for _, entity := range []inter.ExternalEntity{
+		{TenantID: inter.DefaultTenantID, Source: "zigbee2mqtt", EntityID: "kitchen/sensor.temperature", Domain: "sensor", RoomName: "kitchen", ValueType: "number", Unit: "°C", LastNum: &temp, LastStateTS: now},
+		{TenantID: inter.DefaultTenantID, Source: "zigbee2mqtt", EntityID: "hall.contact", Domain: "binary_sensor", RoomName: "hall", ValueType: "bool", LastStateTS: now},
+		{TenantID: "tenant_other", Source: "zigbee2mqtt", EntityID: "garage.temperature", Domain: "sensor", RoomName: "kitchen", LastStateTS: now},
+	} {
+		if err := env.externalEntities.UpsertExternalEntity(entity); err != nil {
+			t.Fatalf("seed external entity failed: %v", err)
+		}
+	}
+	if err := env.externalEntities.BatchAppendExternalObservations([]inter.ExternalObservation{
+		{TenantID: inter.DefaultTenantID, Source: "zigbee2mqtt", EntityID: "kitchen/sensor.temperature", Timestamp: now, ValueNum: &temp},
+	}); err != nil {
+		t.Fatalf("seed observation failed: %v", err)
+	}
+
+	listReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/external/entities?source=zigbee2mqtt&room=kitchen", nil), inter.PermissionReadOnly)
+	listRec := httptest.NewRecorder()
+	env.api.ExternalEntitiesHandler(listRec, listReq)
+	if listRec.Code != http.StatusOK {
+		t.Fatalf("list expected 200, got %d: %s", listRec.Code, listRec.Body.String())
+	}
+	items := mustJSONEnvelope(t, listRec).Data.(map[string]interface{})["items"].([]interface{})
+	if len(items) != 1 || items[0].(map[string]interface{})["entity_id"] != "kitchen/sensor.temperature" {
+		t.Fatalf("unexpected external entity list: %+v", items)
+	}
+
+	entityPath := "/api/v1/external/entities/zigbee2mqtt/kitchen%2Fsensor.temperature"
+	getReq := withPerm(httptest.NewRequest(http.MethodGet, entityPath, nil), inter.PermissionReadOnly)
+	getRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(getRec, getReq)
+	if getRec.Code != http.StatusOK {
+		t.Fatalf("get expected 200, got %d: %s", getRec.Code, getRec.Body.String())
+	}
+	lastState := mustJSONEnvelope(t, getRec).Data.(map[string]interface{})["last_state"].(map[string]interface{})
+	if lastState["value"] != temp || lastState["unit"] != "°C" {
+		t.Fatalf("unexpected last state: %+v", lastState)
+	}
+
+	obsReq := withPerm(httptest.NewRequest(http.MethodGet, entityPath+"/observations?range=1h", nil), inter.PermissionReadOnly)
+	obsRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(obsRec, obsReq)
+	if obsRec.Code != http.StatusOK {
+		t.Fatalf("observations expected 200, got %d: %s", obsRec.Code, obsRec.Body.String())
+	}
+	if got := mustJSONEnvelope(t, obsRec).Data.(map[string]interface{})["items"].([]interface{}); len(got) != 1 {
+		t.Fatalf("unexpected observations: %+v", got)
+	}
+
+	crossReq := withPerm(httptest.NewRequest(http.MethodGet, "/api/v1/external/entities/zigbee2mqtt/garage.temperature", nil), inter.PermissionReadOnly)
+	crossRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(crossRec, crossReq)
+	if code := mustJSONEnvelope(t, crossRec).Code; crossRec.Code != http.StatusNotFound || code != 40471 {
+		t.Fatalf("cross-tenant entity expected 404/40471, got %d/%d", crossRec.Code, code)
+	}
+
+	readOnlyReq := withPerm(httptest.NewRequest(http.MethodPut, entityPath+"/link", strings.NewReader(`{"goster_uuid":"`+uuid+`"}`)), inter.PermissionReadOnly)
+	readOnlyRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(readOnlyRec, readOnlyReq)
+	if readOnlyRec.Code != http.StatusForbidden {
+		t.Fatalf("read-only link expected 403, got %d", readOnlyRec.Code)
+	}
+
+	missingReq := withPerm(httptest.NewRequest(http.MethodPut, entityPath+"/link", strings.NewReader(`{"goster_uuid":"missing-device"}`)), inter.PermissionReadWrite)
+	missingRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(missingRec, missingReq)
+	if code := mustJSONEnvelope(t, missingRec).Code; missingRec.Code != http.StatusNotFound || code != 40472 {
+		t.Fatalf("link to unknown device expected 404/40472, got %d/%d", missingRec.Code, code)
+	}
+
+	linkReq := withPerm(httptest.NewRequest(http.MethodPut, entityPath+"/link", strings.NewReader(`{"goster_uuid":"`+uuid+`"}`)), inter.PermissionReadWrite)
+	linkRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(linkRec, linkReq)
+	if linkRec.Code != http.StatusOK {
+		t.Fatalf("link expected 200, got %d: %s", linkRec.Code, linkRec.Body.String())
+	}
+	if got := mustJSONEnvelope(t, linkRec).Data.(map[string]interface{})["goster_uuid"]; got != uuid {
+		t.Fatalf("unexpected linked uuid: %v", got)
+	}
+
+	unlinkReq := withPerm(httptest.NewRequest(http.MethodDelete, entityPath+"/link", nil), inter.PermissionReadWrite)
+	unlinkRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(unlinkRec, unlinkReq)
+	if unlinkRec.Code != http.StatusOK {
+		t.Fatalf("unlink expected 200, got %d: %s", unlinkRec.Code, unlinkRec.Body.String())
+	}
+	if _, ok := mustJSONEnvelope(t, unlinkRec).Data.(map[string]interface{})["goster_uuid"]; ok {
+		t.Fatal("unlinked entity should not report goster_uuid")
+	}
+}
+
+func TestAPIExternalEntityCommands(t *testing.T) {
+	env := newTestAPI(t)
+	now := time.Now().UnixMilli()
+	for _, entity := range []inter.ExternalEntity{
+		{TenantID: inter.DefaultTenantID, Source: "zigbee2mqtt", EntityID: "living_plug.state", DeviceID: "living_plug", Domain: "switch", LastStateTS: now},
+		{TenantID: inter.DefaultTenantID, Source: "zigbee2mqtt", EntityID: "hall.contact", DeviceID: "hall", Domain: "binary_sensor", LastStateTS: now},
+	} {
+		if err := env.externalEntities.UpsertExternalEntity(entity); err != nil {
+			t.Fatalf("seed external entity failed: %v", err)
+		}
+	}
+
+	path := "/api/v1/external/entities/zigbee2mqtt/living_plug.state/commands"
+	postReq := withPerm(httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"command":"turn_on","payload":{"brightness":200}}`)), inter.PermissionReadWrite)
+	postRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(postRec, postReq)
+	if postRec.Code != http.StatusOK {
+		t.Fatalf("enqueue expected 200, got %d: %s", postRec.Code, postRec.Body.String())
+	}
+	created := mustJSONEnvelope(t, postRec).Data.(map[string]interface{})
+	payload := created["payload"].(map[string]interface{})
+	if created["status"] != string(inter.ExternalCommandStatusPending) || payload["state"] != "ON" || payload["brightness"] != float64(200) {
+		t.Fatalf("unexpected created command: %+v", created)
+	}
+
+	readOnlyReq := withPerm(httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"command":"turn_off"}`)), inter.PermissionReadOnly)
+	readOnlyRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(readOnlyRec, readOnlyReq)
+	if readOnlyRec.Code != http.StatusForbidden {
+		t.Fatalf("read-only enqueue expected 403, got %d", readOnlyRec.Code)
+	}
+
+	sensorReq := withPerm(httptest.NewRequest(http.MethodPost, "/api/v1/external/entities/zigbee2mqtt/hall.contact/commands", strings.NewReader(`{"command":"turn_on"}`)), inter.PermissionReadWrite)
+	sensorRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(sensorRec, sensorReq)
+	if code := mustJSONEnvelope(t, sensorRec).Code; sensorRec.Code != http.StatusBadRequest || code != 40081 {
+		t.Fatalf("sensor command expected 400/40081, got %d/%d", sensorRec.Code, code)
+	}
+
+	listReq := withPerm(httptest.NewRequest(http.MethodGet, path, nil), inter.PermissionReadOnly)
+	listRec := httptest.NewRecorder()
+	env.api.ExternalEntityByIDHandler(listRec, listReq)
+	if listRec.Code != http.StatusOK {
+		t.Fatalf("list expected 200, got %d: %s", listRec.Code, listRec.Body.String())
+	}
+	if items := mustJSONEnvelope(t, listRec).Data.(map[string]interface{})["items"].([]interface{}); len(items) != 1 {
+		t.Fatalf("unexpected command list: %+v", items)
+	}
+
+	claimed, err := env.externalCommands.PullPending(inter.DefaultTenantID, "zigbee2mqtt", "living_plug", 5)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("expected one pending command, got %+v err=%v", claimed, err)
+	}
+}
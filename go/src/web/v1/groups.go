@@ -0,0 +1,288 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// maxGroupDescriptionLength 限制分组描述长度，名称长度由分组服务校验。
+const maxGroupDescriptionLength = 500
+
+// groupRequest 是创建与更新分组的请求体；更新时省略的字段保持不变。
+type groupRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// GroupsHandler 处理 `/api/v1/groups`：GET 分页列出当前租户的分组，POST 创建分组。
+func (api *API) GroupsHandler(w http.ResponseWriter, r *http.Request) {
+	if api.deviceGroups == nil {
+		api.Error(w, r, http.StatusNotFound, 40481, "device group not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		page, size, ok := api.groupPage(w, r)
+		if !ok {
+			return
+		}
+		groups, total, err := api.deviceGroups.List(api.scopeFromRequest(r), page, size)
+		if err != nil {
+			api.InternalError(w, r, 50081, err)
+			return
+		}
+		api.OK(w, r, map[string]interface{}{
+			"items": groups,
+			"total": total,
+			"page":  page,
+			"size":  size,
+		})
+	case http.MethodPost:
+		if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+			return
+		}
+		payload, ok := api.decodeGroup(w, r)
+		if !ok {
+			return
+		}
+		group := inter.DeviceGroup{}
+		if payload.Name != nil {
+			group.Name = *payload.Name
+		}
+		if payload.Description != nil {
+			group.Description = *payload.Description
+		}
+		created, err := api.deviceGroups.Create(api.scopeFromRequest(r), group)
+		if err != nil {
+			api.groupError(w, r, err, 50082)
+			return
+		}
+		api.write(w, http.StatusCreated, Envelope{
+			Code:      0,
+			Message:   "ok",
+			RequestID: api.requestID(r),
+			Data:      created,
+		})
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+// GroupByIDHandler 处理 `/api/v1/groups/{id}` 及其 devices、commands 子路径。
+func (api *API) GroupByIDHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/groups/"), "/"), "/")
+	groupID := strings.TrimSpace(parts[0])
+	if groupID == "" || len(parts) > 3 {
+		api.Error(w, r, http.StatusNotFound, 40481, "device group not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+		return
+	}
+	if api.deviceGroups == nil {
+		api.Error(w, r, http.StatusNotFound, 40481, "device group not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		api.handleGroup(w, r, groupID)
+	case parts[1] == "devices" && len(parts) == 2:
+		api.handleGroupDevices(w, r, groupID)
+	case parts[1] == "devices" && len(parts) == 3:
+		if r.Method != http.MethodDelete {
+			api.MethodNotAllowed(w, r)
+			return
+		}
+		if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+			return
+		}
+		if err := api.deviceGroups.RemoveDevice(api.scopeFromRequest(r), groupID, parts[2]); err != nil {
+			api.groupError(w, r, err, 50084)
+			return
+		}
+		api.NoContent(w, r)
+	case parts[1] == "commands" && len(parts) == 2:
+		if r.Method != http.MethodPost {
+			api.MethodNotAllowed(w, r)
+			return
+		}
+		api.createCommandBatch(w, r, groupID)
+	default:
+		api.Error(w, r, http.StatusNotFound, 40481, "device group not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+	}
+}
+
+func (api *API) handleGroup(w http.ResponseWriter, r *http.Request, groupID string) {
+	scope := api.scopeFromRequest(r)
+	switch r.Method {
+	case http.MethodGet:
+		group, err := api.deviceGroups.Get(scope, groupID)
+		if err != nil {
+			api.groupError(w, r, err, 50083)
+			return
+		}
+		api.OK(w, r, group)
+	case http.MethodPatch:
+		if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+			return
+		}
+		payload, ok := api.decodeGroup(w, r)
+		if !ok {
+			return
+		}
+		updated, err := api.deviceGroups.Update(scope, groupID, payload.Name, payload.Description)
+		if err != nil {
+			api.groupError(w, r, err, 50083)
+			return
+		}
+		api.OK(w, r, updated)
+	case http.MethodDelete:
+		if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+			return
+		}
+		if err := api.deviceGroups.Delete(scope, groupID); err != nil {
+			api.groupError(w, r, err, 50083)
+			return
+		}
+		api.NoContent(w, r)
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+func (api *API) handleGroupDevices(w http.ResponseWriter, r *http.Request, groupID string) {
+	scope := api.scopeFromRequest(r)
+	switch r.Method {
+	case http.MethodGet:
+		page, size, ok := api.groupPage(w, r)
+		if !ok {
+			return
+		}
+		devices, err := api.deviceGroups.ListDevices(scope, groupID, page, size)
+		if err != nil {
+			api.groupError(w, r, err, 50084)
+			return
+		}
+		includeToken := canViewDeviceToken(r)
+		items := make([]map[string]interface{}, 0, len(devices))
+		for _, d := range devices {
+			runtimeStatus, _ := api.presence.QueryDeviceStatus(d.UUID)
+			items = append(items, map[string]interface{}{
+				"uuid": d.UUID,
+				"meta": deviceMetadataPayload(d.Meta, includeToken),
+				"runtime": map[string]interface{}{
+					"status":      int(runtimeStatus),
+					"status_text": deviceStatusText(runtimeStatus),
+				},
+			})
+		}
+		api.OK(w, r, map[string]interface{}{
+			"items": items,
+			"page": map[string]interface{}{
+				"page":     page,
+				"size":     size,
+				"returned": len(items),
+			},
+		})
+	case http.MethodPost:
+		if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+			return
+		}
+		var payload struct {
+			UUID string `json:"uuid"`
+		}
+		if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40082, "invalid json body",
+				&ErrorDetail{Type: "validation_error"})
+			return
+		}
+		uuid := strings.TrimSpace(payload.UUID)
+		if uuid == "" {
+			api.Error(w, r, http.StatusBadRequest, 40084, "invalid device uuid",
+				&ErrorDetail{Type: "validation_error", Field: "uuid"})
+			return
+		}
+		if err := api.deviceGroups.AddDevice(scope, groupID, uuid); err != nil {
+			api.groupError(w, r, err, 50084)
+			return
+		}
+		api.write(w, http.StatusCreated, Envelope{
+			Code:      0,
+			Message:   "ok",
+			RequestID: api.requestID(r),
+			Data: map[string]interface{}{
+				"action":  "add_group_device",
+				"target":  uuid,
+				"success": true,
+			},
+		})
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+func (api *API) decodeGroup(w http.ResponseWriter, r *http.Request) (groupRequest, bool) {
+	var payload groupRequest
+	if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40082, "invalid json body",
+			&ErrorDetail{Type: "validation_error"})
+		return groupRequest{}, false
+	}
+	if payload.Description != nil {
+		description := strings.TrimSpace(*payload.Description)
+		if utf8.RuneCountInString(description) > maxGroupDescriptionLength {
+			api.Error(w, r, http.StatusBadRequest, 40083, "invalid device group",
+				&ErrorDetail{Type: "validation_error", Field: "description"})
+			return groupRequest{}, false
+		}
+		payload.Description = &description
+	}
+	return payload, true
+}
+
+// groupPage 解析分组列表与分组设备列表共用的分页参数。
+func (api *API) groupPage(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	page, err := ParsePositiveIntQuery(r.URL.Query().Get("page"), 1, 0)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40087, "invalid page",
+			&ErrorDetail{Type: "validation_error", Field: "page", Reason: err.Error()})
+		return 0, 0, false
+	}
+	size, err := ParsePositiveIntQuery(r.URL.Query().Get("size"), api.deviceListDefaultPageSize(), api.deviceListMaxPageSize())
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40088, "invalid size",
+			&ErrorDetail{Type: "validation_error", Field: "size", Reason: err.Error()})
+		return 0, 0, false
+	}
+	return page, size, true
+}
+
+func (api *API) groupError(w http.ResponseWriter, r *http.Request, err error, internalCode int) {
+	switch {
+	case errors.Is(err, inter.ErrDeviceGroupInvalid):
+		api.Error(w, r, http.StatusBadRequest, 40083, "invalid device group",
+			&ErrorDetail{Type: "validation_error", Field: "name", Reason: err.Error()})
+	case errors.Is(err, inter.ErrDeviceGroupNotFound):
+		api.Error(w, r, http.StatusNotFound, 40481, "device group not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+	case errors.Is(err, inter.ErrDeviceGroupExists):
+		api.Error(w, r, http.StatusConflict, 40925, "device group name already exists",
+			&ErrorDetail{Type: "conflict", Field: "name"})
+	case errors.Is(err, inter.ErrGroupDeviceExists):
+		api.Error(w, r, http.StatusConflict, 40926, "device already in group",
+			&ErrorDetail{Type: "conflict", Field: "uuid"})
+	case errors.Is(err, inter.ErrGroupDeviceNotFound):
+		api.Error(w, r, http.StatusNotFound, 40482, "device not in group",
+			&ErrorDetail{Type: "not_found", Field: "uuid"})
+	case errors.Is(err, inter.ErrDeviceNotFound), errors.Is(err, inter.ErrDeviceTenantMismatch):
+		api.deviceScopeError(w, r, err, 40482)
+	default:
+		api.InternalError(w, r, internalCode, err)
+	}
+}
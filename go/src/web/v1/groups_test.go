@@ -0,0 +1,119 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIDeviceGroupsAndBatchCommands(t *testing.T) {
+	env := newTestAPI(t)
+	uuidA := strings.Repeat("g", 64)
+	uuidB := strings.Repeat("h", 64)
+	seedDevice(t, env.dataStore, uuidA, inter.Authenticated)
+	seedDevice(t, env.dataStore, uuidB, inter.Authenticated)
+
+	call := func(method, path, body string, perm inter.PermissionType, handler http.HandlerFunc) (int, map[string]interface{}, int) {
+		t.Helper()
+		req := withPerm(httptest.NewRequest(method, path, strings.NewReader(body)), perm)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code == http.StatusNoContent {
+			return rec.Code, nil, 0
+		}
+		envelope := mustJSONEnvelope(t, rec)
+		data, _ := envelope.Data.(map[string]interface{})
+		return rec.Code, data, envelope.Code
+	}
+
+	if status, _, _ := call(http.MethodPost, "/api/v1/groups", `{"name":"lobby"}`, inter.PermissionReadOnly, env.api.GroupsHandler); status != http.StatusForbidden {
+		t.Fatalf("read-only create expected 403, got %d", status)
+	}
+	status, created, _ := call(http.MethodPost, "/api/v1/groups", `{"name":"lobby","description":"front desk"}`, inter.PermissionReadWrite, env.api.GroupsHandler)
+	if status != http.StatusCreated || created["name"] != "lobby" || created["description"] != "front desk" {
+		t.Fatalf("create expected 201, got %d: %+v", status, created)
+	}
+	groupID := created["id"].(string)
+	if status, _, code := call(http.MethodPost, "/api/v1/groups", `{"name":"lobby"}`, inter.PermissionReadWrite, env.api.GroupsHandler); status != http.StatusConflict || code != 40925 {
+		t.Fatalf("duplicate name expected 409/40925, got %d/%d", status, code)
+	}
+	if status, _, code := call(http.MethodPost, "/api/v1/groups", `{"name":"  "}`, inter.PermissionReadWrite, env.api.GroupsHandler); status != http.StatusBadRequest || code != 40083 {
+		t.Fatalf("empty name expected 400/40083, got %d/%d", status, code)
+	}
+
+	groupPath := "/api/v1/groups/" + groupID
+	for _, uuid := range []string{uuidA, uuidB} {
+		if status, data, _ := call(http.MethodPost, groupPath+"/devices", `{"uuid":"`+uuid+`"}`, inter.PermissionReadWrite, env.api.GroupByIDHandler); status != http.StatusCreated || data["success"] != true {
+			t.Fatalf("add member expected 201, got %d: %+v", status, data)
+		}
+	}
+	if status, _, code := call(http.MethodPost, groupPath+"/devices", `{"uuid":"`+uuidA+`"}`, inter.PermissionReadWrite, env.api.GroupByIDHandler); status != http.StatusConflict || code != 40926 {
+		t.Fatalf("duplicate member expected 409/40926, got %d/%d", status, code)
+	}
+	if status, _, code := call(http.MethodPost, groupPath+"/devices", `{"uuid":"missing"}`, inter.PermissionReadWrite, env.api.GroupByIDHandler); status != http.StatusNotFound || code != 40482 {
+		t.Fatalf("unknown device expected 404/40482, got %d/%d", status, code)
+	}
+
+	status, data, _ := call(http.MethodGet, groupPath+"/devices", "", inter.PermissionReadOnly, env.api.GroupByIDHandler)
+	if status != http.StatusOK || len(data["items"].([]interface{})) != 2 {
+		t.Fatalf("list members expected two devices, got %d: %+v", status, data)
+	}
+	status, data, _ = call(http.MethodPatch, groupPath, `{"name":"front lobby"}`, inter.PermissionReadWrite, env.api.GroupByIDHandler)
+	if status != http.StatusOK || data["name"] != "front lobby" || data["description"] != "front desk" || data["device_count"] != float64(2) {
+		t.Fatalf("unexpected patched group %d: %+v", status, data)
+	}
+	status, data, _ = call(http.MethodGet, "/api/v1/groups", "", inter.PermissionReadOnly, env.api.GroupsHandler)
+	if status != http.StatusOK || data["total"] != float64(1) {
+		t.Fatalf("list groups expected one group, got %d: %+v", status, data)
+	}
+
+	status, batch, _ := call(http.MethodPost, groupPath+"/commands", `{"command":"action_exec","payload":{"op":"refresh"},"key":"refresh"}`, inter.PermissionReadWrite, env.api.GroupByIDHandler)
+	if status != http.StatusAccepted || batch["group_id"] != groupID || batch["total"] != float64(2) {
+		t.Fatalf("group command expected 202 with two targets, got %d: %+v", status, batch)
+	}
+	progress := batch["progress"].(map[string]interface{})
+	if progress["pending"] != float64(2) || progress["done"] != false {
+		t.Fatalf("unexpected batch progress: %+v", progress)
+	}
+	// 逐台入队在后台进行，轮询任务详情直到两台设备的结果都已写入。
+	batchPath := "/api/v1/command-batches/" + strconv.FormatInt(int64(batch["id"].(float64)), 10)
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		status, data, _ := call(http.MethodGet, batchPath, "", inter.PermissionReadOnly, env.api.CommandBatchByIDHandler)
+		if status != http.StatusOK || data["command"] != "action_exec" {
+			t.Fatalf("get batch expected 200, got %d: %+v", status, data)
+		}
+		if len(data["items"].([]interface{})) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("batch items were not recorded in time: %+v", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status, _, code := call(http.MethodPost, "/api/v1/command-batches", `{"command":"action_exec"}`, inter.PermissionReadWrite, env.api.CommandBatchesHandler); status != http.StatusBadRequest || code != 40085 {
+		t.Fatalf("batch without target expected 400/40085, got %d/%d", status, code)
+	}
+	if status, _, code := call(http.MethodPost, "/api/v1/command-batches", `{"group_id":"grp_missing","command":"action_exec"}`, inter.PermissionReadWrite, env.api.CommandBatchesHandler); status != http.StatusNotFound || code != 40481 {
+		t.Fatalf("unknown group expected 404/40481, got %d/%d", status, code)
+	}
+	status, data, _ = call(http.MethodGet, "/api/v1/command-batches", "", inter.PermissionReadOnly, env.api.CommandBatchesHandler)
+	if status != http.StatusOK || data["total"] != float64(1) {
+		t.Fatalf("list batches expected one batch, got %d: %+v", status, data)
+	}
+
+	if status, _, _ := call(http.MethodDelete, groupPath+"/devices/"+uuidB, "", inter.PermissionReadWrite, env.api.GroupByIDHandler); status != http.StatusNoContent {
+		t.Fatalf("remove member expected 204, got %d", status)
+	}
+	if status, _, _ := call(http.MethodDelete, groupPath, "", inter.PermissionReadWrite, env.api.GroupByIDHandler); status != http.StatusNoContent {
+		t.Fatalf("delete group expected 204, got %d", status)
+	}
+	if status, _, code := call(http.MethodGet, groupPath, "", inter.PermissionReadOnly, env.api.GroupByIDHandler); status != http.StatusNotFound || code != 40481 {
+		t.Fatalf("deleted group expected 404/40481, got %d/%d", status, code)
+	}
+}
@@ -287,6 +287,103 @@ func TestAPIDeviceAndMetricsAndUsersHandlers(t *testing.T) {
 	}
 }
 
+func TestAPIMetricsFiltersByNameAndTags(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("m", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+	now := time.Now().UnixMilli()
+	if err := env.dataStore.BatchAppendMetrics(uuid, []inter.MetricPoint{
+		{Timestamp: now - 2000, Name: "pm25", Unit: "µg/m³", Value: 12, Tags: map[string]string{"room": "kitchen"}},
+		{Timestamp: now - 1000, Name: "pm25", Unit: "µg/m³", Value: 30, Tags: map[string]string{"room": "office"}},
+		{Timestamp: now - 1000, Value: 21, Type: 1},
+	}); err != nil {
+		t.Fatalf("seed metrics failed: %v", err)
+	}
+
+	query := func(rawQuery string) (int, []interface{}, int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		env.api.MetricsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics/"+uuid+"?range=1h&"+rawQuery, nil))
+		envelope := mustJSONEnvelope(t, rec)
+		data, _ := envelope.Data.(map[string]interface{})
+		points, _ := data["points"].([]interface{})
+		return rec.Code, points, envelope.Code
+	}
+
+	if status, points, _ := query("name=pm25"); status != http.StatusOK || len(points) != 2 {
+		t.Fatalf("name filter expected two points, got %d: %+v", status, points)
+	}
+	status, points, _ := query("name=pm25&tag=room:office")
+	if status != http.StatusOK || len(points) != 1 {
+		t.Fatalf("tag filter expected one point, got %d: %+v", status, points)
+	}
+	if point := points[0].(map[string]interface{}); point["value"] != float64(30) || point["unit"] != "µg/m³" || point["value_type"] != "number" {
+		t.Fatalf("unexpected filtered point: %+v", point)
+	}
+	status, points, _ = query("name=temperature")
+	if status != http.StatusOK || len(points) != 1 || points[0].(map[string]interface{})["type"] != float64(1) {
+		t.Fatalf("legacy metric expected under its name, got %d: %+v", status, points)
+	}
+	for _, bad := range []string{"tag=room", "tag=ro%22om:x", "name=bad%20name"} {
+		if status, _, code := query(bad); status != http.StatusBadRequest || code != 40099 {
+			t.Fatalf("%s expected 400/40099, got %d/%d", bad, status, code)
+		}
+	}
+}
+
+func TestAPIMetricsAggregatesBuckets(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("g", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+	bucketStart := time.Now().Add(-10 * time.Minute).Truncate(time.Minute).UnixMilli()
+	if err := env.dataStore.BatchAppendMetrics(uuid, []inter.MetricPoint{
+		{Timestamp: bucketStart + 1000, Name: "pm25", Value: 10},
+		{Timestamp: bucketStart + 2000, Name: "pm25", Value: 30},
+		{Timestamp: bucketStart + 3*60000, Name: "pm25", Value: 50},
+	}); err != nil {
+		t.Fatalf("seed metrics failed: %v", err)
+	}
+
+	query := func(rawQuery string) (int, map[string]interface{}, int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		env.api.MetricsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics/"+uuid+"?"+rawQuery, nil))
+		envelope := mustJSONEnvelope(t, rec)
+		data, _ := envelope.Data.(map[string]interface{})
+		return rec.Code, data, envelope.Code
+	}
+
+	status, data, _ := query("range=90m&bucket=1m&agg=max")
+	if status != http.StatusOK || data["bucket_ms"] != float64(60000) || data["agg"] != "max" || data["range"] != "90m" {
+		t.Fatalf("aggregate query expected 200, got %d: %+v", status, data)
+	}
+	series := data["series"].([]interface{})
+	points := series[0].(map[string]interface{})["points"].([]interface{})
+	if len(series) != 1 || len(points) != 2 {
+		t.Fatalf("expected two non-empty buckets, got %+v", series)
+	}
+	if first := points[0].(map[string]interface{}); first["ts"] != float64(bucketStart) || first["value"] != float64(30) || first["count"] != float64(2) {
+		t.Fatalf("unexpected first bucket: %+v", first)
+	}
+
+	status, data, _ = query("range=30m&bucket=1m&agg=p50&fill=null")
+	points = data["series"].([]interface{})[0].(map[string]interface{})["points"].([]interface{})
+	if status != http.StatusOK || data["percentile"] != 0.5 || len(points) < 30 || points[len(points)-1].(map[string]interface{})["value"] != nil {
+		t.Fatalf("filled percentile query expected 200, got %d: %+v", status, data)
+	}
+
+	status, data, _ = query("range=7d&agg=count&max_points=100")
+	if status != http.StatusOK || data["bucket_ms"] != float64(3*time.Hour/time.Millisecond) {
+		t.Fatalf("auto bucket expected 3h, got %d: %+v", status, data)
+	}
+
+	for _, bad := range []string{"range=1h&bucket=1s", "agg=median", "agg=p101", "fill=linear", "bucket=5x", "max_points=0"} {
+		if status, _, code := query(bad); status != http.StatusBadRequest || code != 40014 {
+			t.Fatalf("%s expected 400/40014, got %d/%d", bad, status, code)
+		}
+	}
+}
+
 func TestAPICreateDeviceProvisionsMQTTCredentials(t *testing.T) {
 	env := newTestAPI(t)
 
@@ -400,6 +497,18 @@ func TestAPIDeviceCommandValidation(t *testing.T) {
 	if code := mustJSONEnvelope(t, rec).Code; code != 40027 {
 		t.Fatalf("invalid command should return code 40027, got %d", code)
 	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/devices/"+uuid+"/commands",
+		bytes.NewBufferString(`{"command":"action_exec","ttl_seconds":-1}`))
+	req = withPerm(req, inter.PermissionReadWrite)
+	rec = httptest.NewRecorder()
+	env.api.DeviceByUUIDHandler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("negative ttl should return 400, got %d", rec.Code)
+	}
+	if code := mustJSONEnvelope(t, rec).Code; code != 40038 {
+		t.Fatalf("negative ttl should return code 40038, got %d", code)
+	}
 }
 
 func TestAPIAuthRegisterLoginLogoutFlow(t *testing.T) {
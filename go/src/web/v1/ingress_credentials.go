@@ -0,0 +1,185 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// ingressCredentialPayload 是签发与轮换接口的响应，token 只在这两个接口中返回一次。
+type ingressCredentialPayload struct {
+	inter.IngressCredential
+	Token string `json:"token"`
+}
+
+// IngressCredentialsHandler 处理 `/ingress/credentials`：列出或签发 protocol-ingress 的 adapter 凭据。
+// 默认租户的管理员管理全部凭据；其他租户的管理员只能管理绑定到本租户的凭据。
+func (api *API) IngressCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	if api.ingressCredentials == nil {
+		api.Error(w, r, http.StatusNotFound, 40491, "ingress credentials are not enabled",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		items, err := api.ingressCredentials.List()
+		if err != nil {
+			api.InternalError(w, r, 50091, err)
+			return
+		}
+		visible := make([]inter.IngressCredential, 0, len(items))
+		for _, item := range items {
+			if api.canManageIngressCredential(r, item) {
+				visible = append(visible, item)
+			}
+		}
+		api.OK(w, r, map[string]interface{}{
+			"items": visible,
+			"total": len(visible),
+		})
+	case http.MethodPost:
+		api.createIngressCredential(w, r)
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+// IngressCredentialByIDHandler 处理 `/ingress/credentials/{id}` 与 `/ingress/credentials/{id}/rotate`。
+func (api *API) IngressCredentialByIDHandler(w http.ResponseWriter, r *http.Request) {
+	if api.ingressCredentials == nil {
+		api.Error(w, r, http.StatusNotFound, 40491, "ingress credentials are not enabled",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	suffix := strings.TrimPrefix(r.URL.Path, "/api/v1/ingress/credentials/")
+	parts := strings.Split(strings.Trim(suffix, "/"), "/")
+	id, err := url.PathUnescape(parts[0])
+	if err != nil || strings.TrimSpace(id) == "" || len(parts) > 2 {
+		api.Error(w, r, http.StatusNotFound, 40492, "ingress credential not found",
+			&ErrorDetail{Type: "not_found", Field: "credential_id"})
+		return
+	}
+
+	cred, err := api.ingressCredentials.Get(strings.TrimSpace(id))
+	if err != nil {
+		if errors.Is(err, inter.ErrIngressCredentialNotFound) {
+			api.Error(w, r, http.StatusNotFound, 40492, "ingress credential not found",
+				&ErrorDetail{Type: "not_found", Field: "credential_id"})
+			return
+		}
+		api.InternalError(w, r, 50092, err)
+		return
+	}
+	// 越权访问与不存在返回相同结果，避免泄露其他租户的凭据 ID。
+	if !api.canManageIngressCredential(r, cred) {
+		api.Error(w, r, http.StatusNotFound, 40492, "ingress credential not found",
+			&ErrorDetail{Type: "not_found", Field: "credential_id"})
+		return
+	}
+
+	if len(parts) == 2 {
+		if parts[1] != "rotate" {
+			api.Error(w, r, http.StatusNotFound, 40493, "invalid action",
+				&ErrorDetail{Type: "not_found", Field: "action"})
+			return
+		}
+		if r.Method != http.MethodPost {
+			api.MethodNotAllowed(w, r)
+			return
+		}
+		rotated, token, err := api.ingressCredentials.Rotate(cred.ID)
+		if err != nil {
+			if errors.Is(err, inter.ErrIngressCredentialRevoked) {
+				api.Error(w, r, http.StatusConflict, 40991, "ingress credential revoked",
+					&ErrorDetail{Type: "conflict", Field: "credential_id"})
+				return
+			}
+			api.InternalError(w, r, 50093, err)
+			return
+		}
+		api.OK(w, r, ingressCredentialPayload{IngressCredential: rotated, Token: token})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		api.OK(w, r, cred)
+	case http.MethodDelete:
+		if err := api.ingressCredentials.Revoke(cred.ID); err != nil && !errors.Is(err, inter.ErrIngressCredentialRevoked) {
+			api.InternalError(w, r, 50094, err)
+			return
+		}
+		api.NoContent(w, r)
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+func (api *API) createIngressCredential(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name       string   `json:"name"`
+		InstanceID string   `json:"instance_id"`
+		Adapters   []string `json:"adapters"`
+		TenantIDs  []string `json:"tenant_ids"`
+	}
+	if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40091, "invalid json body",
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	if strings.TrimSpace(payload.InstanceID) == "" {
+		api.Error(w, r, http.StatusBadRequest, 40092, "instance_id is required",
+			&ErrorDetail{Type: "validation_error", Field: "instance_id"})
+		return
+	}
+
+	tenantID := api.tenantID(r)
+	if tenantID != inter.DefaultTenantID {
+		// 非默认租户只能签发绑定到本租户的凭据。
+		for _, item := range payload.TenantIDs {
+			if item = strings.TrimSpace(item); item != "" && item != tenantID {
+				api.Error(w, r, http.StatusForbidden, 40391, "forbidden",
+					&ErrorDetail{Type: "cross_tenant_denied", Field: "tenant_ids"})
+				return
+			}
+		}
+		payload.TenantIDs = []string{tenantID}
+	}
+
+	username, _ := r.Context().Value(ContextUsername).(string)
+	cred, token, err := api.ingressCredentials.Create(inter.IngressCredentialInput{
+		Name:       payload.Name,
+		InstanceID: payload.InstanceID,
+		Adapters:   payload.Adapters,
+		TenantIDs:  payload.TenantIDs,
+		CreatedBy:  username,
+	})
+	if err != nil {
+		if errors.Is(err, inter.ErrIngressCredentialInvalid) {
+			api.Error(w, r, http.StatusBadRequest, 40093, err.Error(),
+				&ErrorDetail{Type: "validation_error"})
+			return
+		}
+		api.InternalError(w, r, 50095, err)
+		return
+	}
+
+	api.write(w, http.StatusCreated, Envelope{
+		Code:      0,
+		Message:   "ok",
+		RequestID: api.requestID(r),
+		Data:      ingressCredentialPayload{IngressCredential: cred, Token: token},
+	})
+}
+
+// canManageIngressCredential 判断当前租户管理员能否查看和操作该凭据。
+func (api *API) canManageIngressCredential(r *http.Request, cred inter.IngressCredential) bool {
+	tenantID := api.tenantID(r)
+	if tenantID == inter.DefaultTenantID {
+		return true
+	}
+	return len(cred.TenantIDs) == 1 && cred.TenantIDs[0] == tenantID
+}
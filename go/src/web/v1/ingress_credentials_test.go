@@ -0,0 +1,78 @@
+package v1_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIIngressCredentialLifecycle(t *testing.T) {
+	env := newTestAPI(t)
+
+	createReq := withTenantPerm(httptest.NewRequest(http.MethodPost, "/api/v1/ingress/credentials",
+		bytes.NewBufferString(`{"name":"edge","instance_id":"ingress-1","adapters":["mqtt"," mqtt","custom_tcp"],"tenant_ids":["tenant_a"]}`)), inter.DefaultTenantID, inter.TenantRoleAdmin)
+	createRec := httptest.NewRecorder()
+	env.api.IngressCredentialsHandler(createRec, createReq)
+	if createRec.Code != http.StatusCreated {
+		t.Fatalf("create expected 201, got %d: %s", createRec.Code, createRec.Body.String())
+	}
+	created := mustJSONEnvelope(t, createRec).Data.(map[string]interface{})
+	id, _ := created["id"].(string)
+	token, _ := created["token"].(string)
+	if id == "" || token == "" || len(created["adapters"].([]interface{})) != 2 {
+		t.Fatalf("unexpected created credential: %+v", created)
+	}
+	if _, err := env.ingressCreds.Authenticate(token); err != nil {
+		t.Fatalf("issued token should authenticate: %v", err)
+	}
+
+	// 其他租户的管理员看不到、也不能操作绑定到别的租户的凭据。
+	otherList := withTenantPerm(httptest.NewRequest(http.MethodGet, "/api/v1/ingress/credentials", nil), "tenant_b", inter.TenantRoleAdmin)
+	otherRec := httptest.NewRecorder()
+	env.api.IngressCredentialsHandler(otherRec, otherList)
+	if total := mustJSONEnvelope(t, otherRec).Data.(map[string]interface{})["total"].(float64); total != 0 {
+		t.Fatalf("tenant_b should not see tenant_a credentials, got %v", total)
+	}
+	otherGet := withTenantPerm(httptest.NewRequest(http.MethodGet, "/api/v1/ingress/credentials/"+id, nil), "tenant_b", inter.TenantRoleAdmin)
+	otherGetRec := httptest.NewRecorder()
+	env.api.IngressCredentialByIDHandler(otherGetRec, otherGet)
+	if code := mustJSONEnvelope(t, otherGetRec).Code; otherGetRec.Code != http.StatusNotFound || code != 40492 {
+		t.Fatalf("cross-tenant get expected 404/40492, got %d/%d", otherGetRec.Code, code)
+	}
+	crossCreate := withTenantPerm(httptest.NewRequest(http.MethodPost, "/api/v1/ingress/credentials",
+		bytes.NewBufferString(`{"instance_id":"ingress-2","tenant_ids":["tenant_a"]}`)), "tenant_b", inter.TenantRoleAdmin)
+	crossRec := httptest.NewRecorder()
+	env.api.IngressCredentialsHandler(crossRec, crossCreate)
+	if code := mustJSONEnvelope(t, crossRec).Code; crossRec.Code != http.StatusForbidden || code != 40391 {
+		t.Fatalf("cross-tenant create expected 403/40391, got %d/%d", crossRec.Code, code)
+	}
+
+	rotateReq := withTenantPerm(httptest.NewRequest(http.MethodPost, "/api/v1/ingress/credentials/"+id+"/rotate", nil), inter.DefaultTenantID, inter.TenantRoleAdmin)
+	rotateRec := httptest.NewRecorder()
+	env.api.IngressCredentialByIDHandler(rotateRec, rotateReq)
+	if rotateRec.Code != http.StatusOK {
+		t.Fatalf("rotate expected 200, got %d: %s", rotateRec.Code, rotateRec.Body.String())
+	}
+	rotated := mustJSONEnvelope(t, rotateRec).Data.(map[string]interface{})
+	if rotated["token"] == token || rotated["rotated_at"] == nil {
+		t.Fatalf("rotate should issue a new token: %+v", rotated)
+	}
+	if _, err := env.ingressCreds.Authenticate(token); err == nil {
+		t.Fatal("old token should stop working after rotate")
+	}
+
+	revokeReq := withTenantPerm(httptest.NewRequest(http.MethodDelete, "/api/v1/ingress/credentials/"+id, nil), inter.DefaultTenantID, inter.TenantRoleAdmin)
+	revokeRec := httptest.NewRecorder()
+	env.api.IngressCredentialByIDHandler(revokeRec, revokeReq)
+	if revokeRec.Code != http.StatusNoContent {
+		t.Fatalf("revoke expected 204, got %d: %s", revokeRec.Code, revokeRec.Body.String())
+	}
+	rotateAgain := httptest.NewRecorder()
+	env.api.IngressCredentialByIDHandler(rotateAgain, withTenantPerm(httptest.NewRequest(http.MethodPost, "/api/v1/ingress/credentials/"+id+"/rotate", nil), inter.DefaultTenantID, inter.TenantRoleAdmin))
+	if code := mustJSONEnvelope(t, rotateAgain).Code; rotateAgain.Code != http.StatusConflict || code != 40991 {
+		t.Fatalf("rotating a revoked credential expected 409/40991, got %d/%d", rotateAgain.Code, code)
+	}
+}
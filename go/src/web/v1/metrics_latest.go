@@ -0,0 +1,165 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// LatestMetricsHandler 处理 `/api/v1/metrics/latest`，一次返回多台设备各指标的最新值。
+// 设备范围三选一：uuid 列表、group 分组（分页），或省略时当前租户全部设备（分页）；name、entity_id、tag 过滤序列。
+func (api *API) LatestMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	values := r.URL.Query()
+	filter, err := ParseMetricFilters(values)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40099, err.Error(),
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	uuids := splitQueryList(values["uuid"])
+	groupID := strings.TrimSpace(values.Get("group"))
+	if len(uuids) > 0 && groupID != "" {
+		api.Error(w, r, http.StatusBadRequest, 40016, "invalid device selector",
+			&ErrorDetail{Type: "validation_error", Field: "uuid", Reason: "uuid and group are mutually exclusive"})
+		return
+	}
+	maxDevices := api.deviceListMaxPageSize()
+	if len(uuids) > maxDevices {
+		api.Error(w, r, http.StatusBadRequest, 40016, "invalid device selector",
+			&ErrorDetail{Type: "validation_error", Field: "uuid", Reason: fmt.Sprintf("at most %d devices are allowed", maxDevices)})
+		return
+	}
+
+	scope := api.scopeFromRequest(r)
+	var pageInfo map[string]interface{}
+	if len(uuids) > 0 {
+		for _, uuid := range uuids {
+			if !api.ensureDeviceInScope(w, r, uuid, 40431) {
+				return
+			}
+		}
+	} else {
+		page, err := ParsePositiveIntQuery(values.Get("page"), 1, 0)
+		if err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40012, "invalid page",
+				&ErrorDetail{Type: "validation_error", Field: "page", Reason: err.Error()})
+			return
+		}
+		size, err := ParsePositiveIntQuery(values.Get("size"), api.deviceListDefaultPageSize(), maxDevices)
+		if err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40013, "invalid size",
+				&ErrorDetail{Type: "validation_error", Field: "size", Reason: err.Error()})
+			return
+		}
+		var devices []inter.DeviceRecord
+		if groupID != "" {
+			if api.deviceGroups == nil {
+				api.Error(w, r, http.StatusNotFound, 40481, "device group not found",
+					&ErrorDetail{Type: "not_found", Field: "group"})
+				return
+			}
+			devices, err = api.deviceGroups.ListDevices(scope, groupID, page, size)
+			if err != nil {
+				api.groupError(w, r, err, 50096)
+				return
+			}
+		} else {
+			devices, err = api.registry.ListDevicesByScope(scope, nil, page, size)
+			if err != nil {
+				api.InternalError(w, r, 50096, err)
+				return
+			}
+		}
+		for _, device := range devices {
+			uuids = append(uuids, device.UUID)
+		}
+		pageInfo = map[string]interface{}{
+			"page":     page,
+			"size":     size,
+			"returned": len(uuids),
+		}
+	}
+
+	latest, err := api.lookupLatestMetrics(api.tenantID(r), uuids)
+	if err != nil {
+		api.InternalError(w, r, 50097, err)
+		return
+	}
+	items := make([]map[string]interface{}, 0, len(uuids))
+	for _, uuid := range uuids {
+		items = append(items, map[string]interface{}{
+			"uuid":    uuid,
+			"metrics": filterLatestMetrics(latest[uuid], filter),
+		})
+	}
+	data := map[string]interface{}{
+		"items": items,
+		"total": len(items),
+	}
+	if pageInfo != nil {
+		data["page"] = pageInfo
+	}
+	api.OK(w, r, data)
+}
+
+// lookupLatestMetrics 优先读取最新值缓存，未注入缓存时直接查询存储。
+func (api *API) lookupLatestMetrics(tenantID string, uuids []string) (map[string][]inter.MetricPoint, error) {
+	if len(uuids) == 0 {
+		return map[string][]inter.MetricPoint{}, nil
+	}
+	if api.latestMetrics != nil {
+		return api.latestMetrics.Latest(tenantID, uuids)
+	}
+	return api.dataStore.LatestMetrics(tenantID, uuids)
+}
+
+// filterLatestMetrics 按 name、entity_id、tag 过滤缓存中的序列，语义与历史查询的过滤一致。
+func filterLatestMetrics(points []inter.MetricPoint, filter inter.MetricQuery) []inter.MetricPoint {
+	names := make(map[string]bool, len(filter.Names))
+	for _, name := range filter.Names {
+		names[name] = true
+	}
+	out := make([]inter.MetricPoint, 0, len(points))
+	for _, point := range points {
+		if len(names) > 0 && !names[point.Name] {
+			continue
+		}
+		if filter.EntityID != "" && point.EntityID != filter.EntityID {
+			continue
+		}
+		matched := true
+		for key, value := range filter.Tags {
+			if point.Tags[key] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			out = append(out, point)
+		}
+	}
+	return out
+}
+
+// splitQueryList 合并重复参数与逗号分隔的值，去掉空项与重复项并保持顺序。
+func splitQueryList(raw []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, item := range raw {
+		for _, value := range strings.Split(item, ",") {
+			value = strings.TrimSpace(value)
+			if value == "" || seen[value] {
+				continue
+			}
+			seen[value] = true
+			out = append(out, value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPILatestMetrics(t *testing.T) {
+	env := newTestAPI(t)
+	uuidA := strings.Repeat("l", 64)
+	uuidB := strings.Repeat("m", 64)
+	seedDevice(t, env.dataStore, uuidA, inter.Authenticated)
+	seedDevice(t, env.dataStore, uuidB, inter.Authenticated)
+	if err := env.dataStore.BatchAppendMetrics(uuidA, []inter.MetricPoint{
+		{Timestamp: 1000, Name: "temp", Value: 20},
+		{Timestamp: 2000, Name: "temp", Value: 21},
+		{Timestamp: 1500, Name: "humidity", Value: 40},
+	}); err != nil {
+		t.Fatalf("BatchAppendMetrics failed: %v", err)
+	}
+	if err := env.dataStore.AppendMetric(uuidB, inter.MetricPoint{Timestamp: 3000, Name: "temp", Value: 25}); err != nil {
+		t.Fatalf("AppendMetric failed: %v", err)
+	}
+	group, err := env.dataStore.CreateDeviceGroup(inter.DeviceGroup{Name: "wall"})
+	if err != nil {
+		t.Fatalf("CreateDeviceGroup failed: %v", err)
+	}
+	if err := env.dataStore.AddGroupDevice(group.ID, uuidB); err != nil {
+		t.Fatalf("AddGroupDevice failed: %v", err)
+	}
+
+	call := func(path string) (int, map[string]interface{}, int) {
+		t.Helper()
+		req := withPerm(httptest.NewRequest(http.MethodGet, path, nil), inter.PermissionReadOnly)
+		rec := httptest.NewRecorder()
+		env.api.LatestMetricsHandler(rec, req)
+		envelope := mustJSONEnvelope(t, rec)
+		data, _ := envelope.Data.(map[string]interface{})
+		return rec.Code, data, envelope.Code
+	}
+	itemsOf := func(data map[string]interface{}) map[string][]interface{} {
+		t.Helper()
+		out := map[string][]interface{}{}
+		for _, raw := range data["items"].([]interface{}) {
+			item := raw.(map[string]interface{})
+			out[item["uuid"].(string)] = item["metrics"].([]interface{})
+		}
+		return out
+	}
+
+	status, data, _ := call("/api/v1/metrics/latest?uuid=" + uuidA + "," + uuidB + "&name=temp")
+	if status != http.StatusOK || data["total"] != float64(2) || data["page"] != nil {
+		t.Fatalf("uuid list expected 200 without paging, got %d: %+v", status, data)
+	}
+	items := itemsOf(data)
+	if len(items[uuidA]) != 1 || items[uuidA][0].(map[string]interface{})["value"] != float64(21) {
+		t.Fatalf("expected newest temp for device A, got %+v", items[uuidA])
+	}
+	if len(items[uuidB]) != 1 || items[uuidB][0].(map[string]interface{})["value"] != float64(25) {
+		t.Fatalf("expected newest temp for device B, got %+v", items[uuidB])
+	}
+
+	status, data, _ = call("/api/v1/metrics/latest?group=" + group.ID)
+	if items := itemsOf(data); status != http.StatusOK || len(items) != 1 || len(items[uuidB]) != 1 {
+		t.Fatalf("group selector expected only device B, got %d: %+v", status, data)
+	}
+
+	status, data, _ = call("/api/v1/metrics/latest?size=1&page=2")
+	if page, _ := data["page"].(map[string]interface{}); status != http.StatusOK || data["total"] != float64(1) || page["returned"] != float64(1) {
+		t.Fatalf("tenant-wide paging expected one device, got %d: %+v", status, data)
+	}
+
+	if status, _, code := call("/api/v1/metrics/latest?uuid=" + uuidA + "&group=" + group.ID); status != http.StatusBadRequest || code != 40016 {
+		t.Fatalf("uuid with group expected 400/40016, got %d/%d", status, code)
+	}
+	if status, _, code := call("/api/v1/metrics/latest?uuid=" + uuidA + ",missing"); status != http.StatusNotFound || code != 40431 {
+		t.Fatalf("unknown device expected 404/40431, got %d/%d", status, code)
+	}
+	if status, _, code := call("/api/v1/metrics/latest?size=0"); status != http.StatusBadRequest || code != 40013 {
+		t.Fatalf("invalid size expected 400/40013, got %d/%d", status, code)
+	}
+}
@@ -0,0 +1,312 @@
+package v1
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// maxOtaListLimit 是固件与升级活动列表单次返回的上限。
+const maxOtaListLimit = 200
+
+// otaCampaignRequest 是创建升级活动的请求体；group_id 与 labels 至少给出一个，同时给出时取交集。
+type otaCampaignRequest struct {
+	Name           string            `json:"name,omitempty"`
+	ArtifactID     string            `json:"artifact_id"`
+	GroupID        string            `json:"group_id,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	RolloutPercent int               `json:"rollout_percent,omitempty"`
+	ChunkSize      int               `json:"chunk_size,omitempty"`
+}
+
+// otaRolloutRequest 是调整放量比例的请求体。
+type otaRolloutRequest struct {
+	RolloutPercent int `json:"rollout_percent"`
+}
+
+// FirmwareHandler 处理 `/api/v1/firmware`：GET 列出固件，POST 以原始字节上传固件。
+// 上传的元数据通过查询参数给出：version 必填，hardware_versions 以逗号分隔，sha256 可选。
+func (api *API) FirmwareHandler(w http.ResponseWriter, r *http.Request) {
+	if api.ota == nil {
+		api.Error(w, r, http.StatusNotFound, 40484, "firmware not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		limit, err := ParsePositiveIntQuery(r.URL.Query().Get("limit"), 50, maxOtaListLimit)
+		if err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40089, "invalid limit",
+				&ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()})
+			return
+		}
+		items, err := api.ota.ListFirmware(api.scopeFromRequest(r), limit)
+		if err != nil {
+			api.InternalError(w, r, 50087, err)
+			return
+		}
+		api.OK(w, r, map[string]interface{}{
+			"items": items,
+			"total": len(items),
+		})
+	case http.MethodPost:
+		api.uploadFirmware(w, r)
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+// FirmwareByIDHandler 处理 `/api/v1/firmware/{id}`：GET 返回固件元数据，DELETE 删除未被升级活动引用的固件。
+func (api *API) FirmwareByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/firmware/"), "/")
+	if id == "" || strings.Contains(id, "/") || api.ota == nil {
+		api.Error(w, r, http.StatusNotFound, 40484, "firmware not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		artifact, err := api.ota.GetFirmware(api.scopeFromRequest(r), id)
+		if err != nil {
+			api.otaError(w, r, err, 50087)
+			return
+		}
+		api.OK(w, r, artifact)
+	case http.MethodDelete:
+		if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+			return
+		}
+		if err := api.ota.DeleteFirmware(api.scopeFromRequest(r), id); err != nil {
+			api.otaError(w, r, err, 50087)
+			return
+		}
+		api.NoContent(w, r)
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+func (api *API) uploadFirmware(w http.ResponseWriter, r *http.Request) {
+	if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+		return
+	}
+	maxBytes := api.config.MaxFirmwareBytes
+	content, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40094, "invalid firmware",
+			&ErrorDetail{Type: "validation_error", Reason: err.Error()})
+		return
+	}
+	if int64(len(content)) > maxBytes {
+		api.Error(w, r, http.StatusRequestEntityTooLarge, 41301, "firmware too large",
+			&ErrorDetail{Type: "validation_error", Reason: "image exceeds " + strconv.FormatInt(maxBytes, 10) + " bytes"})
+		return
+	}
+	query := r.URL.Query()
+	var hardware []string
+	if raw := strings.TrimSpace(query.Get("hardware_versions")); raw != "" {
+		hardware = strings.Split(raw, ",")
+	}
+	createdBy, _ := r.Context().Value(ContextUsername).(string)
+	artifact, err := api.ota.UploadFirmware(api.scopeFromRequest(r), inter.FirmwareArtifact{
+		Name:             query.Get("name"),
+		Version:          query.Get("version"),
+		HardwareVersions: hardware,
+		SHA256:           query.Get("sha256"),
+		Content:          content,
+		CreatedBy:        createdBy,
+	})
+	if err != nil {
+		api.otaError(w, r, err, 50087)
+		return
+	}
+	api.write(w, http.StatusCreated, Envelope{
+		Code:      0,
+		Message:   "ok",
+		RequestID: api.requestID(r),
+		Data:      artifact,
+	})
+}
+
+// OtaCampaignsHandler 处理 `/api/v1/ota/campaigns`：GET 列出最近的升级活动，POST 创建活动。
+func (api *API) OtaCampaignsHandler(w http.ResponseWriter, r *http.Request) {
+	if api.ota == nil {
+		api.Error(w, r, http.StatusNotFound, 40485, "ota campaign not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		limit, err := ParsePositiveIntQuery(r.URL.Query().Get("limit"), 50, maxOtaListLimit)
+		if err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40089, "invalid limit",
+				&ErrorDetail{Type: "validation_error", Field: "limit", Reason: err.Error()})
+			return
+		}
+		items, err := api.ota.ListCampaigns(api.scopeFromRequest(r), limit)
+		if err != nil {
+			api.InternalError(w, r, 50088, err)
+			return
+		}
+		api.OK(w, r, map[string]interface{}{
+			"items": items,
+			"total": len(items),
+		})
+	case http.MethodPost:
+		if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+			return
+		}
+		var payload otaCampaignRequest
+		if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40082, "invalid json body",
+				&ErrorDetail{Type: "validation_error"})
+			return
+		}
+		createdBy, _ := r.Context().Value(ContextUsername).(string)
+		campaign, err := api.ota.CreateCampaign(api.scopeFromRequest(r), inter.OtaCampaign{
+			Name:           payload.Name,
+			ArtifactID:     strings.TrimSpace(payload.ArtifactID),
+			GroupID:        payload.GroupID,
+			Labels:         payload.Labels,
+			RolloutPercent: payload.RolloutPercent,
+			ChunkSize:      payload.ChunkSize,
+			CreatedBy:      createdBy,
+		})
+		if err != nil {
+			api.otaError(w, r, err, 50088)
+			return
+		}
+		api.write(w, http.StatusCreated, Envelope{
+			Code:      0,
+			Message:   "ok",
+			RequestID: api.requestID(r),
+			Data:      campaign,
+		})
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+// OtaCampaignByIDHandler 处理 `/api/v1/ota/campaigns/{id}` 及其 devices、pause、resume、abort 子路径。
+func (api *API) OtaCampaignByIDHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/ota/campaigns/"), "/"), "/")
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || id <= 0 || len(parts) > 2 {
+		api.Error(w, r, http.StatusBadRequest, 40096, "invalid ota campaign id",
+			&ErrorDetail{Type: "validation_error", Field: "id"})
+		return
+	}
+	if api.ota == nil {
+		api.Error(w, r, http.StatusNotFound, 40485, "ota campaign not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+		return
+	}
+	scope := api.scopeFromRequest(r)
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			campaign, err := api.ota.GetCampaign(scope, id)
+			if err != nil {
+				api.otaError(w, r, err, 50088)
+				return
+			}
+			api.OK(w, r, campaign)
+		case http.MethodPatch:
+			if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+				return
+			}
+			var payload otaRolloutRequest
+			if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+				api.Error(w, r, http.StatusBadRequest, 40082, "invalid json body",
+					&ErrorDetail{Type: "validation_error"})
+				return
+			}
+			campaign, err := api.ota.SetRollout(scope, id, payload.RolloutPercent)
+			if err != nil {
+				api.otaError(w, r, err, 50088)
+				return
+			}
+			api.OK(w, r, campaign)
+		default:
+			api.MethodNotAllowed(w, r)
+		}
+		return
+	}
+
+	if parts[1] == "devices" {
+		if r.Method != http.MethodGet {
+			api.MethodNotAllowed(w, r)
+			return
+		}
+		devices, err := api.ota.ListCampaignDevices(scope, id)
+		if err != nil {
+			api.otaError(w, r, err, 50088)
+			return
+		}
+		api.OK(w, r, map[string]interface{}{
+			"items": devices,
+			"total": len(devices),
+		})
+		return
+	}
+
+	var action func(inter.Scope, int64) (inter.OtaCampaign, error)
+	switch parts[1] {
+	case "pause":
+		action = api.ota.Pause
+	case "resume":
+		action = api.ota.Resume
+	case "abort":
+		action = api.ota.Abort
+	default:
+		api.Error(w, r, http.StatusNotFound, 40485, "ota campaign not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+		return
+	}
+	campaign, err := action(scope, id)
+	if err != nil {
+		api.otaError(w, r, err, 50088)
+		return
+	}
+	api.OK(w, r, campaign)
+}
+
+func (api *API) otaError(w http.ResponseWriter, r *http.Request, err error, internalCode int) {
+	switch {
+	case errors.Is(err, inter.ErrFirmwareArtifactInvalid):
+		api.Error(w, r, http.StatusBadRequest, 40094, "invalid firmware",
+			&ErrorDetail{Type: "validation_error", Reason: err.Error()})
+	case errors.Is(err, inter.ErrOtaCampaignInvalid):
+		api.Error(w, r, http.StatusBadRequest, 40095, "invalid ota campaign",
+			&ErrorDetail{Type: "validation_error", Reason: err.Error()})
+	case errors.Is(err, inter.ErrFirmwareArtifactNotFound):
+		api.Error(w, r, http.StatusNotFound, 40484, "firmware not found",
+			&ErrorDetail{Type: "not_found", Field: "artifact_id"})
+	case errors.Is(err, inter.ErrOtaCampaignNotFound):
+		api.Error(w, r, http.StatusNotFound, 40485, "ota campaign not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+	case errors.Is(err, inter.ErrDeviceGroupNotFound):
+		api.Error(w, r, http.StatusNotFound, 40481, "device group not found",
+			&ErrorDetail{Type: "not_found", Field: "group_id"})
+	case errors.Is(err, inter.ErrFirmwareArtifactInUse):
+		api.Error(w, r, http.StatusConflict, 40927, "firmware is referenced by an ota campaign",
+			&ErrorDetail{Type: "conflict", Field: "id"})
+	case errors.Is(err, inter.ErrOtaCampaignState):
+		api.Error(w, r, http.StatusConflict, 40928, "invalid ota campaign state",
+			&ErrorDetail{Type: "conflict", Reason: err.Error()})
+	default:
+		api.InternalError(w, r, internalCode, err)
+	}
+}
@@ -0,0 +1,114 @@
+package v1_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	appcfg "github.com/nhirsama/Goster-IoT/src/config"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIFirmwareUploadAndOtaCampaignLifecycle(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("o", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+
+	call := func(method, path string, body []byte, perm inter.PermissionType, handler http.HandlerFunc) (int, map[string]interface{}, int) {
+		t.Helper()
+		req := withPerm(httptest.NewRequest(method, path, bytes.NewReader(body)), perm)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code == http.StatusNoContent {
+			return rec.Code, nil, 0
+		}
+		envelope := mustJSONEnvelope(t, rec)
+		data, _ := envelope.Data.(map[string]interface{})
+		return rec.Code, data, envelope.Code
+	}
+
+	image := []byte("\x7fELF firmware image")
+	if status, _, _ := call(http.MethodPost, "/api/v1/firmware?version=v2", image, inter.PermissionReadOnly, env.api.FirmwareHandler); status != http.StatusForbidden {
+		t.Fatalf("read-only upload expected 403, got %d", status)
+	}
+	if status, _, code := call(http.MethodPost, "/api/v1/firmware?version=v2&sha256=deadbeef", image, inter.PermissionReadWrite, env.api.FirmwareHandler); status != http.StatusBadRequest || code != 40094 {
+		t.Fatalf("sha256 mismatch expected 400/40094, got %d/%d", status, code)
+	}
+	status, artifact, _ := call(http.MethodPost, "/api/v1/firmware?version=v2&name=sensor&hardware_versions=v1,v1b", image, inter.PermissionReadWrite, env.api.FirmwareHandler)
+	if status != http.StatusCreated || artifact["version"] != "v2" || artifact["size"] != float64(len(image)) || len(artifact["hardware_versions"].([]interface{})) != 2 {
+		t.Fatalf("upload expected 201, got %d: %+v", status, artifact)
+	}
+	if _, ok := artifact["content"]; ok {
+		t.Fatalf("firmware content must not be exposed: %+v", artifact)
+	}
+	artifactID := artifact["id"].(string)
+	if status, data, _ := call(http.MethodGet, "/api/v1/firmware/"+artifactID, nil, inter.PermissionReadOnly, env.api.FirmwareByIDHandler); status != http.StatusOK || data["sha256"] != artifact["sha256"] {
+		t.Fatalf("get firmware expected 200, got %d: %+v", status, data)
+	}
+
+	_, group, _ := call(http.MethodPost, "/api/v1/groups", []byte(`{"name":"ota"}`), inter.PermissionReadWrite, env.api.GroupsHandler)
+	groupID := group["id"].(string)
+	call(http.MethodPost, "/api/v1/groups/"+groupID+"/devices", []byte(`{"uuid":"`+uuid+`"}`), inter.PermissionReadWrite, env.api.GroupByIDHandler)
+
+	if status, _, code := call(http.MethodPost, "/api/v1/ota/campaigns", []byte(`{"artifact_id":"`+artifactID+`"}`), inter.PermissionReadWrite, env.api.OtaCampaignsHandler); status != http.StatusBadRequest || code != 40095 {
+		t.Fatalf("campaign without target expected 400/40095, got %d/%d", status, code)
+	}
+	if status, _, code := call(http.MethodPost, "/api/v1/ota/campaigns", []byte(`{"artifact_id":"fw_missing","group_id":"`+groupID+`"}`), inter.PermissionReadWrite, env.api.OtaCampaignsHandler); status != http.StatusNotFound || code != 40484 {
+		t.Fatalf("unknown firmware expected 404/40484, got %d/%d", status, code)
+	}
+	status, campaign, _ := call(http.MethodPost, "/api/v1/ota/campaigns", []byte(`{"name":"v2 rollout","artifact_id":"`+artifactID+`","group_id":"`+groupID+`","rollout_percent":50,"chunk_size":8}`), inter.PermissionReadWrite, env.api.OtaCampaignsHandler)
+	if status != http.StatusCreated || campaign["status"] != "running" || campaign["rollout_percent"] != float64(50) {
+		t.Fatalf("create campaign expected 201, got %d: %+v", status, campaign)
+	}
+	if progress := campaign["progress"].(map[string]interface{}); progress["total"] != float64(1) {
+		t.Fatalf("unexpected campaign progress: %+v", progress)
+	}
+	campaignPath := "/api/v1/ota/campaigns/" + strconv.FormatInt(int64(campaign["id"].(float64)), 10)
+
+	if status, _, code := call(http.MethodPatch, campaignPath, []byte(`{"rollout_percent":20}`), inter.PermissionReadWrite, env.api.OtaCampaignByIDHandler); status != http.StatusBadRequest || code != 40095 {
+		t.Fatalf("rollout decrease expected 400/40095, got %d/%d", status, code)
+	}
+	if status, data, _ := call(http.MethodPatch, campaignPath, []byte(`{"rollout_percent":100}`), inter.PermissionReadWrite, env.api.OtaCampaignByIDHandler); status != http.StatusOK || data["rollout_percent"] != float64(100) {
+		t.Fatalf("rollout increase expected 200, got %d: %+v", status, data)
+	}
+	if _, err := env.ota.RunOnce(); err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	status, data, _ := call(http.MethodGet, campaignPath+"/devices", nil, inter.PermissionReadOnly, env.api.OtaCampaignByIDHandler)
+	devices, _ := data["items"].([]interface{})
+	if status != http.StatusOK || len(devices) != 1 || devices[0].(map[string]interface{})["status"] != "transferring" {
+		t.Fatalf("expected device to be transferring, got %d: %+v", status, data)
+	}
+
+	if status, data, _ := call(http.MethodPost, campaignPath+"/pause", nil, inter.PermissionReadWrite, env.api.OtaCampaignByIDHandler); status != http.StatusOK || data["status"] != "paused" {
+		t.Fatalf("pause expected 200, got %d: %+v", status, data)
+	}
+	if status, _, code := call(http.MethodPost, campaignPath+"/pause", nil, inter.PermissionReadWrite, env.api.OtaCampaignByIDHandler); status != http.StatusConflict || code != 40928 {
+		t.Fatalf("double pause expected 409/40928, got %d/%d", status, code)
+	}
+	if status, data, _ := call(http.MethodPost, campaignPath+"/abort", nil, inter.PermissionReadWrite, env.api.OtaCampaignByIDHandler); status != http.StatusOK || data["status"] != "aborted" {
+		t.Fatalf("abort expected 200, got %d: %+v", status, data)
+	}
+	if status, _, code := call(http.MethodDelete, "/api/v1/firmware/"+artifactID, nil, inter.PermissionReadWrite, env.api.FirmwareByIDHandler); status != http.StatusConflict || code != 40927 {
+		t.Fatalf("delete referenced firmware expected 409/40927, got %d/%d", status, code)
+	}
+	if status, _, code := call(http.MethodGet, "/api/v1/ota/campaigns/abc", nil, inter.PermissionReadOnly, env.api.OtaCampaignByIDHandler); status != http.StatusBadRequest || code != 40096 {
+		t.Fatalf("invalid campaign id expected 400/40096, got %d/%d", status, code)
+	}
+}
+
+func TestAPIFirmwareUploadRejectsOversizedImage(t *testing.T) {
+	cfg := appcfg.DefaultWebConfig()
+	cfg.MaxFirmwareBytes = 8
+	env := newTestAPI(t, apiTestOptions{config: cfg})
+
+	req := withPerm(httptest.NewRequest(http.MethodPost, "/api/v1/firmware?version=v2", strings.NewReader("0123456789")), inter.PermissionReadWrite)
+	rec := httptest.NewRecorder()
+	env.api.FirmwareHandler(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge || mustJSONEnvelope(t, rec).Code != 41301 {
+		t.Fatalf("oversized image expected 413/41301, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
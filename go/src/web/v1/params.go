@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -74,6 +76,9 @@ func ParseDownlinkCommand(raw string) (inter.CmdID, string, error) {
 		return inter.CmdOtaData, command, nil
 	case "action_exec":
 		return inter.CmdActionExec, command, nil
+	case "set":
+		// set 以属性名到目标值的对象写入设备可写属性，下发时复用 action_exec 通道。
+		return inter.CmdActionExec, command, nil
 	case "screen_wy":
 		return inter.CmdScreenWy, command, nil
 	default:
@@ -132,17 +137,11 @@ func ResolveMetricsRange(r *http.Request, minValidTimestampMs int64, defaultRang
 		return start, end, rangeLabel, nil
 	}
 
-	switch rangeLabel {
-	case "all":
+	if rangeLabel == "all" {
 		start = minValidTimestampMs
-	case "1h":
-		start = time.Now().Add(-time.Hour).UnixMilli()
-	case "6h":
-		start = time.Now().Add(-6 * time.Hour).UnixMilli()
-	case "24h":
-		start = time.Now().Add(-24 * time.Hour).UnixMilli()
-	case "7d":
-		start = time.Now().Add(-7 * 24 * time.Hour).UnixMilli()
+	} else {
+		window, _ := inter.ParseMetricDuration(rangeLabel)
+		start = time.Now().Add(-window).UnixMilli()
 	}
 
 	if start < minValidTimestampMs {
@@ -151,12 +150,136 @@ func ResolveMetricsRange(r *http.Request, minValidTimestampMs int64, defaultRang
 	return start, end, rangeLabel, nil
 }
 
-// IsValidMetricsRange 判断指标范围标签是否受接口支持。
+// IsValidMetricsRange 判断指标范围是否受接口支持：`all` 或任意 `数字+单位` 的时长，如 `90m`、`3d`。
 func IsValidMetricsRange(raw string) bool {
-	switch raw {
-	case "1h", "6h", "24h", "7d", "all":
+	if raw == "all" {
 		return true
+	}
+	_, err := inter.ParseMetricDuration(raw)
+	return err == nil
+}
+
+// metricBucketSteps 是自动分桶时依次尝试的桶宽。
+var metricBucketSteps = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// AutoMetricBucket 选出能让 [start, end] 不超过 maxPoints 个桶的最小整齐桶宽（毫秒）。
+func AutoMetricBucket(start, end int64, maxPoints int) int64 {
+	for _, step := range metricBucketSteps {
+		if inter.MetricBucketCount(start, end, step.Milliseconds()) <= int64(maxPoints) {
+			return step.Milliseconds()
+		}
+	}
+	week := metricBucketSteps[len(metricBucketSteps)-1].Milliseconds()
+	weeks := (end-start)/week/int64(maxPoints) + 1
+	for inter.MetricBucketCount(start, end, weeks*week) > int64(maxPoints) {
+		weeks++
+	}
+	return weeks * week
+}
+
+// ParseMetricAggregation 解析指标查询的 bucket、agg、fill 与 max_points 参数，四者都未给出时返回 ok=false，接口仍返回原始采样点。
+// bucket 为 `auto`（默认）或时长；agg 默认 avg，分位数写作 `p50`、`p99.9`；显式桶宽超出点数预算时返回错误，自动桶宽会放大到预算以内。
+func ParseMetricAggregation(values url.Values, start, end int64, maxPoints int) (query inter.MetricAggregateQuery, ok bool, err error) {
+	bucketRaw := strings.TrimSpace(values.Get("bucket"))
+	aggRaw := strings.ToLower(strings.TrimSpace(values.Get("agg")))
+	fillRaw := strings.ToLower(strings.TrimSpace(values.Get("fill")))
+	maxPointsRaw := strings.TrimSpace(values.Get("max_points"))
+	if bucketRaw == "" && aggRaw == "" && fillRaw == "" && maxPointsRaw == "" {
+		return query, false, nil
+	}
+
+	budget, err := ParsePositiveIntQuery(maxPointsRaw, maxPoints, maxPoints)
+	if err != nil {
+		return query, true, fmt.Errorf("invalid max_points: %w", err)
+	}
+
+	query.Agg = inter.MetricAggAvg
+	switch inter.MetricAggregation(aggRaw) {
+	case "":
+	case inter.MetricAggAvg, inter.MetricAggMin, inter.MetricAggMax, inter.MetricAggSum,
+		inter.MetricAggCount, inter.MetricAggFirst, inter.MetricAggLast:
+		query.Agg = inter.MetricAggregation(aggRaw)
+	default:
+		percentile, parseErr := strconv.ParseFloat(strings.TrimPrefix(aggRaw, "p"), 64)
+		if !strings.HasPrefix(aggRaw, "p") || parseErr != nil || !(percentile >= 0 && percentile <= 100) {
+			return query, true, errors.New("invalid agg: must be avg, min, max, sum, count, first, last or pNN")
+		}
+		query.Agg = inter.MetricAggPercentile
+		query.Percentile = percentile / 100
+	}
+
+	query.Fill = inter.MetricFillNone
+	switch inter.MetricFill(fillRaw) {
+	case "":
+	case inter.MetricFillNone, inter.MetricFillNull, inter.MetricFillZero, inter.MetricFillPrevious:
+		query.Fill = inter.MetricFill(fillRaw)
 	default:
-		return false
+		return query, true, errors.New("invalid fill: must be none, null, zero or previous")
+	}
+
+	if bucketRaw == "" || bucketRaw == "auto" {
+		query.BucketMs = AutoMetricBucket(start, end, budget)
+		return query, true, nil
+	}
+	bucket, err := inter.ParseMetricDuration(bucketRaw)
+	if err != nil {
+		return query, true, errors.New("invalid bucket: must be auto or a duration such as 30s, 5m, 1h")
+	}
+	query.BucketMs = bucket.Milliseconds()
+	if count := inter.MetricBucketCount(start, end, query.BucketMs); count > int64(budget) {
+		return query, true, fmt.Errorf("invalid bucket: produces %d buckets, more than max_points %d", count, budget)
+	}
+	return query, true, nil
+}
+
+const (
+	maxMetricNameFilters = 20
+	maxMetricTagFilters  = 10
+)
+
+// metricFilterKeyPattern 限制指标名与标签键的字符集，标签键会被拼进 SQLite 的 JSON 路径。
+var metricFilterKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,64}$`)
+
+// ParseMetricFilters 解析指标查询的 name、entity_id 与 tag 参数。
+// name 可重复或以逗号分隔；tag 形如 `room:kitchen`，可重复，多个标签须同时匹配。
+func ParseMetricFilters(values url.Values) (inter.MetricQuery, error) {
+	var query inter.MetricQuery
+	seen := map[string]bool{}
+	for _, raw := range values["name"] {
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			if !metricFilterKeyPattern.MatchString(name) {
+				return inter.MetricQuery{}, fmt.Errorf("invalid metric name %q", name)
+			}
+			seen[name] = true
+			query.Names = append(query.Names, name)
+		}
+	}
+	if len(query.Names) > maxMetricNameFilters {
+		return inter.MetricQuery{}, fmt.Errorf("at most %d metric names are allowed", maxMetricNameFilters)
+	}
+	query.EntityID = strings.TrimSpace(values.Get("entity_id"))
+	for _, raw := range values["tag"] {
+		key, value, ok := strings.Cut(raw, ":")
+		key = strings.TrimSpace(key)
+		if !ok || !metricFilterKeyPattern.MatchString(key) || value == "" {
+			return inter.MetricQuery{}, fmt.Errorf("tag must be key:value, got %q", raw)
+		}
+		if query.Tags == nil {
+			query.Tags = map[string]string{}
+		}
+		query.Tags[key] = value
+	}
+	if len(query.Tags) > maxMetricTagFilters {
+		return inter.MetricQuery{}, fmt.Errorf("at most %d tags are allowed", maxMetricTagFilters)
 	}
+	return query, nil
 }
@@ -3,7 +3,9 @@ package v1_test
 import (
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/nhirsama/Goster-IoT/src/inter"
 	apiv1 "github.com/nhirsama/Goster-IoT/src/web/v1"
 )
 
@@ -51,17 +53,62 @@ func TestResolveMetricsRangeInvalidQueries(t *testing.T) {
 		t.Fatalf("start_ms without end_ms should return error")
 	}
 
-	invalidRange := httptest.NewRequest("GET", "/api/v1/metrics/dev-1?range=30m", nil)
+	invalidRange := httptest.NewRequest("GET", "/api/v1/metrics/dev-1?range=30x", nil)
 	if _, _, _, err := apiv1.ResolveMetricsRange(invalidRange, minValidMetricsTs, "1h"); err == nil {
 		t.Fatalf("invalid range should return error")
 	}
 
-	invalidRangeWithWindow := httptest.NewRequest("GET", "/api/v1/metrics/dev-1?range=30m&start_ms=1700000000000&end_ms=1700003600000", nil)
+	invalidRangeWithWindow := httptest.NewRequest("GET", "/api/v1/metrics/dev-1?range=0m&start_ms=1700000000000&end_ms=1700003600000", nil)
 	if _, _, _, err := apiv1.ResolveMetricsRange(invalidRangeWithWindow, minValidMetricsTs, "1h"); err == nil {
 		t.Fatalf("invalid range should return error even with explicit window")
 	}
 }
 
+func TestResolveMetricsRangeAcceptsArbitraryDurations(t *testing.T) {
+	for raw, window := range map[string]time.Duration{"90s": 90 * time.Second, "45m": 45 * time.Minute, "36h": 36 * time.Hour, "3d": 72 * time.Hour, "2w": 14 * 24 * time.Hour} {
+		if !apiv1.IsValidMetricsRange(raw) {
+			t.Fatalf("%s should be a valid range", raw)
+		}
+		req := httptest.NewRequest("GET", "/api/v1/metrics/dev-1?range="+raw, nil)
+		start, end, label, err := apiv1.ResolveMetricsRange(req, 0, "1h")
+		if err != nil || label != raw {
+			t.Fatalf("%s: unexpected result label=%s err=%v", raw, label, err)
+		}
+		if got := time.Duration(end-start) * time.Millisecond; got < window-time.Second || got > window+time.Second {
+			t.Fatalf("%s: expected window %s, got %s", raw, window, got)
+		}
+	}
+	for _, raw := range []string{"", "h", "1.5h", "-1h", "10y", "1hour"} {
+		if apiv1.IsValidMetricsRange(raw) {
+			t.Fatalf("%q should be an invalid range", raw)
+		}
+	}
+}
+
+func TestAutoMetricBucketFitsBudget(t *testing.T) {
+	cases := []struct {
+		window    time.Duration
+		maxPoints int
+		want      time.Duration
+	}{
+		{time.Hour, 1000, 5 * time.Second},
+		{24 * time.Hour, 1000, 5 * time.Minute},
+		{7 * 24 * time.Hour, 1000, 15 * time.Minute},
+		{365 * 24 * time.Hour, 10, 6 * 7 * 24 * time.Hour},
+	}
+	const end int64 = 1700000000000
+	for _, tc := range cases {
+		start := end - tc.window.Milliseconds()
+		got := apiv1.AutoMetricBucket(start, end, tc.maxPoints)
+		if got != tc.want.Milliseconds() {
+			t.Fatalf("window %s budget %d: expected %s, got %dms", tc.window, tc.maxPoints, tc.want, got)
+		}
+		if count := inter.MetricBucketCount(start, end, got); count > int64(tc.maxPoints) {
+			t.Fatalf("window %s: %d buckets exceed budget %d", tc.window, count, tc.maxPoints)
+		}
+	}
+}
+
 func TestParseDownlinkCommand(t *testing.T) {
 	cmdID, name, err := apiv1.ParseDownlinkCommand(" action_exec ")
 	if err != nil {
@@ -71,6 +118,10 @@ func TestParseDownlinkCommand(t *testing.T) {
 		t.Fatalf("unexpected parse result: cmdID=%d name=%s", cmdID, name)
 	}
 
+	if cmdID, name, err := apiv1.ParseDownlinkCommand("SET"); err != nil || cmdID != 0x0203 || name != "set" {
+		t.Fatalf("set should map to action_exec channel: cmdID=%d name=%s err=%v", cmdID, name, err)
+	}
+
 	if _, _, err := apiv1.ParseDownlinkCommand("reboot"); err == nil {
 		t.Fatal("parseDownlinkCommand should reject unsupported command")
 	}
@@ -0,0 +1,141 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// retentionPolicyRequest 是覆盖保留期的请求体，retention 支持 30d、12h 等写法，"0" 表示永久保留。
+type retentionPolicyRequest struct {
+	Retention   *string `json:"retention,omitempty"`
+	RetentionMs *int64  `json:"retention_ms,omitempty"`
+}
+
+// RetentionPoliciesHandler 处理 `/api/v1/retention-policies`，返回当前租户各数据类别的生效保留期。
+func (api *API) RetentionPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	if api.retention == nil {
+		api.Error(w, r, http.StatusNotFound, 40488, "retention policy not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	policies, err := api.retention.ListPolicies(api.scopeFromRequest(r))
+	if err != nil {
+		api.InternalError(w, r, 50090, err)
+		return
+	}
+	api.OK(w, r, map[string]interface{}{
+		"items": policies,
+		"total": len(policies),
+	})
+}
+
+// RetentionPolicyByClassHandler 处理 `/api/v1/retention-policies/{class}` 的覆盖与重置，
+// 以及 `/api/v1/retention-policies/status` 的清理进度查询。
+func (api *API) RetentionPolicyByClassHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/retention-policies/"), "/")
+	if api.retention == nil || strings.Contains(name, "/") {
+		api.Error(w, r, http.StatusNotFound, 40488, "retention policy not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	if name == "status" {
+		if r.Method != http.MethodGet {
+			api.MethodNotAllowed(w, r)
+			return
+		}
+		if !api.ensurePerm(w, r, inter.PermissionAdmin) {
+			return
+		}
+		api.OK(w, r, api.retention.Progress())
+		return
+	}
+	class := inter.RetentionDataClass(name)
+	if !class.Valid() {
+		api.Error(w, r, http.StatusNotFound, 40488, "retention policy not found",
+			&ErrorDetail{Type: "not_found", Field: "data_class"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if !api.ensurePerm(w, r, inter.PermissionAdmin) {
+			return
+		}
+		var payload retentionPolicyRequest
+		if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40082, "invalid json body",
+				&ErrorDetail{Type: "validation_error"})
+			return
+		}
+		retention, err := parseRetentionRequest(payload)
+		if err != nil {
+			api.Error(w, r, http.StatusBadRequest, 40015, "invalid retention policy",
+				&ErrorDetail{Type: "validation_error", Field: "retention", Reason: err.Error()})
+			return
+		}
+		updatedBy, _ := r.Context().Value(ContextUsername).(string)
+		policy, err := api.retention.SetPolicy(api.scopeFromRequest(r), class, retention, updatedBy)
+		if err != nil {
+			api.retentionError(w, r, err)
+			return
+		}
+		api.OK(w, r, policy)
+	case http.MethodDelete:
+		if !api.ensurePerm(w, r, inter.PermissionAdmin) {
+			return
+		}
+		policy, err := api.retention.ResetPolicy(api.scopeFromRequest(r), class)
+		if err != nil {
+			api.retentionError(w, r, err)
+			return
+		}
+		api.OK(w, r, policy)
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+// parseRetentionRequest 读取 retention 或 retention_ms，两者必须且只能给出一个。
+func parseRetentionRequest(payload retentionPolicyRequest) (time.Duration, error) {
+	switch {
+	case payload.Retention != nil && payload.RetentionMs != nil:
+		return 0, errors.New("retention and retention_ms are mutually exclusive")
+	case payload.RetentionMs != nil:
+		if *payload.RetentionMs < 0 {
+			return 0, errors.New("retention_ms must not be negative")
+		}
+		return time.Duration(*payload.RetentionMs) * time.Millisecond, nil
+	case payload.Retention != nil:
+		raw := strings.TrimSpace(*payload.Retention)
+		if raw == "0" {
+			return 0, nil
+		}
+		if d, err := inter.ParseMetricDuration(raw); err == nil {
+			return d, nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return 0, errors.New("retention must be a duration such as 30d or 12h")
+		}
+		return d, nil
+	default:
+		return 0, errors.New("retention is required")
+	}
+}
+
+func (api *API) retentionError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, inter.ErrRetentionPolicyInvalid) {
+		api.Error(w, r, http.StatusBadRequest, 40015, "invalid retention policy",
+			&ErrorDetail{Type: "validation_error", Reason: err.Error()})
+		return
+	}
+	api.InternalError(w, r, 50090, err)
+}
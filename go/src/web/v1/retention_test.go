@@ -0,0 +1,73 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPIRetentionPolicies(t *testing.T) {
+	env := newTestAPI(t)
+
+	call := func(method, path, body string, perm inter.PermissionType, handler http.HandlerFunc) (int, interface{}, int) {
+		t.Helper()
+		req := withPerm(httptest.NewRequest(method, path, strings.NewReader(body)), perm)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		envelope := mustJSONEnvelope(t, rec)
+		return rec.Code, envelope.Data, envelope.Code
+	}
+	policyOf := func(data interface{}, class string) map[string]interface{} {
+		t.Helper()
+		for _, item := range data.(map[string]interface{})["items"].([]interface{}) {
+			policy := item.(map[string]interface{})
+			if policy["data_class"] == class {
+				return policy
+			}
+		}
+		t.Fatalf("policy %s not listed: %+v", class, data)
+		return nil
+	}
+
+	status, data, _ := call(http.MethodGet, "/api/v1/retention-policies", "", inter.PermissionReadOnly, env.api.RetentionPoliciesHandler)
+	if status != http.StatusOK || data.(map[string]interface{})["total"] != float64(len(inter.RetentionDataClasses)) {
+		t.Fatalf("list policies expected every class, got %d: %+v", status, data)
+	}
+	if logs := policyOf(data, "logs"); logs["source"] != "default" || logs["retention_ms"] != float64(30*24*3600*1000) {
+		t.Fatalf("unexpected default logs policy: %+v", logs)
+	}
+
+	if status, _, _ := call(http.MethodPut, "/api/v1/retention-policies/logs", `{"retention":"7d"}`, inter.PermissionReadWrite, env.api.RetentionPolicyByClassHandler); status != http.StatusForbidden {
+		t.Fatalf("non-admin override expected 403, got %d", status)
+	}
+	if status, _, code := call(http.MethodPut, "/api/v1/retention-policies/logs", `{"retention":"soon"}`, inter.PermissionAdmin, env.api.RetentionPolicyByClassHandler); status != http.StatusBadRequest || code != 40015 {
+		t.Fatalf("invalid retention expected 400/40015, got %d/%d", status, code)
+	}
+	if status, _, code := call(http.MethodPut, "/api/v1/retention-policies/audio", `{"retention":"7d"}`, inter.PermissionAdmin, env.api.RetentionPolicyByClassHandler); status != http.StatusNotFound || code != 40488 {
+		t.Fatalf("unknown class expected 404/40488, got %d/%d", status, code)
+	}
+	status, data, _ = call(http.MethodPut, "/api/v1/retention-policies/logs", `{"retention":"7d"}`, inter.PermissionAdmin, env.api.RetentionPolicyByClassHandler)
+	if policy := data.(map[string]interface{}); status != http.StatusOK || policy["source"] != "tenant" || policy["retention_ms"] != float64(7*24*3600*1000) {
+		t.Fatalf("override expected 200, got %d: %+v", status, data)
+	}
+	_, data, _ = call(http.MethodGet, "/api/v1/retention-policies", "", inter.PermissionReadOnly, env.api.RetentionPoliciesHandler)
+	if logs := policyOf(data, "logs"); logs["source"] != "tenant" {
+		t.Fatalf("expected tenant override listed, got %+v", logs)
+	}
+
+	status, data, _ = call(http.MethodDelete, "/api/v1/retention-policies/logs", "", inter.PermissionAdmin, env.api.RetentionPolicyByClassHandler)
+	if policy := data.(map[string]interface{}); status != http.StatusOK || policy["source"] != "default" {
+		t.Fatalf("reset expected default policy, got %d: %+v", status, data)
+	}
+
+	if status, _, _ := call(http.MethodGet, "/api/v1/retention-policies/status", "", inter.PermissionReadOnly, env.api.RetentionPolicyByClassHandler); status != http.StatusForbidden {
+		t.Fatalf("non-admin status expected 403, got %d", status)
+	}
+	status, data, _ = call(http.MethodGet, "/api/v1/retention-policies/status", "", inter.PermissionAdmin, env.api.RetentionPolicyByClassHandler)
+	if progress := data.(map[string]interface{}); status != http.StatusOK || progress["running"] != false || progress["runs"] != float64(0) {
+		t.Fatalf("status expected idle progress, got %d: %+v", status, data)
+	}
+}
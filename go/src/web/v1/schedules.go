@@ -0,0 +1,257 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/src/device_manager"
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+// maxScheduleNameLength 限制计划名称长度。
+const maxScheduleNameLength = 128
+
+// scheduleRequest 是创建与更新指令计划的请求体，execute_at 与 cron 二选一。
+type scheduleRequest struct {
+	Name           string          `json:"name"`
+	UUID           string          `json:"uuid,omitempty"`
+	Command        string          `json:"command"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	Key            string          `json:"key,omitempty"`
+	Supersede      bool            `json:"supersede,omitempty"`
+	TTLSeconds     int64           `json:"ttl_seconds,omitempty"`
+	TimeoutSeconds int64           `json:"timeout_seconds,omitempty"`
+	MaxAttempts    int             `json:"max_attempts,omitempty"`
+	ExecuteAt      *time.Time      `json:"execute_at,omitempty"`
+	Cron           string          `json:"cron,omitempty"`
+	Timezone       string          `json:"timezone,omitempty"`
+	Enabled        *bool           `json:"enabled,omitempty"`
+}
+
+// SchedulesHandler 处理 `/api/v1/schedules`：GET 列出当前租户的指令计划，POST 创建计划。
+func (api *API) SchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	if api.commandSchedules == nil {
+		api.Error(w, r, http.StatusNotFound, 40440, "command schedule not found",
+			&ErrorDetail{Type: "not_found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		uuid := strings.TrimSpace(r.URL.Query().Get("uuid"))
+		if uuid != "" && !api.ensureDeviceInScope(w, r, uuid, 40441) {
+			return
+		}
+		items, err := api.commandSchedules.List(api.scopeFromRequest(r), uuid)
+		if err != nil {
+			api.InternalError(w, r, 50044, err)
+			return
+		}
+		payload := make([]map[string]interface{}, 0, len(items))
+		for _, item := range items {
+			payload = append(payload, commandSchedulePayload(item))
+		}
+		api.OK(w, r, map[string]interface{}{
+			"items": payload,
+			"total": len(payload),
+		})
+	case http.MethodPost:
+		if !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+			return
+		}
+		schedule, ok := api.decodeSchedule(w, r)
+		if !ok {
+			return
+		}
+		created, err := api.commandSchedules.Create(api.scopeFromRequest(r), schedule)
+		if err != nil {
+			api.scheduleError(w, r, err, 50045)
+			return
+		}
+		api.OK(w, r, commandSchedulePayload(created))
+	default:
+		api.MethodNotAllowed(w, r)
+	}
+}
+
+// ScheduleByIDHandler 处理 `/api/v1/schedules/{id}`：GET 读取，PUT 整体替换定义，DELETE 删除计划。
+func (api *API) ScheduleByIDHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		api.MethodNotAllowed(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && !api.ensurePerm(w, r, inter.PermissionReadWrite) {
+		return
+	}
+	raw := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/schedules/"), "/")
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		api.Error(w, r, http.StatusBadRequest, 40046, "invalid schedule id",
+			&ErrorDetail{Type: "validation_error", Field: "id"})
+		return
+	}
+	if api.commandSchedules == nil {
+		api.Error(w, r, http.StatusNotFound, 40440, "command schedule not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+		return
+	}
+
+	scope := api.scopeFromRequest(r)
+	switch r.Method {
+	case http.MethodGet:
+		schedule, err := api.commandSchedules.Get(scope, id)
+		if err != nil {
+			api.scheduleError(w, r, err, 50046)
+			return
+		}
+		api.OK(w, r, commandSchedulePayload(schedule))
+	case http.MethodPut:
+		schedule, ok := api.decodeSchedule(w, r)
+		if !ok {
+			return
+		}
+		schedule.ID = id
+		updated, err := api.commandSchedules.Update(scope, schedule)
+		if err != nil {
+			api.scheduleError(w, r, err, 50046)
+			return
+		}
+		api.OK(w, r, commandSchedulePayload(updated))
+	case http.MethodDelete:
+		if err := api.commandSchedules.Delete(scope, id); err != nil {
+			api.scheduleError(w, r, err, 50047)
+			return
+		}
+		api.NoContent(w, r)
+	}
+}
+
+// decodeSchedule 解析并校验请求体中与 HTTP 层相关的字段；时间与 cron 的校验由计划服务完成。
+func (api *API) decodeSchedule(w http.ResponseWriter, r *http.Request) (inter.CommandSchedule, bool) {
+	var payload scheduleRequest
+	if err := DecodeBody(r, &payload, api.maxAPIBodyBytes()); err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40044, "invalid json body",
+			&ErrorDetail{Type: "validation_error"})
+		return inter.CommandSchedule{}, false
+	}
+	if len(strings.TrimSpace(payload.Name)) > maxScheduleNameLength {
+		api.Error(w, r, http.StatusBadRequest, 40045, "invalid command schedule",
+			&ErrorDetail{Type: "validation_error", Field: "name"})
+		return inter.CommandSchedule{}, false
+	}
+	if field := negativeCommandPolicyField(payload.TTLSeconds, payload.TimeoutSeconds, payload.MaxAttempts); field != "" {
+		api.Error(w, r, http.StatusBadRequest, 40045, "invalid command schedule",
+			&ErrorDetail{Type: "validation_error", Field: field})
+		return inter.CommandSchedule{}, false
+	}
+	if len(strings.TrimSpace(payload.Key)) > maxCommandKeyLength {
+		api.Error(w, r, http.StatusBadRequest, 40045, "invalid command schedule",
+			&ErrorDetail{Type: "validation_error", Field: "key"})
+		return inter.CommandSchedule{}, false
+	}
+	cmdID, command, err := ParseDownlinkCommand(payload.Command)
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40045, "invalid command schedule",
+			&ErrorDetail{Type: "validation_error", Field: "command"})
+		return inter.CommandSchedule{}, false
+	}
+
+	rawPayload := []byte(strings.TrimSpace(string(payload.Payload)))
+	if command == "set" {
+		if detail := setPayloadDetail(rawPayload); detail != nil {
+			api.Error(w, r, http.StatusBadRequest, 40039, "command violates device capabilities", detail)
+			return inter.CommandSchedule{}, false
+		}
+	}
+	uuid := strings.TrimSpace(payload.UUID)
+	if uuid != "" {
+		meta, err := api.registry.GetDeviceMetadataByScope(api.scopeFromRequest(r), uuid)
+		if err != nil {
+			api.deviceScopeError(w, r, err, 40441)
+			return inter.CommandSchedule{}, false
+		}
+		if detail := capabilityViolationDetail(device_manager.ValidateCommandCapabilities(meta.Descriptor.Capabilities, cmdID, rawPayload)); detail != nil {
+			api.Error(w, r, http.StatusBadRequest, 40039, "command violates device capabilities", detail)
+			return inter.CommandSchedule{}, false
+		}
+	}
+
+	enabled := true
+	if payload.Enabled != nil {
+		enabled = *payload.Enabled
+	}
+	return inter.CommandSchedule{
+		Name:    payload.Name,
+		UUID:    uuid,
+		Command: command,
+		CmdID:   cmdID,
+		Payload: rawPayload,
+		Policy: inter.DeviceCommandPolicy{
+			TTL:         time.Duration(payload.TTLSeconds) * time.Second,
+			Timeout:     time.Duration(payload.TimeoutSeconds) * time.Second,
+			MaxAttempts: payload.MaxAttempts,
+			Key:         strings.TrimSpace(payload.Key),
+			Supersede:   payload.Supersede,
+		},
+		ExecuteAt: payload.ExecuteAt,
+		Cron:      payload.Cron,
+		Timezone:  payload.Timezone,
+		Enabled:   enabled,
+	}, true
+}
+
+func (api *API) scheduleError(w http.ResponseWriter, r *http.Request, err error, internalCode int) {
+	switch {
+	case errors.Is(err, inter.ErrCommandScheduleInvalid):
+		api.Error(w, r, http.StatusBadRequest, 40045, "invalid command schedule",
+			&ErrorDetail{Type: "validation_error", Reason: err.Error()})
+	case errors.Is(err, inter.ErrCommandScheduleNotFound):
+		api.Error(w, r, http.StatusNotFound, 40440, "command schedule not found",
+			&ErrorDetail{Type: "not_found", Field: "id"})
+	case errors.Is(err, inter.ErrDeviceNotFound), errors.Is(err, inter.ErrDeviceTenantMismatch):
+		api.deviceScopeError(w, r, err, 40441)
+	default:
+		api.InternalError(w, r, internalCode, err)
+	}
+}
+
+// commandSchedulePayload 展开计划定义；uuid 为空表示下发给租户内全部已认证设备。
+func commandSchedulePayload(schedule inter.CommandSchedule) map[string]interface{} {
+	data := map[string]interface{}{
+		"id":              schedule.ID,
+		"name":            schedule.Name,
+		"uuid":            schedule.UUID,
+		"command":         schedule.Command,
+		"cmd_id":          int(schedule.CmdID),
+		"key":             schedule.Policy.Key,
+		"supersede":       schedule.Policy.Supersede,
+		"ttl_seconds":     int64(schedule.Policy.TTL / time.Second),
+		"timeout_seconds": int64(schedule.Policy.Timeout / time.Second),
+		"max_attempts":    schedule.Policy.MaxAttempts,
+		"cron":            schedule.Cron,
+		"timezone":        schedule.Timezone,
+		"enabled":         schedule.Enabled,
+		"run_count":       schedule.RunCount,
+		"created_at":      schedule.CreatedAt.UTC(),
+		"updated_at":      schedule.UpdatedAt.UTC(),
+	}
+	if payload := strings.TrimSpace(string(schedule.Payload)); payload != "" && json.Valid([]byte(payload)) {
+		data["payload"] = json.RawMessage(payload)
+	}
+	if schedule.ExecuteAt != nil {
+		data["execute_at"] = schedule.ExecuteAt.UTC()
+	}
+	if schedule.NextRunAt != nil {
+		data["next_run_at"] = schedule.NextRunAt.UTC()
+	}
+	if schedule.LastRunAt != nil {
+		data["last_run_at"] = schedule.LastRunAt.UTC()
+	}
+	if schedule.LastError != "" {
+		data["last_error"] = schedule.LastError
+	}
+	return data
+}
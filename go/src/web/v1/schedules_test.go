@@ -0,0 +1,73 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
+)
+
+func TestAPICommandScheduleCRUD(t *testing.T) {
+	env := newTestAPI(t)
+	uuid := strings.Repeat("s", 64)
+	seedDevice(t, env.dataStore, uuid, inter.Authenticated)
+
+	call := func(method, path, body string, perm inter.PermissionType, handler http.HandlerFunc) (int, map[string]interface{}, int) {
+		t.Helper()
+		req := withPerm(httptest.NewRequest(method, path, strings.NewReader(body)), perm)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code == http.StatusNoContent {
+			return rec.Code, nil, 0
+		}
+		envelope := mustJSONEnvelope(t, rec)
+		data, _ := envelope.Data.(map[string]interface{})
+		return rec.Code, data, envelope.Code
+	}
+
+	body := `{"name":"nightly refresh","uuid":"` + uuid + `","command":"config_push","payload":{"refresh":true},"cron":"0 2 * * *","timezone":"Asia/Shanghai","key":"refresh","supersede":true}`
+	if status, _, _ := call(http.MethodPost, "/api/v1/schedules", body, inter.PermissionReadOnly, env.api.SchedulesHandler); status != http.StatusForbidden {
+		t.Fatalf("read-only create expected 403, got %d", status)
+	}
+	status, created, _ := call(http.MethodPost, "/api/v1/schedules", body, inter.PermissionReadWrite, env.api.SchedulesHandler)
+	if status != http.StatusOK {
+		t.Fatalf("create expected 200, got %d: %+v", status, created)
+	}
+	if created["uuid"] != uuid || created["cron"] != "0 2 * * *" || created["enabled"] != true || created["key"] != "refresh" ||
+		created["next_run_at"] == nil || created["payload"].(map[string]interface{})["refresh"] != true {
+		t.Fatalf("unexpected created schedule: %+v", created)
+	}
+	id := strconv.FormatInt(int64(created["id"].(float64)), 10)
+
+	status, data, _ := call(http.MethodGet, "/api/v1/schedules?uuid="+uuid, "", inter.PermissionReadOnly, env.api.SchedulesHandler)
+	if status != http.StatusOK || data["total"] != float64(1) {
+		t.Fatalf("list expected one schedule, got %d: %+v", status, data)
+	}
+
+	update := `{"name":"paused","uuid":"` + uuid + `","command":"config_push","execute_at":"2030-01-01T08:00:00Z","enabled":false}`
+	status, data, _ = call(http.MethodPut, "/api/v1/schedules/"+id, update, inter.PermissionReadWrite, env.api.ScheduleByIDHandler)
+	if status != http.StatusOK || data["name"] != "paused" || data["enabled"] != false || data["cron"] != "" ||
+		data["execute_at"] != "2030-01-01T08:00:00Z" || data["next_run_at"] != nil {
+		t.Fatalf("unexpected updated schedule %d: %+v", status, data)
+	}
+
+	status, _, code := call(http.MethodPost, "/api/v1/schedules", `{"command":"config_push","cron":"bad"}`, inter.PermissionReadWrite, env.api.SchedulesHandler)
+	if status != http.StatusBadRequest || code != 40045 {
+		t.Fatalf("invalid cron expected 400/40045, got %d/%d", status, code)
+	}
+	status, _, code = call(http.MethodPost, "/api/v1/schedules", `{"uuid":"missing","command":"config_push","cron":"@daily"}`, inter.PermissionReadWrite, env.api.SchedulesHandler)
+	if status != http.StatusNotFound || code != 40441 {
+		t.Fatalf("unknown device expected 404/40441, got %d/%d", status, code)
+	}
+
+	if status, _, _ := call(http.MethodDelete, "/api/v1/schedules/"+id, "", inter.PermissionReadWrite, env.api.ScheduleByIDHandler); status != http.StatusNoContent {
+		t.Fatalf("delete expected 204, got %d", status)
+	}
+	status, _, code = call(http.MethodGet, "/api/v1/schedules/"+id, "", inter.PermissionReadOnly, env.api.ScheduleByIDHandler)
+	if status != http.StatusNotFound || code != 40440 {
+		t.Fatalf("deleted schedule expected 404/40440, got %d/%d", status, code)
+	}
+}
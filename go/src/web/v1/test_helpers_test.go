@@ -27,12 +27,22 @@ type apiTestOptions struct {
 }
 
 type apiTestEnv struct {
-	api              *apiv1.API
-	auth             identitycore.Service
-	dataStore        *persistence.Store
-	deviceRegistry   inter.DeviceRegistry
-	devicePresence   inter.DevicePresence
-	downlinkCommands inter.DownlinkCommandService
+	api               *apiv1.API
+	auth              identitycore.Service
+	dataStore         *persistence.Store
+	deviceRegistry    inter.DeviceRegistry
+	devicePresence    inter.DevicePresence
+	downlinkCommands  inter.DownlinkCommandService
+	commandSchedules  inter.CommandScheduleService
+	ota               inter.OtaService
+	deviceConfigs     inter.DeviceConfigService
+	deviceStates      inter.DeviceStateService
+	deviceShadows     inter.DeviceShadowService
+	deviceTopology    inter.DeviceTopologyService
+	deviceDiagnostics inter.DeviceDiagnosticsService
+	externalEntities  inter.ExternalEntityService
+	externalCommands  inter.ExternalCommandService
+	ingressCreds      inter.IngressCredentialService
 }
 
 func newTestAPI(t *testing.T, opts ...apiTestOptions) *apiTestEnv {
@@ -65,23 +75,47 @@ func newTestAPI(t *testing.T, opts ...apiTestOptions) *apiTestEnv {
 	}
 
 	api := apiv1.New(apiv1.Deps{
-		DataStore:        ds,
-		DeviceRegistry:   services.DeviceRegistry,
-		DevicePresence:   services.DevicePresence,
-		DownlinkCommands: services.DownlinkCommands,
-		Auth:             authService,
-		Captcha:          option.captcha,
-		Config:           option.config,
-		LoginGuard:       option.loginGuard,
+		DataStore:          ds,
+		DeviceRegistry:     services.DeviceRegistry,
+		DevicePresence:     services.DevicePresence,
+		DownlinkCommands:   services.DownlinkCommands,
+		CommandSchedules:   services.CommandSchedules,
+		CommandBatches:     services.CommandBatches,
+		DeviceGroups:       services.DeviceGroups,
+		Ota:                services.Ota,
+		DeviceConfigs:      services.DeviceConfigs,
+		Retention:          services.Retention,
+		LatestMetrics:      services.LatestMetrics,
+		DeviceStates:       services.DeviceStates,
+		DeviceShadows:      services.DeviceShadows,
+		DeviceTopology:     services.DeviceTopology,
+		DeviceDiagnostics:  services.DeviceDiagnostics,
+		ExternalEntities:   services.ExternalEntities,
+		ExternalCommands:   services.ExternalCommands,
+		IngressCredentials: services.IngressCredentials,
+		Auth:               authService,
+		Captcha:            option.captcha,
+		Config:             option.config,
+		LoginGuard:         option.loginGuard,
 	})
 
 	return &apiTestEnv{
-		api:              api,
-		auth:             authService,
-		dataStore:        ds,
-		deviceRegistry:   services.DeviceRegistry,
-		devicePresence:   services.DevicePresence,
-		downlinkCommands: services.DownlinkCommands,
+		api:               api,
+		auth:              authService,
+		dataStore:         ds,
+		deviceRegistry:    services.DeviceRegistry,
+		devicePresence:    services.DevicePresence,
+		downlinkCommands:  services.DownlinkCommands,
+		commandSchedules:  services.CommandSchedules,
+		ota:               services.Ota,
+		deviceConfigs:     services.DeviceConfigs,
+		deviceStates:      services.DeviceStates,
+		deviceShadows:     services.DeviceShadows,
+		deviceTopology:    services.DeviceTopology,
+		deviceDiagnostics: services.DeviceDiagnostics,
+		externalEntities:  services.ExternalEntities,
+		externalCommands:  services.ExternalCommands,
+		ingressCreds:      services.IngressCredentials,
 	}
 }
 
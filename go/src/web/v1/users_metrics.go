@@ -3,9 +3,12 @@ package v1
 import (
 	"net/http"
 	"strings"
+
+	"github.com/nhirsama/Goster-IoT/src/inter"
 )
 
-// MetricsHandler 返回当前租户范围内设备的时序指标数据。
+// MetricsHandler 返回当前租户范围内设备的时序指标数据，可按指标名、实体与标签过滤。
+// 带上 bucket、agg、fill 或 max_points 任一参数时改为返回数据库内分桶聚合后的序列。
 func (api *API) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		api.MethodNotAllowed(w, r)
@@ -29,7 +32,45 @@ func (api *API) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	points, err := api.dataStore.QueryMetricsByTenant(api.tenantID(r), uuid, start, end)
+	query, err := ParseMetricFilters(r.URL.Query())
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40099, err.Error(),
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	query.Start, query.End = start, end
+
+	aggregate, ok, err := ParseMetricAggregation(r.URL.Query(), start, end, api.metricsMaxPoints())
+	if err != nil {
+		api.Error(w, r, http.StatusBadRequest, 40014, err.Error(),
+			&ErrorDetail{Type: "validation_error"})
+		return
+	}
+	if ok {
+		aggregate.MetricQuery = query
+		series, err := api.dataStore.AggregateMetricSeries(api.tenantID(r), uuid, aggregate)
+		if err != nil {
+			api.InternalError(w, r, 50031, err)
+			return
+		}
+		data := map[string]interface{}{
+			"uuid":      uuid,
+			"range":     rangeLabel,
+			"start_ms":  start,
+			"end_ms":    end,
+			"bucket_ms": aggregate.BucketMs,
+			"agg":       aggregate.Agg,
+			"fill":      aggregate.Fill,
+			"series":    series,
+		}
+		if aggregate.Agg == inter.MetricAggPercentile {
+			data["percentile"] = aggregate.Percentile
+		}
+		api.OK(w, r, data)
+		return
+	}
+
+	points, err := api.dataStore.QueryMetricSeries(api.tenantID(r), uuid, query)
 	if err != nil {
 		api.InternalError(w, r, 50031, err)
 		return
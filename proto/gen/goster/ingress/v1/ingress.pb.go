@@ -1109,28 +1109,30 @@ type DeviceDescriptor struct {
 	SoftwareVersion string `protobuf:"bytes,13,opt,name=software_version,json=softwareVersion,proto3" json:"software_version,omitempty"`
 	ConfigVersion   string `protobuf:"bytes,14,opt,name=config_version,json=configVersion,proto3" json:"config_version,omitempty"`
 	// 通用 IoT 设备元数据。
-	Manufacturer     string                  `protobuf:"bytes,20,opt,name=manufacturer,proto3" json:"manufacturer,omitempty"`
-	Vendor           string                  `protobuf:"bytes,21,opt,name=vendor,proto3" json:"vendor,omitempty"`
-	Model            string                  `protobuf:"bytes,22,opt,name=model,proto3" json:"model,omitempty"`
-	ModelId          string                  `protobuf:"bytes,23,opt,name=model_id,json=modelId,proto3" json:"model_id,omitempty"`
-	FirmwareVersion  string                  `protobuf:"bytes,24,opt,name=firmware_version,json=firmwareVersion,proto3" json:"firmware_version,omitempty"`
-	HardwareRevision string                  `protobuf:"bytes,25,opt,name=hardware_revision,json=hardwareRevision,proto3" json:"hardware_revision,omitempty"`
-	SoftwareBuildId  string                  `protobuf:"bytes,26,opt,name=software_build_id,json=softwareBuildId,proto3" json:"software_build_id,omitempty"`
-	PowerSource      string                  `protobuf:"bytes,27,opt,name=power_source,json=powerSource,proto3" json:"power_source,omitempty"`
-	DeviceType       string                  `protobuf:"bytes,28,opt,name=device_type,json=deviceType,proto3" json:"device_type,omitempty"`             // sensor、actuator、router、coordinator、gateway、controller 等。
-	NetworkAddress   string                  `protobuf:"bytes,29,opt,name=network_address,json=networkAddress,proto3" json:"network_address,omitempty"` // 短地址、节点地址、总线地址等。
-	Identities       []*DeviceIdentity       `protobuf:"bytes,40,rep,name=identities,proto3" json:"identities,omitempty"`
-	Entities         []*EntityDescriptor     `protobuf:"bytes,50,rep,name=entities,proto3" json:"entities,omitempty"`
-	Endpoints        []*EndpointDescriptor   `protobuf:"bytes,51,rep,name=endpoints,proto3" json:"endpoints,omitempty"`
-	Groups           []*GroupDescriptor      `protobuf:"bytes,52,rep,name=groups,proto3" json:"groups,omitempty"`
-	Capabilities     []*CapabilityDescriptor `protobuf:"bytes,53,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
-	Availability     DeviceAvailability      `protobuf:"varint,70,opt,name=availability,proto3,enum=goster.ingress.v1.DeviceAvailability" json:"availability,omitempty"`
-	FirstSeenAt      *timestamppb.Timestamp  `protobuf:"bytes,80,opt,name=first_seen_at,json=firstSeenAt,proto3" json:"first_seen_at,omitempty"`
-	LastSeenAt       *timestamppb.Timestamp  `protobuf:"bytes,81,opt,name=last_seen_at,json=lastSeenAt,proto3" json:"last_seen_at,omitempty"`
-	Labels           map[string]string       `protobuf:"bytes,90,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
-	Attributes       *structpb.Struct        `protobuf:"bytes,100,opt,name=attributes,proto3" json:"attributes,omitempty"`
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+	Manufacturer     string `protobuf:"bytes,20,opt,name=manufacturer,proto3" json:"manufacturer,omitempty"`
+	Vendor           string `protobuf:"bytes,21,opt,name=vendor,proto3" json:"vendor,omitempty"`
+	Model            string `protobuf:"bytes,22,opt,name=model,proto3" json:"model,omitempty"`
+	ModelId          string `protobuf:"bytes,23,opt,name=model_id,json=modelId,proto3" json:"model_id,omitempty"`
+	FirmwareVersion  string `protobuf:"bytes,24,opt,name=firmware_version,json=firmwareVersion,proto3" json:"firmware_version,omitempty"`
+	HardwareRevision string `protobuf:"bytes,25,opt,name=hardware_revision,json=hardwareRevision,proto3" json:"hardware_revision,omitempty"`
+	SoftwareBuildId  string `protobuf:"bytes,26,opt,name=software_build_id,json=softwareBuildId,proto3" json:"software_build_id,omitempty"`
+	PowerSource      string `protobuf:"bytes,27,opt,name=power_source,json=powerSource,proto3" json:"power_source,omitempty"`
+	DeviceType       string `protobuf:"bytes,28,opt,name=device_type,json=deviceType,proto3" json:"device_type,omitempty"`             // sensor、actuator、router、coordinator、gateway、controller 等。
+	NetworkAddress   string `protobuf:"bytes,29,opt,name=network_address,json=networkAddress,proto3" json:"network_address,omitempty"` // 短地址、节点地址、总线地址等。
+	// 经网关、协调器接入时填写上级设备 UUID；直连云端时为空。
+	ParentUuid    string                  `protobuf:"bytes,30,opt,name=parent_uuid,json=parentUuid,proto3" json:"parent_uuid,omitempty"`
+	Identities    []*DeviceIdentity       `protobuf:"bytes,40,rep,name=identities,proto3" json:"identities,omitempty"`
+	Entities      []*EntityDescriptor     `protobuf:"bytes,50,rep,name=entities,proto3" json:"entities,omitempty"`
+	Endpoints     []*EndpointDescriptor   `protobuf:"bytes,51,rep,name=endpoints,proto3" json:"endpoints,omitempty"`
+	Groups        []*GroupDescriptor      `protobuf:"bytes,52,rep,name=groups,proto3" json:"groups,omitempty"`
+	Capabilities  []*CapabilityDescriptor `protobuf:"bytes,53,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	Availability  DeviceAvailability      `protobuf:"varint,70,opt,name=availability,proto3,enum=goster.ingress.v1.DeviceAvailability" json:"availability,omitempty"`
+	FirstSeenAt   *timestamppb.Timestamp  `protobuf:"bytes,80,opt,name=first_seen_at,json=firstSeenAt,proto3" json:"first_seen_at,omitempty"`
+	LastSeenAt    *timestamppb.Timestamp  `protobuf:"bytes,81,opt,name=last_seen_at,json=lastSeenAt,proto3" json:"last_seen_at,omitempty"`
+	Labels        map[string]string       `protobuf:"bytes,90,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Attributes    *structpb.Struct        `protobuf:"bytes,100,opt,name=attributes,proto3" json:"attributes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *DeviceDescriptor) Reset() {
@@ -1282,6 +1284,13 @@ func (x *DeviceDescriptor) GetNetworkAddress() string {
 	return ""
 }
 
+func (x *DeviceDescriptor) GetParentUuid() string {
+	if x != nil {
+		return x.ParentUuid
+	}
+	return ""
+}
+
 func (x *DeviceDescriptor) GetIdentities() []*DeviceIdentity {
 	if x != nil {
 		return x.Identities
@@ -2952,10 +2961,12 @@ type CanonicalDeviceEvent struct {
 	Logs            []*LogRecord           `protobuf:"bytes,42,rep,name=logs,proto3" json:"logs,omitempty"`
 	Availability    DeviceAvailability     `protobuf:"varint,43,opt,name=availability,proto3,enum=goster.ingress.v1.DeviceAvailability" json:"availability,omitempty"`
 	CommandReceipt  *CommandReceipt        `protobuf:"bytes,44,opt,name=command_receipt,json=commandReceipt,proto3" json:"command_receipt,omitempty"`
-	Raw             *RawPayload            `protobuf:"bytes,90,opt,name=raw,proto3" json:"raw,omitempty"`
-	Extensions      *structpb.Struct       `protobuf:"bytes,100,opt,name=extensions,proto3" json:"extensions,omitempty"`
-	unknownFields   protoimpl.UnknownFields
-	sizeCache       protoimpl.SizeCache
+	// EVENT_TYPE_TOPOLOGY 时 device 为网关自身，children 是其当前直连子设备的完整快照。
+	Children      []*DeviceDescriptor `protobuf:"bytes,45,rep,name=children,proto3" json:"children,omitempty"`
+	Raw           *RawPayload         `protobuf:"bytes,90,opt,name=raw,proto3" json:"raw,omitempty"`
+	Extensions    *structpb.Struct    `protobuf:"bytes,100,opt,name=extensions,proto3" json:"extensions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *CanonicalDeviceEvent) Reset() {
@@ -3114,6 +3125,13 @@ func (x *CanonicalDeviceEvent) GetCommandReceipt() *CommandReceipt {
 	return nil
 }
 
+func (x *CanonicalDeviceEvent) GetChildren() []*DeviceDescriptor {
+	if x != nil {
+		return x.Children
+	}
+	return nil
+}
+
 func (x *CanonicalDeviceEvent) GetRaw() *RawPayload {
 	if x != nil {
 		return x.Raw
@@ -3730,13 +3748,15 @@ func (x *IngestEventsRequest) GetAllowPartialSuccess() bool {
 }
 
 type EventIngestResult struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	EventId       string                 `protobuf:"bytes,1,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
-	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
-	Uuid          string                 `protobuf:"bytes,3,opt,name=uuid,proto3" json:"uuid,omitempty"`
-	TenantId      string                 `protobuf:"bytes,4,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
-	ErrorCode     string                 `protobuf:"bytes,5,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
-	ErrorMessage  string                 `protobuf:"bytes,6,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	EventId      string                 `protobuf:"bytes,1,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	Success      bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Uuid         string                 `protobuf:"bytes,3,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	TenantId     string                 `protobuf:"bytes,4,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	ErrorCode    string                 `protobuf:"bytes,5,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
+	ErrorMessage string                 `protobuf:"bytes,6,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	// duplicate 表示该事件已处理过，本次返回的是首次处理的结果，不会重复写入。
+	Duplicate     bool `protobuf:"varint,7,opt,name=duplicate,proto3" json:"duplicate,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -3813,11 +3833,19 @@ func (x *EventIngestResult) GetErrorMessage() string {
 	return ""
 }
 
+func (x *EventIngestResult) GetDuplicate() bool {
+	if x != nil {
+		return x.Duplicate
+	}
+	return false
+}
+
 type IngestEventsResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Results       []*EventIngestResult   `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Results        []*EventIngestResult   `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	DuplicateCount int32                  `protobuf:"varint,2,opt,name=duplicate_count,json=duplicateCount,proto3" json:"duplicate_count,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *IngestEventsResponse) Reset() {
@@ -3857,6 +3885,13 @@ func (x *IngestEventsResponse) GetResults() []*EventIngestResult {
 	return nil
 }
 
+func (x *IngestEventsResponse) GetDuplicateCount() int32 {
+	if x != nil {
+		return x.DuplicateCount
+	}
+	return 0
+}
+
 type PullCommandsRequest struct {
 	state                  protoimpl.MessageState `protogen:"open.v1"`
 	Context                *IngressContext        `protobuf:"bytes,1,opt,name=context,proto3" json:"context,omitempty"`
@@ -4167,6 +4202,200 @@ func (x *CanonicalCommand) GetLabels() map[string]string {
 	return nil
 }
 
+// CommandSubscription 描述一个订阅下行命令的设备。外部集成设备通过带来源前缀的身份定位，
+// 例如 zigbee2mqtt_friendly_name。
+type CommandSubscription struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Uuid            string                 `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	PrimaryIdentity *DeviceIdentity        `protobuf:"bytes,2,opt,name=primary_identity,json=primaryIdentity,proto3" json:"primary_identity,omitempty"`
+	Identities      []*DeviceIdentity      `protobuf:"bytes,3,rep,name=identities,proto3" json:"identities,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *CommandSubscription) Reset() {
+	*x = CommandSubscription{}
+	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[37]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandSubscription) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandSubscription) ProtoMessage() {}
+
+func (x *CommandSubscription) ProtoReflect() protoreflect.Message {
+	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[37]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandSubscription.ProtoReflect.Descriptor instead.
+func (*CommandSubscription) Descriptor() ([]byte, []int) {
+	return file_goster_ingress_v1_ingress_proto_rawDescGZIP(), []int{37}
+}
+
+func (x *CommandSubscription) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *CommandSubscription) GetPrimaryIdentity() *DeviceIdentity {
+	if x != nil {
+		return x.PrimaryIdentity
+	}
+	return nil
+}
+
+func (x *CommandSubscription) GetIdentities() []*DeviceIdentity {
+	if x != nil {
+		return x.Identities
+	}
+	return nil
+}
+
+type WatchCommandsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// context.source_instance + context.adapter_id 标识一个推送会话，断线重连时据此恢复未确认的命令。
+	Context       *IngressContext        `protobuf:"bytes,1,opt,name=context,proto3" json:"context,omitempty"`
+	Subscriptions []*CommandSubscription `protobuf:"bytes,2,rep,name=subscriptions,proto3" json:"subscriptions,omitempty"`
+	// cursor 是 adapter 已处理完毕的最后一个批次游标；0 表示没有可恢复的进度。
+	Cursor        int64 `protobuf:"varint,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	MaxBatch      int32 `protobuf:"varint,4,opt,name=max_batch,json=maxBatch,proto3" json:"max_batch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchCommandsRequest) Reset() {
+	*x = WatchCommandsRequest{}
+	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[38]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchCommandsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchCommandsRequest) ProtoMessage() {}
+
+func (x *WatchCommandsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[38]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchCommandsRequest.ProtoReflect.Descriptor instead.
+func (*WatchCommandsRequest) Descriptor() ([]byte, []int) {
+	return file_goster_ingress_v1_ingress_proto_rawDescGZIP(), []int{38}
+}
+
+func (x *WatchCommandsRequest) GetContext() *IngressContext {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+func (x *WatchCommandsRequest) GetSubscriptions() []*CommandSubscription {
+	if x != nil {
+		return x.Subscriptions
+	}
+	return nil
+}
+
+func (x *WatchCommandsRequest) GetCursor() int64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+func (x *WatchCommandsRequest) GetMaxBatch() int32 {
+	if x != nil {
+		return x.MaxBatch
+	}
+	return 0
+}
+
+type WatchCommandsResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Commands []*CanonicalCommand    `protobuf:"bytes,1,rep,name=commands,proto3" json:"commands,omitempty"`
+	// cursor 随每个命令批次单调递增，adapter 处理完该批次后记录它用于重连恢复。
+	Cursor int64 `protobuf:"varint,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	// keepalive 帧不携带命令，仅用于保持连接并让双方及时发现断线。
+	Keepalive     bool `protobuf:"varint,3,opt,name=keepalive,proto3" json:"keepalive,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchCommandsResponse) Reset() {
+	*x = WatchCommandsResponse{}
+	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[39]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchCommandsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchCommandsResponse) ProtoMessage() {}
+
+func (x *WatchCommandsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[39]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchCommandsResponse.ProtoReflect.Descriptor instead.
+func (*WatchCommandsResponse) Descriptor() ([]byte, []int) {
+	return file_goster_ingress_v1_ingress_proto_rawDescGZIP(), []int{39}
+}
+
+func (x *WatchCommandsResponse) GetCommands() []*CanonicalCommand {
+	if x != nil {
+		return x.Commands
+	}
+	return nil
+}
+
+func (x *WatchCommandsResponse) GetCursor() int64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+func (x *WatchCommandsResponse) GetKeepalive() bool {
+	if x != nil {
+		return x.Keepalive
+	}
+	return false
+}
+
 type UpdateCommandStatusRequest struct {
 	state               protoimpl.MessageState `protogen:"open.v1"`
 	Context             *IngressContext        `protobuf:"bytes,1,opt,name=context,proto3" json:"context,omitempty"`
@@ -4189,7 +4418,7 @@ type UpdateCommandStatusRequest struct {
 
 func (x *UpdateCommandStatusRequest) Reset() {
 	*x = UpdateCommandStatusRequest{}
-	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[37]
+	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[40]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -4201,7 +4430,7 @@ func (x *UpdateCommandStatusRequest) String() string {
 func (*UpdateCommandStatusRequest) ProtoMessage() {}
 
 func (x *UpdateCommandStatusRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[37]
+	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[40]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -4214,7 +4443,7 @@ func (x *UpdateCommandStatusRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateCommandStatusRequest.ProtoReflect.Descriptor instead.
 func (*UpdateCommandStatusRequest) Descriptor() ([]byte, []int) {
-	return file_goster_ingress_v1_ingress_proto_rawDescGZIP(), []int{37}
+	return file_goster_ingress_v1_ingress_proto_rawDescGZIP(), []int{40}
 }
 
 func (x *UpdateCommandStatusRequest) GetContext() *IngressContext {
@@ -4311,7 +4540,7 @@ type UpdateCommandStatusResponse struct {
 
 func (x *UpdateCommandStatusResponse) Reset() {
 	*x = UpdateCommandStatusResponse{}
-	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[38]
+	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[41]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -4323,7 +4552,7 @@ func (x *UpdateCommandStatusResponse) String() string {
 func (*UpdateCommandStatusResponse) ProtoMessage() {}
 
 func (x *UpdateCommandStatusResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[38]
+	mi := &file_goster_ingress_v1_ingress_proto_msgTypes[41]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -4336,7 +4565,7 @@ func (x *UpdateCommandStatusResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateCommandStatusResponse.ProtoReflect.Descriptor instead.
 func (*UpdateCommandStatusResponse) Descriptor() ([]byte, []int) {
-	return file_goster_ingress_v1_ingress_proto_rawDescGZIP(), []int{38}
+	return file_goster_ingress_v1_ingress_proto_rawDescGZIP(), []int{41}
 }
 
 func (x *UpdateCommandStatusResponse) GetSuccess() bool {
@@ -4441,7 +4670,7 @@ const file_goster_ingress_v1_ingress_proto_rawDesc = "" +
 	"\x0eDeviceIdentity\x12\x12\n" +
 	"\x04type\x18\x01 \x01(\tR\x04type\x12\x14\n" +
 	"\x05value\x18\x02 \x01(\tR\x05value\x12\x16\n" +
-	"\x06issuer\x18\x03 \x01(\tR\x06issuer\"\xb3\n" +
+	"\x06issuer\x18\x03 \x01(\tR\x06issuer\"\xd4\n" +
 	"\n" +
 	"\x10DeviceDescriptor\x12\x12\n" +
 	"\x04uuid\x18\x01 \x01(\tR\x04uuid\x12\x12\n" +
@@ -4463,7 +4692,9 @@ const file_goster_ingress_v1_ingress_proto_rawDesc = "" +
 	"\fpower_source\x18\x1b \x01(\tR\vpowerSource\x12\x1f\n" +
 	"\vdevice_type\x18\x1c \x01(\tR\n" +
 	"deviceType\x12'\n" +
-	"\x0fnetwork_address\x18\x1d \x01(\tR\x0enetworkAddress\x12A\n" +
+	"\x0fnetwork_address\x18\x1d \x01(\tR\x0enetworkAddress\x12\x1f\n" +
+	"\vparent_uuid\x18\x1e \x01(\tR\n" +
+	"parentUuid\x12A\n" +
 	"\n" +
 	"identities\x18( \x03(\v2!.goster.ingress.v1.DeviceIdentityR\n" +
 	"identities\x12?\n" +
@@ -4662,7 +4893,7 @@ const file_goster_ingress_v1_ingress_proto_rawDesc = "" +
 	"\x04body\x18\x02 \x01(\fR\x04body\x12+\n" +
 	"\x04json\x18\x03 \x01(\v2\x17.google.protobuf.StructR\x04json\x12\x12\n" +
 	"\x04text\x18\x04 \x01(\tR\x04text\x12\x16\n" +
-	"\x06schema\x18\x05 \x01(\tR\x06schema\"\xd5\b\n" +
+	"\x06schema\x18\x05 \x01(\tR\x06schema\"\x96\t\n" +
 	"\x14CanonicalDeviceEvent\x12\x19\n" +
 	"\bevent_id\x18\x01 \x01(\tR\aeventId\x12!\n" +
 	"\fevent_source\x18\x02 \x01(\tR\veventSource\x12!\n" +
@@ -4687,7 +4918,8 @@ const file_goster_ingress_v1_ingress_proto_rawDesc = "" +
 	"\x06states\x18) \x03(\v2\x1d.goster.ingress.v1.StatePointR\x06states\x120\n" +
 	"\x04logs\x18* \x03(\v2\x1c.goster.ingress.v1.LogRecordR\x04logs\x12I\n" +
 	"\favailability\x18+ \x01(\x0e2%.goster.ingress.v1.DeviceAvailabilityR\favailability\x12J\n" +
-	"\x0fcommand_receipt\x18, \x01(\v2!.goster.ingress.v1.CommandReceiptR\x0ecommandReceipt\x12/\n" +
+	"\x0fcommand_receipt\x18, \x01(\v2!.goster.ingress.v1.CommandReceiptR\x0ecommandReceipt\x12?\n" +
+	"\bchildren\x18- \x03(\v2#.goster.ingress.v1.DeviceDescriptorR\bchildren\x12/\n" +
 	"\x03raw\x18Z \x01(\v2\x1d.goster.ingress.v1.RawPayloadR\x03raw\x127\n" +
 	"\n" +
 	"extensions\x18d \x01(\v2\x17.google.protobuf.StructR\n" +
@@ -4749,7 +4981,7 @@ const file_goster_ingress_v1_ingress_proto_rawDesc = "" +
 	"\x13IngestEventsRequest\x12;\n" +
 	"\acontext\x18\x01 \x01(\v2!.goster.ingress.v1.IngressContextR\acontext\x12?\n" +
 	"\x06events\x18\x02 \x03(\v2'.goster.ingress.v1.CanonicalDeviceEventR\x06events\x122\n" +
-	"\x15allow_partial_success\x18\x03 \x01(\bR\x13allowPartialSuccess\"\xbd\x01\n" +
+	"\x15allow_partial_success\x18\x03 \x01(\bR\x13allowPartialSuccess\"\xdb\x01\n" +
 	"\x11EventIngestResult\x12\x19\n" +
 	"\bevent_id\x18\x01 \x01(\tR\aeventId\x12\x18\n" +
 	"\asuccess\x18\x02 \x01(\bR\asuccess\x12\x12\n" +
@@ -4757,9 +4989,11 @@ const file_goster_ingress_v1_ingress_proto_rawDesc = "" +
 	"\ttenant_id\x18\x04 \x01(\tR\btenantId\x12\x1d\n" +
 	"\n" +
 	"error_code\x18\x05 \x01(\tR\terrorCode\x12#\n" +
-	"\rerror_message\x18\x06 \x01(\tR\ferrorMessage\"V\n" +
+	"\rerror_message\x18\x06 \x01(\tR\ferrorMessage\x12\x1c\n" +
+	"\tduplicate\x18\a \x01(\bR\tduplicate\"\x7f\n" +
 	"\x14IngestEventsResponse\x12>\n" +
-	"\aresults\x18\x01 \x03(\v2$.goster.ingress.v1.EventIngestResultR\aresults\"\x81\x03\n" +
+	"\aresults\x18\x01 \x03(\v2$.goster.ingress.v1.EventIngestResultR\aresults\x12'\n" +
+	"\x0fduplicate_count\x18\x02 \x01(\x05R\x0eduplicateCount\"\x81\x03\n" +
 	"\x13PullCommandsRequest\x12;\n" +
 	"\acontext\x18\x01 \x01(\v2!.goster.ingress.v1.IngressContextR\acontext\x12\x12\n" +
 	"\x04uuid\x18\x02 \x01(\tR\x04uuid\x12L\n" +
@@ -4801,7 +5035,22 @@ const file_goster_ingress_v1_ingress_proto_rawDesc = "" +
 	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a9\n" +
 	"\vLabelsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xd3\x04\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xba\x01\n" +
+	"\x13CommandSubscription\x12\x12\n" +
+	"\x04uuid\x18\x01 \x01(\tR\x04uuid\x12L\n" +
+	"\x10primary_identity\x18\x02 \x01(\v2!.goster.ingress.v1.DeviceIdentityR\x0fprimaryIdentity\x12A\n" +
+	"\n" +
+	"identities\x18\x03 \x03(\v2!.goster.ingress.v1.DeviceIdentityR\n" +
+	"identities\"\xd6\x01\n" +
+	"\x14WatchCommandsRequest\x12;\n" +
+	"\acontext\x18\x01 \x01(\v2!.goster.ingress.v1.IngressContextR\acontext\x12L\n" +
+	"\rsubscriptions\x18\x02 \x03(\v2&.goster.ingress.v1.CommandSubscriptionR\rsubscriptions\x12\x16\n" +
+	"\x06cursor\x18\x03 \x01(\x03R\x06cursor\x12\x1b\n" +
+	"\tmax_batch\x18\x04 \x01(\x05R\bmaxBatch\"\x8e\x01\n" +
+	"\x15WatchCommandsResponse\x12?\n" +
+	"\bcommands\x18\x01 \x03(\v2#.goster.ingress.v1.CanonicalCommandR\bcommands\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\x03R\x06cursor\x12\x1c\n" +
+	"\tkeepalive\x18\x03 \x01(\bR\tkeepalive\"\xd3\x04\n" +
 	"\x1aUpdateCommandStatusRequest\x12;\n" +
 	"\acontext\x18\x01 \x01(\v2!.goster.ingress.v1.IngressContextR\acontext\x12\x1d\n" +
 	"\n" +
@@ -4876,14 +5125,15 @@ const file_goster_ingress_v1_ingress_proto_rawDesc = "" +
 	"\x0fLOG_LEVEL_DEBUG\x10\x01\x12\x12\n" +
 	"\x0eLOG_LEVEL_INFO\x10\x02\x12\x12\n" +
 	"\x0eLOG_LEVEL_WARN\x10\x03\x12\x13\n" +
-	"\x0fLOG_LEVEL_ERROR\x10\x042\x98\x05\n" +
+	"\x0fLOG_LEVEL_ERROR\x10\x042\xfe\x05\n" +
 	"\x1aProtocolIngressCoreService\x12q\n" +
 	"\x12AuthenticateDevice\x12,.goster.ingress.v1.AuthenticateDeviceRequest\x1a-.goster.ingress.v1.AuthenticateDeviceResponse\x12e\n" +
 	"\x0eRegisterDevice\x12(.goster.ingress.v1.RegisterDeviceRequest\x1a).goster.ingress.v1.RegisterDeviceResponse\x12h\n" +
 	"\x0fReportHeartbeat\x12).goster.ingress.v1.ReportHeartbeatRequest\x1a*.goster.ingress.v1.ReportHeartbeatResponse\x12_\n" +
 	"\fIngestEvents\x12&.goster.ingress.v1.IngestEventsRequest\x1a'.goster.ingress.v1.IngestEventsResponse\x12_\n" +
 	"\fPullCommands\x12&.goster.ingress.v1.PullCommandsRequest\x1a'.goster.ingress.v1.PullCommandsResponse\x12t\n" +
-	"\x13UpdateCommandStatus\x12-.goster.ingress.v1.UpdateCommandStatusRequest\x1a..goster.ingress.v1.UpdateCommandStatusResponseBFZDgithub.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1;ingressv1b\x06proto3"
+	"\x13UpdateCommandStatus\x12-.goster.ingress.v1.UpdateCommandStatusRequest\x1a..goster.ingress.v1.UpdateCommandStatusResponse\x12d\n" +
+	"\rWatchCommands\x12'.goster.ingress.v1.WatchCommandsRequest\x1a(.goster.ingress.v1.WatchCommandsResponse0\x01BFZDgithub.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1;ingressv1b\x06proto3"
 
 var (
 	file_goster_ingress_v1_ingress_proto_rawDescOnce sync.Once
@@ -4898,7 +5148,7 @@ func file_goster_ingress_v1_ingress_proto_rawDescGZIP() []byte {
 }
 
 var file_goster_ingress_v1_ingress_proto_enumTypes = make([]protoimpl.EnumInfo, 7)
-var file_goster_ingress_v1_ingress_proto_msgTypes = make([]protoimpl.MessageInfo, 47)
+var file_goster_ingress_v1_ingress_proto_msgTypes = make([]protoimpl.MessageInfo, 50)
 var file_goster_ingress_v1_ingress_proto_goTypes = []any{
 	(Transport)(0),                      // 0: goster.ingress.v1.Transport
 	(EventType)(0),                      // 1: goster.ingress.v1.EventType
@@ -4944,151 +5194,162 @@ var file_goster_ingress_v1_ingress_proto_goTypes = []any{
 	(*PullCommandsRequest)(nil),         // 41: goster.ingress.v1.PullCommandsRequest
 	(*PullCommandsResponse)(nil),        // 42: goster.ingress.v1.PullCommandsResponse
 	(*CanonicalCommand)(nil),            // 43: goster.ingress.v1.CanonicalCommand
-	(*UpdateCommandStatusRequest)(nil),  // 44: goster.ingress.v1.UpdateCommandStatusRequest
-	(*UpdateCommandStatusResponse)(nil), // 45: goster.ingress.v1.UpdateCommandStatusResponse
-	nil,                                 // 46: goster.ingress.v1.IngressContext.LabelsEntry
-	nil,                                 // 47: goster.ingress.v1.MessageContext.PropertiesEntry
-	nil,                                 // 48: goster.ingress.v1.FrameContext.HeadersEntry
-	nil,                                 // 49: goster.ingress.v1.DeviceDescriptor.LabelsEntry
-	nil,                                 // 50: goster.ingress.v1.MetricPoint.TagsEntry
-	nil,                                 // 51: goster.ingress.v1.StatePoint.TagsEntry
-	nil,                                 // 52: goster.ingress.v1.CanonicalCommand.PropertiesEntry
-	nil,                                 // 53: goster.ingress.v1.CanonicalCommand.LabelsEntry
-	(*timestamppb.Timestamp)(nil),       // 54: google.protobuf.Timestamp
-	(*structpb.Struct)(nil),             // 55: google.protobuf.Struct
-	(*durationpb.Duration)(nil),         // 56: google.protobuf.Duration
+	(*CommandSubscription)(nil),         // 44: goster.ingress.v1.CommandSubscription
+	(*WatchCommandsRequest)(nil),        // 45: goster.ingress.v1.WatchCommandsRequest
+	(*WatchCommandsResponse)(nil),       // 46: goster.ingress.v1.WatchCommandsResponse
+	(*UpdateCommandStatusRequest)(nil),  // 47: goster.ingress.v1.UpdateCommandStatusRequest
+	(*UpdateCommandStatusResponse)(nil), // 48: goster.ingress.v1.UpdateCommandStatusResponse
+	nil,                                 // 49: goster.ingress.v1.IngressContext.LabelsEntry
+	nil,                                 // 50: goster.ingress.v1.MessageContext.PropertiesEntry
+	nil,                                 // 51: goster.ingress.v1.FrameContext.HeadersEntry
+	nil,                                 // 52: goster.ingress.v1.DeviceDescriptor.LabelsEntry
+	nil,                                 // 53: goster.ingress.v1.MetricPoint.TagsEntry
+	nil,                                 // 54: goster.ingress.v1.StatePoint.TagsEntry
+	nil,                                 // 55: goster.ingress.v1.CanonicalCommand.PropertiesEntry
+	nil,                                 // 56: goster.ingress.v1.CanonicalCommand.LabelsEntry
+	(*timestamppb.Timestamp)(nil),       // 57: google.protobuf.Timestamp
+	(*structpb.Struct)(nil),             // 58: google.protobuf.Struct
+	(*durationpb.Duration)(nil),         // 59: google.protobuf.Duration
 }
 var file_goster_ingress_v1_ingress_proto_depIdxs = []int32{
 	0,   // 0: goster.ingress.v1.IngressContext.transport:type_name -> goster.ingress.v1.Transport
-	54,  // 1: goster.ingress.v1.IngressContext.received_at:type_name -> google.protobuf.Timestamp
+	57,  // 1: goster.ingress.v1.IngressContext.received_at:type_name -> google.protobuf.Timestamp
 	8,   // 2: goster.ingress.v1.IngressContext.network:type_name -> goster.ingress.v1.NetworkContext
 	9,   // 3: goster.ingress.v1.IngressContext.message:type_name -> goster.ingress.v1.MessageContext
 	10,  // 4: goster.ingress.v1.IngressContext.frame:type_name -> goster.ingress.v1.FrameContext
-	46,  // 5: goster.ingress.v1.IngressContext.labels:type_name -> goster.ingress.v1.IngressContext.LabelsEntry
-	55,  // 6: goster.ingress.v1.IngressContext.extensions:type_name -> google.protobuf.Struct
-	47,  // 7: goster.ingress.v1.MessageContext.properties:type_name -> goster.ingress.v1.MessageContext.PropertiesEntry
-	48,  // 8: goster.ingress.v1.FrameContext.headers:type_name -> goster.ingress.v1.FrameContext.HeadersEntry
-	54,  // 9: goster.ingress.v1.Credential.issued_at:type_name -> google.protobuf.Timestamp
-	54,  // 10: goster.ingress.v1.Credential.expires_at:type_name -> google.protobuf.Timestamp
-	55,  // 11: goster.ingress.v1.Credential.claims:type_name -> google.protobuf.Struct
+	49,  // 5: goster.ingress.v1.IngressContext.labels:type_name -> goster.ingress.v1.IngressContext.LabelsEntry
+	58,  // 6: goster.ingress.v1.IngressContext.extensions:type_name -> google.protobuf.Struct
+	50,  // 7: goster.ingress.v1.MessageContext.properties:type_name -> goster.ingress.v1.MessageContext.PropertiesEntry
+	51,  // 8: goster.ingress.v1.FrameContext.headers:type_name -> goster.ingress.v1.FrameContext.HeadersEntry
+	57,  // 9: goster.ingress.v1.Credential.issued_at:type_name -> google.protobuf.Timestamp
+	57,  // 10: goster.ingress.v1.Credential.expires_at:type_name -> google.protobuf.Timestamp
+	58,  // 11: goster.ingress.v1.Credential.claims:type_name -> google.protobuf.Struct
 	12,  // 12: goster.ingress.v1.DeviceDescriptor.identities:type_name -> goster.ingress.v1.DeviceIdentity
 	14,  // 13: goster.ingress.v1.DeviceDescriptor.entities:type_name -> goster.ingress.v1.EntityDescriptor
 	15,  // 14: goster.ingress.v1.DeviceDescriptor.endpoints:type_name -> goster.ingress.v1.EndpointDescriptor
 	23,  // 15: goster.ingress.v1.DeviceDescriptor.groups:type_name -> goster.ingress.v1.GroupDescriptor
 	24,  // 16: goster.ingress.v1.DeviceDescriptor.capabilities:type_name -> goster.ingress.v1.CapabilityDescriptor
 	5,   // 17: goster.ingress.v1.DeviceDescriptor.availability:type_name -> goster.ingress.v1.DeviceAvailability
-	54,  // 18: goster.ingress.v1.DeviceDescriptor.first_seen_at:type_name -> google.protobuf.Timestamp
-	54,  // 19: goster.ingress.v1.DeviceDescriptor.last_seen_at:type_name -> google.protobuf.Timestamp
-	49,  // 20: goster.ingress.v1.DeviceDescriptor.labels:type_name -> goster.ingress.v1.DeviceDescriptor.LabelsEntry
-	55,  // 21: goster.ingress.v1.DeviceDescriptor.attributes:type_name -> google.protobuf.Struct
+	57,  // 18: goster.ingress.v1.DeviceDescriptor.first_seen_at:type_name -> google.protobuf.Timestamp
+	57,  // 19: goster.ingress.v1.DeviceDescriptor.last_seen_at:type_name -> google.protobuf.Timestamp
+	52,  // 20: goster.ingress.v1.DeviceDescriptor.labels:type_name -> goster.ingress.v1.DeviceDescriptor.LabelsEntry
+	58,  // 21: goster.ingress.v1.DeviceDescriptor.attributes:type_name -> google.protobuf.Struct
 	16,  // 22: goster.ingress.v1.EntityDescriptor.endpoint:type_name -> goster.ingress.v1.EndpointRef
-	55,  // 23: goster.ingress.v1.EntityDescriptor.attributes:type_name -> google.protobuf.Struct
+	58,  // 23: goster.ingress.v1.EntityDescriptor.attributes:type_name -> google.protobuf.Struct
 	17,  // 24: goster.ingress.v1.EndpointDescriptor.input_functions:type_name -> goster.ingress.v1.FunctionBlockDescriptor
 	17,  // 25: goster.ingress.v1.EndpointDescriptor.output_functions:type_name -> goster.ingress.v1.FunctionBlockDescriptor
 	20,  // 26: goster.ingress.v1.EndpointDescriptor.bindings:type_name -> goster.ingress.v1.BindingDescriptor
 	21,  // 27: goster.ingress.v1.EndpointDescriptor.reporting_rules:type_name -> goster.ingress.v1.ReportingRule
 	22,  // 28: goster.ingress.v1.EndpointDescriptor.scenes:type_name -> goster.ingress.v1.SceneDescriptor
-	55,  // 29: goster.ingress.v1.EndpointDescriptor.attributes:type_name -> google.protobuf.Struct
+	58,  // 29: goster.ingress.v1.EndpointDescriptor.attributes:type_name -> google.protobuf.Struct
 	18,  // 30: goster.ingress.v1.FunctionBlockDescriptor.attributes:type_name -> goster.ingress.v1.AttributeDescriptor
 	19,  // 31: goster.ingress.v1.FunctionBlockDescriptor.commands:type_name -> goster.ingress.v1.CommandDescriptor
 	25,  // 32: goster.ingress.v1.AttributeDescriptor.value:type_name -> goster.ingress.v1.Value
-	55,  // 33: goster.ingress.v1.AttributeDescriptor.metadata:type_name -> google.protobuf.Struct
-	55,  // 34: goster.ingress.v1.CommandDescriptor.schema:type_name -> google.protobuf.Struct
+	58,  // 33: goster.ingress.v1.AttributeDescriptor.metadata:type_name -> google.protobuf.Struct
+	58,  // 34: goster.ingress.v1.CommandDescriptor.schema:type_name -> google.protobuf.Struct
 	16,  // 35: goster.ingress.v1.BindingDescriptor.target_endpoint:type_name -> goster.ingress.v1.EndpointRef
-	56,  // 36: goster.ingress.v1.ReportingRule.minimum_interval:type_name -> google.protobuf.Duration
-	56,  // 37: goster.ingress.v1.ReportingRule.maximum_interval:type_name -> google.protobuf.Duration
+	59,  // 36: goster.ingress.v1.ReportingRule.minimum_interval:type_name -> google.protobuf.Duration
+	59,  // 37: goster.ingress.v1.ReportingRule.maximum_interval:type_name -> google.protobuf.Duration
 	16,  // 38: goster.ingress.v1.GroupDescriptor.members:type_name -> goster.ingress.v1.EndpointRef
 	24,  // 39: goster.ingress.v1.CapabilityDescriptor.features:type_name -> goster.ingress.v1.CapabilityDescriptor
-	55,  // 40: goster.ingress.v1.CapabilityDescriptor.metadata:type_name -> google.protobuf.Struct
-	55,  // 41: goster.ingress.v1.Value.json_value:type_name -> google.protobuf.Struct
+	58,  // 40: goster.ingress.v1.CapabilityDescriptor.metadata:type_name -> google.protobuf.Struct
+	58,  // 41: goster.ingress.v1.Value.json_value:type_name -> google.protobuf.Struct
 	25,  // 42: goster.ingress.v1.MetricPoint.value:type_name -> goster.ingress.v1.Value
-	54,  // 43: goster.ingress.v1.MetricPoint.observed_at:type_name -> google.protobuf.Timestamp
+	57,  // 43: goster.ingress.v1.MetricPoint.observed_at:type_name -> google.protobuf.Timestamp
 	16,  // 44: goster.ingress.v1.MetricPoint.endpoint:type_name -> goster.ingress.v1.EndpointRef
-	50,  // 45: goster.ingress.v1.MetricPoint.tags:type_name -> goster.ingress.v1.MetricPoint.TagsEntry
+	53,  // 45: goster.ingress.v1.MetricPoint.tags:type_name -> goster.ingress.v1.MetricPoint.TagsEntry
 	25,  // 46: goster.ingress.v1.StatePoint.value:type_name -> goster.ingress.v1.Value
-	54,  // 47: goster.ingress.v1.StatePoint.observed_at:type_name -> google.protobuf.Timestamp
+	57,  // 47: goster.ingress.v1.StatePoint.observed_at:type_name -> google.protobuf.Timestamp
 	16,  // 48: goster.ingress.v1.StatePoint.endpoint:type_name -> goster.ingress.v1.EndpointRef
-	51,  // 49: goster.ingress.v1.StatePoint.tags:type_name -> goster.ingress.v1.StatePoint.TagsEntry
+	54,  // 49: goster.ingress.v1.StatePoint.tags:type_name -> goster.ingress.v1.StatePoint.TagsEntry
 	6,   // 50: goster.ingress.v1.LogRecord.level:type_name -> goster.ingress.v1.LogLevel
-	54,  // 51: goster.ingress.v1.LogRecord.observed_at:type_name -> google.protobuf.Timestamp
-	55,  // 52: goster.ingress.v1.LogRecord.fields:type_name -> google.protobuf.Struct
-	55,  // 53: goster.ingress.v1.RawPayload.json:type_name -> google.protobuf.Struct
+	57,  // 51: goster.ingress.v1.LogRecord.observed_at:type_name -> google.protobuf.Timestamp
+	58,  // 52: goster.ingress.v1.LogRecord.fields:type_name -> google.protobuf.Struct
+	58,  // 53: goster.ingress.v1.RawPayload.json:type_name -> google.protobuf.Struct
 	1,   // 54: goster.ingress.v1.CanonicalDeviceEvent.event_type:type_name -> goster.ingress.v1.EventType
 	7,   // 55: goster.ingress.v1.CanonicalDeviceEvent.context:type_name -> goster.ingress.v1.IngressContext
 	12,  // 56: goster.ingress.v1.CanonicalDeviceEvent.primary_identity:type_name -> goster.ingress.v1.DeviceIdentity
 	12,  // 57: goster.ingress.v1.CanonicalDeviceEvent.identities:type_name -> goster.ingress.v1.DeviceIdentity
 	13,  // 58: goster.ingress.v1.CanonicalDeviceEvent.device:type_name -> goster.ingress.v1.DeviceDescriptor
-	54,  // 59: goster.ingress.v1.CanonicalDeviceEvent.occurred_at:type_name -> google.protobuf.Timestamp
-	54,  // 60: goster.ingress.v1.CanonicalDeviceEvent.received_at:type_name -> google.protobuf.Timestamp
+	57,  // 59: goster.ingress.v1.CanonicalDeviceEvent.occurred_at:type_name -> google.protobuf.Timestamp
+	57,  // 60: goster.ingress.v1.CanonicalDeviceEvent.received_at:type_name -> google.protobuf.Timestamp
 	26,  // 61: goster.ingress.v1.CanonicalDeviceEvent.metrics:type_name -> goster.ingress.v1.MetricPoint
 	27,  // 62: goster.ingress.v1.CanonicalDeviceEvent.states:type_name -> goster.ingress.v1.StatePoint
 	28,  // 63: goster.ingress.v1.CanonicalDeviceEvent.logs:type_name -> goster.ingress.v1.LogRecord
 	5,   // 64: goster.ingress.v1.CanonicalDeviceEvent.availability:type_name -> goster.ingress.v1.DeviceAvailability
 	31,  // 65: goster.ingress.v1.CanonicalDeviceEvent.command_receipt:type_name -> goster.ingress.v1.CommandReceipt
-	29,  // 66: goster.ingress.v1.CanonicalDeviceEvent.raw:type_name -> goster.ingress.v1.RawPayload
-	55,  // 67: goster.ingress.v1.CanonicalDeviceEvent.extensions:type_name -> google.protobuf.Struct
-	4,   // 68: goster.ingress.v1.CommandReceipt.status:type_name -> goster.ingress.v1.CommandStatus
-	54,  // 69: goster.ingress.v1.CommandReceipt.observed_at:type_name -> google.protobuf.Timestamp
-	29,  // 70: goster.ingress.v1.CommandReceipt.raw:type_name -> goster.ingress.v1.RawPayload
-	7,   // 71: goster.ingress.v1.AuthenticateDeviceRequest.context:type_name -> goster.ingress.v1.IngressContext
-	11,  // 72: goster.ingress.v1.AuthenticateDeviceRequest.credentials:type_name -> goster.ingress.v1.Credential
-	12,  // 73: goster.ingress.v1.AuthenticateDeviceRequest.identities:type_name -> goster.ingress.v1.DeviceIdentity
-	13,  // 74: goster.ingress.v1.AuthenticateDeviceRequest.device_hint:type_name -> goster.ingress.v1.DeviceDescriptor
-	2,   // 75: goster.ingress.v1.AuthenticateDeviceResponse.status:type_name -> goster.ingress.v1.AuthStatus
-	13,  // 76: goster.ingress.v1.AuthenticateDeviceResponse.device:type_name -> goster.ingress.v1.DeviceDescriptor
-	7,   // 77: goster.ingress.v1.RegisterDeviceRequest.context:type_name -> goster.ingress.v1.IngressContext
-	13,  // 78: goster.ingress.v1.RegisterDeviceRequest.device:type_name -> goster.ingress.v1.DeviceDescriptor
-	29,  // 79: goster.ingress.v1.RegisterDeviceRequest.raw:type_name -> goster.ingress.v1.RawPayload
-	3,   // 80: goster.ingress.v1.RegisterDeviceResponse.status:type_name -> goster.ingress.v1.RegistrationStatus
-	11,  // 81: goster.ingress.v1.RegisterDeviceResponse.credential:type_name -> goster.ingress.v1.Credential
-	13,  // 82: goster.ingress.v1.RegisterDeviceResponse.device:type_name -> goster.ingress.v1.DeviceDescriptor
-	7,   // 83: goster.ingress.v1.ReportHeartbeatRequest.context:type_name -> goster.ingress.v1.IngressContext
-	12,  // 84: goster.ingress.v1.ReportHeartbeatRequest.primary_identity:type_name -> goster.ingress.v1.DeviceIdentity
-	12,  // 85: goster.ingress.v1.ReportHeartbeatRequest.identities:type_name -> goster.ingress.v1.DeviceIdentity
-	5,   // 86: goster.ingress.v1.ReportHeartbeatRequest.availability:type_name -> goster.ingress.v1.DeviceAvailability
-	54,  // 87: goster.ingress.v1.ReportHeartbeatRequest.observed_at:type_name -> google.protobuf.Timestamp
-	55,  // 88: goster.ingress.v1.ReportHeartbeatRequest.state:type_name -> google.protobuf.Struct
-	5,   // 89: goster.ingress.v1.ReportHeartbeatResponse.availability:type_name -> goster.ingress.v1.DeviceAvailability
-	7,   // 90: goster.ingress.v1.IngestEventsRequest.context:type_name -> goster.ingress.v1.IngressContext
-	30,  // 91: goster.ingress.v1.IngestEventsRequest.events:type_name -> goster.ingress.v1.CanonicalDeviceEvent
-	39,  // 92: goster.ingress.v1.IngestEventsResponse.results:type_name -> goster.ingress.v1.EventIngestResult
-	7,   // 93: goster.ingress.v1.PullCommandsRequest.context:type_name -> goster.ingress.v1.IngressContext
-	12,  // 94: goster.ingress.v1.PullCommandsRequest.primary_identity:type_name -> goster.ingress.v1.DeviceIdentity
-	12,  // 95: goster.ingress.v1.PullCommandsRequest.identities:type_name -> goster.ingress.v1.DeviceIdentity
-	43,  // 96: goster.ingress.v1.PullCommandsResponse.commands:type_name -> goster.ingress.v1.CanonicalCommand
-	12,  // 97: goster.ingress.v1.CanonicalCommand.target_identity:type_name -> goster.ingress.v1.DeviceIdentity
-	16,  // 98: goster.ingress.v1.CanonicalCommand.target_endpoint:type_name -> goster.ingress.v1.EndpointRef
-	29,  // 99: goster.ingress.v1.CanonicalCommand.payload:type_name -> goster.ingress.v1.RawPayload
-	56,  // 100: goster.ingress.v1.CanonicalCommand.timeout:type_name -> google.protobuf.Duration
-	55,  // 101: goster.ingress.v1.CanonicalCommand.adapter_options:type_name -> google.protobuf.Struct
-	52,  // 102: goster.ingress.v1.CanonicalCommand.properties:type_name -> goster.ingress.v1.CanonicalCommand.PropertiesEntry
-	54,  // 103: goster.ingress.v1.CanonicalCommand.created_at:type_name -> google.protobuf.Timestamp
-	54,  // 104: goster.ingress.v1.CanonicalCommand.expires_at:type_name -> google.protobuf.Timestamp
-	53,  // 105: goster.ingress.v1.CanonicalCommand.labels:type_name -> goster.ingress.v1.CanonicalCommand.LabelsEntry
-	7,   // 106: goster.ingress.v1.UpdateCommandStatusRequest.context:type_name -> goster.ingress.v1.IngressContext
-	4,   // 107: goster.ingress.v1.UpdateCommandStatusRequest.status:type_name -> goster.ingress.v1.CommandStatus
-	29,  // 108: goster.ingress.v1.UpdateCommandStatusRequest.raw:type_name -> goster.ingress.v1.RawPayload
-	54,  // 109: goster.ingress.v1.UpdateCommandStatusRequest.observed_at:type_name -> google.protobuf.Timestamp
-	12,  // 110: goster.ingress.v1.UpdateCommandStatusRequest.target_identity:type_name -> goster.ingress.v1.DeviceIdentity
-	43,  // 111: goster.ingress.v1.UpdateCommandStatusRequest.command:type_name -> goster.ingress.v1.CanonicalCommand
-	4,   // 112: goster.ingress.v1.UpdateCommandStatusResponse.status:type_name -> goster.ingress.v1.CommandStatus
-	32,  // 113: goster.ingress.v1.ProtocolIngressCoreService.AuthenticateDevice:input_type -> goster.ingress.v1.AuthenticateDeviceRequest
-	34,  // 114: goster.ingress.v1.ProtocolIngressCoreService.RegisterDevice:input_type -> goster.ingress.v1.RegisterDeviceRequest
-	36,  // 115: goster.ingress.v1.ProtocolIngressCoreService.ReportHeartbeat:input_type -> goster.ingress.v1.ReportHeartbeatRequest
-	38,  // 116: goster.ingress.v1.ProtocolIngressCoreService.IngestEvents:input_type -> goster.ingress.v1.IngestEventsRequest
-	41,  // 117: goster.ingress.v1.ProtocolIngressCoreService.PullCommands:input_type -> goster.ingress.v1.PullCommandsRequest
-	44,  // 118: goster.ingress.v1.ProtocolIngressCoreService.UpdateCommandStatus:input_type -> goster.ingress.v1.UpdateCommandStatusRequest
-	33,  // 119: goster.ingress.v1.ProtocolIngressCoreService.AuthenticateDevice:output_type -> goster.ingress.v1.AuthenticateDeviceResponse
-	35,  // 120: goster.ingress.v1.ProtocolIngressCoreService.RegisterDevice:output_type -> goster.ingress.v1.RegisterDeviceResponse
-	37,  // 121: goster.ingress.v1.ProtocolIngressCoreService.ReportHeartbeat:output_type -> goster.ingress.v1.ReportHeartbeatResponse
-	40,  // 122: goster.ingress.v1.ProtocolIngressCoreService.IngestEvents:output_type -> goster.ingress.v1.IngestEventsResponse
-	42,  // 123: goster.ingress.v1.ProtocolIngressCoreService.PullCommands:output_type -> goster.ingress.v1.PullCommandsResponse
-	45,  // 124: goster.ingress.v1.ProtocolIngressCoreService.UpdateCommandStatus:output_type -> goster.ingress.v1.UpdateCommandStatusResponse
-	119, // [119:125] is the sub-list for method output_type
-	113, // [113:119] is the sub-list for method input_type
-	113, // [113:113] is the sub-list for extension type_name
-	113, // [113:113] is the sub-list for extension extendee
-	0,   // [0:113] is the sub-list for field type_name
+	13,  // 66: goster.ingress.v1.CanonicalDeviceEvent.children:type_name -> goster.ingress.v1.DeviceDescriptor
+	29,  // 67: goster.ingress.v1.CanonicalDeviceEvent.raw:type_name -> goster.ingress.v1.RawPayload
+	58,  // 68: goster.ingress.v1.CanonicalDeviceEvent.extensions:type_name -> google.protobuf.Struct
+	4,   // 69: goster.ingress.v1.CommandReceipt.status:type_name -> goster.ingress.v1.CommandStatus
+	57,  // 70: goster.ingress.v1.CommandReceipt.observed_at:type_name -> google.protobuf.Timestamp
+	29,  // 71: goster.ingress.v1.CommandReceipt.raw:type_name -> goster.ingress.v1.RawPayload
+	7,   // 72: goster.ingress.v1.AuthenticateDeviceRequest.context:type_name -> goster.ingress.v1.IngressContext
+	11,  // 73: goster.ingress.v1.AuthenticateDeviceRequest.credentials:type_name -> goster.ingress.v1.Credential
+	12,  // 74: goster.ingress.v1.AuthenticateDeviceRequest.identities:type_name -> goster.ingress.v1.DeviceIdentity
+	13,  // 75: goster.ingress.v1.AuthenticateDeviceRequest.device_hint:type_name -> goster.ingress.v1.DeviceDescriptor
+	2,   // 76: goster.ingress.v1.AuthenticateDeviceResponse.status:type_name -> goster.ingress.v1.AuthStatus
+	13,  // 77: goster.ingress.v1.AuthenticateDeviceResponse.device:type_name -> goster.ingress.v1.DeviceDescriptor
+	7,   // 78: goster.ingress.v1.RegisterDeviceRequest.context:type_name -> goster.ingress.v1.IngressContext
+	13,  // 79: goster.ingress.v1.RegisterDeviceRequest.device:type_name -> goster.ingress.v1.DeviceDescriptor
+	29,  // 80: goster.ingress.v1.RegisterDeviceRequest.raw:type_name -> goster.ingress.v1.RawPayload
+	3,   // 81: goster.ingress.v1.RegisterDeviceResponse.status:type_name -> goster.ingress.v1.RegistrationStatus
+	11,  // 82: goster.ingress.v1.RegisterDeviceResponse.credential:type_name -> goster.ingress.v1.Credential
+	13,  // 83: goster.ingress.v1.RegisterDeviceResponse.device:type_name -> goster.ingress.v1.DeviceDescriptor
+	7,   // 84: goster.ingress.v1.ReportHeartbeatRequest.context:type_name -> goster.ingress.v1.IngressContext
+	12,  // 85: goster.ingress.v1.ReportHeartbeatRequest.primary_identity:type_name -> goster.ingress.v1.DeviceIdentity
+	12,  // 86: goster.ingress.v1.ReportHeartbeatRequest.identities:type_name -> goster.ingress.v1.DeviceIdentity
+	5,   // 87: goster.ingress.v1.ReportHeartbeatRequest.availability:type_name -> goster.ingress.v1.DeviceAvailability
+	57,  // 88: goster.ingress.v1.ReportHeartbeatRequest.observed_at:type_name -> google.protobuf.Timestamp
+	58,  // 89: goster.ingress.v1.ReportHeartbeatRequest.state:type_name -> google.protobuf.Struct
+	5,   // 90: goster.ingress.v1.ReportHeartbeatResponse.availability:type_name -> goster.ingress.v1.DeviceAvailability
+	7,   // 91: goster.ingress.v1.IngestEventsRequest.context:type_name -> goster.ingress.v1.IngressContext
+	30,  // 92: goster.ingress.v1.IngestEventsRequest.events:type_name -> goster.ingress.v1.CanonicalDeviceEvent
+	39,  // 93: goster.ingress.v1.IngestEventsResponse.results:type_name -> goster.ingress.v1.EventIngestResult
+	7,   // 94: goster.ingress.v1.PullCommandsRequest.context:type_name -> goster.ingress.v1.IngressContext
+	12,  // 95: goster.ingress.v1.PullCommandsRequest.primary_identity:type_name -> goster.ingress.v1.DeviceIdentity
+	12,  // 96: goster.ingress.v1.PullCommandsRequest.identities:type_name -> goster.ingress.v1.DeviceIdentity
+	43,  // 97: goster.ingress.v1.PullCommandsResponse.commands:type_name -> goster.ingress.v1.CanonicalCommand
+	12,  // 98: goster.ingress.v1.CanonicalCommand.target_identity:type_name -> goster.ingress.v1.DeviceIdentity
+	16,  // 99: goster.ingress.v1.CanonicalCommand.target_endpoint:type_name -> goster.ingress.v1.EndpointRef
+	29,  // 100: goster.ingress.v1.CanonicalCommand.payload:type_name -> goster.ingress.v1.RawPayload
+	59,  // 101: goster.ingress.v1.CanonicalCommand.timeout:type_name -> google.protobuf.Duration
+	58,  // 102: goster.ingress.v1.CanonicalCommand.adapter_options:type_name -> google.protobuf.Struct
+	55,  // 103: goster.ingress.v1.CanonicalCommand.properties:type_name -> goster.ingress.v1.CanonicalCommand.PropertiesEntry
+	57,  // 104: goster.ingress.v1.CanonicalCommand.created_at:type_name -> google.protobuf.Timestamp
+	57,  // 105: goster.ingress.v1.CanonicalCommand.expires_at:type_name -> google.protobuf.Timestamp
+	56,  // 106: goster.ingress.v1.CanonicalCommand.labels:type_name -> goster.ingress.v1.CanonicalCommand.LabelsEntry
+	12,  // 107: goster.ingress.v1.CommandSubscription.primary_identity:type_name -> goster.ingress.v1.DeviceIdentity
+	12,  // 108: goster.ingress.v1.CommandSubscription.identities:type_name -> goster.ingress.v1.DeviceIdentity
+	7,   // 109: goster.ingress.v1.WatchCommandsRequest.context:type_name -> goster.ingress.v1.IngressContext
+	44,  // 110: goster.ingress.v1.WatchCommandsRequest.subscriptions:type_name -> goster.ingress.v1.CommandSubscription
+	43,  // 111: goster.ingress.v1.WatchCommandsResponse.commands:type_name -> goster.ingress.v1.CanonicalCommand
+	7,   // 112: goster.ingress.v1.UpdateCommandStatusRequest.context:type_name -> goster.ingress.v1.IngressContext
+	4,   // 113: goster.ingress.v1.UpdateCommandStatusRequest.status:type_name -> goster.ingress.v1.CommandStatus
+	29,  // 114: goster.ingress.v1.UpdateCommandStatusRequest.raw:type_name -> goster.ingress.v1.RawPayload
+	57,  // 115: goster.ingress.v1.UpdateCommandStatusRequest.observed_at:type_name -> google.protobuf.Timestamp
+	12,  // 116: goster.ingress.v1.UpdateCommandStatusRequest.target_identity:type_name -> goster.ingress.v1.DeviceIdentity
+	43,  // 117: goster.ingress.v1.UpdateCommandStatusRequest.command:type_name -> goster.ingress.v1.CanonicalCommand
+	4,   // 118: goster.ingress.v1.UpdateCommandStatusResponse.status:type_name -> goster.ingress.v1.CommandStatus
+	32,  // 119: goster.ingress.v1.ProtocolIngressCoreService.AuthenticateDevice:input_type -> goster.ingress.v1.AuthenticateDeviceRequest
+	34,  // 120: goster.ingress.v1.ProtocolIngressCoreService.RegisterDevice:input_type -> goster.ingress.v1.RegisterDeviceRequest
+	36,  // 121: goster.ingress.v1.ProtocolIngressCoreService.ReportHeartbeat:input_type -> goster.ingress.v1.ReportHeartbeatRequest
+	38,  // 122: goster.ingress.v1.ProtocolIngressCoreService.IngestEvents:input_type -> goster.ingress.v1.IngestEventsRequest
+	41,  // 123: goster.ingress.v1.ProtocolIngressCoreService.PullCommands:input_type -> goster.ingress.v1.PullCommandsRequest
+	47,  // 124: goster.ingress.v1.ProtocolIngressCoreService.UpdateCommandStatus:input_type -> goster.ingress.v1.UpdateCommandStatusRequest
+	45,  // 125: goster.ingress.v1.ProtocolIngressCoreService.WatchCommands:input_type -> goster.ingress.v1.WatchCommandsRequest
+	33,  // 126: goster.ingress.v1.ProtocolIngressCoreService.AuthenticateDevice:output_type -> goster.ingress.v1.AuthenticateDeviceResponse
+	35,  // 127: goster.ingress.v1.ProtocolIngressCoreService.RegisterDevice:output_type -> goster.ingress.v1.RegisterDeviceResponse
+	37,  // 128: goster.ingress.v1.ProtocolIngressCoreService.ReportHeartbeat:output_type -> goster.ingress.v1.ReportHeartbeatResponse
+	40,  // 129: goster.ingress.v1.ProtocolIngressCoreService.IngestEvents:output_type -> goster.ingress.v1.IngestEventsResponse
+	42,  // 130: goster.ingress.v1.ProtocolIngressCoreService.PullCommands:output_type -> goster.ingress.v1.PullCommandsResponse
+	48,  // 131: goster.ingress.v1.ProtocolIngressCoreService.UpdateCommandStatus:output_type -> goster.ingress.v1.UpdateCommandStatusResponse
+	46,  // 132: goster.ingress.v1.ProtocolIngressCoreService.WatchCommands:output_type -> goster.ingress.v1.WatchCommandsResponse
+	126, // [126:133] is the sub-list for method output_type
+	119, // [119:126] is the sub-list for method input_type
+	119, // [119:119] is the sub-list for extension type_name
+	119, // [119:119] is the sub-list for extension extendee
+	0,   // [0:119] is the sub-list for field type_name
 }
 
 func init() { file_goster_ingress_v1_ingress_proto_init() }
@@ -5109,7 +5370,7 @@ func file_goster_ingress_v1_ingress_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_goster_ingress_v1_ingress_proto_rawDesc), len(file_goster_ingress_v1_ingress_proto_rawDesc)),
 			NumEnums:      7,
-			NumMessages:   47,
+			NumMessages:   50,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -52,6 +52,9 @@ const (
 	// ProtocolIngressCoreServiceUpdateCommandStatusProcedure is the fully-qualified name of the
 	// ProtocolIngressCoreService's UpdateCommandStatus RPC.
 	ProtocolIngressCoreServiceUpdateCommandStatusProcedure = "/goster.ingress.v1.ProtocolIngressCoreService/UpdateCommandStatus"
+	// ProtocolIngressCoreServiceWatchCommandsProcedure is the fully-qualified name of the
+	// ProtocolIngressCoreService's WatchCommands RPC.
+	ProtocolIngressCoreServiceWatchCommandsProcedure = "/goster.ingress.v1.ProtocolIngressCoreService/WatchCommands"
 )
 
 // ProtocolIngressCoreServiceClient is a client for the goster.ingress.v1.ProtocolIngressCoreService
@@ -70,6 +73,9 @@ type ProtocolIngressCoreServiceClient interface {
 	PullCommands(context.Context, *connect.Request[v1.PullCommandsRequest]) (*connect.Response[v1.PullCommandsResponse], error)
 	// UpdateCommandStatus 回填下行命令状态，例如已发送、已确认、失败、重新入队或过期。
 	UpdateCommandStatus(context.Context, *connect.Request[v1.UpdateCommandStatusRequest]) (*connect.Response[v1.UpdateCommandStatusResponse], error)
+	// WatchCommands 为 ingress 实例订阅其当前连接设备的下行命令。命令入队后由 core-api 立即推送，
+	// 订阅集合变化时 adapter 携带最近处理完的 cursor 重新订阅，core-api 会补发游标之后尚未确认的命令。
+	WatchCommands(context.Context, *connect.Request[v1.WatchCommandsRequest]) (*connect.ServerStreamForClient[v1.WatchCommandsResponse], error)
 }
 
 // NewProtocolIngressCoreServiceClient constructs a client for the
@@ -120,6 +126,12 @@ func NewProtocolIngressCoreServiceClient(httpClient connect.HTTPClient, baseURL
 			connect.WithSchema(protocolIngressCoreServiceMethods.ByName("UpdateCommandStatus")),
 			connect.WithClientOptions(opts...),
 		),
+		watchCommands: connect.NewClient[v1.WatchCommandsRequest, v1.WatchCommandsResponse](
+			httpClient,
+			baseURL+ProtocolIngressCoreServiceWatchCommandsProcedure,
+			connect.WithSchema(protocolIngressCoreServiceMethods.ByName("WatchCommands")),
+			connect.WithClientOptions(opts...),
+		),
 	}
 }
 
@@ -131,6 +143,7 @@ type protocolIngressCoreServiceClient struct {
 	ingestEvents        *connect.Client[v1.IngestEventsRequest, v1.IngestEventsResponse]
 	pullCommands        *connect.Client[v1.PullCommandsRequest, v1.PullCommandsResponse]
 	updateCommandStatus *connect.Client[v1.UpdateCommandStatusRequest, v1.UpdateCommandStatusResponse]
+	watchCommands       *connect.Client[v1.WatchCommandsRequest, v1.WatchCommandsResponse]
 }
 
 // AuthenticateDevice calls goster.ingress.v1.ProtocolIngressCoreService.AuthenticateDevice.
@@ -163,6 +176,11 @@ func (c *protocolIngressCoreServiceClient) UpdateCommandStatus(ctx context.Conte
 	return c.updateCommandStatus.CallUnary(ctx, req)
 }
 
+// WatchCommands calls goster.ingress.v1.ProtocolIngressCoreService.WatchCommands.
+func (c *protocolIngressCoreServiceClient) WatchCommands(ctx context.Context, req *connect.Request[v1.WatchCommandsRequest]) (*connect.ServerStreamForClient[v1.WatchCommandsResponse], error) {
+	return c.watchCommands.CallServerStream(ctx, req)
+}
+
 // ProtocolIngressCoreServiceHandler is an implementation of the
 // goster.ingress.v1.ProtocolIngressCoreService service.
 type ProtocolIngressCoreServiceHandler interface {
@@ -179,6 +197,9 @@ type ProtocolIngressCoreServiceHandler interface {
 	PullCommands(context.Context, *connect.Request[v1.PullCommandsRequest]) (*connect.Response[v1.PullCommandsResponse], error)
 	// UpdateCommandStatus 回填下行命令状态，例如已发送、已确认、失败、重新入队或过期。
 	UpdateCommandStatus(context.Context, *connect.Request[v1.UpdateCommandStatusRequest]) (*connect.Response[v1.UpdateCommandStatusResponse], error)
+	// WatchCommands 为 ingress 实例订阅其当前连接设备的下行命令。命令入队后由 core-api 立即推送，
+	// 订阅集合变化时 adapter 携带最近处理完的 cursor 重新订阅，core-api 会补发游标之后尚未确认的命令。
+	WatchCommands(context.Context, *connect.Request[v1.WatchCommandsRequest], *connect.ServerStream[v1.WatchCommandsResponse]) error
 }
 
 // NewProtocolIngressCoreServiceHandler builds an HTTP handler from the service implementation. It
@@ -224,6 +245,12 @@ func NewProtocolIngressCoreServiceHandler(svc ProtocolIngressCoreServiceHandler,
 		connect.WithSchema(protocolIngressCoreServiceMethods.ByName("UpdateCommandStatus")),
 		connect.WithHandlerOptions(opts...),
 	)
+	protocolIngressCoreServiceWatchCommandsHandler := connect.NewServerStreamHandler(
+		ProtocolIngressCoreServiceWatchCommandsProcedure,
+		svc.WatchCommands,
+		connect.WithSchema(protocolIngressCoreServiceMethods.ByName("WatchCommands")),
+		connect.WithHandlerOptions(opts...),
+	)
 	return "/goster.ingress.v1.ProtocolIngressCoreService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case ProtocolIngressCoreServiceAuthenticateDeviceProcedure:
@@ -238,6 +265,8 @@ func NewProtocolIngressCoreServiceHandler(svc ProtocolIngressCoreServiceHandler,
 			protocolIngressCoreServicePullCommandsHandler.ServeHTTP(w, r)
 		case ProtocolIngressCoreServiceUpdateCommandStatusProcedure:
 			protocolIngressCoreServiceUpdateCommandStatusHandler.ServeHTTP(w, r)
+		case ProtocolIngressCoreServiceWatchCommandsProcedure:
+			protocolIngressCoreServiceWatchCommandsHandler.ServeHTTP(w, r)
 		default:
 			http.NotFound(w, r)
 		}
@@ -270,3 +299,7 @@ func (UnimplementedProtocolIngressCoreServiceHandler) PullCommands(context.Conte
 func (UnimplementedProtocolIngressCoreServiceHandler) UpdateCommandStatus(context.Context, *connect.Request[v1.UpdateCommandStatusRequest]) (*connect.Response[v1.UpdateCommandStatusResponse], error) {
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("goster.ingress.v1.ProtocolIngressCoreService.UpdateCommandStatus is not implemented"))
 }
+
+func (UnimplementedProtocolIngressCoreServiceHandler) WatchCommands(context.Context, *connect.Request[v1.WatchCommandsRequest], *connect.ServerStream[v1.WatchCommandsResponse]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("goster.ingress.v1.ProtocolIngressCoreService.WatchCommands is not implemented"))
+}
@@ -46,11 +46,29 @@ type DeviceDescriptor struct {
 	FirmwareVersion string
 	DeviceType      string
 	NetworkAddress  string
+	ParentUUID      string
 	Identities      []Identity
+	Capabilities    []Capability
 	Labels          map[string]string
 	Attributes      map[string]any
 }
 
+// Capability 描述设备可读写的一个属性，zigbee2mqtt 的 exposes 会转换成这种结构。
+type Capability struct {
+	Name          string
+	Property      string
+	Type          string
+	Access        string
+	Readable      bool
+	Writable      bool
+	Unit          string
+	ValueMin      string
+	ValueMax      string
+	Description   string
+	AllowedValues []string
+	Features      []Capability
+}
+
 type MetricPoint struct {
 	Name             string
 	Value            Value
@@ -129,6 +147,7 @@ type AdapterEvent struct {
 	Log          *LogRecord
 	Availability string
 	Receipt      *CommandReceipt
+	Children     []DeviceDescriptor
 
 	Raw            []byte
 	RawContentType string
@@ -146,6 +165,7 @@ type AdapterCommand struct {
 	Operation           string
 	ProtocolCommandCode uint32
 	Target              Identity
+	TargetEntityID      string
 	Payload             []byte
 	PayloadContentType  string
 	Properties          map[string]string
@@ -17,6 +17,7 @@ import (
 
 	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
 	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/adapter"
+	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/commandwatch"
 	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/config"
 	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/coreclient"
 	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/normalizer"
@@ -36,6 +37,9 @@ type Adapter struct {
 	shutdown       atomic.Bool
 	connMu         sync.Mutex
 	conns          map[net.Conn]struct{}
+	watcher        *commandwatch.Watcher
+	sessionMu      sync.Mutex
+	sessions       map[string]*session
 }
 
 func New(cfg config.CustomTCPConfig, logger *slog.Logger, deps ...Option) *Adapter {
@@ -68,10 +72,17 @@ func New(cfg config.CustomTCPConfig, logger *slog.Logger, deps ...Option) *Adapt
 		codec:          gosterwy.NewCodec(),
 		privateKey:     privKey,
 		conns:          make(map[net.Conn]struct{}),
+		sessions:       make(map[string]*session),
 	}
 	for _, opt := range deps {
 		opt(a)
 	}
+	if a.core != nil && a.normalizer != nil {
+		a.watcher = commandwatch.New(a.core, logger, commandwatch.Options{
+			Context:  a.watchContext,
+			MaxBatch: cfg.DownlinkMaxBatch,
+		}, a.deliverDownlink)
+	}
 	logger.Info("custom_tcp X25519 密钥初始化成功", "pub_key", hex.EncodeToString(privKey.PublicKey().Bytes()))
 	return a
 }
@@ -150,6 +161,10 @@ func (a *Adapter) Serve(ctx context.Context, listener net.Listener) error {
 	}()
 	defer close(stopShutdown)
 
+	if a.watcher != nil {
+		go a.watcher.Run(ctx)
+	}
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -182,7 +197,7 @@ func (a *Adapter) handleConnection(ctx context.Context, conn net.Conn) {
 	connID := a.connSeq.Add(1)
 	logger := a.logger.With("remote_addr", conn.RemoteAddr().String(), "conn_id", connID)
 	session := newSession(a, logger, conn)
-	defer session.RequeueInflight(ctx)
+	defer session.Close(ctx)
 	connCtx, cancelConn := context.WithCancel(ctx)
 	defer cancelConn()
 	var lastActivity atomic.Int64
@@ -192,9 +207,57 @@ func (a *Adapter) handleConnection(ctx context.Context, conn net.Conn) {
 	var sessionKey []byte
 	var writeSeq uint64
 
+	// 读包放在独立 goroutine 中，使推送流送达的下行命令无需等待设备下一个上行包即可写出。
+	// 每读完一包都要等主循环交回当前会话密钥再继续，保证握手与密钥重协商后使用新密钥解包。
+	nextRead := make(chan []byte, 1)
+	reads := make(chan readResult, 1)
+	defer close(nextRead)
+	go a.readPackets(conn, nextRead, reads)
+
+	flushDownlinks := func() bool {
+		for i := 0; i < a.cfg.DownlinkMaxBatch; i++ {
+			msg, ok := session.PopCommand()
+			if !ok {
+				return true
+			}
+			cmdID, ok := resolveDownlinkCmd(msg)
+			if !ok {
+				session.FailDownlink(connCtx, msg, fmt.Errorf("无法映射下行操作: %s", msg.Operation))
+				continue
+			}
+			writeSeq++
+			downlinkBuf, err := a.codec.Pack(msg.Payload, cmdID, 1, sessionKey, writeSeq, false)
+			if err != nil {
+				session.FailDownlink(connCtx, msg, err)
+				logger.Warn("下行指令打包失败", "cmd_id", cmdID, "command_id", msg.CommandID, "error", err)
+				continue
+			}
+			if err := writeAll(conn, downlinkBuf); err != nil {
+				session.RequeueDownlink(ctx, msg, err)
+				logger.Warn("下行指令发送失败", "cmd_id", cmdID, "command_id", msg.CommandID, "error", err)
+				return false
+			}
+			session.MarkDownlinkSent(connCtx, msg, cmdID, writeSeq)
+			logger.Info("下行指令已发送", "cmd_id", cmdID, "command_id", msg.CommandID)
+		}
+		return true
+	}
+
 	for {
-		_ = conn.SetReadDeadline(time.Now().Add(a.cfg.ReadTimeout))
-		packet, err := a.codec.Unpack(conn, sessionKey)
+		nextRead <- sessionKey
+		var result readResult
+	wait:
+		for {
+			select {
+			case result = <-reads:
+				break wait
+			case <-session.Wake():
+				if !flushDownlinks() {
+					return
+				}
+			}
+		}
+		packet, err := result.packet, result.err
 		if err != nil {
 			if a.shutdown.Load() || ctx.Err() != nil {
 				return
@@ -337,32 +400,24 @@ func (a *Adapter) handleConnection(ctx context.Context, conn net.Conn) {
 			logger.Warn("未知指令", "cmd_id", packet.CmdID)
 		}
 
-		if session.IsAuthenticated() {
-			for i := 0; i < a.cfg.DownlinkMaxBatch; i++ {
-				msg, ok := session.PopCommand(connCtx)
-				if !ok {
-					break
-				}
-				cmdID, ok := resolveDownlinkCmd(msg)
-				if !ok {
-					session.FailDownlink(connCtx, msg, fmt.Errorf("无法映射下行操作: %s", msg.Operation))
-					continue
-				}
-				writeSeq++
-				downlinkBuf, err := a.codec.Pack(msg.Payload, cmdID, 1, sessionKey, writeSeq, false)
-				if err != nil {
-					session.FailDownlink(connCtx, msg, err)
-					logger.Warn("下行指令打包失败", "cmd_id", cmdID, "command_id", msg.CommandID, "error", err)
-					continue
-				}
-				if err := writeAll(conn, downlinkBuf); err != nil {
-					session.RequeueDownlink(ctx, msg, err)
-					logger.Warn("下行指令发送失败", "cmd_id", cmdID, "command_id", msg.CommandID, "error", err)
-					return
-				}
-				session.MarkDownlinkSent(connCtx, msg, cmdID, writeSeq)
-				logger.Info("下行指令已发送", "cmd_id", cmdID, "command_id", msg.CommandID)
-			}
+		if session.IsAuthenticated() && !flushDownlinks() {
+			return
+		}
+	}
+}
+
+type readResult struct {
+	packet *gosterwy.Packet
+	err    error
+}
+
+func (a *Adapter) readPackets(conn net.Conn, nextRead <-chan []byte, reads chan<- readResult) {
+	for sessionKey := range nextRead {
+		_ = conn.SetReadDeadline(time.Now().Add(a.cfg.ReadTimeout))
+		packet, err := a.codec.Unpack(conn, sessionKey)
+		reads <- readResult{packet: packet, err: err}
+		if err != nil {
+			return
 		}
 	}
 }
@@ -507,6 +562,86 @@ func frameInfo(packet *gosterwy.Packet) adapter.FrameInfo {
 	}
 }
 
+// attachSession 登记设备当前的连接会话并订阅其下行推送；同一设备重连时新会话覆盖旧会话。
+func (a *Adapter) attachSession(s *session) {
+	a.sessionMu.Lock()
+	a.sessions[s.uuid] = s
+	a.sessionMu.Unlock()
+	if a.watcher != nil {
+		a.watcher.Track(s.uuid, &ingressv1.DeviceIdentity{Type: s.identity.Type, Value: s.identity.Value, Issuer: s.identity.Issuer})
+	}
+}
+
+// detachSession 仅在 s 仍是设备当前会话时注销并取消订阅，避免旧连接的关闭影响已重连的新会话。
+func (a *Adapter) detachSession(s *session) {
+	a.sessionMu.Lock()
+	current, ok := a.sessions[s.uuid]
+	if !ok || current != s {
+		a.sessionMu.Unlock()
+		return
+	}
+	delete(a.sessions, s.uuid)
+	a.sessionMu.Unlock()
+	if a.watcher != nil {
+		a.watcher.Untrack(s.uuid)
+	}
+}
+
+func (a *Adapter) lookupSession(uuid string) *session {
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+	return a.sessions[uuid]
+}
+
+func (a *Adapter) watchContext() *ingressv1.IngressContext {
+	return &ingressv1.IngressContext{
+		SourceInstance:  a.sourceInstance,
+		AdapterId:       a.Name(),
+		ProtocolName:    "goster-wy",
+		ProtocolVersion: "1",
+		Transport:       ingressv1.Transport_TRANSPORT_STREAM,
+	}
+}
+
+// deliverDownlink 把推送流送达的命令交给设备所在的连接会话；设备已断开时回队等待下次连接。
+func (a *Adapter) deliverDownlink(ctx context.Context, raw *ingressv1.CanonicalCommand) {
+	s := a.lookupSession(raw.GetUuid())
+	if s == nil {
+		a.requeueCommand(ctx, raw)
+		return
+	}
+	cmd, err := a.normalizer.NormalizeCommand(ctx, raw)
+	if err != nil {
+		s.logger.Warn("归一化下行命令失败", "command_id", raw.GetCommandId(), "error", err)
+		s.FailDownlink(ctx, adapter.AdapterCommand{CommandID: raw.GetCommandId(), CommandUUID: raw.GetCommandUuid(), UUID: raw.GetUuid(), Operation: raw.GetOperation()}, err)
+		return
+	}
+	if !s.pushCommand(cmd) {
+		a.requeueCommand(ctx, raw)
+	}
+}
+
+func (a *Adapter) requeueCommand(ctx context.Context, raw *ingressv1.CanonicalCommand) {
+	rpcCtx, cancel := context.WithTimeout(ctx, a.cfg.RPCTimeout)
+	defer cancel()
+	ingressCtx := a.watchContext()
+	ingressCtx.TenantId = raw.GetTenantId()
+	if _, err := a.core.UpdateCommandStatus(rpcCtx, &ingressv1.UpdateCommandStatusRequest{
+		Context:             ingressCtx,
+		CommandId:           raw.GetCommandId(),
+		CommandUuid:         raw.GetCommandUuid(),
+		Status:              ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED,
+		ProtocolCommandCode: raw.GetProtocolCommandCode(),
+		ObservedAt:          timestamppb.Now(),
+		Uuid:                raw.GetUuid(),
+		TargetIdentity:      raw.GetTargetIdentity(),
+		Command:             raw,
+		Operation:           raw.GetOperation(),
+	}); err != nil {
+		a.logger.Warn("custom_tcp 下行回队状态回填失败", "uuid", raw.GetUuid(), "command_id", raw.GetCommandId(), "error", err)
+	}
+}
+
 func (a *Adapter) ingressContext(conn net.Conn, packet *gosterwy.Packet, session *session) *ingressv1.IngressContext {
 	ctx := &ingressv1.IngressContext{
 		SourceInstance:  a.sourceInstance,
@@ -29,7 +29,6 @@ type fakeCore struct {
 	authToken    string
 	authResp     *ingressv1.AuthenticateDeviceResponse
 	authErr      error
-	blockPull    chan struct{}
 	registerResp *ingressv1.RegisterDeviceResponse
 	heartbeats   []*ingressv1.ReportHeartbeatRequest
 	ingested     []*ingressv1.IngestEventsRequest
@@ -77,13 +76,6 @@ func (f *fakeCore) IngestEvents(ctx context.Context, req *ingressv1.IngestEvents
 }
 
 func (f *fakeCore) PullCommands(ctx context.Context, req *ingressv1.PullCommandsRequest) (*ingressv1.PullCommandsResponse, error) {
-	if f.blockPull != nil {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-f.blockPull:
-		}
-	}
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	if len(f.pullQueue) == 0 {
@@ -94,6 +86,32 @@ func (f *fakeCore) PullCommands(ctx context.Context, req *ingressv1.PullCommands
 	return &ingressv1.PullCommandsResponse{Commands: []*ingressv1.CanonicalCommand{cmd}}, nil
 }
 
+// WatchCommands 把 pullQueue 中属于订阅设备的命令推送一次，然后保持推送流直到取消。
+func (f *fakeCore) WatchCommands(ctx context.Context, req *ingressv1.WatchCommandsRequest, handle func(*ingressv1.WatchCommandsResponse) error) error {
+	subscribed := map[string]bool{}
+	for _, sub := range req.GetSubscriptions() {
+		subscribed[sub.GetUuid()] = true
+	}
+	f.mu.Lock()
+	var pushed, rest []*ingressv1.CanonicalCommand
+	for _, cmd := range f.pullQueue {
+		if subscribed[cmd.GetUuid()] {
+			pushed = append(pushed, cmd)
+		} else {
+			rest = append(rest, cmd)
+		}
+	}
+	f.pullQueue = rest
+	f.mu.Unlock()
+	if len(pushed) > 0 {
+		if err := handle(&ingressv1.WatchCommandsResponse{Commands: pushed, Cursor: 1}); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
 func (f *fakeCore) UpdateCommandStatus(ctx context.Context, req *ingressv1.UpdateCommandStatusRequest) (*ingressv1.UpdateCommandStatusResponse, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -111,6 +129,14 @@ func newTestAdapter(core *fakeCore) *Adapter {
 	return New(config.CustomTCPConfig{Enabled: true, ReadTimeout: time.Second, IdleTimeout: 5 * time.Minute, RPCTimeout: time.Second, RegisterAckGraceDelay: time.Millisecond, DownlinkMaxBatch: 4}, slog.New(slog.NewTextHandler(io.Discard, nil)), WithCoreClient(core), WithNormalizer(normalizer.New("ingress-test")))
 }
 
+// runWatcher 启动下行推送订阅，测试结束时停止。
+func runWatcher(t *testing.T, a *Adapter) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go a.watcher.Run(ctx)
+}
+
 func startPipeSession(t *testing.T, a *Adapter) (net.Conn, gosterwy.ProtocolCodec, []byte, []byte, []byte, int64) {
 	t.Helper()
 	serverConn, clientConn := net.Pipe()
@@ -313,6 +339,7 @@ func TestHandleConnectionDownlinkSentAckedAndRequeuedOnDisconnect(t *testing.T)
 		Payload:   &ingressv1.RawPayload{ContentType: "application/json", Body: []byte(`{"sampling":"5s"}`)},
 	}}
 	a := newTestAdapter(core)
+	runWatcher(t, a)
 	conn, codec, key, clientPubKey, serverPubKey, serverTS := startPipeSession(t, a)
 
 	writeAuthPacket(t, conn, codec, "token-1", key, clientPubKey, serverPubKey, serverTS, 2)
@@ -356,6 +383,7 @@ func TestHandleConnectionDownlinkSentAckedAndRequeuedOnDisconnect(t *testing.T)
 	core = newFakeCore()
 	core.pullQueue = []*ingressv1.CanonicalCommand{{CommandId: 43, Uuid: "dev-1", Operation: "action_exec", Payload: &ingressv1.RawPayload{Body: []byte("on")}}}
 	a = newTestAdapter(core)
+	runWatcher(t, a)
 	conn, codec, key, clientPubKey, serverPubKey, serverTS = startPipeSession(t, a)
 	writeAuthPacket(t, conn, codec, "token-1", key, clientPubKey, serverPubKey, serverTS, 2)
 	readAck(t, conn, codec, key, gosterwy.CmdAuthAck)
@@ -375,6 +403,35 @@ func TestHandleConnectionDownlinkSentAckedAndRequeuedOnDisconnect(t *testing.T)
 	t.Fatalf("expected requeued update after disconnect, got %+v", updates)
 }
 
+func TestHandleConnectionWritesPushedDownlinkWithoutUplink(t *testing.T) {
+	core := newFakeCore()
+	a := newTestAdapter(core)
+	conn, codec, key, clientPubKey, serverPubKey, serverTS := startPipeSession(t, a)
+	defer conn.Close()
+	writeAuthPacket(t, conn, codec, "token-1", key, clientPubKey, serverPubKey, serverTS, 2)
+	readAck(t, conn, codec, key, gosterwy.CmdAuthAck)
+
+	// 设备鉴权后不再发送任何上行包，推送的命令也应立即写出。
+	a.deliverDownlink(context.Background(), &ingressv1.CanonicalCommand{CommandId: 7, Uuid: "dev-1", Operation: "action_exec", Payload: &ingressv1.RawPayload{Body: []byte("on")}})
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	downlink, err := codec.Unpack(conn, key)
+	if err != nil {
+		t.Fatalf("read pushed downlink: %v", err)
+	}
+	if downlink.CmdID != gosterwy.CmdActionExec || !bytes.Equal(downlink.Payload, []byte("on")) {
+		t.Fatalf("unexpected pushed downlink: %+v", downlink)
+	}
+
+	a.deliverDownlink(context.Background(), &ingressv1.CanonicalCommand{CommandId: 8, Uuid: "dev-2", Operation: "action_exec"})
+	_, updates, _ := core.snapshot()
+	for _, update := range updates {
+		if update.GetCommandId() == 8 && update.GetStatus() == ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED {
+			return
+		}
+	}
+	t.Fatalf("command for unconnected device should be requeued, got %+v", updates)
+}
+
 func TestHandleConnectionRejectsStaleDownlinkAckSequence(t *testing.T) {
 	core := newFakeCore()
 	core.pullQueue = []*ingressv1.CanonicalCommand{{
@@ -384,6 +441,7 @@ func TestHandleConnectionRejectsStaleDownlinkAckSequence(t *testing.T) {
 		Payload:   &ingressv1.RawPayload{Body: []byte(`{"sampling":"5s"}`)},
 	}}
 	a := newTestAdapter(core)
+	runWatcher(t, a)
 	conn, codec, key, clientPubKey, serverPubKey, serverTS := startPipeSession(t, a)
 	defer conn.Close()
 
@@ -433,7 +491,6 @@ func TestHandleConnectionRejectsAuthWithoutHandshakeHMAC(t *testing.T) {
 
 func TestHandleConnectionIdleTimeoutClosesBlockedConnection(t *testing.T) {
 	core := newFakeCore()
-	core.blockPull = make(chan struct{})
 	a := New(config.CustomTCPConfig{Enabled: true, ReadTimeout: time.Second, IdleTimeout: 50 * time.Millisecond, RPCTimeout: 500 * time.Millisecond, RegisterAckGraceDelay: time.Millisecond, DownlinkMaxBatch: 1}, slog.New(slog.NewTextHandler(io.Discard, nil)), WithCoreClient(core), WithNormalizer(normalizer.New("ingress-test")))
 	conn, codec, key, clientPubKey, serverPubKey, serverTS := startPipeSession(t, a)
 	defer conn.Close()
@@ -30,13 +30,16 @@ type session struct {
 	mu            sync.Mutex
 	inflight      *adapter.AdapterCommand
 	inflightSeq   uint64
+	pending       []adapter.AdapterCommand
+	closed        bool
+	wake          chan struct{}
 	clientPubKey  []byte
 	serverPubKey  []byte
 	handshakeTS   int64
 }
 
 func newSession(a *Adapter, logger *slog.Logger, conn net.Conn) *session {
-	return &session{adapter: a, logger: logger, conn: conn}
+	return &session{adapter: a, logger: logger, conn: conn, wake: make(chan struct{}, 1)}
 }
 
 func (s *session) IsAuthenticated() bool { return s.authenticated }
@@ -246,30 +249,34 @@ func (s *session) HandleDownlinkAck(ctx context.Context, cmd gosterwy.CmdID, pac
 	}
 }
 
-func (s *session) PopCommand(ctx context.Context) (adapter.AdapterCommand, bool) {
-	if !s.authenticated || s.adapter.core == nil || s.adapter.normalizer == nil || s.hasInflight() {
-		return adapter.AdapterCommand{}, false
-	}
-	rpcCtx, cancel := s.rpcContext(ctx)
-	defer cancel()
-	resp, err := s.adapter.core.PullCommands(rpcCtx, &ingressv1.PullCommandsRequest{
-		Context:         s.adapter.ingressContext(s.conn, nil, s),
-		Uuid:            s.uuid,
-		PrimaryIdentity: &ingressv1.DeviceIdentity{Type: s.identity.Type, Value: s.identity.Value, Issuer: s.identity.Issuer},
-		MaxCount:        1,
-	})
-	if err != nil {
-		s.logger.Warn("拉取下行消息失败", "uuid", s.uuid, "error", err)
-		return adapter.AdapterCommand{}, false
+// pushCommand 缓存推送流送达的下行命令并唤醒连接循环；会话已关闭时返回 false，由调用方回队。
+func (s *session) pushCommand(cmd adapter.AdapterCommand) bool {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return false
 	}
-	if len(resp.GetCommands()) == 0 {
-		return adapter.AdapterCommand{}, false
+	s.pending = append(s.pending, cmd)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
 	}
-	cmd, err := s.adapter.normalizer.NormalizeCommand(rpcCtx, resp.GetCommands()[0])
-	if err != nil {
-		s.logger.Warn("归一化下行命令失败", "uuid", s.uuid, "error", err)
+	return true
+}
+
+// Wake 在有新的下行命令缓存时发出信号。
+func (s *session) Wake() <-chan struct{} { return s.wake }
+
+// PopCommand 取出下一条待发送命令；上一条命令未确认前不会下发新命令。
+func (s *session) PopCommand() (adapter.AdapterCommand, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.authenticated || s.inflight != nil || len(s.pending) == 0 {
 		return adapter.AdapterCommand{}, false
 	}
+	cmd := s.pending[0]
+	s.pending = s.pending[1:]
 	return cmd, true
 }
 
@@ -359,7 +366,20 @@ func (s *session) RequeueDownlink(ctx context.Context, msg adapter.AdapterComman
 	}
 }
 
-func (s *session) RequeueInflight(ctx context.Context) {
+// Close 在连接结束时注销会话，并把尚未确认的命令回队。
+// core-api 回队时插入队首，因此按倒序回填缓存命令、最后回填已发送未确认的命令，保持原有下发顺序。
+func (s *session) Close(ctx context.Context) {
+	if s.authenticated {
+		s.adapter.detachSession(s)
+	}
+	s.mu.Lock()
+	s.closed = true
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	for i := len(pending) - 1; i >= 0; i-- {
+		s.RequeueDownlink(ctx, pending[i], nil)
+	}
 	msg, ok := s.takeInflight()
 	if !ok {
 		return
@@ -403,12 +423,6 @@ func (s *session) rpcContext(ctx context.Context) (context.Context, context.Canc
 	return context.WithTimeout(ctx, timeout)
 }
 
-func (s *session) hasInflight() bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.inflight != nil
-}
-
 func (s *session) clearInflightByCommandID(commandID int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -497,8 +511,11 @@ func (s *session) bindDevice(uuid string, tenantID string, identity adapter.Iden
 		identity = adapter.Identity{Type: "uuid", Value: uuid}
 	}
 	s.identity = identity
-	s.authenticated = true
 	s.logger = s.logger.With("uuid", uuid)
+	s.mu.Lock()
+	s.authenticated = true
+	s.mu.Unlock()
+	s.adapter.attachSession(s)
 }
 
 func commandTargetIdentity(msg adapter.AdapterCommand) *ingressv1.DeviceIdentity {
@@ -12,6 +12,7 @@ import (
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
 	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/adapter"
+	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/commandwatch"
 	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/config"
 	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/coreclient"
 	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/normalizer"
@@ -27,6 +28,7 @@ type Adapter struct {
 	mapper         *Mapper
 	deviceMu       sync.Mutex
 	devices        map[string]deviceSession
+	watcher        *commandwatch.Watcher
 }
 
 type Option func(*Adapter)
@@ -164,7 +166,7 @@ func (a *Adapter) startExternalClient(ctx context.Context) error {
 	}
 	defer client.Disconnect(250)
 	if a.cfg.DownlinkEnabled {
-		go a.runDownlinkLoop(ctx, pahoDownlinkPublisher{client: client, timeout: a.cfg.RPCTimeout})
+		a.startDownlinkWatch(ctx, pahoDownlinkPublisher{client: client, timeout: a.cfg.RPCTimeout})
 	}
 
 	a.logger.Info("mqtt adapter 已启动", "broker", a.cfg.BrokerURL, "client_id", a.cfg.ClientID)
@@ -182,6 +184,9 @@ func (a *Adapter) startExternalClient(ctx context.Context) error {
 
 func (a *Adapter) handleMessage(ctx context.Context, msg InboundMessage) error {
 	mapped, err := a.mapper.Map(msg)
+	if errors.Is(err, errSkipMessage) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -354,18 +359,48 @@ func (a *Adapter) rememberDevice(event adapter.AdapterEvent) {
 	if uuid == "" {
 		return
 	}
-	identity := event.Identity
-	if identity.Value == "" {
-		identity = adapter.Identity{Type: "uuid", Value: uuid}
+	primary := event.Identity
+	if primary.Value == "" {
+		primary = adapter.Identity{Type: "uuid", Value: uuid}
 	}
 	a.deviceMu.Lock()
-	defer a.deviceMu.Unlock()
 	a.devices[uuid] = deviceSession{
 		UUID:     uuid,
 		TenantID: event.TenantID,
-		Identity: identity,
+		Identity: primary,
 		LastSeen: time.Now().UTC(),
 	}
+	watcher := a.watcher
+	a.deviceMu.Unlock()
+	if watcher != nil {
+		watcher.Track(uuid, identity(primary))
+	}
+}
+
+// reportDisconnect 在连接断开时立即上报离线 availability 事件，并取消该设备的下行订阅。
+func (a *Adapter) reportDisconnect(ctx context.Context, session embeddedClientSession) error {
+	uuid := strings.TrimSpace(session.UUID)
+	if uuid == "" {
+		return nil
+	}
+	a.forgetDevice(uuid)
+	return a.ingestEvent(ctx, adapter.AdapterEvent{
+		AdapterName:  a.Name(),
+		ProtocolName: "mqtt",
+		Transport:    "mqtt",
+		RemoteAddr:   session.Remote,
+		TenantHint:   session.TenantID,
+		TenantID:     session.TenantID,
+		Identity:     adapter.Identity{Type: "uuid", Value: uuid},
+		UUID:         uuid,
+		Kind:         "availability",
+		Availability: "offline",
+		Labels: map[string]string{
+			"adapter_protocol":    "mqtt",
+			"mqtt_client_id":      session.ClientID,
+			"availability_reason": "mqtt_disconnect",
+		},
+	})
 }
 
 type downlinkPublisher interface {
@@ -389,78 +424,122 @@ func (p pahoDownlinkPublisher) Publish(_ context.Context, topic string, qos byte
 	return token.Error()
 }
 
-func (a *Adapter) runDownlinkLoop(ctx context.Context, publisher downlinkPublisher) {
-	interval := a.cfg.DownlinkPollInterval
-	if interval <= 0 {
-		interval = 2 * time.Second
+// startDownlinkWatch 订阅 core-api 的下行推送；此前已记住的设备立即加入订阅集合。
+func (a *Adapter) startDownlinkWatch(ctx context.Context, publisher downlinkPublisher) {
+	watcher := commandwatch.New(a.core, a.logger, commandwatch.Options{
+		Context:       func() *ingressv1.IngressContext { return a.ingressContextForDevice(deviceSession{}) },
+		MaxBatch:      a.cfg.DownlinkMaxBatch,
+		RetryInterval: a.cfg.DownlinkPollInterval,
+	}, func(ctx context.Context, cmd *ingressv1.CanonicalCommand) {
+		a.deliverDownlink(ctx, publisher, cmd)
+	})
+	a.deviceMu.Lock()
+	a.watcher = watcher
+	for _, dev := range a.devices {
+		watcher.Track(dev.UUID, identity(dev.Identity))
 	}
-	ticker := time.NewTicker(interval)
+	a.deviceMu.Unlock()
+	go watcher.Run(ctx)
+	go a.runDeviceExpiry(ctx)
+}
+
+// runDeviceExpiry 定期清理超过 DownlinkDeviceTTL 未活跃的设备，并取消其下行订阅。
+func (a *Adapter) runDeviceExpiry(ctx context.Context) {
+	ticker := time.NewTicker(a.downlinkDeviceTTL() / 2)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			for _, dev := range a.deviceSnapshot() {
-				if err := a.pullAndPublishDownlinks(ctx, publisher, dev); err != nil {
-					a.logger.Warn("mqtt 下行轮询失败", "uuid", dev.UUID, "error", err)
-				}
-			}
+			a.expireDevices(time.Now().UTC())
 		}
 	}
 }
 
-func (a *Adapter) deviceSnapshot() []deviceSession {
-	now := time.Now().UTC()
-	ttl := a.cfg.DownlinkDeviceTTL
-	if ttl <= 0 {
-		ttl = 10 * time.Minute
-	}
+func (a *Adapter) expireDevices(now time.Time) {
+	ttl := a.downlinkDeviceTTL()
 	a.deviceMu.Lock()
-	defer a.deviceMu.Unlock()
-	out := make([]deviceSession, 0, len(a.devices))
+	expired := make([]string, 0)
 	for uuid, dev := range a.devices {
 		if now.Sub(dev.LastSeen) > ttl {
-			delete(a.devices, uuid)
-			continue
+			expired = append(expired, uuid)
 		}
-		out = append(out, dev)
 	}
-	return out
+	a.deviceMu.Unlock()
+	for _, uuid := range expired {
+		a.forgetDevice(uuid)
+	}
 }
 
-func (a *Adapter) pullAndPublishDownlinks(ctx context.Context, publisher downlinkPublisher, dev deviceSession) error {
-	if dev.UUID == "" {
-		return nil
+func (a *Adapter) forgetDevice(uuid string) {
+	a.deviceMu.Lock()
+	delete(a.devices, uuid)
+	watcher := a.watcher
+	a.deviceMu.Unlock()
+	if watcher != nil {
+		watcher.Untrack(uuid)
 	}
-	rpcCtx, cancel := a.rpcContext(ctx)
-	defer cancel()
-	resp, err := a.core.PullCommands(rpcCtx, &ingressv1.PullCommandsRequest{
-		Context:         a.ingressContextForDevice(dev),
-		Uuid:            dev.UUID,
-		PrimaryIdentity: identity(dev.Identity),
-		MaxCount:        int32(a.cfg.DownlinkMaxBatch),
-	})
+}
+
+func (a *Adapter) downlinkDeviceTTL() time.Duration {
+	if a.cfg.DownlinkDeviceTTL <= 0 {
+		return 10 * time.Minute
+	}
+	return a.cfg.DownlinkDeviceTTL
+}
+
+func (a *Adapter) lookupDevice(uuid string) (deviceSession, bool) {
+	a.deviceMu.Lock()
+	defer a.deviceMu.Unlock()
+	dev, ok := a.devices[strings.TrimSpace(uuid)]
+	return dev, ok
+}
+
+// deliverDownlink 发布一条推送来的下行命令；设备已离开本实例时把命令放回队列等待其重新连接。
+func (a *Adapter) deliverDownlink(ctx context.Context, publisher downlinkPublisher, raw *ingressv1.CanonicalCommand) {
+	dev, ok := a.lookupDevice(raw.GetUuid())
+	if !ok {
+		a.requeueCommand(ctx, raw)
+		return
+	}
+	cmd, err := a.normalizer.NormalizeCommand(ctx, raw)
 	if err != nil {
-		return err
+		a.logger.Warn("mqtt 下行命令归一化失败", "uuid", dev.UUID, "command_id", raw.GetCommandId(), "error", err)
+		a.markCommandFailed(ctx, dev, adapter.AdapterCommand{CommandID: raw.GetCommandId(), CommandUUID: raw.GetCommandUuid(), UUID: raw.GetUuid(), Operation: raw.GetOperation()}, err)
+		return
 	}
-	for _, rawCmd := range resp.GetCommands() {
-		cmd, err := a.normalizer.NormalizeCommand(ctx, rawCmd)
-		if err != nil {
-			a.logger.Warn("mqtt 下行命令归一化失败", "uuid", dev.UUID, "command_id", rawCmd.GetCommandId(), "error", err)
-			continue
-		}
-		if err := a.publishDownlink(ctx, publisher, dev, cmd); err != nil {
-			a.markCommandFailed(ctx, dev, cmd, err)
-			continue
-		}
-		a.markCommandSent(ctx, dev, cmd)
+	if err := a.publishDownlink(ctx, publisher, dev, cmd); err != nil {
+		a.markCommandFailed(ctx, dev, cmd, err)
+		return
+	}
+	a.markCommandSent(ctx, dev, cmd)
+}
+
+func (a *Adapter) requeueCommand(ctx context.Context, raw *ingressv1.CanonicalCommand) {
+	rpcCtx, cancel := a.rpcContext(ctx)
+	defer cancel()
+	if _, err := a.core.UpdateCommandStatus(rpcCtx, &ingressv1.UpdateCommandStatusRequest{
+		Context:             a.ingressContextForDevice(deviceSession{TenantID: raw.GetTenantId()}),
+		CommandId:           raw.GetCommandId(),
+		CommandUuid:         raw.GetCommandUuid(),
+		Status:              ingressv1.CommandStatus_COMMAND_STATUS_REQUEUED,
+		ProtocolCommandCode: raw.GetProtocolCommandCode(),
+		ObservedAt:          timestamppb.Now(),
+		Uuid:                raw.GetUuid(),
+		TargetIdentity:      raw.GetTargetIdentity(),
+		Command:             raw,
+		Operation:           raw.GetOperation(),
+	}); err != nil {
+		a.logger.Warn("mqtt 下行回队状态回填失败", "uuid", raw.GetUuid(), "command_id", raw.GetCommandId(), "error", err)
 	}
-	return nil
 }
 
 func (a *Adapter) publishDownlink(ctx context.Context, publisher downlinkPublisher, dev deviceSession, cmd adapter.AdapterCommand) error {
-	topic := renderDownlinkTopic(a.cfg.DownlinkTopic, dev, cmd)
+	topic := zigbee2MQTTSetTopic(a.cfg.Zigbee2MQTTBaseTopic, cmd)
+	if topic == "" {
+		topic = renderDownlinkTopic(a.cfg.DownlinkTopic, dev, cmd)
+	}
 	if topic == "" {
 		return errors.New("mqtt 下行 topic 为空")
 	}
@@ -610,6 +689,18 @@ func renderDownlinkTopic(tmpl string, dev deviceSession, cmd adapter.AdapterComm
 	return strings.Trim(out, "/")
 }
 
+// zigbee2MQTTSetTopic 为指向 zigbee2mqtt 设备的命令生成 `{base}/{friendly_name}/set`，其余命令返回空串。
+func zigbee2MQTTSetTopic(base string, cmd adapter.AdapterCommand) string {
+	if cmd.Target.Type != "zigbee2mqtt_friendly_name" || strings.TrimSpace(cmd.Target.Value) == "" {
+		return ""
+	}
+	base = strings.Trim(base, "/")
+	if base == "" {
+		base = "zigbee2mqtt"
+	}
+	return base + "/" + strings.TrimSpace(cmd.Target.Value) + "/set"
+}
+
 func commandTargetIdentity(cmd adapter.AdapterCommand, dev deviceSession) *ingressv1.DeviceIdentity {
 	if cmd.Target.Type != "" || cmd.Target.Value != "" {
 		return &ingressv1.DeviceIdentity{Type: cmd.Target.Type, Value: cmd.Target.Value, Issuer: cmd.Target.Issuer}
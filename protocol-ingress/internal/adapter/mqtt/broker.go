@@ -24,6 +24,8 @@ type embeddedClientSession struct {
 	Remote    string
 	CreatedAt time.Time
 	LastSeen  time.Time
+
+	client *mqttserver.Client // 建立该会话的连接，用于识别同 client id 重连后旧连接的断开
 }
 
 type embeddedBrokerHook struct {
@@ -59,7 +61,7 @@ func (a *Adapter) startEmbeddedBroker(ctx context.Context) error {
 	defer broker.Close()
 
 	if a.cfg.DownlinkEnabled {
-		go a.runDownlinkLoop(ctx, embeddedDownlinkPublisher{server: broker})
+		a.startDownlinkWatch(ctx, embeddedDownlinkPublisher{server: broker})
 	}
 
 	a.logger.Info("mqtt embedded broker 已启动", "addr", tcp.Address(), "auth_mode", a.cfg.AuthMode)
@@ -115,6 +117,7 @@ func (h *embeddedBrokerHook) OnConnectAuthenticate(cl *mqttserver.Client, pk pac
 	if !ok {
 		return false
 	}
+	session.client = cl
 	h.sessions.Store(clientID, session)
 	h.logInfo("mqtt connect 鉴权成功", clientID, username, session.UUID, session.TenantID)
 	return true
@@ -257,9 +260,28 @@ func (h *embeddedBrokerHook) OnPublish(cl *mqttserver.Client, pk packets.Packet)
 
 func (h *embeddedBrokerHook) OnDisconnect(cl *mqttserver.Client, _ error, _ bool) {
 	id := clientID(cl)
-	if id != "" {
-		h.sessions.Delete(id)
+	if id == "" {
+		return
+	}
+	value, ok := h.sessions.Load(id)
+	if !ok {
+		return
 	}
+	session, ok := value.(embeddedClientSession)
+	if !ok || (session.client != nil && session.client != cl) {
+		// 同 client id 的新连接已接管会话，旧连接断开不代表设备离线。
+		return
+	}
+	h.sessions.CompareAndDelete(id, value)
+	if session.UUID == "" {
+		return
+	}
+	// OnDisconnect 在 broker 的连接协程里同步调用，上报放到独立协程，避免 RPC 超时拖住 broker。
+	go func() {
+		if err := h.adapter.reportDisconnect(context.Background(), session); err != nil {
+			h.logWarn("mqtt 断开连接离线上报失败", session.ClientID, session.Username, session.UUID, err.Error())
+		}
+	}()
 }
 
 func (h *embeddedBrokerHook) sessionForClient(cl *mqttserver.Client) (embeddedClientSession, bool) {
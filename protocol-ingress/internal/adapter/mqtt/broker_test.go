@@ -75,23 +75,49 @@ func (f *embeddedBrokerFakeCore) PullCommands(context.Context, *ingressv1.PullCo
 	return &ingressv1.PullCommandsResponse{}, nil
 }
 
+func (f *embeddedBrokerFakeCore) WatchCommands(ctx context.Context, _ *ingressv1.WatchCommandsRequest, _ func(*ingressv1.WatchCommandsResponse) error) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
 func (f *embeddedBrokerFakeCore) UpdateCommandStatus(context.Context, *ingressv1.UpdateCommandStatusRequest) (*ingressv1.UpdateCommandStatusResponse, error) {
 	return &ingressv1.UpdateCommandStatusResponse{}, nil
 }
 
+// eventCount 只统计设备上行事件；连接断开产生的 availability 事件由 availabilityEvents 单独返回。
 func (f *embeddedBrokerFakeCore) eventCount() int {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	return len(f.events)
+	count := 0
+	for _, event := range f.events {
+		if event.GetEventType() != ingressv1.EventType_EVENT_TYPE_AVAILABILITY {
+			count++
+		}
+	}
+	return count
 }
 
 func (f *embeddedBrokerFakeCore) lastEvent() *ingressv1.CanonicalDeviceEvent {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	if len(f.events) == 0 {
-		return nil
+	for i := len(f.events) - 1; i >= 0; i-- {
+		if f.events[i].GetEventType() != ingressv1.EventType_EVENT_TYPE_AVAILABILITY {
+			return f.events[i]
+		}
 	}
-	return f.events[len(f.events)-1]
+	return nil
+}
+
+func (f *embeddedBrokerFakeCore) availabilityEvents() []*ingressv1.CanonicalDeviceEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]*ingressv1.CanonicalDeviceEvent, 0)
+	for _, event := range f.events {
+		if event.GetEventType() == ingressv1.EventType_EVENT_TYPE_AVAILABILITY {
+			out = append(out, event)
+		}
+	}
+	return out
 }
 
 func TestEmbeddedBrokerAuthenticatesWithClientIDAndPasswordToken(t *testing.T) {
@@ -169,6 +195,41 @@ func TestEmbeddedBrokerAuthenticatesWithClientIDAndPasswordToken(t *testing.T) {
 	}
 }
 
+func TestEmbeddedBrokerReportsOfflineOnDisconnect(t *testing.T) {
+	addr := freeTCPAddr(t)
+	core := newEmbeddedBrokerFakeCore()
+	cfg := config.Default().Adapters.MQTT
+	cfg.Enabled = true
+	cfg.Mode = "embedded"
+	cfg.ListenAddr = addr
+	cfg.DownlinkEnabled = false
+	cfg.MessageBuffer = 16
+	cfg.RPCTimeout = time.Second
+
+	adapter := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithCoreClient(core),
+		WithNormalizer(normalizer.New("embedded-broker-test")),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = adapter.Start(ctx) }()
+
+	client := connectEmbeddedMQTT(t, addr, "dev-1", "token-dev-1")
+	client.Disconnect(100)
+
+	waitUntil(t, 2*time.Second, func() bool { return len(core.availabilityEvents()) == 1 })
+	event := core.availabilityEvents()[0]
+	if event.GetAvailability() != ingressv1.DeviceAvailability_DEVICE_AVAILABILITY_OFFLINE {
+		t.Fatalf("expected offline availability event, got type=%v availability=%v", event.GetEventType(), event.GetAvailability())
+	}
+	if event.GetDevice().GetUuid() != "dev-1" || event.GetContext().GetTenantId() != "tenant-a" {
+		t.Fatalf("unexpected event identity: uuid=%q tenant=%q", event.GetDevice().GetUuid(), event.GetContext().GetTenantId())
+	}
+	if got := event.GetContext().GetLabels()["availability_reason"]; got != "mqtt_disconnect" {
+		t.Fatalf("expected mqtt_disconnect reason, got %q", got)
+	}
+}
+
 func connectEmbeddedMQTT(t *testing.T, addr, clientID, password string) paho.Client {
 	t.Helper()
 	deadline := time.Now().Add(2 * time.Second)
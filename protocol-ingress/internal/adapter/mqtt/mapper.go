@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"strconv"
@@ -29,6 +30,10 @@ type InboundMessage struct {
 	LocalAddr  string
 }
 
+// errSkipMessage 表示消息不是设备上报、应直接丢弃，例如本 adapter 自己发布到 zigbee2mqtt 的命令。
+// 调用方遇到它时静默跳过，不按处理失败记录日志。
+var errSkipMessage = errors.New("mqtt 消息无需处理")
+
 type MappedMessage struct {
 	Event adapter.AdapterEvent
 	Token string
@@ -88,10 +93,12 @@ func (m *Mapper) mapGoster(rest []string, topic string, raw []byte, contentType
 	event.Identity = adapter.Identity{Type: "uuid", Value: uuid}
 	event.Identities = []adapter.Identity{{Type: "uuid", Value: uuid}}
 	event.Device = &adapter.DeviceDescriptor{
-		UUID:       uuid,
-		Name:       firstNonEmpty(stringValue(payload, "name", "device_name"), uuid),
-		DeviceType: firstNonEmpty(stringValue(payload, "device_type", "type"), "mqtt_device"),
-		Labels:     map[string]string{"adapter_protocol": "mqtt", "mqtt_topic": topic},
+		UUID:           uuid,
+		Name:           firstNonEmpty(stringValue(payload, "name", "device_name"), uuid),
+		DeviceType:     firstNonEmpty(stringValue(payload, "device_type", "type"), "mqtt_device"),
+		NetworkAddress: stringValue(payload, "network_address"),
+		ParentUUID:     stringValue(payload, "parent_uuid", "gateway_uuid"),
+		Labels:         map[string]string{"adapter_protocol": "mqtt", "mqtt_topic": topic},
 	}
 
 	switch normalizeKind(kind) {
@@ -115,6 +122,10 @@ func (m *Mapper) mapGoster(rest []string, topic string, raw []byte, contentType
 	case "state":
 		event.Kind = "state"
 		event.States = flatStates(payload, observedAt)
+	case "topology":
+		// 网关上报直连子设备的完整快照：{"children":[{"uuid":...,"device_type":...,"network_address":...}]}。
+		event.Kind = "topology"
+		event.Children = topologyChildren(payload["children"])
 	case "telemetry":
 		event.Kind = "telemetry"
 		event.Metrics = append(metricArray(payload, observedAt), flatMetrics(payload, observedAt)...)
@@ -137,6 +148,9 @@ func (m *Mapper) mapZigbee2MQTT(rest []string, topic string, raw []byte, content
 		return MappedMessage{}, fmt.Errorf("zigbee2mqtt topic 缺少 friendly_name")
 	}
 	if rest[0] == "bridge" {
+		if len(rest) == 2 && rest[1] == "devices" {
+			return m.mapZigbee2MQTTDevices(topic, raw, contentType, msg, receivedAt)
+		}
 		return MappedMessage{}, fmt.Errorf("zigbee2mqtt bridge topic 暂不作为设备遥测处理")
 	}
 	friendly := rest[0]
@@ -144,6 +158,10 @@ func (m *Mapper) mapZigbee2MQTT(rest []string, topic string, raw []byte, content
 	if len(rest) > 1 {
 		subtopic = strings.Join(rest[1:], "/")
 	}
+	// {friendly}/set 与 {friendly}/get 是发给 zigbee2mqtt 的命令，包括本 adapter 自己发布的下行，不能当作上报。
+	if len(rest) > 1 && (rest[1] == "set" || rest[1] == "get") {
+		return MappedMessage{}, errSkipMessage
+	}
 	observedAt := observedTime(payload, receivedAt)
 	uuid := externalUUID("zigbee2mqtt", friendly)
 
@@ -190,6 +208,166 @@ func (m *Mapper) mapZigbee2MQTT(rest []string, topic string, raw []byte, content
 	return MappedMessage{Event: event}, nil
 }
 
+// mapZigbee2MQTTDevices 把 bridge/devices 的设备清单转换成以协调器为网关的拓扑快照。
+// zigbee2mqtt 不公开 mesh 内的路由关系，因此所有已入网设备都挂在协调器下。
+func (m *Mapper) mapZigbee2MQTTDevices(topic string, raw []byte, contentType string, msg InboundMessage, receivedAt time.Time) (MappedMessage, error) {
+	var items []map[string]any
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	if err := dec.Decode(&items); err != nil {
+		return MappedMessage{}, fmt.Errorf("解析 zigbee2mqtt 设备清单失败: %w", err)
+	}
+
+	var coordinator map[string]any
+	children := make([]adapter.DeviceDescriptor, 0, len(items))
+	for _, item := range items {
+		if strings.EqualFold(stringValue(item, "type"), "coordinator") {
+			coordinator = item
+			continue
+		}
+		if child, ok := zigbee2MQTTNode(item); ok {
+			children = append(children, child)
+		}
+	}
+	if coordinator == nil {
+		return MappedMessage{}, fmt.Errorf("zigbee2mqtt 设备清单缺少 Coordinator")
+	}
+	gateway, ok := zigbee2MQTTNode(coordinator)
+	if !ok {
+		gateway, _ = zigbee2MQTTNode(map[string]any{"friendly_name": "Coordinator", "type": "Coordinator"})
+	}
+
+	event := baseEvent("zigbee2mqtt", topic, raw, contentType, msg, receivedAt)
+	event.ProtocolName = "zigbee2mqtt"
+	event.ProtocolVersion = "mqtt"
+	event.Transport = "mqtt"
+	event.Kind = "topology"
+	event.UUID = gateway.UUID
+	event.Identity = gateway.Identities[0]
+	event.Identities = []adapter.Identity{gateway.Identities[0], {Type: "mqtt_topic", Value: topic}}
+	gateway.Labels = map[string]string{"adapter_protocol": "zigbee2mqtt", "mqtt_topic": topic}
+	event.Device = &gateway
+	event.Children = children
+	return MappedMessage{Event: event}, nil
+}
+
+// zigbee2MQTTNode 使用与设备遥测相同的 friendly_name 推导 UUID，保证拓扑节点与遥测事件对应同一设备。
+func zigbee2MQTTNode(item map[string]any) (adapter.DeviceDescriptor, bool) {
+	friendly := stringValue(item, "friendly_name")
+	if friendly == "" {
+		return adapter.DeviceDescriptor{}, false
+	}
+	node := adapter.DeviceDescriptor{
+		UUID:       externalUUID("zigbee2mqtt", friendly),
+		Name:       friendly,
+		DeviceType: strings.ToLower(firstNonEmpty(stringValue(item, "type"), "zigbee_node")),
+		Identities: []adapter.Identity{{Type: "zigbee2mqtt_friendly_name", Value: friendly}},
+	}
+	if n, ok := numberValue(item, "network_address"); ok && n >= 0 {
+		node.NetworkAddress = fmt.Sprintf("0x%04x", int64(n))
+	}
+	if ieee := stringValue(item, "ieee_address"); ieee != "" {
+		node.Identities = append(node.Identities, adapter.Identity{Type: "zigbee2mqtt_ieee_address", Value: ieee})
+	}
+	if definition, ok := item["definition"].(map[string]any); ok {
+		node.Vendor = stringValue(definition, "vendor")
+		node.Model = stringValue(definition, "model")
+		node.Capabilities = zigbee2MQTTExposes(definition["exposes"])
+	}
+	return node, true
+}
+
+// zigbee2MQTT 的 access 是位标志：1 表示会在状态中发布，2 表示可 set，4 表示可 get。
+const (
+	zigbee2MQTTAccessState = 1
+	zigbee2MQTTAccessSet   = 2
+	zigbee2MQTTAccessGet   = 4
+)
+
+// zigbee2MQTTExposes 把 definition.exposes 转换成能力描述；light、switch 等特定类型的 features 保留为子能力。
+func zigbee2MQTTExposes(raw any) []adapter.Capability {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil
+	}
+	out := make([]adapter.Capability, 0, len(items))
+	for _, item := range items {
+		expose, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		capability := adapter.Capability{
+			Name:        stringValue(expose, "name"),
+			Property:    stringValue(expose, "property"),
+			Type:        stringValue(expose, "type"),
+			Unit:        stringValue(expose, "unit"),
+			ValueMin:    stringValue(expose, "value_min"),
+			ValueMax:    stringValue(expose, "value_max"),
+			Description: stringValue(expose, "description"),
+			Features:    zigbee2MQTTExposes(expose["features"]),
+		}
+		if access, ok := numberValue(expose, "access"); ok {
+			flags := int64(access)
+			capability.Access = strconv.FormatInt(flags, 10)
+			capability.Readable = flags&(zigbee2MQTTAccessState|zigbee2MQTTAccessGet) != 0
+			capability.Writable = flags&zigbee2MQTTAccessSet != 0
+		}
+		switch capability.Type {
+		case "enum":
+			capability.AllowedValues = stringList(expose["values"])
+		case "binary":
+			// binary 的取值由 value_on/value_off/value_toggle 决定，可能是 ON/OFF 也可能是 true/false。
+			for _, key := range []string{"value_on", "value_off", "value_toggle"} {
+				if v := stringValue(expose, key); v != "" {
+					capability.AllowedValues = append(capability.AllowedValues, v)
+				}
+			}
+		}
+		out = append(out, capability)
+	}
+	return out
+}
+
+func stringList(raw any) []string {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if v := stringValue(map[string]any{"v": item}, "v"); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// topologyChildren 解析 goster topology 消息中的 children 数组，缺少 uuid 的条目会被跳过。
+func topologyChildren(raw any) []adapter.DeviceDescriptor {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil
+	}
+	out := make([]adapter.DeviceDescriptor, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		uuid := stringValue(m, "uuid", "device_uuid")
+		if uuid == "" {
+			continue
+		}
+		out = append(out, adapter.DeviceDescriptor{
+			UUID:           uuid,
+			Name:           stringValue(m, "name", "device_name"),
+			DeviceType:     stringValue(m, "device_type", "type"),
+			NetworkAddress: stringValue(m, "network_address"),
+		})
+	}
+	return out
+}
+
 func baseEvent(source, topic string, raw []byte, contentType string, msg InboundMessage, receivedAt time.Time) adapter.AdapterEvent {
 	if source == "" {
 		source = "mqtt"
@@ -307,7 +485,7 @@ func metricArray(payload map[string]any, observedAt time.Time) []adapter.MetricP
 		if name == "" {
 			continue
 		}
-		n, ok := numberValue(m, "value", "number")
+		value, ok := metricValue(m)
 		if !ok {
 			continue
 		}
@@ -317,7 +495,7 @@ func metricArray(payload map[string]any, observedAt time.Time) []adapter.MetricP
 		}
 		out = append(out, adapter.MetricPoint{
 			Name:             name,
-			Value:            adapter.Value{Number: &n},
+			Value:            value,
 			Unit:             stringValue(m, "unit"),
 			ObservedAt:       observedTime(m, observedAt),
 			LegacyMetricType: legacy,
@@ -327,6 +505,20 @@ func metricArray(payload map[string]any, observedAt time.Time) []adapter.MetricP
 	return out
 }
 
+// metricValue 读取 metrics 数组元素的取值：数字（含数字字符串）优先，其次布尔与字符串。
+func metricValue(m map[string]any) (adapter.Value, bool) {
+	if n, ok := numberValue(m, "value", "number"); ok {
+		return adapter.Value{Number: &n}, true
+	}
+	switch x := m["value"].(type) {
+	case bool:
+		return adapter.Value{Bool: &x}, true
+	case string:
+		return adapter.Value{String: &x}, true
+	}
+	return adapter.Value{}, false
+}
+
 func flatStates(payload map[string]any, observedAt time.Time) []adapter.StatePoint {
 	if len(payload) == 0 {
 		return nil
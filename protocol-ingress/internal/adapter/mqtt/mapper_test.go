@@ -1,6 +1,10 @@
 package mqtt
 
 import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
 	"testing"
 	"time"
 
@@ -40,6 +44,28 @@ func TestMapperMapsGosterTelemetryTopic(t *testing.T) {
 	}
 }
 
+func TestMapperMapsNamedMetricArray(t *testing.T) {
+	mapper := NewMapper(config.Default().Adapters.MQTT)
+	out, err := mapper.Map(InboundMessage{
+		Topic:      "goster/v1/dev-1/telemetry",
+		Payload:    []byte(`{"metrics":[{"name":"co2","value":640,"unit":"ppm","tags":{"room":"lab"}},{"name":"window_open","value":true},{"name":"mode","value":"eco"},{"name":"color","value":{"r":1}}]}`),
+		ReceivedAt: time.Unix(1700000001, 0).UTC(),
+	})
+	if err != nil {
+		t.Fatalf("Map failed: %v", err)
+	}
+	metrics := out.Event.Metrics
+	if len(metrics) != 3 {
+		t.Fatalf("expected object value to be dropped, got %+v", metrics)
+	}
+	if metrics[0].Name != "co2" || *metrics[0].Value.Number != 640 || metrics[0].Unit != "ppm" || metrics[0].Tags["room"] != "lab" {
+		t.Fatalf("unexpected number metric: %+v", metrics[0])
+	}
+	if metrics[1].Value.Bool == nil || !*metrics[1].Value.Bool || metrics[2].Value.String == nil || *metrics[2].Value.String != "eco" {
+		t.Fatalf("unexpected bool/string metrics: %+v", metrics[1:])
+	}
+}
+
 func TestMapperMapsZigbee2MQTTStatePayload(t *testing.T) {
 	cfg := config.Default().Adapters.MQTT
 	mapper := NewMapper(cfg)
@@ -95,6 +121,28 @@ func TestRenderDownlinkTopic(t *testing.T) {
 	}
 }
 
+func TestZigbee2MQTTSetTopicForExternalCommand(t *testing.T) {
+	cmd := adapterCommand("ext_1", "tenant-a")
+	if got := zigbee2MQTTSetTopic("zigbee2mqtt", cmd); got != "" {
+		t.Fatalf("uuid command should keep goster downlink topic, got %s", got)
+	}
+	cmd.Target = adapter.Identity{Type: "zigbee2mqtt_friendly_name", Value: "living_plug"}
+	cmd.TargetEntityID = "living_plug.state"
+	if got := zigbee2MQTTSetTopic("z2m/", cmd); got != "z2m/living_plug/set" {
+		t.Fatalf("unexpected zigbee2mqtt topic: %s", got)
+	}
+
+	mapper := NewMapper(config.Default().Adapters.MQTT)
+	if _, err := mapper.Map(InboundMessage{Topic: "zigbee2mqtt/living_plug/set", Payload: []byte(`{"state":"ON"}`)}); !errors.Is(err, errSkipMessage) {
+		t.Fatalf("expected set topic to be skipped, got %v", err)
+	}
+	// 本 adapter 自己发布的下行会回流到订阅，处理时应静默丢弃而不是报错。
+	a := New(config.Default().Adapters.MQTT, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := a.handleMessage(context.Background(), InboundMessage{Topic: "zigbee2mqtt/living_plug/set", Payload: []byte(`{"state":"ON"}`)}); err != nil {
+		t.Fatalf("own set topic should be ignored silently, got %v", err)
+	}
+}
+
 func TestMapperSkipsZigbee2MQTTBridgeTopic(t *testing.T) {
 	mapper := NewMapper(config.Default().Adapters.MQTT)
 	_, err := mapper.Map(InboundMessage{Topic: "zigbee2mqtt/bridge/devices", Payload: []byte(`[]`)})
@@ -103,6 +151,93 @@ func TestMapperSkipsZigbee2MQTTBridgeTopic(t *testing.T) {
 	}
 }
 
+func TestMapperMapsTopologySnapshots(t *testing.T) {
+	mapper := NewMapper(config.Default().Adapters.MQTT)
+
+	out, err := mapper.Map(InboundMessage{
+		Topic:   "goster/v1/gw-1/topology",
+		Payload: []byte(`{"device_type":"gateway","children":[{"uuid":"node-1","device_type":"router","network_address":"0x01"},{"name":"no-uuid"}]}`),
+	})
+	if err != nil {
+		t.Fatalf("Map failed: %v", err)
+	}
+	if out.Event.Kind != "topology" || out.Event.UUID != "gw-1" || len(out.Event.Children) != 1 {
+		t.Fatalf("unexpected goster topology event: %+v", out.Event)
+	}
+	if child := out.Event.Children[0]; child.UUID != "node-1" || child.DeviceType != "router" || child.NetworkAddress != "0x01" {
+		t.Fatalf("unexpected goster child: %+v", child)
+	}
+
+	sub, err := mapper.Map(InboundMessage{Topic: "goster/v1/node-1/telemetry", Payload: []byte(`{"temperature":20,"parent_uuid":"gw-1"}`)})
+	if err != nil || sub.Event.Device.ParentUUID != "gw-1" {
+		t.Fatalf("expected parent uuid from payload, got %+v err=%v", sub.Event.Device, err)
+	}
+
+	devices, err := mapper.Map(InboundMessage{
+		Topic: "zigbee2mqtt/bridge/devices",
+		Payload: []byte(`[
+			{"ieee_address":"0x00124b0000000001","type":"Coordinator","network_address":0,"friendly_name":"Coordinator"},
+			{"ieee_address":"0x00124b0000000002","type":"Router","network_address":6540,"friendly_name":"living_plug","definition":{"vendor":"IKEA","model":"E1603"}},
+			{"ieee_address":"0x00124b0000000003","type":"EndDevice","network_address":1234}
+		]`),
+	})
+	if err != nil {
+		t.Fatalf("Map bridge/devices failed: %v", err)
+	}
+	event := devices.Event
+	if event.Kind != "topology" || event.UUID != externalUUID("zigbee2mqtt", "Coordinator") || event.Device.DeviceType != "coordinator" {
+		t.Fatalf("unexpected zigbee topology gateway: %+v", event)
+	}
+	if len(event.Children) != 1 {
+		t.Fatalf("devices without friendly_name should be skipped, got %+v", event.Children)
+	}
+	child := event.Children[0]
+	if child.UUID != externalUUID("zigbee2mqtt", "living_plug") || child.DeviceType != "router" || child.NetworkAddress != "0x198c" || child.Vendor != "IKEA" {
+		t.Fatalf("unexpected zigbee child: %+v", child)
+	}
+	if len(child.Identities) != 2 || child.Identities[1].Value != "0x00124b0000000002" {
+		t.Fatalf("expected ieee identity, got %+v", child.Identities)
+	}
+}
+
+func TestMapperConvertsZigbee2MQTTDefinitionExposesToCapabilities(t *testing.T) {
+	mapper := NewMapper(config.Default().Adapters.MQTT)
+	devices, err := mapper.Map(InboundMessage{
+		Topic: "zigbee2mqtt/bridge/devices",
+		Payload: []byte(`[
+			{"ieee_address":"0x00124b0000000001","type":"Coordinator","friendly_name":"Coordinator"},
+			{"ieee_address":"0x00124b0000000004","type":"Router","friendly_name":"kitchen_bulb","definition":{"vendor":"IKEA","model":"LED1545G12","exposes":[
+				{"type":"light","features":[
+					{"type":"binary","name":"state","property":"state","access":7,"value_on":"ON","value_off":"OFF","value_toggle":"TOGGLE"},
+					{"type":"numeric","name":"brightness","property":"brightness","access":7,"value_min":0,"value_max":254}
+				]},
+				{"type":"enum","name":"effect","property":"effect","access":2,"values":["blink","breathe"]},
+				{"type":"numeric","name":"linkquality","property":"linkquality","access":1,"unit":"lqi"}
+			]}}
+		]`),
+	})
+	if err != nil {
+		t.Fatalf("Map bridge/devices failed: %v", err)
+	}
+	caps := devices.Event.Children[0].Capabilities
+	if len(caps) != 3 || caps[0].Type != "light" || len(caps[0].Features) != 2 {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+	state, brightness := caps[0].Features[0], caps[0].Features[1]
+	if !state.Writable || !state.Readable || state.Access != "7" || len(state.AllowedValues) != 3 || state.AllowedValues[0] != "ON" {
+		t.Fatalf("unexpected binary capability: %+v", state)
+	}
+	if brightness.ValueMin != "0" || brightness.ValueMax != "254" {
+		t.Fatalf("unexpected numeric range: %+v", brightness)
+	}
+	if effect := caps[1]; !effect.Writable || effect.Readable || len(effect.AllowedValues) != 2 {
+		t.Fatalf("unexpected enum capability: %+v", effect)
+	}
+	if lqi := caps[2]; lqi.Writable || lqi.Unit != "lqi" {
+		t.Fatalf("read-only capability should not be writable: %+v", lqi)
+	}
+}
+
 func TestMapperMapsOfficialZigbee2MQTTExposes(t *testing.T) {
 	mapper := NewMapper(config.Default().Adapters.MQTT)
 	cases := []struct {
@@ -0,0 +1,218 @@
+package commandwatch
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/coreclient"
+	"google.golang.org/protobuf/proto"
+)
+
+// Handler 处理 core-api 推送的一条下行命令。Handler 返回后该命令即视为已处理，
+// 发送结果需要由 adapter 通过 UpdateCommandStatus 回填。
+type Handler func(ctx context.Context, cmd *ingressv1.CanonicalCommand)
+
+// Options 描述推送流的订阅参数。
+type Options struct {
+	// Context 在每次建立推送流时调用，用于生成 source_instance/adapter_id 等上下文。
+	Context func() *ingressv1.IngressContext
+	// MaxBatch 是单个推送批次的最大命令数。
+	MaxBatch int
+	// RetryInterval 是推送流异常断开后的重连间隔。
+	RetryInterval time.Duration
+	// ResubscribeDelay 用于合并短时间内的多次设备变化，避免频繁重建推送流。
+	ResubscribeDelay time.Duration
+}
+
+// Watcher 维护 adapter 当前连接设备的订阅集合，并保持一条到 core-api 的 WatchCommands 推送流。
+// 设备集合变化时携带最近处理完的游标重新订阅，core-api 会补发游标之后未确认的命令。
+type Watcher struct {
+	core    coreclient.Client
+	logger  *slog.Logger
+	opts    Options
+	handle  Handler
+	changed chan struct{}
+
+	mu      sync.Mutex
+	targets map[string]*ingressv1.CommandSubscription
+	cursor  int64
+}
+
+// New 创建推送流订阅器；调用 Run 后开始工作。
+func New(core coreclient.Client, logger *slog.Logger, opts Options, handle Handler) *Watcher {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = 1
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 2 * time.Second
+	}
+	if opts.ResubscribeDelay <= 0 {
+		opts.ResubscribeDelay = 100 * time.Millisecond
+	}
+	return &Watcher{
+		core:    core,
+		logger:  logger,
+		opts:    opts,
+		handle:  handle,
+		changed: make(chan struct{}, 1),
+		targets: make(map[string]*ingressv1.CommandSubscription),
+	}
+}
+
+// Track 把设备加入订阅集合；设备已订阅且身份未变时不会触发重新订阅。
+func (w *Watcher) Track(uuid string, primary *ingressv1.DeviceIdentity) {
+	uuid = strings.TrimSpace(uuid)
+	if uuid == "" {
+		return
+	}
+	sub := &ingressv1.CommandSubscription{Uuid: uuid, PrimaryIdentity: primary}
+	w.mu.Lock()
+	if existing, ok := w.targets[uuid]; ok && proto.Equal(existing, sub) {
+		w.mu.Unlock()
+		return
+	}
+	w.targets[uuid] = sub
+	w.mu.Unlock()
+	w.signal()
+}
+
+// Untrack 把设备移出订阅集合。
+func (w *Watcher) Untrack(uuid string) {
+	uuid = strings.TrimSpace(uuid)
+	w.mu.Lock()
+	_, ok := w.targets[uuid]
+	delete(w.targets, uuid)
+	w.mu.Unlock()
+	if ok {
+		w.signal()
+	}
+}
+
+// Tracked 返回当前订阅的设备 UUID。
+func (w *Watcher) Tracked() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]string, 0, len(w.targets))
+	for uuid := range w.targets {
+		out = append(out, uuid)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Run 保持推送流直到 ctx 取消。
+func (w *Watcher) Run(ctx context.Context) {
+	for {
+		subs := w.subscriptions()
+		if len(subs) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.changed:
+				continue
+			}
+		}
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- w.core.WatchCommands(streamCtx, w.request(subs), func(resp *ingressv1.WatchCommandsResponse) error {
+				// 命令处理使用外层 ctx，重新订阅取消推送流时不会打断正在进行的下发与状态回填。
+				w.dispatch(ctx, resp)
+				return nil
+			})
+		}()
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return
+		case <-w.changed:
+			if !w.wait(ctx, w.opts.ResubscribeDelay) {
+				cancel()
+				<-done
+				return
+			}
+			// 等待期间的后续变化会在下一轮一并生效。
+			select {
+			case <-w.changed:
+			default:
+			}
+			cancel()
+			<-done
+		case err := <-done:
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			w.logger.Warn("下行推送流已断开，稍后重连", "error", err, "devices", len(subs))
+			if !w.wait(ctx, w.opts.RetryInterval) {
+				return
+			}
+		}
+	}
+}
+
+func (w *Watcher) dispatch(ctx context.Context, resp *ingressv1.WatchCommandsResponse) {
+	for _, cmd := range resp.GetCommands() {
+		w.handle(ctx, cmd)
+	}
+	if resp.GetCursor() > 0 {
+		w.mu.Lock()
+		w.cursor = resp.GetCursor()
+		w.mu.Unlock()
+	}
+}
+
+func (w *Watcher) request(subs []*ingressv1.CommandSubscription) *ingressv1.WatchCommandsRequest {
+	w.mu.Lock()
+	cursor := w.cursor
+	w.mu.Unlock()
+	req := &ingressv1.WatchCommandsRequest{
+		Subscriptions: subs,
+		Cursor:        cursor,
+		MaxBatch:      int32(w.opts.MaxBatch),
+	}
+	if w.opts.Context != nil {
+		req.Context = w.opts.Context()
+	}
+	return req
+}
+
+func (w *Watcher) subscriptions() []*ingressv1.CommandSubscription {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]*ingressv1.CommandSubscription, 0, len(w.targets))
+	for _, sub := range w.targets {
+		out = append(out, sub)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetUuid() < out[j].GetUuid() })
+	return out
+}
+
+func (w *Watcher) signal() {
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Watcher) wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,116 @@
+package commandwatch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nhirsama/Goster-IoT/proto/gen/goster/ingress/v1"
+	"github.com/nhirsama/Goster-IoT/protocol-ingress/internal/coreclient"
+)
+
+type fakeCore struct {
+	coreclient.Client
+	mu       sync.Mutex
+	requests []*ingressv1.WatchCommandsRequest
+	batches  chan *ingressv1.WatchCommandsResponse
+}
+
+func (f *fakeCore) WatchCommands(ctx context.Context, req *ingressv1.WatchCommandsRequest, handle func(*ingressv1.WatchCommandsResponse) error) error {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case batch, ok := <-f.batches:
+			if !ok {
+				return errors.New("stream closed")
+			}
+			if batch == nil {
+				return errors.New("stream reset")
+			}
+			if err := handle(batch); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (f *fakeCore) requestsSnapshot() []*ingressv1.WatchCommandsRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*ingressv1.WatchCommandsRequest(nil), f.requests...)
+}
+
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal(msg)
+}
+
+func TestWatcherSubscribesTrackedDevicesAndResumesFromCursor(t *testing.T) {
+	core := &fakeCore{batches: make(chan *ingressv1.WatchCommandsResponse)}
+	handled := make(chan int64, 4)
+	w := New(core, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{
+		Context:          func() *ingressv1.IngressContext { return &ingressv1.IngressContext{AdapterId: "custom_tcp"} },
+		MaxBatch:         4,
+		RetryInterval:    10 * time.Millisecond,
+		ResubscribeDelay: time.Millisecond,
+	}, func(ctx context.Context, cmd *ingressv1.CanonicalCommand) {
+		handled <- cmd.GetCommandId()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	// 没有订阅设备时不应建立推送流。
+	time.Sleep(20 * time.Millisecond)
+	if got := core.requestsSnapshot(); len(got) != 0 {
+		t.Fatalf("watcher should stay idle without devices, got %+v", got)
+	}
+
+	w.Track("dev-1", &ingressv1.DeviceIdentity{Type: "uuid", Value: "dev-1"})
+	waitFor(t, func() bool { return len(core.requestsSnapshot()) == 1 }, "expected stream to open after Track")
+	first := core.requestsSnapshot()[0]
+	if len(first.GetSubscriptions()) != 1 || first.GetSubscriptions()[0].GetUuid() != "dev-1" || first.GetMaxBatch() != 4 || first.GetContext().GetAdapterId() != "custom_tcp" || first.GetCursor() != 0 {
+		t.Fatalf("unexpected first request: %+v", first)
+	}
+
+	core.batches <- &ingressv1.WatchCommandsResponse{Commands: []*ingressv1.CanonicalCommand{{CommandId: 5, Uuid: "dev-1"}}, Cursor: 100}
+	if got := <-handled; got != 5 {
+		t.Fatalf("unexpected handled command: %d", got)
+	}
+
+	// 重复 Track 相同身份不触发重新订阅；流异常断开后应携带游标重连。
+	w.Track("dev-1", &ingressv1.DeviceIdentity{Type: "uuid", Value: "dev-1"})
+	core.batches <- nil
+	waitFor(t, func() bool { return len(core.requestsSnapshot()) == 2 }, "expected reconnect after stream reset")
+	if second := core.requestsSnapshot()[1]; second.GetCursor() != 100 {
+		t.Fatalf("reconnect should resume from cursor, got %+v", second)
+	}
+
+	w.Track("dev-2", nil)
+	waitFor(t, func() bool { return len(core.requestsSnapshot()) == 3 }, "expected resubscribe after device change")
+	third := core.requestsSnapshot()[2]
+	if len(third.GetSubscriptions()) != 2 || third.GetSubscriptions()[1].GetUuid() != "dev-2" {
+		t.Fatalf("unexpected resubscribe request: %+v", third)
+	}
+
+	w.Untrack("dev-1")
+	w.Untrack("dev-2")
+	if tracked := w.Tracked(); len(tracked) != 0 {
+		t.Fatalf("expected no tracked devices, got %v", tracked)
+	}
+}
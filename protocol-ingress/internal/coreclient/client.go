@@ -22,6 +22,8 @@ type Client interface {
 	IngestEvents(ctx context.Context, req *ingressv1.IngestEventsRequest) (*ingressv1.IngestEventsResponse, error)
 	PullCommands(ctx context.Context, req *ingressv1.PullCommandsRequest) (*ingressv1.PullCommandsResponse, error)
 	UpdateCommandStatus(ctx context.Context, req *ingressv1.UpdateCommandStatusRequest) (*ingressv1.UpdateCommandStatusResponse, error)
+	// WatchCommands 打开下行命令推送流并把每个批次交给 handle，直到流结束、ctx 取消或 handle 返回错误。
+	WatchCommands(ctx context.Context, req *ingressv1.WatchCommandsRequest, handle func(*ingressv1.WatchCommandsResponse) error) error
 }
 
 type RemoteClient struct {
@@ -150,6 +152,27 @@ func (c *RemoteClient) UpdateCommandStatus(ctx context.Context, req *ingressv1.U
 	return resp.Msg, nil
 }
 
+// WatchCommands 是长连接调用，不套用单次 RPC 超时，由调用方通过 ctx 控制生命周期。
+func (c *RemoteClient) WatchCommands(ctx context.Context, req *ingressv1.WatchCommandsRequest, handle func(*ingressv1.WatchCommandsResponse) error) error {
+	if req == nil {
+		return errors.New("WatchCommandsRequest 不能为空")
+	}
+	if handle == nil {
+		return errors.New("WatchCommands handle 不能为空")
+	}
+	stream, err := c.client.WatchCommands(ctx, connect.NewRequest(req))
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	for stream.Receive() {
+		if err := handle(stream.Msg()); err != nil {
+			return err
+		}
+	}
+	return stream.Err()
+}
+
 func (c *RemoteClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -157,13 +180,26 @@ func (c *RemoteClient) withTimeout(ctx context.Context) (context.Context, contex
 	return context.WithTimeout(ctx, c.cfg.Timeout)
 }
 
-func bearerTokenInterceptor(token string) connect.UnaryInterceptorFunc {
-	return func(next connect.UnaryFunc) connect.UnaryFunc {
-		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
-			req.Header().Set("Authorization", "Bearer "+token)
-			return next(ctx, req)
-		}
+// bearerTokenInterceptor 同时覆盖普通调用和推送流，两者都需要携带服务间凭据。
+type bearerTokenInterceptor string
+
+func (t bearerTokenInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		req.Header().Set("Authorization", "Bearer "+string(t))
+		return next(ctx, req)
+	}
+}
+
+func (t bearerTokenInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		conn.RequestHeader().Set("Authorization", "Bearer "+string(t))
+		return conn
 	}
 }
 
+func (t bearerTokenInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
 var _ Client = (*RemoteClient)(nil)
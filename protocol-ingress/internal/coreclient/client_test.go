@@ -23,6 +23,8 @@ type fakeCoreService struct {
 	ingestReq       *ingressv1.IngestEventsRequest
 	pullReq         *ingressv1.PullCommandsRequest
 	updateStatusReq *ingressv1.UpdateCommandStatusRequest
+	watchReq        *ingressv1.WatchCommandsRequest
+	watchAuthHeader string
 }
 
 func (f *fakeCoreService) AuthenticateDevice(ctx context.Context, req *connect.Request[ingressv1.AuthenticateDeviceRequest]) (*connect.Response[ingressv1.AuthenticateDeviceResponse], error) {
@@ -56,6 +58,15 @@ func (f *fakeCoreService) UpdateCommandStatus(ctx context.Context, req *connect.
 	return connect.NewResponse(&ingressv1.UpdateCommandStatusResponse{Success: true, Status: req.Msg.Status}), nil
 }
 
+func (f *fakeCoreService) WatchCommands(ctx context.Context, req *connect.Request[ingressv1.WatchCommandsRequest], stream *connect.ServerStream[ingressv1.WatchCommandsResponse]) error {
+	f.watchReq = req.Msg
+	f.watchAuthHeader = req.Header().Get("Authorization")
+	if err := stream.Send(&ingressv1.WatchCommandsResponse{Keepalive: true}); err != nil {
+		return err
+	}
+	return stream.Send(&ingressv1.WatchCommandsResponse{Commands: []*ingressv1.CanonicalCommand{{CommandId: 8, Uuid: "dev-1"}}, Cursor: 11})
+}
+
 func newTestClient(t *testing.T, svc *fakeCoreService) (*RemoteClient, func()) {
 	t.Helper()
 	mux := http.NewServeMux()
@@ -121,6 +132,18 @@ func TestRemoteClientCallsAllRPCsAndAddsBearerToken(t *testing.T) {
 	if svc.updateStatusReq.GetObservedAt() == nil || svc.updateStatusReq.GetStatus() != ingressv1.CommandStatus_COMMAND_STATUS_SENT {
 		t.Fatalf("unexpected status req: %+v", svc.updateStatusReq)
 	}
+
+	var batches []*ingressv1.WatchCommandsResponse
+	err = client.WatchCommands(ctx, &ingressv1.WatchCommandsRequest{Subscriptions: []*ingressv1.CommandSubscription{{Uuid: "dev-1"}}, Cursor: 10}, func(resp *ingressv1.WatchCommandsResponse) error {
+		batches = append(batches, resp)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WatchCommands failed: %v", err)
+	}
+	if len(batches) != 2 || batches[1].GetCursor() != 11 || svc.watchReq.GetCursor() != 10 || svc.watchAuthHeader != "Bearer secret" {
+		t.Fatalf("unexpected watch result/header/req: batches=%+v header=%q req=%+v", batches, svc.watchAuthHeader, svc.watchReq)
+	}
 }
 
 func TestRemoteClientRejectsNilRequests(t *testing.T) {
@@ -93,6 +93,7 @@ func (n *Canonical) NormalizeEvent(_ context.Context, event adapter.AdapterEvent
 		Availability:    mapAvailability(event.Availability),
 		CommandReceipt:  receipt(event.Receipt),
 		Raw:             raw(event.RawContentType, event.Raw),
+		Children:        children(event.Children),
 	}
 	if out.PrimaryIdentity == nil && event.UUID != "" {
 		out.PrimaryIdentity = &ingressv1.DeviceIdentity{Type: "uuid", Value: event.UUID}
@@ -137,6 +138,7 @@ func (n *Canonical) NormalizeCommand(_ context.Context, command *ingressv1.Canon
 		Operation:           command.Operation,
 		ProtocolCommandCode: command.ProtocolCommandCode,
 		Target:              adapter.Identity{Type: command.TargetIdentity.GetType(), Value: command.TargetIdentity.GetValue(), Issuer: command.TargetIdentity.GetIssuer()},
+		TargetEntityID:      command.TargetEntityId,
 		Payload:             payload,
 		PayloadContentType:  contentType,
 		Properties:          cloneStringMap(command.Properties),
@@ -310,12 +312,49 @@ func device(in *adapter.DeviceDescriptor) *ingressv1.DeviceDescriptor {
 		FirmwareVersion: in.FirmwareVersion,
 		DeviceType:      in.DeviceType,
 		NetworkAddress:  in.NetworkAddress,
+		ParentUuid:      in.ParentUUID,
 		Identities:      identities(in.Identities),
+		Capabilities:    capabilities(in.Capabilities),
 		Labels:          cloneStringMap(in.Labels),
 		Attributes:      attrs,
 	}
 }
 
+func capabilities(items []adapter.Capability) []*ingressv1.CapabilityDescriptor {
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]*ingressv1.CapabilityDescriptor, 0, len(items))
+	for _, item := range items {
+		out = append(out, &ingressv1.CapabilityDescriptor{
+			Name:          item.Name,
+			Property:      item.Property,
+			Type:          item.Type,
+			Access:        item.Access,
+			Readable:      item.Readable,
+			Writable:      item.Writable,
+			Unit:          item.Unit,
+			ValueMin:      item.ValueMin,
+			ValueMax:      item.ValueMax,
+			Description:   item.Description,
+			AllowedValues: append([]string(nil), item.AllowedValues...),
+			Features:      capabilities(item.Features),
+		})
+	}
+	return out
+}
+
+func children(items []adapter.DeviceDescriptor) []*ingressv1.DeviceDescriptor {
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]*ingressv1.DeviceDescriptor, 0, len(items))
+	for i := range items {
+		out = append(out, device(&items[i]))
+	}
+	return out
+}
+
 func metrics(items []adapter.MetricPoint) []*ingressv1.MetricPoint {
 	out := make([]*ingressv1.MetricPoint, 0, len(items))
 	for _, item := range items {
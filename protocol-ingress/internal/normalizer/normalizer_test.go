@@ -78,6 +78,31 @@ func TestNormalizeEventBuildsCanonicalModel(t *testing.T) {
 	}
 }
 
+func TestNormalizeTopologyEventKeepsChildren(t *testing.T) {
+	out, err := New("ingress-test").NormalizeEvent(context.Background(), adapter.AdapterEvent{
+		UUID:   "gw-1",
+		Kind:   "topology",
+		Device: &adapter.DeviceDescriptor{UUID: "gw-1", DeviceType: "gateway", ParentUUID: "gw-root"},
+		Children: []adapter.DeviceDescriptor{
+			{UUID: "node-1", DeviceType: "router", NetworkAddress: "0x01", Capabilities: []adapter.Capability{
+				{Type: "light", Features: []adapter.Capability{{Property: "brightness", Type: "numeric", Writable: true, ValueMax: "254"}}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NormalizeEvent failed: %v", err)
+	}
+	if out.EventType != ingressv1.EventType_EVENT_TYPE_TOPOLOGY || out.Device.GetParentUuid() != "gw-root" {
+		t.Fatalf("unexpected topology event: %+v", out)
+	}
+	if len(out.Children) != 1 || out.Children[0].GetUuid() != "node-1" || out.Children[0].GetNetworkAddress() != "0x01" {
+		t.Fatalf("unexpected children: %+v", out.Children)
+	}
+	if caps := out.Children[0].GetCapabilities(); len(caps) != 1 || caps[0].GetFeatures()[0].GetValueMax() != "254" {
+		t.Fatalf("capabilities should be carried on children: %+v", caps)
+	}
+}
+
 func ptrBool(v bool) *bool { return &v }
 
 func TestNormalizeEventIDDeterministic(t *testing.T) {
@@ -118,6 +143,7 @@ func TestNormalizeCommandMapsRawPayloadAndOptions(t *testing.T) {
 		TenantId:            "tenant-a",
 		Uuid:                "dev-1",
 		TargetIdentity:      &ingressv1.DeviceIdentity{Type: "uuid", Value: "dev-1"},
+		TargetEntityId:      "dev-1.config",
 		Operation:           "config_push",
 		ProtocolCommandCode: 0x0201,
 		Payload:             &ingressv1.RawPayload{ContentType: "application/json", Body: []byte(`{"a":1}`)},
@@ -133,6 +159,9 @@ func TestNormalizeCommandMapsRawPayloadAndOptions(t *testing.T) {
 	if out.CommandID != 42 || out.ProtocolCommandCode != 0x0201 || out.Operation != "config_push" || string(out.Payload) != `{"a":1}` {
 		t.Fatalf("unexpected command: %+v", out)
 	}
+	if out.TargetEntityID != "dev-1.config" {
+		t.Fatalf("unexpected target entity: %q", out.TargetEntityID)
+	}
 	if out.Options["qos"] != "1" || out.Timeout != 2*time.Second || out.MaxAttempts != 3 {
 		t.Fatalf("unexpected command options: %+v", out)
 	}
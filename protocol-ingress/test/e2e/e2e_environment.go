@@ -429,6 +429,33 @@ func (m *MockCoreService) PullCommands(ctx context.Context, req *ingressv1.PullC
 	}, nil
 }
 
+// WatchCommands 周期检查订阅设备的待下发命令并推送，模拟 Core API 的推送流。
+func (m *MockCoreService) WatchCommands(ctx context.Context, req *ingressv1.WatchCommandsRequest, handle func(*ingressv1.WatchCommandsResponse) error) error {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	var cursor int64
+	for {
+		for _, sub := range req.GetSubscriptions() {
+			resp, err := m.PullCommands(ctx, &ingressv1.PullCommandsRequest{Uuid: sub.GetUuid(), MaxCount: req.GetMaxBatch()})
+			if err != nil {
+				return err
+			}
+			if len(resp.GetCommands()) == 0 {
+				continue
+			}
+			cursor++
+			if err := handle(&ingressv1.WatchCommandsResponse{Commands: resp.GetCommands(), Cursor: cursor}); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 func (m *MockCoreService) UpdateCommandStatus(ctx context.Context, req *ingressv1.UpdateCommandStatusRequest) (*ingressv1.UpdateCommandStatusResponse, error) {
 	m.mu.Lock()
 	m.updates = append(m.updates, req)
@@ -465,6 +492,10 @@ func (m *MockCoreClient) PullCommands(ctx context.Context, req *ingressv1.PullCo
 	return m.mockCore.PullCommands(ctx, req)
 }
 
+func (m *MockCoreClient) WatchCommands(ctx context.Context, req *ingressv1.WatchCommandsRequest, handle func(*ingressv1.WatchCommandsResponse) error) error {
+	return m.mockCore.WatchCommands(ctx, req, handle)
+}
+
 func (m *MockCoreClient) UpdateCommandStatus(ctx context.Context, req *ingressv1.UpdateCommandStatusRequest) (*ingressv1.UpdateCommandStatusResponse, error) {
 	return m.mockCore.UpdateCommandStatus(ctx, req)
 }